@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+	"image-gen-service/internal/testutil"
+)
+
+// chatErrorStub 模拟 OpenAI 兼容对话接口按固定状态码失败；x-should-retry 关闭 SDK 自动重试
+func chatErrorStub(t *testing.T, status int) string {
+	t.Helper()
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-should-retry", "false")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"message":"stub failure","type":"server_error"}}`))
+	}))
+	t.Cleanup(stub.Close)
+	return stub.URL
+}
+
+func createProviderConfig(t *testing.T, cfg model.ProviderConfig) {
+	t.Helper()
+	if err := model.DB.Create(&cfg).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitStorageHealth 等待存储自检结果切换；自检结果有最小间隔缓存，需要轮询
+func waitStorageHealth(t *testing.T, available bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for storage.CheckHealth().Available != available {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待存储可用状态变为 %v 超时", available)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestHandlerErrorCodes 各处理器错误路径返回稳定的 error_code，前端依赖它区分提示与重试策略
+func TestHandlerErrorCodes(t *testing.T) {
+	generate := map[string]interface{}{"provider": "fake", "model_id": "fake", "params": map[string]interface{}{"prompt": "x"}}
+	cases := []struct {
+		name       string
+		opts       testutil.Options
+		setup      func(t *testing.T, srv *httptest.Server)
+		method     string
+		path       string
+		body       interface{}
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:   "生成时 Provider 不存在",
+			method: http.MethodPost, path: "/api/v1/tasks/generate",
+			body:       map[string]interface{}{"provider": "missing", "params": map[string]interface{}{"prompt": "x"}},
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeProviderNotFound,
+		},
+		{
+			name:   "生成请求体不是 JSON",
+			method: http.MethodPost, path: "/api/v1/tasks/generate", body: "not json",
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeValidationFailed,
+		},
+		{
+			name:   "对比缺少参数",
+			method: http.MethodGet, path: "/api/v1/tasks/compare?a=x",
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeValidationFailed,
+		},
+		{
+			name:   "任务不存在",
+			method: http.MethodGet, path: "/api/v1/tasks/missing",
+			wantStatus: http.StatusNotFound, wantCode: model.ErrCodeTaskNotFound,
+		},
+		{
+			name:   "删除不存在的图片",
+			method: http.MethodDelete, path: "/api/v1/images/missing",
+			wantStatus: http.StatusNotFound, wantCode: model.ErrCodeTaskNotFound,
+		},
+		{
+			name:   "作业不存在",
+			method: http.MethodGet, path: "/api/v1/jobs/missing",
+			wantStatus: http.StatusNotFound, wantCode: model.ErrCodeNotFound,
+		},
+		{
+			name: "相似图片缺少感知哈希",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				testutil.CreateTask(t, &model.Task{TaskID: "no-phash"})
+			},
+			method: http.MethodGet, path: "/api/v1/images/no-phash/similar",
+			wantStatus: http.StatusConflict, wantCode: model.ErrCodeConflict,
+		},
+		{
+			name:   "调试接口未开启",
+			method: http.MethodGet, path: "/api/v1/tasks/missing/debug",
+			wantStatus: http.StatusForbidden, wantCode: model.ErrCodeUnauthorized,
+		},
+		{
+			name: "Provider 调试接口未开启",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				createProviderConfig(t, model.ProviderConfig{ProviderName: "openai", DisplayName: "OpenAI"})
+			},
+			method: http.MethodGet, path: "/api/v1/providers/openai/debug",
+			wantStatus: http.StatusForbidden, wantCode: model.ErrCodeUnauthorized,
+		},
+		{
+			name: "模型列表缺少 API Key",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				createProviderConfig(t, model.ProviderConfig{ProviderName: "openai", DisplayName: "OpenAI", APIBase: "http://127.0.0.1:1"})
+			},
+			method: http.MethodGet, path: "/api/v1/providers/openai/models",
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeProviderKeyMissing,
+		},
+		{
+			name:   "优化提示词时对话 Provider 未配置",
+			method: http.MethodPost, path: "/api/v1/prompts/optimize",
+			body:       map[string]interface{}{"prompt": "a cat", "provider": "openai-chat"},
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeProviderNotFound,
+		},
+		{
+			name: "优化提示词时上游限流",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				createProviderConfig(t, model.ProviderConfig{ProviderName: "openai-chat", APIBase: chatErrorStub(t, http.StatusTooManyRequests), APIKey: "k"})
+			},
+			method: http.MethodPost, path: "/api/v1/prompts/optimize",
+			body:       map[string]interface{}{"prompt": "a cat", "provider": "openai-chat", "model": "m"},
+			wantStatus: http.StatusTooManyRequests, wantCode: model.ErrCodeRateLimited,
+		},
+		{
+			name: "优化提示词时上游异常",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				createProviderConfig(t, model.ProviderConfig{ProviderName: "openai-chat", APIBase: chatErrorStub(t, http.StatusServiceUnavailable), APIKey: "k"})
+			},
+			method: http.MethodPost, path: "/api/v1/prompts/optimize",
+			body:       map[string]interface{}{"prompt": "a cat", "provider": "openai-chat", "model": "m"},
+			wantStatus: http.StatusBadGateway, wantCode: model.ErrCodeUpstreamError,
+		},
+		{
+			name: "维护模式拒绝新任务",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				if resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/maintenance/enable", nil); resp.StatusCode != http.StatusOK {
+					t.Fatalf("开启维护模式失败: %s", out.Message)
+				}
+				t.Cleanup(func() { doJSON(t, srv, http.MethodPost, "/api/v1/maintenance/disable", nil) })
+			},
+			method: http.MethodPost, path: "/api/v1/tasks/generate", body: generate,
+			wantStatus: http.StatusServiceUnavailable, wantCode: model.ErrCodeMaintenance,
+		},
+		{
+			name: "维护模式拒绝导入图片",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				if resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/maintenance/enable", nil); resp.StatusCode != http.StatusOK {
+					t.Fatalf("开启维护模式失败: %s", out.Message)
+				}
+				t.Cleanup(func() { doJSON(t, srv, http.MethodPost, "/api/v1/maintenance/disable", nil) })
+			},
+			method: http.MethodPost, path: "/api/v1/images/import",
+			wantStatus: http.StatusServiceUnavailable, wantCode: model.ErrCodeMaintenance,
+		},
+		{
+			name: "超出每日费用预算",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				createProviderConfig(t, model.ProviderConfig{ProviderName: "fake", DisplayName: "Fake", Enabled: true,
+					ExtraConfig: `{"max_cost_per_day":0.5,"cost_per_image":1}`})
+			},
+			method: http.MethodPost, path: "/api/v1/tasks/generate", body: generate,
+			wantStatus: http.StatusTooManyRequests, wantCode: model.ErrCodeBudgetExceeded,
+		},
+		{
+			name: "队列已满",
+			opts: testutil.Options{Workers: 1, QueueSize: 1, Config: func(cfg *config.Config) {
+				cfg.Tasks.SubmitWaitMs = 0
+			}},
+			setup: func(t *testing.T, srv *httptest.Server) {
+				// 一个任务占住 worker，一个任务占满队列；不等待名额时第三次提交立即被拒绝
+				for i := 0; i < 2; i++ {
+					submitGenerate(t, srv, map[string]interface{}{"prompt": "x", "fake_delay_ms": 1000})
+				}
+			},
+			method: http.MethodPost, path: "/api/v1/tasks/generate", body: generate,
+			wantStatus: http.StatusServiceUnavailable, wantCode: model.ErrCodeQueueFull,
+		},
+		{
+			name: "存储空间不足",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				storage.MinFreeBytes = math.MaxUint64
+				waitStorageHealth(t, false)
+				t.Cleanup(func() {
+					storage.MinFreeBytes = 0
+					waitStorageHealth(t, true)
+				})
+			},
+			method: http.MethodPost, path: "/api/v1/tasks/generate", body: generate,
+			wantStatus: http.StatusServiceUnavailable, wantCode: model.ErrCodeStorageUnavailable,
+		},
+		{
+			name: "存储空间不足时拒绝导入图片",
+			setup: func(t *testing.T, srv *httptest.Server) {
+				storage.MinFreeBytes = math.MaxUint64
+				waitStorageHealth(t, false)
+				t.Cleanup(func() {
+					storage.MinFreeBytes = 0
+					waitStorageHealth(t, true)
+				})
+			},
+			method: http.MethodPost, path: "/api/v1/images/import",
+			wantStatus: http.StatusServiceUnavailable, wantCode: model.ErrCodeStorageUnavailable,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			if opts.Workers == 0 {
+				opts.NoPool = true
+			}
+			_, srv := setupServer(t, opts)
+			if tc.setup != nil {
+				tc.setup(t, srv)
+			}
+			resp, out := doJSON(t, srv, tc.method, tc.path, tc.body)
+			if resp.StatusCode != tc.wantStatus || out.ErrorCode != tc.wantCode {
+				t.Fatalf("%s %s = %d %s (%s)，期望 %d %s", tc.method, tc.path, resp.StatusCode, out.ErrorCode, out.Message, tc.wantStatus, tc.wantCode)
+			}
+			if out.Code != tc.wantStatus {
+				t.Fatalf("响应 code = %d，期望与 HTTP 状态码一致 %d", out.Code, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errLockHeld 锁文件已被其他进程持有
+var errLockHeld = errors.New("实例锁已被占用")
+
+// instanceLock 单实例锁：同一应用目录下只允许一个后端进程运行，
+// 防止 Tauri 崩溃重启后出现两个进程同时写同一个 SQLite 文件
+type instanceLock struct {
+	file *os.File
+}
+
+// acquireInstanceLock 获取单实例锁；若已有存活实例持有锁，返回其 PID 与 errLockHeld
+// 锁被占用但记录的进程已不存在时视为残留锁，删除后接管
+func acquireInstanceLock(path string) (*instanceLock, int, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := lockFile(f); err == nil {
+			if err := writeLockPID(f); err != nil {
+				log.Printf("写入实例锁 PID 失败: %v", err)
+			}
+			return &instanceLock{file: f}, 0, nil
+		} else if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, 0, err
+		}
+
+		holder := readLockPID(f)
+		f.Close()
+		if holder <= 0 || processAlive(holder) {
+			return nil, holder, errLockHeld
+		}
+		log.Printf("实例锁由已退出的进程 %d 持有，正在接管", holder)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("清理残留实例锁失败: %w", err)
+		}
+	}
+	return nil, 0, errLockHeld
+}
+
+// Release 释放单实例锁；锁文件本身保留，避免删除时与新进程加锁产生竞争
+func (l *instanceLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	if err := unlockFile(l.file); err != nil {
+		log.Printf("释放实例锁失败: %v", err)
+	}
+	l.file.Close()
+	l.file = nil
+}
+
+func writeLockPID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readLockPID(f *os.File) int {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 32))
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// waitForRunningInstance 等待已运行实例写出端口文件（对方可能仍在启动中）
+func waitForRunningInstance(portFile string, pid int, timeout time.Duration) (*serverInfo, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := readPortFile(portFile)
+		if err == nil && info.Port > 0 && (pid <= 0 || info.PID == pid) {
+			return info, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("端口文件记录的进程 %d 与锁持有者 %d 不一致", info.PID, pid)
+			}
+			return nil, err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
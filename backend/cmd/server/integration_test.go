@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider/fake"
+	"image-gen-service/internal/testutil"
+)
+
+func TestGenerateStreamsUntilSettled(t *testing.T) {
+	env, srv := setupServer(t, testutil.Options{Fake: fake.Config{Delay: 50 * time.Millisecond, Width: 64, Height: 64}})
+
+	taskID := submitGenerate(t, srv, map[string]interface{}{"prompt": "a red fox", "count": 2})
+	events := readTaskStream(t, srv, taskID)
+
+	last := events[len(events)-1]
+	if last.Status != "completed" {
+		t.Fatalf("最终状态 = %q (%s)，期望 completed", last.Status, last.ErrorMessage)
+	}
+	if last.ThumbStatus == model.ThumbnailPending {
+		t.Fatal("SSE 在缩略图生成完成前结束")
+	}
+	if env.Fake.Calls() != 1 {
+		t.Fatalf("Provider 调用次数 = %d，期望 1", env.Fake.Calls())
+	}
+
+	task := testutil.WaitTask(t, taskID, 5*time.Second, testutil.Settled)
+	if task.LocalPath == "" || task.ThumbnailPath == "" {
+		t.Fatalf("任务缺少原图或缩略图: local=%q thumb=%q", task.LocalPath, task.ThumbnailPath)
+	}
+	if _, err := os.Stat(task.LocalPath); err != nil {
+		t.Fatalf("原图未写入存储目录: %v", err)
+	}
+}
+
+func TestGenerateFailureIsStreamed(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{})
+
+	taskID := submitGenerate(t, srv, map[string]interface{}{"prompt": "boom", "fake_fail": "上游拒绝"})
+	events := readTaskStream(t, srv, taskID)
+
+	last := events[len(events)-1]
+	if last.Status != "failed" {
+		t.Fatalf("最终状态 = %q，期望 failed", last.Status)
+	}
+	if last.ErrorMessage == "" {
+		t.Fatal("失败任务缺少错误信息")
+	}
+}
+
+func TestGenerateValidation(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{NoPool: true})
+
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+		"provider": "missing",
+		"params":   map[string]interface{}{"prompt": "x"},
+	})
+	if resp.StatusCode != http.StatusBadRequest || out.ErrorCode != model.ErrCodeProviderNotFound {
+		t.Fatalf("未知 Provider: %d %s", resp.StatusCode, out.ErrorCode)
+	}
+
+	resp, out = doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+		"provider": "fake",
+		"params":   map[string]interface{}{},
+	})
+	if resp.StatusCode != http.StatusBadRequest || out.ErrorCode != model.ErrCodeValidationFailed {
+		t.Fatalf("缺少 prompt: %d %s", resp.StatusCode, out.ErrorCode)
+	}
+}
+
+func TestGenerateWithImagesMultipart(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{Fake: fake.Config{Width: 32, Height: 32}})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("provider", "fake")
+	form.WriteField("prompt", "make it blue")
+	form.WriteField("count", "1")
+	for _, size := range []int{16, 24} {
+		part, err := form.CreateFormFile("refImages", "ref.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(testutil.PNG(t, size, size))
+	}
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/tasks/generate-with-images", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, out := send(t, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("提交图生图任务失败 %d: %s", resp.StatusCode, out.Message)
+	}
+	var task model.Task
+	if err := json.Unmarshal(out.Data, &task); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readTaskStream(t, srv, task.TaskID)
+	if last := events[len(events)-1]; last.Status != "completed" {
+		t.Fatalf("最终状态 = %q (%s)", last.Status, last.ErrorMessage)
+	}
+
+	var refs []model.TaskReference
+	model.DB.Where("task_id = ?", task.TaskID).Order("position ASC").Find(&refs)
+	if len(refs) != 2 {
+		t.Fatalf("参考图记录数 = %d，期望 2", len(refs))
+	}
+	if refs[0].Width != 16 || refs[1].Width != 24 {
+		t.Fatalf("参考图顺序或尺寸错误: %+v", refs)
+	}
+}
+
+func TestExportAndDeleteImages(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{Fake: fake.Config{Width: 32, Height: 32}})
+
+	first := submitGenerate(t, srv, map[string]interface{}{"prompt": "one"})
+	second := submitGenerate(t, srv, map[string]interface{}{"prompt": "two"})
+	testutil.WaitTask(t, first, 5*time.Second, testutil.Settled)
+	kept := testutil.WaitTask(t, second, 5*time.Second, testutil.Settled)
+
+	data, _ := json.Marshal(map[string]interface{}{"imageIds": []string{first, second}})
+	resp, err := http.Post(srv.URL+"/api/v1/images/export", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("导出失败 %d: %s", resp.StatusCode, archive)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("导出内容不是 zip: %v", err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, id := range []string{first, second} {
+		if !names[id+".png"] {
+			t.Fatalf("zip 缺少 %s.png，实际 %v", id, names)
+		}
+	}
+
+	resp, out := doJSON(t, srv, http.MethodDelete, "/api/v1/images/"+second, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("删除失败 %d: %s", resp.StatusCode, out.Message)
+	}
+	if _, err := os.Stat(kept.LocalPath); !os.IsNotExist(err) {
+		t.Fatalf("删除后原图仍存在: %v", err)
+	}
+	resp, out = doJSON(t, srv, http.MethodGet, "/api/v1/tasks/"+second, nil)
+	if resp.StatusCode != http.StatusNotFound || out.ErrorCode != model.ErrCodeTaskNotFound {
+		t.Fatalf("删除后查询任务: %d %s", resp.StatusCode, out.ErrorCode)
+	}
+	resp, out = doJSON(t, srv, http.MethodDelete, "/api/v1/images/"+second, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("重复删除: %d %s", resp.StatusCode, out.Message)
+	}
+}
+
+// TestReloadConfigEndpoint 重新加载接口按配置文件与默认值替换运行中的配置，测试中途修改的配置项被还原
+func TestReloadConfigEndpoint(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{NoPool: true, Config: func(cfg *config.Config) { cfg.Tasks.MaxCount = 9 }})
+	previous := config.Get()
+	t.Cleanup(func() { config.Set(previous) })
+
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/maintenance/reload-config", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("重新加载配置失败 %d: %s", resp.StatusCode, out.Message)
+	}
+	if got := config.Get(); got == previous || got.Tasks.MaxCount != 4 {
+		t.Fatalf("重新加载后 tasks.max_count = %d，期望默认值 4", got.Tasks.MaxCount)
+	}
+}
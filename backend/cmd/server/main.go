@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -15,12 +18,12 @@ import (
 
 	"image-gen-service/internal/api"
 	"image-gen-service/internal/config"
+	"image-gen-service/internal/jobs"
 	"image-gen-service/internal/model"
 	"image-gen-service/internal/provider"
+	"image-gen-service/internal/provider/fake"
 	"image-gen-service/internal/storage"
 	"image-gen-service/internal/worker"
-
-	"github.com/gin-gonic/gin"
 )
 
 func getWorkDir() string {
@@ -91,98 +94,74 @@ func getDefaultHost(configuredHost string) string {
 	return "127.0.0.1"
 }
 
+// ossPublicHosts 需要按 storage.public_url_prefix 改写的原始域名：配置的 OSS 访问域名与 Bucket 默认域名
+func ossPublicHosts() []string {
+	oss := config.Get().Storage.OSS
+	hosts := []string{oss.Domain}
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(oss.Endpoint), "https://"), "http://")
+	if oss.BucketName != "" && endpoint != "" {
+		hosts = append(hosts, oss.BucketName+"."+strings.TrimRight(endpoint, "/"))
+	}
+	return hosts
+}
+
 func main() {
+	portFileFlag := flag.String("port-file", "", "写入运行端口信息 (server.json) 的路径，默认位于工作目录")
+	flag.Parse()
+
 	workDir := getWorkDir()
 	log.Printf("Working directory: %s", workDir)
 	_ = os.Chdir(workDir)
 
-	// 1. 初始化配置
-	config.InitConfig()
-
-	// 2. 初始化数据库
-	model.InitDB(config.GlobalConfig.Database.Path)
-
-	// 3. 初始化存储
-	var ossConfig map[string]string
-	if config.GlobalConfig.Storage.OSS.Enabled {
-		ossConfig = map[string]string{
-			"endpoint":        config.GlobalConfig.Storage.OSS.Endpoint,
-			"accessKeyID":     config.GlobalConfig.Storage.OSS.AccessKeyID,
-			"accessKeySecret": config.GlobalConfig.Storage.OSS.AccessKeySecret,
-			"bucketName":      config.GlobalConfig.Storage.OSS.BucketName,
-			"domain":          config.GlobalConfig.Storage.OSS.Domain,
-		}
+	portFile := strings.TrimSpace(*portFileFlag)
+	if portFile == "" {
+		portFile = "server.json"
+	}
+	if abs, err := filepath.Abs(portFile); err == nil {
+		portFile = abs
 	}
-	storage.InitStorage(config.GlobalConfig.Storage.LocalDir, ossConfig)
-
-	// 4. 初始化 Worker 池 (2C2G 服务器，推荐 6 个 worker)
-	worker.InitPool(6, 100)
-	worker.Pool.Start()
-
-	// 5. 注册 Provider
-	provider.InitProviders()
-
-	// 5. 设置路由
-	r := gin.Default()
-
-	// 允许跨域请求
-	r.Use(func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-		log.Printf("[CORS] Request from Origin: %s, Method: %s, Path: %s", origin, c.Request.Method, c.Request.URL.Path)
 
-		if origin != "" {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		} else {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	// 单实例锁：已有实例运行时输出其端口并退出，由启动方直接连接已有实例
+	lockPath, _ := filepath.Abs("server.lock")
+	instance, holderPID, err := acquireInstanceLock(lockPath)
+	if errors.Is(err, errLockHeld) {
+		info, waitErr := waitForRunningInstance(portFile, holderPID, 10*time.Second)
+		if waitErr != nil {
+			log.Fatalf("已有后端实例 (PID %d) 在运行，但无法读取其端口信息: %v", holderPID, waitErr)
 		}
+		log.Printf("已有后端实例 (PID %d) 在运行，端口 %d，本进程退出", info.PID, info.Port)
+		fmt.Printf("SERVER_PORT=%d\n", info.Port)
+		os.Stdout.Sync()
+		os.Exit(0)
+	} else if err != nil {
+		// 无法确定是否有其他实例在运行，数据库中未完成的任务可能属于该实例，启动时不做清理
+		log.Printf("获取实例锁失败，继续启动，不清理中断的任务: %v", err)
+		worker.RecoverInterrupted = false
+	}
+	defer instance.Release()
 
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, *")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+	// 1. 初始化配置
+	config.InitConfig()
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
-
-	v1 := r.Group("/api/v1")
-	{
-		v1.GET("/health", func(c *gin.Context) {
-			api.Success(c, gin.H{"status": "ok", "message": "ok"})
-		})
-		v1.GET("/providers", api.ListProvidersHandler)
-		v1.GET("/providers/config", api.ListProviderConfigsHandler)
-		v1.POST("/providers/config", api.UpdateProviderConfigHandler)
-		v1.POST("/prompts/optimize", api.OptimizePromptHandler)
-		v1.POST("/prompts/image-to-prompt", api.ImageToPromptHandler)
-		v1.POST("/tasks/generate", api.GenerateHandler)
-		v1.POST("/tasks/generate-with-images", api.GenerateWithImagesHandler)
-		v1.GET("/tasks/:task_id", api.GetTaskHandler)
-		v1.GET("/tasks/:task_id/stream", api.StreamTaskHandler)
-		v1.GET("/images", api.ListImagesHandler)
-		v1.POST("/images/export", api.ExportImagesHandler)
-		v1.DELETE("/images/:id", api.DeleteImageHandler)
-		v1.GET("/images/:id/download", api.DownloadImageHandler)
+	// 2. 初始化数据库：数据库只读或被锁定时短暂重试，仍失败则以降级模式启动 HTTP 服务，
+	// 由 /api/v1/startup-status 说明原因，数据库恢复后再完成后续初始化，而不是直接退出
+	cfg := config.Get()
+	model.SlowQueryThreshold = time.Duration(cfg.Observability.SlowQueryMs) * time.Millisecond
+	if !api.RunStartup(cfg.Database.Path, initServices) {
+		log.Printf("数据库不可用，服务以降级模式启动")
 	}
 
-	// 静态资源访问 (将 storage 目录整体暴露，以匹配数据库中的 storage/local/xxx.jpg 路径)
-	// 针对本地存储增加缓存头，优化前端加载性能
-	r.Group("/storage", func(c *gin.Context) {
-		c.Header("Cache-Control", "public, max-age=31536000") // 1年缓存，因为本地文件路径通常包含唯一 ID
-		c.Next()
-	}).Static("", "storage")
+	// 5. 设置路由
+	r := setupRouter()
 
 	// 6. 端口探测与启动
-	port := config.GlobalConfig.Server.Port
+	port := cfg.Server.Port
 	if port <= 0 {
 		port = 8080
 	}
 	// 自动检测运行环境并选择合适的监听地址
-	host := getDefaultHost(config.GlobalConfig.Server.Host)
+	host := getDefaultHost(cfg.Server.Host)
 	var ln net.Listener
-	var err error
 
 	log.Printf("Starting port discovery from %s:%d...", host, port)
 
@@ -208,30 +187,38 @@ func main() {
 	fmt.Printf("SERVER_PORT=%d\n", port)
 	os.Stdout.Sync()
 
-	// 监听标准输入，用于检测父进程是否退出（仅 Tauri 边车模式）
-	// Docker 环境中通过 DISABLE_STDIN_MONITOR 环境变量禁用
+	// 同时写入端口文件：stdout 未被捕获（systemd/nohup）时脚本与健康检查也能发现端口
+	if err := writePortFile(portFile, serverInfo{
+		Port:      port,
+		Scheme:    "http",
+		Host:      host,
+		PID:       os.Getpid(),
+		StartedAt: time.Now(),
+	}); err != nil {
+		log.Printf("写入端口文件失败: %v", err)
+	} else {
+		log.Printf("端口信息已写入 %s", portFile)
+	}
+
+	// 监听标准输入上的父进程心跳，用于检测 Tauri 父进程是否退出；
+	// 从未收到心跳时视为独立运行，不会因标准输入 EOF 退出。DISABLE_STDIN_MONITOR 可显式关闭
 	if os.Getenv("DISABLE_STDIN_MONITOR") == "" {
 		go func() {
-			buf := make([]byte, 1)
-			for {
-				_, err := os.Stdin.Read(buf)
-				if err != nil {
-					log.Printf("检测到标准输入关闭或异常 (%v)，正在安全退出...", err)
-					// 发送退出信号
-					p, _ := os.FindProcess(os.Getpid())
-					p.Signal(syscall.SIGTERM)
-					return
-				}
+			if !watchParentHeartbeat(os.Stdin, stdinHeartbeatInterval, stdinMaxMissedHeartbeats, stdinHeartbeatGrace, time.After) {
+				return
 			}
+			log.Printf("父进程已退出，正在安全退出...")
+			// 父进程已退出，先清理端口文件，避免后续启动读到失效端口
+			removePortFile(portFile)
+			// 发送退出信号
+			p, _ := os.FindProcess(os.Getpid())
+			p.Signal(syscall.SIGTERM)
 		}()
 	} else {
 		log.Println("标准输入监听已禁用（Docker/生产模式）")
 	}
 
-	srv := &http.Server{
-		Addr:    net.JoinHostPort(host, strconv.Itoa(port)),
-		Handler: r,
-	}
+	srv := newHTTPServer(net.JoinHostPort(host, strconv.Itoa(port)), r, cfg)
 
 	go func() {
 		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
@@ -244,9 +231,12 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("正在关闭服务...")
+	removePortFile(portFile)
 
-	// 优雅停止 Worker 池
-	worker.Pool.Stop()
+	// 优雅停止 Worker 池（降级模式下尚未创建）
+	if worker.Pool != nil {
+		worker.Pool.Stop()
+	}
 
 	// 优雅停止 HTTP 服务
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -257,3 +247,55 @@ func main() {
 
 	log.Println("服务已安全退出")
 }
+
+// initServices 数据库就绪后初始化存储、后台任务、Worker 池与 Provider
+func initServices() {
+	cfg := config.Get()
+
+	// 3. 初始化存储
+	var ossConfig map[string]string
+	if cfg.Storage.OSS.Enabled {
+		ossConfig = map[string]string{
+			"endpoint":        cfg.Storage.OSS.Endpoint,
+			"accessKeyID":     cfg.Storage.OSS.AccessKeyID,
+			"accessKeySecret": cfg.Storage.OSS.AccessKeySecret,
+			"bucketName":      cfg.Storage.OSS.BucketName,
+			"domain":          cfg.Storage.OSS.Domain,
+			"prefix":          cfg.Storage.OSS.Prefix,
+		}
+	}
+	localDir := cfg.Storage.LocalDir
+	// 通过设置接口迁移过的图库目录优先于配置文件
+	if dir, ok := model.GetSetting(api.SettingStorageDir); ok && strings.TrimSpace(dir) != "" {
+		localDir = dir
+	}
+	storage.InitStorage(localDir, ossConfig)
+	storage.MinFreeBytes = uint64(max(cfg.Storage.MinFreeMB, 0)) * 1024 * 1024
+	storage.StartSelfCheck()
+	api.ResumeStorageMigration()
+	storage.ThumbnailRefs = model.ReferencedThumbnails
+	storage.SetPublicURL(cfg.Storage.PublicURLPrefix, ossPublicHosts()...)
+	model.PublicURL = storage.PublicURL
+	storage.StartCleanup()
+	api.RegisterJobs()
+	jobs.Start()
+	api.StartRetention()
+	api.StartPendingDeletionRetry()
+	api.LoadMaintenanceMode()
+
+	// 4. 初始化 Worker 池 (2C2G 服务器，推荐 6 个 worker)
+	worker.InitPool(6, 100)
+	worker.OnTaskUpdate(api.InvalidateTask)
+	worker.OnThumbnailUpdate(api.NotifyThumbnailUpdated)
+	worker.Pool.Start()
+	worker.StartThumbnails()
+	api.StartTaskLeaseReaper()
+
+	// 5. 注册 Provider
+	provider.InitProviders()
+	// FAKE_PROVIDER=1 时注册不调用上游的 fake Provider，便于无 API Key 时本地联调
+	if fake.Register() {
+		log.Printf("已注册 fake Provider（FAKE_PROVIDER）")
+	}
+	api.StartProviderHealthMonitor()
+}
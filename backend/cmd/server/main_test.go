@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"image-gen-service/internal/api"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+	"image-gen-service/internal/worker"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	// 启动门禁只需通过一次，之后每个测试由 testutil.Setup 替换数据库与存储
+	if !api.RunStartup(":memory:", nil) {
+		log.Fatal("测试启动失败")
+	}
+	worker.OnTaskUpdate(api.InvalidateTask)
+	worker.OnThumbnailUpdate(api.NotifyThumbnailUpdated)
+	os.Exit(m.Run())
+}
+
+// apiResponse 统一响应，Data 保留原始 JSON 由各测试按需解析
+type apiResponse struct {
+	Code      int             `json:"code"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data"`
+	ErrorCode string          `json:"error_code"`
+}
+
+// newTestServer 以完整路由启动测试服务
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(setupRouter())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doJSON(t *testing.T, srv *httptest.Server, method, path string, body interface{}) (*http.Response, apiResponse) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return send(t, req)
+}
+
+func send(t *testing.T, req *http.Request) (*http.Response, apiResponse) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	var out apiResponse
+	data, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("%s %s 返回非 JSON (%d): %s", req.Method, req.URL.Path, resp.StatusCode, data)
+	}
+	return resp, out
+}
+
+// submitGenerate 提交文生图任务并返回任务 ID
+func submitGenerate(t *testing.T, srv *httptest.Server, params map[string]interface{}) string {
+	t.Helper()
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+		"provider": "fake",
+		"model_id": "fake",
+		"params":   params,
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("提交任务失败 %d: %s (%s)", resp.StatusCode, out.Message, out.ErrorCode)
+	}
+	var task model.Task
+	if err := json.Unmarshal(out.Data, &task); err != nil || task.TaskID == "" {
+		t.Fatalf("响应缺少 task_id: %s", out.Data)
+	}
+	return task.TaskID
+}
+
+// readTaskStream 读取任务 SSE 直到服务端结束推送，返回全部事件
+func readTaskStream(t *testing.T, srv *httptest.Server, taskID string) []model.Task {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/api/v1/tasks/" + taskID + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var events []model.Task
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var task model.Task
+		if err := json.Unmarshal([]byte(line), &task); err != nil {
+			t.Fatalf("解析 SSE 事件失败: %v: %s", err, line)
+		}
+		events = append(events, task)
+	}
+	if len(events) == 0 {
+		t.Fatal("SSE 未推送任何事件")
+	}
+	return events
+}
+
+func setupServer(t *testing.T, opts testutil.Options) (*testutil.Env, *httptest.Server) {
+	t.Helper()
+	env := testutil.Setup(t, opts)
+	return env, newTestServer(t)
+}
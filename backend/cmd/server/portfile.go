@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// serverInfo 写入 server.json 的运行信息，供 Tauri 外壳、脚本与健康检查发现后端端口
+type serverInfo struct {
+	Port      int       `json:"port"`
+	Scheme    string    `json:"scheme"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// writePortFile 原子写入端口文件（先写临时文件再重命名，读取方不会读到半个文件）
+func writePortFile(path string, info serverInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readPortFile 读取端口文件
+func readPortFile(path string) (*serverInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info serverInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// removePortFile 删除端口文件；仅删除当前进程写入的文件，避免误删其他实例的记录
+func removePortFile(path string) {
+	if path == "" {
+		return
+	}
+	info, err := readPortFile(path)
+	if err != nil {
+		return
+	}
+	if info.PID != os.Getpid() {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除端口文件失败: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+// imageStub 模拟 OpenAI 兼容生图接口：每次请求延迟返回一张图片，并记录收到的 API Key
+type imageStub struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]int
+}
+
+func newImageStub(t *testing.T, delay time.Duration) *imageStub {
+	t.Helper()
+	png := base64.StdEncoding.EncodeToString(testutil.PNG(t, 64, 64))
+	stub := &imageStub{keys: map[string]int{}}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		stub.keys[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]++
+		stub.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":[{"b64_json":%q}]}`, png)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func updateProviderConfig(t *testing.T, srv *httptest.Server, body map[string]interface{}) {
+	t.Helper()
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/providers/config", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("更新 Provider 配置失败 %d: %s", resp.StatusCode, out.Message)
+	}
+}
+
+// TestProviderReloadWhileTasksRun 任务执行期间反复保存 Provider 配置并替换全局配置，
+// 在途任务继续使用旧客户端完成，新任务使用新配置；配合 -race 检查注册表替换与配置读取
+func TestProviderReloadWhileTasksRun(t *testing.T) {
+	const (
+		tasks   = 16
+		reloads = 40
+	)
+	stub := newImageStub(t, 150*time.Millisecond)
+	_, srv := setupServer(t, testutil.Options{Workers: 4, QueueSize: tasks})
+	updateProviderConfig(t, srv, map[string]interface{}{
+		"provider_name": "openai", "api_base": stub.URL, "api_key": "key-0", "model_id": "stub-image", "enabled": true,
+	})
+
+	var submitted []string
+	var wg sync.WaitGroup
+	var done atomic.Bool
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= reloads && !done.Load(); i++ {
+			updateProviderConfig(t, srv, map[string]interface{}{
+				"provider_name": "openai", "api_key": fmt.Sprintf("key-%d", i), "timeout_seconds": 30 + i,
+			})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < reloads && !done.Load(); i++ {
+			tolerance := 0.01 * float64(i%5+1)
+			testutil.SetConfig(func(cfg *config.Config) { cfg.Tasks.AspectTolerance = tolerance })
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < tasks; i++ {
+		resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+			"provider": "openai",
+			"model_id": "stub-image",
+			"params":   map[string]interface{}{"prompt": fmt.Sprintf("reload %d", i)},
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("提交任务失败 %d: %s (%s)", resp.StatusCode, out.Message, out.ErrorCode)
+		}
+		var task model.Task
+		if err := json.Unmarshal(out.Data, &task); err != nil {
+			t.Fatal(err)
+		}
+		submitted = append(submitted, task.TaskID)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, id := range submitted {
+		task := testutil.WaitTask(t, id, 20*time.Second, testutil.Settled)
+		if task.Status != "completed" {
+			t.Errorf("任务 %s 状态 = %s (%s)，配置重新加载不应影响在途或新提交的任务", id, task.Status, task.ErrorMessage)
+		}
+	}
+	done.Store(true)
+	wg.Wait()
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	total := 0
+	for key, n := range stub.keys {
+		if !strings.HasPrefix(key, "key-") {
+			t.Errorf("上游收到未配置过的 API Key %q", key)
+		}
+		total += n
+	}
+	if total != tasks {
+		t.Fatalf("上游收到 %d 个请求，期望 %d", total, tasks)
+	}
+	if len(stub.keys) < 2 {
+		t.Fatalf("任务均使用同一个 API Key %v，配置重新加载未生效", stub.keys)
+	}
+}
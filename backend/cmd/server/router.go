@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"image-gen-service/internal/api"
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newHTTPServer 创建 http.Server；超时用于防御慢速客户端长期占用连接，单项为 0 时不限制
+func newHTTPServer(addr string, handler http.Handler, cfg *config.Config) *http.Server {
+	serverCfg := cfg.Server
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(serverCfg.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(serverCfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(serverCfg.WriteTimeoutSeconds) * time.Second,
+	}
+}
+
+// setupRouter 注册全部中间件与路由
+func setupRouter() *gin.Engine {
+	r := gin.Default()
+
+	// 允许跨域请求
+	r.Use(func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+		log.Printf("[CORS] Request from Origin: %s, Method: %s, Path: %s", origin, c.Request.Method, c.Request.URL.Path)
+
+		if origin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		} else {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, *")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+		c.Next()
+	})
+
+	// 降级模式下只开放健康检查与启动状态接口
+	r.Use(api.RequireStartupReady())
+	r.Use(api.RequestTimingMiddleware())
+	r.GET("/metrics", api.MetricsHandler)
+
+	// 维护模式下拒绝会产生新任务的请求，读取、导出与下载不受影响
+	maintenanceGuard := api.RejectDuringMaintenance()
+	// 存储目录不可写或磁盘空间不足时同样拒绝，避免任务生成后才在保存时失败
+	storageGuard := api.RejectWhenStorageUnavailable()
+
+	// 请求体默认按 server.max_body_mb 限制；上传参考图、导入图片的接口注册在按上传配置放宽的分组上
+	// 处理时限按分组设置：普通接口较短，上传类较长；调用对话模型与同步维护操作的路由单独覆盖
+	defaultTimeout := api.RouteTimeout(api.RouteTimeoutFor(api.RouteTimeoutDefault))
+	chatTimeout := api.RouteTimeout(api.RouteTimeoutFor(api.RouteTimeoutChat))
+	longTimeout := api.RouteTimeout(api.RouteTimeoutFor(api.RouteTimeoutLong))
+	v1 := r.Group("/api/v1", api.LimitRequestBody(api.DefaultBodyLimit), defaultTimeout)
+	uploads := r.Group("/api/v1", api.LimitRequestBody(api.UploadBodyLimit), longTimeout)
+	inlineUploads := r.Group("/api/v1", api.LimitRequestBody(api.InlineUploadBodyLimit), defaultTimeout)
+	mixedUploads := r.Group("/api/v1", api.LimitRequestBodyByType(api.UploadBodyLimit, api.InlineUploadBodyLimit), longTimeout)
+	// 长连接与导出接口不受 http.Server 读写超时与接口处理时限限制
+	noDeadline := api.NoDeadline()
+	{
+		v1.GET("/health", api.HealthHandler)
+		v1.GET("/startup-status", api.StartupStatusHandler)
+		v1.POST("/startup/retry", api.RetryStartupHandler)
+		v1.GET("/limits", api.LimitsHandler)
+		v1.GET("/queue/status", api.QueueStatusHandler)
+		v1.GET("/stats/activity", api.ActivityStatsHandler)
+		v1.GET("/stats/providers", api.ProviderStatsHandler)
+		v1.GET("/providers", api.ListProvidersHandler)
+		v1.GET("/providers/config", api.ListProviderConfigsHandler)
+		v1.POST("/providers/config", api.UpdateProviderConfigHandler)
+		v1.PATCH("/providers/config", api.UpdateProviderConfigHandler)
+		v1.GET("/providers/:name/models", api.ListProviderModelsHandler)
+		v1.GET("/providers/budget", api.ListProviderBudgetsHandler)
+		v1.POST("/providers/:name/budget/override", api.OverrideProviderBudgetHandler)
+		v1.GET("/providers/:name/debug", api.ProviderDebugHandler)
+		v1.POST("/prompts/optimize", chatTimeout, api.OptimizePromptHandler)
+		uploads.POST("/prompts/image-to-prompt", chatTimeout, api.ImageToPromptHandler)
+		v1.GET("/prompts/similar", api.SimilarPromptsHandler)
+		inlineUploads.POST("/tasks/generate", maintenanceGuard, storageGuard, api.GenerateHandler)
+		mixedUploads.POST("/tasks/generate-with-images", maintenanceGuard, storageGuard, api.GenerateWithImagesHandler)
+		uploads.POST("/tasks/bulk-from-csv", maintenanceGuard, storageGuard, api.BulkFromCSVHandler)
+		v1.GET("/tasks/compare", api.CompareTasksHandler)
+		v1.GET("/tasks/:task_id", api.GetTaskHandler)
+		v1.GET("/tasks/:task_id/debug", api.TaskDebugHandler)
+		v1.GET("/tasks/:task_id/stream", noDeadline, api.StreamTaskHandler)
+		v1.GET("/tasks/:task_id/poll", noDeadline, api.PollTaskHandler)
+		v1.GET("/tasks/:task_id/events", api.GetTaskEventsHandler)
+		v1.GET("/tasks/:task_id/lineage", api.GetTaskLineageHandler)
+		v1.GET("/ws", noDeadline, api.TaskWebSocketHandler)
+		v1.GET("/images", api.ListImagesHandler)
+		v1.GET("/images/stream", noDeadline, api.StreamGalleryHandler)
+		v1.GET("/images/duplicates", api.DuplicateImagesHandler)
+		v1.POST("/images/batch-update", api.BatchUpdateImagesHandler)
+		v1.POST("/images/export", noDeadline, api.ExportImagesHandler)
+		v1.GET("/images/export-csv", noDeadline, api.ExportCSVHandler)
+		uploads.POST("/images/import", maintenanceGuard, storageGuard, api.ImportImagesHandler)
+		v1.POST("/images/compose", maintenanceGuard, storageGuard, api.ComposeImagesHandler)
+		v1.POST("/images/captions/bulk", api.BulkCaptionHandler)
+		v1.DELETE("/images/:id", api.DeleteImageHandler)
+		v1.PATCH("/images/:id", api.UpdateImageHandler)
+		v1.GET("/images/:id/download", api.DownloadImageHandler)
+		v1.GET("/images/:id/proxy", api.ImageProxyHandler)
+		v1.GET("/images/:id/metadata.json", api.ImageMetadataHandler)
+		v1.GET("/images/:id/similar", api.SimilarImagesHandler)
+		v1.POST("/images/:id/edit", maintenanceGuard, storageGuard, api.EditImageHandler)
+		v1.POST("/images/:id/upscale", maintenanceGuard, storageGuard, api.UpscaleImageHandler)
+		v1.POST("/images/:id/remove-background", maintenanceGuard, storageGuard, api.RemoveBackgroundHandler)
+		v1.POST("/images/:id/caption", chatTimeout, api.CaptionImageHandler)
+		v1.PATCH("/images/:id/caption", api.UpdateCaptionHandler)
+		v1.POST("/maintenance/backfill-file-info", longTimeout, api.BackfillFileInfoHandler)
+		v1.GET("/maintenance/backfill-file-info", api.BackfillFileInfoStatusHandler)
+		v1.POST("/maintenance/retry-remote-sync", longTimeout, api.RetryRemoteSyncHandler)
+		v1.GET("/maintenance/retry-remote-sync", api.RetryRemoteSyncStatusHandler)
+		v1.POST("/maintenance/regenerate-thumbnails", longTimeout, api.RegenerateThumbnailsHandler)
+		v1.GET("/maintenance/regenerate-thumbnails", api.RegenerateThumbnailsStatusHandler)
+		v1.GET("/maintenance/retention/preview", api.RetentionPreviewHandler)
+		v1.POST("/maintenance/purge-failed", longTimeout, api.PurgeFailedTasksHandler)
+		v1.POST("/maintenance/rewrite-public-urls", longTimeout, api.RewritePublicURLsHandler)
+		v1.GET("/maintenance/pending-deletions", api.ListPendingDeletionsHandler)
+		v1.POST("/maintenance/pending-deletions/retry", longTimeout, api.RetryPendingDeletionsHandler)
+		v1.GET("/maintenance/remote-orphans", api.RemoteOrphansStatusHandler)
+		v1.POST("/maintenance/remote-orphans", longTimeout, api.AuditRemoteOrphansHandler)
+		v1.GET("/jobs", api.ListJobsHandler)
+		v1.POST("/jobs", api.CreateJobHandler)
+		v1.GET("/jobs/:job_id", api.GetJobHandler)
+		v1.POST("/jobs/:job_id/cancel", api.CancelJobHandler)
+		v1.POST("/maintenance/enable", api.EnableMaintenanceHandler)
+		v1.POST("/maintenance/disable", api.DisableMaintenanceHandler)
+		v1.POST("/maintenance/reload-config", api.ReloadConfigHandler)
+		v1.GET("/settings/storage-dir", api.GetStorageDirHandler)
+		v1.POST("/settings/storage-dir", longTimeout, api.UpdateStorageDirHandler)
+		v1.GET("/storage/usage", longTimeout, api.GetStorageUsageHandler)
+	}
+
+	// 静态资源访问 (将 storage 目录整体暴露，以匹配数据库中的 storage/local/xxx.jpg 路径)
+	// 针对本地存储增加缓存头，优化前端加载性能
+	r.Group("/storage", func(c *gin.Context) {
+		c.Header("Cache-Control", storage.CacheControl(c.Request.URL.Path)) // 1年缓存，因为本地文件路径通常包含唯一 ID，哈希缩略图标记为 immutable
+		c.Next()
+	}).Static("", "storage")
+	// 迁移到外部目录后任务路径为绝对路径，由该处理器按当前存储目录提供文件
+	r.NoRoute(api.ServeLibraryFileHandler)
+
+	return r
+}
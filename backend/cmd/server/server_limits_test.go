@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+// startLimitedServer 以 newHTTPServer 的超时设置启动完整路由，覆盖真实的连接层行为
+func startLimitedServer(t *testing.T, opts testutil.Options) *httptest.Server {
+	t.Helper()
+	testutil.Setup(t, opts)
+	srv := httptest.NewUnstartedServer(nil)
+	configured := newHTTPServer("", setupRouter(), config.Get())
+	srv.Config.Handler = configured.Handler
+	srv.Config.ReadHeaderTimeout = configured.ReadHeaderTimeout
+	srv.Config.ReadTimeout = configured.ReadTimeout
+	srv.Config.WriteTimeout = configured.WriteTimeout
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// chunkedReader 隐藏长度，使客户端以分块传输发送请求体
+type chunkedReader struct{ io.Reader }
+
+func jsonBody(size int) []byte {
+	return []byte(`{"prompt":"` + strings.Repeat("a", size) + `"}`)
+}
+
+func multipartBody(t *testing.T, size int) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("provider", "fake")
+	form.WriteField("prompt", "x")
+	part, err := form.CreateFormFile("refImages", "big.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte{0}, size))
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	srv := startLimitedServer(t, testutil.Options{NoPool: true, Config: func(cfg *config.Config) {
+		cfg.Server.MaxBodyMB = 1
+		cfg.Upload.MaxFileMB = 1
+		cfg.Upload.MaxTotalMB = 1
+	}})
+
+	cases := []struct {
+		name        string
+		path        string
+		body        func() (io.Reader, string)
+		wantTooBig  bool
+		wantMessage string
+	}{
+		{
+			name: "普通接口未超限",
+			path: "/api/v1/prompts/optimize",
+			body: func() (io.Reader, string) { return bytes.NewReader(jsonBody(512 << 10)), "application/json" },
+		},
+		{
+			name:       "普通接口超出 max_body_mb",
+			path:       "/api/v1/prompts/optimize",
+			body:       func() (io.Reader, string) { return bytes.NewReader(jsonBody(2 << 20)), "application/json" },
+			wantTooBig: true, wantMessage: "1MB",
+		},
+		{
+			name: "分块传输超出 max_body_mb",
+			path: "/api/v1/prompts/optimize",
+			body: func() (io.Reader, string) {
+				return chunkedReader{bytes.NewReader(jsonBody(2 << 20))}, "application/json"
+			},
+			wantTooBig: true, wantMessage: "1MB",
+		},
+		{
+			// 内联 base64 参考图的上限为上传总量的 4/3 加表单余量，大于普通接口
+			name: "内联上传接口按上传配置放宽",
+			path: "/api/v1/tasks/generate",
+			body: func() (io.Reader, string) { return bytes.NewReader(jsonBody(2 << 20)), "application/json" },
+		},
+		{
+			name:       "内联上传接口超限",
+			path:       "/api/v1/tasks/generate",
+			body:       func() (io.Reader, string) { return bytes.NewReader(jsonBody(4 << 20)), "application/json" },
+			wantTooBig: true, wantMessage: "2389KB", // 1MB/3*4 + 1MB 表单余量
+		},
+		{
+			name: "multipart 上传超限",
+			path: "/api/v1/tasks/generate-with-images",
+			body: func() (io.Reader, string) {
+				body, contentType := multipartBody(t, 3<<20)
+				return body, contentType
+			},
+			wantTooBig: true, wantMessage: "2MB",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, contentType := tc.body()
+			req, err := http.NewRequest(http.MethodPost, srv.URL+tc.path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			resp, out := send(t, req)
+			if !tc.wantTooBig {
+				if resp.StatusCode == http.StatusRequestEntityTooLarge {
+					t.Fatalf("未超限的请求被拒绝: %s", out.Message)
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusRequestEntityTooLarge || out.ErrorCode != model.ErrCodeValidationFailed {
+				t.Fatalf("状态 = %d %s，期望 413 %s", resp.StatusCode, out.ErrorCode, model.ErrCodeValidationFailed)
+			}
+			if !strings.Contains(out.Message, tc.wantMessage) {
+				t.Fatalf("错误信息 %q 应包含上限 %s", out.Message, tc.wantMessage)
+			}
+		})
+	}
+}
+
+// TestSlowHeaderClientDisconnected 请求头迟迟不发完的客户端在 read_header_timeout 后被断开
+func TestSlowHeaderClientDisconnected(t *testing.T) {
+	srv := startLimitedServer(t, testutil.Options{NoPool: true, Config: func(cfg *config.Config) {
+		cfg.Server.ReadHeaderTimeoutSeconds = 1
+	}})
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET /api/v1/health HTTP/1.1\r\nHost: test\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatal("服务端未在 read_header_timeout 后断开连接")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("断开耗时 %s", elapsed)
+	}
+}
+
+// TestWriteTimeoutExemptsStreams 普通接口响应超过 write_timeout 时连接被切断，流式推送接口不受影响
+func TestWriteTimeoutExemptsStreams(t *testing.T) {
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c","object":"chat.completion","created":0,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	t.Cleanup(chat.Close)
+
+	srv := startLimitedServer(t, testutil.Options{Config: func(cfg *config.Config) {
+		cfg.Server.WriteTimeoutSeconds = 1
+	}})
+	createProviderConfig(t, model.ProviderConfig{ProviderName: "openai-chat", APIBase: chat.URL, APIKey: "k"})
+
+	t.Run("普通接口", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/api/v1/prompts/optimize", "application/json",
+			strings.NewReader(`{"prompt":"a cat","provider":"openai-chat","model":"m"}`))
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("超过 write_timeout 的响应应被切断，实际返回 %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("流式推送接口", func(t *testing.T) {
+		taskID := submitGenerate(t, srv, map[string]interface{}{"prompt": "slow", "fake_delay_ms": 1500})
+		events := readTaskStream(t, srv, taskID)
+		if last := events[len(events)-1]; last.Status != "completed" {
+			t.Fatalf("最终状态 = %s，期望 completed", last.Status)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// 父进程心跳协议：Tauri 启动器每隔 stdinHeartbeatInterval 向标准输入写入一个字节
+const (
+	stdinHeartbeatInterval   = 2 * time.Second
+	stdinMaxMissedHeartbeats = 5
+	// stdinHeartbeatGrace 启动后等待首个心跳的时间，超时视为独立运行
+	stdinHeartbeatGrace = 15 * time.Second
+)
+
+// watchParentHeartbeat 监听父进程心跳，返回 true 表示父进程已退出、应关闭服务；
+// 返回 false 表示从未收到心跳（nohup、systemd、</dev/null 等独立运行场景），监听停用。
+// 收到首个心跳后，标准输入关闭或连续 maxMissed 次未收到心跳即判定父进程退出。
+// after 为计时器来源，服务中传入 time.After，测试中替换为手动触发的时钟
+func watchParentHeartbeat(r io.Reader, interval time.Duration, maxMissed int, grace time.Duration, after func(time.Duration) <-chan time.Time) bool {
+	beats := make(chan struct{}, 1)
+	closed := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case beats <- struct{}{}:
+				default:
+				}
+			}
+			if err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-beats:
+	case err := <-closed:
+		log.Printf("标准输入在收到心跳前已关闭 (%v)，判定为独立运行，停用父进程监听", err)
+		return false
+	case <-after(grace):
+		log.Printf("%s 内未收到父进程心跳，判定为独立运行，停用父进程监听", grace)
+		return false
+	}
+	log.Printf("已收到父进程心跳，启用父进程监听")
+
+	timeout := interval * time.Duration(maxMissed)
+	deadline := after(timeout)
+	for {
+		select {
+		case <-beats:
+			deadline = after(timeout)
+		case err := <-closed:
+			// 管道被关闭说明父进程已退出，无需再等待心跳超时
+			log.Printf("检测到标准输入关闭 (%v)，父进程已退出", err)
+			return true
+		case <-deadline:
+			log.Printf("连续 %d 次未收到父进程心跳，判定父进程已退出", maxMissed)
+			return true
+		}
+	}
+}
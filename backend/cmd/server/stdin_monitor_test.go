@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// manualClock 手动触发的计时器来源，每次创建计时器都会通知测试，便于按心跳逐步推进
+type manualClock struct {
+	timers chan manualTimer
+}
+
+type manualTimer struct {
+	d  time.Duration
+	ch chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{timers: make(chan manualTimer, 16)}
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	timer := manualTimer{d: d, ch: make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer.ch
+}
+
+// next 等待监听创建下一个计时器并校验时长
+func (c *manualClock) next(t *testing.T, want time.Duration) manualTimer {
+	t.Helper()
+	select {
+	case timer := <-c.timers:
+		if timer.d != want {
+			t.Fatalf("计时器时长 = %s，期望 %s", timer.d, want)
+		}
+		return timer
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待监听创建计时器超时")
+		return manualTimer{}
+	}
+}
+
+func (timer manualTimer) fire() {
+	timer.ch <- time.Now()
+}
+
+const (
+	testInterval  = 2 * time.Second
+	testMaxMissed = 3
+	testGrace     = 10 * time.Second
+	testTimeout   = testInterval * testMaxMissed
+)
+
+func startWatch(r io.Reader, clock *manualClock) <-chan bool {
+	result := make(chan bool, 1)
+	go func() {
+		result <- watchParentHeartbeat(r, testInterval, testMaxMissed, testGrace, clock.After)
+	}()
+	return result
+}
+
+func expectResult(t *testing.T, result <-chan bool, want bool) {
+	t.Helper()
+	select {
+	case got := <-result:
+		if got != want {
+			t.Fatalf("watchParentHeartbeat = %v，期望 %v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("监听未返回")
+	}
+}
+
+func expectRunning(t *testing.T, result <-chan bool) {
+	t.Helper()
+	select {
+	case got := <-result:
+		t.Fatalf("监听提前返回 %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParentHeartbeatPiped(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	clock := newManualClock()
+	result := startWatch(pr, clock)
+
+	clock.next(t, testGrace)
+	pw.Write([]byte{'.'})
+	first := clock.next(t, testTimeout)
+	pw.Write([]byte{'.'})
+	second := clock.next(t, testTimeout)
+
+	// 收到心跳后旧的超时不再生效
+	first.fire()
+	expectRunning(t, result)
+
+	// 心跳中断达到 maxMissed 次后判定父进程退出
+	second.fire()
+	expectResult(t, result, true)
+}
+
+func TestParentHeartbeatStdinClosed(t *testing.T) {
+	t.Run("收到心跳前关闭", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		clock := newManualClock()
+		result := startWatch(pr, clock)
+		clock.next(t, testGrace)
+		pw.Close()
+		expectResult(t, result, false)
+	})
+	t.Run("收到心跳后关闭", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		clock := newManualClock()
+		result := startWatch(pr, clock)
+		clock.next(t, testGrace)
+		pw.Write([]byte{'.'})
+		clock.next(t, testTimeout)
+		pw.Close()
+		expectResult(t, result, true)
+	})
+}
+
+func TestParentHeartbeatNeverWritten(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	clock := newManualClock()
+	result := startWatch(pr, clock)
+
+	grace := clock.next(t, testGrace)
+	expectRunning(t, result)
+	grace.fire()
+	expectResult(t, result, false)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider/fake"
+	"image-gen-service/internal/testutil"
+	"image-gen-service/internal/worker"
+
+	"gorm.io/gorm"
+)
+
+func countTasks(t *testing.T) int64 {
+	t.Helper()
+	var n int64
+	if err := model.DB.Model(&model.Task{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestGenerateQueueFullLeavesNoRow 队列已满时返回 503，被拒绝的提交不留下任务记录，
+// per_image 分组只要有一个名额不足就整组拒绝
+func TestGenerateQueueFullLeavesNoRow(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{
+		Workers:   1,
+		QueueSize: 1,
+		Fake:      fake.Config{Delay: time.Second, Width: 64, Height: 64},
+		Config:    func(cfg *config.Config) { cfg.Tasks.SubmitWaitMs = 0 },
+	})
+
+	// 第一个任务占住唯一的 Worker，第二个任务占住唯一的队列名额
+	first := submitGenerate(t, srv, map[string]interface{}{"prompt": "first"})
+	testutil.WaitTask(t, first, 5*time.Second, func(task *model.Task) bool { return task.Status == "processing" })
+	submitGenerate(t, srv, map[string]interface{}{"prompt": "second"})
+
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+		"provider": "fake",
+		"params":   map[string]interface{}{"prompt": "third"},
+	})
+	if resp.StatusCode != http.StatusServiceUnavailable || out.ErrorCode != model.ErrCodeQueueFull {
+		t.Fatalf("队列已满: %d %s", resp.StatusCode, out.ErrorCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("队列已满响应缺少 Retry-After")
+	}
+	if n := countTasks(t); n != 2 {
+		t.Fatalf("任务记录数 = %d，被拒绝的提交不应留下记录", n)
+	}
+	if depth, _ := worker.Pool.QueueDepth(); depth != 1 {
+		t.Fatalf("队列名额 = %d，被拒绝的提交应释放已占用的名额", depth)
+	}
+}
+
+// TestGenerateCreateFailureReleasesSlot 任务记录写入失败（如进程在占用名额后、事务提交前出错）时
+// 既不留下记录也不占用名额，之后的提交不受影响
+func TestGenerateCreateFailureReleasesSlot(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{Workers: 1, QueueSize: 1, Fake: fake.Config{Width: 64, Height: 64}})
+
+	// 数据库回调不能与写库并发修改，注册与移除前先等待事件写入完成
+	worker.FlushTaskEvents()
+	var failCreate atomic.Bool
+	if err := model.DB.Callback().Create().Before("gorm:create").Register("test:fail_create", func(db *gorm.DB) {
+		if failCreate.Load() {
+			db.AddError(errors.New("模拟写入中断"))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		worker.FlushTaskEvents()
+		model.DB.Callback().Create().Remove("test:fail_create")
+	})
+
+	failCreate.Store(true)
+	resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+		"provider": "fake",
+		"params":   map[string]interface{}{"prompt": "lost", "count": 2},
+	})
+	failCreate.Store(false)
+	if resp.StatusCode != http.StatusInternalServerError || out.ErrorCode != model.ErrCodeStorageError {
+		t.Fatalf("写入失败: %d %s", resp.StatusCode, out.ErrorCode)
+	}
+	if n := countTasks(t); n != 0 {
+		t.Fatalf("写入失败后留下 %d 条任务记录", n)
+	}
+	if depth, _ := worker.Pool.QueueDepth(); depth != 0 {
+		t.Fatalf("写入失败后仍占用 %d 个队列名额", depth)
+	}
+
+	taskID := submitGenerate(t, srv, map[string]interface{}{"prompt": "after"})
+	task := testutil.WaitTask(t, taskID, 5*time.Second, func(task *model.Task) bool {
+		return testutil.Settled(task) && task.ThumbStatus != model.ThumbnailPending
+	})
+	if task.Status != "completed" {
+		t.Fatalf("后续任务状态 = %s (%s)", task.Status, task.ErrorMessage)
+	}
+}
+
+// TestStartFailsTasksLeftByCrash 进程在任务写入后、执行完成前退出时，重启后排队中与处理中的记录
+// 标记为 INTERRUPTED；未持有实例锁时这些记录可能属于另一个实例，保持不变
+func TestStartFailsTasksLeftByCrash(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		recover bool
+		status  string
+		code    string
+	}{
+		{name: "持有实例锁", recover: true, status: "failed", code: model.ErrCodeInterrupted},
+		{name: "未持有实例锁", recover: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Setup(t, testutil.Options{NoPool: true})
+			pending := testutil.CreateTask(t, &model.Task{TaskID: "crash-pending", Status: "pending"})
+			processing := testutil.CreateTask(t, &model.Task{TaskID: "crash-processing", Status: "processing"})
+			completed := testutil.CreateTask(t, &model.Task{TaskID: "crash-completed"})
+
+			worker.RecoverInterrupted = tc.recover
+			t.Cleanup(func() { worker.RecoverInterrupted = true })
+			worker.InitPool(1, 4)
+			pool := worker.Pool
+			pool.Start()
+			t.Cleanup(pool.Stop)
+
+			for _, want := range []*model.Task{pending, processing} {
+				var got model.Task
+				if err := model.DB.Where("task_id = ?", want.TaskID).First(&got).Error; err != nil {
+					t.Fatal(err)
+				}
+				status, code := tc.status, tc.code
+				if !tc.recover {
+					status = want.Status
+				}
+				if got.Status != status || got.ErrorCode != code {
+					t.Fatalf("任务 %s = %s (%s)，期望 %s (%s)", want.TaskID, got.Status, got.ErrorCode, status, code)
+				}
+			}
+			var got model.Task
+			if err := model.DB.Where("task_id = ?", completed.TaskID).First(&got).Error; err != nil || got.Status != "completed" {
+				t.Fatalf("已完成的任务被修改: %s (%v)", got.Status, err)
+			}
+		})
+	}
+}
+
+// postGenerateWithImages 以 multipart 表单提交图生图任务
+func postGenerateWithImages(t *testing.T, srv *httptest.Server, prompt string) (*http.Response, apiResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("provider", "fake")
+	form.WriteField("prompt", prompt)
+	part, err := form.CreateFormFile("refImages", "ref.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(testutil.PNG(t, 16, 16))
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/tasks/generate-with-images", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return send(t, req)
+}
+
+// TestGenerateEndpointsShareValidation 文生图与图生图合并 Provider 默认参数后按同一套规则归一化与校验，
+// 对同样的输入给出同样的结果
+func TestGenerateEndpointsShareValidation(t *testing.T) {
+	_, srv := setupServer(t, testutil.Options{Fake: fake.Config{Width: 64, Height: 64}})
+	createProviderConfig(t, model.ProviderConfig{ProviderName: "fake", DisplayName: "Fake", Enabled: true})
+	setDefaults := func(defaults string) {
+		t.Helper()
+		if err := model.DB.Model(&model.ProviderConfig{}).Where("provider_name = ?", "fake").Update("default_params", defaults).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	submitBoth := func() (generate, withImages apiResponse, generateStatus, withImagesStatus int) {
+		t.Helper()
+		resp, out := doJSON(t, srv, http.MethodPost, "/api/v1/tasks/generate", map[string]interface{}{
+			"provider": "fake",
+			"params":   map[string]interface{}{"prompt": "same input"},
+		})
+		imgResp, imgOut := postGenerateWithImages(t, srv, "same input")
+		return out, imgOut, resp.StatusCode, imgResp.StatusCode
+	}
+
+	// 默认参数中的裁剪方位不合法：两个接口都拒绝
+	setDefaults(`{"crop_gravity":"sideways"}`)
+	out, imgOut, status, imgStatus := submitBoth()
+	for name, got := range map[string]struct {
+		status int
+		code   string
+	}{"文生图": {status, out.ErrorCode}, "图生图": {imgStatus, imgOut.ErrorCode}} {
+		if got.status != http.StatusBadRequest || got.code != model.ErrCodeValidationFailed {
+			t.Fatalf("%s: 不合法的默认参数返回 %d %s，期望 400 %s", name, got.status, got.code, model.ErrCodeValidationFailed)
+		}
+	}
+
+	// 默认超时超过上限：两个接口都截断到 tasks.max_timeout_seconds
+	setDefaults(`{"timeout_seconds":999999}`)
+	out, imgOut, status, imgStatus = submitBoth()
+	if status != http.StatusOK || imgStatus != http.StatusOK {
+		t.Fatalf("提交失败: 文生图 %d %s, 图生图 %d %s", status, out.Message, imgStatus, imgOut.Message)
+	}
+	maxSeconds := float64(config.Get().Tasks.MaxTimeoutSeconds)
+	for name, data := range map[string]json.RawMessage{"文生图": out.Data, "图生图": imgOut.Data} {
+		var task model.Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			t.Fatal(err)
+		}
+		var snapshot map[string]interface{}
+		if err := json.Unmarshal([]byte(task.ConfigSnapshot), &snapshot); err != nil {
+			t.Fatalf("%s: 解析配置快照失败: %v", name, err)
+		}
+		if got := snapshot["timeout_seconds"]; got != maxSeconds {
+			t.Fatalf("%s: 配置快照中的 timeout_seconds = %v，期望 %v", name, got, maxSeconds)
+		}
+		testutil.WaitTask(t, task.TaskID, 5*time.Second, testutil.Settled)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit 写入审计日志；失败只记录日志，不影响操作本身
+func recordAudit(c *gin.Context, action string, detail interface{}) {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		data = []byte("{}")
+	}
+	entry := model.AuditLog{
+		Action:   action,
+		Detail:   string(data),
+		ClientIP: c.ClientIP(),
+	}
+	if err := model.DB.Create(&entry).Error; err != nil {
+		log.Printf("[Audit] 写入审计日志失败 (%s): %v", action, err)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultBodyLimit 普通请求的请求体上限，取自 server.max_body_mb
+func DefaultBodyLimit() int64 {
+	mb := config.Get().Server.MaxBodyMB
+	if mb <= 0 {
+		mb = 4
+	}
+	return int64(mb) << 20
+}
+
+// UploadBodyLimit multipart 上传接口的请求体上限：上传总量加表单字段余量
+func UploadBodyLimit() int64 {
+	return currentUploadLimits().MaxTotalBytes + uploadFormOverhead
+}
+
+// InlineUploadBodyLimit 以 base64 内联参考图的 JSON 接口的请求体上限（base64 约膨胀 4/3）
+func InlineUploadBodyLimit() int64 {
+	return currentUploadLimits().MaxTotalBytes/3*4 + uploadFormOverhead
+}
+
+// LimitRequestBody 将请求体限制为 limit() 字节，超出时返回 413 并在消息中给出上限；上限按请求计算，上传设置修改后立即生效
+func LimitRequestBody(limit func() int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		max := limit()
+		if c.Request.ContentLength > max {
+			abortBodyTooLarge(c, max)
+			return
+		}
+		body := c.Request.Body
+
+		// 未声明长度的非 multipart 请求（分块传输）先读入内存，超限时同样返回 413，
+		// 避免超限错误在各处理函数中变成参数解析失败
+		if c.Request.ContentLength < 0 && body != nil && body != http.NoBody && !isMultipartRequest(c.Request) {
+			data, err := io.ReadAll(io.LimitReader(body, max+1))
+			if err != nil {
+				Error(c, http.StatusBadRequest, 400, "读取请求体失败")
+				c.Abort()
+				return
+			}
+			if int64(len(data)) > max {
+				abortBodyTooLarge(c, max)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			c.Next()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, max)
+		c.Next()
+	}
+}
+
+// LimitRequestBodyByType multipart 请求使用 multipartLimit，其余请求使用 otherLimit，用于同时接受表单上传与内联 base64 JSON 的路由
+func LimitRequestBodyByType(multipartLimit, otherLimit func() int64) gin.HandlerFunc {
+	multipart := LimitRequestBody(multipartLimit)
+	other := LimitRequestBody(otherLimit)
+	return func(c *gin.Context) {
+		if isMultipartRequest(c.Request) {
+			multipart(c)
+			return
+		}
+		other(c)
+	}
+}
+
+// NoDeadline 清除读写超时，避免 SSE、WebSocket 与导出等长连接响应被服务器超时截断
+func NoDeadline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc := http.NewResponseController(c.Writer)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+			log.Printf("[API] 解除写超时失败 route=%s: %v", c.FullPath(), err)
+		}
+		if err := rc.SetReadDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+			log.Printf("[API] 解除读超时失败 route=%s: %v", c.FullPath(), err)
+		}
+		clearRouteTimeout(c)
+		c.Next()
+	}
+}
+
+func abortBodyTooLarge(c *gin.Context, limit int64) {
+	Error(c, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体超过 %s 限制", formatByteLimit(limit)))
+	c.Abort()
+}
+
+func formatByteLimit(limit int64) string {
+	if limit >= 1<<20 && limit%(1<<20) == 0 {
+		return fmt.Sprintf("%dMB", limit>>20)
+	}
+	if limit >= 1<<10 {
+		return fmt.Sprintf("%dKB", limit>>10)
+	}
+	return fmt.Sprintf("%d 字节", limit)
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "multipart/")
+}
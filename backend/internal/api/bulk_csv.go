@@ -0,0 +1,379 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBulkCSVRows 单次批量生成的最大数据行数
+	maxBulkCSVRows = 500
+	// maxBulkCSVBytes CSV 文件大小上限
+	maxBulkCSVBytes    = 2 << 20
+	defaultBulkPreview = 5
+	maxBulkPreview     = 50
+)
+
+// bulkPlaceholder 模板中的 {{column}} 占位符，列名两侧允许空白
+var bulkPlaceholder = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// bulkRowError 某一行渲染或校验失败的原因；Row 为 CSV 中的行号（表头为第 1 行）
+type bulkRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// bulkRowPrompt 渲染后的一行提示词
+type bulkRowPrompt struct {
+	Row       int    `json:"row"`
+	Prompt    string `json:"prompt"`
+	Truncated bool   `json:"truncated,omitempty"`
+	TaskID    string `json:"task_id,omitempty"`
+	Queued    bool   `json:"queued,omitempty"`
+}
+
+// bulkCSVRecord CSV 中的一条数据记录
+type bulkCSVRecord struct {
+	Line   int
+	Fields []string
+	Err    error
+}
+
+// BulkFromCSVHandler 按 CSV 每行填充模板的 {{列名}} 占位符，各创建一个低优先级生成任务，占位符必须对应表头列；渲染失败的行单独报告且不影响其他行。dry_run=true 时不创建任务，只返回前 preview 条渲染结果；同批任务共用批次 ID（group_id）与标签 batch-<id>
+func BulkFromCSVHandler(c *gin.Context) {
+	limits := currentUploadLimits()
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		if limitErr := asUploadError(err, limits); limitErr != nil {
+			Error(c, limitErr.Status, limitErr.Status, limitErr.Message)
+			return
+		}
+		Error(c, http.StatusBadRequest, 400, "解析表单失败: "+err.Error())
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		Error(c, http.StatusBadRequest, 400, "请通过 file 字段上传 CSV 文件")
+		return
+	}
+	if fileHeader.Size > maxBulkCSVBytes {
+		Error(c, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, fmt.Sprintf("CSV 文件超过 %dMB 限制", maxBulkCSVBytes>>20))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		Error(c, http.StatusBadRequest, 400, "读取 CSV 文件失败")
+		return
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		Error(c, http.StatusBadRequest, 400, "读取 CSV 文件失败")
+		return
+	}
+
+	template := c.PostForm("template")
+	if strings.TrimSpace(template) == "" {
+		template = c.PostForm("prompt")
+	}
+	providerName := strings.TrimSpace(c.PostForm("provider"))
+	dryRun := c.PostForm("dry_run") == "true"
+	preview := defaultBulkPreview
+	if value := strings.TrimSpace(c.PostForm("preview")); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			preview = min(n, maxBulkPreview)
+		}
+	}
+
+	verr := &provider.ValidationError{}
+	if strings.TrimSpace(template) == "" {
+		verr.Add("template", "template 不能为空", nil, template)
+	}
+	header, records, err := readBulkCSV(content)
+	if err != nil {
+		verr.Add("file", err.Error(), nil, fileHeader.Filename)
+	} else if len(records) > maxBulkCSVRows {
+		verr.Add("file", fmt.Sprintf("CSV 最多 %d 行数据", maxBulkCSVRows), nil, len(records))
+	}
+	var columns map[string]int
+	if header != nil {
+		columns = make(map[string]int, len(header))
+		for i, name := range header {
+			if _, ok := columns[name]; ok {
+				verr.Add("file", fmt.Sprintf("表头 %s 重复", name), nil, name)
+				continue
+			}
+			columns[name] = i
+		}
+		placeholders := templatePlaceholders(template)
+		if len(placeholders) == 0 && strings.TrimSpace(template) != "" {
+			verr.Add("template", "template 中没有 {{column}} 占位符", header, template)
+		}
+		for _, name := range placeholders {
+			if _, ok := columns[name]; !ok {
+				verr.Add("template", fmt.Sprintf("占位符 {{%s}} 在 CSV 表头中不存在", name), header, name)
+			}
+		}
+	}
+
+	p := provider.GetProvider(providerName)
+	if p == nil {
+		if err := verr.Err(); err != nil {
+			ValidationFailed(c, err)
+			return
+		}
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderNotFound, provider.UnavailableError(providerName).Error())
+		return
+	}
+	params := map[string]interface{}{}
+	if raw := strings.TrimSpace(c.PostForm("params")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &params); err != nil || params == nil {
+			verr.Add("params", "params 必须是 JSON 对象", nil, raw)
+			params = map[string]interface{}{}
+		}
+	}
+	if err := verr.Err(); err != nil {
+		ValidationFailed(c, err)
+		return
+	}
+
+	providerConfig := fetchProviderConfig(providerName)
+	applyDefaultParams(providerConfig, params)
+	resolved := provider.ResolveModelID(provider.ModelResolveOptions{
+		ProviderName: providerName,
+		Purpose:      provider.PurposeImage,
+		RequestModel: c.PostForm("model_id"),
+		Params:       params,
+		Config:       providerConfig,
+	})
+	if resolved.Err != nil {
+		Error(c, http.StatusBadRequest, 400, resolved.Err.Error())
+		return
+	}
+	modelID := resolved.ID
+	if modelID != "" {
+		params["model_id"] = modelID
+	}
+	private, err := takeTaskPrivate(params)
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "params."+err.Error())
+		return
+	}
+	if err := normalizeTaskTimeout(params); err != nil {
+		Error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	// 各行只有提示词不同，其余参数用模板本身校验一次
+	params["prompt"] = template
+	if err := provider.JoinValidationErrors(p.ValidateParams(params), worker.ValidateAspectParams(params)); err != nil {
+		ValidationFailed(c, err)
+		return
+	}
+	count, _ := provider.ParseCount(params["count"])
+	params["count"] = count
+
+	rows := make([]bulkRowPrompt, 0, len(records))
+	rowErrors := make([]bulkRowError, 0)
+	for _, record := range records {
+		if record.Err != nil {
+			rowErrors = append(rowErrors, bulkRowError{Row: record.Line, Error: record.Err.Error()})
+			continue
+		}
+		prompt, err := renderBulkTemplate(template, columns, record.Fields)
+		if err == nil {
+			var truncated bool
+			if prompt, truncated, err = limitPrompt(p, prompt); err == nil {
+				rows = append(rows, bulkRowPrompt{Row: record.Line, Prompt: prompt, Truncated: truncated})
+				continue
+			}
+		}
+		rowErrors = append(rowErrors, bulkRowError{Row: record.Line, Error: err.Error()})
+	}
+
+	if dryRun {
+		Success(c, gin.H{
+			"total_rows": len(records),
+			"valid_rows": len(rows),
+			"preview":    rows[:min(preview, len(rows))],
+			"errors":     rowErrors,
+		})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:      400,
+			Message:   "没有可以提交的行",
+			ErrorCode: model.ErrCodeValidationFailed,
+			Data:      gin.H{"errors": rowErrors},
+		})
+		return
+	}
+	if _, err := worker.CheckBatchBudget(providerName, len(rows), len(rows)*count); err != nil {
+		rejectOverBudget(c, providerName, err)
+		return
+	}
+
+	batchID := uuid.New().String()
+	tag := "batch-" + batchID
+	tagIDs, err := ensureTags([]string{tag})
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建批次标签失败")
+		return
+	}
+	tasks := make([]*worker.Task, 0, len(rows))
+	taskTags := make([]model.TaskTag, 0, len(rows))
+	for i := range rows {
+		rowParams := make(map[string]interface{}, len(params))
+		for k, v := range params {
+			rowParams[k] = v
+		}
+		rowParams["prompt"] = rows[i].Prompt
+		taskModel := &model.Task{
+			TaskID:         uuid.New().String(),
+			Prompt:         rows[i].Prompt,
+			Truncated:      rows[i].Truncated,
+			ProviderName:   providerName,
+			ModelID:        modelID,
+			TotalCount:     count,
+			Status:         "pending",
+			ConfigSnapshot: buildConfigSnapshot(providerName, modelID, rowParams),
+			Private:        private,
+			GroupID:        batchID,
+		}
+		rows[i].TaskID = taskModel.TaskID
+		tasks = append(tasks, &worker.Task{TaskModel: taskModel, Params: rowParams})
+		taskTags = append(taskTags, model.TaskTag{TaskID: taskModel.TaskID, TagID: tagIDs[tag]})
+	}
+	if err := model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, task := range tasks {
+			if err := tx.Create(task.TaskModel).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&taskTags).Error
+	}); err != nil {
+		log.Printf("[API] 批量创建任务失败 batch=%s: %v", batchID, err)
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建任务失败")
+		return
+	}
+
+	// 低优先级队列已满时，剩余任务直接标记失败，不占用普通队列
+	queued := 0
+	for i, task := range tasks {
+		if worker.Pool.SubmitLow(task) {
+			rows[i].Queued = true
+			queued++
+			continue
+		}
+		if err := model.DB.Model(&model.Task{}).Where("task_id = ?", task.TaskModel.TaskID).Updates(map[string]interface{}{
+			"status":        "failed",
+			"error_message": "低优先级队列已满",
+			"error_code":    model.ErrCodeQueueFull,
+		}).Error; err != nil {
+			log.Printf("[API] 标记任务 %s 失败出错: %v", task.TaskModel.TaskID, err)
+		}
+		InvalidateTask(task.TaskModel.TaskID)
+		worker.RecordTaskEvent(task.TaskModel.TaskID, worker.EventFailed, "code=%s 低优先级队列已满", model.ErrCodeQueueFull)
+	}
+
+	log.Printf("[API] CSV 批量生成 batch=%s: 数据行 %d, 创建 %d, 入队 %d, 失败行 %d", batchID, len(records), len(rows), queued, len(rowErrors))
+	Success(c, gin.H{
+		"batch_id":   batchID,
+		"tag":        tag,
+		"total_rows": len(records),
+		"created":    len(rows),
+		"queued":     queued,
+		"tasks":      rows,
+		"errors":     rowErrors,
+		"warning":    providerDegradedWarning(providerName),
+	})
+}
+
+// readBulkCSV 读取表头与全部数据行。表头去除 BOM 与首尾空白；
+// 单行的格式错误记录在该行上，不影响其他行
+func readBulkCSV(content []byte) ([]string, []bulkCSVRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("CSV 文件为空")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析 CSV 表头失败: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var records []bulkCSVRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, fmt.Errorf("读取 CSV 失败: %w", err)
+			}
+			records = append(records, bulkCSVRecord{Line: parseErr.StartLine, Err: fmt.Errorf("CSV 格式错误: %v", parseErr.Err)})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, bulkCSVRecord{Line: line, Fields: fields})
+	}
+	return header, records, nil
+}
+
+// templatePlaceholders 返回模板中出现的列名（去重，保持出现顺序）
+func templatePlaceholders(template string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range bulkPlaceholder.FindAllStringSubmatch(template, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// renderBulkTemplate 用一行数据替换模板中的占位符，列缺失或取值为空时返回错误
+func renderBulkTemplate(template string, columns map[string]int, fields []string) (string, error) {
+	var renderErr error
+	prompt := bulkPlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := bulkPlaceholder.FindStringSubmatch(match)[1]
+		index := columns[name]
+		if index >= len(fields) {
+			if renderErr == nil {
+				renderErr = fmt.Errorf("缺少列 %s", name)
+			}
+			return ""
+		}
+		value := strings.TrimSpace(fields[index])
+		if value == "" && renderErr == nil {
+			renderErr = fmt.Errorf("列 %s 为空", name)
+		}
+		return value
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return strings.TrimSpace(prompt), nil
+}
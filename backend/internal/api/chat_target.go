@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatTarget 解析后的对话 Provider 与模型
+type chatTarget struct {
+	providerName string
+	modelName    string
+	chat         provider.ChatProvider
+}
+
+// chatTargetError 解析对话 Provider 失败，附带返回给前端的错误码
+type chatTargetError struct {
+	code    string
+	message string
+}
+
+func (e *chatTargetError) Error() string { return e.message }
+
+// resolveChatTarget 按请求中的 Provider 与模型解析对话配置；未指定 Provider 时使用 fallback
+func resolveChatTarget(providerName, requestModel, fallback string) (*chatTarget, error) {
+	providerName = provider.NormalizeChatProviderName(providerName, fallback)
+
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
+		return nil, &chatTargetError{code: model.ErrCodeProviderNotFound, message: "未找到指定的 Provider: " + providerName}
+	}
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		return nil, &chatTargetError{code: model.ErrCodeProviderKeyMissing, message: "Provider API Key 未配置"}
+	}
+	chat, err := provider.NewChatProvider(&cfg)
+	if err != nil {
+		return nil, &chatTargetError{code: model.ErrCodeValidationFailed, message: err.Error()}
+	}
+
+	resolved := provider.ResolveModelID(provider.ModelResolveOptions{
+		ProviderName: providerName,
+		Purpose:      provider.PurposeChat,
+		RequestModel: requestModel,
+		Config:       &cfg,
+	})
+	if resolved.Err != nil {
+		return nil, &chatTargetError{code: model.ErrCodeValidationFailed, message: resolved.Err.Error()}
+	}
+	if resolved.ID == "" {
+		return nil, &chatTargetError{code: model.ErrCodeValidationFailed, message: "未找到可用的模型"}
+	}
+	return &chatTarget{providerName: providerName, modelName: resolved.ID, chat: chat}, nil
+}
+
+// chatTargetFailed 返回解析对话 Provider 失败的错误响应
+func chatTargetFailed(c *gin.Context, err error) {
+	var targetErr *chatTargetError
+	if errors.As(err, &targetErr) {
+		ErrorWithCode(c, http.StatusBadRequest, 400, targetErr.code, targetErr.message)
+		return
+	}
+	Error(c, http.StatusBadRequest, 400, err.Error())
+}
+
+// chatRequestFailed 返回对话请求失败的错误响应：上游限流返回 429 并附带 Retry-After，
+// 上游服务异常（如 Anthropic overloaded）返回 502，其余按参数错误处理
+func chatRequestFailed(c *gin.Context, target *chatTarget, prefix string, err error) {
+	classification := provider.ClassifyError(target.providerName, err)
+	switch classification.Class {
+	case provider.ErrorClassRateLimit:
+		if classification.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(classification.RetryAfter.Seconds()))))
+		}
+		ErrorWithCode(c, http.StatusTooManyRequests, 429, model.ErrCodeRateLimited, prefix+err.Error())
+	case provider.ErrorClassUpstream:
+		ErrorWithCode(c, http.StatusBadGateway, 502, model.ErrCodeUpstreamError, prefix+err.Error())
+	default:
+		Error(c, http.StatusBadRequest, 400, prefix+err.Error())
+	}
+}
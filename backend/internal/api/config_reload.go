@@ -0,0 +1,23 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReloadConfigHandler 重新读取配置文件并整体替换当前配置，文件有误时返回 400 并保留原配置；
+// 监听地址、数据库路径等只在启动时读取的配置项仍需重启后生效
+func ReloadConfigHandler(c *gin.Context) {
+	if err := config.Reload(); err != nil {
+		log.Printf("[Config] 重新加载配置失败: %v", err)
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "重新加载配置失败: "+err.Error())
+		return
+	}
+	recordAudit(c, "config_reload", gin.H{})
+	Success(c, gin.H{"reloaded": true})
+}
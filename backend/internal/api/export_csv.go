@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csvFlushRows 每写入多少行刷新一次输出
+const csvFlushRows = 200
+
+// csvColumn CSV 导出中的一列
+type csvColumn struct {
+	Name  string
+	Value func(task *model.Task) string
+}
+
+// csvColumns 可导出的列，默认按此顺序全部导出
+var csvColumns = []csvColumn{
+	{"task_id", func(t *model.Task) string { return t.TaskID }},
+	{"prompt", func(t *model.Task) string { return t.Prompt }},
+	{"caption", func(t *model.Task) string { return t.Caption }},
+	{"provider", func(t *model.Task) string { return t.ProviderName }},
+	{"model", func(t *model.Task) string { return t.ModelID }},
+	{"status", func(t *model.Task) string { return t.Status }},
+	{"task_type", func(t *model.Task) string { return t.TaskType }},
+	{"group_id", func(t *model.Task) string { return t.GroupID }},
+	{"dimensions", func(t *model.Task) string {
+		if t.Width <= 0 || t.Height <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dx%d", t.Width, t.Height)
+	}},
+	{"file_size", func(t *model.Task) string { return strconv.FormatInt(t.FileSize, 10) }},
+	{"favorite", func(t *model.Task) string { return strconv.FormatBool(t.Favorite) }},
+	{"private", func(t *model.Task) string { return strconv.FormatBool(t.Private) }},
+	{"tags", func(t *model.Task) string { return strings.Join(t.Tags, ";") }},
+	{"duration_ms", func(t *model.Task) string {
+		if t.CompletedAt == nil || t.CreatedAt.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(t.CompletedAt.Sub(t.CreatedAt).Milliseconds(), 10)
+	}},
+	{"created_at", func(t *model.Task) string { return formatCSVTime(&t.CreatedAt) }},
+	{"completed_at", func(t *model.Task) string { return formatCSVTime(t.CompletedAt) }},
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// selectCSVColumns 解析 columns= 参数（逗号分隔），为空时返回全部列
+func selectCSVColumns(value string) ([]csvColumn, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return csvColumns, nil
+	}
+	var selected []csvColumn
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, column := range csvColumns {
+			if column.Name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, 0, len(csvColumns))
+			for _, column := range csvColumns {
+				names = append(names, column.Name)
+			}
+			return nil, fmt.Errorf("未知的列: %s，可选值: %s", name, strings.Join(names, ", "))
+		}
+	}
+	if len(selected) == 0 {
+		return csvColumns, nil
+	}
+	return selected, nil
+}
+
+// ExportCSVHandler 以 CSV 流式导出任务元数据，筛选条件与 ListImagesHandler 相同；逐行读取游标写出，内存占用不随图库增长。
+// bom=1 时写入 UTF-8 BOM，便于 Excel 识别中文提示词的编码
+func ExportCSVHandler(c *gin.Context) {
+	columns, err := selectCSVColumns(c.Query("columns"))
+	if err != nil {
+		Error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	listSort, err := parseImageSort(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+
+	rows, err := imageListQuery(c).Order(listSort.orderClause()).Rows()
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
+		return
+	}
+	defer rows.Close()
+
+	fileName := fmt.Sprintf("images-%d.csv", time.Now().Unix())
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	c.Status(http.StatusOK)
+
+	if c.Query("bom") == "1" || c.Query("bom") == "true" {
+		if _, err := c.Writer.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return
+		}
+	}
+
+	// encoding/csv 会为包含逗号、引号或换行的字段加引号并转义
+	writer := csv.NewWriter(c.Writer)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return
+	}
+
+	record := make([]string, len(columns))
+	// 按批写出，每批一次性查询标签，避免逐行查询
+	batch := make([]model.Task, 0, csvFlushRows)
+	writeBatch := func() bool {
+		attachTaskTags(model.DB, batch)
+		for i := range batch {
+			for j, column := range columns {
+				record[j] = column.Value(&batch[i])
+			}
+			if err := writer.Write(record); err != nil {
+				return false
+			}
+		}
+		batch = batch[:0]
+		writer.Flush()
+		c.Writer.Flush()
+		return true
+	}
+	for rows.Next() {
+		var task model.Task
+		if err := model.DB.ScanRows(rows, &task); err != nil {
+			log.Printf("[ExportCSV] 读取任务失败: %v", err)
+			continue
+		}
+		batch = append(batch, task)
+		if len(batch) == csvFlushRows && !writeBatch() {
+			return
+		}
+	}
+	if !writeBatch() {
+		return
+	}
+	if err := writer.Error(); err != nil {
+		log.Printf("[ExportCSV] 写入失败: %v", err)
+	}
+}
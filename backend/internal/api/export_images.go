@@ -2,25 +2,55 @@ package api
 
 import (
 	"archive/zip"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"image-gen-service/internal/model"
+	"image-gen-service/pkg/apitypes"
 
 	"github.com/gin-gonic/gin"
 )
 
 const maxExportRemoteSize = 50 * 1024 * 1024
 
-type exportImagesRequest struct {
-	ImageIDs    []string `json:"imageIds"`
-	ImageIDsAlt []string `json:"image_ids"`
+type exportImagesRequest = apitypes.ExportImagesRequest
+
+type exportFileEntry struct {
+	taskID string
+	name   string
+	path   string
+	// size 本地文件大小，远程 URL 为 -1
+	size int64
+}
+
+// exportManifestItem 为 zip 中 manifest.json 的单条记录，单张下载的 metadata.json 使用相同结构
+type exportManifestItem struct {
+	TaskID   string                 `json:"task_id"`
+	File     string                 `json:"file"`
+	Prompt   string                 `json:"prompt"`
+	Caption  string                 `json:"caption,omitempty"`
+	Width    int                    `json:"width,omitempty"`
+	Height   int                    `json:"height,omitempty"`
+	Provider string                 `json:"provider,omitempty"`
+	Model    string                 `json:"model,omitempty"`
+	TaskType string                 `json:"task_type,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	// Seed 仅在生成参数中记录了种子时输出
+	Seed        interface{} `json:"seed,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	DurationMs  int64       `json:"duration_ms,omitempty"`
 }
 
 // ExportImagesHandler exports selected images as a zip archive.
@@ -42,7 +72,7 @@ func ExportImagesHandler(c *gin.Context) {
 
 	var tasks []model.Task
 	if err := model.DB.Where("task_id IN ?", ids).Find(&tasks).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "查询任务失败")
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务失败")
 		return
 	}
 	if len(tasks) == 0 {
@@ -50,16 +80,13 @@ func ExportImagesHandler(c *gin.Context) {
 		return
 	}
 
+	attachTaskTags(model.DB, tasks)
 	taskMap := make(map[string]model.Task, len(tasks))
 	for _, task := range tasks {
 		taskMap[task.TaskID] = task
 	}
 
-	type fileEntry struct {
-		name string
-		path string
-	}
-	var files []fileEntry
+	var files []exportFileEntry
 	var missing []string
 	var exportFailed []string
 
@@ -71,14 +98,16 @@ func ExportImagesHandler(c *gin.Context) {
 		}
 		localPath := strings.TrimSpace(task.LocalPath)
 		if localPath != "" {
-			if _, err := os.Stat(localPath); err == nil {
+			if info, err := os.Stat(localPath); err == nil {
 				ext := filepath.Ext(localPath)
 				if ext == "" {
 					ext = ".png"
 				}
-				files = append(files, fileEntry{
-					name: id + ext,
-					path: localPath,
+				files = append(files, exportFileEntry{
+					taskID: id,
+					name:   id + ext,
+					path:   localPath,
+					size:   info.Size(),
 				})
 				continue
 			} else {
@@ -88,9 +117,9 @@ func ExportImagesHandler(c *gin.Context) {
 			missing = append(missing, fmt.Sprintf("%s: local_path empty", id))
 		}
 
-		remoteURL := strings.TrimSpace(task.ImageURL)
+		remoteURL := strings.TrimSpace(string(task.ImageURL))
 		if remoteURL == "" {
-			remoteURL = strings.TrimSpace(task.ThumbnailURL)
+			remoteURL = strings.TrimSpace(string(task.ThumbnailURL))
 		}
 		if remoteURL != "" {
 			ext := filepath.Ext(remoteURL)
@@ -102,9 +131,11 @@ func ExportImagesHandler(c *gin.Context) {
 			if ext == "" {
 				ext = ".png"
 			}
-			files = append(files, fileEntry{
-				name: id + ext,
-				path: remoteURL,
+			files = append(files, exportFileEntry{
+				taskID: id,
+				name:   id + ext,
+				path:   remoteURL,
+				size:   -1,
 			})
 			continue
 		}
@@ -116,6 +147,19 @@ func ExportImagesHandler(c *gin.Context) {
 		return
 	}
 
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = strings.ToLower(strings.TrimSpace(c.Query("format")))
+	}
+	if format == "pdf" {
+		writePDFExport(c, files, taskMap, append(missing, exportFailed...), req.IncludeHeader || c.Query("header") == "1")
+		return
+	}
+	if format != "" && format != "zip" {
+		Error(c, http.StatusBadRequest, 400, "不支持的导出格式: "+format+"，可选值: zip, pdf")
+		return
+	}
+
 	hasPartial := len(missing) > 0 || len(exportFailed) > 0
 	fileName := fmt.Sprintf("images-%d.zip", time.Now().Unix())
 	c.Header("Content-Type", "application/zip")
@@ -123,60 +167,174 @@ func ExportImagesHandler(c *gin.Context) {
 	if hasPartial {
 		c.Header("X-Export-Partial", "true")
 	}
+
+	// 全部为大小已知的本地文件时以 store 模式写入，可预先算出准确的 Content-Length，浏览器能显示下载进度；
+	// 此时 manifest 需提前生成，任一文件写入失败只能中断响应
+	var manifestData []byte
+	contentLength := int64(-1)
+	if !hasPartial {
+		manifest := make([]exportManifestItem, 0, len(files))
+		for _, entry := range files {
+			manifest = appendManifestItem(manifest, entry, taskMap)
+		}
+		if data, err := json.MarshalIndent(manifest, "", "  "); err == nil {
+			manifestData = data
+			contentLength = storedZipSize(files, manifestData)
+		}
+	}
+	knownLength := contentLength >= 0
+	if knownLength {
+		c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
+	}
 	c.Status(http.StatusOK)
 
-	zipWriter := zip.NewWriter(c.Writer)
-	defer zipWriter.Close()
+	ctx := c.Request.Context()
+	out := &countingWriter{w: c.Writer}
+	zipWriter := zip.NewWriter(out)
+	create := zipWriter.Create
+	if knownLength {
+		create = func(name string) (io.Writer, error) {
+			return zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		}
+	}
+	done := 0
+	abort := func(reason string) {
+		log.Printf("[Export] 导出中断 (%s): 已写入 %d 字节，完成 %d/%d 个文件", reason, out.n, done, len(files))
+	}
 
+	manifest := make([]exportManifestItem, 0, len(files))
 	for _, entry := range files {
+		if err := ctx.Err(); err != nil {
+			abort("客户端已断开")
+			return
+		}
+
 		if strings.HasPrefix(entry.path, "http://") || strings.HasPrefix(entry.path, "https://") {
-			writer, err := zipWriter.Create(entry.name)
+			writer, err := create(entry.name)
 			if err != nil {
 				exportFailed = append(exportFailed, fmt.Sprintf("%s: %v", entry.name, err))
 				hasPartial = true
 				continue
 			}
-			if err := writeRemoteFile(writer, entry.path); err != nil {
+			if err := writeRemoteFileContext(ctx, writer, entry.path); err != nil {
+				if ctx.Err() != nil {
+					abort("客户端已断开")
+					return
+				}
 				exportFailed = append(exportFailed, fmt.Sprintf("%s: %v", entry.name, err))
 				hasPartial = true
+				continue
 			}
+			manifest = appendManifestItem(manifest, entry, taskMap)
+			done++
 			continue
 		}
 
 		file, err := os.Open(entry.path)
 		if err != nil {
+			if knownLength {
+				abort(fmt.Sprintf("%s: %v", entry.name, err))
+				return
+			}
 			missing = append(missing, fmt.Sprintf("%s: %v", entry.name, err))
 			hasPartial = true
 			continue
 		}
 
-		writer, err := zipWriter.Create(entry.name)
+		writer, err := create(entry.name)
 		if err != nil {
 			file.Close()
+			if knownLength {
+				abort(fmt.Sprintf("%s: %v", entry.name, err))
+				return
+			}
 			exportFailed = append(exportFailed, fmt.Sprintf("%s: %v", entry.name, err))
 			hasPartial = true
 			continue
 		}
 
-		if _, err := io.Copy(writer, file); err != nil {
+		reader := &contextReader{ctx: ctx, r: file}
+		if knownLength {
+			// 只写入统计时的大小，文件在导出期间被截短时中断，避免与 Content-Length 不一致
+			_, err = io.CopyN(writer, reader, entry.size)
+		} else {
+			_, err = io.Copy(writer, reader)
+		}
+		file.Close()
+		if err != nil {
+			if ctx.Err() != nil {
+				abort("客户端已断开")
+				return
+			}
+			if knownLength {
+				abort(fmt.Sprintf("%s: %v", entry.name, err))
+				return
+			}
 			missing = append(missing, fmt.Sprintf("%s: %v", entry.name, err))
 			hasPartial = true
 		}
-		file.Close()
+		manifest = appendManifestItem(manifest, entry, taskMap)
+		done++
+	}
+
+	if manifestData == nil {
+		manifestData, _ = json.MarshalIndent(manifest, "", "  ")
+	}
+	if writer, err := create("manifest.json"); err == nil {
+		_, _ = writer.Write(manifestData)
 	}
 
 	if len(missing) > 0 || len(exportFailed) > 0 {
 		hasPartial = true
-		if writer, err := zipWriter.Create("missing.txt"); err == nil {
+		if writer, err := create("missing.txt"); err == nil {
 			lines := append([]string{}, missing...)
 			lines = append(lines, exportFailed...)
 			_, _ = writer.Write([]byte(strings.Join(lines, "\n")))
 		}
 	}
+	if err := zipWriter.Close(); err != nil {
+		abort(err.Error())
+	}
+}
+
+func appendManifestItem(manifest []exportManifestItem, entry exportFileEntry, taskMap map[string]model.Task) []exportManifestItem {
+	task := taskMap[entry.taskID]
+	return append(manifest, newManifestItem(&task, entry.name))
+}
+
+// newManifestItem 根据任务记录生成清单条目，Tags 需由调用方预先填充
+func newManifestItem(task *model.Task, file string) exportManifestItem {
+	item := exportManifestItem{
+		TaskID:      task.TaskID,
+		File:        file,
+		Prompt:      task.Prompt,
+		Caption:     task.Caption,
+		Width:       task.Width,
+		Height:      task.Height,
+		Provider:    task.ProviderName,
+		Model:       task.ModelID,
+		TaskType:    task.TaskType,
+		Tags:        task.Tags,
+		CreatedAt:   task.CreatedAt,
+		CompletedAt: task.CompletedAt,
+	}
+	if params, ok := parseSnapshotObject(task.ConfigSnapshot); ok && len(params) > 0 {
+		item.Params = params
+		item.Seed = params["seed"]
+	}
+	if task.CompletedAt != nil && task.CompletedAt.After(task.CreatedAt) {
+		item.DurationMs = task.CompletedAt.Sub(task.CreatedAt).Milliseconds()
+	}
+	return item
 }
 
-func writeRemoteFile(writer io.Writer, source string) error {
-	resp, err := http.Get(source)
+// writeRemoteFileContext 下载远程文件写入 writer，ctx 取消时中止下载
+func writeRemoteFileContext(ctx context.Context, writer io.Writer, source string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -196,3 +354,63 @@ func writeRemoteFile(writer io.Writer, source string) error {
 	}
 	return nil
 }
+
+// storedZipSize 计算以 store 模式（不压缩、带 data descriptor）写入全部文件和 manifest.json 后的 zip 总大小。
+// 存在远程文件或需要 zip64 时无法预先确定，返回 -1
+func storedZipSize(files []exportFileEntry, manifest []byte) int64 {
+	const (
+		localHeaderLen     = 30
+		dataDescriptorLen  = 16
+		centralHeaderLen   = 46
+		endOfCentralDirLen = 22
+		zip64Limit         = 1<<32 - 1
+	)
+	entry := func(name string, size int64) (int64, int64) {
+		return localHeaderLen + int64(len(name)) + size + dataDescriptorLen, centralHeaderLen + int64(len(name))
+	}
+
+	if len(files)+1 >= 1<<16-1 {
+		return -1
+	}
+	var body, directory int64
+	for _, f := range files {
+		if f.size < 0 || f.size >= zip64Limit {
+			return -1
+		}
+		local, central := entry(f.name, f.size)
+		body += local
+		directory += central
+	}
+	local, central := entry("manifest.json", int64(len(manifest)))
+	body += local
+	directory += central
+	if body >= zip64Limit || directory >= zip64Limit {
+		return -1
+	}
+	return body + directory + endOfCentralDirLen
+}
+
+// countingWriter 统计已写出的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// contextReader 每次读取前检查 ctx，客户端断开后 io.Copy 能尽快返回
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
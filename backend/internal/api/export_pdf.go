@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/pdf"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pdfMargin     = 36.0
+	pdfHeaderSize = 9.0
+	pdfBodySize   = 10.0
+	pdfTitleSize  = 18.0
+	pdfLineGap    = 4.0
+)
+
+// writePDFExport 以 PDF 流式导出所选图片：首页列出导出清单，每张图片缩放适配单独一页，
+// 末页列出无法导出的图片
+func writePDFExport(c *gin.Context, files []exportFileEntry, taskMap map[string]model.Task, failed []string, includeHeader bool) {
+	fileName := fmt.Sprintf("images-%d.pdf", time.Now().Unix())
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	if len(failed) > 0 {
+		c.Header("X-Export-Partial", "true")
+	}
+	c.Status(http.StatusOK)
+
+	writer := pdf.NewWriter(c.Writer)
+
+	// 1. 封面：导出清单
+	lines := make([]string, 0, len(files))
+	for i, entry := range files {
+		task := taskMap[entry.taskID]
+		lines = append(lines, fmt.Sprintf("%d. %s  %s", i+1, entry.taskID, task.Prompt))
+	}
+	title := fmt.Sprintf("Image Export - %d images - %s", len(files), time.Now().Format("2006-01-02 15:04"))
+	if err := writePDFTextPages(writer, title, lines); err != nil {
+		return
+	}
+
+	// 2. 每张图片一页
+	for _, entry := range files {
+		img, err := loadPDFImage(c.Request.Context(), entry.path)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", entry.name, err))
+			continue
+		}
+		task := taskMap[entry.taskID]
+		if err := writer.AddPage(buildPDFImagePage(img, &task, includeHeader)); err != nil {
+			return
+		}
+		if flusher, ok := c.Writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	// 3. 失败清单（与 zip 导出的 missing.txt 一致）
+	if len(failed) > 0 {
+		if err := writePDFTextPages(writer, "Missing / failed items", failed); err != nil {
+			return
+		}
+	}
+
+	_ = writer.Close()
+}
+
+func buildPDFImagePage(img *pdf.Image, task *model.Task, includeHeader bool) pdf.Page {
+	pageW, pageH := pdf.A4Width, pdf.A4Height
+	if img.Width > img.Height {
+		pageW, pageH = pdf.A4Height, pdf.A4Width
+	}
+
+	page := pdf.Page{Width: pageW, Height: pageH, Image: img}
+	top := pageH - pdfMargin
+	if includeHeader {
+		maxWidth := pageW - 2*pdfMargin
+		promptLine := pdf.Truncate(task.Prompt, pdfHeaderSize, maxWidth)
+		dateLine := task.CreatedAt.Format("2006-01-02 15:04:05")
+		if task.ProviderName != "" {
+			dateLine += "  " + task.ProviderName
+		}
+		if task.ModelID != "" {
+			dateLine += " / " + task.ModelID
+		}
+		headerLines := []string{promptLine, dateLine}
+		if task.Caption != "" {
+			headerLines = append(headerLines, pdf.Truncate(task.Caption, pdfHeaderSize, maxWidth))
+		}
+		for _, line := range headerLines {
+			top -= pdfHeaderSize
+			page.Texts = append(page.Texts, pdf.Text{X: pdfMargin, Y: top, Size: pdfHeaderSize, Str: line})
+			top -= pdfLineGap
+		}
+		top -= pdfLineGap + 6
+	}
+
+	// 等比缩放到可用区域并居中
+	availW := pageW - 2*pdfMargin
+	availH := top - pdfMargin
+	scale := availW / float64(img.Width)
+	if s := availH / float64(img.Height); s < scale {
+		scale = s
+	}
+	drawW, drawH := float64(img.Width)*scale, float64(img.Height)*scale
+	page.ImageRect = [4]float64{
+		(pageW - drawW) / 2,
+		pdfMargin + (availH-drawH)/2,
+		drawW,
+		drawH,
+	}
+	return page
+}
+
+// writePDFTextPages 写入标题与多行文本，超出一页时自动续页
+func writePDFTextPages(writer *pdf.Writer, title string, lines []string) error {
+	maxWidth := pdf.A4Width - 2*pdfMargin
+	lineHeight := pdfBodySize + pdfLineGap
+	y := 0.0
+	var page *pdf.Page
+	flush := func() error {
+		if page == nil {
+			return nil
+		}
+		err := writer.AddPage(*page)
+		page = nil
+		return err
+	}
+	newPage := func() {
+		page = &pdf.Page{Width: pdf.A4Width, Height: pdf.A4Height}
+		y = pdf.A4Height - pdfMargin - pdfTitleSize
+		page.Texts = append(page.Texts, pdf.Text{X: pdfMargin, Y: y, Size: pdfTitleSize, Str: pdf.Truncate(title, pdfTitleSize, maxWidth)})
+		y -= pdfTitleSize
+	}
+
+	newPage()
+	for _, line := range lines {
+		if y-lineHeight < pdfMargin {
+			if err := flush(); err != nil {
+				return err
+			}
+			newPage()
+		}
+		y -= lineHeight
+		page.Texts = append(page.Texts, pdf.Text{X: pdfMargin, Y: y, Size: pdfBodySize, Str: pdf.Truncate(line, pdfBodySize, maxWidth)})
+	}
+	return flush()
+}
+
+// loadPDFImage 读取本地或远程图片并转换为可嵌入 PDF 的 JPEG；JPEG 原样嵌入，
+// 其他格式重新编码（透明区域铺白底）
+func loadPDFImage(ctx context.Context, source string) (*pdf.Image, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		var buf bytes.Buffer
+		if err = writeRemoteFileContext(ctx, &buf, source); err == nil {
+			data = buf.Bytes()
+		}
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && format == "jpeg" {
+		switch cfg.ColorModel {
+		case color.YCbCrModel, color.RGBAModel:
+			return &pdf.Image{Data: data, Width: cfg.Width, Height: cfg.Height, Components: 3}, nil
+		case color.GrayModel:
+			return &pdf.Image{Data: data, Width: cfg.Width, Height: cfg.Height, Components: 1}, nil
+		}
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %v", err)
+	}
+	bounds := img.Bounds()
+	flat := imaging.New(bounds.Dx(), bounds.Dy(), color.White)
+	flat = imaging.Overlay(flat, img, image.Pt(0, 0), 1.0)
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, flat, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return &pdf.Image{Data: out.Bytes(), Width: bounds.Dx(), Height: bounds.Dy(), Components: 3}, nil
+}
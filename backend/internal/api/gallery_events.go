@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// galleryEventBuffer 每个订阅者的缓冲事件数，消费过慢时丢弃新事件，前端可整页刷新兜底
+const galleryEventBuffer = 16
+
+// galleryEvent 图库变更通知，前端按 TaskIDs 刷新对应卡片
+type galleryEvent struct {
+	Type    string   `json:"type"` // images_updated
+	TaskIDs []string `json:"task_ids"`
+}
+
+var (
+	galleryMu          sync.Mutex
+	gallerySubscribers = make(map[chan galleryEvent]struct{})
+)
+
+// publishGalleryEvent 通知所有打开的图库视图，不会阻塞调用方
+func publishGalleryEvent(event galleryEvent) {
+	galleryMu.Lock()
+	defer galleryMu.Unlock()
+	for ch := range gallerySubscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// NotifyThumbnailUpdated 后台缩略图生成完成或失败后通知图库刷新该图片，由 Worker 回调
+func NotifyThumbnailUpdated(taskID string) {
+	publishGalleryEvent(galleryEvent{Type: "images_updated", TaskIDs: []string{taskID}})
+}
+
+func subscribeGallery() chan galleryEvent {
+	ch := make(chan galleryEvent, galleryEventBuffer)
+	galleryMu.Lock()
+	gallerySubscribers[ch] = struct{}{}
+	galleryMu.Unlock()
+	return ch
+}
+
+func unsubscribeGallery(ch chan galleryEvent) {
+	galleryMu.Lock()
+	delete(gallerySubscribers, ch)
+	galleryMu.Unlock()
+}
+
+// StreamGalleryHandler 通过 SSE 推送图库范围的变更通知（如批量打标签、收藏），已打开的图库页据此刷新对应卡片
+func StreamGalleryHandler(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		Error(c, http.StatusInternalServerError, 500, "Streaming unsupported")
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ch := subscribeGallery()
+	defer unsubscribeGallery(ch)
+
+	c.Status(http.StatusOK)
+	if !writeSSEPreamble(c.Writer, flusher) {
+		return
+	}
+
+	keepAliveTicker := time.NewTicker(taskStreamKeepAlive)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-ch:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, payload); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAliveTicker.C:
+			if _, err := fmt.Fprintf(c.Writer, "event: ping\ndata: {}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -1,9 +1,6 @@
 package api
 
 import (
-	"context"
-	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,27 +11,21 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"image-gen-service/internal/config"
 	"image-gen-service/internal/model"
 	"image-gen-service/internal/provider"
 	"image-gen-service/internal/storage"
 	"image-gen-service/internal/worker"
+	"image-gen-service/pkg/apitypes"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
-	"google.golang.org/genai"
+	"gorm.io/gorm"
 )
 
-// Response 统一 API 响应结构
-type Response struct {
-	Code    int         `json:"code"`    // 业务状态码: 200 为成功，其他为失败
-	Message string      `json:"message"` // 提示信息
-	Data    interface{} `json:"data"`    // 返回数据
-}
+// Response 统一 API 响应结构，定义在 pkg/apitypes 中与 Go 客户端共用
+type Response = apitypes.Response
 
 // Success 成功响应
 func Success(c *gin.Context, data interface{}) {
@@ -47,18 +38,75 @@ func Success(c *gin.Context, data interface{}) {
 
 // Error 错误响应
 func Error(c *gin.Context, httpStatus int, code int, message string) {
+	ErrorWithCode(c, httpStatus, code, defaultErrorCode(httpStatus), message)
+}
+
+// ErrorWithCode 错误响应，附带明确的错误码
+func ErrorWithCode(c *gin.Context, httpStatus int, code int, errorCode string, message string) {
 	c.JSON(httpStatus, Response{
-		Code:    code,
-		Message: message,
-		Data:    nil,
+		Code:      code,
+		Message:   message,
+		Data:      nil,
+		ErrorCode: errorCode,
 	})
 }
 
+// ValidationFailed 参数校验失败响应；err 为 provider.ValidationError 时 data.errors 逐项列出出错字段
+func ValidationFailed(c *gin.Context, err error) {
+	var verr *provider.ValidationError
+	if !errors.As(err, &verr) {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+	c.JSON(http.StatusBadRequest, Response{
+		Code:      400,
+		Message:   err.Error(),
+		Data:      gin.H{"errors": verr.Errors},
+		ErrorCode: model.ErrCodeValidationFailed,
+	})
+}
+
+// defaultErrorCode 未指定错误码时按 HTTP 状态码推断
+func defaultErrorCode(httpStatus int) string {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return model.ErrCodeValidationFailed
+	case http.StatusUnauthorized:
+		return model.ErrCodeUnauthorized
+	case http.StatusNotFound:
+		return model.ErrCodeNotFound
+	case http.StatusConflict:
+		return model.ErrCodeConflict
+	case http.StatusBadGateway:
+		return model.ErrCodeUpstreamError
+	default:
+		return model.ErrCodeInternal
+	}
+}
+
 // GenerateRequest 生成图片请求参数
-type GenerateRequest struct {
-	Provider string                 `json:"provider" binding:"required"`
-	ModelID  string                 `json:"model_id"`
-	Params   map[string]interface{} `json:"params"`
+type GenerateRequest = apitypes.GenerateRequest
+
+// generateResponse 生成接口的响应：任务字段之外附带相近的历史任务
+type generateResponse struct {
+	*model.Task
+	SimilarTasks []similarPrompt `json:"similar_tasks,omitempty"`
+	// Warning 提交到健康检查降级的 Provider 时给出提示，不影响任务提交
+	Warning string `json:"warning,omitempty"`
+}
+
+// normalizeTaskTimeout 任务级超时：校验后按配置范围截断，写回参数供 Worker 使用并记录到配置快照
+func normalizeTaskTimeout(params map[string]interface{}) error {
+	raw, ok := params["timeout_seconds"]
+	if !ok {
+		return nil
+	}
+	seconds, isNumber := raw.(float64)
+	if !isNumber || seconds <= 0 || seconds != float64(int(seconds)) {
+		return errors.New("params.timeout_seconds 必须是正整数")
+	}
+	params["timeout_seconds"] = worker.ClampTaskTimeout(int(seconds))
+	return nil
 }
 
 func buildConfigSnapshot(providerName, modelID string, params map[string]interface{}) string {
@@ -90,6 +138,17 @@ func buildConfigSnapshot(providerName, modelID string, params map[string]interfa
 		snapshot["imageSize"] = v
 	}
 
+	if v, ok := params["timeout_seconds"].(int); ok && v > 0 {
+		snapshot["timeout_seconds"] = v
+	}
+
+	if v, ok := params["enforce_aspect"].(string); ok && v != "" {
+		snapshot["enforce_aspect"] = v
+		if gravity, ok := params["crop_gravity"].(string); ok && gravity != "" {
+			snapshot["crop_gravity"] = gravity
+		}
+	}
+
 	// count 可能是 float64（JSON 解析）或 int（服务内部）
 	if v, ok := params["count"].(int); ok && v > 0 {
 		snapshot["count"] = v
@@ -124,18 +183,71 @@ func defaultTimeoutSecondsForProvider(providerName string) int {
 	}
 }
 
-// ProviderConfigRequest 设置 Provider 配置请求
+// ProviderConfigRequest 设置 Provider 配置请求。除 provider_name 外的字段均可省略，
+// 省略的字段保持原值，例如只切换 enabled 或只修改超时时间时无需重新提交 api_key；
+// 创建新配置时必须提供 api_key
 type ProviderConfigRequest struct {
-	ProviderName string `json:"provider_name" binding:"required"`
-	DisplayName  string `json:"display_name"`
-	APIBase      string `json:"api_base" binding:"required"`
-	APIKey       string `json:"api_key" binding:"required"`
-	Enabled      bool   `json:"enabled"`
-	ModelID      string `json:"model_id"`
-	TimeoutSecs  *int   `json:"timeout_seconds"`
+	ProviderName string  `json:"provider_name" binding:"required"`
+	DisplayName  *string `json:"display_name"`
+	APIBase      *string `json:"api_base"`
+	APIKey       *string `json:"api_key"`
+	Enabled      *bool   `json:"enabled"` // 创建时省略视为启用
+	ModelID      *string `json:"model_id"`
+	TimeoutSecs  *int    `json:"timeout_seconds"`
+	Purpose      string  `json:"purpose"` // 前端所在的设置分区: image / chat，可选
+	// DefaultParams 默认生成参数（JSON 对象），未传时保持原值，null 或 {} 表示清除
+	DefaultParams json.RawMessage `json:"default_params"`
+}
+
+// optionalString 读取可省略的字符串字段，省略时为空字符串
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// providerView 在 Provider 配置上附加用途，便于前端分区展示
+type providerView struct {
+	model.ProviderConfig
+	Purpose provider.ModelPurpose `json:"purpose"`
+	// Health 后台健康检查结果，未开启检查或尚未检查时为空
+	Health *providerHealthStatus `json:"health,omitempty"`
+	// Init 生图客户端的初始化状态，对话配置为空
+	Init *provider.InitStatus `json:"init,omitempty"`
+	// MaxCount 单次生成数量上限，供前端限制数量选择，对话配置为空
+	MaxCount int `json:"max_count,omitempty"`
+	// QueuedTasks 尚未完成（排队、限流等待、处理中）的任务数
+	QueuedTasks int64 `json:"queued_tasks,omitempty"`
+	// Draining 已停用但仍在执行停用前排队的任务，这期间不接受新任务
+	Draining bool `json:"draining,omitempty"`
+}
+
+// validateProviderPurpose 防止对话配置被当作生图配置保存，或把对话模型填进生图配置（反之亦然）
+func validateProviderPurpose(req *ProviderConfigRequest) error {
+	purpose := provider.PurposeForProvider(req.ProviderName)
+	if req.Purpose != "" && provider.ModelPurpose(strings.ToLower(strings.TrimSpace(req.Purpose))) != purpose {
+		if purpose == provider.PurposeChat {
+			return fmt.Errorf("%s 是对话配置，不能作为生图 Provider 保存", req.ProviderName)
+		}
+		return fmt.Errorf("%s 是生图配置，不能作为对话 Provider 保存", req.ProviderName)
+	}
+	modelID := optionalString(req.ModelID)
+	capabilities := provider.DetectModelCapabilities(modelID)
+	if len(capabilities) == 0 {
+		return nil
+	}
+	entry := provider.ModelEntry{ID: modelID, Capabilities: capabilities}
+	if !entry.Supports(purpose) {
+		if purpose == provider.PurposeImage {
+			return fmt.Errorf("模型 %s 不支持图片生成，请在对话配置中使用该模型", modelID)
+		}
+		return fmt.Errorf("模型 %s 是图片生成模型，请在生图配置中使用该模型", modelID)
+	}
+	return nil
 }
 
-// UpdateProviderConfigHandler 更新 Provider 配置
+// UpdateProviderConfigHandler 创建或更新 Provider 配置，请求中省略的字段保持原值；仅在配置尚不存在时要求 api_key
 func UpdateProviderConfigHandler(c *gin.Context) {
 	var req ProviderConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -146,11 +258,26 @@ func UpdateProviderConfigHandler(c *gin.Context) {
 	}
 
 	log.Printf("[API] 收到配置更新请求: Provider=%s, Base=%s, KeyLen=%d\n",
-		req.ProviderName, req.APIBase, len(req.APIKey))
+		req.ProviderName, optionalString(req.APIBase), len(optionalString(req.APIKey)))
+
+	if err := validateProviderPurpose(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	var defaultParams string
+	if req.DefaultParams != nil {
+		normalized, err := normalizeDefaultParams(req.ProviderName, req.DefaultParams)
+		if err != nil {
+			ValidationFailed(c, err)
+			return
+		}
+		defaultParams = normalized
+	}
 
 	if model.DB == nil {
 		log.Printf("[API] 数据库未初始化\n")
-		Error(c, http.StatusInternalServerError, 500, "数据库未初始化")
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "数据库未初始化")
 		return
 	}
 
@@ -159,39 +286,70 @@ func UpdateProviderConfigHandler(c *gin.Context) {
 	if err != nil {
 		log.Printf("[API] 配置不存在，准备创建: %s\n", req.ProviderName)
 		// 不存在则创建
-		modelsJSON := buildModelsJSON(req.ProviderName, req.ModelID, "")
+		if strings.TrimSpace(optionalString(req.APIKey)) == "" {
+			verr := &provider.ValidationError{}
+			verr.Add("api_key", "创建配置时 api_key 不能为空", nil, nil)
+			ValidationFailed(c, verr)
+			return
+		}
+		modelsJSON := buildModelsJSON(req.ProviderName, optionalString(req.ModelID), "")
 		timeoutSeconds := defaultTimeoutSecondsForProvider(req.ProviderName)
 		if req.TimeoutSecs != nil && *req.TimeoutSecs > 0 {
 			timeoutSeconds = *req.TimeoutSecs
 		}
 
+		enabled := req.Enabled == nil || *req.Enabled
 		configData = model.ProviderConfig{
 			ProviderName:   req.ProviderName,
-			DisplayName:    req.DisplayName,
-			APIBase:        req.APIBase,
-			APIKey:         req.APIKey,
+			DisplayName:    optionalString(req.DisplayName),
+			APIBase:        optionalString(req.APIBase),
+			APIKey:         optionalString(req.APIKey),
 			Models:         modelsJSON,
-			Enabled:        req.Enabled,
+			Enabled:        enabled,
 			TimeoutSeconds: timeoutSeconds,
+			DefaultParams:  defaultParams,
 		}
 		if err := model.DB.Create(&configData).Error; err != nil {
 			log.Printf("[API] 创建配置失败: %v\n", err)
-			Error(c, http.StatusInternalServerError, 500, "保存配置到数据库失败: "+err.Error())
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存配置到数据库失败: "+err.Error())
 			return
 		}
+		// enabled 列带有 default:true，创建时 false 会被当作零值忽略，需要单独写入
+		if !enabled {
+			if err := model.DB.Model(&configData).Update("enabled", false).Error; err != nil {
+				log.Printf("[API] 创建配置失败: %v\n", err)
+				ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存配置到数据库失败: "+err.Error())
+				return
+			}
+		}
 	} else {
 		log.Printf("[API] 配置已存在，准备更新: %s\n", req.ProviderName)
-		// 存在则更新
-		updates := map[string]interface{}{
-			"api_base": req.APIBase,
-			"api_key":  req.APIKey,
-			"enabled":  req.Enabled,
+		// 存在则只更新请求中出现的字段
+		updates := map[string]interface{}{}
+		if req.APIBase != nil {
+			updates["api_base"] = *req.APIBase
+		}
+		if req.APIKey != nil {
+			updates["api_key"] = *req.APIKey
+		}
+		if req.Enabled != nil {
+			updates["enabled"] = *req.Enabled
+		}
+		if req.DisplayName != nil && *req.DisplayName != "" {
+			updates["display_name"] = *req.DisplayName
 		}
-		if req.DisplayName != "" {
-			updates["display_name"] = req.DisplayName
+		// 地址或密钥变化后，旧的模型列表缓存不再可信
+		if (req.APIBase != nil && *req.APIBase != configData.APIBase) || (req.APIKey != nil && *req.APIKey != configData.APIKey) {
+			updates["models_cache"] = ""
+			updates["models_cached_at"] = nil
 		}
-		if modelsJSON := buildModelsJSON(req.ProviderName, req.ModelID, configData.Models); modelsJSON != "" {
-			updates["models"] = modelsJSON
+		if req.ModelID != nil {
+			if modelsJSON := buildModelsJSON(req.ProviderName, *req.ModelID, configData.Models); modelsJSON != "" {
+				updates["models"] = modelsJSON
+			}
+		}
+		if req.DefaultParams != nil {
+			updates["default_params"] = defaultParams
 		}
 		if req.TimeoutSecs != nil {
 			if *req.TimeoutSecs > 0 {
@@ -200,16 +358,23 @@ func UpdateProviderConfigHandler(c *gin.Context) {
 				updates["timeout_seconds"] = defaultTimeoutSecondsForProvider(req.ProviderName)
 			}
 		}
+		if len(updates) == 0 {
+			Success(c, "配置未变化")
+			return
+		}
 		if err := model.DB.Model(&configData).Updates(updates).Error; err != nil {
 			log.Printf("[API] 更新配置失败: %v\n", err)
-			Error(c, http.StatusInternalServerError, 500, "更新配置到数据库失败: "+err.Error())
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "更新配置到数据库失败: "+err.Error())
 			return
 		}
 	}
 
-	// 重新初始化 Provider 注册表
-	log.Printf("[API] 重新初始化 Provider 注册表...\n")
-	if err := provider.InitProviders(); err != nil {
+	// 配置变化后丢弃缓存的对话客户端
+	provider.InvalidateChatClients(req.ProviderName)
+
+	// 只重新加载本次修改的 Provider，其他 Provider 及正在执行的任务不受影响
+	log.Printf("[API] 重新加载 Provider %s...\n", req.ProviderName)
+	if err := provider.ReloadProvider(req.ProviderName); err != nil {
 		log.Printf("[API] 重新加载 Provider 失败: %v\n", err)
 		// 虽然加载失败，但配置已经保存了，所以这里我们可以选择返回成功或警告
 		// 为了严谨，我们返回一个 500
@@ -225,10 +390,47 @@ func UpdateProviderConfigHandler(c *gin.Context) {
 func ListProvidersHandler(c *gin.Context) {
 	var configs []model.ProviderConfig
 	if err := model.DB.Find(&configs).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "获取配置失败")
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "获取配置失败")
 		return
 	}
-	Success(c, configs)
+	queued := unfinishedTaskCounts()
+	views := make([]providerView, 0, len(configs))
+	for _, cfg := range configs {
+		view := providerView{
+			ProviderConfig: cfg,
+			Purpose:        provider.PurposeForProvider(cfg.ProviderName),
+			Health:         getProviderHealth(cfg.ProviderName),
+			Init:           provider.ProviderInitStatus(cfg.ProviderName),
+		}
+		if view.Purpose == provider.PurposeImage {
+			view.MaxCount = provider.ConfigMaxCount(&cfg)
+			view.QueuedTasks = queued[cfg.ProviderName]
+			view.Draining = !cfg.Enabled && view.QueuedTasks > 0
+		}
+		views = append(views, view)
+	}
+	Success(c, views)
+}
+
+// unfinishedTaskCounts 按 Provider 统计尚未完成的任务数，查询失败时返回空结果
+func unfinishedTaskCounts() map[string]int64 {
+	var rows []struct {
+		ProviderName string
+		Count        int64
+	}
+	err := model.DB.Model(&model.Task{}).
+		Select("provider_name, COUNT(*) AS count").
+		Where("status IN ?", []string{"pending", "processing", worker.StatusRateLimited}).
+		Group("provider_name").
+		Scan(&rows).Error
+	if err != nil {
+		log.Printf("[API] 统计未完成任务失败: %v", err)
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ProviderName] = row.Count
+	}
+	return counts
 }
 
 // PromptOptimizeRequest 提示词优化请求
@@ -237,9 +439,11 @@ type PromptOptimizeRequest struct {
 	Model          string `json:"model"`
 	Prompt         string `json:"prompt" binding:"required"`
 	ResponseFormat string `json:"response_format"`
+	// Language 输出语言代码（如 en / zh），为空时按提示词内容自动判断
+	Language string `json:"language"`
 }
 
-// OptimizePromptHandler 使用 OpenAI 标准接口优化提示词
+// OptimizePromptHandler 使用对话 Provider 优化提示词
 func OptimizePromptHandler(c *gin.Context) {
 	var req PromptOptimizeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -247,59 +451,40 @@ func OptimizePromptHandler(c *gin.Context) {
 		return
 	}
 
-	providerName := strings.TrimSpace(strings.ToLower(req.Provider))
-	if providerName == "" {
-		providerName = "openai-chat"
-	}
-	if providerName == "openai" {
-		providerName = "openai-chat"
-	}
-	if providerName == "gemini" {
-		providerName = "gemini-chat"
-	}
-	req.Provider = providerName
 	if strings.TrimSpace(req.Prompt) == "" {
 		Error(c, http.StatusBadRequest, 400, "prompt 不能为空")
 		return
 	}
-
-	var cfg model.ProviderConfig
-	if err := model.DB.Where("provider_name = ?", req.Provider).First(&cfg).Error; err != nil {
-		Error(c, http.StatusBadRequest, 400, "未找到指定的 Provider: "+req.Provider)
-		return
-	}
-	if strings.TrimSpace(cfg.APIKey) == "" {
-		Error(c, http.StatusBadRequest, 400, "Provider API Key 未配置")
+	if err := checkOptimizeInput(req.Prompt); err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
 		return
 	}
-
-	modelName := provider.ResolveModelID(provider.ModelResolveOptions{
-		ProviderName: req.Provider,
-		Purpose:      provider.PurposeChat,
-		RequestModel: req.Model,
-		Config:       &cfg,
-	}).ID
-	if modelName == "" {
-		Error(c, http.StatusBadRequest, 400, "未找到可用的模型")
+	target, err := resolveChatTarget(req.Provider, req.Model, "openai-chat")
+	if err != nil {
+		chatTargetFailed(c, err)
 		return
 	}
 
 	responseFormat := strings.ToLower(strings.TrimSpace(req.ResponseFormat))
 	forceJSON := responseFormat == "json" || responseFormat == "json_object" || responseFormat == "application/json"
-
-	var optimized string
-	var err error
-	if req.Provider == "gemini-chat" {
-		optimized, err = callGeminiOptimize(c.Request.Context(), &cfg, modelName, req.Prompt, forceJSON)
-	} else {
-		optimized, err = callOpenAIOptimize(c.Request.Context(), &cfg, modelName, req.Prompt, forceJSON)
+	language := normalizePromptLanguage(req.Language)
+	if language == "" {
+		language = detectPromptLanguage(req.Prompt)
+	}
+	optimized, err := target.chat.Complete(c.Request.Context(), []provider.ChatMessage{{Role: "user", Text: req.Prompt}}, provider.ChatOptions{
+		Model:  target.modelName,
+		System: getOptimizeSystemPromptFor(language, forceJSON),
+		JSON:   forceJSON,
+	})
+	if err == nil && optimized == "" {
+		err = fmt.Errorf("未返回优化结果")
 	}
 	if err != nil {
-		Error(c, http.StatusBadRequest, 400, err.Error())
+		chatRequestFailed(c, target, "", err)
 		return
 	}
 
-	Success(c, gin.H{"prompt": optimized})
+	Success(c, gin.H{"prompt": optimized, "language": language})
 }
 
 // GenerateHandler 处理图片生成请求
@@ -310,86 +495,49 @@ func GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	fanout, err := parseFanout(req.Fanout)
+	if err != nil {
+		ValidationFailed(c, err)
+		return
+	}
+
 	// 1. 获取并校验 Provider
 	p := provider.GetProvider(req.Provider)
 	if p == nil {
-		Error(c, http.StatusBadRequest, 400, "未找到指定的 Provider: "+req.Provider)
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderNotFound, provider.UnavailableError(req.Provider).Error())
 		return
 	}
 
 	if req.Params == nil {
 		req.Params = map[string]interface{}{}
 	}
-	modelID := provider.ResolveModelID(provider.ModelResolveOptions{
-		ProviderName: req.Provider,
-		Purpose:      provider.PurposeImage,
-		RequestModel: req.ModelID,
-		Params:       req.Params,
-		Config:       fetchProviderConfig(req.Provider),
-	}).ID
-	if modelID != "" {
-		req.Params["model_id"] = modelID
-	}
-
-	// 2. 校验参数（包含你提到的比例和分辨率）
-	if err := p.ValidateParams(req.Params); err != nil {
-		Error(c, http.StatusBadRequest, 400, err.Error())
-		return
-	}
-
-	taskID := uuid.New().String()
-	prompt, _ := req.Params["prompt"].(string)
-	if prompt == "" {
-		Error(c, http.StatusBadRequest, 400, "params.prompt 不能为空")
-		return
-	}
-
-	taskModel := &model.Task{
-		TaskID:         taskID,
-		Prompt:         prompt,
-		ProviderName:   req.Provider,
-		ModelID:        modelID,
-		TotalCount:     1, // 目前单次请求只生成一张，后续可扩展
-		Status:         "pending",
-		ConfigSnapshot: buildConfigSnapshot(req.Provider, modelID, req.Params),
-	}
-
-	if count, ok := req.Params["count"].(float64); ok {
-		taskModel.TotalCount = int(count)
-	} else if count, ok := req.Params["count"].(int); ok {
-		taskModel.TotalCount = count
-	}
-
-	if err := model.DB.Create(taskModel).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "创建任务失败")
+	// 2. 归一化并校验参数（包含比例和分辨率）
+	sub, ok := prepareGenerateSubmission(c, p, req.Provider, req.ModelID, req.Params)
+	if !ok {
 		return
 	}
 
-	// 提交到 Worker 池
-	task := &worker.Task{
-		TaskModel: taskModel,
-		Params:    req.Params,
+	// 在创建任务前查找，避免匹配到本次任务
+	if req.DedupeWarn {
+		sub.Similar = findSimilarPrompts(sub.Prompt, similarThreshold(), similarDefaultLimit)
 	}
-
-	if !worker.Pool.Submit(task) {
-		model.DB.Model(taskModel).Updates(map[string]interface{}{
-			"status":        "failed",
-			"error_message": "任务队列已满，请稍后再试",
-		})
-		Error(c, http.StatusServiceUnavailable, 503, "服务器繁忙，请稍后再试")
-		return
-	}
-
-	Success(c, taskModel)
+	sub.AutoCancel = req.AutoCancelOnDisconnect
+	sub.Fanout = fanout
+	submitGenerateTask(c, sub)
 }
 
 // GenerateWithImagesHandler 处理带图片的生成请求
 func GenerateWithImagesHandler(c *gin.Context) {
 	log.Printf("[API] 收到图生图请求\n")
-	// 1. 解析 multipart 请求
-	req, err := ParseGenerateRequestFromMultipart(c)
+	// 1. 解析请求（multipart 表单或内联 base64 参考图的 JSON）
+	req, err := parseGenerateWithImagesRequest(c)
 	if err != nil {
-		log.Printf("[API] 解析 multipart 请求失败: %v\n", err)
+		log.Printf("[API] 解析图生图请求失败: %v\n", err)
+		var limitErr *uploadError
+		if errors.As(err, &limitErr) {
+			Error(c, limitErr.Status, limitErr.Status, limitErr.Message)
+			return
+		}
 		Error(c, http.StatusBadRequest, 400, "解析请求失败: "+err.Error())
 		return
 	}
@@ -398,7 +546,7 @@ func GenerateWithImagesHandler(c *gin.Context) {
 	// 2. 校验 Provider
 	p := provider.GetProvider(req.Provider)
 	if p == nil {
-		Error(c, http.StatusBadRequest, 400, "未找到指定的 Provider: "+req.Provider)
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderNotFound, provider.UnavailableError(req.Provider).Error())
 		return
 	}
 
@@ -414,86 +562,59 @@ func GenerateWithImagesHandler(c *gin.Context) {
 	// 处理本地路径请求 (Tauri 优化)
 	for _, path := range req.RefPaths {
 		if path != "" {
-			content, err := os.ReadFile(path)
+			content, err := readRefPath(path)
 			if err != nil {
 				log.Printf("[API] 读取本地参考图失败: %s, err: %v\n", path, err)
-				continue
+				Error(c, http.StatusBadRequest, 400, err.Error())
+				return
 			}
 			refImageBytes = append(refImageBytes, content)
 		}
 	}
 
-	modelID := provider.ResolveModelID(provider.ModelResolveOptions{
-		ProviderName: req.Provider,
-		Purpose:      provider.PurposeImage,
-		RequestModel: req.ModelID,
-		Config:       fetchProviderConfig(req.Provider),
-	}).ID
 	taskParams := map[string]interface{}{
 		"prompt":           req.Prompt,
 		"provider":         req.Provider,
-		"model_id":         modelID,
 		"aspect_ratio":     req.AspectRatio,
 		"resolution_level": req.ImageSize,
 		"count":            req.Count,
 		"reference_images": refImageBytes, // 传递 interface 列表，方便 Provider 类型断言
 	}
-
-	log.Printf("[API] 提交任务: Prompt=%s, Images=%d\n", req.Prompt, len(refImageBytes))
-
-	// 3. 校验参数
-	if err := p.ValidateParams(taskParams); err != nil {
-		Error(c, http.StatusBadRequest, 400, err.Error())
-		return
-	}
-
-	taskID := uuid.New().String()
-	taskModel := &model.Task{
-		TaskID:         taskID,
-		Prompt:         req.Prompt,
-		ProviderName:   req.Provider,
-		ModelID:        modelID,
-		TotalCount:     req.Count,
-		Status:         "pending",
-		ConfigSnapshot: buildConfigSnapshot(req.Provider, modelID, taskParams),
+	if req.Private != "" {
+		taskParams["private"] = req.Private
 	}
 
-	if err := model.DB.Create(taskModel).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "创建任务失败")
+	// 3. 归一化并校验参数，与 GenerateHandler 共用同一套规则
+	sub, ok := prepareGenerateSubmission(c, p, req.Provider, req.ModelID, taskParams)
+	if !ok {
 		return
 	}
+	log.Printf("[API] 提交任务: Prompt=%s, Images=%d\n", sub.Prompt, len(refImageBytes))
 
-	// 4. 提交到 Worker 池
-	task := &worker.Task{
-		TaskModel: taskModel,
-		Params:    taskParams,
-	}
-
-	if !worker.Pool.Submit(task) {
-		model.DB.Model(taskModel).Updates(map[string]interface{}{
-			"status":        "failed",
-			"error_message": "任务队列已满，请稍后再试",
-		})
-		Error(c, http.StatusServiceUnavailable, 503, "服务器繁忙，请稍后再试")
-		return
+	sub.References = make([][]byte, 0, len(refImageBytes))
+	for _, ref := range refImageBytes {
+		if data, ok := ref.([]byte); ok {
+			sub.References = append(sub.References, data)
+		}
 	}
+	sub.AutoCancel = parseAutoCancel(req.AutoCancel)
 
-	Success(c, taskModel)
+	// 4. 提交到 Worker 池，任务记录与参考图记录在占用队列名额后一并写入
+	submitGenerateTask(c, sub)
 }
 
 // GetTaskHandler 获取任务状态
 func GetTaskHandler(c *gin.Context) {
 	taskID := c.Param("task_id")
-	var task model.Task
-	if err := model.DB.Where("task_id = ?", taskID).First(&task).Error; err != nil {
-		Error(c, http.StatusNotFound, 404, "任务未找到")
+	view, err := taskDetailStore.load(taskID)
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
 		return
 	}
-
-	Success(c, task)
+	Success(c, view)
 }
 
-// ListImagesHandler 获取图片列表（含搜索）
+// ListImagesHandler 获取图片列表（含搜索），默认不返回完整提示词，传 fields=prompt 时返回
 func ListImagesHandler(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSizeStr := strings.TrimSpace(c.Query("page_size"))
@@ -509,41 +630,119 @@ func ListImagesHandler(c *gin.Context) {
 	} else if pageSize > 100 {
 		pageSize = 100
 	}
-	keyword := c.Query("keyword")
 
-	var tasks []model.Task
-	query := model.DB.Model(&model.Task{})
-
-	if keyword != "" {
-		query = query.Where("prompt LIKE ?", "%"+keyword+"%")
+	listSort, err := parseImageSort(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
 	}
 
+	var tasks []model.Task
+	query := imageListQuery(c)
+
 	var total int64
 	query.Count(&total)
 
-	offset := (page - 1) * pageSize
-	if err := query.Order("status='processing' DESC, status='pending' DESC, created_at DESC").Offset(offset).Limit(pageSize).Find(&tasks).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "查询失败")
+	query = query.Order(listSort.orderClause())
+	// 传入 cursor 时按游标翻页，忽略 page；翻页期间新增的任务不会导致重复或遗漏
+	if cursorValue := c.Query("cursor"); cursorValue != "" {
+		cursor, err := listSort.decodeCursor(cursorValue)
+		if err != nil {
+			ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+			return
+		}
+		query = listSort.afterCursor(query, cursor)
+	} else {
+		query = query.Offset((page - 1) * pageSize)
+	}
+	if err := query.Limit(pageSize).Find(&tasks).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
 		return
 	}
+	attachTaskTags(model.DB.WithContext(c.Request.Context()), tasks)
+
+	nextCursor := ""
+	if len(tasks) == pageSize {
+		if nextCursor, err = listSort.encodeCursor(c.Request.Context(), tasks[len(tasks)-1].ID); err != nil {
+			log.Printf("[API] 生成分页游标失败: %v", err)
+		}
+	}
+
+	// 列表默认只返回提示词预览，fields=prompt 时附带完整提示词
+	withPrompt := listFieldRequested(c.Query("fields"), "prompt")
+	list := make([]imageListItem, len(tasks))
+	for i := range tasks {
+		list[i].Task = &tasks[i]
+		if withPrompt {
+			list[i].Prompt = &tasks[i].Prompt
+		}
+	}
 
 	Success(c, gin.H{
-		"total": total,
-		"list":  tasks,
+		"total":       total,
+		"list":        list,
+		"next_cursor": nextCursor,
 	})
 }
 
-// DeleteImageHandler 删除图片
-func DeleteImageHandler(c *gin.Context) {
-	id := c.Param("id")
-	var task model.Task
-	if err := model.DB.Where("task_id = ?", id).First(&task).Error; err != nil {
-		Error(c, http.StatusNotFound, 404, "图片不存在")
-		return
+// imageListItem 图库列表项：完整提示词可能有数 KB，未请求时不返回，前端展示使用 prompt_preview
+type imageListItem struct {
+	*model.Task
+	Prompt *string `json:"prompt,omitempty"`
+}
+
+// listFieldRequested 判断逗号分隔的 fields 参数中是否包含 field
+func listFieldRequested(fields, field string) bool {
+	for _, f := range strings.Split(fields, ",") {
+		if strings.TrimSpace(f) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// imageListQuery 按图库列表的筛选参数构建查询，列表与 CSV 导出共用
+func imageListQuery(c *gin.Context) *gorm.DB {
+	keyword := c.Query("keyword")
+	// 携带请求上下文，COUNT/查询耗时计入慢请求日志的 db_time
+	query := model.DB.WithContext(c.Request.Context()).Model(&model.Task{})
+
+	// 已归档任务的文件已被保留策略清理，默认不在图库中展示
+	if c.Query("include_archived") != "true" {
+		query = query.Where("archived_at IS NULL")
+	}
+	if keyword != "" {
+		query = query.Where("(prompt LIKE ? OR caption LIKE ?)", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	// 按来源任务筛选派生结果（如某张图的放大版本）
+	if parentTaskID := strings.TrimSpace(c.Query("parent_task_id")); parentTaskID != "" {
+		query = query.Where("parent_task_id = ?", parentTaskID)
+	}
+	// 按分组筛选 fanout=per_image 拆分出的任务
+	if groupID := strings.TrimSpace(c.Query("group_id")); groupID != "" {
+		query = query.Where("group_id = ?", groupID)
+	}
+	if taskType := strings.TrimSpace(c.Query("task_type")); taskType != "" {
+		query = query.Where("task_type = ?", taskType)
+	}
+	if favorite := c.Query("favorite"); favorite == "true" || favorite == "false" {
+		query = query.Where("favorite = ?", favorite == "true")
+	}
+	if private := c.Query("private"); private == "true" || private == "false" {
+		query = query.Where("private = ?", private == "true")
+	}
+	if tag := strings.TrimSpace(c.Query("tag")); tag != "" {
+		query = query.Where("task_id IN (?)", model.DB.Table("task_tags").
+			Select("task_tags.task_id").
+			Joins("JOIN tags ON tags.id = task_tags.tag_id").
+			Where("tags.name = ?", tag))
 	}
+	return query
+}
 
-	// 删除物理文件/OSS 文件
-	// 优先使用数据库中存储的实际路径，兼容旧数据则尝试各种格式
+// deleteTaskFiles 删除任务对应的物理文件/OSS 文件（含缩略图）
+// 优先使用数据库中存储的实际路径，兼容旧数据则尝试各种格式
+func deleteTaskFiles(task *model.Task) {
 	if task.LocalPath != "" {
 		// 使用实际存储的文件名
 		fileName := filepath.Base(task.LocalPath)
@@ -557,11 +756,35 @@ func DeleteImageHandler(c *gin.Context) {
 			storage.GlobalStorage.Delete(fileName)
 		}
 	}
+	// OSS 对象按任务记录的地址删除，失败的记入 pending_deletions 定期重试
+	deleteRemoteTaskFiles(task)
+	removeProxyCache(task.TaskID)
+	// 按 enforce_aspect=crop 裁剪过的任务另存了裁剪前的原图
+	if task.OriginalPath != "" {
+		if err := os.Remove(task.OriginalPath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("警告: 删除裁剪前原图失败 %s: %v\n", task.OriginalPath, err)
+		}
+	}
+}
+
+// DeleteImageHandler 删除图片
+func DeleteImageHandler(c *gin.Context) {
+	id := c.Param("id")
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", id).First(&task).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
 
+	deleteTaskFiles(&task)
+
+	defer InvalidateTask(task.TaskID)
 	if err := model.DB.Delete(&task).Error; err != nil {
-		Error(c, http.StatusInternalServerError, 500, "删除数据库记录失败")
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "删除数据库记录失败")
 		return
 	}
+	deleteTaskReferences([]string{task.TaskID})
+	deleteTaskTags([]string{task.TaskID})
 
 	Success(c, "删除成功")
 }
@@ -571,7 +794,7 @@ func DownloadImageHandler(c *gin.Context) {
 	id := c.Param("id")
 	var task model.Task
 	if err := model.DB.Where("task_id = ?", id).First(&task).Error; err != nil {
-		Error(c, http.StatusNotFound, 404, "图片不存在")
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
 		return
 	}
 
@@ -586,12 +809,13 @@ func DownloadImageHandler(c *gin.Context) {
 		return
 	}
 
-	// 根据实际文件扩展名设置下载文件名
-	ext := filepath.Ext(task.LocalPath)
-	if ext == "" {
-		ext = ".png" // 默认使用 .png
+	if c.Query("with_metadata") == "1" || c.Query("with_metadata") == "true" {
+		writeImageWithMetadata(c, &task)
+		return
 	}
-	fileName := fmt.Sprintf("%s%s", task.TaskID, ext)
+
+	// 根据实际文件扩展名设置下载文件名
+	fileName := downloadFileName(&task)
 	c.Header("Content-Description", "File Transfer")
 	c.Header("Content-Transfer-Encoding", "binary")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
@@ -601,135 +825,35 @@ func DownloadImageHandler(c *gin.Context) {
 
 func getOptimizeSystemPrompt(forceJSON bool) string {
 	if forceJSON {
-		prompt := strings.TrimSpace(config.GlobalConfig.Prompts.OptimizeSystemJSON)
+		prompt := strings.TrimSpace(config.Get().Prompts.OptimizeSystemJSON)
 		if prompt == "" {
 			return config.DefaultOptimizeSystemJSONPrompt
 		}
 		return prompt
 	}
-	prompt := strings.TrimSpace(config.GlobalConfig.Prompts.OptimizeSystem)
+	prompt := strings.TrimSpace(config.Get().Prompts.OptimizeSystem)
 	if prompt == "" {
 		return config.DefaultOptimizeSystemPrompt
 	}
 	return prompt
 }
 
-func callGeminiOptimize(ctx context.Context, cfg *model.ProviderConfig, modelName, prompt string, forceJSON bool) (string, error) {
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	if timeout <= 0 {
-		timeout = 150 * time.Second
-	}
-
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			DisableKeepAlives:   true,
-			ForceAttemptHTTP2:   false,
-			MaxIdleConns:        0,
-			MaxIdleConnsPerHost: 0,
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-		},
-	}
-
-	clientConfig := &genai.ClientConfig{
-		APIKey:     cfg.APIKey,
-		Backend:    genai.BackendGeminiAPI,
-		HTTPClient: httpClient,
-	}
-
-	if apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBase), "/"); apiBase != "" && apiBase != "https://generativelanguage.googleapis.com" {
-		clientConfig.HTTPOptions = genai.HTTPOptions{BaseURL: apiBase}
-	}
-
-	client, err := genai.NewClient(ctx, clientConfig)
-	if err != nil {
-		return "", fmt.Errorf("创建 Gemini 客户端失败: %w", err)
-	}
-
-	systemPrompt := getOptimizeSystemPrompt(forceJSON)
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: systemPrompt}},
-		},
-	}
-	if forceJSON {
-		config.ResponseMIMEType = "application/json"
-	}
-	contents := []*genai.Content{
-		{
-			Role:  "user",
-			Parts: []*genai.Part{{Text: prompt}},
-		},
-	}
-
-	resp, err := client.Models.GenerateContent(ctx, modelName, contents, config)
-	if err != nil {
-		return "", fmt.Errorf("请求失败: %w", err)
-	}
-
-	optimized := strings.TrimSpace(resp.Text())
-	if optimized == "" {
-		return "", fmt.Errorf("未返回优化结果")
-	}
-	return optimized, nil
-}
-
-func callOpenAIOptimize(ctx context.Context, cfg *model.ProviderConfig, modelName, prompt string, forceJSON bool) (string, error) {
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	if timeout <= 0 {
-		timeout = 150 * time.Second
-	}
-	httpClient := &http.Client{Timeout: timeout}
-	apiBase := provider.NormalizeOpenAIBaseURL(cfg.APIBase)
-	opts := []option.RequestOption{
-		option.WithAPIKey(cfg.APIKey),
-		option.WithHTTPClient(httpClient),
-	}
-	if apiBase != "" {
-		opts = append(opts, option.WithBaseURL(apiBase))
-	}
-	client := openai.NewClient(opts...)
-
-	systemPrompt := getOptimizeSystemPrompt(forceJSON)
-	payload := map[string]interface{}{
-		"model": modelName,
-		"messages": []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(systemPrompt),
-			openai.UserMessage(prompt),
-		},
-	}
-	if forceJSON {
-		payload["response_format"] = map[string]interface{}{"type": "json_object"}
-	}
-
-	var respBytes []byte
-	if err := client.Post(ctx, "/chat/completions", payload, &respBytes); err != nil {
-		return "", fmt.Errorf("请求失败: %s", formatOpenAIClientError(err))
-	}
-
-	optimized, err := extractChatMessage(respBytes)
-	if err != nil {
-		return "", err
-	}
-	optimized = strings.TrimSpace(optimized)
-	if optimized == "" {
-		return "", fmt.Errorf("未返回优化结果")
-	}
-	return optimized, nil
-}
-
-func buildModelsJSON(_ string, modelID, _ string) string {
+func buildModelsJSON(providerName, modelID, _ string) string {
 	modelID = strings.TrimSpace(modelID)
 	if modelID == "" {
 		return ""
 	}
-	payload := []map[string]interface{}{
+	// 能从模型名识别用途时按识别结果标注，否则视为与 Provider 用途一致
+	capabilities := provider.DetectModelCapabilities(modelID)
+	if len(capabilities) == 0 {
+		capabilities = []provider.ModelPurpose{provider.PurposeForProvider(providerName)}
+	}
+	payload := []provider.ModelEntry{
 		{
-			"id":      modelID,
-			"name":    modelID,
-			"default": true,
+			ID:           modelID,
+			Name:         modelID,
+			Default:      true,
+			Capabilities: capabilities,
 		},
 	}
 	data, err := json.Marshal(payload)
@@ -753,52 +877,6 @@ func formatOpenAIClientError(err error) string {
 	return err.Error()
 }
 
-func extractChatMessage(resp []byte) (string, error) {
-	var payload map[string]interface{}
-	if err := json.Unmarshal(resp, &payload); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
-	}
-	choices, ok := payload["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("响应中未找到 choices")
-	}
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("响应格式错误")
-	}
-	msg, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("响应中未找到 message")
-	}
-	return extractTextFromContent(msg["content"]), nil
-}
-
-func extractTextFromContent(content interface{}) string {
-	switch value := content.(type) {
-	case string:
-		return value
-	case []interface{}:
-		var parts []string
-		for _, item := range value {
-			part, ok := item.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			if t, _ := part["type"].(string); t == "text" {
-				if text, _ := part["text"].(string); text != "" {
-					parts = append(parts, text)
-				}
-			}
-		}
-		return strings.Join(parts, "\n")
-	case map[string]interface{}:
-		if text, _ := value["text"].(string); text != "" {
-			return text
-		}
-	}
-	return ""
-}
-
 // ImageToPromptRequest 图片逆向提示词请求
 type ImageToPromptRequest struct {
 	Provider string `form:"provider"`
@@ -808,6 +886,9 @@ type ImageToPromptRequest struct {
 // 图片上传大小限制常量
 const maxImageUploadSize = 20 * 1024 * 1024 // 20MB
 
+// imageToPromptInstruction 逆向提示词时随图片发送的用户指令
+const imageToPromptInstruction = "请分析这张图片并生成提示词描述。"
+
 // ImageToPromptHandler 图片逆向提示词处理函数
 // 用户上传图片，后端分析图片内容并生成提示词
 func ImageToPromptHandler(c *gin.Context) {
@@ -817,41 +898,13 @@ func ImageToPromptHandler(c *gin.Context) {
 	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUploadSize)
 
 	// 1. 解析请求参数
-	providerName := strings.TrimSpace(strings.ToLower(c.PostForm("provider")))
-	if providerName == "" {
-		providerName = "gemini-chat"
-	}
-	if providerName == "openai" {
-		providerName = "openai-chat"
-	}
-	if providerName == "gemini" {
-		providerName = "gemini-chat"
-	}
-
-	// 2. 获取 Provider 配置
-	var cfg model.ProviderConfig
-	if err := model.DB.Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
-		Error(c, http.StatusBadRequest, 400, "未找到指定的 Provider: "+providerName)
-		return
-	}
-	if strings.TrimSpace(cfg.APIKey) == "" {
-		Error(c, http.StatusBadRequest, 400, "Provider API Key 未配置")
-		return
-	}
-
-	// 3. 解析模型名称
-	modelName := provider.ResolveModelID(provider.ModelResolveOptions{
-		ProviderName: providerName,
-		Purpose:      provider.PurposeChat,
-		RequestModel: c.PostForm("model"),
-		Config:       &cfg,
-	}).ID
-	if modelName == "" {
-		Error(c, http.StatusBadRequest, 400, "未找到可用的模型")
+	target, err := resolveChatTarget(c.PostForm("provider"), c.PostForm("model"), "gemini-chat")
+	if err != nil {
+		chatTargetFailed(c, err)
 		return
 	}
 
-	// 4. 获取图片数据（支持 multipart 文件上传或本地路径）
+	// 2. 获取图片数据（支持 multipart 文件上传或本地路径）
 	var imageData []byte
 
 	// 方式1: 从 multipart 文件上传获取
@@ -907,14 +960,15 @@ func ImageToPromptHandler(c *gin.Context) {
 		Error(c, http.StatusBadRequest, 400, "请提供图片（通过 image 文件上传或 image_path 参数）")
 		return
 	}
+	imageData = provider.StripImageMetadata(imageData)
 
-	// 5. 获取系统提示词
-	systemPrompt := strings.TrimSpace(config.GlobalConfig.Prompts.ImageToPromptSystem)
+	// 3. 获取系统提示词
+	systemPrompt := strings.TrimSpace(config.Get().Prompts.ImageToPromptSystem)
 	if systemPrompt == "" {
 		systemPrompt = config.DefaultImageToPromptSystem
 	}
 
-	// 6. 获取用户语言偏好，动态替换语言指令占位符
+	// 4. 获取用户语言偏好，动态替换语言指令占位符
 	language := c.PostForm("language")
 	log.Printf("[API] 图片逆向提示词语言参数: %s\n", language)
 	outputLangInstruction := getImageToPromptLanguageInstruction(language)
@@ -922,115 +976,23 @@ func ImageToPromptHandler(c *gin.Context) {
 	// 替换占位符 {{LANGUAGE_INSTRUCTION}} 为实际的语言要求
 	systemPrompt = strings.Replace(systemPrompt, "{{LANGUAGE_INSTRUCTION}}", outputLangInstruction, 1)
 
-	// 7. 调用 AI 模型分析图片
-	var result string
-	if providerName == "gemini-chat" {
-		result, err = callGeminiImageToPrompt(c.Request.Context(), &cfg, modelName, imageData, systemPrompt)
-	} else {
-		result, err = callOpenAIImageToPrompt(c.Request.Context(), &cfg, modelName, imageData, systemPrompt)
+	// 5. 调用 AI 模型分析图片
+	log.Printf("[ImageToPrompt] provider=%s model=%s, 图片大小: %d bytes", target.providerName, target.modelName, len(imageData))
+	result, err := target.chat.Complete(c.Request.Context(), []provider.ChatMessage{
+		{Role: "user", Text: imageToPromptInstruction, Images: [][]byte{imageData}},
+	}, provider.ChatOptions{Model: target.modelName, System: systemPrompt})
+	if err == nil && result == "" {
+		err = fmt.Errorf("未返回分析结果")
 	}
-
 	if err != nil {
-		Error(c, http.StatusBadRequest, 400, "分析图片失败: "+err.Error())
+		chatRequestFailed(c, target, "分析图片失败: ", err)
 		return
 	}
 
-	log.Printf("[API] 图片逆向提示词成功, 结果长度: %d\n", len(result))
+	log.Printf("[API] 图片逆向提示词成功, 结果长度: %d, 前100字符: %s\n", len(result), truncateString(result, 100))
 	Success(c, gin.H{"prompt": result})
 }
 
-// callGeminiImageToPrompt 使用 Gemini 分析图片生成提示词
-func callGeminiImageToPrompt(ctx context.Context, cfg *model.ProviderConfig, modelName string, imageData []byte, systemPrompt string) (string, error) {
-	log.Printf("[ImageToPrompt] 开始调用 Gemini API, 模型: %s, API Base: %s", modelName, cfg.APIBase)
-
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	if timeout <= 0 {
-		timeout = 150 * time.Second
-	}
-	log.Printf("[ImageToPrompt] 超时设置: %v", timeout)
-
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			DisableKeepAlives:   true,
-			ForceAttemptHTTP2:   false,
-			MaxIdleConns:        0,
-			MaxIdleConnsPerHost: 0,
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-		},
-	}
-
-	clientConfig := &genai.ClientConfig{
-		APIKey:     cfg.APIKey,
-		Backend:    genai.BackendGeminiAPI,
-		HTTPClient: httpClient,
-	}
-
-	if apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBase), "/"); apiBase != "" && apiBase != "https://generativelanguage.googleapis.com" {
-		clientConfig.HTTPOptions = genai.HTTPOptions{BaseURL: apiBase}
-		log.Printf("[ImageToPrompt] 使用自定义 API Base: %s", apiBase)
-	}
-
-	log.Printf("[ImageToPrompt] 正在创建 Gemini 客户端...")
-	client, err := genai.NewClient(ctx, clientConfig)
-	if err != nil {
-		log.Printf("[ImageToPrompt] 创建 Gemini 客户端失败: %v", err)
-		return "", fmt.Errorf("创建 Gemini 客户端失败: %w", err)
-	}
-	log.Printf("[ImageToPrompt] Gemini 客户端创建成功")
-
-	// 自动检测 MIME Type
-	mimeType := http.DetectContentType(imageData)
-	if !strings.HasPrefix(mimeType, "image/") {
-		mimeType = "image/jpeg"
-	}
-	log.Printf("[ImageToPrompt] 图片 MIME Type: %s, 数据大小: %d bytes", mimeType, len(imageData))
-
-	// 构建请求：图片 + 系统提示词
-	contents := []*genai.Content{
-		{
-			Role: "user",
-			Parts: []*genai.Part{
-				{
-					InlineData: &genai.Blob{
-						MIMEType: mimeType,
-						Data:     imageData,
-					},
-				},
-				{Text: "请分析这张图片并生成提示词描述。"},
-			},
-		},
-	}
-
-	genConfig := &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{{Text: systemPrompt}},
-		},
-	}
-
-	log.Printf("[ImageToPrompt] 正在调用 Gemini API GenerateContent...")
-	startTime := time.Now()
-	resp, err := client.Models.GenerateContent(ctx, modelName, contents, genConfig)
-	elapsed := time.Since(startTime)
-	log.Printf("[ImageToPrompt] Gemini API 调用完成, 耗时: %v", elapsed)
-
-	if err != nil {
-		log.Printf("[ImageToPrompt] Gemini API 请求失败: %v", err)
-		return "", fmt.Errorf("请求失败: %w", err)
-	}
-
-	result := strings.TrimSpace(resp.Text())
-	log.Printf("[ImageToPrompt] Gemini API 返回结果长度: %d", len(result))
-	if result == "" {
-		log.Printf("[ImageToPrompt] Gemini API 返回空结果")
-		return "", fmt.Errorf("未返回分析结果")
-	}
-	log.Printf("[ImageToPrompt] 成功获取提示词, 前100字符: %s", truncateString(result, 100))
-	return result, nil
-}
-
 // truncateString 截断字符串用于日志显示
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -1129,76 +1091,3 @@ func getImageToPromptLanguageInstruction(language string) string {
 	// 默认返回英文要求
 	return "用英文输出提示词"
 }
-
-// callOpenAIImageToPrompt 使用 OpenAI Vision 分析图片生成提示词
-func callOpenAIImageToPrompt(ctx context.Context, cfg *model.ProviderConfig, modelName string, imageData []byte, systemPrompt string) (string, error) {
-	log.Printf("[ImageToPrompt] 开始调用 OpenAI Vision API, 模型: %s, API Base: %s", modelName, cfg.APIBase)
-
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	if timeout <= 0 {
-		timeout = 150 * time.Second
-	}
-	log.Printf("[ImageToPrompt] 超时设置: %v", timeout)
-
-	httpClient := &http.Client{Timeout: timeout}
-	apiBase := provider.NormalizeOpenAIBaseURL(cfg.APIBase)
-	opts := []option.RequestOption{
-		option.WithAPIKey(cfg.APIKey),
-		option.WithHTTPClient(httpClient),
-	}
-	if apiBase != "" {
-		opts = append(opts, option.WithBaseURL(apiBase))
-		log.Printf("[ImageToPrompt] 使用自定义 API Base: %s", apiBase)
-	}
-	client := openai.NewClient(opts...)
-
-	// 构建 base64 图片数据
-	mimeType := http.DetectContentType(imageData)
-	if !strings.HasPrefix(mimeType, "image/") {
-		mimeType = "image/jpeg"
-	}
-	log.Printf("[ImageToPrompt] 图片 MIME Type: %s, 数据大小: %d bytes", mimeType, len(imageData))
-
-	base64Image := base64.StdEncoding.EncodeToString(imageData)
-	dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Image)
-
-	// 构建请求
-	payload := map[string]interface{}{
-		"model": modelName,
-		"messages": []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(systemPrompt),
-			openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
-				openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
-					URL: dataURL,
-				}),
-				openai.TextContentPart("请分析这张图片并生成提示词描述。"),
-			}),
-		},
-	}
-
-	log.Printf("[ImageToPrompt] 正在调用 OpenAI API /chat/completions...")
-	startTime := time.Now()
-	var respBytes []byte
-	if err := client.Post(ctx, "/chat/completions", payload, &respBytes); err != nil {
-		elapsed := time.Since(startTime)
-		log.Printf("[ImageToPrompt] OpenAI API 请求失败, 耗时: %v, 错误: %v", elapsed, err)
-		return "", fmt.Errorf("请求失败: %s", formatOpenAIClientError(err))
-	}
-	elapsed := time.Since(startTime)
-	log.Printf("[ImageToPrompt] OpenAI API 调用完成, 耗时: %v, 响应长度: %d", elapsed, len(respBytes))
-
-	result, err := extractChatMessage(respBytes)
-	if err != nil {
-		log.Printf("[ImageToPrompt] 解析响应失败: %v, 原始响应: %s", err, truncateString(string(respBytes), 500))
-		return "", err
-	}
-
-	result = strings.TrimSpace(result)
-	log.Printf("[ImageToPrompt] OpenAI API 返回结果长度: %d", len(result))
-	if result == "" {
-		log.Printf("[ImageToPrompt] OpenAI API 返回空结果")
-		return "", fmt.Errorf("未返回分析结果")
-	}
-	log.Printf("[ImageToPrompt] 成功获取提示词, 前100字符: %s", truncateString(result, 100))
-	return result, nil
-}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler 返回服务状态。维护模式或启动降级（数据库不可用）时返回 503，使负载均衡不再转发新请求，响应体仍包含完整状态；
+// 存储目录不可写或空间不足时状态为 storage_unavailable，读取接口仍可用
+func HealthHandler(c *gin.Context) {
+	if !startupReady.Load() {
+		status := currentStartup()
+		c.JSON(http.StatusServiceUnavailable, Response{
+			Code:      503,
+			Message:   "服务启动未完成: " + status.Hint,
+			Data:      gin.H{"status": status.Status, "message": status.Error, "startup": status},
+			ErrorCode: model.ErrCodeStartupDegraded,
+		})
+		return
+	}
+	state := currentMaintenance()
+	storageHealth := storage.CheckHealth()
+	data := gin.H{
+		"status":          "ok",
+		"message":         "ok",
+		"maintenance":     state,
+		"task_cache":      GetTaskCacheStats(),
+		"storage_cleanup": storage.GetCleanupStats(),
+		"storage":         storageHealth,
+		"providers":       providerHealthSnapshot(),
+		"provider_init":   provider.ProviderInitStatuses(),
+	}
+	if !storageHealth.Available {
+		data["status"] = "storage_unavailable"
+		data["message"] = storageHealth.Reason
+	}
+	if state.Enabled {
+		data["status"] = "maintenance"
+		data["message"] = state.Message
+		c.JSON(http.StatusServiceUnavailable, Response{Code: 503, Message: state.Message, Data: data, ErrorCode: model.ErrCodeMaintenance})
+		return
+	}
+	Success(c, data)
+}
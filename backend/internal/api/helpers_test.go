@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// performJSON 以 JSON 请求体调用 handler，返回录制的响应
+func performJSON(t *testing.T, method, route, path string, body interface{}, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	r := gin.New()
+	r.Handle(method, route, handler)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse 解析统一响应，失败时测试终止
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("响应不是 JSON (%d): %s", rec.Code, rec.Body.String())
+	}
+	return resp
+}
+
+// expectError 断言响应的 HTTP 状态与错误码
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, errorCode string) Response {
+	t.Helper()
+	resp := decodeResponse(t, rec)
+	if rec.Code != status || resp.ErrorCode != errorCode {
+		t.Fatalf("期望 %d %s，实际 %d %s: %s", status, errorCode, rec.Code, resp.ErrorCode, resp.Message)
+	}
+	return resp
+}
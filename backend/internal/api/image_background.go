@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// removeBackgroundPrompt 使用 Gemini 图像编辑能力抠图时的提示词
+const removeBackgroundPrompt = "Remove the background from this image completely. Keep the main subject exactly as it is, and output a PNG with a fully transparent background (alpha channel)."
+
+// backgroundRemovalProviders 按优先级排列的专用抠图服务
+var backgroundRemovalProviders = []string{"removebg", "rembg"}
+
+type removeBackgroundRequest struct {
+	Provider string `json:"provider"`
+}
+
+// RemoveBackgroundHandler 以关联子任务的形式为已存储的图片去除背景，优先使用 remove.bg / rembg 服务，未配置时回退到 Gemini 图像编辑
+func RemoveBackgroundHandler(c *gin.Context) {
+	id := c.Param("id")
+	var parent model.Task
+	if err := model.DB.Where("task_id = ?", id).First(&parent).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+
+	var req removeBackgroundRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+
+	localPath := strings.TrimSpace(parent.LocalPath)
+	if localPath == "" {
+		Error(c, http.StatusBadRequest, 400, "该任务没有本地原图文件")
+		return
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		Error(c, http.StatusBadRequest, 400, "本地原图文件不存在: "+localPath)
+		return
+	}
+
+	providerName := strings.TrimSpace(req.Provider)
+	if providerName == "" {
+		for _, name := range backgroundRemovalProviders {
+			if provider.GetProvider(name) != nil {
+				providerName = name
+				break
+			}
+		}
+	}
+	if providerName == "" && provider.GetProvider("gemini") != nil {
+		providerName = "gemini"
+	}
+	p := provider.GetProvider(providerName)
+	if p == nil {
+		if providerName != "" {
+			ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderNotFound, provider.UnavailableError(providerName).Error())
+			return
+		}
+		Error(c, http.StatusBadRequest, 400, "未配置可用的抠图服务 (removebg / rembg / gemini)")
+		return
+	}
+
+	taskParams := map[string]interface{}{
+		"operation":   "remove_background",
+		"source_path": localPath,
+	}
+	if _, dedicated := p.(*provider.BackgroundRemovalProvider); !dedicated {
+		content, err := os.ReadFile(localPath)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 400, "读取本地原图失败")
+			return
+		}
+		taskParams["prompt"] = removeBackgroundPrompt
+		taskParams["reference_images"] = []interface{}{content}
+	}
+	if err := p.ValidateParams(taskParams); err != nil {
+		ValidationFailed(c, err)
+		return
+	}
+
+	snapshot, _ := json.Marshal(map[string]interface{}{
+		"provider":       providerName,
+		"source_task_id": parent.TaskID,
+	})
+	taskModel := &model.Task{
+		TaskID:         uuid.New().String(),
+		Prompt:         parent.Prompt,
+		ProviderName:   providerName,
+		TotalCount:     1,
+		Status:         "pending",
+		ConfigSnapshot: string(snapshot),
+		TaskType:       "remove_background",
+		ParentTaskID:   parent.TaskID,
+		RootTaskID:     lineageRoot(&parent),
+		Private:        parent.Private,
+	}
+	if !submitTask(c, &worker.Task{TaskModel: taskModel, Params: taskParams}) {
+		return
+	}
+
+	Success(c, taskModel)
+}
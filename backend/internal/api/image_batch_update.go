@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxBatchUpdateIDs    = 1000
+	batchUpdateChunkSize = 200
+)
+
+type batchUpdateRequest struct {
+	TaskIDs     []string `json:"task_ids"`
+	AddTags     []string `json:"add_tags"`
+	RemoveTags  []string `json:"remove_tags"`
+	SetFavorite *bool    `json:"set_favorite"`
+	MoveToAlbum string   `json:"move_to_album"`
+}
+
+// batchUpdateResult 单个任务的处理结果，Status: updated / not_found / failed
+type batchUpdateResult struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchUpdateImagesHandler 对一组图片执行标签与收藏操作，每张图片单独事务、单独报告结果；add_tags 中不存在的标签自动创建
+func BatchUpdateImagesHandler(c *gin.Context) {
+	var req batchUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	taskIDs := make([]string, 0, len(req.TaskIDs))
+	seen := make(map[string]bool, len(req.TaskIDs))
+	for _, id := range req.TaskIDs {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	if len(taskIDs) == 0 {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "task_ids 不能为空")
+		return
+	}
+	if len(taskIDs) > maxBatchUpdateIDs {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("单次最多更新 %d 张图片", maxBatchUpdateIDs))
+		return
+	}
+	// 相册需预先创建，当前版本尚无相册，引用任何相册都视为不存在
+	if album := strings.TrimSpace(req.MoveToAlbum); album != "" {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "相册不存在: "+album)
+		return
+	}
+	addTags, err := normalizeTagNames(req.AddTags)
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+	removeTags, err := normalizeTagNames(req.RemoveTags)
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+	if len(addTags) == 0 && len(removeTags) == 0 && req.SetFavorite == nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "请至少指定一种操作: add_tags / remove_tags / set_favorite")
+		return
+	}
+
+	removeIDs, err := lookupTags(removeTags)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询标签失败")
+		return
+	}
+	for _, name := range removeTags {
+		if _, ok := removeIDs[name]; !ok {
+			ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "标签不存在: "+name)
+			return
+		}
+	}
+	tagIDs, err := ensureTags(addTags)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建标签失败")
+		return
+	}
+	// 按请求顺序关联标签，详情中的标签顺序与添加顺序一致
+	addIDs := make([]uint, 0, len(addTags))
+	for _, name := range addTags {
+		addIDs = append(addIDs, tagIDs[name])
+	}
+
+	results := make([]batchUpdateResult, 0, len(taskIDs))
+	updatedIDs := make([]string, 0, len(taskIDs))
+	var failed, missing int
+	for start := 0; start < len(taskIDs); start += batchUpdateChunkSize {
+		chunk := taskIDs[start:min(start+batchUpdateChunkSize, len(taskIDs))]
+		var existing []string
+		if err := model.DB.Model(&model.Task{}).Where("task_id IN ?", chunk).Pluck("task_id", &existing).Error; err != nil {
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务失败")
+			return
+		}
+		found := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			found[id] = true
+		}
+
+		for _, taskID := range chunk {
+			if !found[taskID] {
+				missing++
+				results = append(results, batchUpdateResult{TaskID: taskID, Status: "not_found", Error: "图片不存在"})
+				continue
+			}
+			if err := applyBatchUpdate(taskID, addIDs, removeIDs, req.SetFavorite); err != nil {
+				failed++
+				log.Printf("[API] 批量更新图片 %s 失败: %v", taskID, err)
+				results = append(results, batchUpdateResult{TaskID: taskID, Status: "failed", Error: err.Error()})
+				continue
+			}
+			InvalidateTask(taskID)
+			updatedIDs = append(updatedIDs, taskID)
+			results = append(results, batchUpdateResult{TaskID: taskID, Status: "updated"})
+		}
+	}
+
+	if len(updatedIDs) > 0 {
+		publishGalleryEvent(galleryEvent{Type: "images_updated", TaskIDs: updatedIDs})
+	}
+	recordAudit(c, "batch_update", gin.H{
+		"task_count":   len(taskIDs),
+		"add_tags":     addTags,
+		"remove_tags":  removeTags,
+		"set_favorite": req.SetFavorite,
+		"updated":      len(updatedIDs),
+		"not_found":    missing,
+		"failed":       failed,
+	})
+	Success(c, gin.H{
+		"updated":   len(updatedIDs),
+		"not_found": missing,
+		"failed":    failed,
+		"results":   results,
+	})
+}
+
+// applyBatchUpdate 在单个事务中更新一张图片的收藏状态与标签
+func applyBatchUpdate(taskID string, addIDs []uint, removeIDs map[string]uint, favorite *bool) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if favorite != nil {
+			if err := tx.Model(&model.Task{}).Where("task_id = ?", taskID).Update("favorite", *favorite).Error; err != nil {
+				return err
+			}
+		}
+		if len(removeIDs) > 0 {
+			ids := make([]uint, 0, len(removeIDs))
+			for _, id := range removeIDs {
+				ids = append(ids, id)
+			}
+			if err := tx.Where("task_id = ? AND tag_id IN ?", taskID, ids).Delete(&model.TaskTag{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(addIDs) > 0 {
+			rows := make([]model.TaskTag, 0, len(addIDs))
+			for _, id := range addIDs {
+				rows = append(rows, model.TaskTag{TaskID: taskID, TagID: id})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// captionInstruction 生成描述时随图片发送的用户指令
+	captionInstruction = "请为这张图片撰写替代文本。"
+	maxCaptionLength   = 1000
+	maxBulkCaption     = 500
+)
+
+// captionInFlight 记录正在排队或生成描述的任务，避免批量请求重复入队
+var captionInFlight sync.Map
+
+type captionRequest struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Language string `json:"language"`
+}
+
+type bulkCaptionRequest struct {
+	captionRequest
+	Limit int `json:"limit"`
+}
+
+type updateCaptionRequest struct {
+	Caption *string `json:"caption"`
+}
+
+// captionTarget 解析后的视觉模型配置
+type captionTarget struct {
+	*chatTarget
+	systemPrompt string
+}
+
+// CaptionImageHandler 调用支持视觉的对话模型为已存储的图片生成替代文本，保存到任务并返回
+func CaptionImageHandler(c *gin.Context) {
+	id := c.Param("id")
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", id).First(&task).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+
+	var req captionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	target, err := resolveCaptionTarget(req)
+	if err != nil {
+		chatTargetFailed(c, err)
+		return
+	}
+
+	caption, err := generateCaption(c.Request.Context(), target, &task)
+	if err != nil {
+		chatRequestFailed(c, target.chatTarget, "生成描述失败: ", err)
+		return
+	}
+	Success(c, gin.H{"task_id": task.TaskID, "caption": caption})
+}
+
+// UpdateCaptionHandler 用用户编辑的文本替换图片说明
+func UpdateCaptionHandler(c *gin.Context) {
+	id := c.Param("id")
+	var req updateCaptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if req.Caption == nil {
+		Error(c, http.StatusBadRequest, 400, "caption 不能为空")
+		return
+	}
+	caption := strings.TrimSpace(*req.Caption)
+	if len([]rune(caption)) > maxCaptionLength {
+		Error(c, http.StatusBadRequest, 400, fmt.Sprintf("描述不能超过 %d 个字符", maxCaptionLength))
+		return
+	}
+
+	result := model.DB.Model(&model.Task{}).Where("task_id = ?", id).Update("caption", caption)
+	InvalidateTask(id)
+	if result.Error != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "更新描述失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+	Success(c, gin.H{"task_id": id, "caption": caption})
+}
+
+// BulkCaptionHandler 为尚无说明的已完成图片排队生成说明，走低优先级队列，不拖慢图片生成
+func BulkCaptionHandler(c *gin.Context) {
+	var req bulkCaptionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	if req.Limit <= 0 || req.Limit > maxBulkCaption {
+		req.Limit = maxBulkCaption
+	}
+	target, err := resolveCaptionTarget(req.captionRequest)
+	if err != nil {
+		chatTargetFailed(c, err)
+		return
+	}
+
+	var tasks []model.Task
+	if err := model.DB.Where("status IN ? AND (caption IS NULL OR caption = '')", finishedTaskStatuses).
+		Order("created_at DESC").Limit(req.Limit).Find(&tasks).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务失败")
+		return
+	}
+
+	queued, skipped := 0, 0
+	for i := range tasks {
+		task := tasks[i]
+		if _, loaded := captionInFlight.LoadOrStore(task.TaskID, struct{}{}); loaded {
+			skipped++
+			continue
+		}
+		job := &worker.Task{
+			TaskModel: &task,
+			Handler: func(ctx context.Context) error {
+				defer captionInFlight.Delete(task.TaskID)
+				if _, err := generateCaption(ctx, target, &task); err != nil {
+					return fmt.Errorf("任务 %s 生成描述失败: %w", task.TaskID, err)
+				}
+				return nil
+			},
+		}
+		if !worker.Pool.SubmitLow(job) {
+			captionInFlight.Delete(task.TaskID)
+			break
+		}
+		queued++
+	}
+
+	log.Printf("[API] 批量生成描述: 待处理 %d, 已入队 %d, 跳过 %d", len(tasks), queued, skipped)
+	Success(c, gin.H{
+		"pending": len(tasks),
+		"queued":  queued,
+		"skipped": skipped,
+	})
+}
+
+// resolveCaptionTarget 解析用于生成描述的视觉模型，规则与图片逆向提示词一致
+func resolveCaptionTarget(req captionRequest) (*captionTarget, error) {
+	target, err := resolveChatTarget(req.Provider, req.Model, "gemini-chat")
+	if err != nil {
+		return nil, err
+	}
+
+	systemPrompt := strings.TrimSpace(config.Get().Prompts.CaptionSystem)
+	if systemPrompt == "" {
+		systemPrompt = config.DefaultCaptionSystem
+	}
+	language := strings.TrimSpace(req.Language)
+	if language == "" {
+		language = "en"
+	}
+	systemPrompt = strings.Replace(systemPrompt, "{{LANGUAGE}}", language, 1)
+
+	return &captionTarget{chatTarget: target, systemPrompt: systemPrompt}, nil
+}
+
+// generateCaption 调用视觉模型生成描述并写回任务
+func generateCaption(ctx context.Context, target *captionTarget, task *model.Task) (string, error) {
+	imageData, err := readCaptionImage(ctx, task)
+	if err != nil {
+		return "", err
+	}
+
+	startedAt := time.Now()
+	caption, err := target.chat.Complete(ctx, []provider.ChatMessage{
+		{Role: "user", Text: captionInstruction, Images: [][]byte{imageData}},
+	}, provider.ChatOptions{Model: target.modelName, System: target.systemPrompt})
+	if err != nil {
+		return "", err
+	}
+	if caption == "" {
+		return "", fmt.Errorf("未返回分析结果")
+	}
+	caption = strings.Trim(strings.TrimSpace(caption), "\"“”")
+	if runes := []rune(caption); len(runes) > maxCaptionLength {
+		caption = string(runes[:maxCaptionLength])
+	}
+
+	if err := model.DB.Model(&model.Task{}).Where("task_id = ?", task.TaskID).Update("caption", caption).Error; err != nil {
+		return "", fmt.Errorf("保存描述失败: %w", err)
+	}
+	InvalidateTask(task.TaskID)
+	task.Caption = caption
+	log.Printf("[Caption] 任务 %s 描述已生成, provider=%s model=%s elapsed=%s", task.TaskID, target.providerName, target.modelName, time.Since(startedAt))
+	return caption, nil
+}
+
+// readCaptionImage 读取用于生成描述的图片：优先本地原图，过大时使用缩略图，最后回退到远程地址
+func readCaptionImage(ctx context.Context, task *model.Task) ([]byte, error) {
+	for _, path := range []string{task.LocalPath, task.ThumbnailPath} {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > maxImageUploadSize {
+			continue
+		}
+		return os.ReadFile(path)
+	}
+
+	for _, remoteURL := range []string{string(task.ImageURL), string(task.ThumbnailURL)} {
+		remoteURL = strings.TrimSpace(remoteURL)
+		if remoteURL == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := writeRemoteFileContext(ctx, &buf, remoteURL); err == nil && buf.Len() <= maxImageUploadSize {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("没有可用的图片文件")
+}
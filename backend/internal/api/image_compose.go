@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// maxComposePixels 合成图的像素上限，避免误操作渲染出超大图片
+	maxComposePixels   = 64 * 1000 * 1000
+	maxComposeColumns  = 20
+	maxComposeCellSize = 2048
+	maxComposeGap      = 256
+	// maxComposeImages 单次合成的图片数上限，所有图片解码后才能绘制，数量决定内存占用
+	maxComposeImages   = 100
+	composeCaptionSize = 20
+)
+
+type composeImagesRequest struct {
+	TaskIDs    []string `json:"task_ids"`
+	Columns    int      `json:"columns"`
+	CellWidth  int      `json:"cell_width"`
+	CellHeight int      `json:"cell_height"`
+	Gap        int      `json:"gap"`
+	Background string   `json:"background"`
+	Caption    bool     `json:"caption"`
+	Format     string   `json:"format"`
+	Save       bool     `json:"save"`
+}
+
+// ComposeImagesHandler 将选中的图片拼成一张网格拼图，直接返回结果；save=true 时另存为 compose 任务
+func ComposeImagesHandler(c *gin.Context) {
+	var req composeImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if len(req.TaskIDs) == 0 {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "task_ids 不能为空")
+		return
+	}
+	if len(req.TaskIDs) > maxComposeImages {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("task_ids 最多 %d 个", maxComposeImages))
+		return
+	}
+	if req.Columns <= 0 {
+		req.Columns = 4
+	}
+	if req.Columns > maxComposeColumns {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("columns 不能超过 %d", maxComposeColumns))
+		return
+	}
+	if req.CellWidth <= 0 {
+		req.CellWidth = 512
+	}
+	if req.CellHeight <= 0 {
+		req.CellHeight = req.CellWidth
+	}
+	if req.CellWidth > maxComposeCellSize || req.CellHeight > maxComposeCellSize {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("单元格尺寸不能超过 %d", maxComposeCellSize))
+		return
+	}
+	if req.Gap < 0 {
+		req.Gap = 0
+	}
+	if req.Gap > maxComposeGap {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("gap 不能超过 %d", maxComposeGap))
+		return
+	}
+	bg, err := parseHexColor(req.Background)
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+	format := imaging.JPEG
+	switch strings.ToLower(strings.TrimSpace(req.Format)) {
+	case "", "jpg", "jpeg":
+	case "png":
+		format = imaging.PNG
+	default:
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "不支持的输出格式: "+req.Format+"，可选值: jpeg, png")
+		return
+	}
+
+	// 按请求的图片数在解码前校验画布尺寸，部分图片缺失时实际画布只会更小
+	if width, height := composeGridSize(len(req.TaskIDs), req); width*height > maxComposePixels {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("合成图尺寸 %dx%d 超过上限 (%d 像素)，请减小单元格尺寸或图片数量", width, height, maxComposePixels))
+		return
+	}
+
+	var tasks []model.Task
+	if err := model.DB.Where("task_id IN ?", req.TaskIDs).Find(&tasks).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务失败")
+		return
+	}
+	taskMap := make(map[string]*model.Task, len(tasks))
+	for i := range tasks {
+		taskMap[tasks[i].TaskID] = &tasks[i]
+	}
+
+	type cell struct {
+		task *model.Task
+		img  image.Image
+	}
+	var cells []cell
+	var omitted []string
+	for _, id := range req.TaskIDs {
+		task, ok := taskMap[id]
+		if !ok {
+			omitted = append(omitted, fmt.Sprintf("%s: not found", id))
+			continue
+		}
+		img, _, err := openTaskImage(task)
+		if err != nil {
+			omitted = append(omitted, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		cells = append(cells, cell{task: task, img: imaging.Fit(img, req.CellWidth, req.CellHeight, imaging.Lanczos)})
+	}
+	if len(cells) == 0 {
+		Error(c, http.StatusNotFound, 404, "没有可合成的图片")
+		return
+	}
+
+	columns := min(req.Columns, len(cells))
+	rowHeight := req.CellHeight
+	if req.Caption {
+		rowHeight += composeCaptionSize
+	}
+	width, height := composeGridSize(len(cells), req)
+
+	canvas := imaging.New(width, height, bg)
+	for i, item := range cells {
+		col, row := i%columns, i/columns
+		x := req.Gap + col*(req.CellWidth+req.Gap)
+		y := req.Gap + row*(rowHeight+req.Gap)
+		// 按比例缩放后在单元格内居中（letterbox）
+		b := item.img.Bounds()
+		offset := image.Pt(x+(req.CellWidth-b.Dx())/2, y+(req.CellHeight-b.Dy())/2)
+		canvas = imaging.Paste(canvas, item.img, offset)
+		if req.Caption {
+			drawCaption(canvas, item.task.Prompt, x, y+req.CellHeight, req.CellWidth, bg)
+		}
+	}
+
+	buf, err := encodeImage(canvas, format)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 500, "编码图片失败: "+err.Error())
+		return
+	}
+
+	if req.Save {
+		taskID := uuid.New().String()
+		fileSize := int64(buf.Len())
+		saved, err := storage.SaveImage(taskID, buf)
+		if err != nil {
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存图片失败: "+err.Error())
+			return
+		}
+		snapshot, _ := json.Marshal(map[string]interface{}{
+			"provider":   "compose",
+			"task_ids":   req.TaskIDs,
+			"columns":    columns,
+			"cell_width": req.CellWidth,
+			"gap":        req.Gap,
+		})
+		// 任一来源图片为私密时，合成图同样设为私密
+		private := false
+		for _, item := range cells {
+			private = private || item.task.Private
+		}
+		now := time.Now()
+		composed := &model.Task{
+			TaskID:         taskID,
+			Prompt:         fmt.Sprintf("Contact sheet (%d images)", len(cells)),
+			ProviderName:   "compose",
+			Status:         "completed",
+			ImageURL:       model.RemoteURL(saved.RemoteURL),
+			LocalPath:      saved.LocalPath,
+			ThumbnailURL:   model.RemoteURL(saved.ThumbRemoteURL),
+			ThumbnailPath:  saved.ThumbLocalPath,
+			ThumbnailHash:  saved.ThumbHash,
+			SyncStatus:     saved.RemoteSync.Status,
+			SyncError:      saved.RemoteSync.Error,
+			Width:          saved.Width,
+			Height:         saved.Height,
+			PerceptualHash: saved.PerceptualHash,
+			FileSize:       fileSize,
+			TotalCount:     1,
+			ConfigSnapshot: string(snapshot),
+			TaskType:       "compose",
+			Private:        private,
+			CompletedAt:    &now,
+		}
+		if err := model.DB.Create(composed).Error; err != nil {
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建任务失败")
+			return
+		}
+		log.Printf("[API] 合成图已保存为任务 %s (%d 张, 跳过 %d 张)", taskID, len(cells), len(omitted))
+		Success(c, gin.H{
+			"task":    composed,
+			"omitted": omitted,
+		})
+		return
+	}
+
+	contentType, ext := "image/jpeg", "jpg"
+	if format == imaging.PNG {
+		contentType, ext = "image/png", "png"
+	}
+	if len(omitted) > 0 {
+		if manifest, err := json.Marshal(omitted); err == nil {
+			c.Header("X-Compose-Omitted", string(manifest))
+		}
+	}
+	c.Header("X-Compose-Count", strconv.Itoa(len(cells)))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=contact-sheet-%d.%s", time.Now().Unix(), ext))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// composeGridSize 按图片数、列数、单元格尺寸与间距计算画布宽高
+func composeGridSize(count int, req composeImagesRequest) (int, int) {
+	columns := min(req.Columns, count)
+	rows := (count + columns - 1) / columns
+	rowHeight := req.CellHeight
+	if req.Caption {
+		rowHeight += composeCaptionSize
+	}
+	return columns*req.CellWidth + (columns+1)*req.Gap, rows*rowHeight + (rows+1)*req.Gap
+}
+
+// drawCaption 用内置点阵字体在单元格下方绘制单行提示词摘要；字体仅覆盖 ASCII，
+// 其他字符替换为 ?，保证排版可预期
+func drawCaption(dst *image.NRGBA, text string, x, y, width int, bg color.Color) {
+	face := basicfont.Face7x13
+	maxChars := (width - 8) / face.Advance
+	if maxChars < 4 {
+		return
+	}
+	var b strings.Builder
+	for _, r := range strings.Join(strings.Fields(text), " ") {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	caption := b.String()
+	if utf8.RuneCountInString(caption) > maxChars {
+		caption = caption[:maxChars-3] + "..."
+	}
+
+	textColor := color.Black
+	if r, g, bl, _ := bg.RGBA(); (r+g+bl)/3 < 0x8000 {
+		textColor = color.White
+	}
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.P(x+4, y+composeCaptionSize-5),
+	}
+	drawer.DrawString(caption)
+}
+
+func parseHexColor(value string) (color.NRGBA, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if value == "" {
+		return color.NRGBA{R: 255, G: 255, B: 255, A: 255}, nil
+	}
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) != 6 {
+		return color.NRGBA{}, fmt.Errorf("无效的背景色: %s", value)
+	}
+	n, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("无效的背景色: %s", value)
+	}
+	return color.NRGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 255}, nil
+}
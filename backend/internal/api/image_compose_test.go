@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+func TestComposeImagesValidation(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+
+	tooMany := make([]string, maxComposeImages+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("task-%d", i)
+	}
+	cases := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"空 task_ids", map[string]interface{}{}},
+		{"task_ids 超过上限", map[string]interface{}{"task_ids": tooMany}},
+		{"列数超过上限", map[string]interface{}{"task_ids": []string{"a"}, "columns": maxComposeColumns + 1}},
+		{"单元格过大", map[string]interface{}{"task_ids": []string{"a"}, "cell_width": maxComposeCellSize + 1}},
+		{"间距过大", map[string]interface{}{"task_ids": []string{"a"}, "gap": maxComposeGap + 1}},
+		{"背景色无效", map[string]interface{}{"task_ids": []string{"a"}, "background": "zz"}},
+		{"输出格式无效", map[string]interface{}{"task_ids": []string{"a"}, "format": "gif"}},
+		// 任务均不存在：画布尺寸应在查询与解码前按请求数量拒绝，而不是返回 404
+		{"画布超过像素上限", map[string]interface{}{"task_ids": tooMany[:maxComposeImages], "columns": 10, "cell_width": 2048}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := performJSON(t, http.MethodPost, "/images/compose", "/images/compose", tc.body, ComposeImagesHandler)
+			expectError(t, rec, http.StatusBadRequest, model.ErrCodeValidationFailed)
+		})
+	}
+}
+
+func TestComposeImagesGrid(t *testing.T) {
+	env := testutil.Setup(t, testutil.Options{NoPool: true})
+
+	var ids []string
+	for i, size := range []int{40, 60, 80} {
+		path := filepath.Join(env.StorageDir, fmt.Sprintf("src-%d.png", i))
+		if err := os.WriteFile(path, testutil.PNG(t, size, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		task := testutil.CreateTask(t, &model.Task{TaskID: fmt.Sprintf("compose-%d", i), LocalPath: path})
+		ids = append(ids, task.TaskID)
+	}
+	ids = append(ids, "missing")
+
+	rec := performJSON(t, http.MethodPost, "/images/compose", "/images/compose", map[string]interface{}{
+		"task_ids": ids, "columns": 2, "cell_width": 50, "gap": 4,
+	}, ComposeImagesHandler)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("合成失败 %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-Compose-Count"); got != "3" {
+		t.Fatalf("X-Compose-Count = %q", got)
+	}
+	if rec.Header().Get("X-Compose-Omitted") == "" {
+		t.Fatal("缺失的任务未在 X-Compose-Omitted 中列出")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 张图 2 列：2 行，宽 2*50+3*4，高 2*50+3*4
+	if cfg.Width != 112 || cfg.Height != 112 {
+		t.Fatalf("画布尺寸 = %dx%d，期望 112x112", cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/storage"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// imageEditOperation 单个后期处理步骤
+//
+//	crop:   指定 x/y/width/height，或指定比例 ratio（如 "16:9"）并可选 gravity 锚点
+//	rotate: 顺时针旋转角度 angle（90/180/270）
+//	flip:   翻转方向 direction，取值 "horizontal" 或 "vertical"
+type imageEditOperation struct {
+	Type      string `json:"type"`
+	X         *int   `json:"x,omitempty"`
+	Y         *int   `json:"y,omitempty"`
+	Width     *int   `json:"width,omitempty"`
+	Height    *int   `json:"height,omitempty"`
+	Ratio     string `json:"ratio,omitempty"`
+	Gravity   string `json:"gravity,omitempty"`
+	Angle     int    `json:"angle,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+type imageEditRequest struct {
+	Operations []imageEditOperation `json:"operations"`
+}
+
+var gravityAnchors = map[string]imaging.Anchor{
+	"":             imaging.Center,
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top-left":     imaging.TopLeft,
+	"top-right":    imaging.TopRight,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom-right": imaging.BottomRight,
+}
+
+// EditImageHandler 对已保存的原图依次执行裁剪/旋转/翻转，结果保存为新的子任务，原图保持不变
+func EditImageHandler(c *gin.Context) {
+	id := c.Param("id")
+	var parent model.Task
+	if err := model.DB.Where("task_id = ?", id).First(&parent).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+
+	var req imageEditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if len(req.Operations) == 0 {
+		Error(c, http.StatusBadRequest, 400, "operations 不能为空")
+		return
+	}
+
+	img, format, err := openTaskImage(&parent)
+	if err != nil {
+		Error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	for i, op := range req.Operations {
+		img, err = applyImageEdit(img, op)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 400, fmt.Sprintf("第 %d 个操作 (%s) 无效: %v", i+1, op.Type, err))
+			return
+		}
+	}
+
+	buf, err := encodeImage(img, format)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 500, "编码图片失败: "+err.Error())
+		return
+	}
+
+	snapshot, _ := json.Marshal(map[string]interface{}{
+		"provider":       parent.ProviderName,
+		"model_id":       parent.ModelID,
+		"source_task_id": parent.TaskID,
+		"operations":     req.Operations,
+	})
+	child, err := saveDerivedTask(&parent, "edit", string(snapshot), buf)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, err.Error())
+		return
+	}
+
+	Success(c, child)
+}
+
+// openTaskImage 解码任务的本地原图并返回其 imaging 格式
+func openTaskImage(task *model.Task) (image.Image, imaging.Format, error) {
+	localPath := strings.TrimSpace(task.LocalPath)
+	if localPath == "" {
+		return nil, 0, fmt.Errorf("该任务没有本地原图文件")
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		return nil, 0, fmt.Errorf("本地原图文件不存在: %s", localPath)
+	}
+	img, err := imaging.Open(localPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("解码原图失败: %v", err)
+	}
+	format, err := imaging.FormatFromFilename(localPath)
+	if err != nil {
+		// webp 等 imaging 无法编码的格式统一输出为 PNG
+		format = imaging.PNG
+	}
+	return img, format, nil
+}
+
+func applyImageEdit(img image.Image, op imageEditOperation) (image.Image, error) {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	switch strings.ToLower(strings.TrimSpace(op.Type)) {
+	case "crop":
+		if strings.TrimSpace(op.Ratio) != "" {
+			ratio, err := provider.ParseAspectRatio(op.Ratio)
+			if err != nil {
+				return nil, err
+			}
+			anchor, ok := gravityAnchors[strings.ToLower(strings.TrimSpace(op.Gravity))]
+			if !ok {
+				return nil, fmt.Errorf("不支持的 gravity: %s", op.Gravity)
+			}
+			w, h := fitRatio(srcW, srcH, ratio)
+			return imaging.CropAnchor(img, w, h, anchor), nil
+		}
+		if op.X == nil || op.Y == nil || op.Width == nil || op.Height == nil {
+			return nil, fmt.Errorf("裁剪需要提供 x/y/width/height 或 ratio")
+		}
+		x, y, w, h := *op.X, *op.Y, *op.Width, *op.Height
+		if w <= 0 || h <= 0 {
+			return nil, fmt.Errorf("裁剪宽高必须大于 0 (width=%d, height=%d)", w, h)
+		}
+		if x < 0 || y < 0 || x+w > srcW || y+h > srcH {
+			return nil, fmt.Errorf("裁剪区域超出图片范围 (图片 %dx%d, 裁剪 x=%d y=%d width=%d height=%d)", srcW, srcH, x, y, w, h)
+		}
+		return imaging.Crop(img, image.Rect(x, y, x+w, y+h).Add(bounds.Min)), nil
+	case "rotate":
+		// imaging 的 Rotate 系列为逆时针，这里按顺时针角度对外暴露
+		switch op.Angle {
+		case 90, -270:
+			return imaging.Rotate270(img), nil
+		case 180, -180:
+			return imaging.Rotate180(img), nil
+		case 270, -90:
+			return imaging.Rotate90(img), nil
+		default:
+			return nil, fmt.Errorf("不支持的旋转角度: %d，可选值: 90, 180, 270", op.Angle)
+		}
+	case "flip":
+		switch strings.ToLower(strings.TrimSpace(op.Direction)) {
+		case "horizontal", "h":
+			return imaging.FlipH(img), nil
+		case "vertical", "v":
+			return imaging.FlipV(img), nil
+		default:
+			return nil, fmt.Errorf("不支持的翻转方向: %s，可选值: horizontal, vertical", op.Direction)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的操作类型，可选值: crop, rotate, flip")
+	}
+}
+
+// fitRatio 返回按指定比例能放入 srcW x srcH 的最大宽高
+func fitRatio(srcW, srcH int, ratio float64) (int, int) {
+	w, h := srcW, int(float64(srcW)/ratio+0.5)
+	if h > srcH {
+		h = srcH
+		w = int(float64(srcH)*ratio + 0.5)
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+func encodeImage(img image.Image, format imaging.Format) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	if err := imaging.Encode(buf, img, format, imaging.JPEGQuality(95)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// saveDerivedTask 保存处理后的图片并记录为已完成的子任务
+func saveDerivedTask(parent *model.Task, taskType, configSnapshot string, data *bytes.Buffer) (*model.Task, error) {
+	taskID := uuid.New().String()
+	fileSize := int64(data.Len())
+	saved, err := storage.SaveImage(taskID, data)
+	if err != nil {
+		return nil, fmt.Errorf("保存图片失败: %v", err)
+	}
+
+	now := time.Now()
+	child := &model.Task{
+		TaskID:         taskID,
+		Prompt:         parent.Prompt,
+		ProviderName:   parent.ProviderName,
+		ModelID:        parent.ModelID,
+		Status:         "completed",
+		ImageURL:       model.RemoteURL(saved.RemoteURL),
+		LocalPath:      saved.LocalPath,
+		ThumbnailURL:   model.RemoteURL(saved.ThumbRemoteURL),
+		ThumbnailPath:  saved.ThumbLocalPath,
+		ThumbnailHash:  saved.ThumbHash,
+		SyncStatus:     saved.RemoteSync.Status,
+		SyncError:      saved.RemoteSync.Error,
+		Width:          saved.Width,
+		Height:         saved.Height,
+		PerceptualHash: saved.PerceptualHash,
+		FileSize:       fileSize,
+		TotalCount:     1,
+		ConfigSnapshot: configSnapshot,
+		TaskType:       taskType,
+		ParentTaskID:   parent.TaskID,
+		RootTaskID:     lineageRoot(parent),
+		Private:        parent.Private,
+		CompletedAt:    &now,
+	}
+	if err := model.DB.Create(child).Error; err != nil {
+		return nil, fmt.Errorf("创建任务失败: %v", err)
+	}
+	log.Printf("[API] 已生成派生任务 %s (type=%s, parent=%s)", taskID, taskType, parent.TaskID)
+	return child, nil
+}
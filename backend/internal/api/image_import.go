@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// taskStatusImported 从外部导入的图片，与 completed 一样视为已完成
+const taskStatusImported = "imported"
+
+// finishedTaskStatuses 有可用图片文件的任务状态
+var finishedTaskStatuses = []string{"completed", taskStatusImported}
+
+// importSkipped 导入时被跳过的文件及原因
+type importSkipped struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+	// TaskID 内容重复时为已存在的任务 ID
+	TaskID string `json:"task_id,omitempty"`
+}
+
+// ImportImagesHandler 将外部图片导入图库：files 字段中的每个文件按生成图片的方式存储，记为 manual Provider 的 imported 任务。
+// 提示词取自表单字段 prompt，缺省时读取其他工具写入的文本（PNG 文本块、JPEG 注释）；内容哈希已存在的文件跳过
+func ImportImagesHandler(c *gin.Context) {
+	limits := currentUploadLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxTotalBytes+uploadFormOverhead)
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		if limitErr := asUploadError(err, limits); limitErr != nil {
+			Error(c, limitErr.Status, limitErr.Status, limitErr.Message)
+			return
+		}
+		Error(c, http.StatusBadRequest, 400, "解析表单失败: "+err.Error())
+		return
+	}
+
+	files := c.Request.MultipartForm.File["files"]
+	if len(files) == 0 {
+		files = c.Request.MultipartForm.File["file"]
+	}
+	if len(files) == 0 {
+		Error(c, http.StatusBadRequest, 400, "请通过 files 字段上传图片")
+		return
+	}
+	formPrompt := strings.TrimSpace(c.PostForm("prompt"))
+	caption := strings.TrimSpace(c.PostForm("caption"))
+	private, err := resolveTaskPrivate(c.PostForm("private"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+
+	imported := make([]*model.Task, 0, len(files))
+	skipped := make([]importSkipped, 0)
+	seen := make(map[string]bool)
+	for _, fileHeader := range files {
+		content, err := readImportFile(fileHeader, limits)
+		if err != nil {
+			skipped = append(skipped, importSkipped{File: fileHeader.Filename, Reason: err.Error()})
+			continue
+		}
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if seen[hash] {
+			skipped = append(skipped, importSkipped{File: fileHeader.Filename, Reason: "与本次上传的其他文件内容相同"})
+			continue
+		}
+		seen[hash] = true
+		var existing model.Task
+		if err := model.DB.Select("task_id").Where("content_hash = ?", hash).First(&existing).Error; err == nil {
+			skipped = append(skipped, importSkipped{File: fileHeader.Filename, Reason: "图库中已存在相同图片", TaskID: existing.TaskID})
+			continue
+		}
+
+		prompt := formPrompt
+		if prompt == "" {
+			prompt = extractEmbeddedPrompt(content)
+		}
+		task, err := saveImportedImage(fileHeader.Filename, content, hash, prompt, caption, private)
+		if err != nil {
+			log.Printf("[Import] 导入 %s 失败: %v", fileHeader.Filename, err)
+			skipped = append(skipped, importSkipped{File: fileHeader.Filename, Reason: err.Error()})
+			continue
+		}
+		imported = append(imported, task)
+	}
+
+	log.Printf("[Import] 导入完成: 成功 %d, 跳过 %d", len(imported), len(skipped))
+	Success(c, gin.H{
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
+
+func readImportFile(fileHeader *multipart.FileHeader, limits uploadLimits) ([]byte, error) {
+	if fileHeader.Size > limits.MaxFileBytes {
+		return nil, errFileTooLarge("files", fileHeader.Filename, limits.MaxFileBytes)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, errors.New("读取文件失败")
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, limits.MaxFileBytes+1))
+	if err != nil {
+		return nil, errors.New("读取文件失败")
+	}
+	if int64(len(content)) > limits.MaxFileBytes {
+		return nil, errFileTooLarge("files", fileHeader.Filename, limits.MaxFileBytes)
+	}
+	if err := validateImageContent("files", fileHeader.Filename, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func saveImportedImage(fileName string, content []byte, hash, prompt, caption string, private bool) (*model.Task, error) {
+	taskID := uuid.New().String()
+	saved, err := storage.SaveImage(taskID, bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.New("保存图片失败: " + err.Error())
+	}
+
+	snapshot, _ := json.Marshal(map[string]interface{}{
+		"provider":    "manual",
+		"source_file": fileName,
+	})
+	now := time.Now()
+	task := &model.Task{
+		TaskID:         taskID,
+		Prompt:         prompt,
+		ProviderName:   "manual",
+		Status:         taskStatusImported,
+		ImageURL:       model.RemoteURL(saved.RemoteURL),
+		LocalPath:      saved.LocalPath,
+		ThumbnailURL:   model.RemoteURL(saved.ThumbRemoteURL),
+		ThumbnailPath:  saved.ThumbLocalPath,
+		ThumbnailHash:  saved.ThumbHash,
+		SyncStatus:     saved.RemoteSync.Status,
+		SyncError:      saved.RemoteSync.Error,
+		Width:          saved.Width,
+		Height:         saved.Height,
+		PerceptualHash: saved.PerceptualHash,
+		FileSize:       int64(len(content)),
+		ContentHash:    hash,
+		TotalCount:     1,
+		ConfigSnapshot: string(snapshot),
+		TaskType:       "import",
+		Caption:        caption,
+		Private:        private,
+		CompletedAt:    &now,
+	}
+	if err := model.DB.Create(task).Error; err != nil {
+		deleteTaskFiles(task)
+		return nil, errors.New("创建任务失败: " + err.Error())
+	}
+	return task, nil
+}
+
+// extractEmbeddedPrompt 读取其他工具写入图片的提示词：PNG 文本块（parameters / prompt /
+// Description 等）与 JPEG 注释段；ComfyUI 等写入的 JSON 工作流不作为提示词
+func extractEmbeddedPrompt(data []byte) string {
+	var texts map[string]string
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		texts = pngTextChunks(data)
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		if comment := jpegComment(data); comment != "" {
+			texts = map[string]string{"Comment": comment}
+		}
+	}
+	for _, key := range []string{"parameters", "prompt", "Description", "Title", "Comment"} {
+		text := strings.TrimSpace(texts[key])
+		if text == "" || strings.HasPrefix(text, "{") {
+			continue
+		}
+		if key == "parameters" {
+			// Stable Diffusion WebUI 格式：正向提示词后依次为 Negative prompt 与 Steps 等参数
+			for _, marker := range []string{"\nNegative prompt:", "\nSteps:"} {
+				if idx := strings.Index(text, marker); idx >= 0 {
+					text = text[:idx]
+				}
+			}
+			text = strings.TrimSpace(text)
+		}
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// pngTextChunks 读取 tEXt 与未压缩的 iTXt 文本块
+func pngTextChunks(data []byte) map[string]string {
+	texts := make(map[string]string)
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		start := pos + 8
+		end := start + length
+		if length < 0 || end+4 > len(data) {
+			break
+		}
+		chunk := data[start:end]
+		switch chunkType {
+		case "tEXt":
+			if idx := bytes.IndexByte(chunk, 0); idx > 0 {
+				texts[string(chunk[:idx])] = string(chunk[idx+1:])
+			}
+		case "iTXt":
+			// keyword \0 压缩标志 压缩方式 语言 \0 翻译关键字 \0 文本
+			if idx := bytes.IndexByte(chunk, 0); idx > 0 && idx+2 < len(chunk) && chunk[idx+1] == 0 {
+				rest := chunk[idx+3:]
+				if lang := bytes.IndexByte(rest, 0); lang >= 0 {
+					rest = rest[lang+1:]
+					if translated := bytes.IndexByte(rest, 0); translated >= 0 {
+						texts[string(chunk[:idx])] = string(rest[translated+1:])
+					}
+				}
+			}
+		case "IEND":
+			return texts
+		}
+		pos = end + 4
+	}
+	return texts
+}
+
+// jpegComment 读取 JPEG 的 COM 注释段
+func jpegComment(data []byte) string {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		if marker == 0xFE {
+			return string(data[pos+4 : pos+2+length])
+		}
+		pos += 2 + length
+	}
+	return ""
+}
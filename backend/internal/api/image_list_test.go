@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+// listAllImages 按游标翻完整个图库列表，返回全部列表项与响应体总字节数
+func listAllImages(t *testing.T, fields string) ([]map[string]json.RawMessage, int) {
+	t.Helper()
+	var items []map[string]json.RawMessage
+	size := 0
+	cursor := ""
+	for {
+		query := url.Values{"page_size": {"100"}}
+		if fields != "" {
+			query.Set("fields", fields)
+		}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		rec := performJSON(t, http.MethodGet, "/api/v1/images", "/api/v1/images?"+query.Encode(), nil, ListImagesHandler)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("查询图库列表 %d: %s", rec.Code, rec.Body.String())
+		}
+		size += rec.Body.Len()
+		var resp struct {
+			Data struct {
+				List       []map[string]json.RawMessage `json:"list"`
+				NextCursor string                       `json:"next_cursor"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, resp.Data.List...)
+		if resp.Data.NextCursor == "" || len(resp.Data.List) == 0 {
+			return items, size
+		}
+		cursor = resp.Data.NextCursor
+	}
+}
+
+// TestImageListOmitsFullPrompt 1000 个长提示词任务的图库列表默认只返回提示词预览，
+// 响应体积明显小于 fields=prompt 时的完整列表
+func TestImageListOmitsFullPrompt(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	const taskCount = 1000
+	prompt := strings.Repeat("一只在雪山上奔跑的赤狐，电影感光影，", 100)
+	tasks := make([]model.Task, taskCount)
+	for i := range tasks {
+		tasks[i] = model.Task{
+			TaskID:       fmt.Sprintf("list-%04d", i),
+			Prompt:       prompt,
+			ProviderName: "fake",
+			TotalCount:   1,
+			Status:       "completed",
+		}
+	}
+	if err := model.DB.CreateInBatches(tasks, 200).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	trimmed, trimmedSize := listAllImages(t, "")
+	full, fullSize := listAllImages(t, "prompt")
+	if len(trimmed) != taskCount || len(full) != taskCount {
+		t.Fatalf("列表项数 = %d / %d，期望 %d", len(trimmed), len(full), taskCount)
+	}
+	for _, item := range trimmed {
+		if _, ok := item["prompt"]; ok {
+			t.Fatal("默认列表返回了完整提示词")
+		}
+		var preview string
+		if err := json.Unmarshal(item["prompt_preview"], &preview); err != nil || preview == "" {
+			t.Fatalf("列表项缺少提示词预览: %s", item["prompt_preview"])
+		}
+		if n := utf8.RuneCountInString(preview); n > model.PromptPreviewRunes+1 {
+			t.Fatalf("提示词预览长度 = %d 个字符", n)
+		}
+	}
+	var got string
+	if err := json.Unmarshal(full[0]["prompt"], &got); err != nil || got != prompt {
+		t.Fatal("fields=prompt 时未返回完整提示词")
+	}
+	if trimmedSize*4 > fullSize {
+		t.Fatalf("默认列表 %d 字节，完整列表 %d 字节，期望缩减到四分之一以下", trimmedSize, fullSize)
+	}
+	t.Logf("1000 个任务：默认列表 %d 字节，完整列表 %d 字节", trimmedSize, fullSize)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageMetadataHandler 返回图片的来源信息，结构与导出 manifest.json 中的条目相同
+func ImageMetadataHandler(c *gin.Context) {
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", c.Param("id")).First(&task).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s-metadata.json", task.TaskID))
+	c.IndentedJSON(http.StatusOK, buildImageMetadata(&task))
+}
+
+// buildImageMetadata 填充标签后生成单张图片的元数据，File 为下载时使用的文件名
+func buildImageMetadata(task *model.Task) exportManifestItem {
+	tasks := []model.Task{*task}
+	attachTaskTags(model.DB, tasks)
+	return newManifestItem(&tasks[0], downloadFileName(task))
+}
+
+// downloadFileName 按实际文件扩展名生成下载文件名
+func downloadFileName(task *model.Task) string {
+	ext := filepath.Ext(task.LocalPath)
+	if ext == "" {
+		ext = ".png" // 默认使用 .png
+	}
+	return task.TaskID + ext
+}
+
+// writeImageWithMetadata 以 zip 形式返回图片与 metadata.json
+func writeImageWithMetadata(c *gin.Context, task *model.Task) {
+	file, err := os.Open(task.LocalPath)
+	if err != nil {
+		Error(c, http.StatusNotFound, 404, "本地文件不存在")
+		return
+	}
+	defer file.Close()
+	metadata, err := json.MarshalIndent(buildImageMetadata(task), "", "  ")
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 500, "生成元数据失败")
+		return
+	}
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", task.TaskID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	zipWriter := zip.NewWriter(c.Writer)
+	defer zipWriter.Close()
+	writer, err := zipWriter.Create(downloadFileName(task))
+	if err == nil {
+		_, err = io.Copy(writer, file)
+	}
+	if err != nil {
+		log.Printf("[API] 打包图片 %s 失败: %v", task.TaskID, err)
+		return
+	}
+	if writer, err := zipWriter.Create("metadata.json"); err == nil {
+		_, _ = writer.Write(metadata)
+	}
+}
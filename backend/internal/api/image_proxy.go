@@ -0,0 +1,313 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// proxyCacheDirName 代理缓存目录，位于本地存储目录下；隐藏目录不会被定期清理与存储迁移处理
+	proxyCacheDirName = ".proxy-cache"
+	// maxProxyImageSize 代理拉取的单张图片大小上限
+	maxProxyImageSize = 50 * 1024 * 1024
+	// proxyFetchTimeout 拉取远程图片的超时时间
+	proxyFetchTimeout = 30 * time.Second
+	// proxyMaxRedirects 远程地址允许的最大重定向次数，每一跳都会重新做地址校验
+	proxyMaxRedirects = 3
+)
+
+var (
+	// proxyCacheMaxBytes 代理缓存总大小上限，超出时从最久未访问的文件开始淘汰
+	proxyCacheMaxBytes int64 = 512 * 1024 * 1024
+	// proxyCacheTTL 代理缓存文件超过该时间未被访问即删除
+	proxyCacheTTL = 7 * 24 * time.Hour
+
+	proxyCachePruneMu sync.Mutex
+)
+
+var errProxyAddressBlocked = errors.New("远程地址指向内网或保留地址，已拒绝")
+
+// proxyClient 拉取任务远程图片的客户端：连接建立前校验解析出的实际 IP，
+// 拒绝回环、内网、链路本地等地址，避免通过任务记录中的地址访问内网服务
+var proxyClient = &http.Client{
+	Timeout: proxyFetchTimeout,
+	Transport: &http.Transport{
+		// 不走环境变量中的代理，否则校验的是代理地址而不是目标地址
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return errProxyAddressBlocked
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= proxyMaxRedirects {
+			return fmt.Errorf("重定向次数超过 %d 次", proxyMaxRedirects)
+		}
+		return validateProxyURL(req.URL)
+	},
+}
+
+// isPublicIP 是否为可以从公网访问的单播地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		// 100.64.0.0/10 运营商级 NAT 地址
+		(ip.To4() != nil && ip.To4()[0] == 100 && ip.To4()[1]&0xc0 == 64))
+}
+
+// validateProxyURL 只允许 http(s) 地址，且不得携带用户信息
+func validateProxyURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("不支持的地址协议: %s", u.Scheme)
+	}
+	if u.Host == "" || u.User != nil {
+		return errors.New("远程地址无效")
+	}
+	return nil
+}
+
+// ImageProxyHandler 经后端转发任务图片（?thumb=1 为缩略图），本地文件直接返回，远程图片经 SSRF 校验后拉取并缓存，Bucket 禁止跨域时图库也能显示
+func ImageProxyHandler(c *gin.Context) {
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", c.Param("id")).First(&task).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+
+	thumb := c.Query("thumb") == "1" || c.Query("thumb") == "true"
+	localPath, remoteURL := task.LocalPath, string(task.ImageURL)
+	if thumb {
+		localPath, remoteURL = task.ThumbnailPath, string(task.ThumbnailURL)
+	}
+
+	if localPath != "" {
+		if info, err := os.Stat(localPath); err == nil && !info.IsDir() {
+			c.Header("Cache-Control", storage.CacheControl(localPath))
+			c.File(localPath)
+			return
+		}
+	}
+	if remoteURL == "" {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeNotFound, "图片没有可用的本地文件或远程地址")
+		return
+	}
+
+	cachePath := proxyCachePath(task.TaskID, remoteURL, thumb)
+	if cachePath != "" {
+		if data, err := readProxyCache(cachePath); err == nil {
+			writeProxiedImage(c, data)
+			return
+		}
+	}
+
+	data, err := fetchProxyImage(c.Request.Context(), remoteURL)
+	if err != nil {
+		log.Printf("[API] 代理任务 %s 的远程图片失败: %v", task.TaskID, err)
+		ErrorWithCode(c, http.StatusBadGateway, 502, model.ErrCodeUpstreamError, "获取远程图片失败: "+err.Error())
+		return
+	}
+	if cachePath != "" {
+		if err := writeProxyCache(cachePath, data); err != nil {
+			log.Printf("[API] 缓存任务 %s 的远程图片失败: %v", task.TaskID, err)
+		}
+		pruneProxyCache(filepath.Dir(cachePath), time.Now())
+	}
+	writeProxiedImage(c, data)
+}
+
+// fetchProxyImage 拉取远程图片，只接受图片内容
+func fetchProxyImage(ctx context.Context, source string) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, errors.New("远程地址无效")
+	}
+	if err := validateProxyURL(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errProxyAddressBlocked) {
+			return nil, errProxyAddressBlocked
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProxyImageSize {
+		return nil, fmt.Errorf("远程图片超过 %d 字节", maxProxyImageSize)
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, errors.New("远程地址返回的不是图片")
+	}
+	return data, nil
+}
+
+// writeProxiedImage 按实际内容设置 Content-Type，不信任上游返回的类型
+func writeProxiedImage(c *gin.Context, data []byte) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", http.DetectContentType(data))
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(data))
+}
+
+// proxyCachePath 缓存文件按任务 ID 与远程地址哈希命名，远程地址变化后不会读到旧内容；
+// 未启用本地存储时返回空字符串，不缓存
+func proxyCachePath(taskID, remoteURL string, thumb bool) string {
+	dir := storage.LocalDir()
+	if dir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(remoteURL))
+	kind := "image"
+	if thumb {
+		kind = "thumb"
+	}
+	return filepath.Join(dir, proxyCacheDirName, fmt.Sprintf("%s-%s-%s", taskID, kind, hex.EncodeToString(sum[:8])))
+}
+
+// readProxyCache 读取缓存并刷新修改时间，淘汰时按修改时间判断最近访问
+func readProxyCache(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, nil
+}
+
+// writeProxyCache 先写临时文件再重命名，并发请求同一张图片时不会读到写了一半的文件
+func writeProxyCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// pruneProxyCache 删除超过 proxyCacheTTL 未访问的缓存文件，总大小仍超过 proxyCacheMaxBytes 时
+// 从最久未访问的开始淘汰。每次写入缓存后调用，已有清理在进行时直接跳过
+func pruneProxyCache(dir string, now time.Time) {
+	if !proxyCachePruneMu.TryLock() {
+		return
+	}
+	defer proxyCachePruneMu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]cacheFile, 0, len(entries))
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if now.Sub(info.ModTime()) > proxyCacheTTL {
+			removeProxyCacheFile(path)
+			continue
+		}
+		// 正在写入的临时文件不参与按大小淘汰
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+	if total <= proxyCacheMaxBytes {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		if total <= proxyCacheMaxBytes {
+			break
+		}
+		removeProxyCacheFile(file.path)
+		total -= file.size
+	}
+}
+
+func removeProxyCacheFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[API] 删除代理缓存失败 %s: %v", path, err)
+	}
+}
+
+// removeProxyCache 删除任务的代理缓存
+func removeProxyCache(taskID string) {
+	dir := storage.LocalDir()
+	if dir == "" {
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, proxyCacheDirName, taskID+"-*"))
+	for _, path := range matches {
+		removeProxyCacheFile(path)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/testutil"
+)
+
+// TestPruneProxyCache 写入缓存后删除超过保留时间未访问的文件，总大小超过上限时从最久未访问的开始淘汰，
+// 读取命中会刷新访问时间
+func TestPruneProxyCache(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	maxBytes, ttl := proxyCacheMaxBytes, proxyCacheTTL
+	proxyCacheMaxBytes, proxyCacheTTL = 250, 24*time.Hour
+	t.Cleanup(func() { proxyCacheMaxBytes, proxyCacheTTL = maxBytes, ttl })
+
+	now := time.Now()
+	data := make([]byte, 100)
+	write := func(taskID string, age time.Duration) string {
+		t.Helper()
+		path := proxyCachePath(taskID, "https://example.com/"+taskID+".png", false)
+		if err := writeProxyCache(path, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	expired := write("expired", 48*time.Hour)
+	oldest := write("oldest", 3*time.Hour)
+	older := write("older", 2*time.Hour)
+	newest := write("newest", time.Hour)
+
+	// 命中缓存后 oldest 成为最近访问的文件
+	if _, err := readProxyCache(oldest); err != nil {
+		t.Fatal(err)
+	}
+	pruneProxyCache(filepath.Dir(oldest), time.Now())
+
+	for path, kept := range map[string]bool{expired: false, older: false, newest: true, oldest: true} {
+		_, err := os.Stat(path)
+		if exists := err == nil; exists != kept {
+			t.Fatalf("%s 保留 = %v，期望 %v", filepath.Base(path), exists, kept)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSimilarThreshold 64 位 dHash 的汉明距离阈值，10 以内通常是同一构图的重绘或轻微裁剪
+	defaultSimilarThreshold = 10
+	// defaultDuplicateThreshold 重复分组使用更严格的阈值，减少误判
+	defaultDuplicateThreshold = 6
+	maxSimilarThreshold       = 20
+	maxSimilarResults         = 200
+	// maxDuplicateScan 查找重复分组需两两比较，只扫描最近的这么多张图片
+	maxDuplicateScan        = 20000
+	maxDuplicateClusters    = 200
+	perceptualHashBatchSize = 100
+)
+
+// similarImage 相似图片及其与目标图片的汉明距离
+type similarImage struct {
+	TaskID        string    `json:"task_id"`
+	Prompt        string    `json:"prompt"`
+	ThumbnailPath string    `json:"thumbnail_path"`
+	ThumbnailURL  string    `json:"thumbnail_url"`
+	ThumbnailSrc  string    `json:"thumbnail_src,omitempty"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	FileSize      int64     `json:"file_size"`
+	CreatedAt     time.Time `json:"created_at"`
+	Distance      int       `json:"distance"`
+}
+
+// duplicateCluster 一组近似重复的图片，Images 按创建时间排序
+type duplicateCluster struct {
+	Images      []similarImage `json:"images"`
+	MaxDistance int            `json:"max_distance"`
+	TotalBytes  int64          `json:"total_bytes"`
+}
+
+// hashedTask 参与比较的任务及解析后的哈希
+type hashedTask struct {
+	task model.Task
+	hash uint64
+}
+
+// SimilarImagesHandler 列出感知哈希与该图片的汉明距离在给定范围内的图片，距离近的在前
+func SimilarImagesHandler(c *gin.Context) {
+	threshold, ok := parseSimilarThreshold(c, defaultSimilarThreshold)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > maxSimilarResults {
+		limit = maxSimilarResults
+	}
+
+	task, err := loadTask(c.Param("id"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+	target, ok := storage.ParsePerceptualHash(task.PerceptualHash)
+	if !ok {
+		ErrorWithCode(c, http.StatusConflict, 409, model.ErrCodeConflict, "该图片尚未计算感知哈希，请先运行 perceptual_hash 回填作业")
+		return
+	}
+
+	candidates, err := loadHashedTasks(c.Request.Context(), 0)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
+		return
+	}
+	results := make([]similarImage, 0)
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.task.TaskID == task.TaskID {
+			continue
+		}
+		if distance := storage.HammingDistance(target, candidate.hash); distance <= threshold {
+			results = append(results, newSimilarImage(&candidate.task, distance))
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	Success(c, gin.H{
+		"task_id":   task.TaskID,
+		"threshold": threshold,
+		"list":      results,
+	})
+}
+
+// DuplicateImagesHandler 将感知哈希两两（可传递）落在阈值内的近期图片分组，大组在前
+func DuplicateImagesHandler(c *gin.Context) {
+	threshold, ok := parseSimilarThreshold(c, defaultDuplicateThreshold)
+	if !ok {
+		return
+	}
+	candidates, err := loadHashedTasks(c.Request.Context(), maxDuplicateScan)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
+		return
+	}
+
+	// 并查集合并距离在阈值内的图片
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			if storage.HammingDistance(candidates[i].hash, candidates[j].hash) <= threshold {
+				if a, b := find(i), find(j); a != b {
+					parent[b] = a
+				}
+			}
+		}
+	}
+	groups := make(map[int][]int)
+	for i := range candidates {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	clusters := make([]duplicateCluster, 0)
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		cluster := duplicateCluster{Images: make([]similarImage, 0, len(members))}
+		first := candidates[members[0]].hash
+		for _, idx := range members {
+			distance := storage.HammingDistance(first, candidates[idx].hash)
+			cluster.MaxDistance = max(cluster.MaxDistance, distance)
+			cluster.TotalBytes += candidates[idx].task.FileSize
+			cluster.Images = append(cluster.Images, newSimilarImage(&candidates[idx].task, distance))
+		}
+		sort.SliceStable(cluster.Images, func(i, j int) bool {
+			return cluster.Images[i].CreatedAt.Before(cluster.Images[j].CreatedAt)
+		})
+		clusters = append(clusters, cluster)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].Images) != len(clusters[j].Images) {
+			return len(clusters[i].Images) > len(clusters[j].Images)
+		}
+		return clusters[i].TotalBytes > clusters[j].TotalBytes
+	})
+	truncated := len(clusters) > maxDuplicateClusters
+	if truncated {
+		clusters = clusters[:maxDuplicateClusters]
+	}
+	Success(c, gin.H{
+		"threshold": threshold,
+		"scanned":   len(candidates),
+		"truncated": truncated || len(candidates) >= maxDuplicateScan,
+		"clusters":  clusters,
+	})
+}
+
+func parseSimilarThreshold(c *gin.Context, fallback int) (int, bool) {
+	value := c.Query("threshold")
+	if value == "" {
+		return fallback, true
+	}
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 || threshold > maxSimilarThreshold {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("threshold 应为 0-%d 之间的整数", maxSimilarThreshold))
+		return 0, false
+	}
+	return threshold, true
+}
+
+// loadHashedTasks 读取已计算感知哈希且未归档的图片，按创建时间倒序；limit 为 0 时不限制
+func loadHashedTasks(ctx context.Context, limit int) ([]hashedTask, error) {
+	query := model.DB.WithContext(ctx).Model(&model.Task{}).
+		Select("task_id", "prompt", "thumbnail_path", "thumbnail_url", "width", "height", "file_size", "created_at", "perceptual_hash").
+		Where("perceptual_hash <> '' AND archived_at IS NULL").
+		Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var tasks []model.Task
+	if err := query.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	result := make([]hashedTask, 0, len(tasks))
+	for _, task := range tasks {
+		if hash, ok := storage.ParsePerceptualHash(task.PerceptualHash); ok {
+			result = append(result, hashedTask{task: task, hash: hash})
+		}
+	}
+	return result, nil
+}
+
+func newSimilarImage(task *model.Task, distance int) similarImage {
+	return similarImage{
+		TaskID:        task.TaskID,
+		Prompt:        task.Prompt,
+		ThumbnailPath: task.ThumbnailPath,
+		ThumbnailURL:  task.ThumbnailURL.Public(),
+		ThumbnailSrc:  task.ThumbnailSrc,
+		Width:         task.Width,
+		Height:        task.Height,
+		FileSize:      task.FileSize,
+		CreatedAt:     task.CreatedAt,
+		Distance:      distance,
+	}
+}
+
+func perceptualHashBackfillQuery() *gorm.DB {
+	return model.DB.Model(&model.Task{}).
+		Where("status IN ? AND local_path <> '' AND archived_at IS NULL", finishedTaskStatuses).
+		Where("(perceptual_hash = '' OR perceptual_hash IS NULL)")
+}
+
+// runPerceptualHashBackfill 为保存时尚未计算感知哈希的旧图片回填
+func runPerceptualHashBackfill(ctx context.Context, run *jobs.Run) error {
+	var total int64
+	if err := perceptualHashBackfillQuery().Count(&total).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	var batch []model.Task
+	return perceptualHashBackfillQuery().
+		Select("id", "task_id", "local_path").
+		FindInBatches(&batch, perceptualHashBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				task := &batch[i]
+				hash, err := storage.PerceptualHashFile(task.LocalPath)
+				if err != nil {
+					log.Printf("[Maintenance] 任务 %s 计算感知哈希失败: %v", task.TaskID, err)
+					run.Count("failed", 1)
+					run.Advance(1)
+					continue
+				}
+				if err := model.DB.Model(&model.Task{}).Where("id = ?", task.ID).Update("perceptual_hash", hash).Error; err != nil {
+					return err
+				}
+				InvalidateTask(task.TaskID)
+				run.Count("updated", 1)
+				run.Advance(1)
+			}
+			return nil
+		}).Error
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"image-gen-service/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// imageSortKey 排序键：expr 用于 ORDER BY 与游标比较，value 用于读取游标中保存的取值。
+// created_at 列会被驱动解析为 time.Time，游标中需保存数据库中的原始文本才能逐字比较
+type imageSortKey struct {
+	expr  string
+	value string
+}
+
+// imageSortColumns sort 参数白名单，只有列在这里的表达式才会拼入 SQL
+var imageSortColumns = map[string]imageSortKey{
+	"created_at":   {expr: "created_at", value: "CAST(created_at AS TEXT)"},
+	"completed_at": {expr: model.TaskSortCompletedAt, value: model.TaskSortCompletedAt},
+	"duration":     {expr: model.TaskSortDuration, value: model.TaskSortDuration},
+	"size":         {expr: model.TaskSortFileSize, value: model.TaskSortFileSize},
+	"width":        {expr: model.TaskSortWidth, value: model.TaskSortWidth},
+	"prompt":       {expr: "prompt", value: "prompt"},
+}
+
+// defaultImageSortKeys 未指定 sort 时的排序：进行中的任务置顶（限流等待中的任务与排队任务同级），
+// 其余按创建时间倒序
+var defaultImageSortKeys = []imageSortKey{
+	{
+		expr:  "CASE status WHEN 'processing' THEN 2 WHEN 'pending' THEN 1 WHEN 'rate_limited' THEN 1 ELSE 0 END",
+		value: "CASE status WHEN 'processing' THEN 2 WHEN 'pending' THEN 1 WHEN 'rate_limited' THEN 1 ELSE 0 END",
+	},
+	imageSortColumns["created_at"],
+}
+
+// imageSort 解析后的排序方式，所有排序键方向相同，最后以 id 兜底保证顺序稳定
+type imageSort struct {
+	name  string // 空字符串表示默认排序
+	order string // asc 或 desc
+	keys  []imageSortKey
+}
+
+// imageListCursor 游标分页的位置：记录排序方式与上一页最后一条的排序键取值
+type imageListCursor struct {
+	Sort   string        `json:"sort"`
+	Order  string        `json:"order"`
+	Values []interface{} `json:"values"`
+	ID     uint          `json:"id"`
+}
+
+// parseImageSort 解析 sort/order 参数，sort 不在白名单内时返回错误
+func parseImageSort(sortName, order string) (imageSort, error) {
+	sortName = strings.ToLower(strings.TrimSpace(sortName))
+	order = strings.ToLower(strings.TrimSpace(order))
+	if order != "" && order != "asc" && order != "desc" {
+		return imageSort{}, fmt.Errorf("order 仅支持 asc 或 desc")
+	}
+	if sortName == "" {
+		// 默认排序固定为倒序，order 不生效
+		return imageSort{order: "desc", keys: defaultImageSortKeys}, nil
+	}
+	key, ok := imageSortColumns[sortName]
+	if !ok {
+		return imageSort{}, fmt.Errorf("不支持的排序字段: %s（可选 created_at、completed_at、duration、size、width、prompt）", sortName)
+	}
+	if order == "" {
+		order = "desc"
+	}
+	return imageSort{name: sortName, order: order, keys: []imageSortKey{key}}, nil
+}
+
+func (s imageSort) direction() string {
+	if s.order == "asc" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// orderClause 生成 ORDER BY 子句
+func (s imageSort) orderClause() string {
+	parts := make([]string, 0, len(s.keys)+1)
+	for _, key := range s.keys {
+		parts = append(parts, key.expr+" "+s.direction())
+	}
+	parts = append(parts, "id "+s.direction())
+	return strings.Join(parts, ", ")
+}
+
+// afterCursor 只保留排在游标之后的记录，使用行值比较以便命中排序表达式索引
+func (s imageSort) afterCursor(query *gorm.DB, cursor *imageListCursor) *gorm.DB {
+	exprs := make([]string, 0, len(s.keys)+1)
+	for _, key := range s.keys {
+		exprs = append(exprs, key.expr)
+	}
+	exprs = append(exprs, "id")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(exprs)), ", ")
+	operator := "<"
+	if s.order == "asc" {
+		operator = ">"
+	}
+	args := append(append([]interface{}{}, cursor.Values...), cursor.ID)
+	return query.Where("("+strings.Join(exprs, ", ")+") "+operator+" ("+placeholders+")", args...)
+}
+
+// encodeCursor 读取指定任务的排序键取值并编码为游标
+func (s imageSort) encodeCursor(ctx context.Context, id uint) (string, error) {
+	columns := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		columns = append(columns, key.value)
+	}
+	values := make([]interface{}, len(s.keys))
+	dest := make([]interface{}, len(s.keys))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	row := model.DB.WithContext(ctx).Raw("SELECT "+strings.Join(columns, ", ")+" FROM tasks WHERE id = ?", id).Row()
+	if err := row.Scan(dest...); err != nil {
+		return "", err
+	}
+	for i, value := range values {
+		if raw, ok := value.([]byte); ok {
+			values[i] = string(raw)
+		}
+	}
+	data, err := json.Marshal(imageListCursor{Sort: s.name, Order: s.order, Values: values, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor 解析游标，并校验其排序方式与本次请求一致，避免翻页时顺序错乱
+func (s imageSort) decodeCursor(value string) (*imageListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("cursor 格式无效")
+	}
+	var cursor imageListCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(s.keys) {
+		return nil, fmt.Errorf("cursor 格式无效")
+	}
+	if cursor.Sort != s.name || cursor.Order != s.order {
+		return nil, fmt.Errorf("cursor 与当前排序参数不一致，请使用相同的 sort/order 翻页")
+	}
+	for _, v := range cursor.Values {
+		switch v.(type) {
+		case string, float64:
+		default:
+			return nil, fmt.Errorf("cursor 格式无效")
+		}
+	}
+	return &cursor, nil
+}
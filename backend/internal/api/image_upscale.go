@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type upscaleImageRequest struct {
+	Provider string `json:"provider"`
+	ModelID  string `json:"model_id"`
+	Factor   int    `json:"factor"`
+}
+
+// UpscaleImageHandler 将已保存图片的放大处理提交为关联的子任务
+func UpscaleImageHandler(c *gin.Context) {
+	id := c.Param("id")
+	var parent model.Task
+	if err := model.DB.Where("task_id = ?", id).First(&parent).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+
+	var req upscaleImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if req.Factor == 0 {
+		req.Factor = 2
+	}
+	if req.Factor != 2 && req.Factor != 4 {
+		Error(c, http.StatusBadRequest, 400, fmt.Sprintf("不支持的放大倍数: %d，可选值: 2, 4", req.Factor))
+		return
+	}
+
+	localPath := strings.TrimSpace(parent.LocalPath)
+	if localPath == "" {
+		Error(c, http.StatusBadRequest, 400, "该任务没有本地原图文件")
+		return
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		Error(c, http.StatusBadRequest, 400, "本地原图文件不存在: "+localPath)
+		return
+	}
+
+	providerName := strings.TrimSpace(req.Provider)
+	if providerName == "" {
+		providerName = parent.ProviderName
+	}
+	p := provider.GetProvider(providerName)
+	if p == nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderNotFound, provider.UnavailableError(providerName).Error())
+		return
+	}
+	if !provider.GetCapabilities(p).Upscale {
+		Error(c, http.StatusBadRequest, 400, "Provider "+providerName+" 不支持放大")
+		return
+	}
+
+	taskParams := map[string]interface{}{
+		"operation":   "upscale",
+		"source_path": localPath,
+		"scale":       req.Factor,
+	}
+	if modelID := strings.TrimSpace(req.ModelID); modelID != "" {
+		taskParams["model_id"] = modelID
+	}
+
+	snapshot, _ := json.Marshal(map[string]interface{}{
+		"provider":       providerName,
+		"model_id":       req.ModelID,
+		"source_task_id": parent.TaskID,
+		"scale":          req.Factor,
+	})
+	taskModel := &model.Task{
+		TaskID:         uuid.New().String(),
+		Prompt:         parent.Prompt,
+		ProviderName:   providerName,
+		ModelID:        strings.TrimSpace(req.ModelID),
+		TotalCount:     1,
+		Status:         "pending",
+		ConfigSnapshot: string(snapshot),
+		TaskType:       "upscale",
+		ParentTaskID:   parent.TaskID,
+		RootTaskID:     lineageRoot(&parent),
+		Private:        parent.Private,
+	}
+	if !submitTask(c, &worker.Task{TaskModel: taskModel, Params: taskParams}) {
+		return
+	}
+
+	Success(c, taskModel)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"image-gen-service/pkg/apitypes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inlineImagesField JSON 请求中以 base64 内联参考图的字段名
+const inlineImagesField = "reference_images_base64"
+
+// generateWithImagesJSON generate-with-images 的 JSON 请求体，字段名与 multipart 表单一致
+type generateWithImagesJSON = apitypes.GenerateWithImagesRequest
+
+// parseGenerateWithImagesRequest 按 Content-Type 解析图生图请求：JSON 走内联 base64，其余按 multipart 处理
+func parseGenerateWithImagesRequest(c *gin.Context) (*MultipartRequest, error) {
+	if isJSONRequest(c.Request) {
+		return parseGenerateRequestFromJSON(c)
+	}
+	return ParseGenerateRequestFromMultipart(c)
+}
+
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type"))), "application/json")
+}
+
+// parseGenerateRequestFromJSON 解析 JSON 图生图请求，转换为与 multipart 相同的 MultipartRequest；
+// 参考图解码后按与 multipart 相同的单文件、总量与类型限制校验
+func parseGenerateRequestFromJSON(c *gin.Context) (*MultipartRequest, error) {
+	limits := currentUploadLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, InlineUploadBodyLimit())
+
+	var body generateWithImagesJSON
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		if limitErr := asUploadError(err, limits); limitErr != nil {
+			return nil, limitErr
+		}
+		return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+
+	req := &MultipartRequest{
+		Provider:    body.Provider,
+		ModelID:     body.ModelID,
+		Prompt:      body.Prompt,
+		AspectRatio: body.AspectRatio,
+		ImageSize:   body.ImageSize,
+		Count:       jsonFormValue(body.Count),
+		Private:     jsonFormValue(body.Private),
+		AutoCancel:  jsonFormValue(body.AutoCancel),
+		RefPaths:    body.RefPaths,
+	}
+
+	budget := &uploadBudget{limits: limits}
+	for i, encoded := range body.RefImages {
+		name := fmt.Sprintf("#%d", i)
+		data, err := decodeInlineImage(encoded, name, limits)
+		if err != nil {
+			if limitErr := asUploadError(err, limits); limitErr != nil {
+				return nil, limitErr
+			}
+			return nil, fmt.Errorf("字段 %s 的第 %d 张图片解码失败: %w", inlineImagesField, i, err)
+		}
+		content, err := budget.readFile(bytes.NewReader(data), inlineImagesField, name)
+		if err != nil {
+			return nil, err
+		}
+		req.RefImages = append(req.RefImages, MultipartFile{Name: name, Content: content})
+	}
+	return req, nil
+}
+
+// decodeInlineImage 解码 data URL（data:image/png;base64,...）或裸 base64；
+// 解码前按编码长度预估大小，明显超过单文件上限时直接拒绝
+func decodeInlineImage(value, name string, limits uploadLimits) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "data:") {
+		meta, payload, ok := strings.Cut(value, ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, errors.New("data URL 必须为 base64 编码")
+		}
+		value = payload
+	}
+	if value == "" {
+		return nil, errors.New("内容为空")
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(value))) > limits.MaxFileBytes+3 {
+		return nil, errFileTooLarge(inlineImagesField, name, limits.MaxFileBytes)
+	}
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// jsonFormValue 把 JSON 字段值转换为与表单相同的字符串形式，缺省为空字符串
+func jsonFormValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
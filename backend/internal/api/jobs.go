@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 后台作业类型
+const (
+	jobTypeBackfillFileInfo = "backfill_file_info"
+	jobTypeRemoteSyncRetry  = "remote_sync_retry"
+	jobTypeRetention        = "retention"
+	jobTypePerceptualHash   = "perceptual_hash"
+
+	jobTypePendingDeletionRetry = "pending_deletion_retry"
+	jobTypeRemoteOrphanAudit    = "remote_orphan_audit"
+	jobTypeRegenerateThumbnails = "regenerate_thumbnails"
+)
+
+// RegisterJobs 注册维护类后台作业，需在 jobs.Start 之前调用
+func RegisterJobs() {
+	jobs.Register(jobTypeBackfillFileInfo, runFileInfoBackfill)
+	jobs.Register(jobTypeRemoteSyncRetry, runRemoteSyncRetry)
+	jobs.Register(jobTypeRetention, runRetention)
+	jobs.Register(jobTypePerceptualHash, runPerceptualHashBackfill)
+	jobs.Register(jobTypePendingDeletionRetry, runPendingDeletionRetry)
+	jobs.Register(jobTypeRemoteOrphanAudit, runRemoteOrphanAudit)
+	jobs.Register(jobTypeRegenerateThumbnails, runThumbnailRegeneration)
+}
+
+type createJobRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params"`
+}
+
+// CreateJobHandler 创建已注册类型的后台作业并排队
+func CreateJobHandler(c *gin.Context) {
+	var req createJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	var params interface{}
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		params = req.Params
+	}
+	enqueueJob(c, strings.TrimSpace(req.Type), params)
+}
+
+// ListJobsHandler 列出近期后台作业，可按类型与状态筛选
+func ListJobsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	list, err := jobs.List(strings.TrimSpace(c.Query("type")), strings.TrimSpace(c.Query("status")), limit)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询作业失败")
+		return
+	}
+	Success(c, gin.H{
+		"list":  list,
+		"types": jobs.Types(),
+	})
+}
+
+// GetJobHandler 返回后台作业的状态与进度
+func GetJobHandler(c *gin.Context) {
+	job, err := jobs.Get(c.Param("job_id"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeNotFound, "作业不存在")
+		return
+	}
+	Success(c, job)
+}
+
+// CancelJobHandler 取消排队中的作业，或通知运行中的作业停止
+func CancelJobHandler(c *gin.Context) {
+	job, err := jobs.Cancel(c.Param("job_id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeNotFound, "作业不存在")
+	case errors.Is(err, jobs.ErrFinished):
+		c.JSON(http.StatusConflict, Response{Code: 409, Message: err.Error(), Data: job, ErrorCode: model.ErrCodeConflict})
+	case err != nil:
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "取消作业失败")
+	default:
+		recordAudit(c, "job_cancel", gin.H{"job_id": job.JobID, "type": job.Type})
+		Success(c, job)
+	}
+}
+
+// enqueueJob 创建作业并返回作业记录；同类作业在排队或运行时返回 409 与该作业
+func enqueueJob(c *gin.Context, jobType string, params interface{}) (*model.Job, bool) {
+	job, err := jobs.Enqueue(jobType, params)
+	var active *jobs.ActiveError
+	switch {
+	case errors.As(err, &active):
+		c.JSON(http.StatusConflict, Response{Code: 409, Message: "同类作业正在运行", Data: active.Job, ErrorCode: model.ErrCodeConflict})
+		return nil, false
+	case errors.Is(err, jobs.ErrUnknownType):
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "未知的作业类型: "+jobType)
+		return nil, false
+	case err != nil:
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建作业失败")
+		return nil, false
+	}
+	recordAudit(c, "job_enqueue", gin.H{"job_id": job.JobID, "type": job.Type, "params": job.Params})
+	Success(c, job)
+	return job, true
+}
+
+// latestJobHandler 返回指定类型最近一次作业，供各维护接口的 GET 状态查询使用
+func latestJobHandler(jobType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := jobs.Latest(jobType)
+		if err != nil {
+			Success(c, nil)
+			return
+		}
+		Success(c, job)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"strings"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+const fileInfoBackfillBatchSize = 200
+
+// BackfillFileInfoHandler 启动后台作业，为已有任务补全文件大小与缺失的尺寸，同一时间只运行一个
+func BackfillFileInfoHandler(c *gin.Context) {
+	enqueueJob(c, jobTypeBackfillFileInfo, nil)
+}
+
+// BackfillFileInfoStatusHandler 返回最近一次补全作业的状态
+func BackfillFileInfoStatusHandler(c *gin.Context) {
+	latestJobHandler(jobTypeBackfillFileInfo)(c)
+}
+
+func fileInfoBackfillQuery() *gorm.DB {
+	return model.DB.Model(&model.Task{}).
+		Where("status IN ? AND local_path <> ''", finishedTaskStatuses).
+		Where("(file_size = 0 OR file_size IS NULL OR width = 0 OR height = 0)")
+}
+
+// runFileInfoBackfill 文件信息回填作业
+func runFileInfoBackfill(ctx context.Context, run *jobs.Run) error {
+	var total int64
+	if err := fileInfoBackfillQuery().Count(&total).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	var batch []model.Task
+	return fileInfoBackfillQuery().
+		Select("id", "task_id", "local_path", "width", "height", "file_size").
+		FindInBatches(&batch, fileInfoBackfillBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				run.Count(backfillTaskFileInfo(&batch[i]), 1)
+				run.Advance(1)
+			}
+			return nil
+		}).Error
+}
+
+// backfillTaskFileInfo 读取单个任务的本地文件并补齐大小与尺寸
+func backfillTaskFileInfo(task *model.Task) string {
+	path := strings.TrimSpace(task.LocalPath)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+
+	updates := map[string]interface{}{}
+	if task.FileSize != info.Size() {
+		updates["file_size"] = info.Size()
+	}
+	if task.Width == 0 || task.Height == 0 {
+		file, err := os.Open(path)
+		if err != nil {
+			return "failed"
+		}
+		cfg, _, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			log.Printf("[Maintenance] 任务 %s 解析图片尺寸失败: %v", task.TaskID, err)
+		} else {
+			updates["width"] = cfg.Width
+			updates["height"] = cfg.Height
+		}
+	}
+	if len(updates) == 0 {
+		return "skipped"
+	}
+	err = model.DB.Model(&model.Task{}).Where("id = ?", task.ID).Updates(updates).Error
+	InvalidateTask(task.TaskID)
+	if err != nil {
+		log.Printf("[Maintenance] 任务 %s 更新文件信息失败: %v", task.TaskID, err)
+		return "failed"
+	}
+	return "updated"
+}
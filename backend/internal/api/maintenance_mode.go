@@ -0,0 +1,116 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	settingMaintenanceEnabled = "maintenance.enabled"
+	settingMaintenanceMessage = "maintenance.message"
+)
+
+// maintenanceState 维护模式状态，持久化在 settings 表中，内存中保留一份避免每个请求查库
+type maintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+var (
+	maintenanceMu sync.RWMutex
+	maintenance   maintenanceState
+)
+
+type maintenanceRequest struct {
+	Message string `json:"message"`
+}
+
+// LoadMaintenanceMode 启动时从 settings 表恢复维护模式
+func LoadMaintenanceMode() {
+	enabled, _ := model.GetSetting(settingMaintenanceEnabled)
+	message, _ := model.GetSetting(settingMaintenanceMessage)
+	maintenanceMu.Lock()
+	maintenance = maintenanceState{Enabled: enabled == "true", Message: message}
+	maintenanceMu.Unlock()
+	if enabled == "true" {
+		log.Printf("[Maintenance] 服务处于维护模式，新的生成请求将被拒绝")
+	}
+}
+
+func currentMaintenance() maintenanceState {
+	maintenanceMu.RLock()
+	state := maintenance
+	maintenanceMu.RUnlock()
+	if state.Message == "" {
+		state.Message = config.Get().Maintenance.Message
+	}
+	return state
+}
+
+func setMaintenance(enabled bool, message string) error {
+	value := "false"
+	if enabled {
+		value = "true"
+	}
+	if err := model.SetSetting(settingMaintenanceEnabled, value); err != nil {
+		return err
+	}
+	if err := model.SetSetting(settingMaintenanceMessage, message); err != nil {
+		return err
+	}
+	maintenanceMu.Lock()
+	maintenance = maintenanceState{Enabled: enabled, Message: message}
+	maintenanceMu.Unlock()
+	return nil
+}
+
+// EnableMaintenanceHandler 开启维护模式：新的生成请求返回 503，排队与执行中的任务照常完成；可传入 message 覆盖配置的提示
+func EnableMaintenanceHandler(c *gin.Context) {
+	var req maintenanceRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	if err := setMaintenance(true, strings.TrimSpace(req.Message)); err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存维护模式失败")
+		return
+	}
+	state := currentMaintenance()
+	recordAudit(c, "maintenance_enable", state)
+	log.Printf("[Maintenance] 已开启维护模式: %s", state.Message)
+	Success(c, state)
+}
+
+// DisableMaintenanceHandler 关闭维护模式
+func DisableMaintenanceHandler(c *gin.Context) {
+	if err := setMaintenance(false, ""); err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存维护模式失败")
+		return
+	}
+	recordAudit(c, "maintenance_disable", gin.H{})
+	log.Printf("[Maintenance] 已关闭维护模式")
+	Success(c, currentMaintenance())
+}
+
+// RejectDuringMaintenance 挂在会产生新任务的接口上，维护模式下返回 503
+func RejectDuringMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := currentMaintenance()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "300")
+		ErrorWithCode(c, http.StatusServiceUnavailable, 503, model.ErrCodeMaintenance, state.Message)
+		c.Abort()
+	}
+}
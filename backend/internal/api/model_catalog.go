@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// modelCatalogTimeout 拉取上游模型列表的超时时间
+const modelCatalogTimeout = 30 * time.Second
+
+// modelCatalogRefreshing 正在后台刷新模型列表的 Provider，避免重复请求上游
+var modelCatalogRefreshing sync.Map
+
+// ListProviderModelsHandler 返回 Provider 的模型列表，并按元数据或名称标注可识别的能力。列表缓存在 Provider 记录中：
+// 缓存未过期直接返回，已过期先返回旧列表并在后台刷新，refresh=1 强制向上游拉取；上游失败时返回缓存并标记 stale=true
+func ListProviderModelsHandler(c *gin.Context) {
+	providerName := strings.TrimSpace(c.Param("name"))
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeProviderNotFound, "未找到指定的 Provider: "+providerName)
+		return
+	}
+
+	cached, hasCache := loadModelCatalogCache(&cfg)
+	forceRefresh := c.Query("refresh") == "1" || c.Query("refresh") == "true"
+	fresh := hasCache && cfg.ModelsCachedAt != nil && time.Since(*cfg.ModelsCachedAt) < modelCatalogTTL()
+
+	if hasCache && !forceRefresh {
+		if !fresh {
+			refreshModelCatalogAsync(cfg)
+		}
+		writeModelCatalog(c, &cfg, cached, !fresh, "")
+		return
+	}
+
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeProviderKeyMissing, "Provider API Key 未配置")
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), modelCatalogTimeout)
+	defer cancel()
+	entries, err := refreshModelCatalog(ctx, &cfg)
+	if err != nil {
+		if hasCache {
+			writeModelCatalog(c, &cfg, cached, true, formatOpenAIClientError(err))
+			return
+		}
+		Error(c, http.StatusBadGateway, 502, "获取模型列表失败: "+formatOpenAIClientError(err))
+		return
+	}
+	writeModelCatalog(c, &cfg, entries, false, "")
+}
+
+func writeModelCatalog(c *gin.Context, cfg *model.ProviderConfig, entries []provider.ModelEntry, stale bool, fetchErr string) {
+	data := gin.H{
+		"provider":   cfg.ProviderName,
+		"purpose":    provider.PurposeForProvider(cfg.ProviderName),
+		"models":     entries,
+		"fetched_at": cfg.ModelsCachedAt,
+		"stale":      stale,
+	}
+	if fetchErr != "" {
+		data["error"] = fetchErr
+	}
+	Success(c, data)
+}
+
+func modelCatalogTTL() time.Duration {
+	minutes := config.Get().ModelCatalog.CacheTTLMinutes
+	if minutes <= 0 {
+		minutes = 360
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func loadModelCatalogCache(cfg *model.ProviderConfig) ([]provider.ModelEntry, bool) {
+	if strings.TrimSpace(cfg.ModelsCache) == "" {
+		return nil, false
+	}
+	var entries []provider.ModelEntry
+	if err := json.Unmarshal([]byte(cfg.ModelsCache), &entries); err != nil {
+		return nil, false
+	}
+	return entries, true
+}
+
+// refreshModelCatalog 从上游拉取模型列表并写入缓存，同时更新 cfg 中的缓存字段
+func refreshModelCatalog(ctx context.Context, cfg *model.ProviderConfig) ([]provider.ModelEntry, error) {
+	var entries []provider.ModelEntry
+	var err error
+	if strings.HasPrefix(cfg.ProviderName, "gemini") {
+		entries, err = fetchGeminiModels(ctx, cfg)
+	} else {
+		entries, err = fetchOpenAIModels(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return entries, nil
+	}
+	now := time.Now()
+	if err := model.DB.Model(&model.ProviderConfig{}).Where("id = ?", cfg.ID).Updates(map[string]interface{}{
+		"models_cache":     string(data),
+		"models_cached_at": &now,
+	}).Error; err != nil {
+		log.Printf("[ModelCatalog] 写入 %s 模型列表缓存失败: %v", cfg.ProviderName, err)
+	}
+	cfg.ModelsCache = string(data)
+	cfg.ModelsCachedAt = &now
+	return entries, nil
+}
+
+// refreshModelCatalogAsync 在后台刷新过期的模型列表，同一 Provider 同时只刷新一次
+func refreshModelCatalogAsync(cfg model.ProviderConfig) {
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		return
+	}
+	if _, running := modelCatalogRefreshing.LoadOrStore(cfg.ProviderName, true); running {
+		return
+	}
+	go func() {
+		defer modelCatalogRefreshing.Delete(cfg.ProviderName)
+		ctx, cancel := context.WithTimeout(context.Background(), modelCatalogTimeout)
+		defer cancel()
+		if _, err := refreshModelCatalog(ctx, &cfg); err != nil {
+			log.Printf("[ModelCatalog] 后台刷新 %s 模型列表失败: %v", cfg.ProviderName, err)
+		}
+	}()
+}
+
+func fetchOpenAIModels(ctx context.Context, cfg *model.ProviderConfig, opts ...option.RequestOption) ([]provider.ModelEntry, error) {
+	client := provider.OpenAIChatClient(cfg)
+	page, err := client.Models.List(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]provider.ModelEntry, 0, len(page.Data))
+	for _, item := range page.Data {
+		if strings.TrimSpace(item.ID) == "" {
+			continue
+		}
+		entries = append(entries, provider.ModelEntry{
+			ID:           item.ID,
+			Name:         item.ID,
+			Capabilities: provider.DetectModelCapabilities(item.ID),
+		})
+	}
+	return entries, nil
+}
+
+func fetchGeminiModels(ctx context.Context, cfg *model.ProviderConfig) ([]provider.ModelEntry, error) {
+	client, err := provider.GeminiChatClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var entries []provider.ModelEntry
+	for item, err := range client.Models.All(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimPrefix(item.Name, "models/")
+		if id == "" {
+			continue
+		}
+		name := item.DisplayName
+		if name == "" {
+			name = id
+		}
+		entries = append(entries, provider.ModelEntry{
+			ID:           id,
+			Name:         name,
+			Capabilities: geminiModelCapabilities(id, item.SupportedActions),
+		})
+	}
+	return entries, nil
+}
+
+// geminiModelCapabilities 结合 supportedActions 判断能力：Imagen 走 predict，
+// 其余只有支持 generateContent 的模型才可用于生图或对话
+func geminiModelCapabilities(id string, actions []string) []provider.ModelPurpose {
+	var generate, predict bool
+	for _, action := range actions {
+		switch action {
+		case "generateContent":
+			generate = true
+		case "predict":
+			predict = true
+		}
+	}
+	capabilities := provider.DetectModelCapabilities(id)
+	if predict && strings.Contains(strings.ToLower(id), "imagen") {
+		return []provider.ModelPurpose{provider.PurposeImage}
+	}
+	if len(actions) > 0 && !generate {
+		return nil
+	}
+	return capabilities
+}
@@ -1,10 +1,11 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"strconv"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mazrean/formstream"
@@ -17,23 +18,28 @@ type MultipartFile struct {
 	Content []byte
 }
 
-// MultipartRequest 表示图生图请求解析后的数据
+// MultipartRequest 表示图生图请求解析后的数据，multipart 表单与 JSON 请求都转换为该结构
 type MultipartRequest struct {
 	Provider    string
 	ModelID     string
 	Prompt      string
 	AspectRatio string
 	ImageSize   string
-	Count       int
+	Count       string // 原始表单值，由 provider.ParseCount 解析
+	Private     string // 原始表单值，由 resolveTaskPrivate 解析
+	AutoCancel  string // 原始表单值 auto_cancel_on_disconnect，由 parseAutoCancel 解析
 	RefImages   []MultipartFile
 	RefPaths    []string
 }
 
 // ParseGenerateRequestFromMultipart 使用 formstream 解析图生图请求
 func ParseGenerateRequestFromMultipart(c *gin.Context) (*MultipartRequest, error) {
-	req := &MultipartRequest{
-		Count: 1, // 默认生成 1 张
-	}
+	req := &MultipartRequest{}
+
+	// 限制请求体总大小，formstream 与标准库回退路径共用
+	limits := currentUploadLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxTotalBytes+uploadFormOverhead)
+	budget := &uploadBudget{limits: limits}
 
 	p, err := ginform.NewParser(c)
 	if err != nil {
@@ -86,9 +92,23 @@ func ParseGenerateRequestFromMultipart(c *gin.Context) (*MultipartRequest, error
 		if err != nil {
 			return err
 		}
-		if count, err := strconv.Atoi(string(data)); err == nil {
-			req.Count = count
+		req.Count = string(data)
+		return nil
+	})
+	p.Parser.Register("private", func(reader io.Reader, header formstream.Header) error {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		req.Private = string(data)
+		return nil
+	})
+	p.Parser.Register("auto_cancel_on_disconnect", func(reader io.Reader, header formstream.Header) error {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
 		}
+		req.AutoCancel = string(data)
 		return nil
 	})
 	p.Parser.Register("refPaths", func(reader io.Reader, header formstream.Header) error {
@@ -102,9 +122,9 @@ func ParseGenerateRequestFromMultipart(c *gin.Context) (*MultipartRequest, error
 
 	// 注册文件处理器 (匹配前端的 refImages)
 	p.Parser.Register("refImages", func(reader io.Reader, header formstream.Header) error {
-		content, err := io.ReadAll(reader)
+		content, err := budget.readFile(reader, "refImages", header.FileName())
 		if err != nil {
-			return fmt.Errorf("读取文件失败: %w", err)
+			return err
 		}
 		req.RefImages = append(req.RefImages, MultipartFile{
 			Name:    header.FileName(),
@@ -115,17 +135,24 @@ func ParseGenerateRequestFromMultipart(c *gin.Context) (*MultipartRequest, error
 
 	// 执行解析
 	if err := p.Parse(); err != nil {
+		// 超出上传限制或文件类型不符时直接返回，不再回退
+		if limitErr := asUploadError(err, limits); limitErr != nil {
+			return nil, limitErr
+		}
 		// 如果 formstream 解析失败，尝试回退到标准库
 		log.Printf("[回退] formstream 解析失败: %v, 尝试使用标准库\n", err)
-		return parseWithStandardLibrary(c)
+		return parseWithStandardLibrary(c, limits)
 	}
 
 	return req, nil
 }
 
 // parseWithStandardLibrary 标准库回退解析逻辑
-func parseWithStandardLibrary(c *gin.Context) (*MultipartRequest, error) {
+func parseWithStandardLibrary(c *gin.Context, limits uploadLimits) (*MultipartRequest, error) {
 	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		if limitErr := asUploadError(err, limits); limitErr != nil {
+			return nil, limitErr
+		}
 		return nil, fmt.Errorf("解析表单失败: %w", err)
 	}
 
@@ -135,19 +162,23 @@ func parseWithStandardLibrary(c *gin.Context) (*MultipartRequest, error) {
 		Prompt:      c.PostForm("prompt"),
 		AspectRatio: c.PostForm("aspectRatio"),
 		ImageSize:   c.PostForm("imageSize"),
-		Count:       1,
-	}
-
-	if countStr := c.PostForm("count"); countStr != "" {
-		if count, err := strconv.Atoi(countStr); err == nil {
-			req.Count = count
-		}
+		Count:       c.PostForm("count"),
+		Private:     c.PostForm("private"),
+		AutoCancel:  c.PostForm("auto_cancel_on_disconnect"),
+		RefPaths:    c.PostFormArray("refPaths"),
 	}
 
 	form, err := c.MultipartForm()
 	if err == nil && form.File != nil {
 		files := form.File["refImages"]
+		var total int64
 		for _, fileHeader := range files {
+			if fileHeader.Size > limits.MaxFileBytes {
+				return nil, errFileTooLarge("refImages", fileHeader.Filename, limits.MaxFileBytes)
+			}
+			if total += fileHeader.Size; total > limits.MaxTotalBytes {
+				return nil, errTotalTooLarge(limits.MaxTotalBytes)
+			}
 			file, err := fileHeader.Open()
 			if err != nil {
 				continue
@@ -157,6 +188,9 @@ func parseWithStandardLibrary(c *gin.Context) (*MultipartRequest, error) {
 			if err != nil {
 				continue
 			}
+			if err := validateImageContent("refImages", fileHeader.Filename, content); err != nil {
+				return nil, err
+			}
 			req.RefImages = append(req.RefImages, MultipartFile{
 				Name:    fileHeader.Filename,
 				Content: content,
@@ -166,3 +200,16 @@ func parseWithStandardLibrary(c *gin.Context) (*MultipartRequest, error) {
 
 	return req, nil
 }
+
+// asUploadError 识别解析过程中的上传限制错误，其他错误返回 nil
+func asUploadError(err error, limits uploadLimits) *uploadError {
+	var limitErr *uploadError
+	if errors.As(err, &limitErr) {
+		return limitErr
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errTotalTooLarge(limits.MaxTotalBytes)
+	}
+	return nil
+}
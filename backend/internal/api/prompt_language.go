@@ -0,0 +1,125 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+
+	"image-gen-service/internal/config"
+)
+
+// promptLanguageReinforcements 语言代码 -> 输出语言强调语（用该语言书写，弱模型更容易遵守）
+var promptLanguageReinforcements = map[string]string{
+	"zh": "请使用与用户输入相同的中文（简体或繁体）输出优化后的提示词。",
+	"ja": "最適化したプロンプトは必ず日本語のみで出力してください。",
+	"ko": "최적화된 프롬프트는 반드시 한국어로만 출력하세요.",
+	"ru": "Выводите оптимизированный промпт только на русском языке.",
+	"ar": "اكتب الموجه المحسّن باللغة العربية فقط.",
+	"en": "Respond in English only.",
+	"fr": "Répondez uniquement en français.",
+	"de": "Antworten Sie ausschließlich auf Deutsch.",
+	"es": "Responde únicamente en español.",
+	"it": "Rispondi esclusivamente in italiano.",
+	"pt": "Responda apenas em português.",
+}
+
+// latinStopwords 拉丁字母语言的常见虚词，用于区分英语与其他西欧语言
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "with", "of", "a", "in", "on", "is", "for", "an"},
+	"fr": {"le", "la", "les", "et", "avec", "des", "une", "un", "du", "dans"},
+	"de": {"der", "die", "das", "und", "mit", "ein", "eine", "im", "auf", "ist"},
+	"es": {"el", "los", "las", "y", "con", "una", "del", "en", "por", "un"},
+	"it": {"il", "gli", "e", "con", "una", "della", "di", "nel", "un", "sul"},
+	"pt": {"o", "os", "e", "com", "uma", "do", "da", "em", "no", "um"},
+}
+
+// detectPromptLanguage 按字符所属文字粗略判断提示词的主要语言，无法判断时返回 en。
+// 含假名判为日语，否则汉字占多数判为中文；拉丁字母文本再按常见虚词区分西欧语言
+func detectPromptLanguage(text string) string {
+	var han, kana, hangul, cyrillic, arabic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// JSON 提示词的键名是英文，汉字、假名等按字符计数时需要放宽占比要求
+	cjk := han + kana
+	switch {
+	case kana > 0 && kana*10 >= cjk:
+		return "ja"
+	case hangul > 0 && hangul*3 >= latin:
+		return "ko"
+	case han > 0 && han*3 >= latin:
+		return "zh"
+	case cyrillic > latin:
+		return "ru"
+	case arabic > latin:
+		return "ar"
+	}
+	return detectLatinLanguage(text)
+}
+
+// normalizePromptLanguage 只保留主语言代码，如 zh-CN -> zh、en_US -> en
+func normalizePromptLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+func detectLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	counts := make(map[string]int, len(words))
+	for _, w := range words {
+		counts[w]++
+	}
+	best, bestScore := "en", 0
+	for _, lang := range []string{"en", "fr", "de", "es", "it", "pt"} {
+		score := 0
+		for _, w := range latinStopwords[lang] {
+			score += counts[w]
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
+
+// getOptimizeSystemPromptFor 按语言选择优化系统提示词：英文使用 optimize_system_en / optimize_system_json_en，
+// 其余语言沿用 optimize_system / optimize_system_json；末尾追加用目标语言书写的输出语言强调
+func getOptimizeSystemPromptFor(language string, forceJSON bool) string {
+	var prompt string
+	switch {
+	case language == "en" && forceJSON:
+		prompt = strings.TrimSpace(config.Get().Prompts.OptimizeSystemJSONEN)
+		if prompt == "" {
+			prompt = config.DefaultOptimizeSystemJSONPromptEN
+		}
+	case language == "en":
+		prompt = strings.TrimSpace(config.Get().Prompts.OptimizeSystemEN)
+		if prompt == "" {
+			prompt = config.DefaultOptimizeSystemPromptEN
+		}
+	default:
+		prompt = getOptimizeSystemPrompt(forceJSON)
+	}
+	if reinforcement := promptLanguageReinforcements[language]; reinforcement != "" {
+		prompt = strings.TrimSpace(prompt) + "\n\n" + reinforcement
+	}
+	return prompt
+}
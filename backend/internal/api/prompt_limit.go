@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/provider"
+)
+
+// promptSentenceEnds 截断时优先停在这些字符之后，避免把一句话截成半句
+const promptSentenceEnds = "。！？；.!?;\n"
+
+// promptLimit 提示词字符数上限：Provider 声明的上限优先，其次为 prompts.max_length，0 表示不限制
+func promptLimit(p provider.Provider) int {
+	if limit := provider.GetCapabilities(p).MaxPromptLength; limit > 0 {
+		return limit
+	}
+	return config.Get().Prompts.MaxLength
+}
+
+// limitPrompt 检查提示词长度；超出上限时按 prompts.auto_truncate 截断（truncated 为 true），
+// 否则返回以 prompt 字段标注的 ValidationError
+func limitPrompt(p provider.Provider, prompt string) (string, bool, error) {
+	limit := promptLimit(p)
+	length := utf8.RuneCountInString(prompt)
+	if limit <= 0 || length <= limit {
+		return prompt, false, nil
+	}
+	if !config.Get().Prompts.AutoTruncate {
+		verr := &provider.ValidationError{}
+		verr.Add("prompt", fmt.Sprintf("提示词长度 %d 超过上限 %d 字符，请精简后重试", length, limit), nil, length)
+		return "", false, verr
+	}
+	return truncatePrompt(prompt, limit), true, nil
+}
+
+// truncatePrompt 截断到 limit 个字符以内，后半段有句子结束符时停在最后一个结束符之后
+func truncatePrompt(prompt string, limit int) string {
+	runes := []rune(prompt)
+	if len(runes) <= limit {
+		return prompt
+	}
+	cut := runes[:limit]
+	for i := len(cut) - 1; i >= limit/2; i-- {
+		if strings.ContainsRune(promptSentenceEnds, cut[i]) {
+			cut = cut[:i+1]
+			break
+		}
+	}
+	return strings.TrimSpace(string(cut))
+}
+
+// checkOptimizeInput 提示词优化接口的输入上限（prompts.max_optimize_input），超出时直接拒绝
+func checkOptimizeInput(text string) error {
+	limit := config.Get().Prompts.MaxOptimizeInput
+	if limit <= 0 {
+		return nil
+	}
+	if length := utf8.RuneCountInString(text); length > limit {
+		return fmt.Errorf("待优化的提示词长度 %d 超过上限 %d 字符", length, limit)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/pkg/apitypes"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	similarCandidateLimit = 500
+	similarDefaultLimit   = 10
+	similarMaxLimit       = 50
+	// similarKeywordCount 用于缩小候选集的关键词数量
+	similarKeywordCount = 3
+)
+
+// similarPrompt 与当前提示词相近的历史任务
+type similarPrompt = apitypes.SimilarPrompt
+
+// SimilarPromptsHandler 返回提示词与给定内容相近的近期已完成任务，供前端提交前提示重复生成
+func SimilarPromptsHandler(c *gin.Context) {
+	prompt := strings.TrimSpace(c.Query("prompt"))
+	if prompt == "" {
+		Error(c, http.StatusBadRequest, 400, "prompt 不能为空")
+		return
+	}
+	threshold := similarThreshold()
+	if v, err := strconv.ParseFloat(c.Query("threshold"), 64); err == nil && v > 0 && v <= 1 {
+		threshold = v
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = similarDefaultLimit
+	} else if limit > similarMaxLimit {
+		limit = similarMaxLimit
+	}
+
+	Success(c, gin.H{
+		"threshold": threshold,
+		"list":      findSimilarPrompts(prompt, threshold, limit),
+	})
+}
+
+func similarThreshold() float64 {
+	threshold := config.Get().SimilarPrompts.Threshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 0.75
+	}
+	return threshold
+}
+
+// findSimilarPrompts 先用关键词 LIKE 在回溯期内缩小候选集，再在内存中计算三元组相似度
+func findSimilarPrompts(prompt string, threshold float64, limit int) []similarPrompt {
+	normalized := normalizePrompt(prompt)
+	if normalized == "" {
+		return []similarPrompt{}
+	}
+
+	query := model.DB.Model(&model.Task{}).
+		Select("task_id", "prompt", "thumbnail_path", "thumbnail_url", "local_path", "created_at").
+		Where("status IN ? AND archived_at IS NULL", finishedTaskStatuses)
+	if days := config.Get().SimilarPrompts.LookbackDays; days > 0 {
+		query = query.Where("created_at >= ?", time.Now().AddDate(0, 0, -days))
+	}
+	if keywords := promptKeywords(normalized, similarKeywordCount); len(keywords) > 0 {
+		conditions := make([]string, 0, len(keywords))
+		args := make([]interface{}, 0, len(keywords))
+		for _, keyword := range keywords {
+			conditions = append(conditions, "LOWER(prompt) LIKE ?")
+			args = append(args, "%"+keyword+"%")
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	var candidates []model.Task
+	if err := query.Order("created_at DESC").Limit(similarCandidateLimit).Find(&candidates).Error; err != nil {
+		return []similarPrompt{}
+	}
+
+	target := trigrams(normalized)
+	matches := make([]similarPrompt, 0)
+	for _, task := range candidates {
+		score := jaccard(target, trigrams(normalizePrompt(task.Prompt)))
+		if score < threshold {
+			continue
+		}
+		matches = append(matches, similarPrompt{
+			TaskID:        task.TaskID,
+			Prompt:        task.Prompt,
+			Similarity:    float64(int(score*1000)) / 1000,
+			ThumbnailPath: task.ThumbnailPath,
+			ThumbnailURL:  task.ThumbnailURL.Public(),
+			ThumbnailSrc:  task.ThumbnailSrc,
+			LocalPath:     task.LocalPath,
+			CreatedAt:     task.CreatedAt,
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Similarity > matches[j].Similarity })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// normalizePrompt 统一大小写，标点视为空白并合并连续空白
+func normalizePrompt(prompt string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(prompt) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space && b.Len() > 0 {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// promptKeywords 取最长的若干个词作为候选集过滤条件；中日韩文本没有空格分词，取较长片段的前缀
+func promptKeywords(normalized string, n int) []string {
+	words := strings.Fields(normalized)
+	sort.SliceStable(words, func(i, j int) bool { return len([]rune(words[i])) > len([]rune(words[j])) })
+	keywords := make([]string, 0, n)
+	seen := make(map[string]bool)
+	for _, word := range words {
+		runes := []rune(word)
+		if len(runes) < 3 {
+			break
+		}
+		if len(runes) > 6 {
+			word = string(runes[:6])
+		}
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		keywords = append(keywords, word)
+		if len(keywords) == n {
+			break
+		}
+	}
+	return keywords
+}
+
+// trigrams 按字符（rune）切分的三元组集合，对中英文都适用
+func trigrams(s string) map[string]struct{} {
+	runes := []rune(" " + s + " ")
+	set := make(map[string]struct{}, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = struct{}{}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	intersection := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBudgetOverrideMinutes 临时解除预算限制的最长时间
+const maxBudgetOverrideMinutes = 24 * 60
+
+type budgetOverrideRequest struct {
+	// Minutes 解除限制的分钟数，0 表示取消解除
+	Minutes int `json:"minutes"`
+}
+
+// rejectOverBudget 返回 429 与预算重置时间
+func rejectOverBudget(c *gin.Context, providerName string, err error) {
+	status, _ := worker.ProviderBudget(providerName, "")
+	data := gin.H{"provider": providerName}
+	if status != nil {
+		retryAfter := int(math.Ceil(time.Until(status.ResetAt).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		data["reset_at"] = status.ResetAt
+		data["budget"] = status
+	}
+	log.Printf("[Budget] 拒绝任务: %v", err)
+	c.JSON(http.StatusTooManyRequests, Response{
+		Code:      429,
+		Message:   err.Error(),
+		ErrorCode: model.ErrCodeBudgetExceeded,
+		Data:      data,
+	})
+}
+
+// ListProviderBudgetsHandler 返回各 Provider 今日用量与剩余预算
+func ListProviderBudgetsHandler(c *gin.Context) {
+	var names []string
+	if err := model.DB.Model(&model.ProviderConfig{}).Order("provider_name").Pluck("provider_name", &names).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询 Provider 配置失败")
+		return
+	}
+	budgets := make([]*worker.BudgetStatus, 0, len(names))
+	for _, name := range names {
+		status, err := worker.ProviderBudget(name, "")
+		if err != nil {
+			log.Printf("[Budget] 统计 Provider %s 用量失败: %v", name, err)
+			continue
+		}
+		budgets = append(budgets, status)
+	}
+	Success(c, budgets)
+}
+
+// OverrideProviderBudgetHandler 在指定分钟数内解除 Provider 的每日预算限制，minutes=0 恢复限制；覆盖只保存在内存中
+func OverrideProviderBudgetHandler(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	var req budgetOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if req.Minutes < 0 || req.Minutes > maxBudgetOverrideMinutes {
+		Error(c, http.StatusBadRequest, 400, "minutes 需在 0 到 "+strconv.Itoa(maxBudgetOverrideMinutes)+" 之间")
+		return
+	}
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", name).First(&cfg).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeProviderNotFound, "未找到指定的 Provider: "+name)
+		return
+	}
+
+	var until time.Time
+	if req.Minutes > 0 {
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	}
+	worker.OverrideBudget(name, until)
+	recordAudit(c, "provider_budget_override", gin.H{"provider": name, "minutes": req.Minutes})
+	if until.IsZero() {
+		log.Printf("[Budget] 已恢复 Provider %s 的预算限制", name)
+	} else {
+		log.Printf("[Budget] 已临时解除 Provider %s 的预算限制，至 %s", name, until.Format(time.RFC3339))
+	}
+
+	status, err := worker.ProviderBudget(name, "")
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "统计 Provider 用量失败")
+		return
+	}
+	Success(c, status)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+func loadProviderConfig(t *testing.T, name string) model.ProviderConfig {
+	t.Helper()
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", name).First(&cfg).Error; err != nil {
+		t.Fatalf("读取 Provider 配置失败: %v", err)
+	}
+	return cfg
+}
+
+// TestPatchProviderConfigKeepsOmittedFields PATCH 只修改请求中出现的字段，未传的字段保持原值
+func TestPatchProviderConfigKeepsOmittedFields(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	const route = "/api/v1/providers/config"
+	rec := performJSON(t, http.MethodPost, route, route, map[string]interface{}{
+		"provider_name":   "openai",
+		"display_name":    "OpenAI 兼容",
+		"api_base":        "http://127.0.0.1:1/v1",
+		"api_key":         "sk-original",
+		"model_id":        "gpt-image-1",
+		"timeout_seconds": 120,
+		"enabled":         true,
+	}, UpdateProviderConfigHandler)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("创建配置失败 %d: %s", rec.Code, rec.Body.String())
+	}
+	original := loadProviderConfig(t, "openai")
+
+	cases := []struct {
+		name   string
+		body   map[string]interface{}
+		expect func(cfg *model.ProviderConfig)
+	}{
+		{
+			name:   "只修改启用状态",
+			body:   map[string]interface{}{"enabled": false},
+			expect: func(cfg *model.ProviderConfig) { cfg.Enabled = false },
+		},
+		{
+			name:   "只修改超时",
+			body:   map[string]interface{}{"timeout_seconds": 300},
+			expect: func(cfg *model.ProviderConfig) { cfg.TimeoutSeconds = 300 },
+		},
+		{
+			name:   "只修改模型",
+			body:   map[string]interface{}{"model_id": "dall-e-3"},
+			expect: func(cfg *model.ProviderConfig) { cfg.Models = buildModelsJSON("openai", "dall-e-3", "") },
+		},
+	}
+	want := original
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := map[string]interface{}{"provider_name": "openai"}
+			for k, v := range tc.body {
+				body[k] = v
+			}
+			rec := performJSON(t, http.MethodPatch, route, route, body, UpdateProviderConfigHandler)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("PATCH 失败 %d: %s", rec.Code, rec.Body.String())
+			}
+			tc.expect(&want)
+			got := loadProviderConfig(t, "openai")
+			if got.DisplayName != want.DisplayName || got.APIBase != want.APIBase || got.APIKey != want.APIKey ||
+				got.Models != want.Models || got.Enabled != want.Enabled || got.TimeoutSeconds != want.TimeoutSeconds ||
+				got.DefaultParams != want.DefaultParams {
+				t.Fatalf("PATCH 后配置 = %+v\n期望 %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProviderDebugHandler 返回 extra_config.debug_capture 开启后保留的 Provider 请求 / 响应记录（按时间正序），密钥已脱敏，图片数据替换为大小占位；访问条件同 TaskDebugHandler
+func ProviderDebugHandler(c *gin.Context) {
+	if !debugAccessAllowed(c.Request) {
+		ErrorWithCode(c, http.StatusForbidden, 403, model.ErrCodeUnauthorized, "调试接口未开启或 API Token 无效")
+		return
+	}
+	name := strings.TrimSpace(c.Param("name"))
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", name).First(&cfg).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeProviderNotFound, "未找到指定的 Provider: "+name)
+		return
+	}
+	captures, capacity, enabled := provider.DebugCaptures(name)
+	if captures == nil {
+		captures = []provider.DebugCapture{}
+	}
+	Success(c, gin.H{
+		"provider": name,
+		"enabled":  enabled,
+		"capacity": capacity,
+		"list":     captures,
+	})
+}
+
+// TaskDebugHandler 返回任务失败时保存的脱敏上游原始响应（省略图片数据，截断至 64KB）及 Provider 调试记录，访问条件见 debugAccessAllowed
+func TaskDebugHandler(c *gin.Context) {
+	if !debugAccessAllowed(c.Request) {
+		ErrorWithCode(c, http.StatusForbidden, 403, model.ErrCodeUnauthorized, "调试接口未开启或 API Token 无效")
+		return
+	}
+	var task model.Task
+	if err := model.DB.Select("task_id", "status", "provider_name", "error_code", "error_message", "debug_response", "provider_debug").
+		Where("task_id = ?", c.Param("task_id")).First(&task).Error; err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
+		return
+	}
+	var captures json.RawMessage
+	if task.ProviderDebug != "" && json.Valid([]byte(task.ProviderDebug)) {
+		captures = json.RawMessage(task.ProviderDebug)
+	}
+	Success(c, gin.H{
+		"task_id":        task.TaskID,
+		"status":         task.Status,
+		"provider":       task.ProviderName,
+		"error_code":     task.ErrorCode,
+		"error_message":  task.ErrorMessage,
+		"debug_response": task.DebugResponse,
+		"provider_debug": captures,
+	})
+}
+
+// debugAccessAllowed 配置了 API Token 时凭 Token 访问调试接口，否则需开启 observability.debug_endpoints
+func debugAccessAllowed(r *http.Request) bool {
+	cfg := config.Get()
+	if strings.TrimSpace(cfg.Server.APIToken) != "" {
+		return checkAPIToken(r)
+	}
+	return cfg.Observability.DebugEndpoints
+}
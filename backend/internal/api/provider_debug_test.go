@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+// TestProviderDebugOnlyFromDebugEndpoint 失败任务的上游抓包记录不随任务详情返回，
+// 只能经过访问校验的 /tasks/:id/debug 读取
+func TestProviderDebugOnlyFromDebugEndpoint(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	task := testutil.CreateTask(t, &model.Task{
+		TaskID:        "debug-capture",
+		Status:        "failed",
+		ProviderDebug: `[{"request":"secret-body"}]`,
+	})
+	InvalidateTask(task.TaskID)
+
+	rec := performJSON(t, http.MethodGet, "/api/v1/tasks/:task_id", "/api/v1/tasks/"+task.TaskID, nil, GetTaskHandler)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("查询任务详情 %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "provider_debug") || strings.Contains(body, "secret-body") {
+		t.Fatalf("任务详情包含抓包记录: %s", body)
+	}
+
+	debugPath := "/api/v1/tasks/" + task.TaskID + "/debug"
+	if rec := performJSON(t, http.MethodGet, "/api/v1/tasks/:task_id/debug", debugPath, nil, TaskDebugHandler); rec.Code != http.StatusForbidden {
+		t.Fatalf("调试接口未开启时返回 %d，期望 403", rec.Code)
+	}
+	previous := config.Get()
+	t.Cleanup(func() { config.Set(previous) })
+	testutil.SetConfig(func(cfg *config.Config) { cfg.Observability.DebugEndpoints = true })
+	rec = performJSON(t, http.MethodGet, "/api/v1/tasks/:task_id/debug", debugPath, nil, TaskDebugHandler)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "secret-body") {
+		t.Fatalf("调试接口 %d: %s", rec.Code, rec.Body.String())
+	}
+}
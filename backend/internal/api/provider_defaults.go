@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+)
+
+// defaultParamAliases 同一参数的多种命名，请求中出现任一别名即视为已指定
+var defaultParamAliases = [][]string{
+	{"aspect_ratio", "aspectRatio", "aspect"},
+	{"resolution_level", "imageSize", "image_size"},
+}
+
+// reservedDefaultParams 由请求本身决定的参数，不允许配置默认值
+var reservedDefaultParams = map[string]bool{
+	"prompt":           true,
+	"provider":         true,
+	"model_id":         true,
+	"reference_images": true,
+	"messages":         true,
+}
+
+// normalizeDefaultParams 校验 Provider 默认生成参数并返回紧凑的 JSON；null 或空对象表示清除。
+// 列表接口以字符串返回该字段，因此也接受 JSON 字符串形式，便于原样回传
+func normalizeDefaultParams(providerName string, raw json.RawMessage) (string, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if strings.HasPrefix(trimmed, `"`) {
+		var encoded string
+		if err := json.Unmarshal([]byte(trimmed), &encoded); err != nil {
+			return "", fmt.Errorf("default_params 必须是 JSON 对象")
+		}
+		trimmed = strings.TrimSpace(encoded)
+	}
+	if trimmed == "" || trimmed == "null" {
+		return "", nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &params); err != nil || params == nil {
+		return "", fmt.Errorf("default_params 必须是 JSON 对象")
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	for key := range params {
+		if reservedDefaultParams[key] {
+			return "", fmt.Errorf("default_params 不能包含 %s", key)
+		}
+	}
+	if raw, ok := params["timeout_seconds"]; ok {
+		if seconds, isNumber := raw.(float64); !isNumber || seconds <= 0 || seconds != float64(int(seconds)) {
+			return "", fmt.Errorf("default_params.timeout_seconds 必须是正整数")
+		}
+	}
+
+	// 以占位提示词走一遍与生成接口相同的校验，避免保存后每次生成都失败
+	probe := map[string]interface{}{"prompt": "default params"}
+	for key, value := range params {
+		probe[key] = value
+	}
+	var providerErr error
+	if p := provider.GetProvider(providerName); p != nil {
+		providerErr = p.ValidateParams(probe)
+	}
+	if err := provider.JoinValidationErrors(providerErr, worker.ValidateAspectParams(probe)); err != nil {
+		return "", fmt.Errorf("default_params 无效: %w", err)
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// applyDefaultParams 将 Provider 配置的默认参数合并到请求参数之下，请求中已指定的值优先
+func applyDefaultParams(cfg *model.ProviderConfig, params map[string]interface{}) {
+	if cfg == nil || strings.TrimSpace(cfg.DefaultParams) == "" {
+		return
+	}
+	var defaults map[string]interface{}
+	if err := json.Unmarshal([]byte(cfg.DefaultParams), &defaults); err != nil {
+		log.Printf("[API] Provider %s 的默认参数解析失败: %v", cfg.ProviderName, err)
+		return
+	}
+	for key, value := range defaults {
+		if reservedDefaultParams[key] || paramSpecified(params, key) {
+			continue
+		}
+		params[key] = value
+	}
+}
+
+// paramSpecified 请求中是否已给出该参数（含别名），空字符串视为未指定
+func paramSpecified(params map[string]interface{}, key string) bool {
+	keys := []string{key}
+	for _, group := range defaultParamAliases {
+		for _, alias := range group {
+			if alias == key {
+				keys = group
+				break
+			}
+		}
+	}
+	for _, k := range keys {
+		value, ok := params[k]
+		if !ok || value == nil {
+			continue
+		}
+		if s, isString := value.(string); isString && strings.TrimSpace(s) == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
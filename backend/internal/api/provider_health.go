@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/openai/openai-go/v3/option"
+)
+
+// providerHealthCheckTimeout 单次健康检查的超时时间
+const providerHealthCheckTimeout = 20 * time.Second
+
+// providerHealthStatus Provider 最近一次健康检查的结果，仅保存在内存中
+type providerHealthStatus struct {
+	LastCheckAt         *time.Time `json:"last_check_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LatencyMs           int64      `json:"latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// Degraded 连续失败次数达到阈值后置为 true，下一次检查成功即恢复
+	Degraded bool `json:"degraded"`
+}
+
+var (
+	providerHealthMu sync.RWMutex
+	providerHealth   = make(map[string]*providerHealthStatus)
+)
+
+// StartProviderHealthMonitor 按配置周期性检查已启用的 Provider；未开启时不启动
+func StartProviderHealthMonitor() {
+	cfg := config.Get().ProviderHealth
+	if !cfg.Enabled {
+		return
+	}
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	if interval < 30*time.Second {
+		interval = 30 * time.Second
+	}
+	log.Printf("[ProviderHealth] 已开启: 每 %s 检查一次, 连续失败 %d 次标记为降级", interval, providerHealthThreshold())
+	go func() {
+		for {
+			checkProviders()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func providerHealthThreshold() int {
+	if threshold := config.Get().ProviderHealth.FailureThreshold; threshold > 0 {
+		return threshold
+	}
+	return 3
+}
+
+// checkProviders 依次检查已启用且配置了 API Key 的 Provider，使用模型列表接口作为轻量探测
+func checkProviders() {
+	var configs []model.ProviderConfig
+	if err := model.DB.Where("enabled = ?", true).Find(&configs).Error; err != nil {
+		log.Printf("[ProviderHealth] 查询 Provider 配置失败: %v", err)
+		return
+	}
+	for i := range configs {
+		cfg := &configs[i]
+		if strings.TrimSpace(cfg.APIKey) == "" || !supportsModelCatalog(cfg.ProviderName) {
+			continue
+		}
+		startedAt := time.Now()
+		err := probeProvider(cfg)
+		recordProviderHealth(cfg.ProviderName, time.Since(startedAt), err)
+	}
+}
+
+func supportsModelCatalog(providerName string) bool {
+	return strings.HasPrefix(providerName, "gemini") || strings.HasPrefix(providerName, "openai") ||
+		strings.HasPrefix(providerName, "deepseek")
+}
+
+func probeProvider(cfg *model.ProviderConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), providerHealthCheckTimeout)
+	defer cancel()
+	var err error
+	if strings.HasPrefix(cfg.ProviderName, "gemini") {
+		_, err = fetchGeminiModels(ctx, cfg)
+	} else {
+		// 探测不重试，以便如实反映单次请求的延迟与失败
+		_, err = fetchOpenAIModels(ctx, cfg, option.WithMaxRetries(0))
+	}
+	return err
+}
+
+func recordProviderHealth(providerName string, latency time.Duration, err error) {
+	now := time.Now()
+	providerHealthMu.Lock()
+	defer providerHealthMu.Unlock()
+
+	status := providerHealth[providerName]
+	if status == nil {
+		status = &providerHealthStatus{}
+		providerHealth[providerName] = status
+	}
+	status.LastCheckAt = &now
+	status.LatencyMs = latency.Milliseconds()
+	if err == nil {
+		if status.Degraded {
+			log.Printf("[ProviderHealth] %s 已恢复", providerName)
+		}
+		status.LastSuccessAt = &now
+		status.LastError = ""
+		status.ConsecutiveFailures = 0
+		status.Degraded = false
+		return
+	}
+
+	status.LastFailureAt = &now
+	status.LastError = formatOpenAIClientError(err)
+	status.ConsecutiveFailures++
+	if !status.Degraded && status.ConsecutiveFailures >= providerHealthThreshold() {
+		status.Degraded = true
+		log.Printf("[ProviderHealth] %s 连续 %d 次检查失败，标记为降级: %s", providerName, status.ConsecutiveFailures, status.LastError)
+	}
+}
+
+// getProviderHealth 返回指定 Provider 的健康状态副本，尚未检查过时返回 nil
+func getProviderHealth(providerName string) *providerHealthStatus {
+	providerHealthMu.RLock()
+	defer providerHealthMu.RUnlock()
+	status, ok := providerHealth[providerName]
+	if !ok {
+		return nil
+	}
+	copied := *status
+	return &copied
+}
+
+// providerHealthSnapshot 返回全部 Provider 健康状态的副本
+func providerHealthSnapshot() map[string]providerHealthStatus {
+	providerHealthMu.RLock()
+	defer providerHealthMu.RUnlock()
+	snapshot := make(map[string]providerHealthStatus, len(providerHealth))
+	for name, status := range providerHealth {
+		snapshot[name] = *status
+	}
+	return snapshot
+}
+
+// providerDegradedWarning Provider 已降级时返回提示文本，否则返回空字符串
+func providerDegradedWarning(providerName string) string {
+	status := getProviderHealth(providerName)
+	if status == nil || !status.Degraded {
+		return ""
+	}
+	return fmt.Sprintf("Provider %s 最近 %d 次健康检查失败（%s），任务可能失败或耗时较长", providerName, status.ConsecutiveFailures, status.LastError)
+}
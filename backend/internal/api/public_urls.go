@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const rewritePublicURLsChunkSize = 500
+
+type rewritePublicURLsRequest struct {
+	DryRun  bool `json:"dry_run"`
+	Confirm bool `json:"confirm"`
+}
+
+// RewritePublicURLsHandler 将任务记录（含回收站）中保存的 image_url / thumbnail_url 永久改写为 storage.public_url_prefix 下的地址；
+// 接口响应已在返回时改写，此操作并非必需。dry_run=true 只统计数量，否则必须传入 confirm=true
+func RewritePublicURLsHandler(c *gin.Context) {
+	var req rewritePublicURLsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	dryRun := req.DryRun || c.Query("dry_run") == "true"
+	if !dryRun && !req.Confirm && c.Query("confirm") != "true" {
+		Error(c, http.StatusBadRequest, 400, "该操作会永久改写任务记录中的 OSS 地址，请传入 confirm=true 确认，或传入 dry_run=true 预览")
+		return
+	}
+	if strings.TrimSpace(config.Get().Storage.PublicURLPrefix) == "" {
+		Error(c, http.StatusBadRequest, 400, "未配置 storage.public_url_prefix")
+		return
+	}
+
+	var scanned, rewritten int64
+	var batch []model.Task
+	err := model.DB.Unscoped().Model(&model.Task{}).
+		Select("id", "task_id", "image_url", "thumbnail_url").
+		Where("image_url <> '' OR thumbnail_url <> ''").
+		FindInBatches(&batch, rewritePublicURLsChunkSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				task := &batch[i]
+				scanned++
+				updates := map[string]interface{}{}
+				if public := task.ImageURL.Public(); public != string(task.ImageURL) {
+					updates["image_url"] = public
+				}
+				if public := task.ThumbnailURL.Public(); public != string(task.ThumbnailURL) {
+					updates["thumbnail_url"] = public
+				}
+				if len(updates) == 0 {
+					continue
+				}
+				rewritten++
+				if dryRun {
+					continue
+				}
+				if err := model.DB.Unscoped().Model(&model.Task{}).Where("id = ?", task.ID).UpdateColumns(updates).Error; err != nil {
+					return err
+				}
+				InvalidateTask(task.TaskID)
+			}
+			return nil
+		}).Error
+
+	if !dryRun {
+		recordAudit(c, "rewrite_public_urls", gin.H{
+			"prefix":    config.Get().Storage.PublicURLPrefix,
+			"rewritten": rewritten,
+			"error":     errString(err),
+		})
+	}
+	if err != nil {
+		log.Printf("[Maintenance] 改写对外地址中断: 已改写 %d, 错误: %v", rewritten, err)
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, fmt.Sprintf("改写对外地址中断，已改写 %d 条", rewritten))
+		return
+	}
+	if !dryRun {
+		log.Printf("[Maintenance] 已将 %d 条任务的 OSS 地址改写为对外地址", rewritten)
+	}
+	Success(c, gin.H{"dry_run": dryRun, "scanned": scanned, "rewritten": rewritten})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+	"image-gen-service/internal/testutil"
+)
+
+// TestRewritePublicURLsIdempotent 重复执行改写不会给已使用新前缀的地址再加一层前缀，第二次执行不改写任何记录
+func TestRewritePublicURLsIdempotent(t *testing.T) {
+	const prefix = "https://cdn.example.com/images"
+	testutil.Setup(t, testutil.Options{NoPool: true, Config: func(cfg *config.Config) { cfg.Storage.PublicURLPrefix = prefix }})
+	// CDN 域名同时也是 OSS 绑定的访问域名，已带前缀的地址同样匹配改写域名
+	storage.SetPublicURL(prefix, "bucket.oss-cn-hangzhou.aliyuncs.com", "cdn.example.com")
+	model.PublicURL = storage.PublicURL
+	t.Cleanup(func() {
+		storage.SetPublicURL("")
+		model.PublicURL = nil
+	})
+
+	seed := []struct {
+		task      model.Task
+		wantImage string
+		wantThumb string
+	}{
+		{
+			task: model.Task{
+				TaskID:       "url-oss",
+				ImageURL:     "https://bucket.oss-cn-hangzhou.aliyuncs.com/a.png",
+				ThumbnailURL: "https://bucket.oss-cn-hangzhou.aliyuncs.com/thumb/a.jpg?v=2",
+			},
+			wantImage: prefix + "/a.png",
+			wantThumb: prefix + "/thumb/a.jpg?v=2",
+		},
+		{
+			task:      model.Task{TaskID: "url-prefixed", ImageURL: prefix + "/b.png", ThumbnailURL: prefix + "/thumb/b.jpg"},
+			wantImage: prefix + "/b.png",
+			wantThumb: prefix + "/thumb/b.jpg",
+		},
+		{
+			task:      model.Task{TaskID: "url-cdn-root", ImageURL: "https://cdn.example.com/c.png"},
+			wantImage: prefix + "/c.png",
+		},
+		{
+			task:      model.Task{TaskID: "url-other", ImageURL: "https://elsewhere.example.org/d.png"},
+			wantImage: "https://elsewhere.example.org/d.png",
+		},
+	}
+	for i := range seed {
+		testutil.CreateTask(t, &seed[i].task)
+	}
+
+	const route = "/api/v1/maintenance/rewrite-public-urls"
+	for run, want := range []float64{2, 0} {
+		rec := performJSON(t, http.MethodPost, route, route, map[string]interface{}{"confirm": true}, RewritePublicURLsHandler)
+		resp := decodeResponse(t, rec)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("第 %d 次改写失败 %d: %s", run+1, rec.Code, resp.Message)
+		}
+		data, _ := resp.Data.(map[string]interface{})
+		if data["rewritten"] != want {
+			t.Fatalf("第 %d 次改写 %v 条，期望 %v", run+1, data["rewritten"], want)
+		}
+	}
+
+	for _, s := range seed {
+		var got model.Task
+		if err := model.DB.Where("task_id = ?", s.task.TaskID).First(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if string(got.ImageURL) != s.wantImage || string(got.ThumbnailURL) != s.wantThumb {
+			t.Fatalf("任务 %s 地址 = %s / %s，期望 %s / %s", s.task.TaskID, got.ImageURL, got.ThumbnailURL, s.wantImage, s.wantThumb)
+		}
+	}
+}
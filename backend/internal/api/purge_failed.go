@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const purgeFailedChunkSize = 200
+
+type purgeFailedRequest struct {
+	Provider      string `json:"provider"`
+	Before        string `json:"before"`         // RFC3339 或 2006-01-02
+	ErrorContains string `json:"error_contains"` // 错误信息包含的子串
+	Confirm       bool   `json:"confirm"`
+}
+
+// PurgeFailedTasksHandler 删除符合 provider / before / error_contains 筛选条件的失败任务及其残留文件，请求体或查询参数须带 confirm=true
+func PurgeFailedTasksHandler(c *gin.Context) {
+	var req purgeFailedRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	if !req.Confirm && c.Query("confirm") != "true" {
+		Error(c, http.StatusBadRequest, 400, "该操作会永久删除失败任务，请传入 confirm=true 确认")
+		return
+	}
+
+	query := model.DB.Model(&model.Task{}).Where("status = ?", "failed")
+	if provider := strings.TrimSpace(req.Provider); provider != "" {
+		query = query.Where("provider_name = ?", provider)
+	}
+	if before := strings.TrimSpace(req.Before); before != "" {
+		t, err := parseBeforeTime(before)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	if substr := strings.TrimSpace(req.ErrorContains); substr != "" {
+		query = query.Where("error_message LIKE ?", "%"+substr+"%")
+	}
+
+	var removed int64
+	var batch []model.Task
+	err := query.Select("id", "task_id", "local_path", "thumbnail_path").
+		FindInBatches(&batch, purgeFailedChunkSize, func(_ *gorm.DB, _ int) error {
+			ids := make([]uint, 0, len(batch))
+			taskIDs := make([]string, 0, len(batch))
+			for i := range batch {
+				// 失败任务通常没有文件，但派生/中断的任务可能留下部分文件
+				if batch[i].LocalPath != "" || batch[i].ThumbnailPath != "" {
+					deleteTaskFiles(&batch[i])
+				}
+				ids = append(ids, batch[i].ID)
+				taskIDs = append(taskIDs, batch[i].TaskID)
+			}
+			err := model.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("task_id IN ?", taskIDs).Delete(&model.TaskEvent{}).Error; err != nil {
+					return err
+				}
+				result := tx.Unscoped().Where("id IN ?", ids).Delete(&model.Task{})
+				if result.Error != nil {
+					return result.Error
+				}
+				removed += result.RowsAffected
+				return nil
+			})
+			for _, taskID := range taskIDs {
+				InvalidateTask(taskID)
+			}
+			if err == nil {
+				deleteTaskReferences(taskIDs)
+				deleteTaskTags(taskIDs)
+			}
+			return err
+		}).Error
+
+	recordAudit(c, "purge_failed", gin.H{
+		"provider":       req.Provider,
+		"before":         req.Before,
+		"error_contains": req.ErrorContains,
+		"removed":        removed,
+		"error":          errString(err),
+	})
+	if err != nil {
+		log.Printf("[Maintenance] 清理失败任务中断: 已删除 %d, 错误: %v", removed, err)
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, fmt.Sprintf("清理失败任务中断，已删除 %d 条", removed))
+		return
+	}
+	log.Printf("[Maintenance] 已清理失败任务 %d 条", removed)
+	Success(c, gin.H{"removed": removed})
+}
+
+func parseBeforeTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("before 格式错误，应为 RFC3339 或 YYYY-MM-DD")
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
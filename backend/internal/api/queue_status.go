@@ -0,0 +1,19 @@
+package api
+
+import (
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueueStatusHandler 返回队列深度、各 Worker 正在处理的任务及其最近心跳，以及最近的卡死检测记录
+func QueueStatusHandler(c *gin.Context) {
+	depth, capacity := worker.Pool.QueueDepth()
+	Success(c, gin.H{
+		"queue_depth":    depth,
+		"queue_capacity": capacity,
+		"workers":        worker.Pool.WorkerCount(),
+		"running":        worker.Pool.RunningTasks(),
+		"stalled":        worker.Pool.StalledTasks(),
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/storage"
+)
+
+// refPathAllowedDirs 返回允许读取参考图的目录：当前存储目录与 storage.ref_path_dirs
+func refPathAllowedDirs() []string {
+	candidates := append([]string{storage.LocalDir()}, config.Get().Storage.RefPathDirs...)
+	dirs := make([]string, 0, len(candidates))
+	for _, dir := range candidates {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		resolved, err := resolveRealPath(dir)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, resolved)
+	}
+	return dirs
+}
+
+// resolveRealPath 转为绝对路径并解析符号链接，防止借助链接跳出允许目录
+func resolveRealPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// readRefPath 校验路径位于允许目录内后读取参考图，超过大小上限时拒绝
+func readRefPath(path string) ([]byte, error) {
+	resolved, err := resolveRealPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("参考图路径无效: %s", path)
+	}
+	allowed := false
+	for _, dir := range refPathAllowedDirs() {
+		if isSubPath(dir, resolved) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("参考图路径不在允许的目录中: %s（可在 storage.ref_path_dirs 中添加）", path)
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("读取参考图失败: %s", path)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("参考图不是普通文件: %s", path)
+	}
+	maxBytes := currentUploadLimits().MaxFileBytes
+	if info.Size() > maxBytes {
+		return nil, fmt.Errorf("参考图超过 %dMB 限制: %s", maxBytes>>20, path)
+	}
+	// 读取时再限制一次，避免文件在校验后被追加写入
+	content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取参考图失败: %s", path)
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("参考图超过 %dMB 限制: %s", maxBytes>>20, path)
+	}
+	if err := validateImageContent("refPaths", path, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeTestFile(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func symlinkOrSkip(t *testing.T, target, link string) string {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("当前环境不支持符号链接: %v", err)
+	}
+	return link
+}
+
+func TestReadRefPathConfinement(t *testing.T) {
+	extraDir := t.TempDir()
+	env := testutil.Setup(t, testutil.Options{NoPool: true, Config: func(cfg *config.Config) {
+		cfg.Storage.RefPathDirs = []string{extraDir}
+	}})
+	root := env.StorageDir
+	outside := t.TempDir()
+	img := testutil.PNG(t, 8, 8)
+
+	inside := writeTestFile(t, filepath.Join(root, "refs", "in.png"), img)
+	extra := writeTestFile(t, filepath.Join(extraDir, "extra.png"), img)
+	secret := writeTestFile(t, filepath.Join(outside, "secret.png"), img)
+	// 与存储目录同前缀的兄弟目录不应被视为子目录
+	sibling := writeTestFile(t, root+"-evil/x.png", img)
+	t.Cleanup(func() { os.RemoveAll(root + "-evil") })
+	notImage := writeTestFile(t, filepath.Join(root, "notes.png"), []byte("plain text"))
+
+	fileLink := symlinkOrSkip(t, secret, filepath.Join(root, "link.png"))
+	dirLink := symlinkOrSkip(t, outside, filepath.Join(root, "linkdir"))
+	innerLink := symlinkOrSkip(t, inside, filepath.Join(root, "inner-link.png"))
+
+	rel, err := filepath.Rel(mustGetwd(t), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		wantErr string // 为空表示应读取成功，"*" 表示任意错误
+	}{
+		{"存储目录内的文件", inside, ""},
+		{"额外允许目录内的文件", extra, ""},
+		{"指向存储目录内文件的符号链接", innerLink, ""},
+		{"../ 跳出存储目录", filepath.Join(root, "refs", "..", "..", filepath.Base(outside), "secret.png"), "不在允许的目录"},
+		{"未经清理的 ../ 字符串", root + "/refs/../../" + filepath.Base(outside) + "/secret.png", "不在允许的目录"},
+		{"相对路径", rel, "不在允许的目录"},
+		{"允许目录外的绝对路径", secret, "不在允许的目录"},
+		{"系统文件", "/etc/passwd", "不在允许的目录"},
+		{"同前缀的兄弟目录", sibling, "不在允许的目录"},
+		{"指向目录外文件的符号链接", fileLink, "不在允许的目录"},
+		{"经由符号链接目录跳出", filepath.Join(dirLink, "secret.png"), "不在允许的目录"},
+		{"不存在的文件", filepath.Join(root, "missing.png"), "参考图路径无效"},
+		{"目录", filepath.Join(root, "refs"), "不是普通文件"},
+		{"非图片内容", notImage, "*"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := readRefPath(tc.path)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readRefPath(%s): %v", tc.path, err)
+				}
+				if !bytes.Equal(content, img) {
+					t.Fatal("读取内容与原文件不一致")
+				}
+				return
+			}
+			if err == nil || (tc.wantErr != "*" && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("readRefPath(%s) = %v，期望包含 %q", tc.path, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateWithImagesRejectsEscapingRefPath(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	secret := writeTestFile(t, filepath.Join(t.TempDir(), "secret.png"), testutil.PNG(t, 8, 8))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("provider", "fake")
+	form.WriteField("prompt", "x")
+	form.WriteField("refPaths", secret)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks/generate-with-images", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	r := gin.New()
+	r.POST("/tasks/generate-with-images", GenerateWithImagesHandler)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	resp := expectError(t, rec, http.StatusBadRequest, model.ErrCodeValidationFailed)
+	if !strings.Contains(resp.Message, "不在允许的目录") {
+		t.Fatalf("错误信息 = %q", resp.Message)
+	}
+	var count int64
+	model.DB.Model(&model.Task{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("被拒绝的请求创建了 %d 个任务", count)
+	}
+}
+
+func mustGetwd(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
@@ -0,0 +1,403 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// pendingDeletionCheckInterval 检查是否有到期的待删除对象的间隔
+	pendingDeletionCheckInterval = 10 * time.Minute
+	// pendingDeletionBaseBackoff / pendingDeletionMaxBackoff 删除失败后的重试间隔，按失败次数翻倍
+	pendingDeletionBaseBackoff = 5 * time.Minute
+	pendingDeletionMaxBackoff  = 24 * time.Hour
+	pendingDeletionBatchSize   = 200
+	pendingDeletionBatchPause  = 500 * time.Millisecond
+	pendingDeletionListLimit   = 200
+
+	// remoteOrphanGracePeriod 只把早于该时间的对象视为孤立对象，避免与刚上传、尚未写入任务记录的对象竞争
+	remoteOrphanGracePeriod = time.Hour
+	// remoteOrphanReportLimit 检查报告中最多列出的孤立对象数
+	remoteOrphanReportLimit = 1000
+)
+
+// deleteRemoteTaskFiles 按任务记录的 OSS 地址删除原图与缩略图对象，删除失败的记入 pending_deletions 稍后重试。
+// 按内容哈希命名的缩略图可能被内容相同的其他任务共用，仍有任务引用时保留
+func deleteRemoteTaskFiles(task *model.Task) {
+	if !storage.RemoteEnabled() {
+		return
+	}
+	var keys []string
+	if key := storage.RemoteObjectKey(string(task.ImageURL)); key != "" {
+		keys = append(keys, key)
+	}
+	if key := storage.RemoteObjectKey(string(task.ThumbnailURL)); key != "" && !remoteThumbnailShared(task) {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if err := storage.DeleteRemoteObject(key); err != nil {
+			log.Printf("[Storage] 删除 OSS 对象 %s 失败，稍后重试: %v", key, err)
+			recordPendingDeletion(key, task.TaskID, err)
+		}
+	}
+}
+
+func remoteThumbnailShared(task *model.Task) bool {
+	var count int64
+	if err := model.DB.Model(&model.Task{}).
+		Where("thumbnail_url = ? AND id <> ?", task.ThumbnailURL, task.ID).
+		Count(&count).Error; err != nil {
+		// 无法确认时按共用处理，宁可留下孤立对象由孤立对象检查清理
+		return true
+	}
+	return count > 0
+}
+
+// pendingDeletionBackoff 第 attempts 次失败后的重试间隔
+func pendingDeletionBackoff(attempts int) time.Duration {
+	backoff := pendingDeletionBaseBackoff
+	for i := 1; i < attempts && backoff < pendingDeletionMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, pendingDeletionMaxBackoff)
+}
+
+// recordPendingDeletion 记录一次删除失败；同一对象键已存在时累加失败次数并推迟下次重试
+func recordPendingDeletion(key, taskID string, cause error) {
+	now := time.Now()
+	row := model.PendingDeletion{
+		ObjectKey:     key,
+		TaskID:        taskID,
+		Attempts:      1,
+		LastError:     cause.Error(),
+		NextAttemptAt: now.Add(pendingDeletionBackoff(1)),
+	}
+	err := model.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      row.LastError,
+			"next_attempt_at": row.NextAttemptAt,
+			"updated_at":      now,
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		log.Printf("[Storage] 记录待删除 OSS 对象 %s 失败: %v", key, err)
+	}
+}
+
+// StartPendingDeletionRetry 定期检查到期的待删除 OSS 对象，有则创建重试作业
+func StartPendingDeletionRetry() {
+	if !storage.RemoteEnabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(pendingDeletionCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			var due int64
+			if err := model.DB.Model(&model.PendingDeletion{}).Where("next_attempt_at <= ?", time.Now()).Count(&due).Error; err != nil || due == 0 {
+				continue
+			}
+			var active *jobs.ActiveError
+			if _, err := jobs.Enqueue(jobTypePendingDeletionRetry, nil); err != nil && !errors.As(err, &active) {
+				log.Printf("[Storage] 创建待删除对象重试作业失败: %v", err)
+			}
+		}
+	}()
+}
+
+type pendingDeletionRetryParams struct {
+	// All 忽略退避时间，重试全部待删除对象（手动触发时使用）
+	All bool `json:"all"`
+}
+
+// RetryPendingDeletionsHandler 启动作业，忽略退避时间立即重试所有删除失败的 OSS 对象
+func RetryPendingDeletionsHandler(c *gin.Context) {
+	if !storage.RemoteEnabled() {
+		Error(c, http.StatusBadRequest, 400, "未配置 OSS，无需重试")
+		return
+	}
+	enqueueJob(c, jobTypePendingDeletionRetry, pendingDeletionRetryParams{All: true})
+}
+
+// ListPendingDeletionsHandler 列出等待重试删除的 OSS 对象及最近一次重试作业
+func ListPendingDeletionsHandler(c *gin.Context) {
+	var total int64
+	var list []model.PendingDeletion
+	if err := model.DB.Model(&model.PendingDeletion{}).Count(&total).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询待删除对象失败")
+		return
+	}
+	if err := model.DB.Order("next_attempt_at ASC").Limit(pendingDeletionListLimit).Find(&list).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询待删除对象失败")
+		return
+	}
+	job, _ := jobs.Latest(jobTypePendingDeletionRetry)
+	Success(c, gin.H{
+		"total": total,
+		"list":  list,
+		"job":   job,
+	})
+}
+
+// runPendingDeletionRetry 重试删除 pending_deletions 中的 OSS 对象，成功后移除记录，
+// 仍失败的累加次数并按退避推迟；批次之间休眠以限制对 Bucket 的请求频率
+func runPendingDeletionRetry(ctx context.Context, run *jobs.Run) error {
+	var params pendingDeletionRetryParams
+	if err := run.Params(&params); err != nil {
+		return fmt.Errorf("解析作业参数失败: %w", err)
+	}
+	cutoff := time.Now()
+	query := func() *gorm.DB {
+		q := model.DB.Model(&model.PendingDeletion{})
+		if !params.All {
+			q = q.Where("next_attempt_at <= ?", cutoff)
+		}
+		return q
+	}
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return fmt.Errorf("查询待删除对象失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	lastID := uint(0)
+	for {
+		var batch []model.PendingDeletion
+		if err := query().Where("id > ?", lastID).Order("id ASC").Limit(pendingDeletionBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		keys := make([]string, 0, len(batch))
+		for _, row := range batch {
+			keys = append(keys, row.ObjectKey)
+		}
+		failed, err := storage.DeleteRemoteObjects(ctx, keys)
+		failedSet := make(map[string]bool, len(failed))
+		for _, key := range failed {
+			failedSet[key] = true
+		}
+		var deletedIDs []uint
+		for _, row := range batch {
+			if !failedSet[row.ObjectKey] {
+				deletedIDs = append(deletedIDs, row.ID)
+				continue
+			}
+			reason := "删除未确认"
+			if err != nil {
+				reason = err.Error()
+			}
+			recordPendingDeletion(row.ObjectKey, row.TaskID, errors.New(reason))
+		}
+		if len(deletedIDs) > 0 {
+			if err := model.DB.Where("id IN ?", deletedIDs).Delete(&model.PendingDeletion{}).Error; err != nil {
+				log.Printf("[Storage] 移除待删除对象记录失败: %v", err)
+			}
+		}
+		run.Count("deleted", int64(len(deletedIDs)))
+		run.Count("failed", int64(len(failed)))
+		run.Advance(int64(len(batch)))
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if len(batch) < pendingDeletionBatchSize {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pendingDeletionBatchPause):
+		}
+	}
+}
+
+type remoteOrphanAuditParams struct {
+	// Remove 为 true 时删除发现的孤立对象，否则只生成报告
+	Remove bool `json:"remove"`
+}
+
+// RemoteOrphan 孤立对象检查发现的一个 OSS 对象
+type RemoteOrphan struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// RemoteOrphanReport 最近一次孤立对象检查的结果
+type RemoteOrphanReport struct {
+	JobID     string         `json:"job_id"`
+	Prefix    string         `json:"prefix"`
+	Remove    bool           `json:"remove"`
+	Scanned   int            `json:"scanned"`
+	Orphans   []RemoteOrphan `json:"orphans"`
+	Total     int            `json:"total_orphans"`
+	Bytes     int64          `json:"orphan_bytes"`
+	Truncated bool           `json:"truncated"` // 孤立对象过多，Orphans 只列出前 remoteOrphanReportLimit 个
+	Removed   int            `json:"removed"`
+	Failed    int            `json:"failed"`
+	StartedAt time.Time      `json:"started_at"`
+	Duration  int64          `json:"duration_ms"`
+	Error     string         `json:"error,omitempty"`
+}
+
+var (
+	remoteOrphanMu         sync.Mutex
+	lastRemoteOrphanReport *RemoteOrphanReport
+)
+
+// AuditRemoteOrphansHandler 启动作业，列出服务前缀下未被任何任务引用的 OSS 对象；remove=true 时一并删除
+func AuditRemoteOrphansHandler(c *gin.Context) {
+	if !storage.RemoteEnabled() {
+		Error(c, http.StatusBadRequest, 400, "未配置 OSS，无需检查")
+		return
+	}
+	var params remoteOrphanAuditParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	if c.Query("remove") == "true" {
+		params.Remove = true
+	}
+	enqueueJob(c, jobTypeRemoteOrphanAudit, params)
+}
+
+// RemoteOrphansStatusHandler 返回最近一次孤立对象检查作业及其报告
+func RemoteOrphansStatusHandler(c *gin.Context) {
+	job, _ := jobs.Latest(jobTypeRemoteOrphanAudit)
+	remoteOrphanMu.Lock()
+	report := lastRemoteOrphanReport
+	remoteOrphanMu.Unlock()
+	Success(c, gin.H{
+		"job":    job,
+		"report": report,
+	})
+}
+
+// remoteReferencedKeys 返回仍被任务（不含已删除任务）引用的 OSS 对象键
+func remoteReferencedKeys(ctx context.Context) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	var batch []model.Task
+	err := model.DB.Model(&model.Task{}).
+		Select("id", "image_url", "thumbnail_url").
+		Where("image_url <> '' OR thumbnail_url <> ''").
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, task := range batch {
+				if key := storage.RemoteObjectKey(string(task.ImageURL)); key != "" {
+					refs[key] = true
+				}
+				if key := storage.RemoteObjectKey(string(task.ThumbnailURL)); key != "" {
+					refs[key] = true
+				}
+			}
+			return nil
+		}).Error
+	return refs, err
+}
+
+// runRemoteOrphanAudit 孤立对象检查作业：分页列举本服务前缀下的对象（列举本身按页限速），
+// 与任务记录中的地址比对，报告（按参数删除）没有任务引用的对象；删除失败的记入 pending_deletions
+func runRemoteOrphanAudit(ctx context.Context, run *jobs.Run) error {
+	if !storage.RemoteEnabled() {
+		return errors.New("未配置 OSS，无需检查")
+	}
+	var params remoteOrphanAuditParams
+	if err := run.Params(&params); err != nil {
+		return fmt.Errorf("解析作业参数失败: %w", err)
+	}
+	report := &RemoteOrphanReport{
+		JobID:     run.ID(),
+		Prefix:    storage.RemotePrefix(),
+		Remove:    params.Remove,
+		Orphans:   []RemoteOrphan{},
+		StartedAt: time.Now(),
+	}
+	err := auditRemoteOrphans(ctx, run, params, report)
+	report.Duration = time.Since(report.StartedAt).Milliseconds()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	remoteOrphanMu.Lock()
+	lastRemoteOrphanReport = report
+	remoteOrphanMu.Unlock()
+	log.Printf("[Storage] 孤立对象检查完成: 扫描 %d 个对象，孤立 %d 个 (%d 字节)，删除 %d 个，失败 %d 个",
+		report.Scanned, report.Total, report.Bytes, report.Removed, report.Failed)
+	return err
+}
+
+func auditRemoteOrphans(ctx context.Context, run *jobs.Run, params remoteOrphanAuditParams, report *RemoteOrphanReport) error {
+	refs, err := remoteReferencedKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	cutoff := report.StartedAt.Add(-remoteOrphanGracePeriod)
+
+	return storage.ListRemoteObjects(ctx, func(objects []storage.RemoteObject) error {
+		var orphanKeys []string
+		for _, object := range objects {
+			report.Scanned++
+			if refs[object.Key] {
+				continue
+			}
+			if object.LastModified.After(cutoff) {
+				run.Count("recent", 1)
+				continue
+			}
+			report.Total++
+			report.Bytes += object.Size
+			if len(report.Orphans) < remoteOrphanReportLimit {
+				report.Orphans = append(report.Orphans, RemoteOrphan{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+			} else {
+				report.Truncated = true
+			}
+			orphanKeys = append(orphanKeys, object.Key)
+		}
+		run.Count("scanned", int64(len(objects)))
+		run.Count("orphans", int64(len(orphanKeys)))
+		run.Advance(int64(len(objects)))
+
+		if !params.Remove || len(orphanKeys) == 0 {
+			return nil
+		}
+		failed, err := storage.DeleteRemoteObjects(ctx, orphanKeys)
+		for _, key := range failed {
+			reason := "删除未确认"
+			if err != nil {
+				reason = err.Error()
+			}
+			recordPendingDeletion(key, "", errors.New(reason))
+		}
+		report.Removed += len(orphanKeys) - len(failed)
+		report.Failed += len(failed)
+		run.Count("removed", int64(len(orphanKeys)-len(failed)))
+		run.Count("remove_failed", int64(len(failed)))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return nil
+	})
+}
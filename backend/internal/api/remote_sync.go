@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const remoteSyncRetryBatchSize = 50
+
+// RetryRemoteSyncHandler 启动后台作业，重新上传 OSS 同步失败或部分成功的图片，同一时间只运行一个
+func RetryRemoteSyncHandler(c *gin.Context) {
+	if !storage.RemoteEnabled() {
+		Error(c, http.StatusBadRequest, 400, "未配置 OSS，无需同步")
+		return
+	}
+	enqueueJob(c, jobTypeRemoteSyncRetry, nil)
+}
+
+// RetryRemoteSyncStatusHandler 返回最近一次重新同步作业的状态
+func RetryRemoteSyncStatusHandler(c *gin.Context) {
+	latestJobHandler(jobTypeRemoteSyncRetry)(c)
+}
+
+func remoteSyncRetryQuery() *gorm.DB {
+	return model.DB.Model(&model.Task{}).
+		Where("sync_status IN ? AND local_path <> '' AND archived_at IS NULL", []string{storage.RemoteSyncFailed, storage.RemoteSyncPartial})
+}
+
+// runRemoteSyncRetry 重新同步 OSS 作业
+func runRemoteSyncRetry(ctx context.Context, run *jobs.Run) error {
+	if !storage.RemoteEnabled() {
+		return errors.New("未配置 OSS，无需同步")
+	}
+	var total int64
+	if err := remoteSyncRetryQuery().Count(&total).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	var batch []model.Task
+	return remoteSyncRetryQuery().
+		Select("id", "task_id", "local_path", "thumbnail_path", "image_url", "thumbnail_url").
+		FindInBatches(&batch, remoteSyncRetryBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				task := &batch[i]
+				result := storage.RetryRemoteSync(task.LocalPath, task.ThumbnailPath)
+				// 部分同步的任务保留此前已上传成功的地址
+				if result.RemoteURL == "" {
+					result.RemoteURL = string(task.ImageURL)
+				}
+				if result.ThumbRemoteURL == "" {
+					result.ThumbRemoteURL = string(task.ThumbnailURL)
+				}
+				if err := model.DB.Model(&model.Task{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
+					"image_url":     result.RemoteURL,
+					"thumbnail_url": result.ThumbRemoteURL,
+					"sync_status":   result.Status,
+					"sync_error":    result.Error,
+				}).Error; err != nil {
+					log.Printf("[Maintenance] 更新任务 %s 同步状态失败: %v", task.TaskID, err)
+				}
+				InvalidateTask(task.TaskID)
+				if result.Status == storage.RemoteSyncSynced {
+					run.Count("synced", 1)
+				} else {
+					run.Count("failed", 1)
+				}
+				run.Advance(1)
+			}
+			return nil
+		}).Error
+}
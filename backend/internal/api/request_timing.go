@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/metrics"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxParamValueLength = 40
+
+var (
+	httpRequestDuration = metrics.NewHistogram("http_request_duration_seconds", "HTTP 请求耗时", "method", "route", "status")
+	httpRequestDBTime   = metrics.NewHistogram("http_request_db_duration_seconds", "单个 HTTP 请求内的 SQL 累计耗时", "method", "route")
+)
+
+// RequestTimingMiddleware 按路由记录耗时与数据库耗时直方图，超过 observability.slow_request_ms 的请求连同参数摘要写入日志
+func RequestTimingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, timer := model.WithDBTimer(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		start := time.Now()
+
+		c.Next()
+
+		elapsed := time.Since(start)
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequestDuration.Observe(elapsed, method, route, strconv.Itoa(c.Writer.Status()))
+		httpRequestDBTime.Observe(timer.Elapsed(), method, route)
+
+		threshold := time.Duration(config.Get().Observability.SlowRequestMs) * time.Millisecond
+		if threshold > 0 && elapsed > threshold && !isStreamingRoute(route) {
+			log.Printf("[SlowRequest] method=%s route=%s status=%d elapsed=%s db_time=%s db_queries=%d params=%s",
+				method, route, c.Writer.Status(), elapsed, timer.Elapsed(), timer.Queries(), summarizeParams(c))
+		}
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出收集到的直方图
+func MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WriteText(c.Writer)
+}
+
+// isStreamingRoute SSE/WebSocket 等长连接的耗时不代表处理性能，不输出慢请求日志
+func isStreamingRoute(route string) bool {
+	return strings.HasSuffix(route, "/stream") || strings.HasSuffix(route, "/ws")
+}
+
+// summarizeParams 汇总路径参数与查询参数，长值截断，避免日志过长或泄露大段提示词
+func summarizeParams(c *gin.Context) string {
+	parts := make([]string, 0, len(c.Params)+4)
+	for _, p := range c.Params {
+		parts = append(parts, p.Key+"="+truncateParam(p.Value))
+	}
+	query := c.Request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "token" {
+			continue
+		}
+		parts = append(parts, key+"="+truncateParam(query.Get(key)))
+	}
+	if c.Request.ContentLength > 0 {
+		parts = append(parts, fmt.Sprintf("body_bytes=%d", c.Request.ContentLength))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "&")
+}
+
+func truncateParam(value string) string {
+	if runes := []rune(value); len(runes) > maxParamValueLength {
+		return string(runes[:maxParamValueLength]) + "..."
+	}
+	return value
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const retentionPreviewSample = 20
+
+// retentionPolicy 从配置解析出的保留策略
+type retentionPolicy struct {
+	Enabled       bool          `json:"enabled"`
+	Days          int           `json:"days"`
+	Mode          string        `json:"mode"`
+	RunAt         string        `json:"run_at"`
+	BatchSize     int           `json:"batch_size"`
+	BatchInterval time.Duration `json:"-"`
+}
+
+// retentionJobParams 保留策略作业参数，执行时的截止时间与清理方式
+type retentionJobParams struct {
+	Cutoff time.Time `json:"cutoff"`
+	Mode   string    `json:"mode"`
+}
+
+func currentRetentionPolicy() retentionPolicy {
+	cfg := config.Get().Retention
+	policy := retentionPolicy{
+		Enabled:       cfg.Enabled,
+		Days:          cfg.Days,
+		Mode:          strings.ToLower(strings.TrimSpace(cfg.Mode)),
+		RunAt:         strings.TrimSpace(cfg.RunAt),
+		BatchSize:     cfg.BatchSize,
+		BatchInterval: time.Duration(cfg.BatchIntervalMs) * time.Millisecond,
+	}
+	if policy.Days <= 0 {
+		policy.Days = 90
+	}
+	if policy.Mode != "archive" {
+		policy.Mode = "delete"
+	}
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = 100
+	}
+	if _, _, ok := parseClock(policy.RunAt); !ok {
+		policy.RunAt = "03:00"
+	}
+	return policy
+}
+
+func (p retentionPolicy) cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -p.Days)
+}
+
+// nextRun 计算下一次执行时间（本地时间每天 RunAt）
+func (p retentionPolicy) nextRun(now time.Time) time.Time {
+	hour, minute, _ := parseClock(p.RunAt)
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func parseClock(value string) (int, int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
+
+// retentionQuery 满足清理条件的任务：早于截止时间、已完成、未收藏且尚未归档
+func retentionQuery(cutoff time.Time) *gorm.DB {
+	return model.DB.Model(&model.Task{}).
+		Where("status = ? AND created_at < ? AND archived_at IS NULL AND favorite = ?", "completed", cutoff, false)
+}
+
+// StartRetention 按配置每天执行一次保留策略；未开启时不启动
+func StartRetention() {
+	policy := currentRetentionPolicy()
+	if !policy.Enabled {
+		return
+	}
+	log.Printf("[Retention] 已开启: 保留 %d 天, 方式 %s, 每天 %s 执行", policy.Days, policy.Mode, policy.RunAt)
+	go func() {
+		for {
+			next := policy.nextRun(time.Now())
+			time.Sleep(time.Until(next))
+			params := retentionJobParams{Cutoff: policy.cutoff(time.Now()), Mode: policy.Mode}
+			if _, err := jobs.Enqueue(jobTypeRetention, params); err != nil {
+				log.Printf("[Retention] 创建清理作业失败: %v", err)
+			}
+		}
+	}()
+}
+
+// runRetention 保留策略作业：分批清理过期任务，批次之间休眠以限制磁盘 I/O
+func runRetention(ctx context.Context, run *jobs.Run) error {
+	policy := currentRetentionPolicy()
+	params := retentionJobParams{Cutoff: policy.cutoff(time.Now()), Mode: policy.Mode}
+	if err := run.Params(&params); err != nil {
+		return fmt.Errorf("解析作业参数失败: %w", err)
+	}
+	if params.Mode != "archive" {
+		params.Mode = "delete"
+	}
+	var total int64
+	if err := retentionQuery(params.Cutoff).Count(&total).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	log.Printf("[Retention] 开始清理 %s 之前的已完成任务 (方式: %s)", params.Cutoff.Format(time.RFC3339), params.Mode)
+	lastID := uint(0)
+	for {
+		var batch []model.Task
+		if err := retentionQuery(params.Cutoff).Where("id > ?", lastID).Order("id ASC").Limit(policy.BatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for i := range batch {
+			deleteTaskFiles(&batch[i])
+		}
+		if err := expireTasks(batch, params.Mode); err != nil {
+			return err
+		}
+		run.Advance(int64(len(batch)))
+
+		if len(batch) < policy.BatchSize {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(policy.BatchInterval):
+		}
+	}
+}
+
+// expireTasks 在一个事务内删除或归档一批任务记录（文件已由调用方删除）
+func expireTasks(batch []model.Task, mode string) error {
+	ids := make([]uint, 0, len(batch))
+	taskIDs := make([]string, 0, len(batch))
+	for _, task := range batch {
+		ids = append(ids, task.ID)
+		taskIDs = append(taskIDs, task.TaskID)
+	}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if mode == "archive" {
+			return tx.Model(&model.Task{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"archived_at":    time.Now(),
+				"local_path":     "",
+				"thumbnail_path": "",
+				"thumbnail_hash": "",
+				"image_url":      "",
+				"thumbnail_url":  "",
+				"original_path":  "",
+				"sync_status":    "",
+				"sync_error":     "",
+			}).Error
+		}
+		if err := tx.Where("task_id IN ?", taskIDs).Delete(&model.TaskEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&model.Task{}).Error
+	})
+	for _, taskID := range taskIDs {
+		InvalidateTask(taskID)
+	}
+	if err != nil {
+		return fmt.Errorf("更新任务记录失败: %w", err)
+	}
+	if mode != "archive" {
+		deleteTaskReferences(taskIDs)
+		deleteTaskTags(taskIDs)
+	}
+	return nil
+}
+
+// RetentionPreviewHandler 预览下一次保留策略清理将删除的内容，不做任何修改
+func RetentionPreviewHandler(c *gin.Context) {
+	policy := currentRetentionPolicy()
+	now := time.Now()
+	next := policy.nextRun(now)
+	// 预览按下一次执行时的截止时间计算
+	cutoff := policy.cutoff(next)
+
+	var stats struct {
+		Count     int64
+		TotalSize int64
+	}
+	if err := retentionQuery(cutoff).Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS total_size").Scan(&stats).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务失败")
+		return
+	}
+	var sample []model.Task
+	retentionQuery(cutoff).Order("created_at ASC").Limit(retentionPreviewSample).Find(&sample)
+
+	lastRun, _ := jobs.Latest(jobTypeRetention)
+	running := lastRun != nil && (lastRun.Status == jobs.StatusPending || lastRun.Status == jobs.StatusRunning)
+
+	var nextRunAt *time.Time
+	if policy.Enabled {
+		nextRunAt = &next
+	}
+	Success(c, gin.H{
+		"policy":      policy,
+		"next_run_at": nextRunAt,
+		"cutoff":      cutoff,
+		"count":       stats.Count,
+		"total_bytes": stats.TotalSize,
+		"sample":      sample,
+		"running":     running,
+		"last_run":    lastRun,
+	})
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDeadlineKey 当前请求的处理时限，路由级的 RouteTimeout / NoDeadline 在分组设置的基础上覆盖
+const routeDeadlineKey = "route_deadline"
+
+// 路由超时分类，对应 server.route_timeouts 的各项配置
+const (
+	RouteTimeoutDefault = "default" // 普通读写接口
+	RouteTimeoutChat    = "chat"    // 调用对话模型的接口
+	RouteTimeoutLong    = "long"    // 上传导入与同步执行的维护操作
+)
+
+// RouteTimeoutFor 返回分类对应的处理时限，0 表示不限制
+func RouteTimeoutFor(class string) time.Duration {
+	cfg := config.Get().Server.RouteTimeouts
+	seconds := cfg.DefaultSeconds
+	switch class {
+	case RouteTimeoutChat:
+		seconds = cfg.ChatSeconds
+	case RouteTimeoutLong:
+		seconds = cfg.LongSeconds
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// routeDeadline 请求的处理时限。parent 为进入中间件前的请求 Context，覆盖时限时从 parent 重新派生，
+// 客户端断开仍会取消请求
+type routeDeadline struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (d *routeDeadline) reset(c *gin.Context, timeout time.Duration) {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	if timeout > 0 {
+		d.ctx, d.cancel = context.WithTimeout(d.parent, timeout)
+	} else {
+		d.ctx, d.cancel = context.WithCancel(d.parent)
+	}
+	c.Request = c.Request.WithContext(d.ctx)
+}
+
+func (d *routeDeadline) expired() bool {
+	return errors.Is(d.ctx.Err(), context.DeadlineExceeded)
+}
+
+// RouteTimeout 为请求设置处理时限：处理器及其发出的上游调用都应使用 c.Request.Context()，
+// 时限到达时一起取消，并以 504 TIMEOUT 响应代替处理器之后写出的内容。
+// 挂在分组上作为默认值，挂在单个路由上时覆盖分组的设置；timeout 为 0 表示不限制
+func RouteTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if existing, ok := c.Get(routeDeadlineKey); ok {
+			existing.(*routeDeadline).reset(c, timeout)
+			c.Next()
+			return
+		}
+
+		deadline := &routeDeadline{parent: c.Request.Context()}
+		deadline.reset(c, timeout)
+		c.Set(routeDeadlineKey, deadline)
+		writer := &timeoutWriter{ResponseWriter: c.Writer, deadline: deadline}
+		c.Writer = writer
+
+		c.Next()
+
+		timedOut := writer.finish()
+		deadline.cancel()
+		c.Writer = writer.ResponseWriter
+		if timedOut {
+			log.Printf("[API] 请求处理超时 route=%s", c.FullPath())
+			ErrorWithCode(c, http.StatusGatewayTimeout, 504, model.ErrCodeTimeout, "请求处理超时")
+		}
+	}
+}
+
+// clearRouteTimeout 解除当前请求的处理时限，供流式与导出接口使用
+func clearRouteTimeout(c *gin.Context) {
+	if existing, ok := c.Get(routeDeadlineKey); ok {
+		existing.(*routeDeadline).reset(c, 0)
+	}
+}
+
+// timeoutWriter 时限到达后丢弃处理器写出的状态码与内容，由 RouteTimeout 统一返回 504；
+// 时限到达前已开始写出的响应保持不变
+type timeoutWriter struct {
+	gin.ResponseWriter
+	deadline *routeDeadline
+
+	mu       sync.Mutex
+	wrote    bool
+	timedOut bool
+	done     bool
+}
+
+// allow 判断本次写入是否放行：时限到达前放行并记录已写出，之后的写入丢弃
+func (w *timeoutWriter) allow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return true
+	}
+	if w.timedOut || (!w.wrote && w.deadline.expired()) {
+		w.timedOut = true
+		return false
+	}
+	w.wrote = true
+	return true
+}
+
+// finish 处理器返回后调用，返回是否需要写出 504
+func (w *timeoutWriter) finish() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if !w.wrote && !w.Written() && w.deadline.expired() {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.allow() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if w.allow() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if !w.allow() {
+		return 0, context.DeadlineExceeded
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if !w.allow() {
+		return 0, context.DeadlineExceeded
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap 供 http.ResponseController 找到底层连接，NoDeadline 才能解除读写超时
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRouteTimeoutNoGoroutineLeak 处理器超过时限时返回 504，处理器及其发起的上游调用随请求 Context 一起结束，
+// 请求完成后 goroutine 数回到基线
+func TestRouteTimeoutNoGoroutineLeak(t *testing.T) {
+	r := gin.New()
+	r.GET("/slow", RouteTimeout(30*time.Millisecond), func(c *gin.Context) {
+		ctx := c.Request.Context()
+		// 模拟使用请求 Context 的上游调用
+		upstream := make(chan struct{})
+		go func() {
+			defer close(upstream)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Minute):
+			}
+		}()
+		<-upstream
+		// 超时后处理器仍尝试写出结果，应被丢弃
+		Success(c, "late")
+	})
+	srv := httptest.NewServer(r)
+	client := &http.Client{Transport: &http.Transport{}}
+
+	baseline := runtime.NumGoroutine()
+	const requests = 20
+	done := make(chan int, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			resp, err := client.Get(srv.URL + "/slow")
+			if err != nil {
+				done <- 0
+				return
+			}
+			defer resp.Body.Close()
+			var out Response
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.ErrorCode != model.ErrCodeTimeout {
+				done <- 0
+				return
+			}
+			done <- resp.StatusCode
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		if code := <-done; code != http.StatusGatewayTimeout {
+			t.Fatalf("超时请求返回 %d，期望 504 TIMEOUT", code)
+		}
+	}
+	client.CloseIdleConnections()
+	srv.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= baseline {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("超时请求结束后 goroutine 数 %d 未回到基线 %d\n%s", n, baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// startupRetryWindow 启动时数据库只读或被锁定的重试时长，超过后以降级模式启动 HTTP 服务
+	startupRetryWindow = 15 * time.Second
+	// startupRetryInitialWait 启动重试的首次等待时间，之后逐次翻倍
+	startupRetryInitialWait = 500 * time.Millisecond
+	// startupRecheckInterval 降级模式下自动重新检查数据库的间隔，逐次翻倍到 startupRecheckMaxInterval
+	startupRecheckInterval    = 10 * time.Second
+	startupRecheckMaxInterval = 60 * time.Second
+
+	startupStatusInitializing = "initializing"
+	startupStatusDegraded     = "degraded"
+	startupStatusReady        = "ready"
+)
+
+// startupStatus 启动状态：数据库不可用时服务以降级模式运行，前端据此展示错误原因而不是一直显示“连接中”
+type startupStatus struct {
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	ErrorKind     string     `json:"error_kind,omitempty"` // read_only / locked / unavailable / other
+	Hint          string     `json:"hint,omitempty"`
+	DBPath        string     `json:"db_path"`
+	Attempts      int        `json:"attempts"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"`
+	ReadyAt       *time.Time `json:"ready_at,omitempty"`
+}
+
+var (
+	startupReady atomic.Bool
+	startupMu    sync.Mutex
+	startup      = startupStatus{Status: startupStatusInitializing}
+	// startupAttemptMu 保证同一时间只有一次初始化尝试，重试接口与自动重新检查不会并发打开数据库
+	startupAttemptMu sync.Mutex
+	startupInit      func()
+)
+
+// RunStartup 打开数据库并执行 initServices 完成其余初始化。数据库只读、被锁定或无法打开时在
+// startupRetryWindow 内按退避重试；仍然失败时返回 false，服务以降级模式运行并在后台定期重新检查，
+// 数据库恢复后（或调用 /startup/retry）自动完成初始化。initServices 只会成功执行一次
+func RunStartup(dbPath string, initServices func()) bool {
+	startupMu.Lock()
+	startup.DBPath = dbPath
+	startupInit = initServices
+	startupMu.Unlock()
+
+	deadline := time.Now().Add(startupRetryWindow)
+	wait := startupRetryInitialWait
+	for {
+		err := attemptStartup()
+		if err == nil {
+			return true
+		}
+		kind, transient := model.ClassifyDBError(err)
+		if !transient || time.Now().Add(wait).After(deadline) {
+			log.Printf("[Startup] 数据库不可用 (%s)，以降级模式启动: %v", kind, err)
+			break
+		}
+		log.Printf("[Startup] 数据库不可用 (%s)，%s 后重试: %v", kind, wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+
+	startupMu.Lock()
+	startup.Status = startupStatusDegraded
+	startupMu.Unlock()
+	go recheckStartup()
+	return false
+}
+
+// attemptStartup 尝试一次初始化，已就绪时直接返回
+func attemptStartup() error {
+	startupAttemptMu.Lock()
+	defer startupAttemptMu.Unlock()
+	if startupReady.Load() {
+		return nil
+	}
+
+	startupMu.Lock()
+	dbPath := startup.DBPath
+	startupMu.Unlock()
+
+	err := model.OpenDB(dbPath)
+	now := time.Now()
+
+	startupMu.Lock()
+	startup.Attempts++
+	startup.LastAttemptAt = &now
+	if err != nil {
+		startup.Error = err.Error()
+		startup.ErrorKind, _ = model.ClassifyDBError(err)
+		startup.Hint = startupHint(startup.ErrorKind)
+		startupMu.Unlock()
+		return err
+	}
+	initServices := startupInit
+	startupMu.Unlock()
+
+	if initServices != nil {
+		initServices()
+	}
+
+	startupMu.Lock()
+	readyAt := time.Now()
+	startup = startupStatus{Status: startupStatusReady, DBPath: dbPath, Attempts: startup.Attempts, LastAttemptAt: &now, ReadyAt: &readyAt}
+	startupMu.Unlock()
+	startupReady.Store(true)
+	return nil
+}
+
+// recheckStartup 降级模式下定期重新检查数据库，直到初始化完成
+func recheckStartup() {
+	interval := startupRecheckInterval
+	for !startupReady.Load() {
+		next := time.Now().Add(interval)
+		startupMu.Lock()
+		if startup.Status != startupStatusReady {
+			startup.NextRetryAt = &next
+		}
+		startupMu.Unlock()
+
+		time.Sleep(interval)
+		if startupReady.Load() {
+			return
+		}
+		if err := attemptStartup(); err != nil {
+			log.Printf("[Startup] 数据库仍不可用: %v", err)
+		} else {
+			log.Printf("[Startup] 数据库已恢复，服务初始化完成")
+			return
+		}
+		if interval *= 2; interval > startupRecheckMaxInterval {
+			interval = startupRecheckMaxInterval
+		}
+	}
+}
+
+func startupHint(kind string) string {
+	switch kind {
+	case model.DBErrorReadOnly:
+		return "数据库文件或所在目录不可写，请检查应用数据目录的权限"
+	case model.DBErrorLocked:
+		return "数据库被其他进程占用，请关闭其他正在运行的实例"
+	case model.DBErrorUnavailable:
+		return "无法打开数据库文件，请检查路径是否存在且有访问权限"
+	}
+	return "数据库初始化失败，请查看服务日志"
+}
+
+func currentStartup() startupStatus {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	return startup
+}
+
+// startupAllowedPaths 降级模式下仍可访问的接口
+var startupAllowedPaths = map[string]bool{
+	"/api/v1/health":         true,
+	"/api/v1/startup-status": true,
+	"/api/v1/startup/retry":  true,
+}
+
+// RequireStartupReady 降级模式下除健康检查与启动状态接口外一律返回 503，避免请求访问未初始化的数据库
+func RequireStartupReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if startupReady.Load() || startupAllowedPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		respondStartupDegraded(c)
+		c.Abort()
+	}
+}
+
+func respondStartupDegraded(c *gin.Context) {
+	status := currentStartup()
+	c.Header("Retry-After", strconv.Itoa(int(startupRecheckInterval/time.Second)))
+	c.JSON(http.StatusServiceUnavailable, Response{
+		Code:      503,
+		Message:   "服务启动未完成: " + status.Hint,
+		Data:      status,
+		ErrorCode: model.ErrCodeStartupDegraded,
+	})
+}
+
+// StartupStatusHandler 返回启动是否完成；数据库不可用时服务以降级模式运行，由此接口说明原因供前端展示
+func StartupStatusHandler(c *gin.Context) {
+	Success(c, currentStartup())
+}
+
+// RetryStartupHandler 立即重试打开数据库而不等待下一次自动检查，数据库仍不可用时返回 503 及最新错误
+func RetryStartupHandler(c *gin.Context) {
+	if err := attemptStartup(); err != nil {
+		respondStartupDegraded(c)
+		return
+	}
+	Success(c, currentStartup())
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireStartupReady(t *testing.T) {
+	ready := startupReady.Load()
+	startupReady.Store(false)
+	t.Cleanup(func() { startupReady.Store(ready) })
+
+	r := gin.New()
+	r.Use(RequireStartupReady())
+	r.GET("/api/v1/tasks/:task_id", func(c *gin.Context) { Success(c, nil) })
+	r.GET("/api/v1/startup-status", StartupStatusHandler)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/x", nil))
+	expectError(t, rec, http.StatusServiceUnavailable, model.ErrCodeStartupDegraded)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("降级响应缺少 Retry-After")
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/startup-status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("降级模式下启动状态接口应可访问，实际 %d", rec.Code)
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultActivityDays = 30
+	maxActivityDays     = 366
+	// maxActivityHourDays 按小时统计时允许的最大天数，避免返回过多的桶
+	maxActivityHourDays = 31
+	// activitySlotSeconds SQL 分组的粒度。按 15 分钟而不是 1 小时分组，
+	// 才能正确映射到 +05:30、+05:45 等非整点偏移时区的本地小时
+	activitySlotSeconds = 900
+)
+
+// activityBucket 一个时间桶内提交、完成与失败的任务数
+type activityBucket struct {
+	Start     time.Time `json:"start"`
+	Submitted int64     `json:"submitted"`
+	Completed int64     `json:"completed"`
+	Failed    int64     `json:"failed"`
+}
+
+type activityTotals struct {
+	Submitted int64 `json:"submitted"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// activityBucketer 按时区计算时间所在桶的起点。夏令时切换当天按本地日历计算，
+// 日桶可能为 23 或 25 小时；回拨时重复的本地小时按实际时间区分为两个桶
+type activityBucketer struct {
+	hourly bool
+	loc    *time.Location
+}
+
+func (b activityBucketer) start(t time.Time) time.Time {
+	local := t.In(b.loc)
+	if b.hourly {
+		offset := time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+		return local.Add(-offset)
+	}
+	y, m, d := local.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, b.loc)
+}
+
+func (b activityBucketer) next(start time.Time) time.Time {
+	if b.hourly {
+		// 起点重新对齐，兼容夏令时偏移不足一小时的时区
+		return b.start(start.Add(time.Hour))
+	}
+	y, m, d := start.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, b.loc)
+}
+
+// parseActivityLocation 解析 tz 参数，为空时使用服务器本地时区
+func parseActivityLocation(tz string) (*time.Location, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// ActivityStatsHandler 按小时或天统计最近 days 天提交、完成与失败的任务数，按 tz 时区（默认服务器本地时区）分桶；
+// 空桶也会返回，前端可直接绘制曲线
+func ActivityStatsHandler(c *gin.Context) {
+	verr := &provider.ValidationError{}
+	granularity := strings.TrimSpace(c.DefaultQuery("granularity", "day"))
+	if granularity != "hour" && granularity != "day" {
+		verr.Add("granularity", "granularity 只支持 hour 或 day", []string{"hour", "day"}, granularity)
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultActivityDays)))
+	maxDays := maxActivityDays
+	if granularity == "hour" {
+		maxDays = maxActivityHourDays
+	}
+	if err != nil || days < 1 || days > maxDays {
+		verr.Add("days", fmt.Sprintf("days 取值范围为 1 ~ %d", maxDays), nil, c.Query("days"))
+	}
+	loc, err := parseActivityLocation(c.Query("tz"))
+	if err != nil {
+		verr.Add("tz", "无法识别的时区，请使用 IANA 时区名，如 Asia/Shanghai", nil, c.Query("tz"))
+	}
+	if err := verr.Err(); err != nil {
+		ValidationFailed(c, err)
+		return
+	}
+
+	bucketer := activityBucketer{hourly: granularity == "hour", loc: loc}
+	now := time.Now()
+	// 日桶从 days-1 天前的零点开始（含今天共 days 个桶）；小时桶覆盖最近 days*24 小时
+	var from time.Time
+	if bucketer.hourly {
+		from = bucketer.start(now.Add(-time.Duration(days*24-1) * time.Hour))
+	} else {
+		today := bucketer.start(now)
+		from = time.Date(today.Year(), today.Month(), today.Day()-(days-1), 0, 0, 0, 0, loc)
+	}
+
+	var buckets []activityBucket
+	index := make(map[int64]int)
+	for start := from; !start.After(now); start = bucketer.next(start) {
+		index[start.Unix()] = len(buckets)
+		buckets = append(buckets, activityBucket{Start: start})
+	}
+
+	slots, err := queryActivitySlots(from)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "统计任务数失败")
+		return
+	}
+	var totals activityTotals
+	for _, slot := range slots {
+		i, ok := index[bucketer.start(time.Unix(slot.Slot*activitySlotSeconds, 0)).Unix()]
+		if !ok {
+			continue
+		}
+		switch slot.Kind {
+		case "submitted":
+			buckets[i].Submitted += slot.Count
+			totals.Submitted += slot.Count
+		case "completed":
+			buckets[i].Completed += slot.Count
+			totals.Completed += slot.Count
+		case "failed":
+			buckets[i].Failed += slot.Count
+			totals.Failed += slot.Count
+		}
+	}
+
+	Success(c, gin.H{
+		"granularity": granularity,
+		"tz":          loc.String(),
+		"days":        days,
+		"from":        from,
+		"to":          now.In(loc),
+		"buckets":     buckets,
+		"totals":      totals,
+	})
+}
+
+type activitySlot struct {
+	Slot  int64
+	Kind  string
+	Count int64
+}
+
+// queryActivitySlots 用一次 GROUP BY 按 15 分钟（UTC）统计各类任务数：提交按 created_at，
+// 完成按 completed_at；失败任务不记录结束时间，按 created_at 统计。含已删除到回收站的任务
+func queryActivitySlots(from time.Time) ([]activitySlot, error) {
+	var slots []activitySlot
+	err := model.DB.Raw(`SELECT slot, kind, COUNT(*) AS count FROM (
+		SELECT CAST(strftime('%s', created_at) AS INTEGER) / ? AS slot, 'submitted' AS kind FROM tasks WHERE created_at >= ?
+		UNION ALL
+		SELECT CAST(strftime('%s', completed_at) AS INTEGER) / ?, 'completed' FROM tasks WHERE status = 'completed' AND completed_at >= ?
+		UNION ALL
+		SELECT CAST(strftime('%s', created_at) AS INTEGER) / ?, 'failed' FROM tasks WHERE status = 'failed' AND created_at >= ?
+	) GROUP BY slot, kind`,
+		activitySlotSeconds, from, activitySlotSeconds, from, activitySlotSeconds, from).
+		Scan(&slots).Error
+	return slots, err
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// TestActivityBucketerDST 夏令时切换当天按本地日历分桶：日桶为 23 或 25 小时，
+// 跳过的本地小时不产生桶，回拨时重复的本地小时分为两个桶
+func TestActivityBucketerDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := activityBucketer{loc: loc}
+	hour := activityBucketer{hourly: true, loc: loc}
+	// 2026-03-08 02:00 EST 拨快到 03:00 EDT；2026-11-01 02:00 EDT 回拨到 01:00 EST
+	springMidnight := time.Date(2026, 3, 8, 0, 0, 0, 0, loc)
+	fallMidnight := time.Date(2026, 11, 1, 0, 0, 0, 0, loc)
+
+	cases := []struct {
+		name      string
+		bucketer  activityBucketer
+		at        time.Time // UTC 时刻
+		wantStart time.Time
+		wantSpan  time.Duration // 桶的实际时长
+	}{
+		{"拨快当天的日桶", day, time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC), springMidnight, 23 * time.Hour},
+		{"拨快前一刻属于当天", day, time.Date(2026, 3, 8, 6, 59, 59, 0, time.UTC), springMidnight, 23 * time.Hour},
+		{"拨快后次日零点起新桶", day, time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 0, 0, 0, 0, loc), 24 * time.Hour},
+		{"回拨当天的日桶", day, time.Date(2026, 11, 1, 12, 0, 0, 0, time.UTC), fallMidnight, 25 * time.Hour},
+		{"回拨当天最后一刻", day, time.Date(2026, 11, 2, 4, 59, 59, 0, time.UTC), fallMidnight, 25 * time.Hour},
+		{"拨快前的 01 点", hour, time.Date(2026, 3, 8, 6, 30, 0, 0, time.UTC), time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC), time.Hour},
+		{"拨快后的 03 点", hour, time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC), time.Hour},
+		{"回拨前的 01 点 EDT", hour, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC), time.Hour},
+		{"回拨后的 01 点 EST", hour, time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC), time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := tc.bucketer.start(tc.at)
+			if !start.Equal(tc.wantStart) {
+				t.Fatalf("桶起点 = %s，期望 %s", start, tc.wantStart.In(loc))
+			}
+			if span := tc.bucketer.next(start).Sub(start); span != tc.wantSpan {
+				t.Fatalf("桶时长 = %s，期望 %s", span, tc.wantSpan)
+			}
+		})
+	}
+
+	// 逐小时遍历两个切换日：拨快当天只有 23 个小时桶、回拨当天有 25 个，且没有重复的起点
+	for _, tc := range []struct {
+		name     string
+		midnight time.Time
+		want     int
+	}{
+		{"拨快当天", springMidnight, 23},
+		{"回拨当天", fallMidnight, 25},
+	} {
+		end := day.next(tc.midnight)
+		seen := map[int64]bool{}
+		n := 0
+		for start := tc.midnight; start.Before(end); start = hour.next(start) {
+			if seen[start.Unix()] {
+				t.Fatalf("%s: 小时桶 %s 重复", tc.name, start)
+			}
+			seen[start.Unix()] = true
+			n++
+		}
+		if n != tc.want {
+			t.Fatalf("%s: 小时桶数 = %d，期望 %d", tc.name, n, tc.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultProviderStatsDays = 7
+	// maxProviderStatsDays 统计窗口上限，避免对 tasks 表做无界扫描
+	maxProviderStatsDays = 90
+	// providerStatsTTL 统计结果的缓存时间
+	providerStatsTTL = 30 * time.Second
+)
+
+// providerModelStats 某个 Provider 下某个模型在统计窗口内的表现
+type providerModelStats struct {
+	Provider    string           `json:"provider"`
+	Model       string           `json:"model"`
+	Attempts    int64            `json:"attempts"` // 已结束（成功或失败）的任务数
+	Successes   int64            `json:"successes"`
+	Failures    int64            `json:"failures"`
+	SuccessRate float64          `json:"success_rate"`
+	FailuresBy  map[string]int64 `json:"failures_by_class"` // 按错误分类统计的失败数，未分类的记为 unknown
+	DurationP50 int64            `json:"duration_p50_ms"`   // 成功任务从创建到完成的耗时（含排队）
+	DurationP95 int64            `json:"duration_p95_ms"`
+	AvgWidth    float64          `json:"avg_width"`
+	AvgHeight   float64          `json:"avg_height"`
+}
+
+type providerStatsReport struct {
+	Days        int                   `json:"days"`
+	From        time.Time             `json:"from"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	Models      []*providerModelStats `json:"models"`
+}
+
+type providerStatsEntry struct {
+	report    *providerStatsReport
+	expiresAt time.Time
+}
+
+var (
+	providerStatsMu    sync.Mutex
+	providerStatsCache = make(map[string]providerStatsEntry)
+)
+
+// ProviderStatsHandler 按 Provider 与模型统计最近 days 天（最多 90 天）生成任务的尝试、成功、按错误分类的失败次数，
+// p50 / p95 生成耗时与平均图片大小，结果短暂缓存
+func ProviderStatsHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultProviderStatsDays)))
+	if err != nil || days < 1 || days > maxProviderStatsDays {
+		verr := &provider.ValidationError{}
+		verr.Add("days", fmt.Sprintf("days 取值范围为 1 ~ %d", maxProviderStatsDays), nil, c.Query("days"))
+		ValidationFailed(c, verr)
+		return
+	}
+	providerName := strings.TrimSpace(c.Query("provider"))
+
+	key := fmt.Sprintf("%d|%s", days, providerName)
+	now := time.Now()
+	providerStatsMu.Lock()
+	entry, ok := providerStatsCache[key]
+	providerStatsMu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		Success(c, entry.report)
+		return
+	}
+
+	report, err := buildProviderStats(days, providerName, now)
+	if err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "统计 Provider 数据失败")
+		return
+	}
+	providerStatsMu.Lock()
+	for k, e := range providerStatsCache {
+		if !now.Before(e.expiresAt) {
+			delete(providerStatsCache, k)
+		}
+	}
+	providerStatsCache[key] = providerStatsEntry{report: report, expiresAt: now.Add(providerStatsTTL)}
+	providerStatsMu.Unlock()
+	Success(c, report)
+}
+
+type providerStatsRow struct {
+	ProviderName string
+	ModelID      string
+	Status       string
+	ErrorClass   string
+	Count        int64
+	SumWidth     int64
+	SumHeight    int64
+	Sized        int64
+}
+
+type providerDurationRow struct {
+	ProviderName string
+	ModelID      string
+	Duration     float64 // 天，与 model.TaskSortDuration 一致
+}
+
+// buildProviderStats 汇总统计窗口内已结束的生图任务：计数与尺寸用一次 GROUP BY 完成，
+// 耗时分位数需要逐条耗时，按 Provider 与模型排序后在内存中计算
+func buildProviderStats(days int, providerName string, now time.Time) (*providerStatsReport, error) {
+	from := now.AddDate(0, 0, -days)
+	base := func() *gorm.DB {
+		q := model.DB.Model(&model.Task{}).
+			Where("task_type = ? AND created_at >= ? AND status IN ?", "generate", from, []string{"completed", "failed"})
+		if providerName != "" {
+			q = q.Where("provider_name = ?", providerName)
+		}
+		return q
+	}
+
+	var rows []providerStatsRow
+	if err := base().
+		Select("provider_name, model_id, status, error_class, COUNT(*) AS count, " +
+			"SUM(CASE WHEN width > 0 AND height > 0 THEN width ELSE 0 END) AS sum_width, " +
+			"SUM(CASE WHEN width > 0 AND height > 0 THEN height ELSE 0 END) AS sum_height, " +
+			"SUM(CASE WHEN width > 0 AND height > 0 THEN 1 ELSE 0 END) AS sized").
+		Group("provider_name, model_id, status, error_class").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var durations []providerDurationRow
+	if err := base().
+		Select("provider_name, model_id, "+model.TaskSortDuration+" AS duration").
+		Where("status = ? AND completed_at IS NOT NULL", "completed").
+		Order("provider_name, model_id, duration").
+		Scan(&durations).Error; err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*providerModelStats)
+	get := func(providerName, modelID string) *providerModelStats {
+		key := providerName + "\x00" + modelID
+		s, ok := stats[key]
+		if !ok {
+			s = &providerModelStats{Provider: providerName, Model: modelID, FailuresBy: map[string]int64{}}
+			stats[key] = s
+		}
+		return s
+	}
+	sized := make(map[*providerModelStats]int64)
+	for _, row := range rows {
+		s := get(row.ProviderName, row.ModelID)
+		s.Attempts += row.Count
+		if row.Status == "completed" {
+			s.Successes += row.Count
+			s.AvgWidth += float64(row.SumWidth)
+			s.AvgHeight += float64(row.SumHeight)
+			sized[s] += row.Sized
+			continue
+		}
+		s.Failures += row.Count
+		class := row.ErrorClass
+		if class == "" {
+			class = "unknown"
+		}
+		s.FailuresBy[class] += row.Count
+	}
+
+	for start := 0; start < len(durations); {
+		end := start
+		for end < len(durations) && durations[end].ProviderName == durations[start].ProviderName && durations[end].ModelID == durations[start].ModelID {
+			end++
+		}
+		s := get(durations[start].ProviderName, durations[start].ModelID)
+		s.DurationP50 = durationPercentile(durations[start:end], 0.5)
+		s.DurationP95 = durationPercentile(durations[start:end], 0.95)
+		start = end
+	}
+
+	report := &providerStatsReport{Days: days, From: from, GeneratedAt: now, Models: make([]*providerModelStats, 0, len(stats))}
+	for _, s := range stats {
+		if n := sized[s]; n > 0 {
+			s.AvgWidth = math.Round(s.AvgWidth / float64(n))
+			s.AvgHeight = math.Round(s.AvgHeight / float64(n))
+		} else {
+			s.AvgWidth, s.AvgHeight = 0, 0
+		}
+		if s.Attempts > 0 {
+			s.SuccessRate = math.Round(float64(s.Successes)/float64(s.Attempts)*10000) / 10000
+		}
+		report.Models = append(report.Models, s)
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		if report.Models[i].Provider != report.Models[j].Provider {
+			return report.Models[i].Provider < report.Models[j].Provider
+		}
+		return report.Models[i].Model < report.Models[j].Model
+	})
+	return report, nil
+}
+
+// durationPercentile 取已升序排列的耗时的 p 分位（最近秩法），返回毫秒
+func durationPercentile(sorted []providerDurationRow, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return int64(math.Round(sorted[rank].Duration * 24 * 3600 * 1000))
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RejectWhenStorageUnavailable 挂在会产生新任务的接口上：存储目录不可写或磁盘空间不足时直接返回 503，
+// 而不是等任务生成完成后在保存时逐个失败；条件恢复后自动放行
+func RejectWhenStorageUnavailable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := storage.CurrentHealth()
+		if health.Available {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(30))
+		c.JSON(http.StatusServiceUnavailable, Response{
+			Code:      503,
+			Message:   health.Reason,
+			Data:      health,
+			ErrorCode: model.ErrCodeStorageUnavailable,
+		})
+		c.Abort()
+	}
+}
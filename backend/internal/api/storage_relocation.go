@@ -0,0 +1,527 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// SettingStorageDir 迁移完成后生效的图库目录，启动时优先于配置文件
+	SettingStorageDir = "storage.local_dir"
+	// settingStorageMigration 未完成的迁移任务，用于中断后恢复
+	settingStorageMigration = "storage.migration"
+
+	storageMigrationBatchSize = 200
+	// storageFreeSpaceReserve 目标磁盘在容纳现有图库之外需保留的空间
+	storageFreeSpaceReserve = 200 * 1024 * 1024
+)
+
+// storageMigrationState 持久化的迁移任务信息
+type storageMigrationState struct {
+	JobID     string    `json:"job_id"`
+	Source    string    `json:"source"`
+	Target    string    `json:"target"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// storageMigrationProgress 迁移任务进度
+// 阶段依次为 copy -> switch -> copy_delta -> update_db -> cleanup -> done
+type storageMigrationProgress struct {
+	JobID        string     `json:"job_id"`
+	Running      bool       `json:"running"`
+	Phase        string     `json:"phase"`
+	Source       string     `json:"source"`
+	Target       string     `json:"target"`
+	TotalFiles   int64      `json:"total_files"`
+	TotalBytes   int64      `json:"total_bytes"`
+	CopiedFiles  int64      `json:"copied_files"`
+	CopiedBytes  int64      `json:"copied_bytes"`
+	UpdatedRows  int64      `json:"updated_rows"`
+	MissingFiles int64      `json:"missing_files"`
+	DeletedFiles int64      `json:"deleted_files"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+var (
+	storageMigrationMu sync.Mutex
+	storageMigration   storageMigrationProgress
+)
+
+type storageDirRequest struct {
+	Path string `json:"path"`
+}
+
+// GetStorageDirHandler 返回当前图片库目录及进行中或最近一次迁移任务的进度
+func GetStorageDirHandler(c *gin.Context) {
+	storageMigrationMu.Lock()
+	progress := storageMigration
+	storageMigrationMu.Unlock()
+	Success(c, gin.H{
+		"storage_dir": storage.LocalDir(),
+		"migration":   progress,
+	})
+}
+
+// UpdateStorageDirHandler 校验新的图片库绝对路径并启动后台迁移：复制文件、切换存储、改写任务路径后删除旧文件，重复提交同一目录可续传中断的迁移
+func UpdateStorageDirHandler(c *gin.Context) {
+	var req storageDirRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	target := strings.TrimSpace(req.Path)
+	if target == "" || !filepath.IsAbs(target) {
+		Error(c, http.StatusBadRequest, 400, "path 必须是绝对路径")
+		return
+	}
+	target = filepath.Clean(target)
+
+	storageMigrationMu.Lock()
+	if storageMigration.Running {
+		progress := storageMigration
+		storageMigrationMu.Unlock()
+		c.JSON(http.StatusConflict, Response{Code: 409, Message: "存储目录迁移正在进行", Data: progress, ErrorCode: model.ErrCodeConflict})
+		return
+	}
+	storageMigrationMu.Unlock()
+
+	state, pending := loadStorageMigrationState()
+	if pending && state.Target != target {
+		Error(c, http.StatusConflict, 409, fmt.Sprintf("上次迁移到 %s 尚未完成，请先以相同目录重新提交以继续", state.Target))
+		return
+	}
+	if !pending {
+		source := storage.LocalDir()
+		if source == "" {
+			Error(c, http.StatusBadRequest, 400, "当前未启用本地存储")
+			return
+		}
+		if err := validateStorageTarget(source, target); err != nil {
+			Error(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+		state = &storageMigrationState{
+			JobID:     uuid.New().String(),
+			Source:    source,
+			Target:    target,
+			StartedAt: time.Now(),
+		}
+		data, _ := json.Marshal(state)
+		if err := model.SetSetting(settingStorageMigration, string(data)); err != nil {
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "保存迁移任务失败")
+			return
+		}
+	}
+
+	progress, started := startStorageMigration(state)
+	if !started {
+		c.JSON(http.StatusConflict, Response{Code: 409, Message: "存储目录迁移正在进行", Data: progress, ErrorCode: model.ErrCodeConflict})
+		return
+	}
+	Success(c, progress)
+}
+
+// ResumeStorageMigration 启动时检查是否有被中断的迁移任务，有则在后台继续
+func ResumeStorageMigration() {
+	state, pending := loadStorageMigrationState()
+	if !pending {
+		return
+	}
+	log.Printf("[Storage] 检测到未完成的存储目录迁移 %s: %s -> %s，继续执行", state.JobID, state.Source, state.Target)
+	startStorageMigration(state)
+}
+
+func loadStorageMigrationState() (*storageMigrationState, bool) {
+	raw, ok := model.GetSetting(settingStorageMigration)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil, false
+	}
+	var state storageMigrationState
+	if err := json.Unmarshal([]byte(raw), &state); err != nil || state.Source == "" || state.Target == "" {
+		log.Printf("[Storage] 迁移任务记录无效，已忽略: %v", err)
+		return nil, false
+	}
+	return &state, true
+}
+
+// validateStorageTarget 校验目标目录：不能与当前目录嵌套、必须可写且剩余空间足够
+func validateStorageTarget(source, target string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return fmt.Errorf("解析当前存储目录失败: %w", err)
+	}
+	if absSource == target {
+		return fmt.Errorf("新目录与当前存储目录相同")
+	}
+	if isSubPath(absSource, target) || isSubPath(target, absSource) {
+		return fmt.Errorf("新目录不能与当前存储目录互相嵌套")
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	probe, err := os.CreateTemp(target, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("目录不可写: %w", err)
+	}
+	probe.Close()
+	_ = os.Remove(probe.Name())
+
+	_, totalBytes, err := scanLibraryFiles(source)
+	if err != nil {
+		return fmt.Errorf("读取当前图库失败: %w", err)
+	}
+	free, err := storage.FreeSpace(target)
+	if err != nil {
+		return fmt.Errorf("获取磁盘剩余空间失败: %w", err)
+	}
+	if required := uint64(totalBytes) + storageFreeSpaceReserve; free < required {
+		return fmt.Errorf("磁盘剩余空间不足: 需要 %d MB，可用 %d MB", required>>20, free>>20)
+	}
+	return nil
+}
+
+func startStorageMigration(state *storageMigrationState) (storageMigrationProgress, bool) {
+	storageMigrationMu.Lock()
+	defer storageMigrationMu.Unlock()
+	if storageMigration.Running {
+		return storageMigration, false
+	}
+	now := time.Now()
+	storageMigration = storageMigrationProgress{
+		JobID:     state.JobID,
+		Running:   true,
+		Phase:     "copy",
+		Source:    state.Source,
+		Target:    state.Target,
+		StartedAt: &now,
+	}
+	go runStorageMigration(state)
+	return storageMigration, true
+}
+
+func setStorageMigrationPhase(phase string) {
+	storageMigrationMu.Lock()
+	storageMigration.Phase = phase
+	storageMigrationMu.Unlock()
+}
+
+// runStorageMigration 执行迁移。每个阶段都可重复执行：
+// 已复制且大小一致的文件会跳过，已改写的记录不再匹配旧目录，因此中断后从头重跑即可恢复。
+// 数据库只在新文件就绪后才指向新目录，旧文件在数据库改写完成后才删除。
+func runStorageMigration(state *storageMigrationState) {
+	log.Printf("[Storage] 开始迁移存储目录 %s: %s -> %s", state.JobID, state.Source, state.Target)
+	err := func() error {
+		if err := os.MkdirAll(state.Target, 0755); err != nil {
+			return fmt.Errorf("创建目标目录失败: %w", err)
+		}
+		if err := copyLibraryFiles(state.Source, state.Target); err != nil {
+			return err
+		}
+
+		// 切换存储目录后新生成的图片直接写入新目录
+		setStorageMigrationPhase("switch")
+		if err := model.SetSetting(SettingStorageDir, state.Target); err != nil {
+			return fmt.Errorf("保存存储目录失败: %w", err)
+		}
+		storage.SetLocalDir(state.Target)
+
+		// 补齐首轮复制到切换之间旧目录新增的文件
+		setStorageMigrationPhase("copy_delta")
+		if err := copyLibraryFiles(state.Source, state.Target); err != nil {
+			return err
+		}
+
+		setStorageMigrationPhase("update_db")
+		if err := relocateTaskPaths(state.Source, state.Target); err != nil {
+			return err
+		}
+
+		setStorageMigrationPhase("cleanup")
+		return removeMigratedFiles(state.Source, state.Target)
+	}()
+
+	now := time.Now()
+	storageMigrationMu.Lock()
+	storageMigration.Running = false
+	storageMigration.FinishedAt = &now
+	if err != nil {
+		storageMigration.LastError = err.Error()
+	} else {
+		storageMigration.Phase = "done"
+	}
+	progress := storageMigration
+	storageMigrationMu.Unlock()
+
+	if err != nil {
+		log.Printf("[Storage] 存储目录迁移 %s 中断（可重新提交继续）: %v", state.JobID, err)
+		return
+	}
+	if err := model.DeleteSetting(settingStorageMigration); err != nil {
+		log.Printf("[Storage] 清理迁移任务记录失败: %v", err)
+	}
+	log.Printf("[Storage] 存储目录迁移完成: 复制 %d 个文件 (%d 字节), 更新 %d 条记录, 删除旧文件 %d 个, 缺失 %d 个",
+		progress.CopiedFiles, progress.CopiedBytes, progress.UpdatedRows, progress.DeletedFiles, progress.MissingFiles)
+}
+
+// isLibraryFile 只迁移图片与缩略图，跳过数据库、临时文件等
+func isLibraryFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	default:
+		return false
+	}
+}
+
+// scanLibraryFiles 列出图库目录下的图片文件（相对路径）及总大小
+func scanLibraryFiles(root string) ([]string, int64, error) {
+	var files []string
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !isLibraryFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, rel)
+		total += info.Size()
+		return nil
+	})
+	return files, total, err
+}
+
+func copyLibraryFiles(source, target string) error {
+	files, totalBytes, err := scanLibraryFiles(source)
+	if err != nil {
+		return fmt.Errorf("读取原存储目录失败: %w", err)
+	}
+	storageMigrationMu.Lock()
+	storageMigration.TotalFiles = int64(len(files))
+	storageMigration.TotalBytes = totalBytes
+	storageMigration.CopiedFiles = 0
+	storageMigration.CopiedBytes = 0
+	storageMigrationMu.Unlock()
+
+	for _, rel := range files {
+		size, err := copyLibraryFile(filepath.Join(source, rel), filepath.Join(target, rel))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 复制期间被删除的图片
+				continue
+			}
+			return fmt.Errorf("复制 %s 失败: %w", rel, err)
+		}
+		storageMigrationMu.Lock()
+		storageMigration.CopiedFiles++
+		storageMigration.CopiedBytes += size
+		storageMigrationMu.Unlock()
+	}
+	return nil
+}
+
+// copyLibraryFile 复制单个文件；目标已存在且大小一致时跳过，先写临时文件再重命名避免留下半个文件
+func copyLibraryFile(src, dst string) (int64, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Size() == srcInfo.Size() {
+		return srcInfo.Size(), nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	_ = os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+	return written, nil
+}
+
+// relocateTaskPaths 分批把指向旧目录的 local_path / thumbnail_path 改写到新目录
+// 只有新位置的文件确实存在时才改写，保证数据库不会指向缺失的文件
+func relocateTaskPaths(source, target string) error {
+	var batch []model.Task
+	return model.DB.Unscoped().Model(&model.Task{}).
+		Select("id", "task_id", "local_path", "thumbnail_path").
+		Where("local_path <> '' OR thumbnail_path <> ''").
+		FindInBatches(&batch, storageMigrationBatchSize, func(tx *gorm.DB, _ int) error {
+			var updated, missing int64
+			var touched []string
+			err := model.DB.Transaction(func(db *gorm.DB) error {
+				for _, task := range batch {
+					updates := map[string]interface{}{}
+					for column, path := range map[string]string{"local_path": task.LocalPath, "thumbnail_path": task.ThumbnailPath} {
+						newPath, ok := relocatedPath(path, source, target)
+						if !ok {
+							continue
+						}
+						if _, err := os.Stat(newPath); err != nil {
+							missing++
+							continue
+						}
+						updates[column] = newPath
+					}
+					if len(updates) == 0 {
+						continue
+					}
+					if err := db.Unscoped().Model(&model.Task{}).Where("id = ?", task.ID).Updates(updates).Error; err != nil {
+						return err
+					}
+					updated++
+					touched = append(touched, task.TaskID)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("更新任务路径失败: %w", err)
+			}
+			for _, taskID := range touched {
+				InvalidateTask(taskID)
+			}
+			storageMigrationMu.Lock()
+			storageMigration.UpdatedRows += updated
+			storageMigration.MissingFiles += missing
+			storageMigrationMu.Unlock()
+			return nil
+		}).Error
+}
+
+// relocatedPath 计算旧目录下的路径在新目录中的位置，不在旧目录下时返回 false
+func relocatedPath(path, source, target string) (string, bool) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	absSource, err := filepath.Abs(source)
+	if err != nil || !isSubPath(absSource, absPath) {
+		return "", false
+	}
+	rel, err := filepath.Rel(absSource, absPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(target, rel), true
+}
+
+// removeMigratedFiles 删除旧目录中已确认复制到新目录的图片
+func removeMigratedFiles(source, target string) error {
+	files, _, err := scanLibraryFiles(source)
+	if err != nil {
+		return fmt.Errorf("读取原存储目录失败: %w", err)
+	}
+	var deleted int64
+	for _, rel := range files {
+		src := filepath.Join(source, rel)
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			continue
+		}
+		dstInfo, err := os.Stat(filepath.Join(target, rel))
+		if err != nil || dstInfo.Size() != srcInfo.Size() {
+			continue
+		}
+		if err := os.Remove(src); err != nil {
+			log.Printf("[Storage] 删除旧文件 %s 失败: %v", src, err)
+			continue
+		}
+		deleted++
+	}
+	storageMigrationMu.Lock()
+	storageMigration.DeletedFiles += deleted
+	storageMigrationMu.Unlock()
+	return nil
+}
+
+// isSubPath 判断 path 是否位于 root 之内（含 root 本身）
+func isSubPath(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// ServeLibraryFileHandler 迁移后任务路径为绝对路径且前端原样请求，当前存储目录内未匹配路由的 GET 请求由此从磁盘返回文件
+func ServeLibraryFileHandler(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return
+	}
+	dir := storage.LocalDir()
+	if dir == "" || !filepath.IsAbs(dir) {
+		return
+	}
+	requested := strings.TrimPrefix(c.Request.URL.Path, "/")
+	if runtime.GOOS != "windows" {
+		requested = "/" + requested
+	}
+	path := filepath.Clean(filepath.FromSlash(requested))
+	if !filepath.IsAbs(path) || !isSubPath(dir, path) || !isLibraryFile(path) {
+		return
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return
+	}
+	c.Header("Cache-Control", storage.CacheControl(path))
+	c.File(path)
+}
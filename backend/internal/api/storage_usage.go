@@ -0,0 +1,216 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// storageUsageCacheTTL 目录遍历结果的缓存时间
+	storageUsageCacheTTL = 5 * time.Minute
+	// storageUsageMinRescan refresh=true 强制重新遍历的最小间隔，防止频繁遍历大目录
+	storageUsageMinRescan = 30 * time.Second
+	// storageUsageRemoteLimit 最多统计的 OSS 对象数量
+	storageUsageRemoteLimit = 100000
+	defaultStorageUsageTop  = 10
+	maxStorageUsageTop      = 100
+)
+
+// storageUsageCategory 单类文件占用；Source 为 database 时来自任务表中记录的文件大小，walk 时来自目录遍历
+type storageUsageCategory struct {
+	storage.UsageCategory
+	Source string `json:"source"`
+}
+
+// largestTask 占用空间最大的任务
+type largestTask struct {
+	TaskID        string    `json:"task_id"`
+	Prompt        string    `json:"prompt"`
+	FileSize      int64     `json:"file_size"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	ThumbnailPath string    `json:"thumbnail_path"`
+	ThumbnailURL  string    `json:"thumbnail_url"`
+	ThumbnailSrc  string    `gorm:"-" json:"thumbnail_src,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// storageRemoteUsage OSS 占用，未配置 OSS 时 Enabled 为 false
+type storageRemoteUsage struct {
+	Enabled bool `json:"enabled"`
+	*storage.RemoteUsage
+	Error string `json:"error,omitempty"`
+}
+
+// storageUsage GET /storage/usage 的响应
+type storageUsage struct {
+	StorageDir   string                          `json:"storage_dir"`
+	TotalBytes   int64                           `json:"total_bytes"`
+	TotalFiles   int                             `json:"total_files"`
+	FreeBytes    uint64                          `json:"free_bytes,omitempty"`
+	Categories   map[string]storageUsageCategory `json:"categories"`
+	LargestTasks []largestTask                   `json:"largest_tasks"`
+	Remote       storageRemoteUsage              `json:"remote"`
+	ScannedAt    *time.Time                      `json:"scanned_at,omitempty"`
+	ScanDuration int64                           `json:"scan_duration_ms"`
+	Cached       bool                            `json:"cached"`
+	ScanError    string                          `json:"scan_error,omitempty"`
+	NextRescanAt *time.Time                      `json:"next_rescan_at,omitempty"`
+}
+
+// storageUsageSnapshot 缓存的目录遍历与 OSS 统计结果
+type storageUsageSnapshot struct {
+	dir      string
+	local    storage.LocalUsage
+	localErr error
+	remote   storageRemoteUsage
+	at       time.Time
+}
+
+var (
+	// storageUsageMu 同时保证同一时间只有一个遍历在运行，并发请求等待后直接使用新结果
+	storageUsageMu    sync.Mutex
+	storageUsageCache *storageUsageSnapshot
+)
+
+// GetStorageUsageHandler 返回图片库按类别划分的磁盘用量、占用最大的任务与 OSS 对象数；目录扫描结果缓存几分钟，
+// refresh=true 强制重新扫描（刚扫描过时除外）
+func GetStorageUsageHandler(c *gin.Context) {
+	top := defaultStorageUsageTop
+	if value := c.Query("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			Error(c, http.StatusBadRequest, 400, "top 参数无效")
+			return
+		}
+		top = min(n, maxStorageUsageTop)
+	}
+	refresh := c.Query("refresh") == "true" || c.Query("refresh") == "1"
+
+	snapshot, cached := loadStorageUsageSnapshot(refresh)
+	usage := storageUsage{
+		StorageDir:   snapshot.dir,
+		Categories:   make(map[string]storageUsageCategory),
+		LargestTasks: []largestTask{},
+		Remote:       snapshot.remote,
+		Cached:       cached,
+	}
+	if snapshot.localErr == nil {
+		scannedAt := snapshot.local.ScannedAt
+		next := snapshot.at.Add(storageUsageMinRescan)
+		usage.ScannedAt = &scannedAt
+		usage.ScanDuration = snapshot.local.Duration
+		usage.NextRescanAt = &next
+		usage.Categories["originals"] = storageUsageCategory{snapshot.local.Originals, "walk"}
+		usage.Categories["thumbnails"] = storageUsageCategory{snapshot.local.Thumbnails, "walk"}
+		usage.Categories["references"] = storageUsageCategory{snapshot.local.References, "walk"}
+		usage.Categories["temp"] = storageUsageCategory{snapshot.local.Temp, "walk"}
+	} else {
+		usage.ScanError = snapshot.localErr.Error()
+	}
+
+	// 任务表中的文件大小随任务写入维护，缓存期间有新任务时比遍历结果更新
+	if originals, ok := databaseOriginalsUsage(); ok {
+		usage.Categories["originals"] = storageUsageCategory{originals, "database"}
+	}
+	if references, ok := databaseReferencesUsage(); ok && snapshot.localErr != nil {
+		usage.Categories["references"] = storageUsageCategory{references, "database"}
+	}
+	for _, category := range usage.Categories {
+		usage.TotalBytes += category.Bytes
+		usage.TotalFiles += category.Files
+	}
+	if snapshot.dir != "" {
+		if free, err := storage.FreeSpace(snapshot.dir); err == nil {
+			usage.FreeBytes = free
+		}
+	}
+
+	if top > 0 {
+		if err := model.DB.Model(&model.Task{}).
+			Select("task_id, prompt, file_size, width, height, thumbnail_path, thumbnail_url, created_at").
+			Where("file_size > 0 AND archived_at IS NULL").
+			Order("file_size DESC").
+			Limit(top).
+			Scan(&usage.LargestTasks).Error; err != nil {
+			ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
+			return
+		}
+		for i := range usage.LargestTasks {
+			t := &usage.LargestTasks[i]
+			t.ThumbnailURL = model.RemoteURL(t.ThumbnailURL).Public()
+			t.ThumbnailSrc = model.ThumbnailSource(t.ThumbnailPath, model.RemoteURL(t.ThumbnailURL))
+		}
+	}
+	Success(c, usage)
+}
+
+// loadStorageUsageSnapshot 返回缓存的统计结果，缓存过期、存储目录已切换或强制刷新时重新遍历
+func loadStorageUsageSnapshot(refresh bool) (*storageUsageSnapshot, bool) {
+	storageUsageMu.Lock()
+	defer storageUsageMu.Unlock()
+
+	dir := storage.LocalDir()
+	if cached := storageUsageCache; cached != nil && cached.dir == dir {
+		age := time.Since(cached.at)
+		if age < storageUsageCacheTTL && (!refresh || age < storageUsageMinRescan) {
+			return cached, true
+		}
+	}
+
+	snapshot := &storageUsageSnapshot{dir: dir, at: time.Now()}
+	snapshot.local, snapshot.localErr = storage.ScanLocalUsage()
+	if snapshot.localErr != nil {
+		log.Printf("[Storage] 统计本地存储占用失败: %v", snapshot.localErr)
+	}
+	remote, err := storage.ScanRemoteUsage(storageUsageRemoteLimit)
+	snapshot.remote = storageRemoteUsage{Enabled: storage.RemoteEnabled(), RemoteUsage: remote}
+	if err != nil {
+		log.Printf("[Storage] 统计 OSS 对象失败: %v", err)
+		snapshot.remote.Error = err.Error()
+	}
+	storageUsageCache = snapshot
+	return snapshot, false
+}
+
+// databaseOriginalsUsage 按任务表记录的文件大小统计原图；存在未回填文件大小的本地图片时不可用
+func databaseOriginalsUsage() (storage.UsageCategory, bool) {
+	base := func() *gorm.DB {
+		return model.DB.Model(&model.Task{}).Where("local_path <> '' AND archived_at IS NULL")
+	}
+	var unknown int64
+	if err := base().Where("COALESCE(file_size, 0) = 0").Count(&unknown).Error; err != nil || unknown > 0 {
+		return storage.UsageCategory{}, false
+	}
+	var result struct {
+		Files int
+		Bytes int64
+	}
+	if err := base().Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").Scan(&result).Error; err != nil {
+		return storage.UsageCategory{}, false
+	}
+	return storage.UsageCategory{Files: result.Files, Bytes: result.Bytes}, true
+}
+
+// databaseReferencesUsage 按参考图记录统计，同一哈希的参考图共用一份文件，只计一次
+func databaseReferencesUsage() (storage.UsageCategory, bool) {
+	var result struct {
+		Files int
+		Bytes int64
+	}
+	if err := model.DB.Raw(`SELECT COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes FROM (
+			SELECT MAX(file_size) AS size FROM task_references WHERE path <> '' GROUP BY sha256)`).
+		Scan(&result).Error; err != nil {
+		return storage.UsageCategory{}, false
+	}
+	return storage.UsageCategory{Files: result.Files, Bytes: result.Bytes}, true
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/model"
+)
+
+const (
+	// taskCacheTTL 缓存兜底过期时间；正常情况下写路径会主动失效
+	taskCacheTTL        = 30 * time.Second
+	taskCacheMaxEntries = 2000
+)
+
+type taskCacheEntry struct {
+	task      model.Task
+	expiresAt time.Time
+}
+
+// taskCache 按 task_id 缓存任务记录，服务于详情查询与 SSE/WebSocket 轮询
+// 所有写路径必须在响应前调用 InvalidateTask，保证"先写后读"不会读到旧数据
+type taskCache struct {
+	mu      sync.Mutex
+	entries map[string]taskCacheEntry
+	// epoch 每次失效递增；读库前后 epoch 不一致说明期间有写入，本次结果不写回缓存
+	epoch  uint64
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+var taskCacheStore = &taskCache{entries: make(map[string]taskCacheEntry)}
+
+// TaskCacheStats 任务缓存命中统计
+type TaskCacheStats struct {
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	// Detail* 任务详情接口的响应缓存：命中缓存、合并到进行中查询、实际组装的次数
+	DetailHits      int64 `json:"detail_hits"`
+	DetailCoalesced int64 `json:"detail_coalesced"`
+	DetailLoads     int64 `json:"detail_loads"`
+}
+
+// GetTaskCacheStats 返回任务缓存的命中统计
+func GetTaskCacheStats() TaskCacheStats {
+	taskCacheStore.mu.Lock()
+	entries := len(taskCacheStore.entries)
+	taskCacheStore.mu.Unlock()
+
+	stats := TaskCacheStats{
+		Entries: entries,
+		Hits:    taskCacheStore.hits.Load(),
+		Misses:  taskCacheStore.misses.Load(),
+
+		DetailHits:      taskDetailStore.hits.Load(),
+		DetailCoalesced: taskDetailStore.coalesced.Load(),
+		DetailLoads:     taskDetailStore.loads.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// InvalidateTask 使指定任务的缓存失效并唤醒等待该任务的长轮询，供 Worker 更新通知与各写接口调用
+func InvalidateTask(taskID string) {
+	taskCacheStore.mu.Lock()
+	delete(taskCacheStore.entries, taskID)
+	taskCacheStore.epoch++
+	taskCacheStore.mu.Unlock()
+	taskDetailStore.invalidate(taskID)
+	notifyTaskWatchers(taskID)
+}
+
+// loadTask 优先从缓存读取任务，未命中时查库并写回缓存
+func loadTask(taskID string) (*model.Task, error) {
+	now := time.Now()
+	taskCacheStore.mu.Lock()
+	if entry, ok := taskCacheStore.entries[taskID]; ok && now.Before(entry.expiresAt) {
+		taskCacheStore.mu.Unlock()
+		taskCacheStore.hits.Add(1)
+		task := entry.task
+		return &task, nil
+	}
+	epoch := taskCacheStore.epoch
+	taskCacheStore.mu.Unlock()
+	taskCacheStore.misses.Add(1)
+
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", taskID).First(&task).Error; err != nil {
+		return nil, err
+	}
+
+	taskCacheStore.mu.Lock()
+	if taskCacheStore.epoch == epoch {
+		if len(taskCacheStore.entries) >= taskCacheMaxEntries {
+			taskCacheStore.evictLocked(now)
+		}
+		taskCacheStore.entries[taskID] = taskCacheEntry{task: task, expiresAt: now.Add(taskCacheTTL)}
+	}
+	taskCacheStore.mu.Unlock()
+	return &task, nil
+}
+
+// evictLocked 清理过期条目；仍然超限时整体清空（缓存只是加速层，清空不影响正确性）
+func (c *taskCache) evictLocked(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) >= taskCacheMaxEntries {
+		c.entries = make(map[string]taskCacheEntry)
+	}
+}
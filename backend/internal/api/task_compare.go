@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPromptDiffTokens 提示词超过该分词数量时不做逐词对比，避免 O(n*m) 的开销过大
+const maxPromptDiffTokens = 2000
+
+// paramChange 配置快照中发生变化的字段，Path 以点号连接嵌套键
+type paramChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+	// Kind: changed / added / removed
+	Kind string `json:"kind"`
+}
+
+// promptDiffOp 提示词对比片段：equal / insert / delete
+type promptDiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// imageComparison 两张图片的尺寸与大小对比，Delta 为 B 相对 A 的变化
+type imageComparison struct {
+	A     imageStats `json:"a"`
+	B     imageStats `json:"b"`
+	Delta imageStats `json:"delta"`
+}
+
+type imageStats struct {
+	Width    int   `json:"width"`
+	Height   int   `json:"height"`
+	FileSize int64 `json:"file_size"`
+}
+
+// taskComparison A/B 对比结果
+type taskComparison struct {
+	A            *model.Task     `json:"a"`
+	B            *model.Task     `json:"b"`
+	ParamChanges []paramChange   `json:"param_changes"`
+	PromptDiff   []promptDiffOp  `json:"prompt_diff"`
+	Image        imageComparison `json:"image"`
+}
+
+// CompareTasksHandler 并排返回两个任务，附配置快照差异、按词的提示词差异及图片尺寸对比
+func CompareTasksHandler(c *gin.Context) {
+	idA := strings.TrimSpace(c.Query("a"))
+	idB := strings.TrimSpace(c.Query("b"))
+	if idA == "" || idB == "" {
+		Error(c, http.StatusBadRequest, 400, "请通过 a 和 b 参数指定要对比的任务 ID")
+		return
+	}
+	taskA, err := loadTask(idA)
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到: "+idA)
+		return
+	}
+	taskB, err := loadTask(idB)
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到: "+idB)
+		return
+	}
+	Success(c, compareTasks(taskA, taskB))
+}
+
+func compareTasks(a, b *model.Task) taskComparison {
+	statsA := imageStats{Width: a.Width, Height: a.Height, FileSize: a.FileSize}
+	statsB := imageStats{Width: b.Width, Height: b.Height, FileSize: b.FileSize}
+	return taskComparison{
+		A:            a,
+		B:            b,
+		ParamChanges: diffSnapshots(a.ConfigSnapshot, b.ConfigSnapshot),
+		PromptDiff:   diffPromptWords(a.Prompt, b.Prompt),
+		Image: imageComparison{
+			A: statsA,
+			B: statsB,
+			Delta: imageStats{
+				Width:    statsB.Width - statsA.Width,
+				Height:   statsB.Height - statsA.Height,
+				FileSize: statsB.FileSize - statsA.FileSize,
+			},
+		},
+	}
+}
+
+// diffSnapshots 对比两个配置快照 JSON；无法解析为对象时整体作为 snapshot 字段比较
+func diffSnapshots(a, b string) []paramChange {
+	changes := make([]paramChange, 0)
+	objA, okA := parseSnapshotObject(a)
+	objB, okB := parseSnapshotObject(b)
+	if !okA || !okB {
+		if a != b {
+			changes = append(changes, paramChange{Path: "snapshot", Old: a, New: b, Kind: "changed"})
+		}
+		return changes
+	}
+	diffValues("", objA, objB, &changes)
+	return changes
+}
+
+func parseSnapshotObject(snapshot string) (map[string]interface{}, bool) {
+	if strings.TrimSpace(snapshot) == "" {
+		return map[string]interface{}{}, true
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(snapshot), &obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+// diffValues 递归对比 JSON 值：对象按键展开，数组与标量整体比较
+func diffValues(path string, a, b map[string]interface{}, changes *[]paramChange) {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		oldValue, inA := a[key]
+		newValue, inB := b[key]
+		switch {
+		case !inA:
+			*changes = append(*changes, paramChange{Path: keyPath, New: newValue, Kind: "added"})
+		case !inB:
+			*changes = append(*changes, paramChange{Path: keyPath, Old: oldValue, Kind: "removed"})
+		default:
+			oldObj, oldIsObj := oldValue.(map[string]interface{})
+			newObj, newIsObj := newValue.(map[string]interface{})
+			if oldIsObj && newIsObj {
+				diffValues(keyPath, oldObj, newObj, changes)
+			} else if !reflect.DeepEqual(oldValue, newValue) {
+				*changes = append(*changes, paramChange{Path: keyPath, Old: oldValue, New: newValue, Kind: "changed"})
+			}
+		}
+	}
+}
+
+// tokenizePrompt 按空白切分单词并保留空白；中日韩文字没有空格分词，逐字切分
+func tokenizePrompt(text string) []string {
+	var tokens []string
+	var current []rune
+	currentSpace := false
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, string(current))
+			current = current[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			if !currentSpace {
+				flush()
+			}
+			currentSpace = true
+			current = append(current, r)
+		default:
+			if currentSpace {
+				flush()
+			}
+			currentSpace = false
+			current = append(current, r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// diffPromptWords 基于最长公共子序列生成逐词差异，相邻同类片段合并
+func diffPromptWords(a, b string) []promptDiffOp {
+	tokensA := tokenizePrompt(a)
+	tokensB := tokenizePrompt(b)
+	if len(tokensA) > maxPromptDiffTokens || len(tokensB) > maxPromptDiffTokens {
+		if a == b {
+			return []promptDiffOp{{Op: "equal", Text: a}}
+		}
+		return []promptDiffOp{{Op: "delete", Text: a}, {Op: "insert", Text: b}}
+	}
+
+	n, m := len(tokensA), len(tokensB)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if tokensA[i] == tokensB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]promptDiffOp, 0)
+	appendOp := func(op, text string) {
+		if last := len(ops) - 1; last >= 0 && ops[last].Op == op {
+			ops[last].Text += text
+			return
+		}
+		ops = append(ops, promptDiffOp{Op: op, Text: text})
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case tokensA[i] == tokensB[j]:
+			appendOp("equal", tokensA[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			appendOp("delete", tokensA[i])
+			i++
+		default:
+			appendOp("insert", tokensB[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		appendOp("delete", tokensA[i])
+	}
+	for ; j < m; j++ {
+		appendOp("insert", tokensB[j])
+	}
+	return ops
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want []paramChange
+	}{
+		{"相同快照", `{"a":1,"n":{"x":[1,2]}}`, `{"n":{"x":[1,2]},"a":1}`, []paramChange{}},
+		{"两侧为空", ``, `  `, []paramChange{}},
+		{"空快照与对象", ``, `{"a":1}`, []paramChange{{Path: "a", New: 1.0, Kind: "added"}}},
+		{
+			"标量变化、新增与删除按键排序",
+			`{"b":"x","c":true,"d":null}`,
+			`{"a":2,"b":"y","d":null}`,
+			[]paramChange{
+				{Path: "a", New: 2.0, Kind: "added"},
+				{Path: "b", Old: "x", New: "y", Kind: "changed"},
+				{Path: "c", Old: true, Kind: "removed"},
+			},
+		},
+		{
+			"嵌套对象逐层展开",
+			`{"params":{"size":{"w":512,"h":512},"style":"a"}}`,
+			`{"params":{"size":{"w":1024,"h":512},"seed":7}}`,
+			[]paramChange{
+				{Path: "params.seed", New: 7.0, Kind: "added"},
+				{Path: "params.size.w", Old: 512.0, New: 1024.0, Kind: "changed"},
+				{Path: "params.style", Old: "a", Kind: "removed"},
+			},
+		},
+		{
+			"数组整体比较",
+			`{"tags":["a","b"],"refs":[{"id":1}]}`,
+			`{"tags":["b","a"],"refs":[{"id":1}]}`,
+			[]paramChange{{Path: "tags", Old: []interface{}{"a", "b"}, New: []interface{}{"b", "a"}, Kind: "changed"}},
+		},
+		{
+			"数组内嵌对象变化",
+			`{"refs":[{"id":1,"w":2}]}`,
+			`{"refs":[{"id":1,"w":3}]}`,
+			[]paramChange{{Path: "refs", Old: []interface{}{map[string]interface{}{"id": 1.0, "w": 2.0}}, New: []interface{}{map[string]interface{}{"id": 1.0, "w": 3.0}}, Kind: "changed"}},
+		},
+		{
+			"对象变为标量",
+			`{"size":{"w":1}}`,
+			`{"size":"1K"}`,
+			[]paramChange{{Path: "size", Old: map[string]interface{}{"w": 1.0}, New: "1K", Kind: "changed"}},
+		},
+		{
+			"嵌套对象变为空对象",
+			`{"extra":{"k":{"deep":1}}}`,
+			`{"extra":{}}`,
+			[]paramChange{{Path: "extra.k", Old: map[string]interface{}{"deep": 1.0}, Kind: "removed"}},
+		},
+		{"无法解析时整体比较", `not json`, `{"a":1}`, []paramChange{{Path: "snapshot", Old: "not json", New: `{"a":1}`, Kind: "changed"}}},
+		{"顶层为数组时整体比较", `[1]`, `[2]`, []paramChange{{Path: "snapshot", Old: "[1]", New: "[2]", Kind: "changed"}}},
+		{"无法解析但相同", `[1]`, `[1]`, []paramChange{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := diffSnapshots(tc.a, tc.b)
+			if !reflect.DeepEqual(got, tc.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tc.want)
+				t.Fatalf("diffSnapshots =\n%s\n期望\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestDiffPromptWords(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want []promptDiffOp
+	}{
+		{"相同", "a red fox", "a red fox", []promptDiffOp{{"equal", "a red fox"}}},
+		{"替换单词", "a red fox", "a blue fox", []promptDiffOp{{"equal", "a "}, {"delete", "red"}, {"insert", "blue"}, {"equal", " fox"}}},
+		{"追加", "cat", "cat, 4k", []promptDiffOp{{"delete", "cat"}, {"insert", "cat, 4k"}}},
+		{"中文逐字", "红色狐狸", "蓝色狐狸", []promptDiffOp{{"delete", "红"}, {"insert", "蓝"}, {"equal", "色狐狸"}}},
+		{"空提示词", "", "new", []promptDiffOp{{"insert", "new"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := diffPromptWords(tc.a, tc.b); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("diffPromptWords = %+v，期望 %+v", got, tc.want)
+			}
+		})
+	}
+
+	long := strings.Repeat("w ", maxPromptDiffTokens)
+	if got := diffPromptWords(long, long+"x"); len(got) != 2 || got[0].Op != "delete" || got[1].Op != "insert" {
+		t.Fatalf("超长提示词应整体替换，实际 %d 段", len(got))
+	}
+}
+
+func TestCompareTasksHandler(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	testutil.CreateTask(t, &model.Task{TaskID: "cmp-a", Prompt: "a red fox", Width: 512, Height: 512, FileSize: 100,
+		ConfigSnapshot: `{"params":{"aspect_ratio":"1:1"}}`})
+	testutil.CreateTask(t, &model.Task{TaskID: "cmp-b", Prompt: "a blue fox", Width: 1024, Height: 512, FileSize: 80,
+		ConfigSnapshot: `{"params":{"aspect_ratio":"2:1"}}`})
+
+	rec := performJSON(t, http.MethodGet, "/tasks/compare", "/tasks/compare?a=cmp-a&b=cmp-b", nil, CompareTasksHandler)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("对比失败 %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data taskComparison `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.ParamChanges) != 1 || resp.Data.ParamChanges[0].Path != "params.aspect_ratio" {
+		t.Fatalf("param_changes = %+v", resp.Data.ParamChanges)
+	}
+	if d := resp.Data.Image.Delta; d.Width != 512 || d.Height != 0 || d.FileSize != -20 {
+		t.Fatalf("image.delta = %+v", d)
+	}
+
+	rec = performJSON(t, http.MethodGet, "/tasks/compare", "/tasks/compare?a=cmp-a", nil, CompareTasksHandler)
+	expectError(t, rec, http.StatusBadRequest, model.ErrCodeValidationFailed)
+	rec = performJSON(t, http.MethodGet, "/tasks/compare", "/tasks/compare?a=cmp-a&b=missing", nil, CompareTasksHandler)
+	expectError(t, rec, http.StatusNotFound, model.ErrCodeTaskNotFound)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/model"
+)
+
+// taskDetailTTL 任务详情响应的缓存时间。旧版前端每张卡片每 500ms 轮询一次详情，
+// 短暂缓存即可让同一任务的并发轮询共用一次查询；任务写入时会立即失效，不影响状态变化的及时性
+const taskDetailTTL = 250 * time.Millisecond
+
+var errTaskDetailAborted = errors.New("加载任务详情失败")
+
+// taskDetailCall 一次正在进行的详情查询，同一任务的并发请求等待并共用其结果
+type taskDetailCall struct {
+	done chan struct{}
+	view *taskView
+	err  error
+}
+
+type taskDetailEntry struct {
+	view      *taskView
+	expiresAt time.Time
+}
+
+// taskDetailCache 缓存 GetTaskHandler 组装好的完整响应（含事件、排队信息、参考图与标签），
+// 并合并同一任务的并发查询。缓存的 taskView 在多个请求间共享，只能读取不能修改
+type taskDetailCache struct {
+	mu      sync.Mutex
+	entries map[string]taskDetailEntry
+	calls   map[string]*taskDetailCall
+
+	hits      atomic.Int64
+	coalesced atomic.Int64
+	loads     atomic.Int64
+}
+
+var taskDetailStore = &taskDetailCache{
+	entries: make(map[string]taskDetailEntry),
+	calls:   make(map[string]*taskDetailCall),
+}
+
+// invalidate 删除缓存并让进行中的查询不再被新请求复用，其结果也不会写回缓存
+func (c *taskDetailCache) invalidate(taskID string) {
+	c.mu.Lock()
+	delete(c.entries, taskID)
+	delete(c.calls, taskID)
+	c.mu.Unlock()
+}
+
+// load 返回任务详情：命中缓存直接返回，已有相同任务的查询在进行时等待其结果，否则发起查询
+func (c *taskDetailCache) load(taskID string) (*taskView, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if entry, ok := c.entries[taskID]; ok && now.Before(entry.expiresAt) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return entry.view, nil
+	}
+	if call, ok := c.calls[taskID]; ok {
+		c.mu.Unlock()
+		c.coalesced.Add(1)
+		<-call.done
+		return call.view, call.err
+	}
+	// err 预置为失败，组装过程 panic 时等待者也能拿到错误返回
+	call := &taskDetailCall{done: make(chan struct{}), err: errTaskDetailAborted}
+	c.calls[taskID] = call
+	if len(c.entries) >= taskCacheMaxEntries {
+		c.evictLocked(now)
+	}
+	c.mu.Unlock()
+	c.loads.Add(1)
+
+	defer c.finish(taskID, call)
+	call.view, call.err = buildTaskDetail(taskID)
+	return call.view, call.err
+}
+
+// finish 唤醒等待者并写回缓存。查询期间任务被写入时 calls 中的记录已被 invalidate 删除，
+// 此时结果可能已过时，不写回缓存
+func (c *taskDetailCache) finish(taskID string, call *taskDetailCall) {
+	close(call.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[taskID] != call {
+		return
+	}
+	delete(c.calls, taskID)
+	if call.err == nil {
+		c.entries[taskID] = taskDetailEntry{view: call.view, expiresAt: time.Now().Add(taskDetailTTL)}
+	}
+}
+
+func (c *taskDetailCache) evictLocked(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// buildTaskDetail 组装任务详情响应
+func buildTaskDetail(taskID string) (*taskView, error) {
+	task, err := loadTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	view := buildTaskView(task)
+	view.References = loadTaskReferences(task.TaskID)
+	tagged := []model.Task{view.Task}
+	attachTaskTags(model.DB, tagged)
+	view.Tags = tagged[0].Tags
+	return view, nil
+}
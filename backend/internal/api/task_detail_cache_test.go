@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/testutil"
+
+	"gorm.io/gorm"
+)
+
+// countQueries 统计之后经 model.DB 发出的查询语句数
+func countQueries(t *testing.T) *atomic.Int64 {
+	t.Helper()
+	var n atomic.Int64
+	count := func(*gorm.DB) { n.Add(1) }
+	if err := model.DB.Callback().Query().After("gorm:query").Register("test:count_query", count); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Callback().Row().After("gorm:row").Register("test:count_row", count); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Callback().Raw().After("gorm:raw").Register("test:count_raw", count); err != nil {
+		t.Fatal(err)
+	}
+	return &n
+}
+
+func getTaskDetail(t *testing.T, taskID string) taskView {
+	t.Helper()
+	rec := performJSON(t, http.MethodGet, "/api/v1/tasks/:task_id", "/api/v1/tasks/"+taskID, nil, GetTaskHandler)
+	resp := decodeResponse(t, rec)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("查询任务详情 %d: %s", rec.Code, resp.Message)
+	}
+	data, _ := json.Marshal(resp.Data)
+	var view taskView
+	if err := json.Unmarshal(data, &view); err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+// TestTaskDetailCacheQueries 重复查询同一任务详情只在首次查库，任务写入后缓存失效并重新查询，
+// 并发查询合并为一次加载
+func TestTaskDetailCacheQueries(t *testing.T) {
+	testutil.Setup(t, testutil.Options{NoPool: true})
+	task := testutil.CreateTask(t, &model.Task{TaskID: "detail-cache", Status: "processing"})
+	InvalidateTask(task.TaskID)
+	queries := countQueries(t)
+
+	getTaskDetail(t, task.TaskID)
+	perLoad := queries.Load()
+	if perLoad == 0 {
+		t.Fatal("首次查询详情未查库")
+	}
+	for i := 0; i < 20; i++ {
+		getTaskDetail(t, task.TaskID)
+	}
+	if n := queries.Load(); n != perLoad {
+		t.Fatalf("重复查询 20 次共查库 %d 次，期望只有首次的 %d 次", n, perLoad)
+	}
+
+	// 任务写入后 Worker 通知失效，下一次查询读到新状态
+	if err := model.DB.Model(&model.Task{}).Where("task_id = ?", task.TaskID).Update("status", "completed").Error; err != nil {
+		t.Fatal(err)
+	}
+	InvalidateTask(task.TaskID)
+	queries.Store(0)
+	if view := getTaskDetail(t, task.TaskID); view.Status != "completed" {
+		t.Fatalf("失效后详情状态 = %s，期望 completed", view.Status)
+	}
+	if n := queries.Load(); n != perLoad {
+		t.Fatalf("失效后查库 %d 次，期望 %d 次", n, perLoad)
+	}
+
+	InvalidateTask(task.TaskID)
+	queries.Store(0)
+	loads := taskDetailStore.loads.Load()
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := performJSON(t, http.MethodGet, "/api/v1/tasks/:task_id", "/api/v1/tasks/"+task.TaskID, nil, GetTaskHandler)
+			if rec.Code != http.StatusOK {
+				t.Errorf("并发查询任务详情 %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := taskDetailStore.loads.Load() - loads; n > 2 {
+		t.Fatalf("32 个并发查询加载了 %d 次，期望合并为一次", n)
+	}
+	if n := queries.Load(); n > 2*perLoad {
+		t.Fatalf("32 个并发查询共查库 %d 次", n)
+	}
+}
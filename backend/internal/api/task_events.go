@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTaskEventsHandler 返回任务的处理时间线，按时间正序
+func GetTaskEventsHandler(c *gin.Context) {
+	taskID := c.Param("task_id")
+	var count int64
+	if err := model.DB.Model(&model.Task{}).Where("task_id = ?", taskID).Count(&count).Error; err != nil || count == 0 {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
+		return
+	}
+
+	var events []model.TaskEvent
+	if err := model.DB.Where("task_id = ?", taskID).Order("id ASC").Find(&events).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询任务事件失败")
+		return
+	}
+	Success(c, gin.H{
+		"task_id": taskID,
+		"events":  events,
+	})
+}
+
+// latestTaskEvent 返回任务最近一条事件，没有记录时返回 nil
+func latestTaskEvent(taskID string) *model.TaskEvent {
+	var event model.TaskEvent
+	if err := model.DB.Where("task_id = ?", taskID).Order("id DESC").Limit(1).Find(&event).Error; err != nil || event.ID == 0 {
+		return nil
+	}
+	return &event
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+)
+
+// taskLeaseCheckInterval 续期租约与检查过期租约的间隔，自动取消的实际宽限时间会多出最多一个间隔
+const taskLeaseCheckInterval = 5 * time.Second
+
+// taskLeaseStatuses 可被自动取消的状态；处理中的任务从不自动取消
+var taskLeaseStatuses = []string{"pending", worker.StatusRateLimited}
+
+var (
+	taskLeaseMu sync.Mutex
+	// taskLeases 任务 -> 正在关注该任务的连接数（SSE、WebSocket 订阅与长轮询）
+	taskLeases = make(map[string]int)
+)
+
+func autoCancelGrace() time.Duration {
+	seconds := config.Get().Tasks.AutoCancelGraceSeconds
+	if seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// applyAutoCancel 为开启 auto_cancel_on_disconnect 的任务设置初始租约，客户端需在宽限时间内连接
+func applyAutoCancel(task *model.Task, enabled bool) {
+	if !enabled {
+		return
+	}
+	expiresAt := time.Now().Add(autoCancelGrace())
+	task.AutoCancel = true
+	task.LeaseExpiresAt = &expiresAt
+}
+
+// parseAutoCancel 解析表单中的 auto_cancel_on_disconnect，空值为 false
+func parseAutoCancel(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1":
+		return true
+	}
+	return false
+}
+
+// acquireTaskLease 登记一个关注该任务的连接，连接结束时调用返回的函数释放。
+// 只在内存中计数，续期由 StartTaskLeaseReaper 定期批量写入，断开与重连不产生数据库写入
+func acquireTaskLease(taskID string) func() {
+	taskLeaseMu.Lock()
+	taskLeases[taskID]++
+	taskLeaseMu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			taskLeaseMu.Lock()
+			defer taskLeaseMu.Unlock()
+			if taskLeases[taskID]--; taskLeases[taskID] <= 0 {
+				delete(taskLeases, taskID)
+			}
+		})
+	}
+}
+
+func taskLeaseHeld(taskID string) bool {
+	taskLeaseMu.Lock()
+	defer taskLeaseMu.Unlock()
+	return taskLeases[taskID] > 0
+}
+
+// StartTaskLeaseReaper 定期为有连接的 auto_cancel 排队任务续期，并取消租约已过期的任务。
+// 启动时先把所有租约顺延一个宽限时间，让重启前的客户端有机会重新连接
+func StartTaskLeaseReaper() {
+	expiresAt := time.Now().Add(autoCancelGrace())
+	if err := model.DB.Model(&model.Task{}).
+		Where("auto_cancel = ? AND status IN ?", true, taskLeaseStatuses).
+		Update("lease_expires_at", expiresAt).Error; err != nil {
+		log.Printf("[Lease] 顺延任务租约失败: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(taskLeaseCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reapTaskLeases(time.Now())
+		}
+	}()
+}
+
+func reapTaskLeases(now time.Time) {
+	var tasks []model.Task
+	if err := model.DB.Model(&model.Task{}).
+		Select("id", "task_id", "lease_expires_at").
+		Where("auto_cancel = ? AND status IN ?", true, taskLeaseStatuses).
+		Find(&tasks).Error; err != nil {
+		log.Printf("[Lease] 查询任务租约失败: %v", err)
+		return
+	}
+	var renew []uint
+	for _, task := range tasks {
+		if taskLeaseHeld(task.TaskID) {
+			renew = append(renew, task.ID)
+			continue
+		}
+		if task.LeaseExpiresAt != nil && now.Before(*task.LeaseExpiresAt) {
+			continue
+		}
+		abandonTask(task.TaskID)
+	}
+	if len(renew) > 0 {
+		if err := model.DB.Model(&model.Task{}).Where("id IN ?", renew).
+			Update("lease_expires_at", now.Add(autoCancelGrace())).Error; err != nil {
+			log.Printf("[Lease] 续期任务租约失败: %v", err)
+		}
+	}
+}
+
+// abandonTask 自动取消租约过期的排队任务；任务已开始处理时保持不变
+func abandonTask(taskID string) {
+	if !worker.Pool.CancelQueued(taskID, worker.ErrTaskAbandoned) {
+		return
+	}
+	result := model.DB.Model(&model.Task{}).
+		Where("task_id = ? AND status IN ?", taskID, taskLeaseStatuses).
+		Updates(map[string]interface{}{
+			"status":          "failed",
+			"error_message":   worker.ErrTaskAbandoned.Error(),
+			"error_code":      model.ErrCodeAbandoned,
+			"error_class":     provider.ErrorClassCancelled,
+			"next_attempt_at": nil,
+		})
+	if result.Error != nil {
+		log.Printf("[Lease] 自动取消任务 %s 失败: %v", taskID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	InvalidateTask(taskID)
+	worker.RecordTaskEvent(taskID, worker.EventFailed, "code=%s %v", model.ErrCodeAbandoned, worker.ErrTaskAbandoned)
+	log.Printf("[Lease] 任务 %s 的客户端已断开超过 %s，已自动取消", taskID, autoCancelGrace())
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLineageNodes 单棵派生树最多返回的任务数量
+const maxLineageNodes = 1000
+
+// lineageNode 派生树节点；Missing 表示该任务已被删除，仅保留 ID 以维持树结构
+type lineageNode struct {
+	TaskID        string         `json:"task_id"`
+	ParentTaskID  string         `json:"parent_task_id,omitempty"`
+	TaskType      string         `json:"task_type,omitempty"`
+	GroupID       string         `json:"group_id,omitempty"` // fanout=per_image 拆分出的任务所属分组；同组的其他任务各自是独立的派生树
+	Status        string         `json:"status,omitempty"`
+	Prompt        string         `json:"prompt,omitempty"`
+	ThumbnailURL  string         `json:"thumbnail_url,omitempty"`
+	ThumbnailPath string         `json:"thumbnail_path,omitempty"`
+	ThumbnailSrc  string         `json:"thumbnail_src,omitempty"`
+	Width         int            `json:"width,omitempty"`
+	Height        int            `json:"height,omitempty"`
+	CreatedAt     *time.Time     `json:"created_at,omitempty"`
+	Missing       bool           `json:"missing,omitempty"`
+	Children      []*lineageNode `json:"children"`
+}
+
+// taskLineage 派生树及当前任务到根节点的路径（从根到当前任务）
+type taskLineage struct {
+	RootTaskID string       `json:"root_task_id"`
+	Root       *lineageNode `json:"root"`
+	Path       []string     `json:"path"`
+	Total      int          `json:"total"`
+	Truncated  bool         `json:"truncated"`
+}
+
+// lineageRoot 返回派生任务应记录的 root_task_id
+func lineageRoot(parent *model.Task) string {
+	if parent.RootTaskID != "" {
+		return parent.RootTaskID
+	}
+	return parent.TaskID
+}
+
+// GetTaskLineageHandler 返回任务所属的完整派生树（编辑、放大、去背景等），已删除的祖先保留为标记 missing 的占位节点，保持树连通
+func GetTaskLineageHandler(c *gin.Context) {
+	task, err := loadTask(c.Param("task_id"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
+		return
+	}
+
+	rootID := lineageRoot(task)
+	var tasks []model.Task
+	if err := model.DB.Unscoped().
+		Where("task_id = ? OR root_task_id = ?", rootID, rootID).
+		Order("created_at ASC").
+		Limit(maxLineageNodes + 1).
+		Find(&tasks).Error; err != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "查询失败")
+		return
+	}
+	truncated := len(tasks) > maxLineageNodes
+	if truncated {
+		tasks = tasks[:maxLineageNodes]
+	}
+
+	lineage := buildLineage(rootID, task, tasks)
+	lineage.Truncated = truncated
+	Success(c, lineage)
+}
+
+func buildLineage(rootID string, current *model.Task, tasks []model.Task) taskLineage {
+	nodes := make(map[string]*lineageNode, len(tasks)+1)
+	for i := range tasks {
+		nodes[tasks[i].TaskID] = newLineageNode(&tasks[i])
+	}
+	if _, ok := nodes[current.TaskID]; !ok {
+		// 截断时当前任务可能不在查询结果中，补上以保证路径完整
+		nodes[current.TaskID] = newLineageNode(current)
+	}
+
+	// 来源任务已被物理删除时补一个占位节点，根节点缺失同理
+	if _, ok := nodes[rootID]; !ok {
+		nodes[rootID] = &lineageNode{TaskID: rootID, Missing: true, Children: []*lineageNode{}}
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		parentID := nodes[id].ParentTaskID
+		if id == rootID || parentID == "" {
+			continue
+		}
+		if _, ok := nodes[parentID]; !ok {
+			nodes[parentID] = &lineageNode{TaskID: parentID, ParentTaskID: rootID, Missing: true, Children: []*lineageNode{}}
+		}
+	}
+
+	for id, node := range nodes {
+		if id == rootID {
+			continue
+		}
+		parentID := node.ParentTaskID
+		if parentID == "" || parentID == id {
+			parentID = rootID
+		}
+		nodes[parentID].Children = append(nodes[parentID].Children, node)
+	}
+	for _, node := range nodes {
+		sortLineageChildren(node.Children)
+	}
+
+	var path []string
+	seen := make(map[string]bool)
+	for id := current.TaskID; id != "" && !seen[id]; {
+		seen[id] = true
+		path = append(path, id)
+		if id == rootID {
+			break
+		}
+		id = nodes[id].ParentTaskID
+		if id == "" {
+			id = rootID
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return taskLineage{
+		RootTaskID: rootID,
+		Root:       nodes[rootID],
+		Path:       path,
+		Total:      len(nodes),
+	}
+}
+
+func newLineageNode(t *model.Task) *lineageNode {
+	if t.DeletedAt.Valid {
+		return &lineageNode{TaskID: t.TaskID, ParentTaskID: t.ParentTaskID, Missing: true, Children: []*lineageNode{}}
+	}
+	createdAt := t.CreatedAt
+	return &lineageNode{
+		TaskID:        t.TaskID,
+		ParentTaskID:  t.ParentTaskID,
+		TaskType:      t.TaskType,
+		GroupID:       t.GroupID,
+		Status:        t.Status,
+		Prompt:        t.Prompt,
+		ThumbnailURL:  t.ThumbnailURL.Public(),
+		ThumbnailPath: t.ThumbnailPath,
+		ThumbnailSrc:  t.ThumbnailSrc,
+		Width:         t.Width,
+		Height:        t.Height,
+		CreatedAt:     &createdAt,
+		Children:      []*lineageNode{},
+	}
+}
+
+func sortLineageChildren(children []*lineageNode) {
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if a.CreatedAt == nil || b.CreatedAt == nil {
+			if a.CreatedAt == nil && b.CreatedAt == nil {
+				return a.TaskID < b.TaskID
+			}
+			return a.CreatedAt == nil
+		}
+		return a.CreatedAt.Before(*b.CreatedAt)
+	})
+}
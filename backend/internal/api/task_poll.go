@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTaskPollWait = 25 * time.Second
+	// maxTaskPollWait 需低于常见代理的读超时（nginx 默认 60s），避免长轮询被代理中断
+	maxTaskPollWait = 55 * time.Second
+)
+
+var (
+	taskWatchMu  sync.Mutex
+	taskWatchers = make(map[string]map[chan struct{}]struct{})
+)
+
+// watchTask 订阅任务变更通知，任务每次被写入（InvalidateTask）时收到一次信号
+func watchTask(taskID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	taskWatchMu.Lock()
+	if taskWatchers[taskID] == nil {
+		taskWatchers[taskID] = make(map[chan struct{}]struct{})
+	}
+	taskWatchers[taskID][ch] = struct{}{}
+	taskWatchMu.Unlock()
+	return ch, func() {
+		taskWatchMu.Lock()
+		delete(taskWatchers[taskID], ch)
+		if len(taskWatchers[taskID]) == 0 {
+			delete(taskWatchers, taskID)
+		}
+		taskWatchMu.Unlock()
+	}
+}
+
+// notifyTaskWatchers 唤醒等待该任务变更的长轮询请求，不会阻塞调用方
+func notifyTaskWatchers(taskID string) {
+	taskWatchMu.Lock()
+	defer taskWatchMu.Unlock()
+	for ch := range taskWatchers[taskID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// taskVersion 任务可见状态的短摘要，客户端在下次长轮询时通过 since 回传
+func taskVersion(task *model.Task, view *taskView) string {
+	h := fnv.New64a()
+	h.Write([]byte(taskSignature(task) + view.viewSignature()))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// PollTaskHandler 供 SSE 被缓冲代理阻塞的客户端长轮询：任务版本与 ?since 不同时立即返回，否则等到任务变化或 ?wait（默认 25s）超时
+func PollTaskHandler(c *gin.Context) {
+	taskID := c.Param("task_id")
+	wait, err := parsePollWait(c.Query("wait"))
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, err.Error())
+		return
+	}
+	since := strings.TrimSpace(c.Query("since"))
+
+	// 先订阅再读取，避免读取与等待之间的变更被漏掉
+	changes, stop := watchTask(taskID)
+	defer stop()
+	defer acquireTaskLease(taskID)()
+
+	task, err := loadTask(taskID)
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
+		return
+	}
+	view := buildTaskView(task)
+	version := taskVersion(task, view)
+	if since == "" || since != version || taskSettled(task) || wait == 0 {
+		writePollResult(c, view, version, since)
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timer.C:
+			writePollResult(c, view, version, since)
+			return
+		case <-changes:
+			latest, err := loadTask(taskID)
+			if err != nil {
+				ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
+				return
+			}
+			view = buildTaskView(latest)
+			version = taskVersion(latest, view)
+			// 写入未改变可见字段时继续等待
+			if version != since {
+				writePollResult(c, view, version, since)
+				return
+			}
+		}
+	}
+}
+
+func writePollResult(c *gin.Context, view *taskView, version, since string) {
+	c.Header("Cache-Control", "no-cache")
+	Success(c, gin.H{
+		"task":    view,
+		"version": version,
+		"changed": version != since,
+	})
+}
+
+// parsePollWait 解析等待时长，支持 25s 形式或纯秒数
+func parsePollWait(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultTaskPollWait, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, fmt.Errorf("wait 格式无效: %s", value)
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("wait 不能为负数")
+	}
+	if wait > maxTaskPollWait {
+		wait = maxTaskPollWait
+	}
+	return wait, nil
+}
+
+func isTerminalTaskStatus(status string) bool {
+	return status == "completed" || status == taskStatusImported || status == "failed"
+}
+
+// taskSettled 任务已结束且不会再有可见变化：已完成但缩略图仍在后台生成的任务，推送会持续到缩略图就绪
+func taskSettled(task *model.Task) bool {
+	return isTerminalTaskStatus(task.Status) && task.ThumbStatus != model.ThumbnailPending
+}
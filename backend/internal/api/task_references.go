@@ -0,0 +1,112 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+)
+
+// 参考图保存方式，对应配置 storage.ref_store_mode
+const (
+	refStoreFull      = "full"
+	refStoreThumbnail = "thumbnail"
+	refStoreHash      = "hash"
+)
+
+// taskReferenceView 参考图记录附带可直接访问的地址
+type taskReferenceView struct {
+	model.TaskReference
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func currentRefStoreMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(config.Get().Storage.RefStoreMode)); mode {
+	case refStoreThumbnail, refStoreHash:
+		return mode
+	default:
+		return refStoreFull
+	}
+}
+
+// buildTaskReferences 按存储方式保存参考图文件并返回待写入的记录；文件按内容哈希命名，
+// 任务最终未创建时留下的文件会被其他任务复用或由清理任务处理。保存失败只记录日志，不影响任务本身
+func buildTaskReferences(taskID string, images [][]byte) []model.TaskReference {
+	mode := currentRefStoreMode()
+	refs := make([]model.TaskReference, 0, len(images))
+	for i, data := range images {
+		sum := sha256.Sum256(data)
+		ref := model.TaskReference{
+			TaskID:   taskID,
+			Position: i,
+			SHA256:   hex.EncodeToString(sum[:]),
+			FileSize: int64(len(data)),
+		}
+		if mode != refStoreHash {
+			files, err := storage.SaveReference(data, ref.SHA256, mode == refStoreThumbnail)
+			if err != nil {
+				log.Printf("[References] 保存任务 %s 的第 %d 张参考图失败: %v", taskID, i, err)
+			}
+			ref.Path = files.Path
+			ref.ThumbnailPath = files.ThumbnailPath
+			ref.Width = files.Width
+			ref.Height = files.Height
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// loadTaskReferences 按顺序返回任务的参考图
+func loadTaskReferences(taskID string) []taskReferenceView {
+	var refs []model.TaskReference
+	if err := model.DB.Where("task_id = ?", taskID).Order("position").Find(&refs).Error; err != nil {
+		log.Printf("[References] 查询任务 %s 的参考图失败: %v", taskID, err)
+		return nil
+	}
+	dir := storage.LocalDir()
+	views := make([]taskReferenceView, 0, len(refs))
+	for _, ref := range refs {
+		view := taskReferenceView{TaskReference: ref}
+		if ref.Path != "" && dir != "" {
+			view.URL = filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(ref.Path)))
+		}
+		if ref.ThumbnailPath != "" && dir != "" {
+			view.ThumbnailURL = filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(ref.ThumbnailPath)))
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// deleteTaskReferences 删除任务的参考图记录；文件按哈希共用，不再被其他任务引用时才删除
+func deleteTaskReferences(taskIDs []string) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	var refs []model.TaskReference
+	if err := model.DB.Where("task_id IN ?", taskIDs).Find(&refs).Error; err != nil || len(refs) == 0 {
+		return
+	}
+	if err := model.DB.Where("task_id IN ?", taskIDs).Delete(&model.TaskReference{}).Error; err != nil {
+		log.Printf("[References] 删除参考图记录失败: %v", err)
+		return
+	}
+	paths := make(map[string][]string)
+	for _, ref := range refs {
+		paths[ref.SHA256] = append(paths[ref.SHA256], ref.Path, ref.ThumbnailPath)
+	}
+	for hash, files := range paths {
+		var remaining int64
+		model.DB.Model(&model.TaskReference{}).Where("sha256 = ?", hash).Count(&remaining)
+		if remaining == 0 {
+			storage.DeleteReferenceFiles(files...)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"image-gen-service/internal/model"
@@ -14,17 +15,23 @@ import (
 const (
 	taskStreamPollInterval = 1 * time.Second
 	taskStreamKeepAlive    = 3 * time.Second
+	// sseRetryMs 断线后 EventSource 的重连间隔
+	sseRetryMs = 3000
+	// ssePaddingBytes 首包填充的注释长度，部分代理在缓冲区积满前不会转发数据
+	ssePaddingBytes = 2048
 )
 
 // StreamTaskHandler streams task status updates via SSE.
 func StreamTaskHandler(c *gin.Context) {
 	taskID := c.Param("task_id")
 
-	var task model.Task
-	if err := model.DB.Where("task_id = ?", taskID).First(&task).Error; err != nil {
-		Error(c, http.StatusNotFound, 404, "任务未找到")
+	task, err := loadTask(taskID)
+	if err != nil {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "任务未找到")
 		return
 	}
+	// 连接期间持有任务租约，开启 auto_cancel_on_disconnect 的排队任务不会被自动取消
+	defer acquireTaskLease(taskID)()
 
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
@@ -37,8 +44,12 @@ func StreamTaskHandler(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("X-Accel-Buffering", "no")
 
-	lastSignature := taskSignature(&task)
-	if !writeTaskEvent(c.Writer, flusher, &task) {
+	if !writeSSEPreamble(c.Writer, flusher) {
+		return
+	}
+	view := buildTaskView(task)
+	lastSignature := taskSignature(task) + view.viewSignature()
+	if !writeTaskEvent(c.Writer, flusher, view) {
 		return
 	}
 
@@ -52,20 +63,21 @@ func StreamTaskHandler(c *gin.Context) {
 		case <-c.Request.Context().Done():
 			return
 		case <-ticker.C:
-			var latest model.Task
-			if err := model.DB.Where("task_id = ?", taskID).First(&latest).Error; err != nil {
+			latest, err := loadTask(taskID)
+			if err != nil {
 				return
 			}
 
-			signature := taskSignature(&latest)
+			view := buildTaskView(latest)
+			signature := taskSignature(latest) + view.viewSignature()
 			if signature != lastSignature {
-				if !writeTaskEvent(c.Writer, flusher, &latest) {
+				if !writeTaskEvent(c.Writer, flusher, view) {
 					return
 				}
 				lastSignature = signature
 			}
 
-			if latest.Status == "completed" || latest.Status == "failed" {
+			if taskSettled(latest) {
 				return
 			}
 		case <-keepAliveTicker.C:
@@ -77,7 +89,17 @@ func StreamTaskHandler(c *gin.Context) {
 	}
 }
 
-func writeTaskEvent(w http.ResponseWriter, flusher http.Flusher, task *model.Task) bool {
+// writeSSEPreamble 写入重连间隔与填充注释并立即刷新，让未关闭缓冲的代理尽快转发后续事件。
+// 代理仍然缓冲时，客户端可改用 WebSocket 或 /tasks/:task_id/poll 长轮询
+func writeSSEPreamble(w http.ResponseWriter, flusher http.Flusher) bool {
+	if _, err := fmt.Fprintf(w, "retry: %d\n:%s\n\n", sseRetryMs, strings.Repeat(" ", ssePaddingBytes)); err != nil {
+		return false
+	}
+	flusher.Flush()
+	return true
+}
+
+func writeTaskEvent(w http.ResponseWriter, flusher http.Flusher, task *taskView) bool {
 	payload, err := json.Marshal(task)
 	if err != nil {
 		return false
@@ -94,16 +116,26 @@ func taskSignature(task *model.Task) string {
 	if task.CompletedAt != nil {
 		completedAt = task.CompletedAt.UTC().Format(time.RFC3339Nano)
 	}
-	return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%d|%d|%d|%s",
+	nextAttemptAt := ""
+	if task.NextAttemptAt != nil {
+		nextAttemptAt = task.NextAttemptAt.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%s|%d|%s|%s|%s|%s|%s|%s|%s|%d|%d|%d|%s|%t|%t|%s",
 		task.Status,
+		task.Progress,
 		task.ErrorMessage,
+		task.ErrorCode,
 		task.ImageURL,
 		task.ThumbnailURL,
 		task.LocalPath,
 		task.ThumbnailPath,
+		task.ThumbStatus,
 		task.TotalCount,
 		task.Width,
 		task.Height,
 		completedAt,
+		task.Favorite,
+		task.Private,
+		nextAttemptAt,
 	)
 }
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultRetryAfterSeconds 没有耗时样本时建议的重试间隔
+const defaultRetryAfterSeconds = 5
+
+// maxRetryAfterSeconds 建议重试间隔的上限
+const maxRetryAfterSeconds = 120
+
+// submitTask 先检查 Provider 每日预算并占用队列名额，再创建任务记录并提交到 Worker 池。
+// 超出预算返回 429；队列已满时最多等待 tasks.submit_wait_ms，超时返回 503，此时不会留下任何任务记录。
+// 返回 false 时已写入错误响应。
+func submitTask(c *gin.Context, task *worker.Task) bool {
+	return submitTaskWithReferences(c, task, nil)
+}
+
+// submitTaskWithReferences 与 submitTask 相同，并在创建任务记录的同一事务中写入参考图记录。
+// 任务记录只在占用队列名额之后写入，且写入后的提交不会失败，不存在先创建再标记失败的中间状态；
+// 事务失败时释放名额，任务与参考图记录都不会留下
+func submitTaskWithReferences(c *gin.Context, task *worker.Task, references [][]byte) bool {
+	return submitTasks(c, []*worker.Task{task}, references)
+}
+
+// submitTasks 一次提交同一 Provider 的多个任务（fanout=per_image 时）：预算按全部任务合计检查，
+// 每个任务各占一个队列名额，任一名额等待超时即释放已占用的名额并返回 503；
+// 所有任务与参考图记录在同一事务中写入，要么全部创建，要么都不留下
+func submitTasks(c *gin.Context, tasks []*worker.Task, references [][]byte) bool {
+	providerName := tasks[0].TaskModel.ProviderName
+	images := 0
+	for _, task := range tasks {
+		images += task.TaskModel.TotalCount
+	}
+	if _, err := worker.CheckBatchBudget(providerName, len(tasks), images); err != nil {
+		rejectOverBudget(c, providerName, err)
+		return false
+	}
+
+	reservations := make([]*worker.Reservation, 0, len(tasks))
+	cancelAll := func() {
+		for _, reservation := range reservations {
+			reservation.Cancel()
+		}
+	}
+	for range tasks {
+		reservation, ok := worker.Pool.Reserve(c.Request.Context(), submitWait())
+		if !ok {
+			cancelAll()
+			rejectQueueFull(c, providerName)
+			return false
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	var refs []model.TaskReference
+	for _, task := range tasks {
+		refs = append(refs, buildTaskReferences(task.TaskModel.TaskID, references)...)
+	}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, task := range tasks {
+			if err := tx.Create(task.TaskModel).Error; err != nil {
+				return err
+			}
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+		return tx.Create(&refs).Error
+	})
+	if err != nil {
+		cancelAll()
+		log.Printf("[Queue] 创建任务 %s 失败: %v", tasks[0].TaskModel.TaskID, err)
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "创建任务失败")
+		return false
+	}
+	for i, task := range tasks {
+		reservations[i].Submit(task)
+	}
+	return true
+}
+
+// rejectQueueFull 队列已满时返回 503，并按 Provider 最近的耗时给出建议的重试间隔
+func rejectQueueFull(c *gin.Context, providerName string) {
+	depth, capacity := worker.Pool.QueueDepth()
+	retryAfter := estimateRetryAfter(providerName)
+	log.Printf("[Queue] 队列已满 (%d/%d)，拒绝任务，建议 %d 秒后重试", depth, capacity, retryAfter)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, Response{
+		Code:      503,
+		Message:   "服务器繁忙，请稍后再试",
+		ErrorCode: model.ErrCodeQueueFull,
+		Data: gin.H{
+			"queue_depth":         depth,
+			"queue_capacity":      capacity,
+			"retry_after_seconds": retryAfter,
+		},
+	})
+}
+
+// count 大于 1 时的任务拆分方式
+const (
+	// fanoutSingleTask 一个任务生成全部图片（默认）
+	fanoutSingleTask = "single_task"
+	// fanoutPerImage 每张图片一个任务，共享 group_id，可分别查看状态与删除
+	fanoutPerImage = "per_image"
+)
+
+// parseFanout 校验 fanout 参数，为空时使用 single_task
+func parseFanout(value string) (string, error) {
+	switch value = strings.TrimSpace(value); value {
+	case "", fanoutSingleTask:
+		return fanoutSingleTask, nil
+	case fanoutPerImage:
+		return fanoutPerImage, nil
+	}
+	verr := &provider.ValidationError{}
+	verr.Add("fanout", "fanout 只支持 single_task 或 per_image", []string{fanoutSingleTask, fanoutPerImage}, value)
+	return "", verr.Err()
+}
+
+// generateSubmission 两个生图接口在参数校验完成后提交任务所需的信息
+type generateSubmission struct {
+	Provider   string
+	ModelID    string
+	Prompt     string // 已按长度上限处理后的提示词
+	Truncated  bool
+	Params     map[string]interface{}
+	Private    bool
+	AutoCancel bool
+	References [][]byte        // 图生图的参考图
+	Similar    []similarPrompt // 相近的历史提示词，随响应返回
+	Fanout     string          // count 大于 1 时的拆分方式，为空时等同 single_task
+}
+
+// prepareGenerateSubmission 归一化并校验生图参数：合并 Provider 默认参数、解析模型、取出 private、
+// 规范超时并校验参数与提示词长度。GenerateHandler 与 GenerateWithImagesHandler 共用，两个接口接受与拒绝的输入一致。
+// 返回 false 时已写入错误响应
+func prepareGenerateSubmission(c *gin.Context, p provider.Provider, providerName, requestModel string, params map[string]interface{}) (generateSubmission, bool) {
+	providerConfig := fetchProviderConfig(providerName)
+	// 默认参数合并在请求参数之下，之后的校验与配置快照都基于合并结果
+	applyDefaultParams(providerConfig, params)
+	resolved := provider.ResolveModelID(provider.ModelResolveOptions{
+		ProviderName: providerName,
+		Purpose:      provider.PurposeImage,
+		RequestModel: requestModel,
+		Params:       params,
+		Config:       providerConfig,
+	})
+	if resolved.Err != nil {
+		Error(c, http.StatusBadRequest, 400, resolved.Err.Error())
+		return generateSubmission{}, false
+	}
+	if resolved.ID != "" {
+		params["model_id"] = resolved.ID
+	}
+
+	private, err := takeTaskPrivate(params)
+	if err != nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "params."+err.Error())
+		return generateSubmission{}, false
+	}
+	if err := normalizeTaskTimeout(params); err != nil {
+		Error(c, http.StatusBadRequest, 400, err.Error())
+		return generateSubmission{}, false
+	}
+	// 一次返回全部不合法的字段
+	if err := provider.JoinValidationErrors(p.ValidateParams(params), worker.ValidateAspectParams(params)); err != nil {
+		ValidationFailed(c, err)
+		return generateSubmission{}, false
+	}
+
+	prompt, _ := params["prompt"].(string)
+	if prompt == "" {
+		Error(c, http.StatusBadRequest, 400, "params.prompt 不能为空")
+		return generateSubmission{}, false
+	}
+	prompt, truncated, err := limitPrompt(p, prompt)
+	if err != nil {
+		ValidationFailed(c, err)
+		return generateSubmission{}, false
+	}
+	if truncated {
+		params["prompt"] = prompt
+	}
+	return generateSubmission{
+		Provider:  providerName,
+		ModelID:   resolved.ID,
+		Prompt:    prompt,
+		Truncated: truncated,
+		Params:    params,
+		Private:   private,
+	}, true
+}
+
+// generateGroupResponse fanout=per_image 时的响应：同一分组的全部任务
+type generateGroupResponse struct {
+	GroupID      string          `json:"group_id"`
+	Tasks        []*model.Task   `json:"tasks"`
+	SimilarTasks []similarPrompt `json:"similar_tasks,omitempty"`
+	Warning      string          `json:"warning,omitempty"`
+}
+
+// submitGenerateTask 创建生图任务并提交，成功时写入任务响应。GenerateHandler 与 GenerateWithImagesHandler
+// 共用此函数，任务字段、count 归一与提交流程保持一致
+func submitGenerateTask(c *gin.Context, sub generateSubmission) {
+	// count 已通过校验，统一写回整数，任务记录、配置快照与 Provider 使用同一个值
+	count, _ := provider.ParseCount(sub.Params["count"])
+	sub.Params["count"] = count
+	if sub.Fanout == fanoutPerImage && count > 1 {
+		submitGenerateGroup(c, sub, count)
+		return
+	}
+
+	taskModel := &model.Task{
+		TaskID:         uuid.New().String(),
+		Prompt:         sub.Prompt,
+		Truncated:      sub.Truncated,
+		ProviderName:   sub.Provider,
+		ModelID:        sub.ModelID,
+		TotalCount:     count,
+		Status:         "pending",
+		ConfigSnapshot: buildConfigSnapshot(sub.Provider, sub.ModelID, sub.Params),
+		Private:        sub.Private,
+	}
+	applyAutoCancel(taskModel, sub.AutoCancel)
+
+	task := &worker.Task{
+		TaskModel: taskModel,
+		Params:    sub.Params,
+	}
+	if !submitTaskWithReferences(c, task, sub.References) {
+		return
+	}
+	Success(c, generateResponse{Task: taskModel, SimilarTasks: sub.Similar, Warning: providerDegradedWarning(sub.Provider)})
+}
+
+// submitGenerateGroup 把 count 张图片拆分为 count 个单图任务，共享同一个 group_id 并一起提交
+func submitGenerateGroup(c *gin.Context, sub generateSubmission, count int) {
+	groupID := uuid.New().String()
+	tasks := make([]*worker.Task, 0, count)
+	models := make([]*model.Task, 0, count)
+	for i := 0; i < count; i++ {
+		params := make(map[string]interface{}, len(sub.Params))
+		for k, v := range sub.Params {
+			params[k] = v
+		}
+		params["count"] = 1
+		taskModel := &model.Task{
+			TaskID:         uuid.New().String(),
+			Prompt:         sub.Prompt,
+			Truncated:      sub.Truncated,
+			ProviderName:   sub.Provider,
+			ModelID:        sub.ModelID,
+			TotalCount:     1,
+			Status:         "pending",
+			ConfigSnapshot: buildConfigSnapshot(sub.Provider, sub.ModelID, params),
+			Private:        sub.Private,
+			GroupID:        groupID,
+		}
+		applyAutoCancel(taskModel, sub.AutoCancel)
+		tasks = append(tasks, &worker.Task{TaskModel: taskModel, Params: params})
+		models = append(models, taskModel)
+	}
+	if !submitTasks(c, tasks, sub.References) {
+		return
+	}
+	Success(c, generateGroupResponse{GroupID: groupID, Tasks: models, SimilarTasks: sub.Similar, Warning: providerDegradedWarning(sub.Provider)})
+}
+
+func submitWait() time.Duration {
+	ms := config.Get().Tasks.SubmitWaitMs
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// estimateRetryAfter 按 Provider 最近的平均耗时估算队列空出名额所需的秒数
+func estimateRetryAfter(providerName string) int {
+	avg, ok := worker.Pool.AverageDuration(providerName)
+	if !ok {
+		return defaultRetryAfterSeconds
+	}
+	workers := worker.Pool.WorkerCount()
+	if workers <= 0 {
+		workers = 1
+	}
+	// 任一 Worker 完成任务后即会取走队首任务空出名额
+	seconds := int(math.Ceil(avg.Seconds() / float64(workers)))
+	if seconds < 1 {
+		seconds = 1
+	}
+	if seconds > maxRetryAfterSeconds {
+		seconds = maxRetryAfterSeconds
+	}
+	return seconds
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"image-gen-service/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxTagLength = 50
+
+// normalizeTagNames 去除首尾空白并去重，保持原有顺序；标签名过长时返回错误
+func normalizeTagNames(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return nil, fmt.Errorf("标签 %q 超过 %d 个字符", name, maxTagLength)
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// ensureTags 返回标签名到 ID 的映射，不存在的标签自动创建
+func ensureTags(names []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(names))
+	if len(names) == 0 {
+		return ids, nil
+	}
+	tags := make([]model.Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, model.Tag{Name: name})
+	}
+	if err := model.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+	var existing []model.Tag
+	if err := model.DB.Where("name IN ?", names).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range existing {
+		ids[tag.Name] = tag.ID
+	}
+	return ids, nil
+}
+
+// lookupTags 返回已存在标签的名称到 ID 映射，不创建新标签
+func lookupTags(names []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(names))
+	if len(names) == 0 {
+		return ids, nil
+	}
+	var existing []model.Tag
+	if err := model.DB.Where("name IN ?", names).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range existing {
+		ids[tag.Name] = tag.ID
+	}
+	return ids, nil
+}
+
+// attachTaskTags 为任务列表填充 Tags 字段
+func attachTaskTags(db *gorm.DB, tasks []model.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	taskIDs := make([]string, 0, len(tasks))
+	for i := range tasks {
+		taskIDs = append(taskIDs, tasks[i].TaskID)
+	}
+	var rows []struct {
+		TaskID string
+		Name   string
+	}
+	if err := db.Table("task_tags").
+		Select("task_tags.task_id, tags.name").
+		Joins("JOIN tags ON tags.id = task_tags.tag_id").
+		Where("task_tags.task_id IN ?", taskIDs).
+		Order("task_tags.id ASC").
+		Scan(&rows).Error; err != nil {
+		log.Printf("[API] 查询任务标签失败: %v", err)
+		return
+	}
+	byTask := make(map[string][]string, len(tasks))
+	for _, row := range rows {
+		byTask[row.TaskID] = append(byTask[row.TaskID], row.Name)
+	}
+	for i := range tasks {
+		tasks[i].Tags = byTask[tasks[i].TaskID]
+	}
+}
+
+// deleteTaskTags 删除任务的标签关联，标签本身保留
+func deleteTaskTags(taskIDs []string) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	if err := model.DB.Where("task_id IN ?", taskIDs).Delete(&model.TaskTag{}).Error; err != nil {
+		log.Printf("[API] 删除任务标签关联失败: %v", err)
+	}
+}
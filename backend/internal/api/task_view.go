@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"math"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+	"image-gen-service/pkg/apitypes"
+)
+
+// taskView 是任务详情与 SSE 推送使用的响应结构，在任务字段之外附带实时计算的信息
+type taskView struct {
+	model.Task
+	// QueueEstimate 仅在任务排队（pending）时返回
+	QueueEstimate *queueEstimate `json:"queue_estimate,omitempty"`
+	// LatestEvent 任务最近一条处理事件
+	LatestEvent *model.TaskEvent `json:"latest_event,omitempty"`
+	// Retryable 仅在任务失败时返回，表示按错误分类重试是否可能成功
+	Retryable *bool `json:"retryable,omitempty"`
+	// References 图生图任务的参考图，仅任务详情接口返回
+	References []taskReferenceView `json:"references,omitempty"`
+}
+
+// queueEstimate 排队位置与预计等待时间，均为估算值
+type queueEstimate = apitypes.QueueEstimate
+
+func buildTaskView(task *model.Task) *taskView {
+	view := &taskView{Task: *task, LatestEvent: latestTaskEvent(task.TaskID)}
+	if task.Status == "pending" {
+		view.QueueEstimate = estimateQueue(task)
+	}
+	if task.Status == "failed" {
+		retryable := provider.IsRetryableClass(task.ErrorClass)
+		view.Retryable = &retryable
+	}
+	return view
+}
+
+// estimateQueue 统计同一 Provider 下更早创建（自增 ID 更小）的排队任务与正在处理的任务，
+// 并以 Worker 池记录的平均耗时估算等待时间
+func estimateQueue(task *model.Task) *queueEstimate {
+	var ahead int64
+	err := model.DB.Model(&model.Task{}).
+		Where("provider_name = ?", task.ProviderName).
+		Where("((status = ? AND id < ?) OR status = ?)", "pending", task.ID, "processing").
+		Count(&ahead).Error
+	if err != nil {
+		return nil
+	}
+
+	estimate := &queueEstimate{Estimated: true, Position: ahead + 1, Ahead: ahead}
+	if worker.Pool == nil {
+		return estimate
+	}
+	if avg, ok := worker.Pool.AverageDuration(task.ProviderName); ok {
+		workers := worker.Pool.WorkerCount()
+		if workers <= 0 {
+			workers = 1
+		}
+		rounds := math.Ceil(float64(ahead+1) / float64(workers))
+		eta := int64(rounds * avg.Seconds())
+		estimate.ETASeconds = &eta
+	}
+	return estimate
+}
+
+// viewSignature 用于判断排队信息或最新事件是否变化，变化时 SSE 需要重新推送
+func (v *taskView) viewSignature() string {
+	var eventID uint
+	if v.LatestEvent != nil {
+		eventID = v.LatestEvent.ID
+	}
+	if v.QueueEstimate == nil {
+		return fmt.Sprintf("|%d", eventID)
+	}
+	eta := int64(-1)
+	if v.QueueEstimate.ETASeconds != nil {
+		eta = *v.QueueEstimate.ETASeconds
+	}
+	return fmt.Sprintf("|%d|%d|%d", eventID, v.QueueEstimate.Position, eta)
+}
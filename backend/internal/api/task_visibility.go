@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateImageRequest struct {
+	Private *bool `json:"private"`
+}
+
+// UpdateImageHandler 修改单张图片的设置，目前只支持 private 标记，图片说明走单独的接口
+func UpdateImageHandler(c *gin.Context) {
+	id := c.Param("id")
+	var req updateImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+		return
+	}
+	if req.Private == nil {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "请指定要更新的字段: private")
+		return
+	}
+
+	result := model.DB.Model(&model.Task{}).Where("task_id = ?", id).Update("private", *req.Private)
+	InvalidateTask(id)
+	if result.Error != nil {
+		ErrorWithCode(c, http.StatusInternalServerError, 500, model.ErrCodeStorageError, "更新图片失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		ErrorWithCode(c, http.StatusNotFound, 404, model.ErrCodeTaskNotFound, "图片不存在")
+		return
+	}
+	publishGalleryEvent(galleryEvent{Type: "images_updated", TaskIDs: []string{id}})
+	recordAudit(c, "image_visibility", gin.H{"task_id": id, "private": *req.Private})
+	Success(c, gin.H{"task_id": id, "private": *req.Private})
+}
+
+// resolveTaskPrivate 解析创建任务时的 private 参数（布尔值或 "true"/"false" 字符串），
+// 未指定时使用 privacy.default_private
+func resolveTaskPrivate(raw interface{}) (bool, error) {
+	switch v := raw.(type) {
+	case nil:
+		return config.Get().Privacy.DefaultPrivate, nil
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "":
+			return config.Get().Privacy.DefaultPrivate, nil
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("private 必须是布尔值")
+}
+
+// takeTaskPrivate 从生成参数中取出 private，该参数只决定可见性，不透传给 Provider
+func takeTaskPrivate(params map[string]interface{}) (bool, error) {
+	raw := params["private"]
+	delete(params, "private")
+	return resolveTaskPrivate(raw)
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsMaxSubscriptions = 50
+	wsWriteTimeout     = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingInterval     = 25 * time.Second
+	wsMaxMessageSize   = 64 * 1024
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// 跨域策略与 HTTP 接口保持一致（允许任意来源），访问控制由 API Token 负责
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsCommand 客户端发送的指令
+type wsCommand struct {
+	Type    string   `json:"type"` // subscribe / unsubscribe / cancel / ping
+	ID      string   `json:"id"`   // 客户端请求 ID，原样带回
+	TaskID  string   `json:"task_id"`
+	TaskIDs []string `json:"task_ids"`
+}
+
+// wsMessage 服务端推送的消息
+type wsMessage struct {
+	Type   string      `json:"type"` // task / subscribed / unsubscribed / cancelled / pong / error
+	ID     string      `json:"id,omitempty"`
+	TaskID string      `json:"task_id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Code   string      `json:"code,omitempty"` // 错误码，取值见 model/error_codes.go
+}
+
+// TaskWebSocketHandler 升级为 WebSocket 推送已订阅任务的更新（内容与 SSE 相同），接受 subscribe / unsubscribe / cancel / ping 指令
+func TaskWebSocketHandler(c *gin.Context) {
+	if !checkAPIToken(c.Request) {
+		Error(c, http.StatusUnauthorized, 401, "API Token 无效")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[WS] 升级 WebSocket 失败: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	// 读协程只负责解析指令，所有写操作都在当前协程完成（gorilla/websocket 不支持并发写）
+	commands := make(chan wsCommand, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(commands)
+		for {
+			var cmd wsCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					cmd = wsCommand{Type: "invalid"}
+				} else {
+					return
+				}
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			select {
+			case commands <- cmd:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(msg wsMessage) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(msg) == nil
+	}
+
+	// 订阅的任务 -> 上次推送时的签名
+	subscriptions := make(map[string]string)
+	// 订阅的任务 -> 任务租约的释放函数，订阅期间持有租约
+	leases := make(map[string]func())
+	defer func() {
+		for _, release := range leases {
+			release()
+		}
+	}()
+	syncLeases := func() {
+		for taskID := range subscriptions {
+			if _, ok := leases[taskID]; !ok {
+				leases[taskID] = acquireTaskLease(taskID)
+			}
+		}
+		for taskID, release := range leases {
+			if _, ok := subscriptions[taskID]; !ok {
+				release()
+				delete(leases, taskID)
+			}
+		}
+	}
+	push := func(taskID string) bool {
+		task, err := loadTask(taskID)
+		if err != nil {
+			delete(subscriptions, taskID)
+			return send(wsMessage{Type: "error", TaskID: taskID, Error: "任务未找到", Code: model.ErrCodeTaskNotFound})
+		}
+		view := buildTaskView(task)
+		signature := taskSignature(task) + view.viewSignature()
+		if last, ok := subscriptions[taskID]; ok && last == signature {
+			return true
+		}
+		subscriptions[taskID] = signature
+		if taskSettled(task) {
+			// 终态推送后自动退订，与 SSE 在终态时结束连接的行为一致
+			delete(subscriptions, taskID)
+		}
+		return send(wsMessage{Type: "task", TaskID: taskID, Data: view})
+	}
+
+	pollTicker := time.NewTicker(taskStreamPollInterval)
+	defer pollTicker.Stop()
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case cmd, ok := <-commands:
+			if !ok {
+				return
+			}
+			if !handleWSCommand(cmd, subscriptions, send, push) {
+				return
+			}
+			syncLeases()
+		case <-pollTicker.C:
+			for taskID := range subscriptions {
+				if !push(taskID) {
+					return
+				}
+			}
+			syncLeases()
+		case <-pingTicker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func handleWSCommand(cmd wsCommand, subscriptions map[string]string, send func(wsMessage) bool, push func(string) bool) bool {
+	taskIDs := cmd.TaskIDs
+	if cmd.TaskID != "" {
+		taskIDs = append(taskIDs, cmd.TaskID)
+	}
+
+	switch cmd.Type {
+	case "ping":
+		return send(wsMessage{Type: "pong", ID: cmd.ID})
+	case "subscribe":
+		if len(taskIDs) == 0 {
+			return send(wsMessage{Type: "error", ID: cmd.ID, Error: "task_ids 不能为空", Code: model.ErrCodeValidationFailed})
+		}
+		for _, taskID := range taskIDs {
+			if _, ok := subscriptions[taskID]; ok {
+				continue
+			}
+			if len(subscriptions) >= wsMaxSubscriptions {
+				return send(wsMessage{Type: "error", ID: cmd.ID, TaskID: taskID, Error: fmt.Sprintf("单个连接最多订阅 %d 个任务", wsMaxSubscriptions), Code: model.ErrCodeValidationFailed})
+			}
+			subscriptions[taskID] = ""
+			if !send(wsMessage{Type: "subscribed", ID: cmd.ID, TaskID: taskID}) || !push(taskID) {
+				return false
+			}
+		}
+		return true
+	case "unsubscribe":
+		for _, taskID := range taskIDs {
+			delete(subscriptions, taskID)
+			if !send(wsMessage{Type: "unsubscribed", ID: cmd.ID, TaskID: taskID}) {
+				return false
+			}
+		}
+		return true
+	case "cancel":
+		for _, taskID := range taskIDs {
+			if code, err := cancelTask(taskID); err != nil {
+				if !send(wsMessage{Type: "error", ID: cmd.ID, TaskID: taskID, Error: err.Error(), Code: code}) {
+					return false
+				}
+				continue
+			}
+			if !send(wsMessage{Type: "cancelled", ID: cmd.ID, TaskID: taskID}) {
+				return false
+			}
+		}
+		return true
+	case "invalid":
+		return send(wsMessage{Type: "error", Error: "指令格式错误，应为 JSON 对象", Code: model.ErrCodeValidationFailed})
+	default:
+		return send(wsMessage{Type: "error", ID: cmd.ID, Error: "未知指令: " + cmd.Type, Code: model.ErrCodeValidationFailed})
+	}
+}
+
+// cancelTask 取消排队中或处理中的任务，取消后任务标记为失败；失败时返回错误码
+func cancelTask(taskID string) (string, error) {
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", taskID).First(&task).Error; err != nil {
+		return model.ErrCodeTaskNotFound, errors.New("任务未找到")
+	}
+	if task.Status != "pending" && task.Status != "processing" && task.Status != worker.StatusRateLimited {
+		return model.ErrCodeConflict, fmt.Errorf("任务已结束 (%s)，无法取消", task.Status)
+	}
+
+	running := worker.Pool.Cancel(taskID)
+	if !running {
+		// 仍在队列中或限流等待中：直接更新状态，Worker 出队时会跳过该任务
+		model.DB.Model(&task).Updates(map[string]interface{}{
+			"status":          "failed",
+			"error_message":   worker.ErrTaskCancelled.Error(),
+			"error_code":      model.ErrCodeCancelled,
+			"error_class":     provider.ErrorClassCancelled,
+			"next_attempt_at": nil,
+		})
+		InvalidateTask(taskID)
+		worker.RecordTaskEvent(taskID, worker.EventFailed, "code=%s %v", model.ErrCodeCancelled, worker.ErrTaskCancelled)
+	}
+	log.Printf("[API] 任务 %s 已取消 (processing=%v)", taskID, running)
+	return "", nil
+}
+
+// checkAPIToken 校验请求携带的 API Token；未配置 Token 时不做校验
+// WebSocket 无法在浏览器中自定义请求头，因此同时支持 ?token= 查询参数
+func checkAPIToken(r *http.Request) bool {
+	expected := strings.TrimSpace(config.Get().Server.APIToken)
+	if expected == "" {
+		return true
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		token = strings.TrimSpace(r.URL.Query().Get("token"))
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
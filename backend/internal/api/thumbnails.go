@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/jobs"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	thumbnailRegenerateBatchSize = 50
+	maxThumbnailRegenerateIDs    = 500
+)
+
+type regenerateThumbnailsParams struct {
+	// TaskIDs 只重新生成指定任务的缩略图；为空时处理所有生成失败或仍在等待的任务
+	TaskIDs []string `json:"task_ids,omitempty"`
+}
+
+// RegenerateThumbnailsHandler 启动后台作业，重新生成失败或后台生成后仍未完成的缩略图；传入 task_ids 时只处理指定图片
+func RegenerateThumbnailsHandler(c *gin.Context) {
+	var params regenerateThumbnailsParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			Error(c, http.StatusBadRequest, 400, "参数解析失败: "+err.Error())
+			return
+		}
+	}
+	for i, id := range params.TaskIDs {
+		params.TaskIDs[i] = strings.TrimSpace(id)
+		if params.TaskIDs[i] == "" {
+			ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, "task_ids 不能包含空值")
+			return
+		}
+	}
+	if len(params.TaskIDs) > maxThumbnailRegenerateIDs {
+		ErrorWithCode(c, http.StatusBadRequest, 400, model.ErrCodeValidationFailed, fmt.Sprintf("task_ids 最多 %d 个", maxThumbnailRegenerateIDs))
+		return
+	}
+	enqueueJob(c, jobTypeRegenerateThumbnails, params)
+}
+
+// RegenerateThumbnailsStatusHandler 返回最近一次缩略图重新生成作业的状态
+func RegenerateThumbnailsStatusHandler(c *gin.Context) {
+	latestJobHandler(jobTypeRegenerateThumbnails)(c)
+}
+
+func thumbnailRegenerateQuery(params regenerateThumbnailsParams) *gorm.DB {
+	query := model.DB.Model(&model.Task{}).Where("local_path <> ''")
+	if len(params.TaskIDs) > 0 {
+		return query.Where("task_id IN ?", params.TaskIDs)
+	}
+	return query.Where("thumb_status IN ?", []string{model.ThumbnailFailed, model.ThumbnailPending})
+}
+
+// runThumbnailRegeneration 缩略图重新生成作业，逐个解码原图，结果通过任务推送与图库事件通知前端
+func runThumbnailRegeneration(ctx context.Context, run *jobs.Run) error {
+	var params regenerateThumbnailsParams
+	if err := run.Params(&params); err != nil {
+		return fmt.Errorf("解析作业参数失败: %w", err)
+	}
+	var total int64
+	if err := thumbnailRegenerateQuery(params).Count(&total).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+	run.SetTotal(total)
+
+	var batch []model.Task
+	return thumbnailRegenerateQuery(params).
+		Select("id", "task_id").
+		FindInBatches(&batch, thumbnailRegenerateBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := worker.GenerateTaskThumbnail(batch[i].TaskID); err != nil {
+					run.Count("failed", 1)
+				} else {
+					run.Count("regenerated", 1)
+				}
+				run.Advance(1)
+			}
+			return nil
+		}).Error
+}
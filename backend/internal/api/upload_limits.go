@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/provider"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadFormOverhead 为表单文本字段与 multipart 边界预留的字节数
+const uploadFormOverhead = 1 << 20
+
+// allowedImageTypes 按文件内容嗅探后允许上传的图片类型
+var allowedImageTypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif", "image/bmp"}
+
+type uploadLimits struct {
+	MaxFileBytes  int64
+	MaxTotalBytes int64
+}
+
+func currentUploadLimits() uploadLimits {
+	upload := config.Get().Upload
+	fileMB := upload.MaxFileMB
+	if fileMB <= 0 {
+		fileMB = 15
+	}
+	totalMB := upload.MaxTotalMB
+	if totalMB <= 0 {
+		totalMB = 60
+	}
+	if totalMB < fileMB {
+		totalMB = fileMB
+	}
+	return uploadLimits{
+		MaxFileBytes:  int64(fileMB) << 20,
+		MaxTotalBytes: int64(totalMB) << 20,
+	}
+}
+
+// uploadError 上传内容校验失败，不应回退到其他解析方式
+type uploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+func errFileTooLarge(field, name string, limit int64) *uploadError {
+	return &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("字段 %s 的文件 %s 超过单文件 %dMB 限制", field, name, limit>>20),
+	}
+}
+
+func errTotalTooLarge(limit int64) *uploadError {
+	return &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("上传内容超过单次请求 %dMB 限制", limit>>20),
+	}
+}
+
+// uploadBudget 在流式解析过程中累计已读取的字节数
+type uploadBudget struct {
+	limits uploadLimits
+	used   int64
+}
+
+// readFile 读取单个文件字段，超过单文件或总量上限时立即中止
+func (b *uploadBudget) readFile(reader io.Reader, field, name string) ([]byte, error) {
+	limit := b.limits.MaxFileBytes
+	if remaining := b.limits.MaxTotalBytes - b.used; remaining < limit {
+		limit = remaining
+	}
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	if int64(len(content)) > b.limits.MaxFileBytes {
+		return nil, errFileTooLarge(field, name, b.limits.MaxFileBytes)
+	}
+	if int64(len(content)) > limit {
+		return nil, errTotalTooLarge(b.limits.MaxTotalBytes)
+	}
+	b.used += int64(len(content))
+	if err := validateImageContent(field, name, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// validateImageContent 按文件头嗅探类型，拒绝非图片文件
+func validateImageContent(field, name string, content []byte) error {
+	contentType := http.DetectContentType(content)
+	for _, allowed := range allowedImageTypes {
+		if contentType == allowed {
+			return nil
+		}
+	}
+	return &uploadError{
+		Status:  http.StatusBadRequest,
+		Message: fmt.Sprintf("字段 %s 的文件 %s 不是支持的图片格式 (%s)", field, name, contentType),
+	}
+}
+
+// LimitsHandler 返回上传限制，供前端在发送前校验文件
+func LimitsHandler(c *gin.Context) {
+	limits := currentUploadLimits()
+	prompts := config.Get().Prompts
+	Success(c, gin.H{
+		"max_file_bytes":       limits.MaxFileBytes,
+		"max_total_bytes":      limits.MaxTotalBytes,
+		"allowed_image_types":  allowedImageTypes,
+		"max_prompt_length":    prompts.MaxLength,
+		"prompt_auto_truncate": prompts.AutoTruncate,
+		"max_optimize_input":   prompts.MaxOptimizeInput,
+		"max_count":            provider.MaxCount(nil),
+	})
+}
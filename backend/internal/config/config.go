@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spf13/viper"
 )
@@ -11,20 +15,46 @@ type Config struct {
 	Server struct {
 		Host string `mapstructure:"host"`
 		Port int    `mapstructure:"port"`
+		// APIToken 配置后，WebSocket 等长连接接口需要携带该令牌
+		APIToken string `mapstructure:"api_token"`
+		// ReadHeaderTimeoutSeconds / ReadTimeoutSeconds / WriteTimeoutSeconds http.Server 超时（秒），0 表示不限制；
+		// 流式推送、WebSocket 与导出接口会单独解除读写超时
+		ReadHeaderTimeoutSeconds int `mapstructure:"read_header_timeout_seconds"`
+		ReadTimeoutSeconds       int `mapstructure:"read_timeout_seconds"`
+		WriteTimeoutSeconds      int `mapstructure:"write_timeout_seconds"`
+		// MaxBodyMB 普通请求体大小上限（MB），上传类接口按 upload 配置计算
+		MaxBodyMB int `mapstructure:"max_body_mb"`
+		// RouteTimeouts 接口处理时限（秒），到达后取消上游调用并返回 504，0 表示不限制；
+		// 流式推送、WebSocket、长轮询与导出接口不受限制
+		RouteTimeouts struct {
+			DefaultSeconds int `mapstructure:"default_seconds"` // 普通读写接口
+			ChatSeconds    int `mapstructure:"chat_seconds"`    // 提示词优化、图片逆向提示词、图片描述等调用对话模型的接口
+			LongSeconds    int `mapstructure:"long_seconds"`    // 上传导入与同步执行的维护操作，仍受 write_timeout_seconds 约束
+		} `mapstructure:"route_timeouts"`
 	} `mapstructure:"server"`
 	Database struct {
 		Path string `mapstructure:"path"`
 	} `mapstructure:"database"`
 	Storage struct {
 		LocalDir string `mapstructure:"local_dir"`
-		OSS      struct {
+		// RefStoreMode 图生图参考图的保存方式: full 原图与缩略图 / thumbnail 仅缩略图 / hash 仅记录哈希与大小
+		RefStoreMode string `mapstructure:"ref_store_mode"`
+		// RefPathDirs 允许通过 refPaths 直接读取参考图的额外目录（存储目录始终允许）
+		RefPathDirs []string `mapstructure:"ref_path_dirs"`
+		OSS         struct {
 			Enabled         bool   `mapstructure:"enabled"`
 			Endpoint        string `mapstructure:"endpoint"`
 			AccessKeyID     string `mapstructure:"access_key_id"`
 			AccessKeySecret string `mapstructure:"access_key_secret"`
 			BucketName      string `mapstructure:"bucket_name"`
 			Domain          string `mapstructure:"domain"`
+			// Prefix 本服务写入的对象键前缀，与其他应用共用 Bucket 时用于隔离，孤立对象检查只列举该前缀
+			Prefix string `mapstructure:"prefix"`
 		} `mapstructure:"oss"`
+		// PublicURLPrefix 接口返回 OSS 地址时替换原始域名的前缀（如 CDN 地址），路径保持不变；为空时不改写
+		PublicURLPrefix string `mapstructure:"public_url_prefix"`
+		// MinFreeMB 存储目录所在磁盘的最低剩余空间（MB），低于该值时暂停接受生成任务；0 表示不检查
+		MinFreeMB int `mapstructure:"min_free_mb"`
 	} `mapstructure:"storage"`
 	Providers map[string]struct {
 		APIKey  string `mapstructure:"api_key"`
@@ -32,13 +62,119 @@ type Config struct {
 		Enabled bool   `mapstructure:"enabled"`
 	} `mapstructure:"providers"`
 	Prompts struct {
-		OptimizeSystem      string `mapstructure:"optimize_system"`
-		OptimizeSystemJSON  string `mapstructure:"optimize_system_json"`
-		ImageToPromptSystem string `mapstructure:"image_to_prompt_system"`
+		OptimizeSystem     string `mapstructure:"optimize_system"`
+		OptimizeSystemJSON string `mapstructure:"optimize_system_json"`
+		// OptimizeSystemEN / OptimizeSystemJSONEN 英文提示词使用的版本，为空时使用内置英文版本
+		OptimizeSystemEN     string `mapstructure:"optimize_system_en"`
+		OptimizeSystemJSONEN string `mapstructure:"optimize_system_json_en"`
+		ImageToPromptSystem  string `mapstructure:"image_to_prompt_system"`
+		CaptionSystem        string `mapstructure:"caption_system"`
+		// MaxLength 生成提示词的字符数上限，0 表示不限制；Provider 可通过 extra_config.max_prompt_length 覆盖
+		MaxLength int `mapstructure:"max_length"`
+		// AutoTruncate 超出上限时在句子边界截断并标记任务 truncated，而不是拒绝请求
+		AutoTruncate bool `mapstructure:"auto_truncate"`
+		// MaxOptimizeInput 提示词优化接口的输入字符数上限，0 表示不限制
+		MaxOptimizeInput int `mapstructure:"max_optimize_input"`
 	} `mapstructure:"prompts"`
+	Privacy struct {
+		// StripReferenceMetadata 参考图发往第三方前移除 EXIF/XMP（含 GPS 定位）
+		StripReferenceMetadata bool `mapstructure:"strip_reference_metadata"`
+		// DefaultPrivate 创建任务时未指定 private 参数的默认可见性
+		DefaultPrivate bool `mapstructure:"default_private"`
+	} `mapstructure:"privacy"`
+	Observability struct {
+		// SlowQueryMs SQL 超过该耗时（毫秒）记为慢查询，0 表示关闭
+		SlowQueryMs int `mapstructure:"slow_query_ms"`
+		// SlowRequestMs HTTP 请求超过该耗时（毫秒）输出慢请求日志，0 表示关闭
+		SlowRequestMs int `mapstructure:"slow_request_ms"`
+		// DebugEndpoints 未配置 server.api_token 时是否开放任务原始响应等调试接口；配置了 Token 时凭 Token 访问
+		DebugEndpoints bool `mapstructure:"debug_endpoints"`
+	} `mapstructure:"observability"`
+	Retention struct {
+		// Enabled 开启后每天按保留策略清理过期任务
+		Enabled bool `mapstructure:"enabled"`
+		// Days 已完成任务的保留天数
+		Days int `mapstructure:"days"`
+		// Mode 清理方式：delete 删除记录，archive 仅删除文件并将记录标记为已归档
+		Mode string `mapstructure:"mode"`
+		// RunAt 每日执行时间（本地时间 HH:MM），默认避开工作时间
+		RunAt string `mapstructure:"run_at"`
+		// BatchSize 每批处理的任务数，批次之间休眠 BatchIntervalMs 毫秒以限制 I/O
+		BatchSize       int `mapstructure:"batch_size"`
+		BatchIntervalMs int `mapstructure:"batch_interval_ms"`
+	} `mapstructure:"retention"`
+	Maintenance struct {
+		// Message 维护模式下拒绝生成请求时返回的提示
+		Message string `mapstructure:"message"`
+	} `mapstructure:"maintenance"`
+	SimilarPrompts struct {
+		// Threshold 提示词三元组相似度阈值（0~1），超过即视为相近
+		Threshold float64 `mapstructure:"threshold"`
+		// LookbackDays 只在最近若干天的任务中查找，0 表示不限
+		LookbackDays int `mapstructure:"lookback_days"`
+	} `mapstructure:"similar_prompts"`
+	ModelCatalog struct {
+		// CacheTTLMinutes 上游模型列表缓存有效期（分钟），过期后先返回缓存再后台刷新
+		CacheTTLMinutes int `mapstructure:"cache_ttl_minutes"`
+	} `mapstructure:"model_catalog"`
+	ProviderHealth struct {
+		// Enabled 开启后后台定期检查已启用的 Provider
+		Enabled bool `mapstructure:"enabled"`
+		// IntervalSeconds 检查间隔（秒），最小 30
+		IntervalSeconds int `mapstructure:"interval_seconds"`
+		// FailureThreshold 连续失败达到该次数后标记为降级
+		FailureThreshold int `mapstructure:"failure_threshold"`
+	} `mapstructure:"provider_health"`
+	Tasks struct {
+		// MinTimeoutSeconds / MaxTimeoutSeconds 任务参数 timeout_seconds 的允许范围
+		MinTimeoutSeconds int `mapstructure:"min_timeout_seconds"`
+		MaxTimeoutSeconds int `mapstructure:"max_timeout_seconds"`
+		// SubmitWaitMs 队列已满时提交任务最多等待的毫秒数，超时后返回 503
+		SubmitWaitMs int `mapstructure:"submit_wait_ms"`
+		// AspectTolerance 实际宽高比与请求比例的最大相对偏差，超过时标记 aspect_mismatch
+		AspectTolerance float64 `mapstructure:"aspect_tolerance"`
+		// AspectRetry 比例不符时自动重新生成一次（Provider 的 max_retries 为 0 时不重试）
+		AspectRetry bool `mapstructure:"aspect_retry"`
+		// CropGravity 参数 enforce_aspect=crop 裁剪时默认保留的区域: center / top / bottom / left / right ...
+		CropGravity string `mapstructure:"crop_gravity"`
+		// MaxCount 单次请求参数 count 的上限，Provider 可通过 extra_config.max_count 覆盖
+		MaxCount int `mapstructure:"max_count"`
+		// AutoCancelGraceSeconds 开启 auto_cancel_on_disconnect 的排队任务在没有客户端连接后保留的秒数
+		AutoCancelGraceSeconds int `mapstructure:"auto_cancel_grace_seconds"`
+	} `mapstructure:"tasks"`
+	Upload struct {
+		// MaxFileMB 单个参考图大小上限（MB）
+		MaxFileMB int `mapstructure:"max_file_mb"`
+		// MaxTotalMB 单次请求上传总大小上限（MB）
+		MaxTotalMB int `mapstructure:"max_total_mb"`
+	} `mapstructure:"upload"`
 }
 
-var GlobalConfig Config
+var (
+	// current 当前生效的配置。请求处理、Worker 与后台任务并发读取，重新加载时整体替换指针，
+	// 已取得的快照在使用期间不会被修改
+	current atomic.Pointer[Config]
+	// reloadMu 串行化配置加载，viper 本身不是并发安全的
+	reloadMu sync.Mutex
+	// emptyConfig InitConfig 之前读取时返回的零值配置
+	emptyConfig Config
+)
+
+// Get 返回当前配置的只读快照。同一次处理中需要读取多项配置时应保存返回值，避免前后读到不同版本；
+// 返回的结构体及其中的 map、slice 不得修改
+func Get() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return &emptyConfig
+}
+
+// Set 直接替换当前配置，不经过配置文件与校验；替换后 cfg 不得再修改。供测试按需调整配置
+func Set(cfg *Config) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	current.Store(cfg)
+}
 
 const DefaultOptimizeSystemPrompt = `
 你是一个「图像生成提示词优化师（Prompt Optimizer）」。
@@ -72,6 +208,91 @@ const DefaultOptimizeSystemPrompt = `
 无前缀，无解释，无标记。
 `
 
+// DefaultOptimizeSystemPromptEN 英文提示词使用的优化系统提示词，内容与 DefaultOptimizeSystemPrompt 对应
+const DefaultOptimizeSystemPromptEN = `
+You are an image-generation Prompt Optimizer.
+
+Your task is to understand the user's original description for generating an image, analyse the visual needs and potential problems it implies, and optimize the prompt while strictly following the original intent, so that it produces images that match the user's expectations more accurately and reliably.
+
+[Core principles]
+Intent first: understand the core visual intent of the description instead of merely substituting equivalent words.
+Diagnose problems: identify issues that may lead to poor results, such as ambiguity, contradictions, missing key information, or phrasing image models commonly misread.
+Improve effectiveness: refine wording, structure, emphasis and logic so the prompt performs better in image-generation models and yields higher-quality images closer to what the user imagines.
+
+[Language and safety constraints]
+Write the optimized prompt in English.
+Do not add any specific art movement, artist, technical term, brand, cultural symbol, decorative detail or color scheme the user did not explicitly mention.
+Do not make subjective artistic additions or design new content.
+
+[What you may do]
+Clarify and make concrete: turn subjective, abstract or colloquial descriptions into objective, visualizable neutral language.
+For example, turn "nice light" into "soft, even lighting" or "dramatic lighting with strong contrast".
+Resolve ambiguity and contradictions: adjust descriptions that could be read several ways or conflict internally.
+For example, "a transparent stone" can become "a mineral with a transparent texture".
+Improve logic and structure: reorder the description along the common "subject - attributes - environment - composition - style - quality" order so the model understands it more easily.
+Add essential visual basics: only when the description is so brief that the basic structure of the image is missing, you may add the most generic, neutral basics (such as "clearly visible", "complete composition", "well-proportioned"); this is optional.
+Integrate generic negative cues: you may weave the most generic quality cues (such as avoiding blur, distortion or missing details) into the positive description, but do not introduce negations about specific content (such as "no modern clothing").
+
+[Forbidden]
+Do not introduce any new, specific subject elements, style references or aesthetic judgements.
+Do not impose your personal preferences or your idea of a "good image" on the optimization.
+Do not output a separate "Negative Prompt" section. Everything must be merged into one fluent positive description.
+
+[Output format]
+Output only the optimized prompt text as a single paragraph.
+No prefix, no explanation, no markup.
+`
+
+// DefaultOptimizeSystemJSONPromptEN 英文提示词使用的 JSON 结构化改写系统提示词，字段与 DefaultOptimizeSystemJSONPrompt 一致
+const DefaultOptimizeSystemJSONPromptEN = `
+You are a Strict Prompt Rewriter for image generation.
+
+Rewrite the user's image description, keeping its meaning, into clearer and more concrete wording that image models understand well, and return it as JSON with the structure below. All keys are in English (new keys too) and all values must be written in English.
+
+{
+  "subject": {
+    "description": "Main subject and what it is doing",
+    "mirror_rules": "Text or UI elements that must stay readable and unmirrored, or null",
+    "age": "Apparent age, or not applicable",
+    "expression": { "eyes": null, "mouth": null, "overall": "Overall mood of the subject" },
+    "face": { "preserve_original": "false", "texture": null, "makeup": null, "features": null },
+    "hair": null,
+    "body": { "frame": null, "waist": null, "chest": null, "legs": null, "skin": null },
+    "pose": { "position": null, "base": null, "overall": "Pose or motion" },
+    "clothing": { "top": null, "bottom": null }
+  },
+  "accessories": { "jewelry": null, "device": null, "prop": null },
+  "photography": {
+    "camera_style": "Photo / render / illustration style only if the user mentioned it",
+    "angle": "Camera angle",
+    "shot_type": "Shot type",
+    "aspect_ratio": "Aspect ratio if mentioned",
+    "texture": null,
+    "lighting": "Lighting",
+    "depth_of_field": null
+  },
+  "background": { "setting": "Where the scene takes place", "wall_color": null, "elements": [], "atmosphere": null, "lighting": null },
+  "the_vibe": { "energy": null, "mood": null, "authenticity": null, "intimacy": null, "story": null, "caption_energy": null },
+  "constraints": { "must_keep": [], "avoid": [] },
+  "negative_prompt": []
+}
+
+Rules:
+- Only restate what the user described; use null or empty arrays for anything not mentioned. Do not invent styles, artists, brands or details.
+- Keep exact text the user wants rendered in the image unchanged.
+- Output only the JSON object, with no Markdown code fences, prefix or explanation.
+`
+
+// DefaultCaptionSystem 为图库图片生成替代文本 (alt text) 的系统提示词
+const DefaultCaptionSystem = `你是一名无障碍与 SEO 文案编辑。请为用户提供的图片撰写一段替代文本（alt text）。
+要求：
+- 客观描述画面中的主体、动作、场景与关键视觉元素，不做主观评价；
+- 一到两句话，不超过 160 个字符；
+- 不要以“图片中”“这是一张图片”等措辞开头；
+- 输出语言：{{LANGUAGE}}；
+- 只输出替代文本本身，无前缀、无引号、无解释。
+`
+
 // DefaultImageToPromptSystem 图片逆向提示词的系统提示词
 // 注意：输出语言要求由后端根据用户语言动态添加
 const DefaultImageToPromptSystem = `你是一个AI绘图提示词专家。请分析用户提供的图片，直接输出一个详细的、可以用来生成相似图片的AI绘图提示词。
@@ -214,21 +435,113 @@ func InitConfig() {
 	// 设置默认值
 	viper.SetDefault("database.path", "data.db")
 	viper.SetDefault("storage.local_dir", "storage")
+	viper.SetDefault("storage.ref_store_mode", "full")
+	viper.SetDefault("storage.public_url_prefix", "")
+	viper.SetDefault("storage.min_free_mb", 200)
 	viper.SetDefault("server.host", "127.0.0.1")
 	viper.SetDefault("server.port", 8080)
+	viper.SetDefault("server.read_header_timeout_seconds", 10)
+	viper.SetDefault("server.read_timeout_seconds", 300)
+	viper.SetDefault("server.write_timeout_seconds", 300)
+	viper.SetDefault("server.route_timeouts.default_seconds", 60)
+	viper.SetDefault("server.route_timeouts.chat_seconds", 180)
+	viper.SetDefault("server.route_timeouts.long_seconds", 0)
+	viper.SetDefault("server.max_body_mb", 4)
 	viper.SetDefault("prompts.optimize_system", DefaultOptimizeSystemPrompt)
 	viper.SetDefault("prompts.optimize_system_json", DefaultOptimizeSystemJSONPrompt)
+	viper.SetDefault("prompts.optimize_system_en", DefaultOptimizeSystemPromptEN)
+	viper.SetDefault("prompts.optimize_system_json_en", DefaultOptimizeSystemJSONPromptEN)
 	viper.SetDefault("prompts.image_to_prompt_system", DefaultImageToPromptSystem)
+	viper.SetDefault("prompts.caption_system", DefaultCaptionSystem)
+	viper.SetDefault("prompts.max_length", 8000)
+	viper.SetDefault("prompts.auto_truncate", false)
+	viper.SetDefault("prompts.max_optimize_input", 20000)
+	viper.SetDefault("privacy.strip_reference_metadata", true)
+	viper.SetDefault("privacy.default_private", false)
+	viper.SetDefault("observability.slow_query_ms", 200)
+	viper.SetDefault("observability.slow_request_ms", 1000)
+	viper.SetDefault("observability.debug_endpoints", false)
+	viper.SetDefault("retention.enabled", false)
+	viper.SetDefault("retention.days", 90)
+	viper.SetDefault("retention.mode", "delete")
+	viper.SetDefault("retention.run_at", "03:00")
+	viper.SetDefault("retention.batch_size", 100)
+	viper.SetDefault("retention.batch_interval_ms", 500)
+	viper.SetDefault("similar_prompts.threshold", 0.75)
+	viper.SetDefault("similar_prompts.lookback_days", 180)
+	viper.SetDefault("model_catalog.cache_ttl_minutes", 360)
+	viper.SetDefault("provider_health.enabled", false)
+	viper.SetDefault("provider_health.interval_seconds", 300)
+	viper.SetDefault("provider_health.failure_threshold", 3)
+	viper.SetDefault("tasks.min_timeout_seconds", 30)
+	viper.SetDefault("tasks.max_timeout_seconds", 1800)
+	viper.SetDefault("tasks.submit_wait_ms", 3000)
+	viper.SetDefault("tasks.aspect_tolerance", 0.03)
+	viper.SetDefault("tasks.aspect_retry", false)
+	viper.SetDefault("tasks.crop_gravity", "center")
+	viper.SetDefault("tasks.max_count", 4)
+	viper.SetDefault("tasks.auto_cancel_grace_seconds", 60)
+	viper.SetDefault("upload.max_file_mb", 15)
+	viper.SetDefault("upload.max_total_mb", 60)
+	viper.SetDefault("maintenance.message", "服务维护中，暂不接受新的生成任务，请稍后再试")
 
 	// 支持环境变量
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("未找到配置文件，将使用环境变量或默认值: %v", err)
 	}
 
-	if err := viper.Unmarshal(&GlobalConfig); err != nil {
+	cfg, err := load()
+	if err != nil {
 		log.Fatalf("解析配置失败: %v", err)
 	}
+	current.Store(cfg)
+}
+
+// Reload 重新读取配置文件与环境变量，解析并校验通过后整体替换当前配置；
+// 配置文件有语法错误或校验失败时返回错误并保留原配置
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return fmt.Errorf("读取配置文件失败: %w", err)
+		}
+	}
+
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+	log.Printf("配置已重新加载")
+	return nil
+}
+
+// load 按 viper 当前的配置源解析出一份新的配置
+func load() (*Config, error) {
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// validate 只拒绝无法使用的取值；超出范围的数值由各使用方按默认值或上下限处理
+func (c *Config) validate() error {
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("server.port 超出范围: %d", c.Server.Port)
+	}
+	if strings.TrimSpace(c.Database.Path) == "" {
+		return errors.New("database.path 不能为空")
+	}
+	return nil
 }
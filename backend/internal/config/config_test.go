@@ -0,0 +1,60 @@
+package config
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReloadSwapsValidatedConfig 重新加载成功时整体替换配置，配置文件有误时返回错误并保留原配置，
+// 已取得的旧配置快照不受替换影响
+func TestReloadSwapsValidatedConfig(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeConfigFile(t, dir, "tasks:\n  max_count: 6\n")
+	InitConfig()
+	before := Get()
+	if before.Tasks.MaxCount != 6 {
+		t.Fatalf("tasks.max_count = %d，期望 6", before.Tasks.MaxCount)
+	}
+
+	writeConfigFile(t, dir, "tasks:\n  max_count: 8\nserver:\n  port: 8181\n")
+	if err := Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	after := Get()
+	if after.Tasks.MaxCount != 8 || after.Server.Port != 8181 {
+		t.Fatalf("重新加载后 max_count=%d port=%d", after.Tasks.MaxCount, after.Server.Port)
+	}
+	if after.Tasks.SubmitWaitMs != 3000 {
+		t.Fatalf("未写入文件的配置项应保留默认值，submit_wait_ms = %d", after.Tasks.SubmitWaitMs)
+	}
+	if before.Tasks.MaxCount != 6 {
+		t.Fatal("重新加载修改了旧的配置快照")
+	}
+
+	for name, content := range map[string]string{
+		"语法错误": "tasks: [max_count\n",
+		"校验失败": "server:\n  port: 70000\n",
+	} {
+		writeConfigFile(t, dir, content)
+		if err := Reload(); err == nil {
+			t.Fatalf("%s: 重新加载应返回错误", name)
+		}
+		if Get() != after {
+			t.Fatalf("%s: 重新加载失败后配置被替换", name)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// 作业状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	// progressFlushInterval 运行中的进度写库间隔，查询接口直接读取内存中的最新进度
+	progressFlushInterval = 2 * time.Second
+	maxListLimit          = 200
+)
+
+var (
+	ErrUnknownType = errors.New("未知的作业类型")
+	ErrNotFound    = errors.New("作业不存在")
+	ErrFinished    = errors.New("作业已结束，无法取消")
+)
+
+// ActiveError 同类型作业已在排队或运行，Job 为该作业
+type ActiveError struct {
+	Job *model.Job
+}
+
+func (e *ActiveError) Error() string {
+	return "同类作业正在排队或运行: " + e.Job.JobID
+}
+
+// Handler 执行一个作业；应定期检查 ctx，取消后尽快返回
+type Handler func(ctx context.Context, run *Run) error
+
+var (
+	mu       sync.Mutex
+	handlers = make(map[string]Handler)
+	// current 正在执行的作业，执行器同一时间只运行一个作业
+	current *Run
+	wake    = make(chan struct{}, 1)
+	started bool
+)
+
+// Register 注册作业类型，需在 Start 之前调用
+func Register(jobType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[jobType] = handler
+}
+
+// Types 返回已注册的作业类型
+func Types() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	types := make([]string, 0, len(handlers))
+	for jobType := range handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Start 将上次进程退出时仍在运行的作业标记为中断，然后启动执行器处理排队中的作业
+func Start() {
+	mu.Lock()
+	if started {
+		mu.Unlock()
+		return
+	}
+	started = true
+	mu.Unlock()
+
+	now := time.Now()
+	result := model.DB.Model(&model.Job{}).Where("status = ?", StatusRunning).Updates(map[string]interface{}{
+		"status":      StatusFailed,
+		"error":       "服务重启，作业已中断",
+		"finished_at": now,
+	})
+	if result.Error != nil {
+		log.Printf("[Jobs] 标记中断作业失败: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[Jobs] %d 个作业因服务重启中断", result.RowsAffected)
+	}
+	go loop()
+}
+
+// Enqueue 创建一个排队中的作业；同类型作业已在排队或运行时返回 *ActiveError
+func Enqueue(jobType string, params interface{}) (*model.Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if handlers[jobType] == nil {
+		return nil, ErrUnknownType
+	}
+
+	var active model.Job
+	err := model.DB.Where("type = ? AND status IN ?", jobType, []string{StatusPending, StatusRunning}).
+		Order("id ASC").First(&active).Error
+	if err == nil {
+		overlayRunning(&active)
+		return nil, &ActiveError{Job: &active}
+	}
+
+	job := &model.Job{
+		JobID:  uuid.New().String(),
+		Type:   jobType,
+		Status: StatusPending,
+	}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("序列化作业参数失败: %w", err)
+		}
+		job.Params = string(data)
+	}
+	if err := model.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get 返回作业详情，运行中的作业返回内存中的最新进度
+func Get(jobID string) (*model.Job, error) {
+	var job model.Job
+	if err := model.DB.Where("job_id = ?", jobID).First(&job).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	mu.Lock()
+	overlayRunning(&job)
+	mu.Unlock()
+	return &job, nil
+}
+
+// Latest 返回指定类型最近创建的作业，没有时返回 ErrNotFound
+func Latest(jobType string) (*model.Job, error) {
+	var job model.Job
+	if err := model.DB.Where("type = ?", jobType).Order("id DESC").First(&job).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	mu.Lock()
+	overlayRunning(&job)
+	mu.Unlock()
+	return &job, nil
+}
+
+// List 按创建时间倒序列出作业，jobType / status 为空时不过滤
+func List(jobType, status string, limit int) ([]model.Job, error) {
+	if limit <= 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+	query := model.DB.Model(&model.Job{})
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var list []model.Job
+	if err := query.Order("id DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	for i := range list {
+		overlayRunning(&list[i])
+	}
+	mu.Unlock()
+	return list, nil
+}
+
+// Cancel 取消作业：排队中的作业直接标记为已取消，运行中的作业通知处理函数停止
+func Cancel(jobID string) (*model.Job, error) {
+	mu.Lock()
+	if current != nil && current.job.JobID == jobID {
+		run := current
+		mu.Unlock()
+		run.cancel()
+		job := run.snapshot()
+		return &job, nil
+	}
+	mu.Unlock()
+
+	now := time.Now()
+	result := model.DB.Model(&model.Job{}).Where("job_id = ? AND status = ?", jobID, StatusPending).Updates(map[string]interface{}{
+		"status":      StatusCancelled,
+		"finished_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	job, err := Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return job, ErrFinished
+	}
+	log.Printf("[Jobs] 作业 %s (%s) 已取消", job.JobID, job.Type)
+	return job, nil
+}
+
+// overlayRunning 用内存中的进度覆盖运行中作业的数据库记录，调用方需持有 mu
+func overlayRunning(job *model.Job) {
+	if current != nil && current.job.JobID == job.JobID {
+		*job = current.snapshot()
+	}
+}
+
+func loop() {
+	for {
+		var job model.Job
+		err := model.DB.Where("status = ?", StatusPending).Order("id ASC").First(&job).Error
+		if err != nil {
+			<-wake
+			continue
+		}
+		execute(&job)
+	}
+}
+
+func execute(job *model.Job) {
+	mu.Lock()
+	handler := handlers[job.Type]
+	mu.Unlock()
+
+	now := time.Now()
+	if handler == nil {
+		model.DB.Model(job).Updates(map[string]interface{}{
+			"status":      StatusFailed,
+			"error":       ErrUnknownType.Error() + ": " + job.Type,
+			"finished_at": now,
+		})
+		return
+	}
+	// 条件更新，避免与取消排队作业的请求竞争
+	result := model.DB.Model(&model.Job{}).Where("id = ? AND status = ?", job.ID, StatusPending).Updates(map[string]interface{}{
+		"status":     StatusRunning,
+		"started_at": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	job.Status = StatusRunning
+	job.StartedAt = &now
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := &Run{job: *job, counters: make(map[string]int64), cancel: cancel, lastFlush: now}
+	mu.Lock()
+	current = run
+	mu.Unlock()
+
+	log.Printf("[Jobs] 开始执行作业 %s (%s)", job.JobID, job.Type)
+	err := runHandler(ctx, handler, run)
+
+	finished := time.Now()
+	run.mu.Lock()
+	run.job.FinishedAt = &finished
+	switch {
+	case ctx.Err() != nil:
+		run.job.Status = StatusCancelled
+	case err != nil:
+		run.job.Status = StatusFailed
+		run.job.Error = err.Error()
+	default:
+		run.job.Status = StatusCompleted
+	}
+	run.mu.Unlock()
+	run.flush(true)
+
+	mu.Lock()
+	current = nil
+	mu.Unlock()
+
+	final := run.snapshot()
+	log.Printf("[Jobs] 作业 %s (%s) 结束: %s, 已处理 %d/%d %s %s", final.JobID, final.Type, final.Status, final.Processed, final.Total, final.Result, final.Error)
+}
+
+// runHandler 执行处理函数，panic 视为作业失败，不影响执行器继续处理后续作业
+func runHandler(ctx context.Context, handler Handler, run *Run) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("作业执行异常: %v", r)
+		}
+	}()
+	return handler(ctx, run)
+}
+
+// Run 正在执行的作业，处理函数通过它读取参数并上报进度
+type Run struct {
+	mu        sync.Mutex
+	job       model.Job
+	counters  map[string]int64
+	cancel    context.CancelFunc
+	lastFlush time.Time
+}
+
+// ID 返回作业 ID
+func (r *Run) ID() string {
+	return r.job.JobID
+}
+
+// Params 将作业参数解析到 v，没有参数时保持 v 不变
+func (r *Run) Params(v interface{}) error {
+	if r.job.Params == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(r.job.Params), v)
+}
+
+// SetTotal 设置需处理的总数
+func (r *Run) SetTotal(total int64) {
+	r.mu.Lock()
+	r.job.Total = total
+	r.mu.Unlock()
+	r.flush(false)
+}
+
+// Advance 增加已处理数量
+func (r *Run) Advance(n int64) {
+	r.mu.Lock()
+	r.job.Processed += n
+	r.mu.Unlock()
+	r.flush(false)
+}
+
+// Count 累加结果计数（如 updated / failed），作业结束后保存在 Result 中
+func (r *Run) Count(key string, delta int64) {
+	r.mu.Lock()
+	r.counters[key] += delta
+	r.mu.Unlock()
+}
+
+func (r *Run) snapshot() model.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.job
+	if len(r.counters) > 0 {
+		data, _ := json.Marshal(r.counters)
+		job.Result = string(data)
+	}
+	return job
+}
+
+// flush 将进度写入数据库；非强制时按 progressFlushInterval 限流
+func (r *Run) flush(force bool) {
+	r.mu.Lock()
+	if !force && time.Since(r.lastFlush) < progressFlushInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastFlush = time.Now()
+	r.mu.Unlock()
+
+	job := r.snapshot()
+	updates := map[string]interface{}{
+		"status":    job.Status,
+		"total":     job.Total,
+		"processed": job.Processed,
+		"result":    job.Result,
+		"error":     job.Error,
+	}
+	if job.FinishedAt != nil {
+		updates["finished_at"] = job.FinishedAt
+	}
+	if err := model.DB.Model(&model.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("[Jobs] 保存作业 %s 进度失败: %v", job.JobID, err)
+	}
+}
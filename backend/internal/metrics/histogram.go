@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 耗时直方图默认分桶（秒），覆盖毫秒级查询到数十秒的慢请求
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram 带标签的耗时直方图，输出格式兼容 Prometheus 文本协议
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Histogram
+)
+
+// NewHistogram 创建并注册一个直方图
+func NewHistogram(name, help string, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: DefaultBuckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	registryMu.Lock()
+	registry = append(registry, h)
+	registryMu.Unlock()
+	return h
+}
+
+// Observe 记录一次耗时，labelValues 顺序需与创建时的标签一致
+func (h *Histogram) Observe(d time.Duration, labelValues ...string) {
+	seconds := d.Seconds()
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if seconds <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		base := h.labelPairs(s.labelValues)
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.name, joinLabels(base, fmt.Sprintf("le=%q", formatFloat(upper))), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.name, joinLabels(base, `le="+Inf"`), s.count)
+		if base == "" {
+			fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count %d\n", h.name, s.count)
+		} else {
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, base, formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, base, s.count)
+		}
+	}
+}
+
+func (h *Histogram) labelPairs(values []string) string {
+	pairs := make([]string, 0, len(h.labels))
+	for i, name := range h.labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(base, extra string) string {
+	if base == "" {
+		return extra
+	}
+	return base + "," + extra
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
+
+// WriteText 以 Prometheus 文本格式输出所有已注册的指标
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	histograms := append([]*Histogram(nil), registry...)
+	registryMu.Unlock()
+	for _, h := range histograms {
+		h.write(w)
+	}
+}
@@ -1,39 +1,67 @@
 package model
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-// InitDB 初始化 SQLite 数据库
+// 图库排序使用的表达式：可为空的字段统一用 COALESCE 归一，便于游标分页比较。
+// 同名表达式索引在 InitDB 中创建，查询时须逐字使用这些表达式才能命中索引
+const (
+	TaskSortCompletedAt = "COALESCE(completed_at, '')"
+	TaskSortDuration    = "COALESCE(julianday(completed_at) - julianday(created_at), -1)"
+	TaskSortFileSize    = "COALESCE(file_size, 0)"
+	TaskSortWidth       = "COALESCE(width, 0)"
+)
+
+// InitDB 初始化 SQLite 数据库，失败时退出进程
 func InitDB(dbPath string) {
-	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath+"?_busy_timeout=5000"), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	if err := OpenDB(dbPath); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// OpenDB 打开并迁移 SQLite 数据库，失败时返回错误且不修改 DB，可在数据库恢复可写后再次调用。
+// 迁移前先做一次写入探测：已迁移的数据库 AutoMigrate 不会写入，只读的数据库要到第一次写入时才会暴露
+func OpenDB(dbPath string) error {
+	db, err := gorm.Open(sqlite.Open(dbPath+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: newTimingLogger(),
 	})
 	if err != nil {
-		log.Fatalf("无法连接数据库: %v", err)
+		return fmt.Errorf("无法连接数据库: %w", err)
 	}
 
 	// 设置连接池参数
-	sqlDB, err := DB.DB()
+	sqlDB, err := db.DB()
 	if err == nil {
 		sqlDB.SetMaxOpenConns(1) // SQLite 建议写操作时设置为 1，或者使用 WAL 模式
 		sqlDB.SetMaxIdleConns(1)
 		sqlDB.SetConnMaxLifetime(time.Hour)
 	}
+	fail := func(err error) error {
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+		return err
+	}
+
+	if err := probeWritable(db); err != nil {
+		return fail(fmt.Errorf("数据库不可写: %w", err))
+	}
 
 	// 自动迁移表结构
-	err = DB.AutoMigrate(&ProviderConfig{}, &Task{})
+	err = db.AutoMigrate(&ProviderConfig{}, &Task{}, &TaskEvent{}, &TaskReference{}, &Setting{}, &AuditLog{}, &Tag{}, &TaskTag{}, &Job{}, &PendingDeletion{})
 	if err != nil {
-		log.Fatalf("数据库迁移失败: %v", err)
+		return fail(fmt.Errorf("数据库迁移失败: %w", err))
 	}
+	DB = db
 
 	// 兼容旧版本默认超时（0/60s）记录：按 Provider 类型修复到对应默认值
 	if err := DB.Model(&ProviderConfig{}).
@@ -47,5 +75,79 @@ func InitDB(dbPath string) {
 		log.Printf("更新对话默认超时失败: %v", err)
 	}
 
+	backfillRootTaskIDs()
+	backfillPromptPreviews()
+	ensureTaskSortIndexes()
+
 	log.Println("数据库初始化成功")
+	return nil
+}
+
+// probeWritable 原值写回 user_version，只读文件、目录不可写（无法创建日志文件）或被其他进程锁定时返回错误
+func probeWritable(db *gorm.DB) error {
+	var version int
+	if err := db.Raw("PRAGMA user_version").Scan(&version).Error; err != nil {
+		return err
+	}
+	return db.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)).Error
+}
+
+// 数据库不可用的原因分类，供启动状态接口展示
+const (
+	DBErrorReadOnly    = "read_only"   // 文件或所在目录不可写
+	DBErrorLocked      = "locked"      // 被其他进程锁定
+	DBErrorUnavailable = "unavailable" // 文件无法打开（目录不存在、无权限等）
+	DBErrorOther       = "other"       // 其他错误，如迁移失败、文件损坏
+)
+
+// ClassifyDBError 按 SQLite 错误信息判断数据库不可用的原因；只读、锁定与无法打开通常是暂时的，
+// 例如桌面端启动时应用数据目录尚未就绪，值得稍后重试
+func ClassifyDBError(err error) (kind string, transient bool) {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "readonly") || strings.Contains(msg, "read-only") || strings.Contains(msg, "read only"):
+		return DBErrorReadOnly, true
+	case strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") || strings.Contains(msg, "busy"):
+		return DBErrorLocked, true
+	case strings.Contains(msg, "unable to open") || strings.Contains(msg, "permission denied"):
+		return DBErrorUnavailable, true
+	}
+	return DBErrorOther, false
+}
+
+// backfillRootTaskIDs 为旧版本创建的派生任务补全 root_task_id。每轮只处理来源任务已确定根节点
+// （来源任务本身是根、已有 root_task_id 或已不存在）的记录，逐层向下传递
+func backfillRootTaskIDs() {
+	const maxDepth = 32
+	for i := 0; i < maxDepth; i++ {
+		result := DB.Exec(`UPDATE tasks SET root_task_id = COALESCE(
+				(SELECT COALESCE(NULLIF(p.root_task_id, ''), p.task_id) FROM tasks p WHERE p.task_id = tasks.parent_task_id),
+				parent_task_id)
+			WHERE parent_task_id <> '' AND COALESCE(root_task_id, '') = ''
+			AND NOT EXISTS (
+				SELECT 1 FROM tasks p WHERE p.task_id = tasks.parent_task_id
+				AND COALESCE(p.parent_task_id, '') <> '' AND COALESCE(p.root_task_id, '') = '')`)
+		if result.Error != nil {
+			log.Printf("补全派生任务 root_task_id 失败: %v", result.Error)
+			return
+		}
+		if result.RowsAffected == 0 {
+			return
+		}
+	}
+}
+
+// ensureTaskSortIndexes 为图库排序表达式创建表达式索引（AutoMigrate 不支持表达式索引）
+func ensureTaskSortIndexes() {
+	indexes := map[string]string{
+		"idx_tasks_sort_completed_at": TaskSortCompletedAt,
+		"idx_tasks_sort_duration":     TaskSortDuration,
+		"idx_tasks_sort_file_size":    TaskSortFileSize,
+		"idx_tasks_sort_width":        TaskSortWidth,
+	}
+	for name, expr := range indexes {
+		if err := DB.Exec("CREATE INDEX IF NOT EXISTS " + name + " ON tasks (" + expr + ")").Error; err != nil {
+			log.Printf("创建排序索引 %s 失败: %v", name, err)
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/metrics"
+
+	"gorm.io/gorm/logger"
+)
+
+// SlowQueryThreshold 超过该耗时的 SQL 会以 [SlowQuery] 标记输出，需在 InitDB 之前设置
+var SlowQueryThreshold = 200 * time.Millisecond
+
+var dbQueryDuration = metrics.NewHistogram("db_query_duration_seconds", "SQL 执行耗时", "op")
+
+// DBTimer 统计单个请求上下文内的 SQL 次数与累计耗时
+type DBTimer struct {
+	queries atomic.Int64
+	nanos   atomic.Int64
+}
+
+// Queries 返回累计 SQL 次数
+func (t *DBTimer) Queries() int64 { return t.queries.Load() }
+
+// Elapsed 返回累计 SQL 耗时
+func (t *DBTimer) Elapsed() time.Duration { return time.Duration(t.nanos.Load()) }
+
+type dbTimerKey struct{}
+
+// WithDBTimer 在上下文中挂载 SQL 计时器；使用 DB.WithContext(ctx) 执行的查询都会计入
+func WithDBTimer(ctx context.Context) (context.Context, *DBTimer) {
+	timer := &DBTimer{}
+	return context.WithValue(ctx, dbTimerKey{}, timer), timer
+}
+
+// timingLogger 包装 GORM 默认日志：记录耗时指标、累计请求内的 SQL 耗时并单独标记慢查询
+type timingLogger struct {
+	logger.Interface
+}
+
+func newTimingLogger() logger.Interface {
+	return &timingLogger{
+		Interface: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			// 慢查询由 timingLogger 统一输出，这里关闭默认的慢查询告警避免重复
+			SlowThreshold: 0,
+			LogLevel:      logger.Info,
+			Colorful:      true,
+		}),
+	}
+}
+
+func (l *timingLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &timingLogger{Interface: l.Interface.LogMode(level)}
+}
+
+func (l *timingLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+
+	dbQueryDuration.Observe(elapsed, sqlOperation(sql))
+	if timer, ok := ctx.Value(dbTimerKey{}).(*DBTimer); ok {
+		timer.queries.Add(1)
+		timer.nanos.Add(int64(elapsed))
+	}
+	if SlowQueryThreshold > 0 && elapsed > SlowQueryThreshold {
+		log.Printf("[SlowQuery] elapsed=%s threshold=%s rows=%d sql=%q", elapsed, SlowQueryThreshold, rows, sql)
+	}
+
+	l.Interface.Trace(ctx, begin, func() (string, int64) { return sql, rows }, err)
+}
+
+// sqlOperation 取 SQL 首个关键字作为指标标签（SELECT/INSERT/UPDATE/DELETE/...）
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,27 @@
+package model
+
+// 接口与任务的错误码。错误文案可能随版本调整，客户端应根据错误码决定重试还是提示重新配置
+const (
+	ErrCodeProviderNotFound   = "PROVIDER_NOT_FOUND"   // Provider 不存在或未启用
+	ErrCodeProviderKeyMissing = "PROVIDER_KEY_MISSING" // Provider 未配置 API Key
+	ErrCodeQueueFull          = "QUEUE_FULL"           // 任务队列已满，可稍后重试
+	ErrCodeTaskNotFound       = "TASK_NOT_FOUND"       // 任务不存在
+	ErrCodeValidationFailed   = "VALIDATION_FAILED"    // 请求参数校验失败
+	ErrCodeUpstreamError      = "UPSTREAM_ERROR"       // 上游接口调用失败
+	ErrCodeRateLimited        = "RATE_LIMITED"         // 上游限流或服务繁忙，可稍后重试
+	ErrCodeSafetyBlocked      = "SAFETY_BLOCKED"       // 被上游安全策略拦截，重试通常无效
+	ErrCodeTimeout            = "TIMEOUT"              // 生成超时
+	ErrCodeStorageError       = "STORAGE_ERROR"        // 数据库或文件存储失败
+	ErrCodeStorageUnavailable = "STORAGE_UNAVAILABLE"  // 存储目录不可写或磁盘空间不足，暂不接受新任务，条件恢复后自动恢复
+	ErrCodeNotFound           = "NOT_FOUND"            // 其他资源不存在
+	ErrCodeUnauthorized       = "UNAUTHORIZED"         // 未携带或携带了错误的 API Token
+	ErrCodeConflict           = "CONFLICT"             // 资源状态冲突
+	ErrCodeCancelled          = "CANCELLED"            // 任务被用户取消
+	ErrCodeAbandoned          = "ABANDONED"            // 排队期间客户端断开超过宽限时间，任务被自动取消（auto_cancel_on_disconnect）
+	ErrCodeInterrupted        = "INTERRUPTED"          // 服务异常退出时任务尚未完成，可重新提交
+	ErrCodeMaintenance        = "MAINTENANCE"          // 服务处于维护模式，暂不接受新任务
+	ErrCodeBudgetExceeded     = "BUDGET_EXCEEDED"      // 超出 Provider 每日请求数或费用上限
+	ErrCodeWorkerStalled      = "WORKER_STALLED"       // 处理任务的 Worker 长时间没有心跳，任务被强制终止，可重新提交
+	ErrCodeStartupDegraded    = "STARTUP_DEGRADED"     // 数据库不可用，服务以降级模式运行，等待数据库恢复后完成启动
+	ErrCodeInternal           = "INTERNAL_ERROR"       // 服务内部错误
+)
@@ -18,6 +18,9 @@ type ProviderConfig struct {
 	TimeoutSeconds int            `gorm:"default:150" json:"timeout_seconds"`        // 超时时间
 	MaxRetries     int            `gorm:"default:3" json:"max_retries"`              // 最大重试次数
 	ExtraConfig    string         `json:"extra_config"`                              // 额外配置 JSON
+	DefaultParams  string         `json:"default_params"`                            // 默认生成参数 JSON，生成时合并在请求参数之下
+	ModelsCache    string         `json:"-"`                                         // 上游模型列表缓存 JSON
+	ModelsCachedAt *time.Time     `json:"models_cached_at,omitempty"`                // 模型列表缓存时间
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
@@ -28,19 +31,138 @@ type Task struct {
 	ID             uint           `gorm:"primaryKey" json:"id"`
 	TaskID         string         `gorm:"uniqueIndex;not null" json:"task_id"`              // 外部调用的唯一 ID
 	Prompt         string         `gorm:"index:idx_prompt_search;index" json:"prompt"`      // 提示词，添加复合索引支持搜索
+	PromptPreview  string         `json:"prompt_preview"`                                   // 提示词前 200 个字符，写入时计算，图库列表默认只返回该字段
+	Truncated      bool           `json:"truncated,omitempty"`                              // 提示词超过长度上限，已按 prompts.auto_truncate 自动截断
 	ProviderName   string         `gorm:"index" json:"provider_name"`                       // 使用的 Provider
 	ModelID        string         `gorm:"index" json:"model_id"`                            // 使用的模型 ID
 	Status         string         `gorm:"index:idx_status_created;not null" json:"status"`  // 状态，与创建时间组成复合索引
+	Progress       int            `json:"progress,omitempty"`                               // 生成进度百分比，仅流式模式的上游会上报
 	ErrorMessage   string         `json:"error_message"`                                    // 错误信息
-	ImageURL       string         `json:"image_url"`                                        // OSS 访问地址
+	ErrorCode      string         `json:"error_code,omitempty"`                             // 错误码，取值见 error_codes.go
+	ErrorClass     string         `json:"error_class,omitempty"`                            // 失败原因分类: network / rate_limit / invalid_key ...
+	RetryAfter     int            `json:"retry_after,omitempty"`                            // 上游建议的重试等待秒数
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`                        // 限流等待中（rate_limited）的任务下次尝试的时间
+	RateLimitRetry int            `json:"rate_limit_retries,omitempty"`                     // 因限流自动重试的次数，不超过 Provider 的 max_retries
+	ProviderDebug  string         `json:"-"`                                                // 失败时附带的上游抓包记录 JSON（Provider 开启 debug_capture 时），仅 /tasks/:id/debug 返回
+	DebugResponse  string         `json:"-"`                                                // 失败时上游的原始响应（已脱敏、截断到 64KB），仅 /tasks/:id/debug 返回；成功任务不保存
+	ImageURL       RemoteURL      `json:"image_url"`                                        // OSS 访问地址
 	LocalPath      string         `json:"local_path"`                                       // 本地存储路径
-	ThumbnailURL   string         `json:"thumbnail_url"`                                    // 缩略图 OSS 访问地址
+	ThumbnailURL   RemoteURL      `json:"thumbnail_url"`                                    // 缩略图 OSS 访问地址
 	ThumbnailPath  string         `json:"thumbnail_path"`                                   // 缩略图本地存储路径
+	ThumbnailHash  string         `gorm:"index" json:"thumbnail_hash,omitempty"`            // 缩略图内容哈希，文件名为 thumb_<hash>.jpg；旧版缩略图为空
+	ThumbnailSrc   string         `gorm:"-" json:"thumbnail_src,omitempty"`                 // 缩略图访问地址，读取时由 ThumbnailPath / ThumbnailURL 计算
+	ThumbStatus    string         `gorm:"index" json:"thumbnail_status,omitempty"`          // 缩略图状态: pending / ready / failed，保存时同步生成缩略图的任务为空
+	SyncStatus     string         `gorm:"index" json:"remote_sync_status,omitempty"`        // OSS 同步状态: synced / partial / failed，未启用 OSS 时为空
+	SyncError      string         `json:"remote_sync_error,omitempty"`                      // OSS 同步失败原因
 	Width          int            `json:"width"`                                            // 图片宽度
 	Height         int            `json:"height"`                                           // 图片高度
+	AspectRatio    string         `json:"requested_aspect_ratio,omitempty"`                 // 请求的宽高比，如 16:9
+	AspectMismatch bool           `gorm:"index" json:"aspect_mismatch,omitempty"`           // 实际宽高比与请求比例偏差超出容差
+	Cropped        bool           `json:"cropped,omitempty"`                                // 已按 enforce_aspect=crop 裁剪到请求比例
+	OriginalPath   string         `json:"original_path,omitempty"`                          // 裁剪前原图的本地路径
+	OriginalWidth  int            `json:"original_width,omitempty"`                         // 裁剪前宽度
+	OriginalHeight int            `json:"original_height,omitempty"`                        // 裁剪前高度
+	FileSize       int64          `gorm:"index" json:"file_size"`                           // 原图文件大小（字节）
+	ContentHash    string         `gorm:"index" json:"content_hash,omitempty"`              // 导入图片的 SHA-256，用于去重
+	PerceptualHash string         `gorm:"index" json:"perceptual_hash,omitempty"`           // 感知哈希 (dHash)，用于查找近似重复的图片
 	TotalCount     int            `gorm:"default:1" json:"total_count"`                     // 申请生成的数量
 	ConfigSnapshot string         `json:"config_snapshot"`                                  // 生成时的配置快照
+	TaskType       string         `gorm:"default:generate;index" json:"task_type"`          // 任务类型: generate / edit
+	ParentTaskID   string         `gorm:"index" json:"parent_task_id"`                      // 派生任务的来源任务 ID
+	RootTaskID     string         `gorm:"index" json:"root_task_id,omitempty"`              // 派生链最顶层的任务 ID，来源任务被删除后仍保留
+	GroupID        string         `gorm:"index" json:"group_id,omitempty"`                  // fanout=per_image 时同一次请求拆分出的任务共享的分组 ID
+	LastHeartbeat  *time.Time     `json:"-"`                                                // 处理中任务最近一次心跳时间，Provider 上报进度时写入
+	Caption        string         `json:"caption"`                                          // 图片描述 (alt text)
+	Favorite       bool           `gorm:"default:false;index" json:"favorite"`              // 已收藏，保留策略不会清理
+	Private        bool           `gorm:"default:false;index" json:"private"`               // 私密图片，图库可按可见性筛选，派生图片继承来源的设置
+	AutoCancel     bool           `json:"auto_cancel_on_disconnect,omitempty"`              // 排队期间没有客户端连接超过宽限时间时自动取消
+	LeaseExpiresAt *time.Time     `json:"-"`                                                // 客户端租约到期时间，仅 AutoCancel 任务使用，有连接时定期续期
+	Tags           []string       `gorm:"-" json:"tags,omitempty"`                          // 标签名，来自 task_tags，仅列表与详情接口填充
 	CreatedAt      time.Time      `gorm:"index:idx_status_created;index" json:"created_at"` // 创建时间
+	ArchivedAt     *time.Time     `gorm:"index" json:"archived_at,omitempty"`               // 归档时间：文件已按保留策略清理，仅保留记录
 	CompletedAt    *time.Time     `json:"completed_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// TaskEvent 对应 task_events 表，记录任务处理过程中的关键节点，便于排查耗时问题
+type TaskEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    string    `gorm:"index;not null" json:"task_id"` // 所属任务 ID
+	Type      string    `json:"type"`                          // 事件类型: enqueued / dequeued / provider_call_started ...
+	Message   string    `json:"message"`                       // 事件详情
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TaskReference 对应 task_references 表，记录图生图任务使用的参考图
+// 文件按内容哈希保存在存储目录的 refs/ 下，路径相对于存储目录；仅保存哈希时路径为空
+type TaskReference struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	TaskID        string    `gorm:"index;not null" json:"task_id"` // 所属任务 ID
+	Position      int       `json:"position"`                      // 参考图顺序，从 0 开始
+	SHA256        string    `gorm:"index" json:"sha256"`           // 参考图内容哈希
+	FileSize      int64     `json:"file_size"`                     // 参考图大小（字节）
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	Path          string    `json:"path,omitempty"`           // 原图路径
+	ThumbnailPath string    `json:"thumbnail_path,omitempty"` // 缩略图路径
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Job 对应 jobs 表，记录文件信息回填、OSS 重新同步、保留策略清理等后台作业
+type Job struct {
+	ID         uint       `gorm:"primaryKey" json:"-"`
+	JobID      string     `gorm:"uniqueIndex;not null" json:"job_id"`
+	Type       string     `gorm:"index;not null" json:"type"`   // 作业类型: backfill_file_info / remote_sync_retry / retention ...
+	Params     string     `json:"params,omitempty"`             // 作业参数 JSON
+	Status     string     `gorm:"index;not null" json:"status"` // pending / running / completed / failed / cancelled
+	Total      int64      `json:"total"`                        // 需处理的总数，未知时为 0
+	Processed  int64      `json:"processed"`                    // 已处理数量
+	Result     string     `json:"result,omitempty"`             // 各类计数等结果 JSON
+	Error      string     `json:"error,omitempty"`              // 失败或中断原因
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Tag 对应 tags 表，标签名唯一
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskTag 对应 task_tags 表，任务与标签的多对多关系
+type TaskTag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    string    `gorm:"uniqueIndex:idx_task_tag;not null" json:"task_id"`
+	TagID     uint      `gorm:"uniqueIndex:idx_task_tag;index;not null" json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Setting 对应 settings 表，保存运行期可修改的键值配置（如图库存储目录）
+type Setting struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuditLog 对应 audit_logs 表，记录批量删除等破坏性管理操作
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Action    string    `gorm:"index;not null" json:"action"` // 操作类型: purge_failed ...
+	Detail    string    `json:"detail"`                       // 操作参数与结果 JSON
+	ClientIP  string    `json:"client_ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// PendingDeletion 对应 pending_deletions 表，记录删除失败、待重试的 OSS 对象
+type PendingDeletion struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ObjectKey     string    `gorm:"uniqueIndex;not null" json:"object_key"` // OSS 对象键
+	TaskID        string    `gorm:"index" json:"task_id,omitempty"`         // 来源任务，孤立对象检查发现的对象为空
+	Attempts      int       `json:"attempts"`                               // 已尝试删除的次数
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `gorm:"index" json:"next_attempt_at"` // 下次自动重试时间，按失败次数退避
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "encoding/json"
+
+// PublicURL 把 OSS 原始地址改写为对外地址，由 main 注入 storage.PublicURL；为 nil 时不改写
+var PublicURL func(rawURL string) string
+
+// RemoteURL 任务记录中的 OSS 地址。数据库中保存原始地址，服务端内部（删除对象、重新同步等）按原值使用，
+// 只在序列化为 JSON 时按 storage.public_url_prefix 改写，更换 CDN 域名无需迁移数据
+type RemoteURL string
+
+// Public 返回对外地址
+func (u RemoteURL) Public() string {
+	if PublicURL == nil {
+		return string(u)
+	}
+	return PublicURL(string(u))
+}
+
+// MarshalJSON 输出对外地址
+func (u RemoteURL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Public())
+}
@@ -0,0 +1,25 @@
+package model
+
+import "gorm.io/gorm/clause"
+
+// GetSetting 读取键值配置，不存在时 ok 为 false
+func GetSetting(key string) (string, bool) {
+	var s Setting
+	if err := DB.Where("key = ?", key).First(&s).Error; err != nil {
+		return "", false
+	}
+	return s.Value, true
+}
+
+// SetSetting 写入键值配置（存在则覆盖）
+func SetSetting(key, value string) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&Setting{Key: key, Value: value}).Error
+}
+
+// DeleteSetting 删除键值配置，不存在时不报错
+func DeleteSetting(key string) error {
+	return DB.Where("key = ?", key).Delete(&Setting{}).Error
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// PromptPreviewRunes 列表中提示词预览的最大字符数（按 rune 计）
+const PromptPreviewRunes = 200
+
+// promptPreviewEllipsis 预览被截断时追加的省略号
+const promptPreviewEllipsis = "…"
+
+// PromptPreview 截取提示词前 PromptPreviewRunes 个字符，超出时在字符边界处截断并追加省略号
+func PromptPreview(prompt string) string {
+	count := 0
+	for i := range prompt {
+		if count == PromptPreviewRunes {
+			return prompt[:i] + promptPreviewEllipsis
+		}
+		count++
+	}
+	return prompt
+}
+
+// BeforeCreate 写入时计算提示词预览；任务创建后提示词不再修改
+func (t *Task) BeforeCreate(tx *gorm.DB) error {
+	t.PromptPreview = PromptPreview(t.Prompt)
+	return nil
+}
+
+// backfillPromptPreviews 为旧版本创建的任务补全提示词预览，与 PromptPreview 一致按字符截断
+func backfillPromptPreviews() {
+	if err := DB.Exec(`UPDATE tasks SET prompt_preview = CASE
+			WHEN length(prompt) > ? THEN substr(prompt, 1, ?) || ?
+			ELSE prompt END
+		WHERE COALESCE(prompt_preview, '') = '' AND COALESCE(prompt, '') <> ''`,
+		PromptPreviewRunes, PromptPreviewRunes, promptPreviewEllipsis).Error; err != nil {
+		log.Printf("补全提示词预览失败: %v", err)
+	}
+}
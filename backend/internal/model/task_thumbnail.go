@@ -0,0 +1,48 @@
+package model
+
+import (
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 缩略图生成状态：Worker 保存原图后即完成任务，缩略图随后在后台生成
+const (
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailFailed  = "failed"
+)
+
+// AfterFind 计算缩略图访问地址，前端直接使用，无需了解缩略图的命名与存储方式
+func (t *Task) AfterFind(tx *gorm.DB) error {
+	t.ThumbnailSrc = ThumbnailSource(t.ThumbnailPath, t.ThumbnailURL)
+	return nil
+}
+
+// ThumbnailSource 返回缩略图访问地址，优先使用本地缩略图：相对路径（storage/local/...）由 /storage 静态路由提供，
+// 迁移到外部目录后的绝对路径由 ServeLibraryFileHandler 按原路径提供；没有本地文件时使用 OSS 对外地址
+func ThumbnailSource(path string, remoteURL RemoteURL) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return strings.TrimSpace(remoteURL.Public())
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// ReferencedThumbnails 返回仍被任务（含回收站中的任务）引用的哈希缩略图文件名，供清理任务判断孤立文件
+func ReferencedThumbnails() (map[string]bool, error) {
+	var paths []string
+	if err := DB.Unscoped().Model(&Task{}).Where("thumbnail_hash <> ''").Pluck("thumbnail_path", &paths).Error; err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		refs[filepath.Base(filepath.FromSlash(path))] = true
+	}
+	return refs, nil
+}
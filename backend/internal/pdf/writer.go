@@ -0,0 +1,263 @@
+// Package pdf 提供一个极简的流式 PDF 写入器，仅支持导出场景需要的 JPEG 图片与文本。
+// 每一页在 AddPage 时立即写出，内存占用只与单页大小相关。
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 页面尺寸（单位: pt）
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// 预留的对象编号
+const (
+	catalogObj = 1
+	pagesObj   = 2
+	fontObj    = 3
+	cidFontObj = 4
+	firstFree  = 5
+)
+
+// ErrClosed 表示写入器已关闭
+var ErrClosed = errors.New("pdf writer 已关闭")
+
+// Image 为已编码的 JPEG 图片
+type Image struct {
+	Data       []byte
+	Width      int
+	Height     int
+	Components int // 1 = 灰度, 3 = RGB
+}
+
+// Text 为单行文本，坐标原点位于页面左下角
+type Text struct {
+	X, Y float64
+	Size float64
+	Str  string
+}
+
+// Page 描述一页的内容
+type Page struct {
+	Width, Height float64
+	Image         *Image
+	// ImageRect 图片绘制区域: x, y, w, h
+	ImageRect [4]float64
+	Texts     []Text
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Writer 流式写出 PDF 文档
+type Writer struct {
+	out     *countingWriter
+	offsets map[int]int64
+	nextObj int
+	pageIDs []int
+	closed  bool
+	err     error
+}
+
+// NewWriter 创建写入器并写出文件头
+func NewWriter(w io.Writer) *Writer {
+	pw := &Writer{
+		out:     &countingWriter{w: w},
+		offsets: make(map[int]int64),
+		nextObj: firstFree,
+	}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+// BytesWritten 返回已写出的字节数
+func (w *Writer) BytesWritten() int64 {
+	return w.out.n
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.out, format, args...)
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.out.Write(p)
+}
+
+func (w *Writer) alloc() int {
+	id := w.nextObj
+	w.nextObj++
+	return id
+}
+
+func (w *Writer) beginObj(id int) {
+	w.offsets[id] = w.out.n
+	w.printf("%d 0 obj\n", id)
+}
+
+func (w *Writer) endObj() {
+	w.printf("endobj\n")
+}
+
+func (w *Writer) writeStream(id int, dict string, data []byte) {
+	w.beginObj(id)
+	w.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	w.write(data)
+	w.printf("\nendstream\n")
+	w.endObj()
+}
+
+// AddPage 立即写出一页
+func (w *Writer) AddPage(page Page) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	var content bytes.Buffer
+	resources := fmt.Sprintf("/Font << /F1 %d 0 R >>", fontObj)
+
+	if page.Image != nil {
+		imgID := w.alloc()
+		colorSpace := "/DeviceRGB"
+		if page.Image.Components == 1 {
+			colorSpace = "/DeviceGray"
+		}
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			page.Image.Width, page.Image.Height, colorSpace)
+		w.writeStream(imgID, dict, page.Image.Data)
+		resources += fmt.Sprintf(" /XObject << /Im1 %d 0 R >>", imgID)
+		r := page.ImageRect
+		fmt.Fprintf(&content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n", r[2], r[3], r[0], r[1])
+	}
+
+	for _, t := range page.Texts {
+		if t.Str == "" {
+			continue
+		}
+		fmt.Fprintf(&content, "BT /F1 %.1f Tf %.2f %.2f Td <%s> Tj ET\n", t.Size, t.X, t.Y, encodeUCS2(t.Str))
+	}
+
+	contentID := w.alloc()
+	w.writeStream(contentID, "", content.Bytes())
+
+	pageID := w.alloc()
+	w.beginObj(pageID)
+	w.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << %s >> /Contents %d 0 R >>\n",
+		pagesObj, page.Width, page.Height, resources, contentID)
+	w.endObj()
+	w.pageIDs = append(w.pageIDs, pageID)
+	return w.err
+}
+
+// PageCount 返回已写出的页数
+func (w *Writer) PageCount() int {
+	return len(w.pageIDs)
+}
+
+// Close 写出字体、页树、目录与交叉引用表
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+
+	// 使用 PDF 阅读器内置的 STSong-Light (Adobe-GB1)，无需嵌入字体即可显示中英文
+	w.beginObj(fontObj)
+	w.printf("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [%d 0 R] >>\n", cidFontObj)
+	w.endObj()
+	w.beginObj(cidFontObj)
+	w.printf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor << /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >> /DW 1000 /W [1 95 500] >>\n")
+	w.endObj()
+
+	kids := make([]string, len(w.pageIDs))
+	for i, id := range w.pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	w.beginObj(pagesObj)
+	w.printf("<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(w.pageIDs))
+	w.endObj()
+
+	w.beginObj(catalogObj)
+	w.printf("<< /Type /Catalog /Pages %d 0 R >>\n", pagesObj)
+	w.endObj()
+
+	xrefOffset := w.out.n
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", w.nextObj)
+	for id := 1; id < w.nextObj; id++ {
+		w.printf("%010d 00000 n \n", w.offsets[id])
+	}
+	w.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", w.nextObj, catalogObj, xrefOffset)
+	return w.err
+}
+
+// encodeUCS2 将文本编码为 UCS-2 大端十六进制，超出 BMP 的字符以 ? 代替
+func encodeUCS2(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 0xFFFF || r == utf8.RuneError {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// TextWidth 估算文本宽度：ASCII 按半角、其余按全角计算
+func TextWidth(s string, size float64) float64 {
+	width := 0.0
+	for _, r := range s {
+		if r < 0x80 {
+			width += size * 0.5
+		} else {
+			width += size
+		}
+	}
+	return width
+}
+
+// Truncate 按估算宽度截断文本，超出时追加省略号
+func Truncate(s string, size, maxWidth float64) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if TextWidth(s, size) <= maxWidth {
+		return s
+	}
+	ellipsis := "..."
+	limit := maxWidth - TextWidth(ellipsis, size)
+	width := 0.0
+	var b strings.Builder
+	for _, r := range s {
+		w := size
+		if r < 0x80 {
+			w = size * 0.5
+		}
+		if width+w > limit {
+			break
+		}
+		width += w
+		b.WriteRune(r)
+	}
+	return b.String() + ellipsis
+}
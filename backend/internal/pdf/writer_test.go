@@ -0,0 +1,157 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+	"testing"
+
+	pdfreader "rsc.io/pdf"
+)
+
+func testJPEG(t *testing.T, width, height int) *Image {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return &Image{Data: buf.Bytes(), Width: width, Height: height, Components: 3}
+}
+
+// TestWriterOutputParses 用独立的 PDF 解析器读取输出，校验交叉引用表、页树、页面尺寸、图片与文本对象
+func TestWriterOutputParses(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	pages := []Page{
+		{Width: A4Width, Height: A4Height, Texts: []Text{{X: 40, Y: 800, Size: 16, Str: "导出清单 Export"}}},
+		{Width: 300, Height: 200, Image: testJPEG(t, 30, 20), ImageRect: [4]float64{0, 0, 300, 200}},
+		{Width: 200, Height: 300, Image: testJPEG(t, 20, 30), ImageRect: [4]float64{10, 10, 180, 270},
+			Texts: []Text{{X: 10, Y: 5, Size: 8, Str: "caption"}}},
+	}
+	for _, page := range pages {
+		if err := w.AddPage(page); err != nil {
+			t.Fatalf("AddPage: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if w.BytesWritten() != int64(buf.Len()) {
+		t.Fatalf("BytesWritten = %d，实际输出 %d 字节", w.BytesWritten(), buf.Len())
+	}
+	if err := w.AddPage(pages[0]); err != ErrClosed {
+		t.Fatalf("关闭后 AddPage = %v，期望 ErrClosed", err)
+	}
+
+	r := parsePDF(t, buf.Bytes())
+	if r.NumPage() != len(pages) {
+		t.Fatalf("页数 = %d，期望 %d", r.NumPage(), len(pages))
+	}
+	for i, want := range pages {
+		page := r.Page(i + 1)
+		box := page.V.Key("MediaBox")
+		if box.Len() != 4 || box.Index(2).Float64() != roundPt(want.Width) || box.Index(3).Float64() != roundPt(want.Height) {
+			t.Fatalf("第 %d 页 MediaBox = %v", i+1, box)
+		}
+		if font := page.Font("F1"); font.BaseFont() != "STSong-Light" {
+			t.Fatalf("第 %d 页字体 = %q", i+1, font.BaseFont())
+		}
+
+		content := readStream(t, page.V.Key("Contents"))
+		for _, text := range want.Texts {
+			if !strings.Contains(content, "<"+encodeUCS2(text.Str)+"> Tj") {
+				t.Fatalf("第 %d 页内容缺少文本 %q: %s", i+1, text.Str, content)
+			}
+		}
+
+		im := page.Resources().Key("XObject").Key("Im1")
+		if want.Image == nil {
+			if !im.IsNull() {
+				t.Fatalf("第 %d 页不应包含图片", i+1)
+			}
+			continue
+		}
+		if !strings.Contains(content, "/Im1 Do") {
+			t.Fatalf("第 %d 页未绘制图片: %s", i+1, content)
+		}
+		if im.Key("Subtype").Name() != "Image" || im.Key("Filter").Name() != "DCTDecode" ||
+			im.Key("Width").Int64() != int64(want.Image.Width) || im.Key("Height").Int64() != int64(want.Image.Height) {
+			t.Fatalf("第 %d 页图片对象 = %v", i+1, im)
+		}
+		if im.Key("Length").Int64() != int64(len(want.Image.Data)) {
+			t.Fatalf("第 %d 页图片长度 = %d，期望 %d", i+1, im.Key("Length").Int64(), len(want.Image.Data))
+		}
+	}
+}
+
+func TestWriterEmptyDocument(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r := parsePDF(t, buf.Bytes()); r.NumPage() != 0 {
+		t.Fatalf("页数 = %d，期望 0", r.NumPage())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in       string
+		maxWidth float64
+		want     string
+	}{
+		{"short", 100, "short"},
+		{"  多个   空白\n折叠 ", 200, "多个 空白 折叠"},
+		{"abcdefghij", 40, "abcde..."},
+		{"中文标题很长", 50, "中文标..."},
+	}
+	for _, tc := range cases {
+		got := Truncate(tc.in, 10, tc.maxWidth)
+		if got != tc.want {
+			t.Errorf("Truncate(%q, %v) = %q，期望 %q", tc.in, tc.maxWidth, got, tc.want)
+		}
+		if TextWidth(got, 10) > tc.maxWidth {
+			t.Errorf("Truncate(%q) 结果宽度 %v 超过 %v", tc.in, TextWidth(got, 10), tc.maxWidth)
+		}
+	}
+}
+
+// parsePDF 解析器在结构错误时 panic，这里转为测试失败
+func parsePDF(t *testing.T, data []byte) (r *pdfreader.Reader) {
+	t.Helper()
+	defer func() {
+		if p := recover(); p != nil {
+			t.Fatalf("解析 PDF 失败: %v", p)
+		}
+	}()
+	r, err := pdfreader.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("解析 PDF 失败: %v", err)
+	}
+	return r
+}
+
+func readStream(t *testing.T, v pdfreader.Value) string {
+	t.Helper()
+	rc := v.Reader()
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("读取内容流失败: %v", err)
+	}
+	return string(data)
+}
+
+// roundPt 与写入器一致保留两位小数
+func roundPt(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
@@ -0,0 +1,24 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseAspectRatio 解析 "16:9" 形式的比例字符串，返回宽高比（宽/高）
+func ParseAspectRatio(ratio string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(ratio), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("无效的比例格式: %s", ratio)
+	}
+	w, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || w <= 0 {
+		return 0, fmt.Errorf("无效的比例格式: %s", ratio)
+	}
+	h, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || h <= 0 {
+		return 0, fmt.Errorf("无效的比例格式: %s", ratio)
+	}
+	return w / h, nil
+}
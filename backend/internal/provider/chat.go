@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"image-gen-service/internal/model"
+)
+
+// ChatMessage 对话消息；Images 为随消息发送的图片原始数据，仅视觉模型支持
+type ChatMessage struct {
+	Role   string // user / assistant
+	Text   string
+	Images [][]byte
+}
+
+// ChatOptions 单次对话请求的选项
+type ChatOptions struct {
+	Model  string
+	System string // 系统提示词，放置方式由各实现决定
+	JSON   bool   // 要求返回 JSON，不支持 JSON 模式的实现仅依赖系统提示词约束
+}
+
+// ChatProvider 提示词优化、图片逆向提示词、生成描述等对话功能使用的 Provider
+type ChatProvider interface {
+	Name() string
+	// Complete 返回完整回复，已去除首尾空白
+	Complete(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error)
+	// Stream 每收到一段内容调用一次 onDelta，结束后返回完整回复
+	Stream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(delta string)) (string, error)
+}
+
+// ChatFactory 根据数据库配置创建对话 Provider
+type ChatFactory func(cfg *model.ProviderConfig) (ChatProvider, error)
+
+// chatFactories 对话 Provider 与生图 Provider 共用 registryMu，按配置名注册
+var chatFactories = map[string]ChatFactory{
+	"gemini-chat":    newGeminiChatProvider,
+	"openai-chat":    newOpenAIChatProvider,
+	"anthropic-chat": newAnthropicChatProvider,
+	"deepseek-chat":  newDeepSeekChatProvider,
+}
+
+// RegisterChat 注册一个对话 Provider 实现
+func RegisterChat(name string, factory ChatFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	chatFactories[name] = factory
+}
+
+// ChatProviderNames 返回已注册的对话 Provider 名称
+func ChatProviderNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(chatFactories))
+	for name := range chatFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewChatProvider 按配置名创建对话 Provider。对话配置不常驻 Registry，
+// 每次请求使用最新的数据库配置创建，底层客户端由 chat_clients 缓存复用
+func NewChatProvider(cfg *model.ProviderConfig) (ChatProvider, error) {
+	registryMu.RLock()
+	factory := chatFactories[cfg.ProviderName]
+	registryMu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("Provider %s 不支持对话功能", cfg.ProviderName)
+	}
+	return factory(cfg)
+}
+
+// NormalizeChatProviderName 将请求中的 Provider 名称映射为对话配置名，如 openai -> openai-chat；
+// 为空时使用 fallback
+func NormalizeChatProviderName(name, fallback string) string {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		return fallback
+	}
+	if !strings.HasSuffix(name, "-chat") {
+		registryMu.RLock()
+		_, ok := chatFactories[name+"-chat"]
+		registryMu.RUnlock()
+		if ok {
+			return name + "-chat"
+		}
+	}
+	return name
+}
+
+// chatJSONInstruction 不支持 JSON 模式时追加到系统提示词的约束
+const chatJSONInstruction = "Respond with a single valid JSON object only, without markdown code fences or any other text."
+
+func withJSONInstruction(system string) string {
+	return strings.TrimSpace(system + "\n\n" + chatJSONInstruction)
+}
+
+// trimJSONFence 去掉模型偶尔附带的 ```json 代码块标记
+func trimJSONFence(text string) string {
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	return strings.TrimSpace(text)
+}
+
+// detectImageMIME 识别图片 MIME 类型，无法识别时按 JPEG 处理
+func detectImageMIME(data []byte) string {
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "image/jpeg"
+	}
+	return mimeType
+}
@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"image-gen-service/internal/model"
+)
+
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com"
+	anthropicAPIVersion       = "2023-06-01"
+	defaultAnthropicMaxTokens = 4096
+)
+
+// anthropicChatProvider 使用 Anthropic Messages API。系统提示词放在顶层 system 字段，
+// max_tokens 为必填项，可通过 extra_config.max_tokens 调整；没有 JSON 模式，仅依赖提示词约束
+type anthropicChatProvider struct {
+	config    *model.ProviderConfig
+	endpoint  string
+	maxTokens int
+}
+
+func newAnthropicChatProvider(cfg *model.ProviderConfig) (ChatProvider, error) {
+	apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBase), "/")
+	if apiBase == "" {
+		apiBase = defaultAnthropicBaseURL
+	}
+	apiBase = strings.TrimSuffix(apiBase, "/v1")
+	maxTokens := ExtraConfigInt(cfg, "max_tokens")
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	return &anthropicChatProvider{
+		config:    cfg,
+		endpoint:  apiBase + "/v1/messages",
+		maxTokens: maxTokens,
+	}, nil
+}
+
+func (p *anthropicChatProvider) Name() string {
+	return p.config.ProviderName
+}
+
+func (p *anthropicChatProvider) Complete(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error) {
+	resp, err := p.send(ctx, messages, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("解析响应失败: %w", err)
+	}
+	var parts []string
+	for _, block := range payload.Content {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return anthropicResult(strings.Join(parts, "\n"), opts), nil
+}
+
+func (p *anthropicChatProvider) Stream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(delta string)) (string, error) {
+	resp, err := p.send(ctx, messages, opts, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var builder strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Error *anthropicErrorBody `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				builder.WriteString(event.Delta.Text)
+				if onDelta != nil {
+					onDelta(event.Delta.Text)
+				}
+			}
+		case "error":
+			// 流式响应中途出错时 HTTP 状态已是 200，按错误类型补齐状态码
+			if event.Error != nil {
+				return "", anthropicError(anthropicStatusForErrorType(event.Error.Type), nil, event.Error.Type, event.Error.Message)
+			}
+		case "message_stop":
+			return anthropicResult(builder.String(), opts), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("读取流式响应失败: %w", err)
+	}
+	return anthropicResult(builder.String(), opts), nil
+}
+
+// send 发送请求，非 2xx 响应转换为可被 ClassifyError 识别的错误
+func (p *anthropicChatProvider) send(ctx context.Context, messages []ChatMessage, opts ChatOptions, stream bool) (*http.Response, error) {
+	system := opts.System
+	if opts.JSON {
+		system = withJSONInstruction(system)
+	}
+	body := map[string]interface{}{
+		"model":      opts.Model,
+		"max_tokens": p.maxTokens,
+		"messages":   anthropicMessages(messages),
+	}
+	if system != "" {
+		body["system"] = system
+	}
+	if stream {
+		body["stream"] = true
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", p.config.APIKey)
+	req.Header.Set("Anthropic-Version", anthropicAPIVersion)
+
+	resp, err := chatHTTPClient(p.config).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var payload struct {
+			Error anthropicErrorBody `json:"error"`
+		}
+		message := strings.TrimSpace(string(respBytes))
+		if json.Unmarshal(respBytes, &payload) == nil && payload.Error.Message != "" {
+			message = payload.Error.Message
+		}
+		return nil, anthropicError(resp.StatusCode, resp.Header, payload.Error.Type, message)
+	}
+	return resp, nil
+}
+
+// anthropicErrorBody Anthropic 错误响应中的 error 字段
+type anthropicErrorBody struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicError 将 overloaded_error（529）与 rate_limit_error（429）转换为明确的提示，
+// 状态码保留给 ClassifyError 判断是否可重试
+func anthropicError(statusCode int, header http.Header, errorType, message string) error {
+	switch errorType {
+	case "overloaded_error":
+		message = "Anthropic 服务繁忙，请稍后重试: " + message
+	case "rate_limit_error":
+		message = "触发 Anthropic 限流，请稍后重试: " + message
+	case "authentication_error", "permission_error":
+		message = "Anthropic API Key 无效或无权限: " + message
+	}
+	return &upstreamError{
+		message:    "请求失败: " + message,
+		statusCode: statusCode,
+		header:     header,
+	}
+}
+
+func anthropicStatusForErrorType(errorType string) int {
+	switch errorType {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func anthropicMessages(messages []ChatMessage) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "assistant"
+		}
+		content := make([]map[string]interface{}, 0, len(msg.Images)+1)
+		for _, data := range msg.Images {
+			content = append(content, map[string]interface{}{
+				"type": "image",
+				"source": map[string]interface{}{
+					"type":       "base64",
+					"media_type": detectImageMIME(data),
+					"data":       base64.StdEncoding.EncodeToString(data),
+				},
+			})
+		}
+		if msg.Text != "" {
+			content = append(content, map[string]interface{}{"type": "text", "text": msg.Text})
+		}
+		result = append(result, map[string]interface{}{"role": role, "content": content})
+	}
+	return result
+}
+
+func anthropicResult(text string, opts ChatOptions) string {
+	text = strings.TrimSpace(text)
+	if opts.JSON {
+		return trimJSONFence(text)
+	}
+	return text
+}
@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"google.golang.org/genai"
+)
+
+// chatClientEntry 缓存的对话客户端及其对应的配置指纹
+type chatClientEntry struct {
+	fingerprint string
+	httpClient  *http.Client
+	gemini      *genai.Client
+	openai      *openai.Client
+}
+
+// chatClients 按 Provider 缓存提示词优化等对话请求使用的客户端，复用底层连接池，
+// 避免每次请求都重新进行 TCP + TLS 握手；配置指纹变化或配置更新时重建
+var (
+	chatClientsMu sync.Mutex
+	chatClients   = make(map[string]*chatClientEntry)
+)
+
+// InvalidateChatClients 丢弃指定 Provider 的缓存客户端（更新配置后调用）
+func InvalidateChatClients(providerName string) {
+	chatClientsMu.Lock()
+	entry := chatClients[providerName]
+	delete(chatClients, providerName)
+	chatClientsMu.Unlock()
+	closeChatClient(entry)
+}
+
+func closeChatClient(entry *chatClientEntry) {
+	if entry == nil || entry.httpClient == nil {
+		return
+	}
+	entry.httpClient.CloseIdleConnections()
+}
+
+func chatClientFingerprint(cfg *model.ProviderConfig, timeout time.Duration) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s", cfg.ProviderName, strings.TrimSpace(cfg.APIBase), cfg.APIKey, timeout)))
+	return hex.EncodeToString(sum[:])
+}
+
+func chatTimeout(cfg *model.ProviderConfig) time.Duration {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 150 * time.Second
+	}
+	return timeout
+}
+
+// chatKeepAliveDisabled 部分中转服务复用连接会出错，可通过 extra_config.disable_keepalive 关闭复用
+func chatKeepAliveDisabled(cfg *model.ProviderConfig) bool {
+	return ExtraConfigBool(cfg, "disable_keepalive")
+}
+
+func newChatHTTPClient(timeout time.Duration, disableKeepAlive bool) *http.Client {
+	if disableKeepAlive {
+		return &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DisableKeepAlives:   true,
+				ForceAttemptHTTP2:   false,
+				MaxIdleConns:        0,
+				MaxIdleConnsPerHost: 0,
+				TLSClientConfig: &tls.Config{
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 4
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// GeminiChatClient 返回可复用的 Gemini 对话客户端；关闭连接复用时每次新建
+func GeminiChatClient(ctx context.Context, cfg *model.ProviderConfig) (*genai.Client, error) {
+	timeout := chatTimeout(cfg)
+	disableKeepAlive := chatKeepAliveDisabled(cfg)
+	fingerprint := chatClientFingerprint(cfg, timeout)
+	if !disableKeepAlive {
+		chatClientsMu.Lock()
+		entry := chatClients[cfg.ProviderName]
+		chatClientsMu.Unlock()
+		if entry != nil && entry.fingerprint == fingerprint && entry.gemini != nil {
+			return entry.gemini, nil
+		}
+	}
+
+	httpClient := newChatHTTPClient(timeout, disableKeepAlive)
+	clientConfig := &genai.ClientConfig{
+		APIKey:     cfg.APIKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: httpClient,
+	}
+	if apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBase), "/"); apiBase != "" && apiBase != "https://generativelanguage.googleapis.com" {
+		clientConfig.HTTPOptions = genai.HTTPOptions{BaseURL: apiBase}
+	}
+	client, err := genai.NewClient(ctx, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Gemini 客户端失败: %w", err)
+	}
+	if !disableKeepAlive {
+		storeChatClient(cfg.ProviderName, &chatClientEntry{fingerprint: fingerprint, httpClient: httpClient, gemini: client})
+	}
+	return client, nil
+}
+
+// OpenAIChatClient 返回可复用的 OpenAI 兼容对话客户端；关闭连接复用时每次新建
+func OpenAIChatClient(cfg *model.ProviderConfig) *openai.Client {
+	timeout := chatTimeout(cfg)
+	disableKeepAlive := chatKeepAliveDisabled(cfg)
+	fingerprint := chatClientFingerprint(cfg, timeout)
+	if !disableKeepAlive {
+		chatClientsMu.Lock()
+		entry := chatClients[cfg.ProviderName]
+		chatClientsMu.Unlock()
+		if entry != nil && entry.fingerprint == fingerprint && entry.openai != nil {
+			return entry.openai
+		}
+	}
+
+	httpClient := newChatHTTPClient(timeout, disableKeepAlive)
+	opts := []option.RequestOption{
+		option.WithAPIKey(cfg.APIKey),
+		option.WithHTTPClient(httpClient),
+	}
+	if apiBase := NormalizeOpenAIBaseURL(cfg.APIBase); apiBase != "" {
+		opts = append(opts, option.WithBaseURL(apiBase))
+	}
+	client := openai.NewClient(opts...)
+	if !disableKeepAlive {
+		storeChatClient(cfg.ProviderName, &chatClientEntry{fingerprint: fingerprint, httpClient: httpClient, openai: &client})
+	}
+	return &client
+}
+
+// chatHTTPClient 返回可复用的 HTTP 客户端，供直接调用 REST 接口的对话 Provider 使用
+func chatHTTPClient(cfg *model.ProviderConfig) *http.Client {
+	timeout := chatTimeout(cfg)
+	disableKeepAlive := chatKeepAliveDisabled(cfg)
+	fingerprint := chatClientFingerprint(cfg, timeout)
+	if !disableKeepAlive {
+		chatClientsMu.Lock()
+		entry := chatClients[cfg.ProviderName]
+		chatClientsMu.Unlock()
+		if entry != nil && entry.fingerprint == fingerprint && entry.gemini == nil && entry.openai == nil {
+			return entry.httpClient
+		}
+	}
+
+	httpClient := newChatHTTPClient(timeout, disableKeepAlive)
+	if !disableKeepAlive {
+		storeChatClient(cfg.ProviderName, &chatClientEntry{fingerprint: fingerprint, httpClient: httpClient})
+	}
+	return httpClient
+}
+
+func storeChatClient(providerName string, entry *chatClientEntry) {
+	chatClientsMu.Lock()
+	previous := chatClients[providerName]
+	chatClients[providerName] = entry
+	chatClientsMu.Unlock()
+	if previous != nil && previous.fingerprint != entry.fingerprint {
+		closeChatClient(previous)
+	}
+}
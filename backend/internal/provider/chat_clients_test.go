@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"image-gen-service/internal/model"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/genai"
+)
+
+// chatStub 模拟 OpenAI 兼容与 Gemini 对话接口，并统计新建的 TCP 连接数
+type chatStub struct {
+	*httptest.Server
+	conns    atomic.Int32
+	requests atomic.Int32
+}
+
+func newChatStub(t testing.TB) *chatStub {
+	t.Helper()
+	stub := &chatStub{}
+	stub.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, ":generateContent") {
+			w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}]}`))
+			return
+		}
+		w.Write([]byte(`{"id":"c","object":"chat.completion","created":0,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	stub.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			stub.conns.Add(1)
+		}
+	}
+	stub.Start()
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+type chatCall func(t testing.TB, cfg *model.ProviderConfig)
+
+func openAIChatCall(t testing.TB, cfg *model.ProviderConfig) {
+	t.Helper()
+	client := OpenAIChatClient(cfg)
+	resp, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Model:    "m",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	})
+	if err != nil {
+		t.Fatalf("OpenAI 对话请求失败: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "ok" {
+		t.Fatalf("OpenAI 响应 = %+v", resp)
+	}
+}
+
+func geminiChatCall(t testing.TB, cfg *model.ProviderConfig) {
+	t.Helper()
+	client, err := GeminiChatClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Models.GenerateContent(context.Background(), "m", genai.Text("hi"), nil)
+	if err != nil {
+		t.Fatalf("Gemini 对话请求失败: %v", err)
+	}
+	if resp.Text() != "ok" {
+		t.Fatalf("Gemini 响应 = %q", resp.Text())
+	}
+}
+
+func TestChatClientsReuseConnections(t *testing.T) {
+	const requests = 5
+	cases := []struct {
+		name      string
+		call      chatCall
+		extra     string
+		wantConns int32
+	}{
+		{"openai 复用连接", openAIChatCall, "", 1},
+		{"openai 关闭复用", openAIChatCall, `{"disable_keepalive":true}`, requests},
+		{"gemini 复用连接", geminiChatCall, "", 1},
+		{"gemini 关闭复用", geminiChatCall, `{"disable_keepalive":true}`, requests},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newChatStub(t)
+			name := "chat-" + tc.name
+			t.Cleanup(func() { InvalidateChatClients(name) })
+			cfg := &model.ProviderConfig{ProviderName: name, APIBase: stub.URL, APIKey: "k", ExtraConfig: tc.extra}
+
+			for i := 0; i < requests; i++ {
+				tc.call(t, cfg)
+			}
+			if got := stub.requests.Load(); got != requests {
+				t.Fatalf("上游收到 %d 个请求，期望 %d", got, requests)
+			}
+			if got := stub.conns.Load(); got != tc.wantConns {
+				t.Fatalf("新建连接 %d 个，期望 %d", got, tc.wantConns)
+			}
+		})
+	}
+}
+
+func TestChatClientRebuiltOnConfigChange(t *testing.T) {
+	stub := newChatStub(t)
+	const name = "chat-rebuild"
+	t.Cleanup(func() { InvalidateChatClients(name) })
+	cfg := &model.ProviderConfig{ProviderName: name, APIBase: stub.URL, APIKey: "k1"}
+
+	first := OpenAIChatClient(cfg)
+	if OpenAIChatClient(cfg) != first {
+		t.Fatal("配置未变化时应返回缓存的客户端")
+	}
+
+	rotated := *cfg
+	rotated.APIKey = "k2"
+	second := OpenAIChatClient(&rotated)
+	if second == first {
+		t.Fatal("API Key 变化后应重建客户端")
+	}
+
+	InvalidateChatClients(name)
+	if OpenAIChatClient(&rotated) == second {
+		t.Fatal("InvalidateChatClients 后应重建客户端")
+	}
+}
+
+// BenchmarkChatClient 对比复用连接与每次新建连接的请求耗时（本地 httptest 无 TLS，差距主要来自 TCP 握手）
+func BenchmarkChatClient(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		extra string
+	}{
+		{"pooled", ""},
+		{"fresh", `{"disable_keepalive":true}`},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			stub := newChatStub(b)
+			name := "chat-bench-" + bc.name
+			b.Cleanup(func() { InvalidateChatClients(name) })
+			cfg := &model.ProviderConfig{ProviderName: name, APIBase: stub.URL, APIKey: "k", ExtraConfig: bc.extra}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				openAIChatCall(b, cfg)
+			}
+			b.ReportMetric(float64(stub.conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"image-gen-service/internal/model"
+
+	"google.golang.org/genai"
+)
+
+// geminiChatProvider 使用 Gemini GenerateContent 接口，系统提示词放在 SystemInstruction，
+// JSON 模式通过 ResponseMIMEType 指定
+type geminiChatProvider struct {
+	config *model.ProviderConfig
+}
+
+func newGeminiChatProvider(cfg *model.ProviderConfig) (ChatProvider, error) {
+	return &geminiChatProvider{config: cfg}, nil
+}
+
+func (p *geminiChatProvider) Name() string {
+	return p.config.ProviderName
+}
+
+func (p *geminiChatProvider) Complete(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error) {
+	client, err := GeminiChatClient(ctx, p.config)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Models.GenerateContent(ctx, opts.Model, geminiChatContents(messages), geminiChatConfig(opts))
+	if err != nil {
+		return "", fmt.Errorf("请求失败: %w", err)
+	}
+	return strings.TrimSpace(resp.Text()), nil
+}
+
+func (p *geminiChatProvider) Stream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(delta string)) (string, error) {
+	client, err := GeminiChatClient(ctx, p.config)
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	for resp, err := range client.Models.GenerateContentStream(ctx, opts.Model, geminiChatContents(messages), geminiChatConfig(opts)) {
+		if err != nil {
+			return "", fmt.Errorf("请求失败: %w", err)
+		}
+		if delta := resp.Text(); delta != "" {
+			builder.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
+
+func geminiChatConfig(opts ChatOptions) *genai.GenerateContentConfig {
+	config := &genai.GenerateContentConfig{}
+	if opts.System != "" {
+		config.SystemInstruction = &genai.Content{
+			Parts: []*genai.Part{{Text: opts.System}},
+		}
+	}
+	if opts.JSON {
+		config.ResponseMIMEType = "application/json"
+	}
+	return config
+}
+
+func geminiChatContents(messages []ChatMessage) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		parts := make([]*genai.Part, 0, len(msg.Images)+1)
+		for _, data := range msg.Images {
+			parts = append(parts, &genai.Part{
+				InlineData: &genai.Blob{MIMEType: detectImageMIME(data), Data: data},
+			})
+		}
+		if msg.Text != "" {
+			parts = append(parts, &genai.Part{Text: msg.Text})
+		}
+		contents = append(contents, &genai.Content{Role: role, Parts: parts})
+	}
+	return contents
+}
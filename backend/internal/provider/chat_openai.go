@@ -0,0 +1,216 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"image-gen-service/internal/model"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// openAIChatProvider 使用 OpenAI 兼容的 /chat/completions 接口，系统提示词作为 system 消息，
+// JSON 模式通过 response_format 指定
+type openAIChatProvider struct {
+	config *model.ProviderConfig
+	// jsonFallback JSON 模式不可靠的上游：请求被拒或返回空内容时，去掉 response_format
+	// 改用提示词约束重试一次
+	jsonFallback bool
+}
+
+func newOpenAIChatProvider(cfg *model.ProviderConfig) (ChatProvider, error) {
+	return &openAIChatProvider{config: cfg}, nil
+}
+
+// newDeepSeekChatProvider DeepSeek 兼容 OpenAI 接口，但 JSON 模式偶尔返回空内容，
+// deepseek-reasoner 不支持 response_format
+func newDeepSeekChatProvider(cfg *model.ProviderConfig) (ChatProvider, error) {
+	return &openAIChatProvider{config: cfg, jsonFallback: true}, nil
+}
+
+func (p *openAIChatProvider) Name() string {
+	return p.config.ProviderName
+}
+
+// Complete 直接解析原始响应，兼容 content 返回数组等中转服务的非标准格式
+func (p *openAIChatProvider) Complete(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error) {
+	if !opts.JSON || !p.jsonFallback {
+		return p.complete(ctx, messages, opts, opts.JSON)
+	}
+	if !strings.Contains(strings.ToLower(opts.Model), "reasoner") {
+		text, err := p.complete(ctx, messages, opts, true)
+		if err == nil && text != "" {
+			return text, nil
+		}
+		reason := "返回空内容"
+		if err != nil {
+			if ClassifyError(p.config.ProviderName, err).Class != ErrorClassBadParams {
+				return "", err
+			}
+			reason = err.Error()
+		}
+		log.Printf("[Chat] %s JSON 模式%s，改用提示词约束重试", p.config.ProviderName, reason)
+	}
+	opts.System = withJSONInstruction(opts.System)
+	text, err := p.complete(ctx, messages, opts, false)
+	if err != nil {
+		return "", err
+	}
+	return trimJSONFence(text), nil
+}
+
+func (p *openAIChatProvider) complete(ctx context.Context, messages []ChatMessage, opts ChatOptions, jsonMode bool) (string, error) {
+	client := OpenAIChatClient(p.config)
+	payload := map[string]interface{}{
+		"model":    opts.Model,
+		"messages": openAIChatMessages(messages, opts),
+	}
+	if jsonMode {
+		payload["response_format"] = map[string]interface{}{"type": "json_object"}
+	}
+
+	var respBytes []byte
+	if err := client.Post(ctx, "/chat/completions", payload, &respBytes); err != nil {
+		return "", &upstreamError{message: "请求失败: " + formatOpenAIClientError(err), err: err}
+	}
+	text, err := ExtractChatMessage(respBytes)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+func (p *openAIChatProvider) Stream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(delta string)) (string, error) {
+	client := OpenAIChatClient(p.config)
+	if opts.JSON && p.jsonFallback {
+		opts.System = withJSONInstruction(opts.System)
+	}
+	params := openai.ChatCompletionNewParams{
+		Model:    shared.ChatModel(opts.Model),
+		Messages: openAIChatMessages(messages, opts),
+	}
+	if opts.JSON && !p.jsonFallback {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		}
+	}
+
+	stream := client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+	var builder strings.Builder
+	for stream.Next() {
+		chunk := stream.Current()
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			builder.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return "", &upstreamError{message: "请求失败: " + formatOpenAIClientError(err), err: err}
+	}
+	text := strings.TrimSpace(stripThinking(builder.String()))
+	if opts.JSON {
+		return trimJSONFence(text), nil
+	}
+	return text, nil
+}
+
+func openAIChatMessages(messages []ChatMessage, opts ChatOptions) []openai.ChatCompletionMessageParamUnion {
+	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages)+1)
+	if opts.System != "" {
+		result = append(result, openai.SystemMessage(opts.System))
+	}
+	for _, msg := range messages {
+		if msg.Role == "assistant" {
+			result = append(result, openai.AssistantMessage(msg.Text))
+			continue
+		}
+		if len(msg.Images) == 0 {
+			result = append(result, openai.UserMessage(msg.Text))
+			continue
+		}
+		parts := make([]openai.ChatCompletionContentPartUnionParam, 0, len(msg.Images)+1)
+		for _, data := range msg.Images {
+			dataURL := fmt.Sprintf("data:%s;base64,%s", detectImageMIME(data), base64.StdEncoding.EncodeToString(data))
+			parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+				URL: dataURL,
+			}))
+		}
+		if msg.Text != "" {
+			parts = append(parts, openai.TextContentPart(msg.Text))
+		}
+		result = append(result, openai.UserMessage(parts))
+	}
+	return result
+}
+
+// thinkBlockPattern 部分推理模型（或中转服务）把推理过程以 <think> 标签混在 content 中
+var thinkBlockPattern = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+func stripThinking(text string) string {
+	return thinkBlockPattern.ReplaceAllString(text, "")
+}
+
+// ExtractChatMessage 从 /chat/completions 原始响应中取出第一条回复的文本。推理模型
+// （如 deepseek-reasoner）的推理过程在 reasoning_content 中，仅当最终内容为空时才使用
+func ExtractChatMessage(resp []byte) (string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(resp, &payload); err != nil {
+		return "", fmt.Errorf("解析响应失败: %w", err)
+	}
+	choices, ok := payload["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return "", fmt.Errorf("响应中未找到 choices")
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("响应格式错误")
+	}
+	msg, ok := choice["message"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("响应中未找到 message")
+	}
+	text := strings.TrimSpace(stripThinking(extractTextFromContent(msg["content"])))
+	if text == "" {
+		reasoning, _ := msg["reasoning_content"].(string)
+		text = strings.TrimSpace(stripThinking(reasoning))
+	}
+	return text, nil
+}
+
+func extractTextFromContent(content interface{}) string {
+	switch value := content.(type) {
+	case string:
+		return value
+	case []interface{}:
+		var parts []string
+		for _, item := range value {
+			part, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if t, _ := part["type"].(string); t == "text" {
+				if text, _ := part["text"].(string); text != "" {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	case map[string]interface{}:
+		if text, _ := value["text"].(string); text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+)
+
+// DefaultMaxCount 未配置 tasks.max_count 时单次请求允许生成的最大数量
+const DefaultMaxCount = 4
+
+// ParseCount 解析 count 参数：缺省为 1；接受整数、整数值的浮点数（JSON 数字）与数字字符串（表单字段），
+// 小数、布尔值等其他取值返回错误。只负责类型转换，范围由 ValidateCount 检查
+func ParseCount(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case nil:
+		return 1, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) || v > math.MaxInt32 || v < math.MinInt32 {
+			return 0, fmt.Errorf("count 必须是整数，收到: %v", v)
+		}
+		return int(v), nil
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 1, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("count 必须是整数，收到: %q", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("count 必须是整数，收到 %T 类型", value)
+	}
+}
+
+// countLimit Provider 配置的上限（extra_config.max_count）优先，其次为 tasks.max_count
+func countLimit(providerLimit int) int {
+	if providerLimit > 0 {
+		return providerLimit
+	}
+	if limit := config.Get().Tasks.MaxCount; limit > 0 {
+		return limit
+	}
+	return DefaultMaxCount
+}
+
+// MaxCount 返回 Provider 单次请求允许生成的最大数量，p 为 nil 时返回全局上限
+func MaxCount(p Provider) int {
+	return GetCapabilities(p).MaxCount
+}
+
+// ConfigMaxCount 按 Provider 配置计算 count 上限，无需初始化客户端，供配置列表展示
+func ConfigMaxCount(cfg *model.ProviderConfig) int {
+	return countLimit(extraIntDefault(parseExtraConfig(cfg), "max_count", 0))
+}
+
+// ValidateCount 校验 count 参数的类型与范围（1 ~ 上限），providerLimit 为 0 时使用全局上限
+func ValidateCount(params map[string]interface{}, providerLimit int, verr *ValidationError) {
+	raw, ok := params["count"]
+	if !ok {
+		return
+	}
+	count, err := ParseCount(raw)
+	if err != nil {
+		verr.Add("count", err.Error(), nil, raw)
+		return
+	}
+	if limit := countLimit(providerLimit); count < 1 || count > limit {
+		verr.Add("count", fmt.Sprintf("count 取值范围为 1 ~ %d，收到: %d", limit, count), nil, raw)
+	}
+}
@@ -0,0 +1,420 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"image-gen-service/internal/model"
+)
+
+const (
+	// defaultDebugCaptureSize 开启调试抓包后每个 Provider 保留的最近请求数（extra_config.debug_capture_size）
+	defaultDebugCaptureSize = 20
+	maxDebugCaptureSize     = 100
+	// maxDebugBodyBytes 每条记录中请求体、响应体各自保留的上限，超出部分截断
+	maxDebugBodyBytes = 64 << 10
+)
+
+var (
+	// inlineDataPattern data URI 与长 base64 串（图片数据），替换为大小占位
+	inlineDataPattern = regexp.MustCompile(`data:[\w.+-]+/[\w.+-]+;base64,[A-Za-z0-9+/]+=*|[A-Za-z0-9+/]{256,}=*`)
+	// secretFieldPattern JSON 中的密钥字段
+	secretFieldPattern = regexp.MustCompile(`("(?i:api_?key|key|access_token|token|secret|password|authorization)"\s*:\s*)"[^"]*"`)
+	// secretHeaders 记录时需要隐藏取值的请求/响应头
+	secretHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"X-Api-Key":           true,
+		"Api-Key":             true,
+		"X-Goog-Api-Key":      true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+)
+
+// DebugCapture 一次上游请求的脱敏记录：密钥已隐藏，图片数据以大小占位
+type DebugCapture struct {
+	ID              uint64            `json:"id"`
+	TaskID          string            `json:"task_id,omitempty"`
+	Time            time.Time         `json:"time"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	ResponseBytes   int64             `json:"response_bytes"`
+	Truncated       bool              `json:"truncated,omitempty"`
+	DurationMs      int64             `json:"duration_ms"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// debugRing 固定容量的环形缓冲区，写满后覆盖最早的记录
+type debugRing struct {
+	mu       sync.Mutex
+	entries  []*DebugCapture
+	next     int
+	count    int
+	sequence uint64
+}
+
+var (
+	debugRingsMu sync.Mutex
+	debugRings   = make(map[string]*debugRing)
+)
+
+type debugTaskKey struct{}
+
+// WithDebugTask 在 ctx 中附带任务 ID，抓包记录据此关联到任务
+func WithDebugTask(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, debugTaskKey{}, taskID)
+}
+
+// debugCaptureSettings 读取 extra_config.debug_capture 与 debug_capture_size，默认关闭
+func debugCaptureSettings(cfg *model.ProviderConfig) (bool, int) {
+	extra := parseExtraConfig(cfg)
+	if !extraBool(extra, "debug_capture") {
+		return false, 0
+	}
+	size := extraIntDefault(extra, "debug_capture_size", defaultDebugCaptureSize)
+	if size <= 0 {
+		size = defaultDebugCaptureSize
+	}
+	if size > maxDebugCaptureSize {
+		size = maxDebugCaptureSize
+	}
+	return true, size
+}
+
+// wrapDebugTransport 按配置为 Provider 的 HTTP 客户端包装抓包 Transport；未开启时原样返回，
+// 并丢弃该 Provider 之前的抓包记录
+func wrapDebugTransport(cfg *model.ProviderConfig, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	enabled, size := debugCaptureSettings(cfg)
+	debugRingsMu.Lock()
+	defer debugRingsMu.Unlock()
+	if !enabled {
+		delete(debugRings, cfg.ProviderName)
+		return base
+	}
+	ring := debugRings[cfg.ProviderName]
+	if ring == nil {
+		ring = &debugRing{}
+		debugRings[cfg.ProviderName] = ring
+	}
+	ring.resize(size)
+
+	secrets := []string{}
+	if key := strings.TrimSpace(cfg.APIKey); len(key) >= 4 {
+		secrets = append(secrets, key)
+	}
+	return &debugTransport{base: base, ring: ring, secrets: secrets}
+}
+
+// DebugCaptures 返回 Provider 最近的抓包记录（从旧到新）与缓冲区容量；未开启抓包时 enabled 为 false
+func DebugCaptures(providerName string) (captures []DebugCapture, capacity int, enabled bool) {
+	debugRingsMu.Lock()
+	ring := debugRings[providerName]
+	debugRingsMu.Unlock()
+	if ring == nil {
+		return nil, 0, false
+	}
+	captures, capacity = ring.snapshot("")
+	return captures, capacity, true
+}
+
+// TaskDebugCaptures 返回缓冲区中属于指定任务的抓包记录，用于附加到失败任务上
+func TaskDebugCaptures(providerName, taskID string) []DebugCapture {
+	debugRingsMu.Lock()
+	ring := debugRings[providerName]
+	debugRingsMu.Unlock()
+	if ring == nil || taskID == "" {
+		return nil
+	}
+	captures, _ := ring.snapshot(taskID)
+	return captures
+}
+
+// resize 调整容量，保留最近的记录
+func (r *debugRing) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == size {
+		return
+	}
+	kept := r.orderedLocked()
+	if len(kept) > size {
+		kept = kept[len(kept)-size:]
+	}
+	r.entries = make([]*DebugCapture, size)
+	copy(r.entries, kept)
+	r.count = len(kept)
+	r.next = len(kept) % size
+}
+
+func (r *debugRing) add(entry *DebugCapture) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence++
+	entry.ID = r.sequence
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.count < len(r.entries) {
+		r.count++
+	}
+}
+
+// update 在锁内修改已写入的记录（响应体读取完成后补充）
+func (r *debugRing) update(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn()
+}
+
+// snapshot 复制记录（从旧到新），taskID 非空时只返回该任务的记录
+func (r *debugRing) snapshot(taskID string) ([]DebugCapture, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]DebugCapture, 0, r.count)
+	for _, entry := range r.orderedLocked() {
+		if taskID == "" || entry.TaskID == taskID {
+			result = append(result, *entry)
+		}
+	}
+	return result, len(r.entries)
+}
+
+func (r *debugRing) orderedLocked() []*DebugCapture {
+	if r.count == 0 {
+		return nil
+	}
+	ordered := make([]*DebugCapture, 0, r.count)
+	start := (r.next - r.count + len(r.entries)) % len(r.entries)
+	for i := 0; i < r.count; i++ {
+		ordered = append(ordered, r.entries[(start+i)%len(r.entries)])
+	}
+	return ordered
+}
+
+// debugTransport 记录经过的请求与响应，不改变请求本身
+type debugTransport struct {
+	base    http.RoundTripper
+	ring    *debugRing
+	secrets []string
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	taskID, _ := req.Context().Value(debugTaskKey{}).(string)
+	entry := &DebugCapture{
+		TaskID:         taskID,
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            t.redact(redactURL(req.URL)),
+		RequestHeaders: t.headers(req.Header),
+	}
+
+	// 读取请求体用于记录后以副本继续发送，原请求保持不变
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		clone := req.Clone(req.Context())
+		clone.Body = io.NopCloser(bytes.NewReader(data))
+		req = clone
+		var truncated bool
+		entry.RequestBody, truncated = t.sanitizeBody(req.Header.Get("Content-Type"), data)
+		entry.Truncated = entry.Truncated || truncated
+	}
+
+	startedAt := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	entry.DurationMs = time.Since(startedAt).Milliseconds()
+	if err != nil {
+		entry.Error = t.redact(err.Error())
+		t.ring.add(entry)
+		return nil, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeaders = t.headers(resp.Header)
+	t.ring.add(entry)
+
+	contentType := resp.Header.Get("Content-Type")
+	finish := func(data []byte, total int64, more bool) {
+		body, truncated := t.sanitizeBody(contentType, data)
+		t.ring.update(func() {
+			entry.ResponseBody = body
+			entry.ResponseBytes = total
+			entry.DurationMs = time.Since(startedAt).Milliseconds()
+			entry.Truncated = entry.Truncated || truncated || more
+		})
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		// SDK 重试前可能不读取失败响应就直接关闭，先读取前一部分记录，再原样交还给调用方
+		prefix, _ := io.ReadAll(io.LimitReader(resp.Body, maxDebugBodyBytes))
+		finish(prefix, int64(len(prefix)), len(prefix) == maxDebugBodyBytes)
+		resp.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body = &debugBody{ReadCloser: resp.Body, finish: finish}
+	return resp, nil
+}
+
+// replayBody 已读取的前缀与剩余响应体拼接后的响应体
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// CloseIdleConnections 转发给底层 Transport，http.Client.CloseIdleConnections 依赖该方法释放连接
+func (t *debugTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(idleCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// headers 复制头部并隐藏密钥类字段
+func (t *debugTransport) headers(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for name, values := range header {
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			result[name] = "***"
+			continue
+		}
+		result[name] = t.redact(strings.Join(values, ", "))
+	}
+	return result
+}
+
+// sanitizeBody 隐藏密钥并以大小占位替换图片数据；multipart 只记录字段与文件大小，
+// 二进制内容只记录类型与大小。返回内容是否被截断
+func (t *debugTransport) sanitizeBody(contentType string, data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	data = trimPartialRune(data)
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return t.summarizeMultipart(data, params["boundary"]), false
+	case strings.HasPrefix(mediaType, "image/") || mediaType == "application/octet-stream" || !utf8.Valid(data):
+		return fmt.Sprintf("[binary %s, %d bytes]", mediaType, len(data)), false
+	}
+	text := inlineDataPattern.ReplaceAllStringFunc(string(data), func(match string) string {
+		if prefix, payload, ok := strings.Cut(match, ","); ok && strings.HasPrefix(match, "data:") {
+			return fmt.Sprintf("[%s %d bytes]", prefix, len(payload)*3/4)
+		}
+		return fmt.Sprintf("[base64 %d bytes]", len(match)*3/4)
+	})
+	text = t.redact(secretFieldPattern.ReplaceAllString(text, `$1"***"`))
+	if len(text) > maxDebugBodyBytes {
+		return strings.ToValidUTF8(text[:maxDebugBodyBytes], ""), true
+	}
+	return text, false
+}
+
+// trimPartialRune 去掉截断时末尾残缺的 UTF-8 字符，避免文本被误判为二进制
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax-1 && len(data) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size != 1 {
+			return data
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// summarizeMultipart 列出 multipart 表单的字段值与文件名、大小
+func (t *debugTransport) summarizeMultipart(data []byte, boundary string) string {
+	if boundary == "" {
+		return fmt.Sprintf("[multipart %d bytes]", len(data))
+	}
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	var b strings.Builder
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(part)
+		if part.FileName() != "" {
+			fmt.Fprintf(&b, "%s: [file %s, %s, %d bytes]\n", part.FormName(), part.FileName(), part.Header.Get("Content-Type"), len(content))
+			continue
+		}
+		value, _ := t.sanitizeBody(part.Header.Get("Content-Type"), content)
+		fmt.Fprintf(&b, "%s: %s\n", part.FormName(), value)
+	}
+	return b.String()
+}
+
+// redact 将文本中出现的 API Key 原文替换为 ***
+func (t *debugTransport) redact(text string) string {
+	for _, secret := range t.secrets {
+		text = strings.ReplaceAll(text, secret, "***")
+	}
+	return text
+}
+
+// redactURL 隐藏查询参数中的 key（Gemini 兼容接口可能以 ?key= 传递密钥）
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	copied := *u
+	query := copied.Query()
+	for name := range query {
+		if lower := strings.ToLower(name); lower == "key" || lower == "api_key" || lower == "access_token" {
+			query.Set(name, "***")
+		}
+	}
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
+
+// debugBody 读取响应体时复制前 maxDebugBodyBytes 字节，读完或关闭时补充到抓包记录
+type debugBody struct {
+	io.ReadCloser
+	buf    bytes.Buffer
+	total  int64
+	once   sync.Once
+	finish func(data []byte, total int64, more bool)
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.total += int64(n)
+		if room := maxDebugBodyBytes - b.buf.Len(); room > 0 {
+			b.buf.Write(p[:min(n, room)])
+		}
+	}
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *debugBody) done() {
+	b.once.Do(func() { b.finish(b.buf.Bytes(), b.total, b.total > int64(b.buf.Len())) })
+}
@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/genai"
+)
+
+// 任务失败原因分类，用于判断重试是否可能成功
+const (
+	ErrorClassNetwork       = "network"        // 网络抖动、连接被重置等临时错误
+	ErrorClassRateLimit     = "rate_limit"     // 触发上游限流或配额
+	ErrorClassUpstream      = "upstream"       // 上游服务 5xx
+	ErrorClassTimeout       = "timeout"        // 任务超时
+	ErrorClassInvalidKey    = "invalid_key"    // API Key 无效或无权限
+	ErrorClassContentPolicy = "content_policy" // 被安全策略拦截
+	ErrorClassBadParams     = "bad_params"     // 参数或模型不被上游接受
+	ErrorClassCancelled     = "cancelled"      // 用户取消
+	ErrorClassUnknown       = "unknown"
+)
+
+// ErrorClassification 错误分类结果；RetryAfter 为上游建议的重试等待时间，未提供时为 0
+type ErrorClassification struct {
+	Class      string
+	RetryAfter time.Duration
+}
+
+// IsRetryableClass 判断该类错误重试后是否可能成功
+func IsRetryableClass(class string) bool {
+	switch class {
+	case ErrorClassNetwork, ErrorClassRateLimit, ErrorClassUpstream, ErrorClassTimeout:
+		return true
+	}
+	return false
+}
+
+// errorMatcher 识别某一类上游错误，无法识别时返回 false
+type errorMatcher func(err error) (ErrorClassification, bool)
+
+// ClassifyError 按 Provider 类型选择错误识别规则，优先使用对应 SDK 的结构化错误信息，
+// 最后按网络错误兜底
+func ClassifyError(providerName string, err error) ErrorClassification {
+	if err == nil {
+		return ErrorClassification{Class: ErrorClassUnknown}
+	}
+	matchers := []errorMatcher{matchSafetyError}
+	if strings.HasPrefix(providerName, "gemini") {
+		matchers = append(matchers, matchGeminiError, matchOpenAIError)
+	} else {
+		matchers = append(matchers, matchOpenAIError, matchGeminiError)
+	}
+	matchers = append(matchers, matchUpstreamStatus, matchNetworkError)
+	for _, match := range matchers {
+		if classification, ok := match(err); ok {
+			return classification
+		}
+	}
+	return ErrorClassification{Class: ErrorClassUnknown}
+}
+
+func matchSafetyError(err error) (ErrorClassification, bool) {
+	if errors.Is(err, ErrSafetyBlocked) {
+		return ErrorClassification{Class: ErrorClassContentPolicy}, true
+	}
+	return ErrorClassification{}, false
+}
+
+func matchOpenAIError(err error) (ErrorClassification, bool) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return ErrorClassification{}, false
+	}
+	classification := ErrorClassification{Class: classifyHTTPStatus(apiErr.StatusCode)}
+	if isOpenAISafetyError(err) {
+		classification.Class = ErrorClassContentPolicy
+	}
+	if apiErr.Code == "invalid_api_key" {
+		classification.Class = ErrorClassInvalidKey
+	}
+	if apiErr.Response != nil {
+		classification.RetryAfter = parseRetryAfterHeader(apiErr.Response.Header)
+	}
+	return classification, true
+}
+
+func matchGeminiError(err error) (ErrorClassification, bool) {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return ErrorClassification{}, false
+	}
+	classification := ErrorClassification{Class: classifyHTTPStatus(apiErr.Code)}
+	// Gemini 对无效 Key 返回 400 INVALID_ARGUMENT，需结合错误详情判断
+	if strings.Contains(apiErr.Message, "API_KEY_INVALID") || strings.Contains(apiErr.Message, "API key not valid") {
+		classification.Class = ErrorClassInvalidKey
+	}
+	for _, detail := range apiErr.Details {
+		if reason, _ := detail["reason"].(string); reason == "API_KEY_INVALID" {
+			classification.Class = ErrorClassInvalidKey
+		}
+		// google.rpc.RetryInfo 中的 retryDelay 形如 "17s"
+		if delay, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(delay); err == nil && d > 0 {
+				classification.RetryAfter = d
+			}
+		}
+	}
+	return classification, true
+}
+
+// matchUpstreamStatus 识别直接通过 HTTP 调用的 Provider（如 rembg）返回的状态码
+func matchUpstreamStatus(err error) (ErrorClassification, bool) {
+	var upstream *upstreamError
+	if !errors.As(err, &upstream) || upstream.statusCode == 0 {
+		return ErrorClassification{}, false
+	}
+	return ErrorClassification{
+		Class:      classifyHTTPStatus(upstream.statusCode),
+		RetryAfter: parseRetryAfterHeader(upstream.header),
+	}, true
+}
+
+func matchNetworkError(err error) (ErrorClassification, bool) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassification{Class: ErrorClassTimeout}, true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorClassification{Class: ErrorClassNetwork}, true
+	}
+	return ErrorClassification{}, false
+}
+
+func classifyHTTPStatus(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrorClassRateLimit
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorClassInvalidKey
+	case status == http.StatusRequestTimeout:
+		return ErrorClassNetwork
+	case status >= 500:
+		return ErrorClassUpstream
+	case status >= 400:
+		return ErrorClassBadParams
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// parseRetryAfterHeader 解析 Retry-After（秒数或 HTTP 日期）与 OpenAI 的 retry-after-ms
+func parseRetryAfterHeader(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+// Package fake 提供不调用任何上游接口的 Provider，用于在没有 API Key 的情况下联调
+// 提交 → Worker → 存储 → SSE 的完整流程。设置环境变量 FAKE_PROVIDER=1 后以 "fake" 名称注册。
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/provider"
+)
+
+// Name 默认注册名
+const Name = "fake"
+
+// Config 控制 fake Provider 的行为，任务参数中的 fake_* 字段可逐次覆盖，
+// fake_fail 为非空字符串时该任务以此信息失败
+type Config struct {
+	Delay time.Duration // 每次生成耗时，期间按比例上报进度
+	// FailAfter 前 N 次调用成功，之后的调用全部失败；0 表示从不失败
+	FailAfter   int
+	FailMessage string
+	Images      int // 每次返回的图片数，0 表示按 count 参数
+	Width       int // 图片尺寸，未指定时按 aspect_ratio 以 1024 为长边推算
+	Height      int
+}
+
+// Provider 可编排的 fake Provider，实现 provider.Provider
+type Provider struct {
+	name  string
+	cfg   Config
+	calls atomic.Int64
+}
+
+// New 创建 fake Provider，name 为空时使用 "fake"
+func New(name string, cfg Config) *Provider {
+	if name == "" {
+		name = Name
+	}
+	return &Provider{name: name, cfg: cfg}
+}
+
+// Enabled 是否通过环境变量 FAKE_PROVIDER 开启
+func Enabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("FAKE_PROVIDER")))
+	return v != "" && v != "0" && v != "false"
+}
+
+// ConfigFromEnv 从环境变量读取配置：FAKE_PROVIDER_DELAY（如 3s）、FAKE_PROVIDER_FAIL_AFTER、
+// FAKE_PROVIDER_FAIL_MESSAGE、FAKE_PROVIDER_IMAGES、FAKE_PROVIDER_SIZE（如 512x768）
+func ConfigFromEnv() Config {
+	cfg := Config{Delay: 2 * time.Second}
+	if d, err := time.ParseDuration(os.Getenv("FAKE_PROVIDER_DELAY")); err == nil && d >= 0 {
+		cfg.Delay = d
+	}
+	cfg.FailAfter, _ = strconv.Atoi(os.Getenv("FAKE_PROVIDER_FAIL_AFTER"))
+	cfg.FailMessage = os.Getenv("FAKE_PROVIDER_FAIL_MESSAGE")
+	cfg.Images, _ = strconv.Atoi(os.Getenv("FAKE_PROVIDER_IMAGES"))
+	cfg.Width, cfg.Height = parseSize(os.Getenv("FAKE_PROVIDER_SIZE"))
+	return cfg
+}
+
+// Register 按环境变量配置注册 fake Provider，返回是否已注册；未开启时不做任何事
+func Register() bool {
+	if !Enabled() {
+		return false
+	}
+	provider.Register(New(Name, ConfigFromEnv()))
+	return true
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// Calls 已执行的 Generate 次数
+func (p *Provider) Calls() int {
+	return int(p.calls.Load())
+}
+
+func (p *Provider) ValidateParams(params map[string]interface{}) error {
+	verr := &provider.ValidationError{}
+	if prompt, _ := params["prompt"].(string); prompt == "" {
+		verr.Add("prompt", "prompt 不能为空", nil, nil)
+	}
+	if raw, ok := params["fake_size"]; ok {
+		if s, _ := raw.(string); s != "" {
+			if w, h := parseSize(s); w == 0 || h == 0 {
+				verr.Add("fake_size", fmt.Sprintf("fake_size 格式无效: %s，应为 宽x高", s), nil, raw)
+			}
+		}
+	}
+	provider.ValidateCount(params, 0, verr)
+	return verr.Err()
+}
+
+func (p *Provider) Generate(ctx context.Context, params map[string]interface{}) (*provider.ProviderResult, error) {
+	call := int(p.calls.Add(1))
+	cfg := p.effectiveConfig(params)
+
+	if err := p.wait(ctx, cfg.Delay); err != nil {
+		return nil, err
+	}
+	// 任务参数 fake_fail 使本次调用以该信息失败
+	if message, _ := params["fake_fail"].(string); message != "" {
+		return nil, errors.New(message)
+	}
+	if cfg.FailAfter > 0 && call > cfg.FailAfter {
+		message := cfg.FailMessage
+		if message == "" {
+			message = fmt.Sprintf("fake provider 第 %d 次调用按配置失败", call)
+		}
+		// 模拟上游返回了无法解析的响应，便于验证失败任务的原始响应记录
+		body, _ := json.Marshal(map[string]interface{}{"call": call, "error": message, "choices": []interface{}{}})
+		return nil, provider.WithRawResponse(errors.New(message), body)
+	}
+
+	count := cfg.Images
+	if count <= 0 {
+		count = intParam(params["count"])
+	}
+	if count <= 0 {
+		count = 1
+	}
+	width, height := cfg.Width, cfg.Height
+	if width <= 0 || height <= 0 {
+		width, height = sizeForAspect(aspectParam(params))
+	}
+
+	images := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data, err := renderPNG(width, height, call*31+i)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, data)
+	}
+	return &provider.ProviderResult{
+		Images: images,
+		Metadata: map[string]interface{}{
+			"provider": p.name,
+			"model":    "fake",
+			"type":     "image",
+		},
+	}, nil
+}
+
+// effectiveConfig 任务参数 fake_delay_ms / fake_images / fake_size 覆盖默认配置
+func (p *Provider) effectiveConfig(params map[string]interface{}) Config {
+	cfg := p.cfg
+	if v, ok := params["fake_delay_ms"]; ok {
+		cfg.Delay = time.Duration(intParam(v)) * time.Millisecond
+	}
+	if v, ok := params["fake_images"]; ok {
+		cfg.Images = intParam(v)
+	}
+	if v, ok := params["fake_size"].(string); ok && v != "" {
+		cfg.Width, cfg.Height = parseSize(v)
+	}
+	return cfg
+}
+
+// wait 模拟生成耗时并分段上报进度，任务被取消或超时时提前返回
+func (p *Provider) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	const steps = 5
+	ticker := time.NewTicker(delay / steps)
+	defer ticker.Stop()
+	for step := 1; step <= steps; step++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if step < steps {
+				provider.ReportProgress(ctx, step*100/steps)
+			}
+		}
+	}
+	return nil
+}
+
+func intParam(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(n))
+		return i
+	default:
+		return 0
+	}
+}
+
+func aspectParam(params map[string]interface{}) string {
+	for _, key := range []string{"aspect_ratio", "aspectRatio"} {
+		if v, ok := params[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// sizeForAspect 以 1024 为长边按比例推算尺寸，比例无效时返回 1024x1024
+func sizeForAspect(aspect string) (int, int) {
+	const long = 1024
+	parts := strings.SplitN(aspect, ":", 2)
+	if len(parts) != 2 {
+		return long, long
+	}
+	w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+	h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return long, long
+	}
+	if w >= h {
+		return long, long * h / w
+	}
+	return long * w / h, long
+}
+
+// parseSize 解析 "宽x高"，格式无效时返回 0, 0
+func parseSize(value string) (int, int) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(value)), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	w, errW := strconv.Atoi(parts[0])
+	h, errH := strconv.Atoi(parts[1])
+	if errW != nil || errH != nil || w <= 0 || h <= 0 || w > 8192 || h > 8192 {
+		return 0, 0
+	}
+	return w, h
+}
+
+// renderPNG 生成一张渐变图，seed 不同颜色不同，便于在图库中区分
+func renderPNG(width, height, seed int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	base := uint8(seed * 47 % 256)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: base + uint8(x*255/width),
+				G: uint8(y * 255 / height),
+				B: 255 - base,
+				A: 255,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
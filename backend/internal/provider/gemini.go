@@ -4,25 +4,40 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"image-gen-service/internal/model"
+	"io"
 	"log"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/genai"
 )
 
 type GeminiProvider struct {
-	config *model.ProviderConfig
-	client *genai.Client
+	config  *model.ProviderConfig
+	timeout time.Duration
+
+	// fanout 中转忽略 CandidateCount 时是否补发请求凑齐数量，fanoutConcurrency 为补发并发上限
+	fanout            bool
+	fanoutConcurrency int
+	// maxPromptLength 提示词字符数上限（extra_config.max_prompt_length），0 表示沿用全局配置
+	maxPromptLength int
+	// maxCount 单次请求允许生成的最大数量（extra_config.max_count），0 表示沿用 tasks.max_count
+	maxCount int
+
+	mu         sync.RWMutex
+	client     *genai.Client
+	httpClient *http.Client
+	// reuseConns 当前客户端是否复用连接（keep-alive 或 HTTP/2）；复用出错后切换为每次新建连接并保持
+	reuseConns bool
 }
 
 func NewGeminiProvider(config *model.ProviderConfig) (*GeminiProvider, error) {
-	ctx := context.Background()
-
 	log.Printf("[Gemini] 正在初始化 Provider: BaseURL=%s, KeyLen=%d\n", config.APIBase, len(config.APIKey))
 
 	timeout := time.Duration(config.TimeoutSeconds) * time.Second
@@ -30,23 +45,57 @@ func NewGeminiProvider(config *model.ProviderConfig) (*GeminiProvider, error) {
 		timeout = 500 * time.Second
 	}
 
-	// 配置自定义 HTTP 客户端，完全禁用连接复用
-	// 每次请求都使用新的 TCP 连接，避免 "bad file descriptor" 问题
-	httpClient := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			// 禁用连接复用和 HTTP/2
-			DisableKeepAlives:   true,
-			ForceAttemptHTTP2:   false,
-			MaxIdleConns:        0,
-			MaxIdleConnsPerHost: 0,
-			// TLS 配置
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: false,
-				MinVersion:         tls.VersionTLS12,
-			},
+	// 连接策略可通过 extra_config 配置，默认保持原有的安全行为：
+	// 每次请求都使用新的 TCP 连接且不使用 HTTP/2，避免部分中转出现 "bad file descriptor" 问题
+	extra := parseExtraConfig(config)
+	disableKeepAlive := extraBoolDefault(extra, "disable_keepalive", true)
+	forceHTTP1 := extraBoolDefault(extra, "force_http1", true)
+
+	client, httpClient, err := newGeminiClient(config, timeout, disableKeepAlive, forceHTTP1)
+	if err != nil {
+		log.Printf("[Gemini] 创建客户端失败: %v\n", err)
+		return nil, err
+	}
+
+	log.Printf("[Gemini] Provider 初始化成功 (disable_keepalive=%v, force_http1=%v)\n", disableKeepAlive, forceHTTP1)
+	return &GeminiProvider{
+		config:            config,
+		timeout:           timeout,
+		fanout:            extraBoolDefault(extra, "candidate_fanout", true),
+		fanoutConcurrency: extraIntDefault(extra, "fanout_concurrency", 2),
+		maxPromptLength:   extraIntDefault(extra, "max_prompt_length", 0),
+		maxCount:          extraIntDefault(extra, "max_count", 0),
+		client:            client,
+		httpClient:        httpClient,
+		reuseConns:        !disableKeepAlive || !forceHTTP1,
+	}, nil
+}
+
+func newGeminiClient(config *model.ProviderConfig, timeout time.Duration, disableKeepAlive, forceHTTP1 bool) (*genai.Client, *http.Client, error) {
+	transport := &http.Transport{
+		DisableKeepAlives: disableKeepAlive,
+		ForceAttemptHTTP2: !forceHTTP1,
+		IdleConnTimeout:   90 * time.Second,
+		// TLS 配置
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: false,
+			MinVersion:         tls.VersionTLS12,
 		},
 	}
+	if disableKeepAlive {
+		transport.MaxIdleConns = 0
+		transport.MaxIdleConnsPerHost = 0
+	} else {
+		transport.MaxIdleConnsPerHost = 4
+	}
+	if forceHTTP1 {
+		// 非 nil 的空表可以彻底关闭 HTTP/2 协商
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: wrapDebugTransport(config, transport),
+	}
 
 	clientConfig := &genai.ClientConfig{
 		APIKey:     config.APIKey,
@@ -64,23 +113,77 @@ func NewGeminiProvider(config *model.ProviderConfig) (*GeminiProvider, error) {
 		}
 	}
 
-	client, err := genai.NewClient(ctx, clientConfig)
+	client, err := genai.NewClient(context.Background(), clientConfig)
 	if err != nil {
-		log.Printf("[Gemini] 创建客户端失败: %v\n", err)
-		return nil, fmt.Errorf("创建 Gemini 客户端失败: %w", err)
+		return nil, nil, fmt.Errorf("创建 Gemini 客户端失败: %w", err)
 	}
+	return client, httpClient, nil
+}
 
-	log.Printf("[Gemini] Provider 初始化成功\n")
-	return &GeminiProvider{
-		config: config,
-		client: client,
-	}, nil
+// generateContent 调用 GenerateContent；复用连接时若遇到疑似连接复用导致的错误，
+// 使用全新的短连接重试一次，并在当前 Provider 实例上记住该偏好
+func (p *GeminiProvider) generateContent(ctx context.Context, modelID string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	p.mu.RLock()
+	client, reuseConns := p.client, p.reuseConns
+	p.mu.RUnlock()
+
+	resp, err := client.Models.GenerateContent(ctx, modelID, contents, config)
+	if err == nil || !reuseConns || ctx.Err() != nil || !isConnectionReuseError(err) {
+		return resp, err
+	}
+
+	log.Printf("[Gemini] 复用连接请求失败，改用新连接重试并关闭连接复用: %v\n", err)
+	fresh, freshHTTP, buildErr := newGeminiClient(p.config, p.timeout, true, true)
+	if buildErr != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	stale := p.httpClient
+	p.client = fresh
+	p.httpClient = freshHTTP
+	p.reuseConns = false
+	p.mu.Unlock()
+	stale.CloseIdleConnections()
+	return fresh.Models.GenerateContent(ctx, modelID, contents, config)
+}
+
+// isConnectionReuseError 判断错误是否像是复用了已失效的连接
+func isConnectionReuseError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range []string{
+		"bad file descriptor",
+		"use of closed network connection",
+		"connection reset by peer",
+		"broken pipe",
+		"server closed idle connection",
+		"http2: server sent goaway",
+		"http2: client connection lost",
+		"unexpected eof",
+	} {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 func (p *GeminiProvider) Name() string {
 	return "gemini"
 }
 
+// Capabilities Gemini 不支持放大，提示词上限可通过 extra_config 配置
+func (p *GeminiProvider) Capabilities() Capabilities {
+	return Capabilities{MaxPromptLength: p.maxPromptLength, MaxCount: p.maxCount}
+}
+
+// CloseIdleConnections 配置被替换后释放连接池中的空闲连接
+func (p *GeminiProvider) CloseIdleConnections() {
+	p.mu.RLock()
+	httpClient := p.httpClient
+	p.mu.RUnlock()
+	httpClient.CloseIdleConnections()
+}
+
 func (p *GeminiProvider) Generate(ctx context.Context, params map[string]interface{}) (*ProviderResult, error) {
 	// 记录日志时排除大数据字段
 	logParams := make(map[string]interface{})
@@ -101,12 +204,16 @@ func (p *GeminiProvider) Generate(ctx context.Context, params map[string]interfa
 		return nil, fmt.Errorf("缺少 prompt 参数")
 	}
 
-	modelID := ResolveModelID(ModelResolveOptions{
+	resolved := ResolveModelID(ModelResolveOptions{
 		ProviderName: p.Name(),
 		Purpose:      PurposeImage,
 		Params:       params,
 		Config:       p.config,
-	}).ID
+	})
+	if resolved.Err != nil {
+		return nil, resolved.Err
+	}
+	modelID := resolved.ID
 	if modelID == "" {
 		return nil, fmt.Errorf("缺少 model_id 参数")
 	}
@@ -147,6 +254,8 @@ func (p *GeminiProvider) Generate(ctx context.Context, params map[string]interfa
 		genConfig.ImageConfig.ImageSize = strings.ToUpper(strings.TrimSpace(quality))
 	}
 
+	// 未指定比例和分辨率时不发送 ImageConfig，由模型使用默认值（有参考图时沿用参考图比例）
+
 	// 3. 安全设置 (避免由于安全过滤导致的空响应)
 	genConfig.SafetySettings = []*genai.SafetySetting{
 		{Category: genai.HarmCategoryHateSpeech, Threshold: genai.HarmBlockThresholdBlockNone},
@@ -222,6 +331,7 @@ func (p *GeminiProvider) generateWithReferences(ctx context.Context, modelID, pr
 		default:
 			continue
 		}
+		imgBytes = StripImageMetadata(imgBytes)
 
 		// 自动检测 MIME Type
 		mimeType = http.DetectContentType(imgBytes)
@@ -243,32 +353,33 @@ func (p *GeminiProvider) generateWithReferences(ctx context.Context, modelID, pr
 	parts = append(parts, &genai.Part{Text: cleanedPrompt})
 
 	// 调用 GenerateContent 接口
+	aspectRatio, imageSize := describeImageConfig(config.ImageConfig)
 	log.Printf("[Gemini] 开始调用 GenerateContent, Model: %s, Parts: %d, AspectRatio: %s, ImageSize: %s\n",
-		modelID, len(parts), config.ImageConfig.AspectRatio, config.ImageConfig.ImageSize)
+		modelID, len(parts), aspectRatio, imageSize)
 
-	resp, err := p.client.Models.GenerateContent(ctx, modelID, []*genai.Content{
+	contents := []*genai.Content{
 		{
 			Role:  "user",
 			Parts: parts,
 		},
-	}, config)
+	}
+	startedAt := time.Now()
+	resp, err := p.generateContent(ctx, modelID, contents, config)
 	if err != nil {
 		return nil, fmt.Errorf("图生图 GenerateContent 调用失败: %w", err)
 	}
 
 	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
-		return nil, fmt.Errorf("API 未返回有效内容 (可能触发了安全过滤或配额限制)")
+		if blocked := geminiPromptBlocked(resp); blocked != nil {
+			return nil, withJSONResponse(blocked, resp)
+		}
+		return nil, withJSONResponse(fmt.Errorf("API 未返回有效内容 (可能触发了安全过滤或配额限制)"), resp)
 	}
 
 	candidate := resp.Candidates[0]
 
 	// 解析返回的图片数据
-	var images [][]byte
-	for _, part := range candidate.Content.Parts {
-		if part.InlineData != nil && len(part.InlineData.Data) > 0 {
-			images = append(images, part.InlineData.Data)
-		}
-	}
+	images := collectCandidateImages(resp)
 
 	if len(images) == 0 {
 		// 构造详细的错误信息
@@ -288,17 +399,25 @@ func (p *GeminiProvider) generateWithReferences(ctx context.Context, modelID, pr
 				}
 			}
 		}
-		return nil, fmt.Errorf(reason.String())
+		if isGeminiSafetyFinish(candidate.FinishReason) {
+			return nil, withJSONResponse(&safetyBlockedError{message: reason.String()}, resp)
+		}
+		return nil, withJSONResponse(errors.New(reason.String()), resp)
 	}
 
+	images, fanout := p.fillCandidates(ctx, modelID, contents, config, images, time.Since(startedAt))
+	metadata := map[string]interface{}{
+		"provider":      "gemini",
+		"model":         modelID,
+		"finish_reason": candidate.FinishReason,
+		"type":          "image-to-image",
+	}
+	for k, v := range fanout {
+		metadata[k] = v
+	}
 	return &ProviderResult{
-		Images: images,
-		Metadata: map[string]interface{}{
-			"provider":      "gemini",
-			"model":         modelID,
-			"finish_reason": candidate.FinishReason,
-			"type":          "image-to-image",
-		},
+		Images:   images,
+		Metadata: metadata,
 	}, nil
 }
 
@@ -315,27 +434,28 @@ func (p *GeminiProvider) generateViaContent(ctx context.Context, modelID, prompt
 		},
 	}
 
+	aspectRatio, imageSize := describeImageConfig(config.ImageConfig)
 	log.Printf("[Gemini] 开始调用 GenerateContent (Text-to-Image), Model: %s, AspectRatio: %s, ImageSize: %s\n",
-		modelID, config.ImageConfig.AspectRatio, config.ImageConfig.ImageSize)
+		modelID, aspectRatio, imageSize)
 
-	resp, err := p.client.Models.GenerateContent(ctx, modelID, []*genai.Content{content}, config)
+	contents := []*genai.Content{content}
+	startedAt := time.Now()
+	resp, err := p.generateContent(ctx, modelID, contents, config)
 	if err != nil {
 		return nil, fmt.Errorf("通过 GenerateContent 调用失败: %w", err)
 	}
 
 	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
-		return nil, fmt.Errorf("通过 GenerateContent 调用未返回有效内容 (可能是由于安全过滤或配额限制)")
+		if blocked := geminiPromptBlocked(resp); blocked != nil {
+			return nil, withJSONResponse(blocked, resp)
+		}
+		return nil, withJSONResponse(fmt.Errorf("通过 GenerateContent 调用未返回有效内容 (可能是由于安全过滤或配额限制)"), resp)
 	}
 
 	candidate := resp.Candidates[0]
 
 	// 解析返回的图片数据
-	var images [][]byte
-	for _, part := range candidate.Content.Parts {
-		if part.InlineData != nil && len(part.InlineData.Data) > 0 {
-			images = append(images, part.InlineData.Data)
-		}
-	}
+	images := collectCandidateImages(resp)
 
 	if len(images) == 0 {
 		var reason strings.Builder
@@ -354,55 +474,223 @@ func (p *GeminiProvider) generateViaContent(ctx context.Context, modelID, prompt
 				}
 			}
 		}
-		return nil, fmt.Errorf(reason.String())
+		if isGeminiSafetyFinish(candidate.FinishReason) {
+			return nil, withJSONResponse(&safetyBlockedError{message: reason.String()}, resp)
+		}
+		return nil, withJSONResponse(errors.New(reason.String()), resp)
 	}
 
+	images, fanout := p.fillCandidates(ctx, modelID, contents, config, images, time.Since(startedAt))
+	metadata := map[string]interface{}{
+		"provider":      "gemini",
+		"model":         modelID,
+		"finish_reason": candidate.FinishReason,
+		"type":          "text-to-image",
+	}
+	for k, v := range fanout {
+		metadata[k] = v
+	}
 	return &ProviderResult{
-		Images: images,
-		Metadata: map[string]interface{}{
-			"provider":      "gemini",
-			"model":         modelID,
-			"finish_reason": candidate.FinishReason,
-			"type":          "text-to-image",
-		},
+		Images:   images,
+		Metadata: metadata,
 	}, nil
 }
 
+// collectCandidateImages 收集所有候选结果中的图片
+func collectCandidateImages(resp *genai.GenerateContentResponse) [][]byte {
+	var images [][]byte
+	for _, candidate := range resp.Candidates {
+		if candidate == nil || candidate.Content == nil {
+			continue
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData != nil && len(part.InlineData.Data) > 0 {
+				images = append(images, part.InlineData.Data)
+			}
+		}
+	}
+	return images
+}
+
+// fillCandidates 许多中转会忽略 CandidateCount 只返回一个候选。返回数量不足时，在任务剩余
+// 时间内并发补发单候选请求凑齐数量，补发失败次数不超过 MaxRetries；补发失败不影响已有结果，
+// 仅在返回的元数据中说明实际数量
+func (p *GeminiProvider) fillCandidates(ctx context.Context, modelID string, contents []*genai.Content, config *genai.GenerateContentConfig, images [][]byte, callDuration time.Duration) ([][]byte, map[string]interface{}) {
+	requested := int(config.CandidateCount)
+	if requested <= 1 || len(images) >= requested {
+		return images, nil
+	}
+	meta := map[string]interface{}{
+		"requested_count": requested,
+	}
+	if !p.fanout {
+		meta["returned_count"] = len(images)
+		meta["note"] = fmt.Sprintf("上游仅返回 %d/%d 张图片（已关闭补发）", len(images), requested)
+		return images, meta
+	}
+
+	single := *config
+	single.CandidateCount = 1
+	concurrency := p.fanoutConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// 补发次数预算：缺少的数量加上允许的重试次数
+	budget := requested - len(images)
+	if p.config.MaxRetries > 0 {
+		budget += p.config.MaxRetries
+	}
+	calls := 0
+	var lastErr error
+	for len(images) < requested && budget > 0 && ctx.Err() == nil {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < callDuration {
+			log.Printf("[Gemini] 剩余时间 %s 不足以再补发一轮请求，停止补发\n", time.Until(deadline).Round(time.Second))
+			break
+		}
+		batch := requested - len(images)
+		if batch > concurrency {
+			batch = concurrency
+		}
+		if batch > budget {
+			batch = budget
+		}
+		log.Printf("[Gemini] 上游返回 %d/%d 张图片，并发补发 %d 个请求\n", len(images), requested, batch)
+
+		type fanoutResult struct {
+			images   [][]byte
+			err      error
+			duration time.Duration
+		}
+		results := make(chan fanoutResult, batch)
+		for i := 0; i < batch; i++ {
+			go func() {
+				startedAt := time.Now()
+				resp, err := p.generateContent(ctx, modelID, contents, &single)
+				result := fanoutResult{err: err, duration: time.Since(startedAt)}
+				if err == nil {
+					result.images = collectCandidateImages(resp)
+					if len(result.images) == 0 {
+						result.err = errors.New("补发请求未返回图片")
+					}
+				}
+				results <- result
+			}()
+		}
+		for i := 0; i < batch; i++ {
+			result := <-results
+			if result.duration > callDuration {
+				callDuration = result.duration
+			}
+			if result.err != nil {
+				lastErr = result.err
+				log.Printf("[Gemini] 补发请求失败: %v\n", result.err)
+				continue
+			}
+			images = append(images, result.images...)
+		}
+		calls += batch
+		budget -= batch
+	}
+
+	if len(images) > requested {
+		images = images[:requested]
+	}
+	meta["returned_count"] = len(images)
+	meta["fanout_calls"] = calls
+	if len(images) < requested {
+		note := fmt.Sprintf("仅生成 %d/%d 张图片", len(images), requested)
+		if lastErr != nil {
+			note += "，补发失败: " + lastErr.Error()
+		}
+		meta["note"] = note
+	}
+	return images, meta
+}
+
+// isGeminiSafetyFinish 判断 FinishReason 是否表示被安全策略拦截
+func isGeminiSafetyFinish(reason genai.FinishReason) bool {
+	switch reason {
+	case genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonProhibitedContent,
+		genai.FinishReasonSPII, genai.FinishReasonImageSafety, genai.FinishReasonImageProhibitedContent:
+		return true
+	}
+	return false
+}
+
+// geminiPromptBlocked 提示词本身被拦截时上游不返回候选结果，原因在 PromptFeedback 中
+func geminiPromptBlocked(resp *genai.GenerateContentResponse) error {
+	if resp == nil || resp.PromptFeedback == nil || resp.PromptFeedback.BlockReason == "" {
+		return nil
+	}
+	message := fmt.Sprintf("提示词被安全策略拦截 (BlockReason: %s)", resp.PromptFeedback.BlockReason)
+	if resp.PromptFeedback.BlockReasonMessage != "" {
+		message += ": " + resp.PromptFeedback.BlockReasonMessage
+	}
+	return &safetyBlockedError{message: message}
+}
+
+// geminiAspectRatios / geminiResolutionLevels Gemini 支持的比例与分辨率级别
+var (
+	geminiAspectRatios     = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+	geminiResolutionLevels = []string{"1K", "2K", "4K"}
+)
+
 func (p *GeminiProvider) ValidateParams(params map[string]interface{}) error {
+	verr := &ValidationError{}
 	prompt, _ := params["prompt"].(string)
 	if prompt == "" {
-		return fmt.Errorf("prompt 不能为空")
+		verr.Add("prompt", "prompt 不能为空", nil, nil)
 	}
 
 	// 1. 校验比例 (Aspect Ratio)
+	arField := "aspect_ratio"
 	ar, ok := params["aspect_ratio"].(string)
 	if !ok {
+		arField = "aspectRatio"
 		ar, _ = params["aspectRatio"].(string)
 	}
-	if ar != "" {
-		validARs := map[string]bool{
-			"1:1": true, "2:3": true, "3:2": true, "3:4": true, "4:3": true,
-			"4:5": true, "5:4": true, "9:16": true, "16:9": true, "21:9": true,
-		}
-		if !validARs[ar] {
-			return fmt.Errorf("不支持的比例: %s，可选值: 1:1, 2:3, 3:2, 3:4, 4:3, 4:5, 5:4, 9:16, 16:9, 21:9", ar)
-		}
+	if ar != "" && !containsString(geminiAspectRatios, ar) {
+		verr.Add(arField, fmt.Sprintf("不支持的比例: %s，可选值: %s", ar, strings.Join(geminiAspectRatios, ", ")), geminiAspectRatios, ar)
 	}
 
 	// 2. 校验分辨率级别 (1K, 2K, 4K)
-	rl, ok := params["resolution_level"].(string)
-	if !ok {
-		rl, _ = params["imageSize"].(string)
+	var rlField, rl string
+	for _, key := range []string{"resolution_level", "imageSize", "image_size"} {
+		if v, ok := params[key].(string); ok {
+			rlField, rl = key, v
+			break
+		}
 	}
-	if !ok {
-		rl, _ = params["image_size"].(string)
+	if rl != "" && !containsString(geminiResolutionLevels, rl) {
+		verr.Add(rlField, fmt.Sprintf("不支持的分辨率级别: %s，请使用: %s", rl, strings.Join(geminiResolutionLevels, ", ")), geminiResolutionLevels, rl)
 	}
-	if rl != "" {
-		validRLs := map[string]bool{"1K": true, "2K": true, "4K": true}
-		if !validRLs[rl] {
-			return fmt.Errorf("不支持的分辨率级别: %s，请使用: 1K, 2K, 4K", rl)
+
+	// 3. 校验生成数量
+	ValidateCount(params, p.maxCount, verr)
+
+	return verr.Err()
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil
+// describeImageConfig 返回用于日志的比例与分辨率，未设置的项显示为 auto
+func describeImageConfig(cfg *genai.ImageConfig) (string, string) {
+	aspectRatio, imageSize := "auto", "auto"
+	if cfg == nil {
+		return aspectRatio, imageSize
+	}
+	if cfg.AspectRatio != "" {
+		aspectRatio = cfg.AspectRatio
+	}
+	if cfg.ImageSize != "" {
+		imageSize = cfg.ImageSize
+	}
+	return aspectRatio, imageSize
 }
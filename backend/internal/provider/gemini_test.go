@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"image-gen-service/internal/model"
+
+	"google.golang.org/genai"
+)
+
+// geminiStubTransport 代替真实网络返回一张图片，并记录请求体
+type geminiStubTransport struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+	image  []byte
+}
+
+func (s *geminiStubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body map[string]interface{}
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		json.Unmarshal(data, &body)
+	}
+	s.mu.Lock()
+	s.bodies = append(s.bodies, body)
+	s.mu.Unlock()
+
+	resp := map[string]interface{}{
+		"candidates": []interface{}{map[string]interface{}{
+			"content": map[string]interface{}{
+				"role":  "model",
+				"parts": []interface{}{map[string]interface{}{"inlineData": map[string]interface{}{"mimeType": "image/png", "data": base64.StdEncoding.EncodeToString(s.image)}}},
+			},
+			"finishReason": "STOP",
+		}},
+	}
+	data, _ := json.Marshal(resp)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}, nil
+}
+
+func (s *geminiStubTransport) lastGenerationConfig(t *testing.T) map[string]interface{} {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) == 0 {
+		t.Fatal("未发出 GenerateContent 请求")
+	}
+	cfg, _ := s.bodies[len(s.bodies)-1]["generationConfig"].(map[string]interface{})
+	return cfg
+}
+
+func stubPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newStubbedGemini(t *testing.T) (*GeminiProvider, *geminiStubTransport) {
+	t.Helper()
+	p, err := NewGeminiProvider(&model.ProviderConfig{ProviderName: "gemini", APIKey: "k", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &geminiStubTransport{image: stubPNG(t)}
+	httpClient := &http.Client{Transport: stub}
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{APIKey: "k", Backend: genai.BackendGeminiAPI, HTTPClient: httpClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.client, p.httpClient = client, httpClient
+	return p, stub
+}
+
+// TestGeminiGenerateWithoutImageConfig 仅有提示词时 ImageConfig 为 nil，生成与日志都不应 panic，也不发送 imageConfig
+func TestGeminiGenerateWithoutImageConfig(t *testing.T) {
+	cases := []struct {
+		name       string
+		params     map[string]interface{}
+		wantAspect string
+	}{
+		{"文生图仅提示词", map[string]interface{}{"prompt": "a cat", "model_id": "gemini-image"}, ""},
+		{"图生图仅提示词", map[string]interface{}{"prompt": "a cat", "model_id": "gemini-image", "reference_images": []interface{}{stubPNG(t)}}, ""},
+		{"指定比例", map[string]interface{}{"prompt": "a cat", "model_id": "gemini-image", "aspect_ratio": "16:9"}, "16:9"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, stub := newStubbedGemini(t)
+			result, err := p.Generate(context.Background(), tc.params)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if len(result.Images) != 1 || !bytes.HasPrefix(result.Images[0], []byte("\x89PNG")) {
+				t.Fatalf("返回图片数 = %d", len(result.Images))
+			}
+
+			genCfg := stub.lastGenerationConfig(t)
+			imageCfg, hasImageCfg := genCfg["imageConfig"].(map[string]interface{})
+			if tc.wantAspect == "" {
+				if hasImageCfg {
+					t.Fatalf("未指定比例与分辨率时不应发送 imageConfig: %v", imageCfg)
+				}
+				return
+			}
+			if !hasImageCfg || imageCfg["aspectRatio"] != tc.wantAspect {
+				t.Fatalf("imageConfig = %v，期望 aspectRatio=%s", imageCfg, tc.wantAspect)
+			}
+		})
+	}
+}
+
+func TestDescribeImageConfig(t *testing.T) {
+	if ar, size := describeImageConfig(nil); ar != "auto" || size != "auto" {
+		t.Fatalf("nil ImageConfig = %s/%s", ar, size)
+	}
+	ar, size := describeImageConfig(&genai.ImageConfig{ImageSize: "2K"})
+	if ar != "auto" || !strings.EqualFold(size, "2K") {
+		t.Fatalf("部分设置 = %s/%s", ar, size)
+	}
+}
@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"log"
+
+	"image-gen-service/internal/config"
+
+	"github.com/disintegration/imaging"
+)
+
+var errMalformedImage = errors.New("图片结构无法解析")
+
+// StripImageMetadata 在参考图发往第三方服务前移除 EXIF / XMP 等元数据（含 GPS 定位）
+// 优先做无损的分段删除；JPEG 带旋转方向时先按方向摆正再高质量重新编码，避免图片被转错方向
+func StripImageMetadata(data []byte) []byte {
+	if !config.Get().Privacy.StripReferenceMetadata || len(data) < 12 {
+		return data
+	}
+
+	var (
+		out []byte
+		err error
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		out, err = stripJPEGMetadata(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		out, err = stripPNGMetadata(data)
+	case bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		out, err = stripWebPMetadata(data)
+	default:
+		return data
+	}
+	if err != nil {
+		log.Printf("[Privacy] 移除参考图元数据失败，将使用原图: %v", err)
+		return data
+	}
+	return out
+}
+
+// stripJPEGMetadata 删除 APP1 (EXIF/XMP)、APP13 (IPTC) 与注释段，保留 ICC 等色彩相关段
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if orientation := jpegOrientation(data); orientation > 1 {
+		img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, errMalformedImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// 填充字节
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			// SOS 之后为压缩数据，原样保留
+			out = append(out, data[pos:]...)
+			return out, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errMalformedImage
+		}
+		switch marker {
+		case 0xE1, 0xED, 0xFE:
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return nil, errMalformedImage
+}
+
+// jpegOrientation 读取 EXIF 中的 Orientation 标签，未找到时返回 0
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 0
+		}
+		marker := data[pos+1]
+		if marker == 0xDA {
+			return 0
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 0
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[pos+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[pos+10 : end])
+		}
+		pos = end
+	}
+	return 0
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+	return 0
+}
+
+// stripPNGMetadata 删除 eXIf 与文本块（XMP 存放在 iTXt 中），其余块原样保留
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	pos := 8
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformedImage
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		switch chunkType {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if chunkType == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, errMalformedImage
+}
+
+// stripWebPMetadata 删除 EXIF / XMP 块，并同步清除 VP8X 头中的对应标志位
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkType := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errMalformedImage
+		}
+		switch chunkType {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	if pos != len(data) {
+		return nil, errMalformedImage
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// Provider 初始化状态
+const (
+	InitStatusPending  = "pending"  // 已启用，尚未被使用，客户端未创建
+	InitStatusOK       = "ok"       // 客户端已创建
+	InitStatusError    = "error"    // 创建客户端失败，Error 为失败原因
+	InitStatusDisabled = "disabled" // 配置未启用
+)
+
+// InitStatus Provider 客户端的初始化状态，只保存在内存中，配置重新加载后重置
+type InitStatus struct {
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	InitializedAt *time.Time `json:"initialized_at,omitempty"`
+}
+
+// ProviderInitStatus 返回指定 Provider 的初始化状态；通过 Register 注册的 Provider 视为已初始化，
+// 未配置时返回 nil
+func ProviderInitStatus(name string) *InitStatus {
+	registryMu.RLock()
+	p, entry := Registry[name], lazyProviders[name]
+	registryMu.RUnlock()
+	if p != nil {
+		return &InitStatus{Status: InitStatusOK}
+	}
+	if entry == nil {
+		return nil
+	}
+	status := entry.status()
+	return &status
+}
+
+// ProviderInitStatuses 返回全部生图 Provider 的初始化状态
+func ProviderInitStatuses() map[string]InitStatus {
+	registryMu.RLock()
+	entries := make(map[string]*lazyProvider, len(lazyProviders))
+	for name, entry := range lazyProviders {
+		entries[name] = entry
+	}
+	registered := make([]string, 0, len(Registry))
+	for name := range Registry {
+		registered = append(registered, name)
+	}
+	registryMu.RUnlock()
+
+	statuses := make(map[string]InitStatus, len(entries)+len(registered))
+	for name, entry := range entries {
+		statuses[name] = entry.status()
+	}
+	for _, name := range registered {
+		statuses[name] = InitStatus{Status: InitStatusOK}
+	}
+	return statuses
+}
+
+// UnavailableError 说明 GetProvider 返回 nil 的原因，有初始化错误时附带错误信息
+func UnavailableError(name string) error {
+	status := ProviderInitStatus(name)
+	switch {
+	case status == nil:
+		return fmt.Errorf("未找到指定的 Provider: %s", name)
+	case status.Status == InitStatusDisabled:
+		return fmt.Errorf("Provider %s 未启用", name)
+	case status.Status == InitStatusError:
+		return fmt.Errorf("Provider %s 初始化失败: %s", name, status.Error)
+	default:
+		return fmt.Errorf("Provider %s 暂不可用", name)
+	}
+}
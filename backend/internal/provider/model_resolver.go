@@ -2,6 +2,7 @@ package provider
 
 import (
 	"encoding/json"
+	"fmt"
 	"image-gen-service/internal/model"
 	"strings"
 )
@@ -9,10 +10,30 @@ import (
 type ModelPurpose string
 
 const (
-	PurposeImage ModelPurpose = "image"
-	PurposeChat  ModelPurpose = "chat"
+	PurposeImage  ModelPurpose = "image"
+	PurposeChat   ModelPurpose = "chat"
+	PurposeVision ModelPurpose = "vision"
 )
 
+// ModelEntry 对应 ProviderConfig.Models JSON 中的单个模型
+// Capabilities 为空表示旧数据或无法识别，解析时视为通用模型
+type ModelEntry struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name,omitempty"`
+	Default      bool           `json:"default,omitempty"`
+	Capabilities []ModelPurpose `json:"capabilities,omitempty"`
+}
+
+// Supports 判断模型是否可用于指定用途；识图模型同时可用于对话
+func (e ModelEntry) Supports(purpose ModelPurpose) bool {
+	for _, capability := range e.Capabilities {
+		if capability == purpose || (purpose == PurposeChat && capability == PurposeVision) {
+			return true
+		}
+	}
+	return false
+}
+
 type ModelResolveOptions struct {
 	ProviderName string
 	Purpose      ModelPurpose
@@ -24,6 +45,7 @@ type ModelResolveOptions struct {
 type ModelResolveResult struct {
 	ID     string
 	Source string
+	Err    error // 配置中的模型均不适用于当前用途时返回，应提示用户修改配置
 }
 
 func ResolveModelID(opts ModelResolveOptions) ModelResolveResult {
@@ -45,9 +67,15 @@ func ResolveModelID(opts ModelResolveOptions) ModelResolveResult {
 	}
 
 	if opts.Config != nil {
-		if id := pickModelFromModels(opts.Config.Models); id != "" {
+		entries := ParseModelEntries(opts.Config.Models)
+		if id := pickModelForPurpose(entries, opts.Purpose); id != "" {
 			return ModelResolveResult{ID: id, Source: "config"}
 		}
+		if len(entries) > 0 && opts.Purpose != "" {
+			return ModelResolveResult{Err: fmt.Errorf(
+				"Provider %s 已配置的模型均不支持%s，请在设置中添加%s模型，或在请求中指定 model_id",
+				opts.ProviderName, purposeLabel(opts.Purpose), purposeLabel(opts.Purpose))}
+		}
 	}
 
 	if id := defaultModelForProvider(opts.ProviderName, opts.Purpose); id != "" {
@@ -57,33 +85,115 @@ func ResolveModelID(opts ModelResolveOptions) ModelResolveResult {
 	return ModelResolveResult{}
 }
 
-func pickModelFromModels(models string) string {
+// ParseModelEntries 解析 Models JSON，格式错误时返回空列表
+func ParseModelEntries(models string) []ModelEntry {
 	models = strings.TrimSpace(models)
 	if models == "" {
-		return ""
-	}
-	var parsed []struct {
-		ID      string `json:"id"`
-		Default bool   `json:"default"`
+		return nil
 	}
+	var parsed []ModelEntry
 	if err := json.Unmarshal([]byte(models), &parsed); err != nil {
-		return ""
+		return nil
 	}
+	entries := parsed[:0]
 	for _, item := range parsed {
-		if item.Default && strings.TrimSpace(item.ID) != "" {
-			return item.ID
+		item.ID = strings.TrimSpace(item.ID)
+		if item.ID != "" {
+			entries = append(entries, item)
 		}
 	}
-	for _, item := range parsed {
-		if strings.TrimSpace(item.ID) != "" {
-			return item.ID
+	return entries
+}
+
+// pickModelForPurpose 按以下顺序选择模型：用途匹配的默认模型、用途匹配的模型、
+// 未标注用途的默认模型、未标注用途的模型；已标注但用途不符的模型不会被选中
+func pickModelForPurpose(entries []ModelEntry, purpose ModelPurpose) string {
+	matches := func(e ModelEntry) bool {
+		if purpose == "" {
+			return true
+		}
+		return e.Supports(purpose)
+	}
+	untagged := func(e ModelEntry) bool {
+		return len(e.Capabilities) == 0
+	}
+	for _, accept := range []func(ModelEntry) bool{matches, untagged} {
+		for _, item := range entries {
+			if item.Default && accept(item) {
+				return item.ID
+			}
+		}
+		for _, item := range entries {
+			if accept(item) {
+				return item.ID
+			}
 		}
 	}
 	return ""
 }
 
+// DetectModelCapabilities 根据模型 ID 推断能力，无法识别时返回 nil
+func DetectModelCapabilities(modelID string) []ModelPurpose {
+	id := strings.ToLower(strings.TrimSpace(modelID))
+	id = strings.TrimPrefix(id, "models/")
+	if id == "" {
+		return nil
+	}
+	for _, keyword := range []string{"embedding", "tts", "whisper", "audio", "moderation", "transcribe"} {
+		if strings.Contains(id, keyword) {
+			return nil
+		}
+	}
+	for _, keyword := range []string{"image", "imagen", "dall-e", "flux", "stable-diffusion", "sdxl", "midjourney", "seedream", "kolors"} {
+		if strings.Contains(id, keyword) {
+			return []ModelPurpose{PurposeImage}
+		}
+	}
+	for _, keyword := range []string{"vision", "-vl", "gpt-4o", "gpt-4.1", "gpt-5", "gemini", "claude", "qwen-vl", "glm-4v"} {
+		if strings.Contains(id, keyword) {
+			return []ModelPurpose{PurposeVision}
+		}
+	}
+	for _, keyword := range []string{"gpt", "chat", "deepseek", "qwen", "glm", "llama", "mistral", "moonshot", "kimi"} {
+		if strings.Contains(id, keyword) {
+			return []ModelPurpose{PurposeChat}
+		}
+	}
+	for _, prefix := range []string{"o1", "o3", "o4"} {
+		if strings.HasPrefix(id, prefix) {
+			return []ModelPurpose{PurposeChat}
+		}
+	}
+	return nil
+}
+
+// PurposeForProvider 返回 Provider 配置的用途：*-chat 为对话配置，其余为生图配置
+func PurposeForProvider(providerName string) ModelPurpose {
+	if strings.HasSuffix(strings.ToLower(strings.TrimSpace(providerName)), "-chat") {
+		return PurposeChat
+	}
+	return PurposeImage
+}
+
+func purposeLabel(purpose ModelPurpose) string {
+	switch purpose {
+	case PurposeImage:
+		return "图片生成"
+	case PurposeVision:
+		return "识图"
+	default:
+		return "对话"
+	}
+}
+
 func defaultModelForProvider(providerName string, purpose ModelPurpose) string {
 	name := strings.ToLower(strings.TrimSpace(providerName))
+	switch name {
+	case "anthropic-chat":
+		return "claude-3-5-sonnet-latest"
+	case "deepseek-chat":
+		return "deepseek-chat"
+	}
 	if purpose == PurposeChat || name == "openai-chat" {
 		return "gemini-3-flash-preview"
 	}
@@ -24,6 +24,15 @@ type OpenAIProvider struct {
 	httpClient *http.Client
 	apiBase    string
 	userAgent  string
+	// upscalePath 中转服务的放大接口路径（extra_config.upscale_path），为空表示不支持放大
+	upscalePath  string
+	upscaleModel string
+	// streamProgress 以流式请求生图并上报中转服务推送的进度（extra_config.stream_progress）
+	streamProgress bool
+	// maxPromptLength 中转服务可接受的提示词字符数上限（extra_config.max_prompt_length）
+	maxPromptLength int
+	// maxCount 单次请求允许生成的最大数量（extra_config.max_count），0 表示沿用 tasks.max_count
+	maxCount int
 }
 
 func NewOpenAIProvider(config *model.ProviderConfig) (*OpenAIProvider, error) {
@@ -33,7 +42,7 @@ func NewOpenAIProvider(config *model.ProviderConfig) (*OpenAIProvider, error) {
 	}
 
 	apiBase := NormalizeOpenAIBaseURL(config.APIBase)
-	httpClient := &http.Client{Timeout: timeout}
+	httpClient := &http.Client{Timeout: timeout, Transport: wrapDebugTransport(config, newProviderTransport())}
 	userAgent := "image-gen-service/1.0"
 	opts := []option.RequestOption{
 		option.WithAPIKey(config.APIKey),
@@ -47,12 +56,20 @@ func NewOpenAIProvider(config *model.ProviderConfig) (*OpenAIProvider, error) {
 	}
 	client := openai.NewClient(opts...)
 
+	extra := parseExtraConfig(config)
+
 	return &OpenAIProvider{
-		config:     config,
-		client:     &client,
-		httpClient: httpClient,
-		apiBase:    apiBase,
-		userAgent:  userAgent,
+		config:       config,
+		client:       &client,
+		httpClient:   httpClient,
+		apiBase:      apiBase,
+		userAgent:    userAgent,
+		upscalePath:  strings.TrimSpace(extraString(extra, "upscale_path")),
+		upscaleModel: strings.TrimSpace(extraString(extra, "upscale_model")),
+
+		streamProgress:  extraBool(extra, "stream_progress"),
+		maxPromptLength: extraIntDefault(extra, "max_prompt_length", 0),
+		maxCount:        extraIntDefault(extra, "max_count", 0),
 	}, nil
 }
 
@@ -60,6 +77,63 @@ func (p *OpenAIProvider) Name() string {
 	return "openai"
 }
 
+// CloseIdleConnections 配置被替换后释放连接池中的空闲连接
+func (p *OpenAIProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
+// Capabilities 仅在配置了放大接口时声明支持放大
+func (p *OpenAIProvider) Capabilities() Capabilities {
+	return Capabilities{Upscale: p.upscalePath != "", MaxPromptLength: p.maxPromptLength, MaxCount: p.maxCount}
+}
+
+// Upscale 调用中转服务的放大接口（Real-ESRGAN / Stability upscale 等）
+// 请求体: {"model": ..., "image": <base64>, "scale": factor}，响应兼容 images 接口的 data 数组
+func (p *OpenAIProvider) Upscale(ctx context.Context, image []byte, factor int, params map[string]interface{}) (*ProviderResult, error) {
+	if p.upscalePath == "" {
+		return nil, fmt.Errorf("当前 Provider 未配置放大接口 (extra_config.upscale_path)")
+	}
+	if len(image) == 0 {
+		return nil, fmt.Errorf("待放大的图片为空")
+	}
+
+	modelID := p.upscaleModel
+	if v, ok := params["model_id"].(string); ok && strings.TrimSpace(v) != "" {
+		modelID = strings.TrimSpace(v)
+	}
+	body := map[string]interface{}{
+		"image": base64.StdEncoding.EncodeToString(image),
+		"scale": factor,
+	}
+	if modelID != "" {
+		body["model"] = modelID
+	}
+
+	log.Printf("[OpenAI] Upscale 被调用, Path: %s, Model: %s, Scale: %d, Size: %d bytes\n", p.upscalePath, modelID, factor, len(image))
+	var respBytes []byte
+	if err := p.client.Post(ctx, p.upscalePath, body, &respBytes); err != nil {
+		return nil, &upstreamError{message: "放大请求失败: " + formatOpenAIClientError(err), err: err}
+	}
+	if len(respBytes) == 0 {
+		return nil, fmt.Errorf("接口未返回内容")
+	}
+
+	images, err := p.extractImages(ctx, respBytes)
+	if err != nil {
+		return nil, WithRawResponse(err, respBytes)
+	}
+
+	return &ProviderResult{
+		Images: images,
+		Metadata: map[string]interface{}{
+			"provider": "openai",
+			"model":    modelID,
+			"type":     "upscale",
+			"scale":    factor,
+		},
+	}, nil
+}
+
 func (p *OpenAIProvider) Generate(ctx context.Context, params map[string]interface{}) (*ProviderResult, error) {
 	logParams := make(map[string]interface{})
 	for k, v := range params {
@@ -75,12 +149,16 @@ func (p *OpenAIProvider) Generate(ctx context.Context, params map[string]interfa
 	}
 	log.Printf("[OpenAI] Generate 被调用, Params: %+v\n", logParams)
 
-	modelID := ResolveModelID(ModelResolveOptions{
+	resolved := ResolveModelID(ModelResolveOptions{
 		ProviderName: p.Name(),
 		Purpose:      PurposeImage,
 		Params:       params,
 		Config:       p.config,
-	}).ID
+	})
+	if resolved.Err != nil {
+		return nil, resolved.Err
+	}
+	modelID := resolved.ID
 	if modelID == "" {
 		return nil, fmt.Errorf("缺少 model_id 参数")
 	}
@@ -123,16 +201,24 @@ func (p *OpenAIProvider) Generate(ctx context.Context, params map[string]interfa
 	if _, ok := reqBody["modalities"]; !ok {
 		reqBody["modalities"] = []string{"text", "image"}
 	}
-	applyOpenAIOptions(reqBody, params)
+	if err := applyOpenAIOptions(reqBody, params); err != nil {
+		return nil, err
+	}
 
-	respBytes, err := p.doChatRequest(ctx, reqBody)
+	var respBytes []byte
+	var err error
+	if p.streamProgress {
+		respBytes, err = p.doChatStream(ctx, reqBody)
+	} else {
+		respBytes, err = p.doChatRequest(ctx, reqBody)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	images, err := p.extractImages(ctx, respBytes)
 	if err != nil {
-		return nil, err
+		return nil, WithRawResponse(err, respBytes)
 	}
 
 	return &ProviderResult{
@@ -146,21 +232,26 @@ func (p *OpenAIProvider) Generate(ctx context.Context, params map[string]interfa
 }
 
 func (p *OpenAIProvider) ValidateParams(params map[string]interface{}) error {
-	if _, ok := params["messages"]; ok {
-		return nil
-	}
-	prompt, _ := params["prompt"].(string)
-	if prompt == "" {
-		return fmt.Errorf("prompt 不能为空")
+	// 提交前校验透传选项，避免任务排队后才在上游失败
+	_, optionsErr := validateOpenAIOptions(params)
+	verr := &ValidationError{}
+	if _, ok := params["messages"]; !ok {
+		if prompt, _ := params["prompt"].(string); prompt == "" {
+			verr.Add("prompt", "prompt 不能为空", nil, nil)
+		}
 	}
-	return nil
+	ValidateCount(params, p.maxCount, verr)
+	return JoinValidationErrors(optionsErr, verr.Err())
 }
 
 func (p *OpenAIProvider) doChatRequest(ctx context.Context, body map[string]interface{}) ([]byte, error) {
 	var respBytes []byte
 	err := p.client.Post(ctx, "/chat/completions", body, &respBytes)
 	if err != nil {
-		return nil, fmt.Errorf("请求失败: %s", formatOpenAIClientError(err))
+		if isOpenAISafetyError(err) {
+			return nil, &safetyBlockedError{message: "请求被安全策略拦截: " + formatOpenAIClientError(err)}
+		}
+		return nil, withOpenAIErrorBody(&upstreamError{message: "请求失败: " + formatOpenAIClientError(err), err: err}, err)
 	}
 	if len(respBytes) == 0 {
 		return nil, fmt.Errorf("接口未返回内容")
@@ -188,11 +279,15 @@ func (p *OpenAIProvider) extractImages(ctx context.Context, respBytes []byte) ([
 
 	var images [][]byte
 	var textSnippets []string
+	filtered := false
 	for _, choice := range choices {
 		choiceMap, ok := choice.(map[string]interface{})
 		if !ok {
 			continue
 		}
+		if reason, _ := choiceMap["finish_reason"].(string); reason == "content_filter" {
+			filtered = true
+		}
 		message, ok := choiceMap["message"].(map[string]interface{})
 		if !ok {
 			continue
@@ -205,6 +300,9 @@ func (p *OpenAIProvider) extractImages(ctx context.Context, respBytes []byte) ([
 
 	if len(images) == 0 {
 		extra := strings.TrimSpace(strings.Join(textSnippets, " | "))
+		if filtered {
+			return nil, &safetyBlockedError{message: strings.TrimSpace("生成结果被安全策略拦截 (finish_reason: content_filter) " + extra)}
+		}
 		if extra != "" {
 			return nil, fmt.Errorf("未在响应中找到图片数据: %s", extra)
 		}
@@ -338,6 +436,7 @@ func buildImageParts(raw interface{}) ([]openai.ChatCompletionContentPartUnionPa
 		default:
 			continue
 		}
+		imgBytes = StripImageMetadata(imgBytes)
 
 		mimeType := http.DetectContentType(imgBytes)
 		if !strings.HasPrefix(mimeType, "image/") {
@@ -379,26 +478,16 @@ func appendPromptHints(prompt string, params map[string]interface{}) string {
 	return fmt.Sprintf("%s\n\n%s", prompt, strings.Join(hintParts, "，"))
 }
 
-func applyOpenAIOptions(body map[string]interface{}, params map[string]interface{}) {
-	keys := []string{
-		"temperature",
-		"top_p",
-		"max_tokens",
-		"presence_penalty",
-		"frequency_penalty",
-		"response_format",
-		"modalities",
-		"stream",
-		"stop",
-		"user",
-		"tools",
-		"tool_choice",
-	}
-	for _, key := range keys {
-		if val, ok := params[key]; ok {
-			body[key] = val
-		}
+// applyOpenAIOptions 将通过白名单校验的选项写入请求体
+func applyOpenAIOptions(body map[string]interface{}, params map[string]interface{}) error {
+	options, err := validateOpenAIOptions(params)
+	if err != nil {
+		return err
+	}
+	for key, val := range options {
+		body[key] = val
 	}
+	return nil
 }
 
 func NormalizeOpenAIBaseURL(apiBase string) string {
@@ -436,6 +525,28 @@ func formatOpenAIClientError(err error) string {
 	return err.Error()
 }
 
+// withOpenAIErrorBody 附加上游返回的错误响应体
+func withOpenAIErrorBody(err, clientErr error) error {
+	var apiErr *openai.Error
+	if !errors.As(clientErr, &apiErr) {
+		return err
+	}
+	return WithRawResponse(err, []byte(apiErr.RawJSON()))
+}
+
+// isOpenAISafetyError 判断上游错误是否为内容安全策略拦截
+func isOpenAISafetyError(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case "content_policy_violation", "content_filter", "moderation_blocked":
+		return true
+	}
+	return false
+}
+
 func parseOpenAIError(resp []byte) string {
 	var payload map[string]interface{}
 	if err := json.Unmarshal(resp, &payload); err != nil {
@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// openAIOptionValidators 允许透传给上游 chat/completions 的参数及其校验规则，返回规范化后的值
+var openAIOptionValidators = map[string]func(interface{}) (interface{}, error){
+	"temperature":       numberInRange(0, 2),
+	"top_p":             numberInRange(0, 1),
+	"presence_penalty":  numberInRange(-2, 2),
+	"frequency_penalty": numberInRange(-2, 2),
+	"max_tokens":        intInRange(1, 1<<20),
+	"response_format":   validateResponseFormat,
+	"modalities":        validateModalities,
+	"stream":            validateStream,
+	"stop":              validateStop,
+	"user":              stringMaxLength(256),
+	"tools":             validateTools,
+	"tool_choice":       validateToolChoice,
+}
+
+// openAIOptionAllowed 取值为固定枚举的选项，校验失败时随错误返回给前端
+var openAIOptionAllowed = map[string][]string{
+	"response_format": {"text", "json_object", "json_schema"},
+	"modalities":      {"text", "image"},
+	"tool_choice":     {"none", "auto", "required"},
+}
+
+// openAIKnownParams 生成流程自身使用的参数，不属于上游选项，不会透传也不记为丢弃
+var openAIKnownParams = map[string]bool{
+	"prompt": true, "messages": true, "model": true, "model_id": true, "provider": true,
+	"count": true, "aspect": true, "aspectRatio": true, "aspect_ratio": true,
+	"imageSize": true, "image_size": true, "resolution_level": true,
+	"reference_images": true, "operation": true, "scale": true, "source_path": true,
+	"timeout_seconds": true, "enforce_aspect": true, "crop_gravity": true,
+}
+
+// validateOpenAIOptions 按白名单校验用户传入的上游选项，返回可直接写入请求体的值；
+// 类型或取值不合法时返回汇总全部问题的 ValidationError，未知参数只记录日志后丢弃
+func validateOpenAIOptions(params map[string]interface{}) (map[string]interface{}, error) {
+	options := make(map[string]interface{})
+	verr := &ValidationError{}
+	var dropped []string
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := params[key]
+		validate, ok := openAIOptionValidators[key]
+		if !ok {
+			if !openAIKnownParams[key] {
+				dropped = append(dropped, key)
+			}
+			continue
+		}
+		if val == nil {
+			continue
+		}
+		normalized, err := validate(val)
+		if err != nil {
+			verr.Add(key, fmt.Sprintf("参数 %s 无效: %v", key, err), openAIOptionAllowed[key], val)
+			continue
+		}
+		if normalized != nil {
+			options[key] = normalized
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		log.Printf("[OpenAI] 忽略不支持透传的参数: %s", strings.Join(dropped, ", "))
+	}
+	return options, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func numberInRange(min, max float64) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		n, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("必须是数字")
+		}
+		if n < min || n > max {
+			return nil, fmt.Errorf("取值范围为 %g ~ %g", min, max)
+		}
+		return n, nil
+	}
+}
+
+func intInRange(min, max int) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		n, ok := toFloat(v)
+		if !ok || n != float64(int(n)) {
+			return nil, fmt.Errorf("必须是整数")
+		}
+		if int(n) < min || int(n) > max {
+			return nil, fmt.Errorf("取值范围为 %d ~ %d", min, max)
+		}
+		return int(n), nil
+	}
+}
+
+func stringMaxLength(max int) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("必须是字符串")
+		}
+		if len(s) > max {
+			return nil, fmt.Errorf("长度不能超过 %d", max)
+		}
+		return s, nil
+	}
+}
+
+// validateStream 流式模式由 Provider 配置 extra_config.stream_progress 决定，不接受任务参数覆盖
+func validateStream(v interface{}) (interface{}, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("必须是布尔值")
+	}
+	if b {
+		return nil, fmt.Errorf("请去掉 stream=true，流式模式需在 Provider 配置中开启 stream_progress")
+	}
+	return nil, nil
+}
+
+func validateResponseFormat(v interface{}) (interface{}, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("必须是对象，如 {\"type\":\"text\"}")
+	}
+	switch obj["type"] {
+	case "text", "json_object":
+		return map[string]interface{}{"type": obj["type"]}, nil
+	case "json_schema":
+		schema, ok := obj["json_schema"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("type=json_schema 时必须提供 json_schema 对象")
+		}
+		if name, _ := schema["name"].(string); strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("json_schema.name 不能为空")
+		}
+		return map[string]interface{}{"type": "json_schema", "json_schema": schema}, nil
+	default:
+		return nil, fmt.Errorf("type 仅支持 text / json_object / json_schema")
+	}
+}
+
+func validateModalities(v interface{}) (interface{}, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		if strs, ok := v.([]string); ok {
+			list = make([]interface{}, len(strs))
+			for i, s := range strs {
+				list[i] = s
+			}
+		} else {
+			return nil, fmt.Errorf("必须是字符串数组")
+		}
+	}
+	modalities := make([]string, 0, len(list))
+	for _, item := range list {
+		s, _ := item.(string)
+		if s != "text" && s != "image" {
+			return nil, fmt.Errorf("仅支持 text / image")
+		}
+		modalities = append(modalities, s)
+	}
+	if len(modalities) == 0 {
+		return nil, fmt.Errorf("不能为空")
+	}
+	return modalities, nil
+}
+
+func validateStop(v interface{}) (interface{}, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []interface{}:
+		if len(s) > 4 {
+			return nil, fmt.Errorf("最多 4 个")
+		}
+		stops := make([]string, 0, len(s))
+		for _, item := range s {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("必须是字符串或字符串数组")
+			}
+			stops = append(stops, str)
+		}
+		return stops, nil
+	default:
+		return nil, fmt.Errorf("必须是字符串或字符串数组")
+	}
+}
+
+func validateTools(v interface{}) (interface{}, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("必须是数组")
+	}
+	for i, item := range list {
+		tool, ok := item.(map[string]interface{})
+		if !ok || tool["type"] != "function" {
+			return nil, fmt.Errorf("第 %d 项必须是 {\"type\":\"function\",...}", i+1)
+		}
+		fn, ok := tool["function"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("第 %d 项缺少 function 对象", i+1)
+		}
+		if name, _ := fn["name"].(string); strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("第 %d 项缺少 function.name", i+1)
+		}
+	}
+	return list, nil
+}
+
+func validateToolChoice(v interface{}) (interface{}, error) {
+	switch choice := v.(type) {
+	case string:
+		if choice != "none" && choice != "auto" && choice != "required" {
+			return nil, fmt.Errorf("仅支持 none / auto / required 或指定函数")
+		}
+		return choice, nil
+	case map[string]interface{}:
+		fn, _ := choice["function"].(map[string]interface{})
+		if name, _ := fn["name"].(string); choice["type"] != "function" || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("指定函数时格式为 {\"type\":\"function\",\"function\":{\"name\":...}}")
+		}
+		return choice, nil
+	default:
+		return nil, fmt.Errorf("格式无效")
+	}
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// openAIStreamMaxLine 单行 SSE 数据的上限，最后一个片段中的 data URL 可能有数 MB
+const openAIStreamMaxLine = 64 << 20
+
+// streamProgressPattern 中转服务常以 "生成中 35%" 之类的文本推送进度
+var streamProgressPattern = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)\s*%`)
+
+// openAIStreamChunk 流式响应的单个片段；progress 为部分中转服务额外返回的进度字段
+type openAIStreamChunk struct {
+	Progress *float64 `json:"progress"`
+	Choices  []struct {
+		Delta struct {
+			Content interface{} `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// doChatStream 以 stream=true 请求 /chat/completions，上报中转服务推送的进度，并把各片段的内容
+// 拼接成与非流式接口相同结构的响应交给 extractImages 解析。上游忽略 stream 直接返回 JSON 时原样返回。
+// 读取受 ctx 约束，任务超时或取消时连接会被关闭，不会因格式错误的片段阻塞 Worker
+func (p *OpenAIProvider) doChatStream(ctx context.Context, body map[string]interface{}) ([]byte, error) {
+	body["stream"] = true
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.apiBase+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, &upstreamError{message: "请求失败: " + err.Error(), err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, &upstreamError{
+			message:    fmt.Sprintf("请求失败: %s %s", resp.Status, parseOpenAIError(respBytes)),
+			statusCode: resp.StatusCode,
+			header:     resp.Header,
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		respBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("读取响应失败: %w", err)
+		}
+		if len(respBytes) == 0 {
+			return nil, fmt.Errorf("接口未返回内容")
+		}
+		return respBytes, nil
+	}
+
+	var content strings.Builder
+	finishReason := ""
+	lastProgress := -1
+	skipped := 0
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), openAIStreamMaxLine)
+	for scanner.Scan() {
+		payload, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "data:")
+		if !ok {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "[DONE]" {
+			break
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			skipped++
+			continue
+		}
+		if chunk.Error != nil && chunk.Error.Message != "" {
+			return nil, fmt.Errorf("上游返回错误: %s", chunk.Error.Message)
+		}
+
+		progress := -1
+		if chunk.Progress != nil {
+			progress = int(math.Round(*chunk.Progress))
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			text := extractTextFromContent(choice.Delta.Content)
+			if text == "" {
+				continue
+			}
+			content.WriteString(text)
+			if progress < 0 && !strings.Contains(text, "data:image/") {
+				progress = parseStreamProgress(text)
+			}
+		}
+		if progress > lastProgress && progress <= 100 {
+			lastProgress = progress
+			ReportProgress(ctx, progress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取流式响应失败: %w", err)
+	}
+	if skipped > 0 {
+		log.Printf("[OpenAI] 流式响应中有 %d 个片段无法解析，已跳过\n", skipped)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"choices": []map[string]interface{}{
+			{
+				"message":       map[string]interface{}{"role": "assistant", "content": content.String()},
+				"finish_reason": finishReason,
+			},
+		},
+	})
+}
+
+// parseStreamProgress 取文本中最后一个百分比，未找到时返回 -1
+func parseStreamProgress(text string) int {
+	matches := streamProgressPattern.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return -1
+	}
+	value, err := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	if err != nil {
+		return -1
+	}
+	return int(math.Round(value))
+}
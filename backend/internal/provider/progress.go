@@ -0,0 +1,28 @@
+package provider
+
+import "context"
+
+// ProgressFunc 接收上游上报的生成进度（0-100）
+type ProgressFunc func(percent int)
+
+type progressKey struct{}
+
+// WithProgress 在 ctx 中附带进度回调，支持上报进度的 Provider 会在生成过程中调用
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress 上报生成进度，ctx 未附带回调时忽略
+func ReportProgress(ctx context.Context, percent int) {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	if fn == nil {
+		return
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	fn(percent)
+}
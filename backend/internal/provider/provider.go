@@ -2,9 +2,14 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"image-gen-service/internal/config"
 	"image-gen-service/internal/model"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -21,11 +26,159 @@ type Provider interface {
 	ValidateParams(params map[string]interface{}) error
 }
 
-// Registry 用于管理不同的 Provider
+// ErrSafetyBlocked 请求或生成结果被上游安全策略拦截，可通过 errors.Is 判断
+var ErrSafetyBlocked = errors.New("内容被安全策略拦截")
+
+// safetyBlockedError 保留上游返回的详细原因，同时可被识别为 ErrSafetyBlocked
+type safetyBlockedError struct {
+	message string
+}
+
+func (e *safetyBlockedError) Error() string { return e.message }
+
+func (e *safetyBlockedError) Unwrap() error { return ErrSafetyBlocked }
+
+// upstreamError 使用自定义错误文案，同时保留原始错误与 HTTP 状态供 ClassifyError 识别
+type upstreamError struct {
+	message    string
+	err        error
+	statusCode int
+	header     http.Header
+}
+
+func (e *upstreamError) Error() string { return e.message }
+
+func (e *upstreamError) Unwrap() error { return e.err }
+
+// Upscaler 由支持图片放大的 Provider 实现
+type Upscaler interface {
+	Upscale(ctx context.Context, image []byte, factor int, params map[string]interface{}) (*ProviderResult, error)
+}
+
+// Capabilities 描述 Provider 支持的附加能力
+type Capabilities struct {
+	Upscale bool `json:"upscale"`
+	// MaxPromptLength 上游可接受的提示词字符数上限（extra_config.max_prompt_length），0 表示沿用全局配置
+	MaxPromptLength int `json:"max_prompt_length,omitempty"`
+	// MaxCount 单次请求允许生成的最大数量：extra_config.max_count 优先，其次为 tasks.max_count
+	MaxCount int `json:"max_count"`
+}
+
+// CapabilityReporter 由能力取决于配置的 Provider 实现
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// GetCapabilities 获取 Provider 的能力描述
+func GetCapabilities(p Provider) Capabilities {
+	if p == nil {
+		return Capabilities{MaxCount: countLimit(0)}
+	}
+	var caps Capabilities
+	if reporter, ok := p.(CapabilityReporter); ok {
+		caps = reporter.Capabilities()
+	} else {
+		_, caps.Upscale = p.(Upscaler)
+	}
+	caps.MaxCount = countLimit(caps.MaxCount)
+	return caps
+}
+
+// parseExtraConfig 解析 ProviderConfig.ExtraConfig 中的 JSON 配置
+func parseExtraConfig(cfg *model.ProviderConfig) map[string]interface{} {
+	extra := map[string]interface{}{}
+	if cfg == nil || cfg.ExtraConfig == "" {
+		return extra
+	}
+	if err := json.Unmarshal([]byte(cfg.ExtraConfig), &extra); err != nil {
+		log.Printf("解析 Provider %s 的 extra_config 失败: %v", cfg.ProviderName, err)
+	}
+	return extra
+}
+
+func extraString(extra map[string]interface{}, key string) string {
+	v, _ := extra[key].(string)
+	return v
+}
+
+func extraBool(extra map[string]interface{}, key string) bool {
+	switch v := extra[key].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(strings.TrimSpace(v), "true")
+	default:
+		return false
+	}
+}
+
+// extraBoolDefault 读取布尔开关，未配置时返回默认值
+func extraBoolDefault(extra map[string]interface{}, key string, def bool) bool {
+	if _, ok := extra[key]; !ok {
+		return def
+	}
+	return extraBool(extra, key)
+}
+
+// extraIntDefault 读取整数配置（JSON 数字或数字字符串），未配置或无效时返回默认值
+func extraIntDefault(extra map[string]interface{}, key string, def int) int {
+	switch v := extra[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// ExtraConfigBool 读取 Provider extra_config 中的布尔开关，未配置时返回 false
+func ExtraConfigBool(cfg *model.ProviderConfig, key string) bool {
+	return extraBool(parseExtraConfig(cfg), key)
+}
+
+// ExtraConfigInt 读取 Provider extra_config 中的整数配置，未配置时返回 0
+func ExtraConfigInt(cfg *model.ProviderConfig, key string) int {
+	return extraIntDefault(parseExtraConfig(cfg), key, 0)
+}
+
+// ExtraConfigFloat 读取 Provider extra_config 中的数值配置（JSON 数字或数字字符串），未配置时返回 0
+func ExtraConfigFloat(cfg *model.ProviderConfig, key string) float64 {
+	switch v := parseExtraConfig(cfg)[key].(type) {
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// Registry 用于管理通过 Register 注册的 Provider；从数据库加载的配置保存在 lazyProviders 中，
+// 首次 GetProvider 时才创建客户端
 var (
-	Registry   = make(map[string]Provider)
-	registryMu sync.RWMutex
-	initMu     sync.Mutex // 确保 InitProviders 不会被并发调用
+	Registry      = make(map[string]Provider)
+	lazyProviders = make(map[string]*lazyProvider)
+	registryMu    sync.RWMutex
+	initMu        sync.Mutex // 确保 InitProviders 不会被并发调用
+
+	defaultChatProviders = []string{"openai-chat", "gemini-chat", "anthropic-chat", "deepseek-chat"}
+
+	// chatProviderSeeds 对话配置首次创建时预填的地址与模型
+	chatProviderSeeds = map[string]model.ProviderConfig{
+		"anthropic-chat": {
+			DisplayName: "Anthropic Claude",
+			APIBase:     defaultAnthropicBaseURL,
+			Models:      `[{"id":"claude-3-5-sonnet-latest","name":"Claude 3.5 Sonnet","default":true,"capabilities":["vision"]},{"id":"claude-3-5-haiku-latest","name":"Claude 3.5 Haiku","capabilities":["chat"]}]`,
+		},
+		"deepseek-chat": {
+			DisplayName: "DeepSeek",
+			APIBase:     "https://api.deepseek.com",
+			Models:      `[{"id":"deepseek-chat","name":"DeepSeek V3","default":true,"capabilities":["chat"]},{"id":"deepseek-reasoner","name":"DeepSeek R1","capabilities":["chat"]}]`,
+		},
+	}
 )
 
 func defaultTimeoutSeconds(providerName string) int {
@@ -44,11 +197,17 @@ func Register(p Provider) {
 	Registry[p.Name()] = p
 }
 
-// GetProvider 获取一个 Provider
+// GetProvider 获取一个 Provider；已启用但尚未使用的 Provider 在此时创建客户端，
+// 未配置、未启用或初始化失败时返回 nil，原因可通过 UnavailableError 获取
 func GetProvider(name string) Provider {
 	registryMu.RLock()
-	defer registryMu.RUnlock()
-	return Registry[name]
+	p, entry := Registry[name], lazyProviders[name]
+	registryMu.RUnlock()
+	if p != nil || entry == nil {
+		return p
+	}
+	p, _ = entry.get()
+	return p
 }
 
 // InitProviders 从数据库初始化所有已启用的 Provider
@@ -71,8 +230,26 @@ func InitProviders() error {
 		}
 	}
 
+	// 提示词优化等对话功能使用的配置，未填写 API Key 前保持禁用
+	for _, name := range defaultChatProviders {
+		var count int64
+		model.DB.Unscoped().Model(&model.ProviderConfig{}).Where("provider_name = ?", name).Count(&count)
+		if count == 0 {
+			cfg := chatProviderSeeds[name]
+			cfg.ProviderName = name
+			cfg.TimeoutSeconds = defaultTimeoutSeconds(name)
+			if cfg.DisplayName == "" {
+				cfg.DisplayName = name
+			}
+			// Enabled 带有 default:true，零值需单独更新
+			if err := model.DB.Create(&cfg).Error; err == nil {
+				model.DB.Model(&cfg).Update("enabled", false)
+			}
+		}
+	}
+
 	// 1. 将配置文件中的配置同步到数据库（如果不存在）
-	for name, cfg := range config.GlobalConfig.Providers {
+	for name, cfg := range config.Get().Providers {
 		if !cfg.Enabled {
 			continue
 		}
@@ -93,52 +270,57 @@ func InitProviders() error {
 		}
 	}
 
-	// 2. 查询数据库中所有已启用的配置
+	// 2. 查询数据库中的全部配置，未启用的配置只记录状态
 	var finalConfigs []model.ProviderConfig
-	if err := model.DB.Where("enabled = ?", true).Find(&finalConfigs).Error; err != nil {
-		log.Printf("查询已启用 Provider 配置失败: %v", err)
+	if err := model.DB.Find(&finalConfigs).Error; err != nil {
+		log.Printf("查询 Provider 配置失败: %v", err)
 		return err
 	}
 
-	// 3. 重建 Registry
-	newRegistry := make(map[string]Provider)
+	// 3. 重建 Registry：只登记配置，客户端在首次使用时创建，避免启动被无人使用的 Provider 拖慢
+	newLazy := make(map[string]*lazyProvider)
+	enabled := 0
 	for _, cfg := range finalConfigs {
-		if cfg.TimeoutSeconds <= 0 {
-			cfg.TimeoutSeconds = defaultTimeoutSeconds(cfg.ProviderName)
-			if err := model.DB.Model(&cfg).Update("timeout_seconds", cfg.TimeoutSeconds).Error; err != nil {
-				log.Printf("修复 Provider %s 超时配置失败: %v", cfg.ProviderName, err)
+		if !cfg.Enabled {
+			// 对话配置由 API 层按需创建客户端，不注册为生图 Provider
+			if PurposeForProvider(cfg.ProviderName) != PurposeChat {
+				fixTimeoutSeconds(&cfg)
+				newLazy[cfg.ProviderName] = &lazyProvider{cfg: cfg, disabled: true}
 			}
-		}
-
-		var p Provider
-		var err error
-
-		switch cfg.ProviderName {
-		case "gemini":
-			p, err = NewGeminiProvider(&cfg)
-		case "openai":
-			p, err = NewOpenAIProvider(&cfg)
-		default:
-			log.Printf("未知的 Provider 类型: %s", cfg.ProviderName)
 			continue
 		}
+		fixTimeoutSeconds(&cfg)
 
-		if err != nil {
-			log.Printf("初始化 Provider %s 失败: %v", cfg.ProviderName, err)
-			// 这里我们选择记录错误并继续，但也可以选择返回错误
-			// 为了让用户知道配置有问题，我们这里记录但不中断
+		// 对话配置由 API 层按需创建客户端，不注册为生图 Provider
+		if PurposeForProvider(cfg.ProviderName) == PurposeChat {
 			continue
 		}
-
-		newRegistry[cfg.ProviderName] = p
-		log.Printf("Provider %s 已加载 (BaseURL: %s)", cfg.ProviderName, cfg.APIBase)
+		newLazy[cfg.ProviderName] = &lazyProvider{cfg: cfg}
+		enabled++
 	}
 
-	// 4. 原子替换 Registry
+	// 4. 原子替换 Registry（通过 Register 注册的 Provider 不来自数据库，保持不变）
 	registryMu.Lock()
-	Registry = newRegistry
+	oldLazy := lazyProviders
+	lazyProviders = newLazy
 	registryMu.Unlock()
 
-	log.Printf("所有 Provider 已重新加载，当前生效数量: %d", len(newRegistry))
+	// 旧客户端在在途调用结束后释放
+	for _, entry := range oldLazy {
+		entry.retire()
+	}
+
+	log.Printf("所有 Provider 已重新加载，已启用数量: %d（首次使用时初始化）", enabled)
 	return nil
 }
+
+// fixTimeoutSeconds 超时未配置时写入按 Provider 区分的默认值
+func fixTimeoutSeconds(cfg *model.ProviderConfig) {
+	if cfg.TimeoutSeconds > 0 {
+		return
+	}
+	cfg.TimeoutSeconds = defaultTimeoutSeconds(cfg.ProviderName)
+	if err := model.DB.Model(cfg).Update("timeout_seconds", cfg.TimeoutSeconds).Error; err != nil {
+		log.Printf("修复 Provider %s 超时配置失败: %v", cfg.ProviderName, err)
+	}
+}
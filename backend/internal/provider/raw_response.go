@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// RawResponseError 附带上游原始响应（已脱敏）的错误，任务失败时由 Worker 保存到 debug_response，
+// 用于排查中转接口返回了无法解析的内容等问题
+type RawResponseError struct {
+	Err  error
+	Body string
+}
+
+func (e *RawResponseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RawResponseError) Unwrap() error {
+	return e.Err
+}
+
+// WithRawResponse 为错误附加上游响应体：图片数据替换为大小占位，密钥字段隐藏，超过 64KB 的部分截断
+func WithRawResponse(err error, body []byte) error {
+	if err == nil || len(body) == 0 {
+		return err
+	}
+	text, _ := (&debugTransport{}).sanitizeBody("application/json", body)
+	if text == "" {
+		return err
+	}
+	return &RawResponseError{Err: err, Body: text}
+}
+
+// withJSONResponse 序列化 SDK 返回的响应结构后附加到错误上，序列化失败时原样返回
+func withJSONResponse(err error, resp interface{}) error {
+	data, marshalErr := json.Marshal(resp)
+	if marshalErr != nil {
+		return err
+	}
+	return WithRawResponse(err, data)
+}
+
+// RawResponse 取出错误链上附带的上游响应，没有时返回空字符串
+func RawResponse(err error) string {
+	var rawErr *RawResponseError
+	if errors.As(err, &rawErr) {
+		return rawErr.Body
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// initRetryInterval 初始化失败后，在该时间内再次使用直接返回上次的错误，避免每个请求都重复构建客户端
+const initRetryInterval = 30 * time.Second
+
+// errProviderRetired 配置重新加载后旧条目不再分配给新的调用方
+var errProviderRetired = errors.New("provider retired")
+
+// idleCloser 持有独立连接池的 Provider，配置替换且在途请求结束后释放空闲连接
+type idleCloser interface {
+	CloseIdleConnections()
+}
+
+// lazyProvider 从数据库加载的 Provider 配置，首次使用时才创建客户端。
+// 配置重新加载时旧条目被标记为 retired，等在途调用全部 release 后再释放客户端资源
+type lazyProvider struct {
+	cfg model.ProviderConfig
+	// disabled 配置未启用：不再接受新任务（get 返回 nil），但停用前已排队的任务
+	// 仍可通过 acquire 获取客户端执行完毕
+	disabled bool
+
+	mu       sync.Mutex
+	p        Provider
+	err      error
+	triedAt  time.Time
+	inflight int
+	retired  bool
+}
+
+// get 返回已创建的客户端，尚未创建或上次失败已超过重试间隔时重新创建
+func (l *lazyProvider) get() (Provider, error) {
+	if l.disabled {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.getLocked()
+}
+
+func (l *lazyProvider) getLocked() (Provider, error) {
+	if l.p != nil {
+		return l.p, nil
+	}
+	if l.err != nil && time.Since(l.triedAt) < initRetryInterval {
+		return nil, l.err
+	}
+
+	// 每次创建使用配置副本，避免失败的尝试残留对配置的修改
+	cfg := l.cfg
+	p, err := newImageProvider(&cfg)
+	l.triedAt = time.Now()
+	if err != nil {
+		log.Printf("初始化 Provider %s 失败: %v", cfg.ProviderName, err)
+		l.err = err
+		return nil, err
+	}
+	log.Printf("Provider %s 已加载 (BaseURL: %s)", cfg.ProviderName, cfg.APIBase)
+	l.p, l.err = p, nil
+	return p, nil
+}
+
+// acquire 获取客户端并登记一次在途调用，条目已被替换时返回 errProviderRetired。
+// 未启用的条目同样可以获取，用于执行停用前已排队的任务
+func (l *lazyProvider) acquire() (Provider, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.retired {
+		return nil, errProviderRetired
+	}
+	p, err := l.getLocked()
+	if p != nil {
+		l.inflight++
+	}
+	return p, err
+}
+
+func (l *lazyProvider) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.retired && l.inflight == 0 {
+		l.closeLocked()
+	}
+}
+
+// retire 标记条目已被新配置替换，没有在途调用时立即释放客户端
+func (l *lazyProvider) retire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retired = true
+	if l.inflight == 0 {
+		l.closeLocked()
+	}
+}
+
+func (l *lazyProvider) closeLocked() {
+	if c, ok := l.p.(idleCloser); ok {
+		c.CloseIdleConnections()
+		log.Printf("Provider %s 旧客户端已释放", l.cfg.ProviderName)
+	}
+}
+
+func (l *lazyProvider) status() InitStatus {
+	if l.disabled {
+		return InitStatus{Status: InitStatusDisabled}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.p != nil:
+		triedAt := l.triedAt
+		return InitStatus{Status: InitStatusOK, InitializedAt: &triedAt}
+	case l.err != nil:
+		return InitStatus{Status: InitStatusError, Error: l.err.Error()}
+	default:
+		return InitStatus{Status: InitStatusPending}
+	}
+}
+
+// AcquireProvider 与 GetProvider 相同，但在调用 release 之前，即使配置被重新加载，
+// 返回的客户端也不会被释放。供 Worker 执行已排队的任务使用，因此未启用的 Provider 也会返回客户端，
+// 停用只拒绝新提交而不影响已排队的任务。Provider 不可用时返回 nil 和空操作的 release
+func AcquireProvider(name string) (Provider, func()) {
+	for {
+		registryMu.RLock()
+		p, entry := Registry[name], lazyProviders[name]
+		registryMu.RUnlock()
+		if p != nil || entry == nil {
+			return p, func() {}
+		}
+		p, err := entry.acquire()
+		if errors.Is(err, errProviderRetired) {
+			// 读取条目后恰好发生了重新加载，改用新条目
+			continue
+		}
+		if p == nil {
+			return nil, func() {}
+		}
+		var once sync.Once
+		return p, func() { once.Do(entry.release) }
+	}
+}
+
+// ReloadProvider 只重新加载指定 Provider 的配置并原子替换其注册表条目，其他 Provider 不受影响；
+// 旧客户端在在途调用结束后释放
+func ReloadProvider(name string) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	// 对话配置由 API 层按需创建客户端，不注册为生图 Provider
+	if PurposeForProvider(name) == PurposeChat {
+		return nil
+	}
+
+	var cfg model.ProviderConfig
+	var entry *lazyProvider
+	err := model.DB.Where("provider_name = ?", name).First(&cfg).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// 配置已删除，移除条目
+	case err != nil:
+		return fmt.Errorf("查询 Provider %s 配置失败: %w", name, err)
+	default:
+		fixTimeoutSeconds(&cfg)
+		entry = &lazyProvider{cfg: cfg, disabled: !cfg.Enabled}
+	}
+
+	registryMu.Lock()
+	old := lazyProviders[name]
+	if entry != nil {
+		lazyProviders[name] = entry
+	} else {
+		delete(lazyProviders, name)
+	}
+	registryMu.Unlock()
+
+	if old != nil {
+		old.retire()
+	}
+	log.Printf("Provider %s 配置已重新加载", name)
+	return nil
+}
+
+// newImageProvider 按 Provider 名称创建生图客户端
+func newImageProvider(cfg *model.ProviderConfig) (Provider, error) {
+	if err := validateAPIBase(cfg.APIBase); err != nil {
+		return nil, err
+	}
+	switch cfg.ProviderName {
+	case "gemini":
+		return NewGeminiProvider(cfg)
+	case "openai":
+		return NewOpenAIProvider(cfg)
+	case "rembg", "removebg":
+		return NewBackgroundRemovalProvider(cfg)
+	default:
+		return nil, fmt.Errorf("未知的 Provider 类型: %s", cfg.ProviderName)
+	}
+}
+
+// validateAPIBase 校验 api_base 为带主机名的 http(s) 地址，留空表示使用默认地址
+func validateAPIBase(apiBase string) error {
+	apiBase = strings.TrimSpace(apiBase)
+	if apiBase == "" {
+		return nil
+	}
+	u, err := url.Parse(apiBase)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("api_base 格式无效，需以 http:// 或 https:// 开头: %s", apiBase)
+	}
+	return nil
+}
+
+// newProviderTransport 为每个客户端复制一份默认 Transport，使其拥有独立的连接池，
+// 配置替换后可以单独释放而不影响其他客户端
+func newProviderTransport() *http.Transport {
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
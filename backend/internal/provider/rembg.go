@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image-gen-service/internal/model"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// BackgroundRemovalProvider 调用外部抠图服务，输出带透明通道的 PNG
+// 支持两种接口风格：
+//   - removebg: remove.bg 兼容接口（POST /v1.0/removebg，字段 image_file，X-Api-Key 鉴权）
+//   - rembg:    自建 rembg HTTP 服务（POST /api/remove，字段 file）
+type BackgroundRemovalProvider struct {
+	config     *model.ProviderConfig
+	httpClient *http.Client
+	name       string
+	endpoint   string
+	fileField  string
+}
+
+func NewBackgroundRemovalProvider(config *model.ProviderConfig) (*BackgroundRemovalProvider, error) {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 150 * time.Second
+	}
+
+	apiBase := strings.TrimRight(strings.TrimSpace(config.APIBase), "/")
+	p := &BackgroundRemovalProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: timeout, Transport: wrapDebugTransport(config, newProviderTransport())},
+		name:       config.ProviderName,
+	}
+	switch config.ProviderName {
+	case "removebg":
+		if apiBase == "" {
+			apiBase = "https://api.remove.bg"
+		}
+		p.endpoint = apiBase + "/v1.0/removebg"
+		p.fileField = "image_file"
+	default:
+		if apiBase == "" {
+			return nil, fmt.Errorf("rembg 服务地址 (api_base) 未配置")
+		}
+		p.endpoint = apiBase + "/api/remove"
+		p.fileField = "file"
+	}
+	if path := strings.TrimSpace(extraString(parseExtraConfig(config), "endpoint_path")); path != "" {
+		p.endpoint = apiBase + "/" + strings.TrimLeft(path, "/")
+	}
+	return p, nil
+}
+
+func (p *BackgroundRemovalProvider) Name() string {
+	return p.name
+}
+
+// CloseIdleConnections 配置被替换后释放连接池中的空闲连接
+func (p *BackgroundRemovalProvider) CloseIdleConnections() {
+	p.httpClient.CloseIdleConnections()
+}
+
+func (p *BackgroundRemovalProvider) ValidateParams(params map[string]interface{}) error {
+	verr := &ValidationError{}
+	if sourcePath, _ := params["source_path"].(string); sourcePath == "" {
+		verr.Add("source_path", "缺少待处理图片 (source_path)", nil, nil)
+	}
+	return verr.Err()
+}
+
+func (p *BackgroundRemovalProvider) Generate(ctx context.Context, params map[string]interface{}) (*ProviderResult, error) {
+	sourcePath, _ := params["source_path"].(string)
+	if sourcePath == "" {
+		return nil, fmt.Errorf("缺少待处理图片 (source_path)")
+	}
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %w", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(p.fileField, "image")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if p.name == "removebg" {
+		_ = writer.WriteField("size", "auto")
+		_ = writer.WriteField("format", "png")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if key := strings.TrimSpace(p.config.APIKey); key != "" {
+		req.Header.Set("X-Api-Key", key)
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	log.Printf("[%s] 开始抠图, Endpoint: %s, Size: %d bytes\n", p.name, p.endpoint, len(data))
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("抠图请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取抠图结果失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &upstreamError{
+			message:    fmt.Sprintf("抠图请求失败: %s %s", resp.Status, parseOpenAIError(respBytes)),
+			statusCode: resp.StatusCode,
+			header:     resp.Header,
+		}
+	}
+	if !bytes.HasPrefix(respBytes, []byte("\x89PNG\r\n\x1a\n")) {
+		return nil, fmt.Errorf("抠图服务未返回 PNG 图片")
+	}
+
+	return &ProviderResult{
+		Images: [][]byte{respBytes},
+		Metadata: map[string]interface{}{
+			"provider": p.name,
+			"type":     "remove-background",
+		},
+	}, nil
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+
+	"image-gen-service/pkg/apitypes"
+)
+
+// FieldError 单个参数的校验失败信息，Allowed 仅在参数取值为固定枚举时给出
+type FieldError = apitypes.FieldError
+
+// ValidationError 参数校验失败，汇总全部不合法的字段，便于前端逐项标注
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "；")
+}
+
+// Add 记录一个字段的校验失败
+func (e *ValidationError) Add(field, message string, allowed []string, got interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message, Allowed: allowed, Got: got})
+}
+
+// Err 没有任何校验失败时返回 nil，避免返回类型化的 nil 指针
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// JoinValidationErrors 合并多个校验步骤的结果；非 ValidationError 的错误作为无字段名的一项保留
+func JoinValidationErrors(errs ...error) error {
+	joined := &ValidationError{}
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			joined.Errors = append(joined.Errors, ve.Errors...)
+			continue
+		}
+		joined.Add("", err.Error(), nil, nil)
+	}
+	return joined.Err()
+}
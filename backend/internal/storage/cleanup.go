@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cleanupGracePeriod 只清理早于该时间的文件，避免与正在写入的文件竞争
+	cleanupGracePeriod = time.Hour
+	// cleanupInterval 定期清理的间隔
+	cleanupInterval = 6 * time.Hour
+)
+
+// CleanupStats 临时文件清理统计
+type CleanupStats struct {
+	LastRunAt        *time.Time `json:"last_run_at"`
+	TempFiles        int        `json:"temp_files"`
+	OrphanThumbnails int        `json:"orphan_thumbnails"`
+	EmptyDirs        int        `json:"empty_dirs"`
+	ReclaimedBytes   int64      `json:"reclaimed_bytes"`
+	TotalReclaimed   int64      `json:"total_reclaimed_bytes"`
+	Failed           int        `json:"failed"`
+	TotalSweeps      int        `json:"total_sweeps"`
+	LastError        string     `json:"last_error,omitempty"`
+}
+
+var (
+	cleanupMu    sync.Mutex
+	cleanupStats CleanupStats
+)
+
+// GetCleanupStats 返回最近一次清理的统计
+func GetCleanupStats() CleanupStats {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	return cleanupStats
+}
+
+// StartCleanup 启动时清理一次，之后定期清理本地存储目录
+func StartCleanup() {
+	go func() {
+		SweepLocalDir()
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			SweepLocalDir()
+		}
+	}()
+}
+
+// SweepLocalDir 清理当前本地存储目录中的残留文件：
+// 超过宽限期的 *.tmp 临时文件、原图已不存在的旧版 thumb_ 缩略图、不再被任何任务引用的哈希缩略图，以及空的子目录
+func SweepLocalDir() CleanupStats {
+	dir := LocalDir()
+	now := time.Now()
+	result := CleanupStats{LastRunAt: &now}
+	if dir != "" {
+		var refs map[string]bool
+		if ThumbnailRefs != nil {
+			var err error
+			if refs, err = ThumbnailRefs(); err != nil {
+				log.Printf("[Storage] 查询缩略图引用失败，本次跳过哈希缩略图: %v", err)
+				refs = nil
+			}
+		}
+		if err := sweepDir(dir, now.Add(-cleanupGracePeriod), refs, &result); err != nil && !os.IsNotExist(err) {
+			result.LastError = err.Error()
+		}
+	}
+
+	cleanupMu.Lock()
+	result.TotalReclaimed = cleanupStats.TotalReclaimed + result.ReclaimedBytes
+	result.TotalSweeps = cleanupStats.TotalSweeps + 1
+	cleanupStats = result
+	cleanupMu.Unlock()
+
+	if result.TempFiles+result.OrphanThumbnails+result.EmptyDirs > 0 || result.LastError != "" {
+		log.Printf("[Storage] 清理完成: 临时文件 %d, 孤立缩略图 %d, 空目录 %d, 回收 %d 字节, 失败 %d",
+			result.TempFiles, result.OrphanThumbnails, result.EmptyDirs, result.ReclaimedBytes, result.Failed)
+	}
+	return result
+}
+
+// sweepDir refs 为仍被引用的哈希缩略图文件名，为 nil 时不清理哈希缩略图
+func sweepDir(root string, cutoff time.Time, refs map[string]bool, result *CleanupStats) error {
+	var dirs []string
+	var thumbs []string
+	originals := make(map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			// 不进入隐藏目录
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		}
+		name := d.Name()
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		switch {
+		case isTempFile(name):
+			if info.ModTime().Before(cutoff) {
+				removeSwept(path, info.Size(), &result.TempFiles, result)
+			}
+		case strings.HasPrefix(name, "thumb_"):
+			if info.ModTime().Before(cutoff) {
+				thumbs = append(thumbs, path)
+			}
+		default:
+			originals[originalKey(filepath.Dir(path), name)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 旧版缩略图后缀可能与原图不同，按去掉后缀的文件名匹配；哈希缩略图按任务引用判断
+	for _, thumb := range thumbs {
+		if IsHashedThumbnail(thumb) {
+			if refs == nil || refs[filepath.Base(thumb)] {
+				continue
+			}
+		} else if name := strings.TrimPrefix(filepath.Base(thumb), "thumb_"); originals[originalKey(filepath.Dir(thumb), name)] {
+			continue
+		}
+		info, err := os.Stat(thumb)
+		if err != nil {
+			continue
+		}
+		removeSwept(thumb, info.Size(), &result.OrphanThumbnails, result)
+	}
+
+	// 先处理更深的目录，使逐层变空的目录也能被清理
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			result.Failed++
+			continue
+		}
+		result.EmptyDirs++
+	}
+	return nil
+}
+
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, ".write-test-")
+}
+
+func originalKey(dir, name string) string {
+	return filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+func removeSwept(path string, size int64, counter *int, result *CleanupStats) {
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Storage] 清理 %s 失败: %v", path, err)
+			result.Failed++
+		}
+		return
+	}
+	*counter++
+	result.ReclaimedBytes += size
+}
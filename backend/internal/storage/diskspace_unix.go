@@ -0,0 +1,14 @@
+//go:build !windows
+
+package storage
+
+import "syscall"
+
+// FreeSpace 返回目录所在磁盘对当前用户可用的剩余空间（字节）
+func FreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package storage
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace 返回目录所在磁盘对当前用户可用的剩余空间（字节）
+func FreeSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
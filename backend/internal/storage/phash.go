@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// DHash 计算图片的 64 位差异哈希（dHash）：缩放为 9x8 灰度图后比较相邻像素亮度。
+// 对缩放、轻微裁剪与重新编码不敏感，适合查找近似重复的图片
+func DHash(img image.Image) uint64 {
+	small := imaging.Resize(img, 9, 8, imaging.Box)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luminance(small, x, y) < luminance(small, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func luminance(img *image.NRGBA, x, y int) uint32 {
+	c := img.NRGBAAt(x, y)
+	return (299*uint32(c.R) + 587*uint32(c.G) + 114*uint32(c.B)) / 1000
+}
+
+// FormatPerceptualHash 将哈希格式化为 16 位十六进制字符串，便于存储
+func FormatPerceptualHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParsePerceptualHash 解析 FormatPerceptualHash 生成的字符串
+func ParsePerceptualHash(value string) (uint64, bool) {
+	if len(value) != 16 {
+		return 0, false
+	}
+	hash, err := strconv.ParseUint(value, 16, 64)
+	return hash, err == nil
+}
+
+// HammingDistance 两个哈希不同的位数，0 表示视觉上几乎一致
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PerceptualHashFile 读取并解码本地图片后计算哈希，用于为旧图片回填
+func PerceptualHashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("解码图片失败: %w", err)
+	}
+	return FormatPerceptualHash(DHash(img)), nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// 对外地址改写：OSS 前面挂了 CDN 或更换了访问域名时，接口返回的地址按 storage.public_url_prefix 改写，
+// 数据库中仍保存原始地址，更换域名无需迁移数据
+var (
+	publicURLMu     sync.RWMutex
+	publicURLPrefix string
+	publicURLHosts  []string
+)
+
+// SetPublicURL 设置对外地址前缀（如 https://cdn.example.com 或 https://cdn.example.com/images），
+// hosts 为需要改写的原始域名（OSS 访问域名、Bucket 默认域名等）；prefix 为空时不改写
+func SetPublicURL(prefix string, hosts ...string) {
+	publicURLMu.Lock()
+	defer publicURLMu.Unlock()
+	publicURLPrefix = strings.TrimRight(strings.TrimSpace(prefix), "/")
+	publicURLHosts = publicURLHosts[:0]
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host != "" {
+			publicURLHosts = append(publicURLHosts, host)
+		}
+	}
+}
+
+// PublicURL 把原始域名下的地址改写为对外地址前缀 + 原路径；已使用新前缀、域名不匹配或未配置前缀时原样返回
+func PublicURL(rawURL string) string {
+	publicURLMu.RLock()
+	prefix, hosts := publicURLPrefix, publicURLHosts
+	publicURLMu.RUnlock()
+	if prefix == "" || rawURL == "" || hasPublicPrefix(rawURL, prefix) {
+		return rawURL
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !matchesHost(u.Host, hosts) {
+		return rawURL
+	}
+	rewritten := prefix + u.EscapedPath()
+	if u.RawQuery != "" {
+		rewritten += "?" + u.RawQuery
+	}
+	return rewritten
+}
+
+// publicURLPath 地址使用对外地址前缀时返回前缀之后的路径（不含开头的 /）
+func publicURLPath(rawURL string) (string, bool) {
+	publicURLMu.RLock()
+	prefix := publicURLPrefix
+	publicURLMu.RUnlock()
+	if prefix == "" || !hasPublicPrefix(rawURL, prefix) {
+		return "", false
+	}
+	u, err := url.Parse(strings.TrimPrefix(rawURL, prefix))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimPrefix(u.Path, "/"), true
+}
+
+func hasPublicPrefix(rawURL, prefix string) bool {
+	return strings.HasPrefix(rawURL, prefix+"/")
+}
+
+func matchesHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+// RefsDir 参考图保存在存储目录下的子目录，按内容哈希命名，多个任务共用同一份文件
+const RefsDir = "refs"
+
+// ReferenceFiles 保存参考图的结果，路径均相对于存储目录，未保存时为空
+type ReferenceFiles struct {
+	Path          string
+	ThumbnailPath string
+	Width         int
+	Height        int
+}
+
+// SaveReference 保存参考图原图与缩略图；thumbnailOnly 时只保存缩略图。
+// 缩略图命名为 <hash>_thumb.jpg，避免被清理任务当作缺少原图的孤立缩略图
+func SaveReference(data []byte, hash string, thumbnailOnly bool) (ReferenceFiles, error) {
+	var files ReferenceFiles
+	baseDir := LocalDir()
+	if baseDir == "" {
+		return files, errors.New("未启用本地存储")
+	}
+	dir := filepath.Join(baseDir, RefsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return files, fmt.Errorf("创建参考图目录失败: %w", err)
+	}
+
+	if !thumbnailOnly {
+		// 无法识别的格式（如 BMP）只保存缩略图
+		if format, err := detectImageFormat(data); err == nil {
+			name := hash + formatToExt(format)
+			if err := writeFileIfMissing(filepath.Join(dir, name), data); err != nil {
+				return files, fmt.Errorf("保存参考图失败: %w", err)
+			}
+			files.Path = filepath.ToSlash(filepath.Join(RefsDir, name))
+		}
+	}
+
+	srcImg, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[Storage] 警告: 解码参考图失败，无法生成缩略图: %v", err)
+		return files, nil
+	}
+	files.Width = srcImg.Bounds().Dx()
+	files.Height = srcImg.Bounds().Dy()
+
+	thumbName := hash + "_thumb.jpg"
+	thumbPath := filepath.Join(dir, thumbName)
+	if _, err := os.Stat(thumbPath); err != nil {
+		thumb := flattenTransparency(imaging.Thumbnail(srcImg, 256, 256, imaging.Lanczos))
+		if err := imaging.Save(thumb, thumbPath); err != nil {
+			log.Printf("[Storage] 警告: 保存参考图缩略图失败: %v", err)
+			return files, nil
+		}
+	}
+	files.ThumbnailPath = filepath.ToSlash(filepath.Join(RefsDir, thumbName))
+	return files, nil
+}
+
+// DeleteReferenceFiles 删除参考图文件，路径相对于存储目录
+func DeleteReferenceFiles(paths ...string) {
+	baseDir := LocalDir()
+	if baseDir == "" {
+		return
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(baseDir, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Storage] 删除参考图 %s 失败: %v", path, err)
+		}
+	}
+}
+
+// writeFileIfMissing 文件已存在时跳过（内容由哈希保证一致），否则先写临时文件再重命名
+func writeFileIfMissing(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
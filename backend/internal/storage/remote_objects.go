@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const (
+	// remoteListPageSize 列举 OSS 对象时每页的数量（接口上限为 1000）
+	remoteListPageSize = 1000
+	// remotePageInterval 相邻两次列举/批量删除请求之间的最小间隔，避免短时间内大量请求 Bucket
+	remotePageInterval = 200 * time.Millisecond
+)
+
+// ErrRemoteDisabled 未配置 OSS
+var ErrRemoteDisabled = errors.New("未配置 OSS")
+
+// RemoteObject OSS 中的一个对象
+type RemoteObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+func remoteStorage() (*OSSStorage, error) {
+	c, ok := GlobalStorage.(*CompositeStorage)
+	if !ok || c.OSS == nil {
+		return nil, ErrRemoteDisabled
+	}
+	return c.OSS, nil
+}
+
+// normalizeObjectPrefix 去掉首尾空白与开头的斜杠，非空时保证以斜杠结尾
+func normalizeObjectPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// RemotePrefix 返回本服务写入 OSS 的对象键前缀
+func RemotePrefix() string {
+	s, err := remoteStorage()
+	if err != nil {
+		return ""
+	}
+	return s.Prefix
+}
+
+// RemoteObjectKey 从任务记录的 OSS 地址（或改写后的对外地址）中解析对象键；地址为空、域名不匹配或不在本服务前缀下时返回空字符串
+func RemoteObjectKey(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	s, err := remoteStorage()
+	if rawURL == "" || err != nil {
+		return ""
+	}
+	// 已通过维护任务改写为对外地址前缀的记录
+	key, ok := publicURLPath(rawURL)
+	if !ok {
+		u, err := url.Parse(rawURL)
+		if err != nil || !strings.EqualFold(u.Host, s.Domain) {
+			return ""
+		}
+		key = strings.TrimPrefix(u.Path, "/")
+	}
+	if key == "" || !strings.HasPrefix(key, s.Prefix) {
+		return ""
+	}
+	return key
+}
+
+// DeleteRemoteObject 删除单个 OSS 对象，对象不存在时同样视为成功
+func DeleteRemoteObject(key string) error {
+	s, err := remoteStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.Bucket.DeleteObject(key); err != nil {
+		return fmt.Errorf("OSS 删除失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteRemoteObjects 批量删除 OSS 对象（每次请求最多 1000 个），返回删除失败的对象键；
+// 请求本身失败时整批视为失败并返回错误
+func DeleteRemoteObjects(ctx context.Context, keys []string) ([]string, error) {
+	s, err := remoteStorage()
+	if err != nil {
+		return keys, err
+	}
+	var failed []string
+	for start := 0; start < len(keys); start += remoteListPageSize {
+		if start > 0 {
+			if err := sleepContext(ctx, remotePageInterval); err != nil {
+				return append(failed, keys[start:]...), err
+			}
+		}
+		end := min(start+remoteListPageSize, len(keys))
+		batch := keys[start:end]
+		result, err := s.Bucket.DeleteObjects(batch)
+		if err != nil {
+			return append(failed, keys[start:]...), fmt.Errorf("OSS 批量删除失败: %w", err)
+		}
+		deleted := make(map[string]bool, len(result.DeletedObjects))
+		for _, key := range result.DeletedObjects {
+			deleted[key] = true
+		}
+		for _, key := range batch {
+			if !deleted[key] {
+				failed = append(failed, key)
+			}
+		}
+	}
+	return failed, nil
+}
+
+// ListRemoteObjects 分页列举本服务前缀下的 OSS 对象，每页回调一次 fn；
+// 相邻两页之间至少间隔 remotePageInterval，ctx 取消或 fn 返回错误时停止
+func ListRemoteObjects(ctx context.Context, fn func(objects []RemoteObject) error) error {
+	s, err := remoteStorage()
+	if err != nil {
+		return err
+	}
+	token := ""
+	for page := 0; ; page++ {
+		if page > 0 {
+			if err := sleepContext(ctx, remotePageInterval); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := s.Bucket.ListObjectsV2(oss.Prefix(s.Prefix), oss.MaxKeys(remoteListPageSize), oss.ContinuationToken(token))
+		if err != nil {
+			return fmt.Errorf("列举 OSS 对象失败: %w", err)
+		}
+		objects := make([]RemoteObject, 0, len(result.Objects))
+		for _, object := range result.Objects {
+			objects = append(objects, RemoteObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+		}
+		if err := fn(objects); err != nil {
+			return err
+		}
+		if !result.IsTruncated {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
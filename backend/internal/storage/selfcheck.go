@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// selfCheckInterval 后台定期检查存储目录的间隔
+	selfCheckInterval = 30 * time.Second
+	// selfCheckMinInterval 按需检查（健康检查、不可用期间的新请求）的最小间隔，避免频繁写探测文件
+	selfCheckMinInterval = 2 * time.Second
+)
+
+// MinFreeBytes 存储目录所在磁盘的最低剩余空间，低于该值时视为存储不可用；0 表示不检查
+var MinFreeBytes uint64
+
+// Health 存储目录自检结果
+type Health struct {
+	Available    bool      `json:"available"`
+	Dir          string    `json:"dir"`
+	Reason       string    `json:"reason,omitempty"`
+	FreeBytes    uint64    `json:"free_bytes,omitempty"`
+	MinFreeBytes uint64    `json:"min_free_bytes,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+var (
+	healthMu   sync.Mutex
+	lastHealth = Health{Available: true}
+)
+
+// CheckHealth 在存储目录中写入并删除探测文件，并检查剩余空间；只读挂载、权限不足或磁盘将满时
+// 返回不可用。距上次检查不足 selfCheckMinInterval 时直接返回上次结果
+func CheckHealth() Health {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if !lastHealth.CheckedAt.IsZero() && time.Since(lastHealth.CheckedAt) < selfCheckMinInterval {
+		return lastHealth
+	}
+
+	health := checkLocalDir(LocalDir())
+	if health.Available != lastHealth.Available {
+		if health.Available {
+			log.Printf("存储目录已恢复可用: %s", health.Dir)
+		} else {
+			log.Printf("存储目录不可用，暂停接受生成任务: %s", health.Reason)
+		}
+	}
+	lastHealth = health
+	return health
+}
+
+// CurrentHealth 返回最近一次自检结果；不可用期间按需重新检查，条件恢复后无需等待定期检查
+func CurrentHealth() Health {
+	healthMu.Lock()
+	health := lastHealth
+	healthMu.Unlock()
+	if health.Available {
+		return health
+	}
+	return CheckHealth()
+}
+
+// StartSelfCheck 启动时立即检查一次，之后定期检查
+func StartSelfCheck() {
+	CheckHealth()
+	go func() {
+		ticker := time.NewTicker(selfCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			CheckHealth()
+		}
+	}()
+}
+
+func checkLocalDir(dir string) Health {
+	health := Health{Available: true, Dir: dir, MinFreeBytes: MinFreeBytes, CheckedAt: time.Now()}
+	if dir == "" {
+		return health
+	}
+	if err := probeWrite(dir); err != nil {
+		// 探测文件名每次随机，只保留底层原因，便于前端比较与展示
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		health.Available = false
+		health.Reason = fmt.Sprintf("存储目录不可写: %v", err)
+		return health
+	}
+	free, err := FreeSpace(dir)
+	if err != nil {
+		// 部分文件系统不支持查询剩余空间，写入探测已通过时不视为不可用
+		return health
+	}
+	health.FreeBytes = free
+	if MinFreeBytes > 0 && free < MinFreeBytes {
+		health.Available = false
+		health.Reason = fmt.Sprintf("存储目录所在磁盘剩余空间不足: 剩余 %d MB，至少需要 %d MB", free/1024/1024, MinFreeBytes/1024/1024)
+	}
+	return health
+}
+
+// probeWrite 写入并删除探测文件；探测文件与迁移目录时的写入检查同名，进程意外退出时由定期清理删除
+func probeWrite(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	_, writeErr := f.Write([]byte("ok"))
+	closeErr := f.Close()
+	removeErr := os.Remove(f.Name())
+	if writeErr != nil {
+		return writeErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return removeErr
+}
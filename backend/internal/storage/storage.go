@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/disintegration/imaging"
@@ -52,12 +54,28 @@ type Storage interface {
 // LocalStorage 本地存储实现
 type LocalStorage struct {
 	BaseDir string
+	// mu 保护 BaseDir，迁移存储目录时会在运行期切换
+	mu sync.RWMutex
+}
+
+// Dir 返回当前的存储目录
+func (l *LocalStorage) Dir() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.BaseDir
+}
+
+// SetDir 切换存储目录，之后保存的文件写入新目录
+func (l *LocalStorage) SetDir(dir string) {
+	l.mu.Lock()
+	l.BaseDir = dir
+	l.mu.Unlock()
 }
 
 func (l *LocalStorage) Save(name string, reader io.Reader) (string, string, error) {
 	// 使用 filepath.Base 防止路径遍历攻击
 	safeName := filepath.Base(name)
-	path := filepath.Join(l.BaseDir, safeName)
+	path := filepath.Join(l.Dir(), safeName)
 	// 确保目录存在
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -107,6 +125,27 @@ func detectImageFormat(data []byte) (string, error) {
 	return "", ErrUnknownFormat
 }
 
+// flattenTransparency 将带透明通道的缩略图合成到棋盘格背景上，使透明区域在图库中可见
+// 原图不受影响，仍保持 PNG 透明通道
+func flattenTransparency(img *image.NRGBA) *image.NRGBA {
+	if img.Opaque() {
+		return img
+	}
+	const cell = 8
+	bounds := img.Bounds()
+	light := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	dark := color.NRGBA{R: 220, G: 220, B: 220, A: 255}
+	bg := imaging.New(bounds.Dx(), bounds.Dy(), light)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if (x/cell+y/cell)%2 == 1 {
+				bg.SetNRGBA(x, y, dark)
+			}
+		}
+	}
+	return imaging.Overlay(bg, img, image.Pt(0, 0), 1.0)
+}
+
 // formatToExt 将格式名称转换为文件后缀
 func formatToExt(format string) string {
 	switch format {
@@ -124,22 +163,31 @@ func formatToExt(format string) string {
 }
 
 func (l *LocalStorage) SaveWithThumbnail(name string, reader io.Reader) (string, string, string, string, int, int, error) {
+	saved, err := l.save(name, reader)
+	if err != nil {
+		return "", "", "", "", 0, 0, err
+	}
+	return saved.LocalPath, "", saved.ThumbLocalPath, "", saved.Width, saved.Height, nil
+}
+
+// saveOriginal 校验大小与格式后原样写入原图，返回本地路径与原始字节
+func (l *LocalStorage) saveOriginal(name string, reader io.Reader) (string, []byte, error) {
 	// 1. 读取原始数据到内存（使用 LimitReader 限制大小，防止内存溢出）
 	limitedReader := io.LimitReader(reader, maxImageSize+1)
 	data, err := io.ReadAll(limitedReader)
 	if err != nil {
-		return "", "", "", "", 0, 0, fmt.Errorf("读取图片数据失败: %w", err)
+		return "", nil, fmt.Errorf("读取图片数据失败: %w", err)
 	}
 
 	// 2. 检查文件大小是否超限
 	if len(data) > maxImageSize {
-		return "", "", "", "", 0, 0, ErrImageTooLarge
+		return "", nil, ErrImageTooLarge
 	}
 
 	// 3. 检测图片格式（不再使用默认值，格式必须被识别）
 	format, err := detectImageFormat(data)
 	if err != nil {
-		return "", "", "", "", 0, 0, fmt.Errorf("检测图片格式失败: %w", err)
+		return "", nil, fmt.Errorf("检测图片格式失败: %w", err)
 	}
 	ext := formatToExt(format)
 	log.Printf("[Storage] 检测到图片格式: %s, 后缀: %s", format, ext)
@@ -149,56 +197,81 @@ func (l *LocalStorage) SaveWithThumbnail(name string, reader io.Reader) (string,
 	safeName := filepath.Base(name)
 	baseName := strings.TrimSuffix(safeName, filepath.Ext(safeName))
 	fileName := baseName + ext
-	localPath := filepath.Join(l.BaseDir, fileName)
+	baseDir := l.Dir()
+	localPath := filepath.Join(baseDir, fileName)
 
 	// 5. 确保目录存在
 	dir := filepath.Dir(localPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", "", "", "", 0, 0, fmt.Errorf("创建目录失败: %w", err)
+		return "", nil, fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	// 6. 直接保存原始字节（无损，保持原始质量）
 	if err := os.WriteFile(localPath, data, 0644); err != nil {
-		return "", "", "", "", 0, 0, fmt.Errorf("保存原图失败: %w", err)
+		return "", nil, fmt.Errorf("保存原图失败: %w", err)
 	}
 	log.Printf("[Storage] 原图已保存: %s", localPath)
 
+	return localPath, data, nil
+}
+
+// save 保存原图并生成缩略图，同时用已解码的图片计算感知哈希，避免重复解码
+func (l *LocalStorage) save(name string, reader io.Reader) (*SavedImage, error) {
+	localPath, data, err := l.saveOriginal(name, reader)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Dir(localPath)
+
 	// 7. 解码图片用于生成缩略图和获取尺寸
 	srcImg, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		// 解码失败但原图已保存，只记录警告，返回原图路径
 		log.Printf("[Storage] 警告: 解码图片失败，无法生成缩略图: %v", err)
-		return localPath, "", "", "", 0, 0, nil
+		return &SavedImage{LocalPath: localPath}, nil
 	}
 
 	// 8. 获取图片尺寸
 	width := srcImg.Bounds().Dx()
 	height := srcImg.Bounds().Dy()
+	saved := &SavedImage{
+		LocalPath:      localPath,
+		Width:          width,
+		Height:         height,
+		PerceptualHash: FormatPerceptualHash(DHash(srcImg)),
+	}
 
-	// 9. 生成 256x256 的等比例缩略图（使用相同格式）
-	thumbName := "thumb_" + fileName
-	thumbPath := filepath.Join(l.BaseDir, thumbName)
-	dstImg := imaging.Thumbnail(srcImg, 256, 256, imaging.Lanczos)
-	if err := imaging.Save(dstImg, thumbPath); err != nil {
+	// 9. 生成 256x256 的等比例缩略图，按内容哈希命名，重新生成后文件名随之变化，不会命中浏览器中的旧缓存
+	thumbData, thumbHash, thumbName, err := encodeThumbnail(srcImg)
+	if err != nil {
+		log.Printf("[Storage] 警告: 生成缩略图失败: %v", err)
+		return saved, nil
+	}
+	thumbPath := filepath.Join(baseDir, thumbName)
+	// 内容相同的缩略图可能已存在，重新写入以刷新修改时间，避免被清理任务当作过期文件
+	if err := os.WriteFile(thumbPath, thumbData, 0644); err != nil {
 		log.Printf("[Storage] 警告: 保存缩略图失败: %v", err)
 		// 缩略图失败不影响原图，继续返回
-		return localPath, "", "", "", width, height, nil
+		return saved, nil
 	}
 	log.Printf("[Storage] 缩略图已保存: %s", thumbPath)
 
-	return localPath, "", thumbPath, "", width, height, nil
+	saved.ThumbLocalPath = thumbPath
+	saved.ThumbHash = thumbHash
+	return saved, nil
 }
 
 func (l *LocalStorage) Delete(name string) error {
 	// 使用 filepath.Base 防止路径遍历攻击
 	safeName := filepath.Base(name)
-	path := filepath.Join(l.BaseDir, safeName)
+	baseDir := l.Dir()
+	path := filepath.Join(baseDir, safeName)
 	err := os.Remove(path)
 
 	// 同时尝试删除缩略图（可能后缀不同，尝试多种格式）
 	baseName := strings.TrimSuffix(safeName, filepath.Ext(safeName))
 	for _, ext := range []string{".png", ".jpg", ".gif", ".webp"} {
-		thumbPath := filepath.Join(l.BaseDir, "thumb_"+baseName+ext)
+		thumbPath := filepath.Join(baseDir, "thumb_"+baseName+ext)
 		_ = os.Remove(thumbPath)
 	}
 
@@ -209,15 +282,22 @@ func (l *LocalStorage) Delete(name string) error {
 type OSSStorage struct {
 	Bucket *oss.Bucket
 	Domain string // OSS 访问域名
+	Prefix string // 对象键前缀（如 images/），为空时直接存放在 Bucket 根目录
+}
+
+// objectKey 返回文件名对应的对象键
+func (s *OSSStorage) objectKey(name string) string {
+	return s.Prefix + name
 }
 
 func (s *OSSStorage) Save(name string, reader io.Reader) (string, string, error) {
-	err := s.Bucket.PutObject(name, reader)
+	key := s.objectKey(name)
+	err := s.Bucket.PutObject(key, reader)
 	if err != nil {
 		return "", "", fmt.Errorf("OSS 上传失败: %w", err)
 	}
 
-	url := fmt.Sprintf("https://%s/%s", s.Domain, name)
+	url := fmt.Sprintf("https://%s/%s", s.Domain, key)
 	return "", url, nil
 }
 
@@ -261,29 +341,14 @@ func (s *OSSStorage) SaveWithThumbnail(name string, reader io.Reader) (string, s
 	width := img.Bounds().Dx()
 	height := img.Bounds().Dy()
 
-	dstImg := imaging.Thumbnail(img, 256, 256, imaging.Lanczos)
-
-	// 7. 根据原图格式选择缩略图编码方式（保持格式一致）
-	buf := new(bytes.Buffer)
-	var encodeErr error
-	switch format {
-	case "jpeg":
-		encodeErr = imaging.Encode(buf, dstImg, imaging.JPEG)
-	case "gif":
-		encodeErr = imaging.Encode(buf, dstImg, imaging.GIF)
-	case "webp":
-		// imaging 不支持 webp 编码，回退到 PNG
-		encodeErr = imaging.Encode(buf, dstImg, imaging.PNG)
-	default:
-		encodeErr = imaging.Encode(buf, dstImg, imaging.PNG)
-	}
-	if encodeErr != nil {
+	// 7. 生成按内容哈希命名的 JPEG 缩略图
+	thumbData, _, thumbName, err := encodeThumbnail(img)
+	if err != nil {
 		return "", remoteURL, "", "", width, height, nil
 	}
 
-	// 8. 上传缩略图（缩略图后缀与原图一致）
-	thumbName := "thumb_" + fileName
-	_, thumbRemoteURL, err := s.Save(thumbName, buf)
+	// 8. 上传缩略图
+	_, thumbRemoteURL, err := s.Save(thumbName, bytes.NewReader(thumbData))
 	if err != nil {
 		log.Printf("[Storage] 警告: 上传缩略图到 OSS 失败: %v", err)
 		// 缩略图上传失败不影响原图，继续返回
@@ -299,14 +364,14 @@ func (s *OSSStorage) Delete(name string) error {
 	safeName := filepath.Base(name)
 
 	// 删除原图
-	if err := s.Bucket.DeleteObject(safeName); err != nil {
+	if err := s.Bucket.DeleteObject(s.objectKey(safeName)); err != nil {
 		errs = append(errs, fmt.Sprintf("删除原图失败: %v", err))
 	}
 
 	// 尝试删除各种格式的缩略图
 	baseName := strings.TrimSuffix(safeName, filepath.Ext(safeName))
 	for _, ext := range []string{".png", ".jpg", ".gif", ".webp"} {
-		if err := s.Bucket.DeleteObject("thumb_" + baseName + ext); err != nil {
+		if err := s.Bucket.DeleteObject(s.objectKey("thumb_" + baseName + ext)); err != nil {
 			// 缩略图删除失败只记录日志，不作为错误
 			log.Printf("[Storage] 删除缩略图失败: %v", err)
 		}
@@ -330,45 +395,70 @@ func (c *CompositeStorage) Save(name string, reader io.Reader) (string, string,
 }
 
 func (c *CompositeStorage) SaveWithThumbnail(name string, reader io.Reader) (string, string, string, string, int, int, error) {
-	// 1. 先保存到本地并生成缩略图
-	localPath, _, thumbLocalPath, _, width, height, err := c.Local.SaveWithThumbnail(name, reader)
+	saved, err := c.saveImage(name, reader)
 	if err != nil {
 		return "", "", "", "", 0, 0, err
 	}
+	return saved.LocalPath, saved.RemoteURL, saved.ThumbLocalPath, saved.ThumbRemoteURL, saved.Width, saved.Height, nil
+}
 
-	remoteURL := ""
-	thumbRemoteURL := ""
-	if c.OSS != nil {
-		// 2. 上传原图到 OSS（使用实际的文件名）
-		fileName := filepath.Base(localPath)
-		file, err := os.Open(localPath)
-		if err == nil {
-			defer file.Close()
-			_, remoteURL, err = c.OSS.Save(fileName, file)
-			if err != nil {
-				log.Printf("[Storage] 警告: 上传原图到 OSS 失败: %v", err)
-			}
-		} else {
-			log.Printf("[Storage] 警告: 打开本地文件失败，无法上传到 OSS: %v", err)
-		}
+// saveImage 先保存到本地并生成缩略图，再同步到 OSS；OSS 上传失败不影响本地保存
+func (c *CompositeStorage) saveImage(name string, reader io.Reader) (*SavedImage, error) {
+	saved, err := c.Local.save(name, reader)
+	if err != nil {
+		return nil, err
+	}
+	saved.RemoteSync = c.SyncRemote(saved.LocalPath, saved.ThumbLocalPath)
+	saved.RemoteURL = saved.RemoteSync.RemoteURL
+	saved.ThumbRemoteURL = saved.RemoteSync.ThumbRemoteURL
+	return saved, nil
+}
 
-		// 3. 上传缩略图到 OSS
-		if thumbLocalPath != "" {
-			thumbFileName := filepath.Base(thumbLocalPath)
-			thumbFile, err := os.Open(thumbLocalPath)
-			if err == nil {
-				defer thumbFile.Close()
-				_, thumbRemoteURL, err = c.OSS.Save(thumbFileName, thumbFile)
-				if err != nil {
-					log.Printf("[Storage] 警告: 上传缩略图到 OSS 失败: %v", err)
-				}
-			} else {
-				log.Printf("[Storage] 警告: 打开缩略图文件失败，无法上传到 OSS: %v", err)
-			}
+// SyncRemote 将本地原图与缩略图上传到 OSS，并汇总上传结果；未启用 OSS 时返回空结果
+func (c *CompositeStorage) SyncRemote(localPath, thumbLocalPath string) RemoteSync {
+	var result RemoteSync
+	if c.OSS == nil {
+		return result
+	}
+
+	var errs []string
+	var err error
+	// 1. 上传原图到 OSS（使用实际的文件名）
+	result.RemoteURL, err = c.uploadFile(localPath)
+	if err != nil {
+		log.Printf("[Storage] 警告: 上传原图到 OSS 失败: %v", err)
+		errs = append(errs, "原图: "+err.Error())
+	}
+
+	// 2. 上传缩略图到 OSS
+	if thumbLocalPath != "" {
+		result.ThumbRemoteURL, err = c.uploadFile(thumbLocalPath)
+		if err != nil {
+			log.Printf("[Storage] 警告: 上传缩略图到 OSS 失败: %v", err)
+			errs = append(errs, "缩略图: "+err.Error())
 		}
 	}
 
-	return localPath, remoteURL, thumbLocalPath, thumbRemoteURL, width, height, nil
+	switch {
+	case len(errs) == 0:
+		result.Status = RemoteSyncSynced
+	case result.RemoteURL != "" || result.ThumbRemoteURL != "":
+		result.Status = RemoteSyncPartial
+	default:
+		result.Status = RemoteSyncFailed
+	}
+	result.Error = strings.Join(errs, "; ")
+	return result
+}
+
+func (c *CompositeStorage) uploadFile(localPath string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("打开本地文件失败: %w", err)
+	}
+	defer file.Close()
+	_, remoteURL, err := c.OSS.Save(filepath.Base(localPath), file)
+	return remoteURL, err
 }
 
 func (c *CompositeStorage) Delete(name string) error {
@@ -391,6 +481,83 @@ func (c *CompositeStorage) Delete(name string) error {
 
 var GlobalStorage Storage
 
+// OSS 同步状态；未启用 OSS 时为空
+const (
+	RemoteSyncSynced  = "synced"  // 原图与缩略图均已上传
+	RemoteSyncPartial = "partial" // 部分文件上传失败
+	RemoteSyncFailed  = "failed"  // 全部上传失败，图片仅存在于本地
+)
+
+// RemoteSync 一次 OSS 同步的结果
+type RemoteSync struct {
+	Status         string
+	Error          string
+	RemoteURL      string
+	ThumbRemoteURL string
+}
+
+// SavedImage 保存图片的结果，包含 OSS 同步状态
+type SavedImage struct {
+	LocalPath      string
+	RemoteURL      string
+	ThumbLocalPath string
+	ThumbRemoteURL string
+	ThumbHash      string // 缩略图内容哈希，对应文件名 thumb_<hash>.jpg
+	Width          int
+	Height         int
+	PerceptualHash string // dHash 十六进制字符串，解码失败时为空
+	RemoteSync     RemoteSync
+	ThumbPending   bool // 只保存了原图，缩略图与感知哈希需调用 GenerateThumbnail 补齐
+}
+
+// SaveImage 保存图片并返回 OSS 同步结果，供需要记录同步状态的调用方使用
+func SaveImage(name string, reader io.Reader) (*SavedImage, error) {
+	if c, ok := GlobalStorage.(*CompositeStorage); ok {
+		return c.saveImage(name, reader)
+	}
+	localPath, remoteURL, thumbLocalPath, thumbRemoteURL, width, height, err := GlobalStorage.SaveWithThumbnail(name, reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SavedImage{
+		LocalPath:      localPath,
+		RemoteURL:      remoteURL,
+		ThumbLocalPath: thumbLocalPath,
+		ThumbRemoteURL: thumbRemoteURL,
+		Width:          width,
+		Height:         height,
+	}, nil
+}
+
+// RemoteEnabled 是否配置了 OSS
+func RemoteEnabled() bool {
+	c, ok := GlobalStorage.(*CompositeStorage)
+	return ok && c.OSS != nil
+}
+
+// RetryRemoteSync 重新上传本地文件到 OSS
+func RetryRemoteSync(localPath, thumbLocalPath string) RemoteSync {
+	if c, ok := GlobalStorage.(*CompositeStorage); ok {
+		return c.SyncRemote(localPath, thumbLocalPath)
+	}
+	return RemoteSync{}
+}
+
+// LocalDir 返回当前本地存储目录，未启用本地存储时返回空字符串
+func LocalDir() string {
+	if c, ok := GlobalStorage.(*CompositeStorage); ok && c.Local != nil {
+		return c.Local.Dir()
+	}
+	return ""
+}
+
+// SetLocalDir 切换本地存储目录
+func SetLocalDir(dir string) {
+	if c, ok := GlobalStorage.(*CompositeStorage); ok && c.Local != nil {
+		c.Local.SetDir(dir)
+	}
+}
+
 // InitStorage 初始化存储组件
 func InitStorage(localDir string, ossConfig map[string]string) {
 	local := &LocalStorage{BaseDir: localDir}
@@ -404,6 +571,7 @@ func InitStorage(localDir string, ossConfig map[string]string) {
 				ossStorage = &OSSStorage{
 					Bucket: bucket,
 					Domain: ossConfig["domain"],
+					Prefix: normalizeObjectPrefix(ossConfig["prefix"]),
 				}
 			}
 		}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/disintegration/imaging"
+)
+
+// thumbnailHashLen 缩略图文件名中内容哈希的十六进制位数
+const thumbnailHashLen = 16
+
+// hashedThumbnailPattern 按内容哈希命名的缩略图 thumb_<hash>.jpg；旧版缩略图为 thumb_<原图文件名>
+var hashedThumbnailPattern = regexp.MustCompile(`^thumb_[0-9a-f]{16}\.(jpg|webp)$`)
+
+// ThumbnailRefs 返回仍被任务引用的缩略图文件名集合，由上层注册。
+// 未注册或查询失败时，清理任务不会删除任何按哈希命名的缩略图
+var ThumbnailRefs func() (map[string]bool, error)
+
+// encodeThumbnail 生成 256x256 的等比例缩略图（透明区域铺白底）并编码为 JPEG，
+// 返回编码数据、内容哈希与文件名 thumb_<hash>.jpg。imaging 不支持 webp 编码，统一使用 JPEG
+func encodeThumbnail(src image.Image) ([]byte, string, string, error) {
+	dst := flattenTransparency(imaging.Thumbnail(src, 256, 256, imaging.Lanczos))
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, dst, imaging.JPEG); err != nil {
+		return nil, "", "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	hash := hex.EncodeToString(sum[:])[:thumbnailHashLen]
+	return buf.Bytes(), hash, "thumb_" + hash + ".jpg", nil
+}
+
+// IsHashedThumbnail 文件名是否为按内容哈希命名的缩略图，此类文件内容永不变化
+func IsHashedThumbnail(name string) bool {
+	return hashedThumbnailPattern.MatchString(filepath.Base(name))
+}
+
+// CacheControl 返回存储目录下文件的缓存头：按内容哈希命名的缩略图标记为 immutable，
+// 其他文件路径通常包含唯一 ID，同样长期缓存
+func CacheControl(path string) string {
+	if IsHashedThumbnail(path) {
+		return "public, max-age=31536000, immutable"
+	}
+	return "public, max-age=31536000"
+}
+
+// ThumbnailResult 延后生成缩略图的结果
+type ThumbnailResult struct {
+	ThumbLocalPath string
+	ThumbRemoteURL string
+	ThumbHash      string
+	Width          int
+	Height         int
+	PerceptualHash string
+	// RemoteError 缩略图上传 OSS 失败的原因，本地缩略图仍然可用
+	RemoteError string
+}
+
+// SaveOriginal 只保存原图并同步到 OSS，尺寸读取文件头得到，不解码整张图片。
+// 返回结果的 ThumbPending 为 true 时，缩略图与感知哈希需随后调用 GenerateThumbnail 补齐
+func SaveOriginal(name string, reader io.Reader) (*SavedImage, error) {
+	c, ok := GlobalStorage.(*CompositeStorage)
+	if !ok || c.Local == nil {
+		return SaveImage(name, reader)
+	}
+	localPath, data, err := c.Local.saveOriginal(name, reader)
+	if err != nil {
+		return nil, err
+	}
+	saved := &SavedImage{LocalPath: localPath, ThumbPending: true}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		saved.Width = cfg.Width
+		saved.Height = cfg.Height
+	}
+	saved.RemoteSync = c.SyncRemote(localPath, "")
+	saved.RemoteURL = saved.RemoteSync.RemoteURL
+	return saved, nil
+}
+
+// GenerateThumbnail 解码本地原图，在原图所在目录生成按内容哈希命名的缩略图并计算感知哈希；
+// 配置了 OSS 时同时上传缩略图，上传失败记录在 RemoteError 中而不作为错误返回
+func GenerateThumbnail(localPath string) (*ThumbnailResult, error) {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %w", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码原图失败: %w", err)
+	}
+	result := &ThumbnailResult{
+		Width:          img.Bounds().Dx(),
+		Height:         img.Bounds().Dy(),
+		PerceptualHash: FormatPerceptualHash(DHash(img)),
+	}
+
+	thumbData, thumbHash, thumbName, err := encodeThumbnail(img)
+	if err != nil {
+		return nil, fmt.Errorf("生成缩略图失败: %w", err)
+	}
+	thumbPath := filepath.Join(filepath.Dir(localPath), thumbName)
+	if err := os.WriteFile(thumbPath, thumbData, 0644); err != nil {
+		return nil, fmt.Errorf("保存缩略图失败: %w", err)
+	}
+	log.Printf("[Storage] 缩略图已保存: %s", thumbPath)
+	result.ThumbLocalPath = thumbPath
+	result.ThumbHash = thumbHash
+
+	if c, ok := GlobalStorage.(*CompositeStorage); ok && c.OSS != nil {
+		if result.ThumbRemoteURL, err = c.uploadFile(thumbPath); err != nil {
+			log.Printf("[Storage] 警告: 上传缩略图到 OSS 失败: %v", err)
+			result.RemoteError = "缩略图: " + err.Error()
+		}
+	}
+	return result, nil
+}
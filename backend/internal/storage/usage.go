@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// UsageCategory 某一类文件的数量与总大小
+type UsageCategory struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (u *UsageCategory) add(size int64) {
+	u.Files++
+	u.Bytes += size
+}
+
+// LocalUsage 遍历本地存储目录得到的占用统计
+type LocalUsage struct {
+	Originals  UsageCategory `json:"originals"`
+	Thumbnails UsageCategory `json:"thumbnails"`
+	References UsageCategory `json:"references"`
+	Temp       UsageCategory `json:"temp"`
+	ScannedAt  time.Time     `json:"scanned_at"`
+	Duration   int64         `json:"duration_ms"`
+}
+
+// ScanLocalUsage 遍历本地存储目录，按原图、缩略图、参考图（refs 子目录）与临时文件分类统计；
+// 未启用本地存储时返回错误
+func ScanLocalUsage() (LocalUsage, error) {
+	start := time.Now()
+	usage := LocalUsage{ScannedAt: start}
+	root := LocalDir()
+	if root == "" {
+		return usage, errors.New("未启用本地存储")
+	}
+	refsRoot := filepath.Join(root, RefsDir)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		switch {
+		case isTempFile(name):
+			usage.Temp.add(info.Size())
+		case strings.HasPrefix(path, refsRoot+string(filepath.Separator)):
+			usage.References.add(info.Size())
+		case strings.HasPrefix(name, "thumb_"):
+			usage.Thumbnails.add(info.Size())
+		default:
+			usage.Originals.add(info.Size())
+		}
+		return nil
+	})
+	usage.Duration = time.Since(start).Milliseconds()
+	return usage, err
+}
+
+// RemoteUsage OSS 中的对象统计；Truncated 表示对象过多，只统计了前 limit 个
+type RemoteUsage struct {
+	Objects   int   `json:"objects"`
+	Bytes     int64 `json:"bytes"`
+	Truncated bool  `json:"truncated"`
+}
+
+// ScanRemoteUsage 分页列举本服务前缀下的 OSS 对象并累计数量与大小，最多统计 limit 个对象；未配置 OSS 时返回 nil
+func ScanRemoteUsage(limit int) (*RemoteUsage, error) {
+	c, ok := GlobalStorage.(*CompositeStorage)
+	if !ok || c.OSS == nil {
+		return nil, nil
+	}
+	usage := &RemoteUsage{}
+	token := ""
+	for {
+		result, err := c.OSS.Bucket.ListObjectsV2(oss.Prefix(c.OSS.Prefix), oss.MaxKeys(1000), oss.ContinuationToken(token))
+		if err != nil {
+			return usage, err
+		}
+		for _, object := range result.Objects {
+			usage.Objects++
+			usage.Bytes += object.Size
+		}
+		if !result.IsTruncated {
+			return usage, nil
+		}
+		if usage.Objects >= limit {
+			usage.Truncated = true
+			return usage, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,167 @@
+// Package testutil 为测试搭建与服务进程一致的运行环境：内存 SQLite、临时存储目录、
+// 小型 Worker 池与可编排的 fake Provider，使提交 → Worker → 存储 → 推送的流程无需 API Key 即可验证。
+//
+// 数据库、存储、Worker 池与 Provider 注册表都是包级全局变量，使用 Setup 的测试不能并行执行。
+package testutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/provider/fake"
+	"image-gen-service/internal/storage"
+	"image-gen-service/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options 调整测试环境，零值即可使用
+type Options struct {
+	Workers   int         // Worker 数量，默认 2
+	QueueSize int         // 队列容量，默认 16
+	Fake      fake.Config // fake Provider 的默认行为，单个任务可通过 fake_* 参数覆盖
+	// NoPool 不创建 Worker 池，只需要数据库与存储的测试使用
+	NoPool bool
+	// Config 在默认配置的副本上调整测试需要的配置项
+	Config func(cfg *config.Config)
+}
+
+// Env 一次 Setup 创建的测试环境，测试结束时自动清理
+type Env struct {
+	StorageDir string
+	Fake       *fake.Provider
+}
+
+var configOnce sync.Once
+
+// Setup 创建测试环境：加载默认配置，打开内存数据库并迁移，存储指向临时目录，注册名为 "fake" 的 Provider 并启动 Worker 池
+func Setup(tb testing.TB, opts Options) *Env {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// 测试目录下没有配置文件，InitConfig 只会加载默认值
+	configOnce.Do(config.InitConfig)
+	dir := tb.TempDir()
+	cfg := *config.Get()
+	cfg.Storage.LocalDir = dir
+	cfg.Storage.MinFreeMB = 0
+	cfg.Database.Path = ":memory:"
+	if opts.Config != nil {
+		opts.Config(&cfg)
+	}
+	config.Set(&cfg)
+
+	if err := model.OpenDB(":memory:"); err != nil {
+		tb.Fatalf("打开测试数据库失败: %v", err)
+	}
+	db := model.DB
+	tb.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	// 在 Worker 池停止之后执行：等待后台缩略图与任务事件写完，避免写入下一个测试的数据库
+	tb.Cleanup(func() {
+		worker.WaitThumbnailsIdle(5 * time.Second)
+		worker.FlushTaskEvents()
+	})
+
+	storage.InitStorage(dir, nil)
+	storage.MinFreeBytes = 0
+	storage.ThumbnailRefs = model.ReferencedThumbnails
+
+	env := &Env{StorageDir: dir, Fake: fake.New(fake.Name, opts.Fake)}
+	provider.Register(env.Fake)
+
+	if !opts.NoPool {
+		workers, queueSize := opts.Workers, opts.QueueSize
+		if workers <= 0 {
+			workers = 2
+		}
+		if queueSize <= 0 {
+			queueSize = 16
+		}
+		worker.InitPool(workers, queueSize)
+		pool := worker.Pool
+		pool.Start()
+		worker.StartThumbnails()
+		tb.Cleanup(pool.Stop)
+	}
+	return env
+}
+
+// SetConfig 在当前配置的副本上修改并替换，用于测试中途调整配置
+func SetConfig(fn func(cfg *config.Config)) {
+	cfg := *config.Get()
+	fn(&cfg)
+	config.Set(&cfg)
+}
+
+// CreateTask 直接写入一条任务记录，未设置的字段使用已完成任务的默认值
+func CreateTask(tb testing.TB, task *model.Task) *model.Task {
+	tb.Helper()
+	if task.Status == "" {
+		task.Status = "completed"
+	}
+	if task.ProviderName == "" {
+		task.ProviderName = fake.Name
+	}
+	if task.TotalCount == 0 {
+		task.TotalCount = 1
+	}
+	if err := model.DB.Create(task).Error; err != nil {
+		tb.Fatalf("写入任务失败: %v", err)
+	}
+	return task
+}
+
+// PNG 生成指定尺寸的纯色 PNG
+func PNG(tb testing.TB, width, height int) []byte {
+	tb.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 200, G: uint8(x % 256), B: 80, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		tb.Fatalf("编码 PNG 失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// WaitTask 等待任务满足 done，超时后测试失败并返回最后一次读取的记录
+func WaitTask(tb testing.TB, taskID string, timeout time.Duration, done func(task *model.Task) bool) *model.Task {
+	tb.Helper()
+	deadline := time.Now().Add(timeout)
+	var task model.Task
+	for {
+		err := model.DB.Where("task_id = ?", taskID).First(&task).Error
+		if err == nil && done(&task) {
+			return &task
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("等待任务 %s 超时，当前状态 %q (%s)", taskID, task.Status, task.ErrorMessage)
+			return &task
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Settled 任务已结束且缩略图不再等待生成
+func Settled(task *model.Task) bool {
+	switch task.Status {
+	case "completed", "imported", "failed":
+		return task.ThumbStatus != model.ThumbnailPending
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"image-gen-service/internal/config"
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+	"image-gen-service/internal/storage"
+
+	"github.com/disintegration/imaging"
+)
+
+// aspectCheck 生成结果与请求宽高比的比对结果
+type aspectCheck struct {
+	Requested string  // 请求的比例，如 16:9
+	Expected  float64 // 请求比例对应的宽/高
+	Actual    float64 // 实际宽/高
+	Width     int
+	Height    int
+	Mismatch  bool
+}
+
+// requestedAspectRatio 读取任务参数中的宽高比，未指定或为 auto 时返回 false
+func requestedAspectRatio(params map[string]interface{}) (string, float64, bool) {
+	ar, _ := params["aspect_ratio"].(string)
+	if ar == "" {
+		ar, _ = params["aspectRatio"].(string)
+	}
+	ar = strings.TrimSpace(ar)
+	ratio, ok := parseAspectRatio(ar)
+	return ar, ratio, ok
+}
+
+// parseAspectRatio 解析 "16:9" 形式的比例
+func parseAspectRatio(value string) (float64, bool) {
+	w, h, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, false
+	}
+	width, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+	if err != nil || width <= 0 {
+		return 0, false
+	}
+	height, err := strconv.ParseFloat(strings.TrimSpace(h), 64)
+	if err != nil || height <= 0 {
+		return 0, false
+	}
+	return width / height, true
+}
+
+func aspectTolerance() float64 {
+	if tolerance := config.Get().Tasks.AspectTolerance; tolerance > 0 {
+		return tolerance
+	}
+	return 0.03
+}
+
+// checkAspect 解析图片尺寸并与请求比例比对；未请求比例或无法解析图片时返回 nil
+func checkAspect(params map[string]interface{}, data []byte) *aspectCheck {
+	requested, expected, ok := requestedAspectRatio(params)
+	if !ok {
+		return nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil
+	}
+	actual := float64(cfg.Width) / float64(cfg.Height)
+	return &aspectCheck{
+		Requested: requested,
+		Expected:  expected,
+		Actual:    actual,
+		Width:     cfg.Width,
+		Height:    cfg.Height,
+		Mismatch:  math.Abs(actual/expected-1) > aspectTolerance(),
+	}
+}
+
+// aspectRetryAllowed 比例不符时是否允许重新生成一次，重试计入 Provider 的 max_retries
+func aspectRetryAllowed(providerName string) bool {
+	if !config.Get().Tasks.AspectRetry || model.DB == nil {
+		return false
+	}
+	var cfg model.ProviderConfig
+	if err := model.DB.Select("max_retries").Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
+		return false
+	}
+	return cfg.MaxRetries > 0
+}
+
+// enforceAspectCrop 任务参数 enforce_aspect 取该值时，比例不符的图片会被裁剪到请求比例
+const enforceAspectCrop = "crop"
+
+// cropAnchors 裁剪时保留的区域，对应任务参数 crop_gravity 与配置 tasks.crop_gravity
+var cropAnchors = map[string]imaging.Anchor{
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top_left":     imaging.TopLeft,
+	"top_right":    imaging.TopRight,
+	"bottom_left":  imaging.BottomLeft,
+	"bottom_right": imaging.BottomRight,
+}
+
+// cropGravityNames crop_gravity 的可选值，校验失败时返回给前端
+var cropGravityNames = []string{"center", "top", "bottom", "left", "right", "top_left", "top_right", "bottom_left", "bottom_right"}
+
+// ValidateAspectParams 校验 enforce_aspect 与 crop_gravity 参数，返回汇总全部问题的 provider.ValidationError
+func ValidateAspectParams(params map[string]interface{}) error {
+	verr := &provider.ValidationError{}
+	if raw, ok := params["enforce_aspect"]; ok && raw != nil {
+		mode, isString := raw.(string)
+		if !isString || (mode != "" && mode != enforceAspectCrop) {
+			verr.Add("enforce_aspect", fmt.Sprintf("params.enforce_aspect 仅支持 %q", enforceAspectCrop), []string{enforceAspectCrop}, raw)
+		} else if mode != "" {
+			if _, _, ok := requestedAspectRatio(params); !ok {
+				verr.Add("aspect_ratio", "params.enforce_aspect 需要同时指定 aspect_ratio", nil, nil)
+			}
+		}
+	}
+	if raw, ok := params["crop_gravity"]; ok && raw != nil {
+		gravity, isString := raw.(string)
+		if _, known := cropAnchors[strings.ToLower(strings.TrimSpace(gravity))]; !isString || !known {
+			verr.Add("crop_gravity", fmt.Sprintf("params.crop_gravity 无效: %v", raw), cropGravityNames, raw)
+		}
+	}
+	return verr.Err()
+}
+
+func enforceAspect(params map[string]interface{}) string {
+	mode, _ := params["enforce_aspect"].(string)
+	return strings.TrimSpace(mode)
+}
+
+// cropAnchor 任务参数优先，其次使用配置，默认居中
+func cropAnchor(params map[string]interface{}) imaging.Anchor {
+	gravity, _ := params["crop_gravity"].(string)
+	if anchor, ok := cropAnchors[strings.ToLower(strings.TrimSpace(gravity))]; ok {
+		return anchor
+	}
+	if anchor, ok := cropAnchors[strings.ToLower(strings.TrimSpace(config.Get().Tasks.CropGravity))]; ok {
+		return anchor
+	}
+	return imaging.Center
+}
+
+// cropToAspect 将图片裁剪到请求比例，保持原图格式，返回裁剪后的数据与尺寸
+func cropToAspect(data []byte, check *aspectCheck, anchor imaging.Anchor) ([]byte, int, int, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("解码图片失败: %w", err)
+	}
+	width, height := check.Width, check.Height
+	if check.Actual > check.Expected {
+		width = int(math.Round(float64(height) * check.Expected))
+	} else {
+		height = int(math.Round(float64(width) / check.Expected))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, 0, 0, fmt.Errorf("裁剪尺寸无效: %dx%d", width, height)
+	}
+
+	cropped := imaging.CropAnchor(img, width, height, anchor)
+	buf := new(bytes.Buffer)
+	switch format {
+	case "jpeg":
+		err = imaging.Encode(buf, cropped, imaging.JPEG, imaging.JPEGQuality(95))
+	case "gif":
+		err = imaging.Encode(buf, cropped, imaging.GIF)
+	default:
+		err = imaging.Encode(buf, cropped, imaging.PNG)
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("编码裁剪后的图片失败: %w", err)
+	}
+	return buf.Bytes(), width, height, nil
+}
+
+// saveOriginalImage 将裁剪前的原图保存为 <taskID>_original.<ext>，仅保存在本地
+func saveOriginalImage(taskID string, data []byte) (string, error) {
+	ext := ".png"
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		switch format {
+		case "jpeg":
+			ext = ".jpg"
+		case "gif":
+			ext = ".gif"
+		}
+	}
+	localPath, _, err := storage.GlobalStorage.Save(taskID+"_original"+ext, bytes.NewReader(data))
+	return localPath, err
+}
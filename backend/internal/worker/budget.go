@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+)
+
+// Provider 每日预算对应的 extra_config 配置项，未配置或为 0 时不限制
+const (
+	budgetKeyMaxRequests  = "max_requests_per_day"
+	budgetKeyMaxCost      = "max_cost_per_day"
+	budgetKeyCostPerImage = "cost_per_image"
+)
+
+// ErrBudgetExceeded 超出 Provider 每日预算，可通过 errors.Is 判断
+var ErrBudgetExceeded = errors.New("已超出 Provider 每日预算")
+
+// budgetExceededError 附带预算重置时间，同时可被识别为 ErrBudgetExceeded
+type budgetExceededError struct {
+	message string
+	resetAt time.Time
+}
+
+func (e *budgetExceededError) Error() string { return e.message }
+
+func (e *budgetExceededError) Unwrap() error { return ErrBudgetExceeded }
+
+// BudgetStatus Provider 当日预算与用量。请求数与费用均按任务表当天（本地时间）创建的任务统计，
+// 请求数包含失败任务，费用只计算未失败任务的图片数 × cost_per_image
+type BudgetStatus struct {
+	Provider          string     `json:"provider"`
+	MaxRequestsPerDay int        `json:"max_requests_per_day"`
+	MaxCostPerDay     float64    `json:"max_cost_per_day"`
+	CostPerImage      float64    `json:"cost_per_image"`
+	Requests          int64      `json:"requests"`
+	Cost              float64    `json:"cost"`
+	RemainingRequests *int64     `json:"remaining_requests,omitempty"`
+	RemainingCost     *float64   `json:"remaining_cost,omitempty"`
+	ResetAt           time.Time  `json:"reset_at"`
+	OverrideUntil     *time.Time `json:"override_until,omitempty"`
+}
+
+// Limited 是否配置了任一预算上限
+func (s *BudgetStatus) Limited() bool {
+	return s.MaxRequestsPerDay > 0 || s.MaxCostPerDay > 0
+}
+
+var (
+	budgetOverrideMu sync.RWMutex
+	budgetOverrides  = make(map[string]time.Time)
+)
+
+// OverrideBudget 在 until 之前临时解除 Provider 的预算限制，until 为零值时取消解除；
+// 仅保存在内存中，重启后失效
+func OverrideBudget(providerName string, until time.Time) {
+	budgetOverrideMu.Lock()
+	defer budgetOverrideMu.Unlock()
+	if until.IsZero() {
+		delete(budgetOverrides, providerName)
+		return
+	}
+	budgetOverrides[providerName] = until
+}
+
+func budgetOverride(providerName string) *time.Time {
+	budgetOverrideMu.RLock()
+	until, ok := budgetOverrides[providerName]
+	budgetOverrideMu.RUnlock()
+	if !ok || !until.After(time.Now()) {
+		return nil
+	}
+	return &until
+}
+
+// ProviderBudget 查询 Provider 当日预算与用量；excludeTaskID 不为空时不统计该任务本身
+func ProviderBudget(providerName, excludeTaskID string) (*BudgetStatus, error) {
+	var cfg model.ProviderConfig
+	if err := model.DB.Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	status := &BudgetStatus{
+		Provider:          providerName,
+		MaxRequestsPerDay: provider.ExtraConfigInt(&cfg, budgetKeyMaxRequests),
+		MaxCostPerDay:     provider.ExtraConfigFloat(&cfg, budgetKeyMaxCost),
+		CostPerImage:      provider.ExtraConfigFloat(&cfg, budgetKeyCostPerImage),
+		ResetAt:           dayStart.AddDate(0, 0, 1),
+		OverrideUntil:     budgetOverride(providerName),
+	}
+	if !status.Limited() {
+		return status, nil
+	}
+
+	// 被预算拒绝的任务不计入用量
+	query := model.DB.Model(&model.Task{}).
+		Where("provider_name = ? AND created_at >= ? AND COALESCE(error_code, '') <> ?", providerName, dayStart, model.ErrCodeBudgetExceeded)
+	if excludeTaskID != "" {
+		query = query.Where("task_id <> ?", excludeTaskID)
+	}
+	var usage struct {
+		Requests int64
+		Images   int64
+	}
+	if err := query.Select("COUNT(*) AS requests, COALESCE(SUM(CASE WHEN status <> 'failed' THEN total_count ELSE 0 END), 0) AS images").
+		Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+	status.Requests = usage.Requests
+	status.Cost = float64(usage.Images) * status.CostPerImage
+	if status.MaxRequestsPerDay > 0 {
+		remaining := int64(status.MaxRequestsPerDay) - status.Requests
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.RemainingRequests = &remaining
+	}
+	if status.MaxCostPerDay > 0 {
+		remaining := status.MaxCostPerDay - status.Cost
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.RemainingCost = &remaining
+	}
+	return status, nil
+}
+
+// CheckBudget 判断再提交一个 images 张图片的任务是否会超出 Provider 当日预算，
+// 超出时返回的错误可被识别为 ErrBudgetExceeded。查询失败时放行，避免统计异常阻塞生成
+func CheckBudget(providerName string, images int, excludeTaskID string) (*BudgetStatus, error) {
+	return checkBudget(providerName, 1, images, excludeTaskID)
+}
+
+// CheckBatchBudget 判断一次提交 requests 个任务、共 images 张图片是否会超出 Provider 当日预算
+func CheckBatchBudget(providerName string, requests, images int) (*BudgetStatus, error) {
+	return checkBudget(providerName, requests, images, "")
+}
+
+func checkBudget(providerName string, requests, images int, excludeTaskID string) (*BudgetStatus, error) {
+	status, err := ProviderBudget(providerName, excludeTaskID)
+	if err != nil || !status.Limited() || status.OverrideUntil != nil {
+		return status, nil
+	}
+	if images < 1 {
+		images = 1
+	}
+	if status.MaxRequestsPerDay > 0 && status.Requests+int64(requests) > int64(status.MaxRequestsPerDay) {
+		return status, &budgetExceededError{
+			message: fmt.Sprintf("Provider %s 今日请求数已达上限 %d，将于 %s 重置", providerName, status.MaxRequestsPerDay, status.ResetAt.Format("2006-01-02 15:04")),
+			resetAt: status.ResetAt,
+		}
+	}
+	if status.MaxCostPerDay > 0 && status.Cost+float64(images)*status.CostPerImage > status.MaxCostPerDay {
+		return status, &budgetExceededError{
+			message: fmt.Sprintf("Provider %s 今日费用将超出上限 %.2f（已用 %.2f），将于 %s 重置", providerName, status.MaxCostPerDay, status.Cost, status.ResetAt.Format("2006-01-02 15:04")),
+			resetAt: status.ResetAt,
+		}
+	}
+	return status, nil
+}
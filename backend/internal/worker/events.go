@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"image-gen-service/internal/model"
+)
+
+// 任务事件类型
+const (
+	EventEnqueued            = "enqueued"
+	EventDequeued            = "dequeued"
+	EventProviderCallStarted = "provider_call_started"
+	EventProviderCallFailed  = "provider_call_failed"
+	EventDeadlineApproaching = "deadline_approaching"
+	EventImagesReceived      = "images_received"
+	EventAspectMismatch      = "aspect_mismatch"
+	EventSaved               = "saved"
+	EventThumbnail           = "thumbnail"
+	EventCompleted           = "completed"
+	EventFailed              = "failed"
+	EventRateLimited         = "rate_limited"
+)
+
+// eventBufferSize 事件写入缓冲区大小，写满时直接丢弃新事件
+const eventBufferSize = 1024
+
+var (
+	eventQueue     chan eventItem
+	eventQueueOnce sync.Once
+)
+
+// eventItem 写入队列中的一项：事件或 FlushTaskEvents 的完成通知
+type eventItem struct {
+	event   *model.TaskEvent
+	flushed chan struct{}
+}
+
+// RecordTaskEvent 记录任务事件（fire-and-forget）
+// 事件由单独的 goroutine 按顺序写库，写入失败或缓冲区已满只记录日志，不会影响任务本身
+func RecordTaskEvent(taskID, eventType, format string, args ...interface{}) {
+	if taskID == "" {
+		return
+	}
+	eventQueueOnce.Do(startEventWriter)
+
+	message := format
+	if len(args) > 0 {
+		message = fmt.Sprintf(format, args...)
+	}
+	event := &model.TaskEvent{
+		TaskID:    taskID,
+		Type:      eventType,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	select {
+	case eventQueue <- eventItem{event: event}:
+	default:
+		log.Printf("任务事件缓冲区已满，丢弃事件: task=%s type=%s", taskID, eventType)
+	}
+}
+
+// FlushTaskEvents 等待此前记录的事件全部写入完成，供测试在修改数据库回调前确认没有并发写入
+func FlushTaskEvents() {
+	eventQueueOnce.Do(startEventWriter)
+	flushed := make(chan struct{})
+	eventQueue <- eventItem{flushed: flushed}
+	<-flushed
+}
+
+func startEventWriter() {
+	eventQueue = make(chan eventItem, eventBufferSize)
+	go func() {
+		for item := range eventQueue {
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			event := item.event
+			if model.DB == nil {
+				continue
+			}
+			if err := model.DB.Create(event).Error; err != nil {
+				log.Printf("写入任务事件失败: task=%s type=%s err=%v", event.TaskID, event.Type, err)
+			}
+		}
+	}()
+}
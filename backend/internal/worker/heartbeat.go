@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+)
+
+const (
+	// heartbeatInterval 处理中的任务写入心跳、检查卡死任务的间隔
+	heartbeatInterval = 15 * time.Second
+	// stalledTimeoutFactor 心跳超过任务超时时间的该倍数仍未更新时，判定 Worker 已卡死
+	stalledTimeoutFactor = 2
+	// maxStalledRecords 队列状态接口保留的最近卡死检测记录数
+	maxStalledRecords = 20
+)
+
+// ErrWorkerStalled Worker 长时间没有心跳，任务被强制终止
+var ErrWorkerStalled = errors.New("Worker 长时间没有响应，任务已被强制终止")
+
+// taskHeartbeat 处理中任务的心跳。心跳只由处理该任务的 Worker 自己写入，
+// Worker 阻塞在 Provider 调用或存储写入中时心跳随之停止
+type taskHeartbeat struct {
+	taskID    string
+	workerID  int
+	provider  string
+	timeout   time.Duration
+	startedAt time.Time
+	last      time.Time
+	persisted time.Time // 最近一次写入 last_heartbeat 列的时间
+	cancel    context.CancelFunc
+}
+
+// RunningTask 正在处理的任务及其心跳
+type RunningTask struct {
+	TaskID         string    `json:"task_id"`
+	WorkerID       int       `json:"worker_id"`
+	Provider       string    `json:"provider"`
+	StartedAt      time.Time `json:"started_at"`
+	LastHeartbeat  time.Time `json:"last_heartbeat"`
+	TimeoutSeconds int       `json:"timeout_seconds"`
+}
+
+// StalledTask 一次卡死检测记录
+type StalledTask struct {
+	RunningTask
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// startHeartbeat 登记处理中的任务，cancel 用于卡死时强制终止任务的 Context
+func (wp *WorkerPool) startHeartbeat(task *Task, workerID int, timeout time.Duration, cancel context.CancelFunc) {
+	now := time.Now()
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	wp.heartbeats[task.TaskModel.TaskID] = &taskHeartbeat{
+		taskID:    task.TaskModel.TaskID,
+		workerID:  workerID,
+		provider:  task.TaskModel.ProviderName,
+		timeout:   timeout,
+		startedAt: now,
+		last:      now,
+		persisted: now,
+		cancel:    cancel,
+	}
+}
+
+// beat 记录任务仍在推进；数据库中的 last_heartbeat 最多每 heartbeatInterval 写入一次
+func (wp *WorkerPool) beat(taskID string) {
+	now := time.Now()
+	wp.heartbeatMu.Lock()
+	hb, ok := wp.heartbeats[taskID]
+	persist := false
+	if ok {
+		hb.last = now
+		if now.Sub(hb.persisted) >= heartbeatInterval {
+			hb.persisted = now
+			persist = true
+		}
+	}
+	wp.heartbeatMu.Unlock()
+	if !persist {
+		return
+	}
+	if err := model.DB.Model(&model.Task{}).Where("task_id = ? AND status = ?", taskID, "processing").
+		Update("last_heartbeat", now).Error; err != nil {
+		log.Printf("任务 %s 写入心跳失败: %v", taskID, err)
+	}
+}
+
+func (wp *WorkerPool) stopHeartbeat(taskID string) {
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	delete(wp.heartbeats, taskID)
+}
+
+// isStalled 任务是否已被判定为卡死；卡死的任务已标记失败，Worker 恢复后不应再写入结果
+func (wp *WorkerPool) isStalled(taskID string) bool {
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	return wp.stalledTasks[taskID]
+}
+
+// clearStalled 清除卡死标记，返回任务是否曾被判定为卡死
+func (wp *WorkerPool) clearStalled(taskID string) bool {
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	stalled := wp.stalledTasks[taskID]
+	delete(wp.stalledTasks, taskID)
+	return stalled
+}
+
+// startStallMonitor 定期检查处理中任务的心跳，直到 Worker 池停止
+func (wp *WorkerPool) startStallMonitor() {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wp.ctx.Done():
+				return
+			case now := <-ticker.C:
+				wp.checkStalled(now)
+			}
+		}
+	}()
+}
+
+// checkStalled 心跳超过任务超时时间 stalledTimeoutFactor 倍未更新的任务：强制取消其 Context，
+// 标记为 WORKER_STALLED 失败，并另起一个 Worker 补足数量；卡住的 Worker 恢复后直接退出
+func (wp *WorkerPool) checkStalled(now time.Time) {
+	var stalled []*taskHeartbeat
+	wp.heartbeatMu.Lock()
+	for taskID, hb := range wp.heartbeats {
+		if now.Sub(hb.last) <= stalledTimeoutFactor*hb.timeout {
+			continue
+		}
+		stalled = append(stalled, hb)
+		delete(wp.heartbeats, taskID)
+		wp.stalledTasks[taskID] = true
+		wp.stalledLog = append(wp.stalledLog, StalledTask{RunningTask: hb.view(), DetectedAt: now})
+		if len(wp.stalledLog) > maxStalledRecords {
+			wp.stalledLog = wp.stalledLog[len(wp.stalledLog)-maxStalledRecords:]
+		}
+	}
+	wp.heartbeatMu.Unlock()
+
+	for _, hb := range stalled {
+		hb.cancel()
+		log.Printf("任务 %s 的 Worker %d 已 %s 没有心跳（超时 %s），强制终止", hb.taskID, hb.workerID, now.Sub(hb.last).Round(time.Second), hb.timeout)
+		result := model.DB.Model(&model.Task{}).Where("task_id = ? AND status = ?", hb.taskID, "processing").
+			Updates(map[string]interface{}{
+				"status":        "failed",
+				"error_message": ErrWorkerStalled.Error(),
+				"error_code":    model.ErrCodeWorkerStalled,
+				"error_class":   provider.ErrorClassTimeout,
+			})
+		if result.Error != nil {
+			log.Printf("标记卡死任务 %s 失败出错: %v", hb.taskID, result.Error)
+		}
+		RecordTaskEvent(hb.taskID, EventFailed, "code=%s worker=%d last_heartbeat=%s", model.ErrCodeWorkerStalled, hb.workerID, hb.last.Format(time.RFC3339))
+		notifyTaskUpdate(hb.taskID)
+
+		wp.wg.Add(1)
+		id := int(wp.nextWorkerID.Add(1))
+		go wp.worker(id)
+		log.Printf("已启动 Worker %d 替换卡死的 Worker %d", id, hb.workerID)
+	}
+}
+
+func (hb *taskHeartbeat) view() RunningTask {
+	return RunningTask{
+		TaskID:         hb.taskID,
+		WorkerID:       hb.workerID,
+		Provider:       hb.provider,
+		StartedAt:      hb.startedAt,
+		LastHeartbeat:  hb.last,
+		TimeoutSeconds: int(hb.timeout / time.Second),
+	}
+}
+
+// RunningTasks 返回正在处理的任务及其最近心跳
+func (wp *WorkerPool) RunningTasks() []RunningTask {
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	tasks := make([]RunningTask, 0, len(wp.heartbeats))
+	for _, hb := range wp.heartbeats {
+		tasks = append(tasks, hb.view())
+	}
+	return tasks
+}
+
+// StalledTasks 返回最近的卡死检测记录（从旧到新）
+func (wp *WorkerPool) StalledTasks() []StalledTask {
+	wp.heartbeatMu.Lock()
+	defer wp.heartbeatMu.Unlock()
+	return append([]StalledTask{}, wp.stalledLog...)
+}
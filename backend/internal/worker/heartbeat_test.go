@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+)
+
+// hangProvider 上报一次进度后一直阻塞，且不理会 Context，模拟卡死在上游调用中的 Provider
+type hangProvider struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *hangProvider) Name() string { return "hang" }
+
+func (p *hangProvider) ValidateParams(map[string]interface{}) error { return nil }
+
+func (p *hangProvider) Generate(ctx context.Context, _ map[string]interface{}) (*provider.ProviderResult, error) {
+	provider.ReportProgress(ctx, 10)
+	close(p.started)
+	<-p.unblock
+	return nil, context.Canceled
+}
+
+func setupHangPool(t *testing.T) (*WorkerPool, *hangProvider) {
+	t.Helper()
+	if err := model.OpenDB(":memory:"); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	p := &hangProvider{started: make(chan struct{}), unblock: make(chan struct{})}
+	provider.Register(p)
+	InitPool(1, 4)
+	wp := Pool
+	wp.Start()
+	t.Cleanup(func() {
+		close(p.unblock)
+		wp.Stop()
+	})
+	return wp, p
+}
+
+func submitHangTask(t *testing.T, wp *WorkerPool, p *hangProvider, taskID string) RunningTask {
+	t.Helper()
+	row := &model.Task{TaskID: taskID, ProviderName: "hang", Status: "pending", TotalCount: 1}
+	if err := model.DB.Create(row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !wp.Submit(&Task{TaskModel: row, Params: map[string]interface{}{"prompt": "hang"}}) {
+		t.Fatal("提交任务失败")
+	}
+	select {
+	case <-p.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Provider 未被调用")
+	}
+	running := wp.RunningTasks()
+	if len(running) != 1 || running[0].TaskID != taskID {
+		t.Fatalf("处理中的任务 = %+v", running)
+	}
+	return running[0]
+}
+
+// TestStallMonitorFailsHungProviderTask Provider 调用卡住时 Worker 不再写入心跳，
+// 超过超时时间两倍后卡死检测将任务标记为 WORKER_STALLED
+func TestStallMonitorFailsHungProviderTask(t *testing.T) {
+	wp, p := setupHangPool(t)
+	hb := submitHangTask(t, wp, p, "stall-hung")
+	timeout := time.Duration(hb.TimeoutSeconds) * time.Second
+
+	// 卡住期间心跳停在最后一次进度上报，不会被定时刷新
+	time.Sleep(50 * time.Millisecond)
+	if last := wp.RunningTasks()[0].LastHeartbeat; !last.Equal(hb.LastHeartbeat) {
+		t.Fatalf("Provider 没有推进时心跳被刷新: %s -> %s", hb.LastHeartbeat, last)
+	}
+
+	wp.checkStalled(hb.LastHeartbeat.Add(stalledTimeoutFactor * timeout))
+	if len(wp.RunningTasks()) != 1 {
+		t.Fatal("心跳未超过阈值的任务被判定为卡死")
+	}
+
+	wp.checkStalled(hb.LastHeartbeat.Add(stalledTimeoutFactor*timeout + time.Second))
+	var task model.Task
+	if err := model.DB.Where("task_id = ?", "stall-hung").First(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != "failed" || task.ErrorCode != model.ErrCodeWorkerStalled {
+		t.Fatalf("任务状态 = %s (%s)，期望 failed (%s)", task.Status, task.ErrorCode, model.ErrCodeWorkerStalled)
+	}
+	stalled := wp.StalledTasks()
+	if len(stalled) != 1 || stalled[0].TaskID != "stall-hung" {
+		t.Fatalf("卡死检测记录 = %+v", stalled)
+	}
+	if len(wp.RunningTasks()) != 0 {
+		t.Fatal("卡死的任务仍登记为处理中")
+	}
+}
+
+// TestProgressRefreshesHeartbeat Provider 上报进度时刷新心跳
+func TestProgressRefreshesHeartbeat(t *testing.T) {
+	wp, p := setupHangPool(t)
+	hb := submitHangTask(t, wp, p, "stall-progress")
+	if !hb.LastHeartbeat.After(hb.StartedAt) {
+		t.Fatalf("进度上报后心跳 %s 未晚于开始时间 %s", hb.LastHeartbeat, hb.StartedAt)
+	}
+}
@@ -3,12 +3,18 @@ package worker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"image-gen-service/internal/config"
 	"image-gen-service/internal/model"
 	"image-gen-service/internal/provider"
 	"image-gen-service/internal/storage"
@@ -18,62 +24,317 @@ import (
 type Task struct {
 	TaskModel *model.Task
 	Params    map[string]interface{}
+	// Handler 非生成类的后台作业（如批量生成描述），设置后 Worker 直接执行它而不调用 Provider
+	Handler func(ctx context.Context) error
 }
 
 // WorkerPool 任务池结构
 type WorkerPool struct {
 	workerCount int
 	taskQueue   chan *Task
+	lowQueue    chan *Task
+	slots       chan struct{} // 普通队列的名额，提交前先占用，Worker 取走任务时释放
 	wg          sync.WaitGroup
 	ctx         context.Context
 	cancel      context.CancelFunc
+	// jobCtx 传给 Handler 后台作业的 Context，Stop 开始时即取消：正在执行的作业尽快退出，
+	// 低优先级队列中尚未开始的作业直接丢弃，不在停止时排空
+	jobCtx      context.Context
+	jobCancel   context.CancelFunc
+	droppedJobs atomic.Int32
+
+	statsMu   sync.Mutex
+	durations map[string][]time.Duration
+
+	cancelMu  sync.Mutex
+	running   map[string]context.CancelFunc
+	cancelled map[string]error // 已取消但尚未出队的任务 -> 出队时记录的失败原因
+
+	// delayed 限流等待中的任务的重试定时器，见 rate_limit.go
+	delayedMu sync.Mutex
+	delayed   map[string]*time.Timer
+	stopping  bool
+
+	// heartbeats 处理中任务的心跳与卡死检测，见 heartbeat.go
+	heartbeatMu  sync.Mutex
+	heartbeats   map[string]*taskHeartbeat
+	stalledTasks map[string]bool // 已判定卡死、Worker 尚未退出的任务
+	stalledLog   []StalledTask
+	nextWorkerID atomic.Int32 // 替换卡死 Worker 时分配的编号
 }
 
+// ErrTaskCancelled 任务被用户取消
+var ErrTaskCancelled = errors.New("任务已取消")
+
+// ErrTaskAbandoned 提交时开启了 auto_cancel_on_disconnect，排队期间客户端断开超过宽限时间
+var ErrTaskAbandoned = errors.New("客户端已断开连接，排队中的任务已自动取消")
+
+// ErrTaskTimeout 任务超过超时时间仍未完成
+var ErrTaskTimeout = errors.New("生成超时")
+
+// durationWindow 每个 Provider 保留的最近耗时样本数，用于估算排队时间
+const durationWindow = 20
+
 var Pool *WorkerPool
 
+// RecoverInterrupted Start 时是否将上次运行遗留的排队中、处理中与限流等待中的任务标记为失败。
+// 只有持有单实例锁时才能确定这些记录不属于另一个仍在运行的实例，未能获取实例锁时应关闭
+var RecoverInterrupted = true
+
+var (
+	updateHooksMu sync.RWMutex
+	updateHooks   []func(taskID string)
+)
+
+// OnTaskUpdate 注册任务更新通知，Worker 每次写入任务记录后都会同步调用
+func OnTaskUpdate(fn func(taskID string)) {
+	updateHooksMu.Lock()
+	defer updateHooksMu.Unlock()
+	updateHooks = append(updateHooks, fn)
+}
+
+func notifyTaskUpdate(taskID string) {
+	updateHooksMu.RLock()
+	defer updateHooksMu.RUnlock()
+	for _, fn := range updateHooks {
+		fn(taskID)
+	}
+}
+
 // InitPool 初始化全局任务池
 func InitPool(workerCount, queueSize int) {
 	ctx, cancel := context.WithCancel(context.Background())
+	jobCtx, jobCancel := context.WithCancel(ctx)
 	Pool = &WorkerPool{
-		workerCount: workerCount,
-		taskQueue:   make(chan *Task, queueSize),
-		ctx:         ctx,
-		cancel:      cancel,
+		workerCount:  workerCount,
+		taskQueue:    make(chan *Task, queueSize),
+		lowQueue:     make(chan *Task, queueSize),
+		slots:        make(chan struct{}, queueSize),
+		ctx:          ctx,
+		cancel:       cancel,
+		jobCtx:       jobCtx,
+		jobCancel:    jobCancel,
+		durations:    make(map[string][]time.Duration),
+		running:      make(map[string]context.CancelFunc),
+		cancelled:    make(map[string]error),
+		delayed:      make(map[string]*time.Timer),
+		heartbeats:   make(map[string]*taskHeartbeat),
+		stalledTasks: make(map[string]bool),
 	}
+	Pool.nextWorkerID.Store(int32(workerCount - 1))
+}
+
+// Cancel 取消任务：正在处理的任务会中断 Provider 调用，仍在队列中的任务会在出队时被跳过
+// 返回值表示任务是否正在处理中
+func (wp *WorkerPool) Cancel(taskID string) bool {
+	// 限流等待中的任务撤销重试定时器即可，由调用方标记为已取消
+	if wp.cancelDelayed(taskID) {
+		return false
+	}
+	wp.cancelMu.Lock()
+	defer wp.cancelMu.Unlock()
+	wp.cancelled[taskID] = ErrTaskCancelled
+	if cancel, ok := wp.running[taskID]; ok {
+		cancel()
+		return true
+	}
+	return false
+}
+
+// CancelQueued 只取消尚未开始处理的任务（队列中或限流等待中），出队时以 reason 标记失败。
+// 任务已在处理中时不做任何操作并返回 false
+func (wp *WorkerPool) CancelQueued(taskID string, reason error) bool {
+	if wp.cancelDelayed(taskID) {
+		return true
+	}
+	wp.cancelMu.Lock()
+	defer wp.cancelMu.Unlock()
+	if _, ok := wp.running[taskID]; ok {
+		return false
+	}
+	wp.cancelled[taskID] = reason
+	return true
+}
+
+// beginTask 登记正在处理的任务；任务已被取消时返回取消原因
+func (wp *WorkerPool) beginTask(taskID string, cancel context.CancelFunc) error {
+	wp.cancelMu.Lock()
+	defer wp.cancelMu.Unlock()
+	if reason, ok := wp.cancelled[taskID]; ok {
+		delete(wp.cancelled, taskID)
+		return reason
+	}
+	wp.running[taskID] = cancel
+	return nil
+}
+
+// endTask 清理任务的取消登记，返回任务是否在处理期间被取消
+func (wp *WorkerPool) endTask(taskID string) bool {
+	wp.cancelMu.Lock()
+	defer wp.cancelMu.Unlock()
+	_, cancelled := wp.cancelled[taskID]
+	delete(wp.running, taskID)
+	delete(wp.cancelled, taskID)
+	return cancelled
+}
+
+// WorkerCount 返回 Worker 数量
+func (wp *WorkerPool) WorkerCount() int {
+	return wp.workerCount
+}
+
+// AverageDuration 返回指定 Provider 最近成功任务的平均处理耗时
+func (wp *WorkerPool) AverageDuration(providerName string) (time.Duration, bool) {
+	wp.statsMu.Lock()
+	defer wp.statsMu.Unlock()
+	samples := wp.durations[providerName]
+	if len(samples) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+	return total / time.Duration(len(samples)), true
+}
+
+func (wp *WorkerPool) recordDuration(providerName string, d time.Duration) {
+	wp.statsMu.Lock()
+	defer wp.statsMu.Unlock()
+	samples := append(wp.durations[providerName], d)
+	if len(samples) > durationWindow {
+		samples = samples[len(samples)-durationWindow:]
+	}
+	wp.durations[providerName] = samples
 }
 
 // Start 启动所有 Worker
 func (wp *WorkerPool) Start() {
+	if RecoverInterrupted {
+		failInterruptedRateLimited()
+		failInterruptedTasks()
+	} else {
+		log.Printf("未持有实例锁，跳过中断任务的清理")
+	}
 	for i := 0; i < wp.workerCount; i++ {
 		wp.wg.Add(1)
 		go wp.worker(i)
 	}
+	wp.startStallMonitor()
 	log.Printf("Worker 池已启动，Worker 数量: %d", wp.workerCount)
 }
 
 // Stop 优雅停止 Worker 池
 func (wp *WorkerPool) Stop() {
 	// 1. 首先关闭任务队列通道，不再接收新提交的任务
-	// 已经提交到通道中的任务会继续保留在通道中
+	// 已经提交到通道中的任务会继续保留在通道中；限流等待中的任务不再放回队列
+	wp.stopDelayed()
 	close(wp.taskQueue)
+	close(wp.lowQueue)
+	// 后台作业（如批量生成描述）可能有数百个排队，停止时取消而不是逐个执行完
+	wp.jobCancel()
 
 	// 2. 等待所有正在运行的 Worker 完成任务
-	// 由于通道已关闭，Worker 会在处理完通道中剩余的所有任务后退出
+	// 由于通道已关闭，Worker 会在处理完通道中剩余的生成任务后退出
 	wp.wg.Wait()
+	if dropped := wp.droppedJobs.Load(); dropped > 0 {
+		log.Printf("Worker 池停止，已丢弃 %d 个排队中的后台作业", dropped)
+	}
 
 	// 3. 最后取消 Context，通知所有依赖该 Context 的操作（如正在进行的 HTTP 请求）停止
 	wp.cancel()
 
-	log.Println("Worker 池已优雅停止，所有队列中的任务已处理完毕")
+	log.Println("Worker 池已优雅停止，队列中的生成任务已处理完毕")
+}
+
+// failInterruptedTasks 队列只存在于内存中，进程异常退出（未经 Stop 排空队列）后留下的排队中与处理中任务
+// 不会再被执行，启动时统一标记为失败，客户端可按错误码重新提交
+func failInterruptedTasks() {
+	if model.DB == nil {
+		return
+	}
+	result := model.DB.Model(&model.Task{}).Where("status IN ?", []string{"pending", "processing"}).Updates(map[string]interface{}{
+		"status":        "failed",
+		"error_message": "服务异常退出，任务未能完成",
+		"error_code":    model.ErrCodeInterrupted,
+	})
+	if result.Error != nil {
+		log.Printf("清理中断的任务失败: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("已将 %d 个服务异常退出前未完成的任务标记为失败", result.RowsAffected)
+	}
+}
+
+// Reservation 普通队列中已占用的名额，必须调用 Submit 或 Cancel 之一
+type Reservation struct {
+	wp   *WorkerPool
+	done bool
+}
+
+// Reserve 占用普通队列的一个名额，队列已满时最多等待 wait；ctx 结束或等待超时返回 false
+func (wp *WorkerPool) Reserve(ctx context.Context, wait time.Duration) (*Reservation, bool) {
+	select {
+	case wp.slots <- struct{}{}:
+		return &Reservation{wp: wp}, true
+	default:
+	}
+	if wait <= 0 {
+		return nil, false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case wp.slots <- struct{}{}:
+		return &Reservation{wp: wp}, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// Submit 将任务放入已占用的名额，不会阻塞
+func (r *Reservation) Submit(task *Task) {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.wp.taskQueue <- task
+	recordEnqueued(task, "")
+}
+
+// Cancel 放弃名额，例如创建任务记录失败时
+func (r *Reservation) Cancel() {
+	if r.done {
+		return
+	}
+	r.done = true
+	<-r.wp.slots
+}
+
+// QueueDepth 返回普通队列中已占用的名额数与队列容量
+func (wp *WorkerPool) QueueDepth() (int, int) {
+	return len(wp.slots), cap(wp.slots)
 }
 
 // Submit 提交任务到队列
 func (wp *WorkerPool) Submit(task *Task) bool {
+	reservation, ok := wp.Reserve(context.Background(), 0)
+	if !ok {
+		// 队列已满
+		return false
+	}
+	reservation.Submit(task)
+	return true
+}
+
+// SubmitLow 提交低优先级任务，仅在普通队列空闲时才会被 Worker 取走
+func (wp *WorkerPool) SubmitLow(task *Task) bool {
 	select {
-	case wp.taskQueue <- task:
+	case wp.lowQueue <- task:
+		recordEnqueued(task, "低优先级")
 		return true
 	default:
-		// 队列已满
 		return false
 	}
 }
@@ -82,42 +343,143 @@ func (wp *WorkerPool) worker(id int) {
 	defer wp.wg.Done()
 	log.Printf("Worker %d 启动", id)
 
-	for {
+	taskQueue, lowQueue := wp.taskQueue, wp.lowQueue
+	for taskQueue != nil || lowQueue != nil {
+		// 优先处理普通队列中的任务
+		select {
+		case task, ok := <-taskQueue:
+			if !ok {
+				taskQueue = nil
+				continue
+			}
+			<-wp.slots
+			if wp.run(task, id) {
+				return
+			}
+			continue
+		default:
+		}
+
 		select {
 		case <-wp.ctx.Done():
 			log.Printf("Worker %d 收到停止信号", id)
 			return
-		case task, ok := <-wp.taskQueue:
+		case task, ok := <-taskQueue:
+			if !ok {
+				taskQueue = nil
+				continue
+			}
+			<-wp.slots
+			if wp.run(task, id) {
+				return
+			}
+		case task, ok := <-lowQueue:
 			if !ok {
+				lowQueue = nil
+				continue
+			}
+			if wp.run(task, id) {
 				return
 			}
-			wp.processTask(task)
 		}
 	}
 }
 
+// run 执行一个任务；返回 true 表示任务期间 Worker 被判定为卡死、已有替换的 Worker，当前 Worker 应退出
+func (wp *WorkerPool) run(task *Task, workerID int) (retire bool) {
+	// 单个任务 panic 不应让 Worker 退出，否则池中可用 Worker 会逐渐减少
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Worker %d 处理任务时发生 panic: %v\n%s", workerID, r, debug.Stack())
+			if task.Handler == nil && task.TaskModel != nil {
+				wp.failTaskWithCode(task.TaskModel, model.ErrCodeInternal, fmt.Errorf("内部错误: %v", r))
+			}
+		}
+		if task.Handler == nil && task.TaskModel != nil && wp.clearStalled(task.TaskModel.TaskID) {
+			log.Printf("Worker %d 已从卡死的任务 %s 中恢复，已有替换的 Worker，退出", workerID, task.TaskModel.TaskID)
+			retire = true
+		}
+	}()
+	if task.Handler != nil {
+		if wp.jobCtx.Err() != nil {
+			wp.droppedJobs.Add(1)
+			return false
+		}
+		if err := task.Handler(wp.jobCtx); err != nil {
+			log.Printf("后台作业执行失败: %v", err)
+		}
+		return false
+	}
+	wp.processTask(task, workerID)
+	return false
+}
+
+func recordEnqueued(task *Task, note string) {
+	if task.Handler != nil || task.TaskModel == nil {
+		return
+	}
+	RecordTaskEvent(task.TaskModel.TaskID, EventEnqueued, "%s", note)
+}
+
 // processTask 处理单个任务（由 Worker 调用）
-func (wp *WorkerPool) processTask(task *Task) {
+func (wp *WorkerPool) processTask(task *Task, workerID int) {
+	startedAt := time.Now()
+	RecordTaskEvent(task.TaskModel.TaskID, EventDequeued, "worker %d", workerID)
+
+	taskCtx, cancelTask := context.WithCancel(wp.ctx)
+	defer cancelTask()
+	if reason := wp.beginTask(task.TaskModel.TaskID, cancelTask); reason != nil {
+		code := ""
+		if errors.Is(reason, ErrTaskAbandoned) {
+			code = model.ErrCodeAbandoned
+		}
+		wp.failTaskWithCode(task.TaskModel, code, reason)
+		return
+	}
+	defer wp.endTask(task.TaskModel.TaskID)
+
+	// 排队期间可能跨过零点或有其他任务先消耗了预算，开始处理前再检查一次
+	if _, err := CheckBudget(task.TaskModel.ProviderName, task.TaskModel.TotalCount, task.TaskModel.TaskID); err != nil {
+		wp.failTaskWithCode(task.TaskModel, model.ErrCodeBudgetExceeded, err)
+		return
+	}
 	if !task.TaskModel.CreatedAt.IsZero() {
 		log.Printf("任务 %s 开始处理: provider=%s model=%s queue_wait=%s", task.TaskModel.TaskID, task.TaskModel.ProviderName, task.TaskModel.ModelID, time.Since(task.TaskModel.CreatedAt))
 	} else {
 		log.Printf("任务 %s 开始处理: provider=%s model=%s", task.TaskModel.TaskID, task.TaskModel.ProviderName, task.TaskModel.ModelID)
 	}
 
-	// 1. 更新状态为 processing
-	model.DB.Model(task.TaskModel).Update("status", "processing")
+	// 1. 更新状态为 processing，重试时清除上一次的进度
+	// 心跳从此开始，由 Provider 的进度回调与后续存储等处理步骤写入
+	timeout := taskTimeout(task)
+	wp.startHeartbeat(task, workerID, timeout, cancelTask)
+	defer wp.stopHeartbeat(task.TaskModel.TaskID)
+	model.DB.Model(task.TaskModel).Updates(map[string]interface{}{"status": "processing", "progress": 0, "last_heartbeat": time.Now()})
+	notifyTaskUpdate(task.TaskModel.TaskID)
 
 	// 2. 获取 Provider
-	p := provider.GetProvider(task.TaskModel.ProviderName)
+	// 由调用 Provider 的 goroutine 持有到调用真正结束，任务超时或取消后提前返回时，
+	// 期间配置被修改也不会释放仍在使用的客户端
+	p, release := provider.AcquireProvider(task.TaskModel.ProviderName)
 	if p == nil {
-		wp.failTask(task.TaskModel, fmt.Errorf("Provider %s 不存在", task.TaskModel.ProviderName))
+		release()
+		wp.failTaskWithCode(task.TaskModel, model.ErrCodeProviderNotFound, provider.UnavailableError(task.TaskModel.ProviderName))
 		return
 	}
 
 	// 3. 调用 API 生成图片（带任务级超时）
-	timeout := fetchProviderTimeout(task.TaskModel.ProviderName)
-	ctx, cancel := context.WithTimeout(wp.ctx, timeout)
+	ctx, cancel := context.WithTimeout(taskCtx, timeout)
 	defer cancel()
+	ctx = provider.WithProgress(ctx, wp.progressReporter(task.TaskModel.TaskID))
+	ctx = provider.WithDebugTask(ctx, task.TaskModel.TaskID)
+
+	// 接近超时时记录事件，SSE / WebSocket 推送后前端可提示用户
+	warnAfter := timeout * deadlineWarnPercent / 100
+	deadlineTimer := time.AfterFunc(warnAfter, func() {
+		RecordTaskEvent(task.TaskModel.TaskID, EventDeadlineApproaching, "remaining=%s timeout=%s", timeout-warnAfter, timeout)
+		notifyTaskUpdate(task.TaskModel.TaskID)
+	})
+	defer deadlineTimer.Stop()
 
 	type generateResult struct {
 		result *provider.ProviderResult
@@ -126,43 +488,68 @@ func (wp *WorkerPool) processTask(task *Task) {
 
 	callStartedAt := time.Now()
 	log.Printf("任务 %s 调用 Provider 开始: provider=%s model=%s timeout=%s", task.TaskModel.TaskID, task.TaskModel.ProviderName, task.TaskModel.ModelID, timeout)
+	RecordTaskEvent(task.TaskModel.TaskID, EventProviderCallStarted, "provider=%s model=%s timeout=%s", task.TaskModel.ProviderName, task.TaskModel.ModelID, timeout)
 	done := make(chan generateResult, 1)
 	go func() {
-		result, err := p.Generate(ctx, task.Params)
+		// 结果送出（包括 panic 转换的失败）后才释放客户端
+		defer release()
+		// Provider 调用在独立 goroutine 中执行，panic 需在此处转换为任务失败
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("任务 %s 调用 Provider 发生 panic: %v\n%s", task.TaskModel.TaskID, r, debug.Stack())
+				RecordTaskEvent(task.TaskModel.TaskID, EventProviderCallFailed, "panic: %v", r)
+				done <- generateResult{err: fmt.Errorf("Provider 内部错误: %v", r)}
+			}
+		}()
+		result, err := runProvider(ctx, p, task.Params)
 		elapsed := time.Since(callStartedAt)
 		if err != nil {
 			log.Printf("任务 %s 调用 Provider 失败: provider=%s model=%s elapsed=%s err=%v", task.TaskModel.TaskID, task.TaskModel.ProviderName, task.TaskModel.ModelID, elapsed, err)
+			RecordTaskEvent(task.TaskModel.TaskID, EventProviderCallFailed, "elapsed=%s err=%v", elapsed, err)
 		} else {
 			imageCount := 0
+			note := ""
 			if result != nil {
 				imageCount = len(result.Images)
+				note, _ = result.Metadata["note"].(string)
 			}
 			log.Printf("任务 %s 调用 Provider 成功: provider=%s model=%s elapsed=%s images=%d", task.TaskModel.TaskID, task.TaskModel.ProviderName, task.TaskModel.ModelID, elapsed, imageCount)
+			RecordTaskEvent(task.TaskModel.TaskID, EventImagesReceived, "elapsed=%s images=%d", elapsed, imageCount)
+			// Provider 部分成功（例如只凑齐了部分候选图片）时在事件中记录说明
+			if note != "" {
+				RecordTaskEvent(task.TaskModel.TaskID, EventImagesReceived, "note=%s", note)
+			}
 		}
 		done <- generateResult{result: result, err: err}
 	}()
 
+	// 等待期间不定时刷新心跳：只有 Provider 上报进度时才算推进，调用卡住时心跳随之停止
 	var result *provider.ProviderResult
 	select {
 	case <-ctx.Done():
 		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			wp.failTask(task.TaskModel, fmt.Errorf("生成超时(%s)", timeout))
+		if taskCtx.Err() != nil && wp.ctx.Err() == nil {
+			wp.failTask(task.TaskModel, ErrTaskCancelled)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			wp.failTask(task.TaskModel, fmt.Errorf("%w(%s)", ErrTaskTimeout, timeout))
 		} else {
 			wp.failTask(task.TaskModel, err)
 		}
 		return
 	case out := <-done:
 		if out.err != nil {
-			if errors.Is(out.err, context.DeadlineExceeded) {
-				wp.failTask(task.TaskModel, fmt.Errorf("生成超时(%s)", timeout))
-			} else {
+			if taskCtx.Err() != nil && wp.ctx.Err() == nil {
+				wp.failTask(task.TaskModel, ErrTaskCancelled)
+			} else if errors.Is(out.err, context.DeadlineExceeded) {
+				wp.failTask(task.TaskModel, fmt.Errorf("%w(%s)", ErrTaskTimeout, timeout))
+			} else if !wp.retryRateLimited(task, out.err) {
 				wp.failTask(task.TaskModel, out.err)
 			}
 			return
 		}
 		result = out.result
 	}
+	wp.beat(task.TaskModel.TaskID)
 
 	// 记录配置快照
 	configSnapshot := ""
@@ -170,29 +557,85 @@ func (wp *WorkerPool) processTask(task *Task) {
 		configSnapshot = fmt.Sprintf("Model: %s", task.TaskModel.ModelID)
 	}
 
-	// 4. 存储图片（含缩略图生成）
+	// 4. 校验宽高比，比例不符时按配置重新生成一次
+	var aspect *aspectCheck
+	if len(result.Images) > 0 {
+		aspect = checkAspect(task.Params, result.Images[0])
+		if aspect != nil && aspect.Mismatch {
+			RecordTaskEvent(task.TaskModel.TaskID, EventAspectMismatch, "requested=%s(%.3f) actual=%dx%d(%.3f)", aspect.Requested, aspect.Expected, aspect.Width, aspect.Height, aspect.Actual)
+			if aspectRetryAllowed(task.TaskModel.ProviderName) {
+				log.Printf("任务 %s 宽高比不符 (请求 %s, 实际 %dx%d)，重新生成一次", task.TaskModel.TaskID, aspect.Requested, aspect.Width, aspect.Height)
+				retried, err := wp.retryProvider(ctx, task)
+				wp.beat(task.TaskModel.TaskID)
+				if err != nil || retried == nil || len(retried.Images) == 0 {
+					log.Printf("任务 %s 重新生成失败，保留原结果: %v", task.TaskModel.TaskID, err)
+				} else if check := checkAspect(task.Params, retried.Images[0]); check != nil && !check.Mismatch {
+					result, aspect = retried, check
+					RecordTaskEvent(task.TaskModel.TaskID, EventImagesReceived, "aspect_retry actual=%dx%d", check.Width, check.Height)
+				}
+			}
+		}
+	}
+
+	// 比例仍不符且请求了 enforce_aspect=crop 时裁剪到请求比例，裁剪前的原图另存一份
+	cropUpdates := map[string]interface{}{}
+	if aspect != nil && aspect.Mismatch && enforceAspect(task.Params) == enforceAspectCrop {
+		data, width, height, err := cropToAspect(result.Images[0], aspect, cropAnchor(task.Params))
+		if err != nil {
+			log.Printf("任务 %s 裁剪到请求比例失败，保留原图: %v", task.TaskModel.TaskID, err)
+		} else if originalPath, err := saveOriginalImage(task.TaskModel.TaskID, result.Images[0]); err != nil {
+			log.Printf("任务 %s 保存裁剪前原图失败，放弃裁剪: %v", task.TaskModel.TaskID, err)
+		} else {
+			result.Images[0] = data
+			cropUpdates["cropped"] = true
+			cropUpdates["original_path"] = originalPath
+			cropUpdates["original_width"] = aspect.Width
+			cropUpdates["original_height"] = aspect.Height
+			RecordTaskEvent(task.TaskModel.TaskID, EventAspectMismatch, "cropped from=%dx%d to=%dx%d original=%s", aspect.Width, aspect.Height, width, height, originalPath)
+		}
+	}
+
+	// 5. 存储原图；大图解码与缩略图生成较慢，放到任务完成后在后台进行
 	// 文件后缀由 storage 层根据实际图片格式自动确定
 	if len(result.Images) > 0 {
 		// 传入基础文件名（无后缀），storage 会根据实际格式添加正确后缀
 		baseFileName := task.TaskModel.TaskID
 		reader := bytes.NewReader(result.Images[0])
-		localPath, remoteURL, thumbLocalPath, thumbRemoteURL, width, height, err := storage.GlobalStorage.SaveWithThumbnail(baseFileName, reader)
+		saved, err := storage.SaveOriginal(baseFileName, reader)
+		wp.beat(task.TaskModel.TaskID)
 		if err != nil {
-			wp.failTask(task.TaskModel, err)
+			wp.failTaskWithCode(task.TaskModel, model.ErrCodeStorageError, err)
 			return
 		}
+		RecordTaskEvent(task.TaskModel.TaskID, EventSaved, "local=%s thumbnail=%s size=%dx%d remote_sync=%s", saved.LocalPath, saved.ThumbLocalPath, saved.Width, saved.Height, saved.RemoteSync.Status)
 
-		// 5. 更新成功状态
+		// 6. 更新成功状态
 		now := time.Now()
 		updates := map[string]interface{}{
-			"status":         "completed",
-			"image_url":      remoteURL,
-			"local_path":     localPath,
-			"thumbnail_url":  thumbRemoteURL,
-			"thumbnail_path": thumbLocalPath,
-			"width":          width,
-			"height":         height,
-			"completed_at":   &now,
+			"status":          "completed",
+			"image_url":       saved.RemoteURL,
+			"local_path":      saved.LocalPath,
+			"thumbnail_url":   saved.ThumbRemoteURL,
+			"thumbnail_path":  saved.ThumbLocalPath,
+			"thumbnail_hash":  saved.ThumbHash,
+			"sync_status":     saved.RemoteSync.Status,
+			"sync_error":      saved.RemoteSync.Error,
+			"width":           saved.Width,
+			"height":          saved.Height,
+			"perceptual_hash": saved.PerceptualHash,
+			"file_size":       int64(len(result.Images[0])),
+			"completed_at":    &now,
+		}
+
+		if aspect != nil {
+			updates["aspect_ratio"] = aspect.Requested
+			updates["aspect_mismatch"] = aspect.Mismatch
+		}
+		for key, value := range cropUpdates {
+			updates[key] = value
+		}
+		if saved.ThumbPending {
+			updates["thumb_status"] = model.ThumbnailPending
 		}
 
 		// 兼容：历史版本可能未写入 config_snapshot，这里只在为空时补充
@@ -200,19 +643,179 @@ func (wp *WorkerPool) processTask(task *Task) {
 			updates["config_snapshot"] = configSnapshot
 		}
 
+		// 处理期间被判定为卡死的任务已标记为失败，不再覆盖
+		if wp.isStalled(task.TaskModel.TaskID) {
+			log.Printf("任务 %s 已被判定为卡死，丢弃迟到的结果", task.TaskModel.TaskID)
+			return
+		}
 		model.DB.Model(task.TaskModel).Updates(updates)
+		notifyTaskUpdate(task.TaskModel.TaskID)
+		wp.recordDuration(task.TaskModel.ProviderName, time.Since(startedAt))
+		RecordTaskEvent(task.TaskModel.TaskID, EventCompleted, "elapsed=%s", time.Since(startedAt))
 		log.Printf("任务 %s 处理完成", task.TaskModel.TaskID)
+		if saved.ThumbPending {
+			enqueueThumbnail(task.TaskModel.TaskID)
+		}
 	} else {
 		wp.failTask(task.TaskModel, fmt.Errorf("未生成任何图片"))
 	}
 }
 
+// retryProvider 重新获取 Provider 再调用一次，首次调用的客户端已随其 goroutine 结束释放
+func (wp *WorkerPool) retryProvider(ctx context.Context, task *Task) (*provider.ProviderResult, error) {
+	p, release := provider.AcquireProvider(task.TaskModel.ProviderName)
+	defer release()
+	if p == nil {
+		return nil, provider.UnavailableError(task.TaskModel.ProviderName)
+	}
+	return runProvider(ctx, p, task.Params)
+}
+
 func (wp *WorkerPool) failTask(taskModel *model.Task, err error) {
-	log.Printf("任务 %s 失败: %v", taskModel.TaskID, err)
-	model.DB.Model(taskModel).Updates(map[string]interface{}{
+	wp.failTaskWithCode(taskModel, "", err)
+}
+
+// failTaskWithCode 标记任务失败并记录错误分类；code 为空时按分类推断错误码
+func (wp *WorkerPool) failTaskWithCode(taskModel *model.Task, code string, err error) {
+	if wp.isStalled(taskModel.TaskID) {
+		log.Printf("任务 %s 已被判定为卡死，忽略迟到的失败: %v", taskModel.TaskID, err)
+		return
+	}
+	classification := classifyTaskError(taskModel.ProviderName, err)
+	if code == "" {
+		code = errorCodeForClass(classification.Class)
+	}
+	retryAfter := int(math.Ceil(classification.RetryAfter.Seconds()))
+	log.Printf("任务 %s 失败 (%s/%s): %v", taskModel.TaskID, code, classification.Class, err)
+	RecordTaskEvent(taskModel.TaskID, EventFailed, "code=%s class=%s retry_after=%d %v", code, classification.Class, retryAfter, err)
+	updates := map[string]interface{}{
 		"status":        "failed",
 		"error_message": err.Error(),
-	})
+		"error_code":    code,
+		"error_class":   classification.Class,
+		"retry_after":   retryAfter,
+	}
+	if debug := taskDebugCaptures(taskModel); debug != "" {
+		updates["provider_debug"] = debug
+	}
+	if raw := provider.RawResponse(err); raw != "" {
+		updates["debug_response"] = raw
+	}
+	model.DB.Model(taskModel).Updates(updates)
+	notifyTaskUpdate(taskModel.TaskID)
+}
+
+// maxTaskDebugCaptures 失败任务最多附带的抓包记录数，保留最近的几次请求
+const maxTaskDebugCaptures = 5
+
+// taskDebugCaptures 取出 Provider 抓包缓冲区中属于该任务的记录，未开启抓包或没有记录时返回空
+func taskDebugCaptures(taskModel *model.Task) string {
+	captures := provider.TaskDebugCaptures(taskModel.ProviderName, taskModel.TaskID)
+	if len(captures) == 0 {
+		return ""
+	}
+	if len(captures) > maxTaskDebugCaptures {
+		captures = captures[len(captures)-maxTaskDebugCaptures:]
+	}
+	data, err := json.Marshal(captures)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// classifyTaskError 先识别取消与超时，其余交给 Provider 的错误识别规则
+func classifyTaskError(providerName string, err error) provider.ErrorClassification {
+	switch {
+	case errors.Is(err, ErrTaskCancelled), errors.Is(err, ErrTaskAbandoned):
+		return provider.ErrorClassification{Class: provider.ErrorClassCancelled}
+	case errors.Is(err, ErrTaskTimeout):
+		return provider.ErrorClassification{Class: provider.ErrorClassTimeout}
+	case errors.Is(err, ErrBudgetExceeded):
+		var budgetErr *budgetExceededError
+		classification := provider.ErrorClassification{Class: provider.ErrorClassRateLimit}
+		if errors.As(err, &budgetErr) {
+			classification.RetryAfter = time.Until(budgetErr.resetAt)
+		}
+		return classification
+	default:
+		return provider.ClassifyError(providerName, err)
+	}
+}
+
+// errorCodeForClass 将错误分类映射为接口错误码，无法识别的错误归为上游错误
+func errorCodeForClass(class string) string {
+	switch class {
+	case provider.ErrorClassCancelled:
+		return model.ErrCodeCancelled
+	case provider.ErrorClassTimeout:
+		return model.ErrCodeTimeout
+	case provider.ErrorClassContentPolicy:
+		return model.ErrCodeSafetyBlocked
+	case provider.ErrorClassBadParams:
+		return model.ErrCodeValidationFailed
+	default:
+		return model.ErrCodeUpstreamError
+	}
+}
+
+// runProvider 根据任务参数中的 operation 分派到对应的 Provider 能力
+func runProvider(ctx context.Context, p provider.Provider, params map[string]interface{}) (*provider.ProviderResult, error) {
+	op, _ := params["operation"].(string)
+	switch op {
+	case "upscale":
+		upscaler, ok := p.(provider.Upscaler)
+		if !ok || !provider.GetCapabilities(p).Upscale {
+			return nil, fmt.Errorf("Provider %s 不支持放大", p.Name())
+		}
+		sourcePath, _ := params["source_path"].(string)
+		data, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取待放大的原图失败: %w", err)
+		}
+		factor, _ := params["scale"].(int)
+		return upscaler.Upscale(ctx, data, factor, params)
+	default:
+		return p.Generate(ctx, params)
+	}
+}
+
+// deadlineWarnPercent 已用时间达到超时时间的该比例时发出临近超时事件
+const deadlineWarnPercent = 80
+
+// taskTimeout 优先使用任务参数中的 timeout_seconds，否则使用 Provider 配置的超时
+func taskTimeout(task *Task) time.Duration {
+	var seconds int
+	switch v := task.Params["timeout_seconds"].(type) {
+	case int:
+		seconds = v
+	case float64:
+		seconds = int(v)
+	}
+	if seconds > 0 {
+		return time.Duration(ClampTaskTimeout(seconds)) * time.Second
+	}
+	return fetchProviderTimeout(task.TaskModel.ProviderName)
+}
+
+// ClampTaskTimeout 将任务级超时限制在 tasks.min_timeout_seconds ~ tasks.max_timeout_seconds 之间
+func ClampTaskTimeout(seconds int) int {
+	tasks := config.Get().Tasks
+	minSeconds := tasks.MinTimeoutSeconds
+	if minSeconds <= 0 {
+		minSeconds = 30
+	}
+	maxSeconds := tasks.MaxTimeoutSeconds
+	if maxSeconds < minSeconds {
+		maxSeconds = minSeconds
+	}
+	if seconds < minSeconds {
+		return minSeconds
+	}
+	if seconds > maxSeconds {
+		return maxSeconds
+	}
+	return seconds
 }
 
 func fetchProviderTimeout(providerName string) time.Duration {
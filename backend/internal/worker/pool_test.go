@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestStopDropsQueuedHandlerJobs(t *testing.T) {
+	InitPool(1, 600)
+	wp := Pool
+	wp.Start()
+
+	started := make(chan struct{})
+	var cancelled atomic.Bool
+	// 第一个作业占住唯一的 Worker，直到 Stop 取消其 Context
+	wp.SubmitLow(&Task{Handler: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled.Store(true)
+		return ctx.Err()
+	}})
+	<-started
+
+	var ran atomic.Int32
+	const queued = 500
+	for i := 0; i < queued; i++ {
+		if !wp.SubmitLow(&Task{Handler: func(ctx context.Context) error {
+			ran.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}}) {
+			t.Fatalf("第 %d 个作业入队失败", i)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wp.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop 在排空后台作业，未及时返回")
+	}
+
+	if !cancelled.Load() {
+		t.Fatal("正在执行的作业未收到取消")
+	}
+	if n := ran.Load(); n != 0 {
+		t.Fatalf("Stop 后仍执行了 %d 个排队中的作业", n)
+	}
+	if n := wp.droppedJobs.Load(); n != queued {
+		t.Fatalf("丢弃的作业数 = %d，期望 %d", n, queued)
+	}
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"log"
+	"sync"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+)
+
+// progressStep 进度至少变化该百分比才写库，避免流式上游频繁推送时反复更新任务记录
+const progressStep = 5
+
+// progressReporter 将 Provider 上报的生成进度写入任务记录，并通知 SSE / WebSocket 推送；
+// 进度只增不减。每次上报都视为任务仍在推进，刷新心跳
+func (wp *WorkerPool) progressReporter(taskID string) provider.ProgressFunc {
+	var mu sync.Mutex
+	last := 0
+	return func(percent int) {
+		wp.beat(taskID)
+		mu.Lock()
+		if percent <= last || (percent-last < progressStep && percent < 100) {
+			mu.Unlock()
+			return
+		}
+		last = percent
+		mu.Unlock()
+
+		if err := model.DB.Model(&model.Task{}).Where("task_id = ? AND status = ?", taskID, "processing").
+			Update("progress", percent).Error; err != nil {
+			log.Printf("任务 %s 更新生成进度失败: %v", taskID, err)
+			return
+		}
+		notifyTaskUpdate(taskID)
+	}
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/provider"
+)
+
+// StatusRateLimited 上游限流后等待自动重试的任务状态，next_attempt_at 为下次尝试时间
+const StatusRateLimited = "rate_limited"
+
+// maxRateLimitDelay 上游建议的等待时间超过该值时不再自动重试，直接标记失败
+const maxRateLimitDelay = 10 * time.Minute
+
+// requeueRetryDelay 到点时普通队列已满，隔该时间后再尝试放回队列
+const requeueRetryDelay = 5 * time.Second
+
+// retryRateLimited 上游限流并给出重试时间时，将任务转为 rate_limited 并在该时间后重新入队，
+// 自动重试次数不超过 Provider 的 max_retries；返回 false 表示不满足条件，由调用方按失败处理
+func (wp *WorkerPool) retryRateLimited(task *Task, err error) bool {
+	classification := classifyTaskError(task.TaskModel.ProviderName, err)
+	if classification.Class != provider.ErrorClassRateLimit || classification.RetryAfter <= 0 || classification.RetryAfter > maxRateLimitDelay {
+		return false
+	}
+	maxRetries := providerMaxRetries(task.TaskModel.ProviderName)
+	if task.TaskModel.RateLimitRetry >= maxRetries {
+		return false
+	}
+
+	taskID := task.TaskModel.TaskID
+	attempt := task.TaskModel.RateLimitRetry + 1
+	nextAttempt := time.Now().Add(classification.RetryAfter)
+	log.Printf("任务 %s 触发上游限流，%s 后进行第 %d/%d 次重试: %v", taskID, classification.RetryAfter, attempt, maxRetries, err)
+	RecordTaskEvent(taskID, EventRateLimited, "retry_after=%s attempt=%d/%d %v", classification.RetryAfter, attempt, maxRetries, err)
+	model.DB.Model(task.TaskModel).Updates(map[string]interface{}{
+		"status":           StatusRateLimited,
+		"progress":         0,
+		"error_message":    err.Error(),
+		"error_class":      classification.Class,
+		"retry_after":      int(math.Ceil(classification.RetryAfter.Seconds())),
+		"next_attempt_at":  &nextAttempt,
+		"rate_limit_retry": attempt,
+	})
+	task.TaskModel.RateLimitRetry = attempt
+	notifyTaskUpdate(taskID)
+
+	wp.delayedMu.Lock()
+	defer wp.delayedMu.Unlock()
+	if !wp.stopping {
+		wp.delayed[taskID] = time.AfterFunc(classification.RetryAfter, func() { wp.requeue(task) })
+	}
+	return true
+}
+
+// requeue 等待结束后将任务放回普通队列；等待期间任务被取消、删除或服务正在停止时放弃
+func (wp *WorkerPool) requeue(task *Task) {
+	taskID := task.TaskModel.TaskID
+	wp.delayedMu.Lock()
+	defer wp.delayedMu.Unlock()
+	if _, ok := wp.delayed[taskID]; !ok || wp.stopping {
+		return
+	}
+	delete(wp.delayed, taskID)
+
+	var current model.Task
+	if err := model.DB.Select("status").Where("task_id = ?", taskID).First(&current).Error; err != nil || current.Status != StatusRateLimited {
+		return
+	}
+	reservation, ok := wp.Reserve(context.Background(), 0)
+	if !ok {
+		wp.delayed[taskID] = time.AfterFunc(requeueRetryDelay, func() { wp.requeue(task) })
+		return
+	}
+	model.DB.Model(task.TaskModel).Updates(map[string]interface{}{"status": "pending", "next_attempt_at": nil})
+	notifyTaskUpdate(taskID)
+	reservation.Submit(task)
+}
+
+// cancelDelayed 撤销限流等待中的任务的重试定时器，返回任务是否处于等待中
+func (wp *WorkerPool) cancelDelayed(taskID string) bool {
+	wp.delayedMu.Lock()
+	defer wp.delayedMu.Unlock()
+	timer, ok := wp.delayed[taskID]
+	if ok {
+		timer.Stop()
+		delete(wp.delayed, taskID)
+	}
+	return ok
+}
+
+// stopDelayed 停止所有重试定时器，停止后不再有任务被放回队列
+func (wp *WorkerPool) stopDelayed() {
+	wp.delayedMu.Lock()
+	defer wp.delayedMu.Unlock()
+	wp.stopping = true
+	for taskID, timer := range wp.delayed {
+		timer.Stop()
+		delete(wp.delayed, taskID)
+	}
+}
+
+// failInterruptedRateLimited 任务参数只保存在内存中，重启前仍在限流等待的任务无法恢复，统一标记为失败
+func failInterruptedRateLimited() {
+	if model.DB == nil {
+		return
+	}
+	result := model.DB.Model(&model.Task{}).Where("status = ?", StatusRateLimited).Updates(map[string]interface{}{
+		"status":          "failed",
+		"error_message":   "服务重启，限流等待中的任务已中止",
+		"error_code":      model.ErrCodeUpstreamError,
+		"next_attempt_at": nil,
+	})
+	if result.Error != nil {
+		log.Printf("清理限流等待中的任务失败: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("已将 %d 个重启前限流等待中的任务标记为失败", result.RowsAffected)
+	}
+}
+
+// providerMaxRetries 读取 Provider 配置的 max_retries，未配置时不自动重试
+func providerMaxRetries(providerName string) int {
+	if model.DB == nil {
+		return 0
+	}
+	var cfg model.ProviderConfig
+	if err := model.DB.Select("max_retries").Where("provider_name = ?", providerName).First(&cfg).Error; err != nil {
+		return 0
+	}
+	return cfg.MaxRetries
+}
@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"image-gen-service/internal/model"
+	"image-gen-service/internal/storage"
+)
+
+const (
+	// thumbnailQueueSize 等待生成缩略图的任务数上限，队列满时任务保持 pending，下次启动时补齐
+	thumbnailQueueSize = 256
+	// thumbnailWorkers 生成缩略图的并发数，大图解码占用内存较多，保持较小
+	thumbnailWorkers = 2
+)
+
+var (
+	thumbnailQueue     chan string
+	thumbnailQueueOnce sync.Once
+	// thumbnailsInFlight 已排队或正在生成的缩略图数
+	thumbnailsInFlight atomic.Int64
+
+	thumbnailHooksMu sync.RWMutex
+	thumbnailHooks   []func(taskID string)
+)
+
+// OnThumbnailUpdate 注册缩略图状态变化通知（生成成功或失败），供图库推送卡片刷新
+func OnThumbnailUpdate(fn func(taskID string)) {
+	thumbnailHooksMu.Lock()
+	defer thumbnailHooksMu.Unlock()
+	thumbnailHooks = append(thumbnailHooks, fn)
+}
+
+func notifyThumbnailUpdate(taskID string) {
+	thumbnailHooksMu.RLock()
+	defer thumbnailHooksMu.RUnlock()
+	for _, fn := range thumbnailHooks {
+		fn(taskID)
+	}
+}
+
+// StartThumbnails 启动缩略图生成协程，并重新排入上次退出时仍为 pending 的任务
+func StartThumbnails() {
+	thumbnailQueueOnce.Do(func() {
+		thumbnailQueue = make(chan string, thumbnailQueueSize)
+		for i := 0; i < thumbnailWorkers; i++ {
+			go func() {
+				for taskID := range thumbnailQueue {
+					if err := GenerateTaskThumbnail(taskID); err != nil {
+						log.Printf("任务 %s 生成缩略图失败: %v", taskID, err)
+					}
+					thumbnailsInFlight.Add(-1)
+				}
+			}()
+		}
+	})
+
+	var pending []string
+	if err := model.DB.Model(&model.Task{}).Where("thumb_status = ?", model.ThumbnailPending).
+		Order("id ASC").Limit(thumbnailQueueSize).Pluck("task_id", &pending).Error; err != nil {
+		log.Printf("查询待生成缩略图的任务失败: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Printf("重新排入 %d 个待生成缩略图的任务", len(pending))
+	}
+	for _, taskID := range pending {
+		enqueueThumbnail(taskID)
+	}
+}
+
+// enqueueThumbnail 将任务加入缩略图队列，不阻塞 Worker；队列未启动或已满时返回 false，任务保持 pending
+func enqueueThumbnail(taskID string) bool {
+	if thumbnailQueue == nil {
+		return false
+	}
+	thumbnailsInFlight.Add(1)
+	select {
+	case thumbnailQueue <- taskID:
+		return true
+	default:
+		thumbnailsInFlight.Add(-1)
+		log.Printf("缩略图队列已满，任务 %s 的缩略图稍后补齐", taskID)
+		return false
+	}
+}
+
+// WaitThumbnailsIdle 等待已排队的缩略图全部生成完毕，超时返回 false。供测试在切换数据库前确认没有后台写入
+func WaitThumbnailsIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for thumbnailsInFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// GenerateTaskThumbnail 为已保存原图的任务生成缩略图并写回任务记录，失败时标记 thumbnail_status=failed，
+// 可通过缩略图重新生成作业重试
+func GenerateTaskThumbnail(taskID string) error {
+	var task model.Task
+	if err := model.DB.Select("id", "task_id", "local_path", "width", "height", "sync_status", "sync_error").
+		Where("task_id = ?", taskID).First(&task).Error; err != nil {
+		return fmt.Errorf("查询任务失败: %w", err)
+	}
+
+	result, err := generateThumbnail(&task)
+	updates := map[string]interface{}{}
+	if err != nil {
+		updates["thumb_status"] = model.ThumbnailFailed
+		RecordTaskEvent(taskID, EventThumbnail, "failed %v", err)
+	} else {
+		updates["thumb_status"] = model.ThumbnailReady
+		updates["thumbnail_path"] = result.ThumbLocalPath
+		updates["thumbnail_hash"] = result.ThumbHash
+		updates["thumbnail_url"] = result.ThumbRemoteURL
+		updates["perceptual_hash"] = result.PerceptualHash
+		if task.Width == 0 || task.Height == 0 {
+			updates["width"] = result.Width
+			updates["height"] = result.Height
+		}
+		// 原图已同步而缩略图上传失败时记为部分同步，可由 OSS 同步重试作业补传
+		if result.RemoteError != "" && task.SyncStatus == storage.RemoteSyncSynced {
+			updates["sync_status"] = storage.RemoteSyncPartial
+			updates["sync_error"] = result.RemoteError
+		}
+		RecordTaskEvent(taskID, EventThumbnail, "ready thumbnail=%s", result.ThumbLocalPath)
+	}
+
+	if dbErr := model.DB.Model(&model.Task{}).Where("id = ?", task.ID).Updates(updates).Error; dbErr != nil {
+		return fmt.Errorf("更新任务失败: %w", dbErr)
+	}
+	notifyTaskUpdate(taskID)
+	notifyThumbnailUpdate(taskID)
+	return err
+}
+
+func generateThumbnail(task *model.Task) (*storage.ThumbnailResult, error) {
+	if strings.TrimSpace(task.LocalPath) == "" {
+		return nil, fmt.Errorf("任务没有本地原图")
+	}
+	return storage.GenerateThumbnail(task.LocalPath)
+}
@@ -0,0 +1,6 @@
+// Package apitypes 定义 HTTP 接口的请求与响应结构，服务端与 pkg/client 共用同一份定义，
+// 字段名与 JSON 标签只在这里维护。
+//
+// 任务记录的 JSON 结构由服务端的数据模型直接序列化，Task 是其对外字段的镜像，
+// 修改任务模型的 JSON 字段时需要同步更新 Task。
+package apitypes
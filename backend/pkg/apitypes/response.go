@@ -0,0 +1,17 @@
+package apitypes
+
+// Response 所有接口统一的响应外层结构
+type Response struct {
+	Code      int         `json:"code"`                 // 业务状态码: 200 为成功，其他为失败
+	Message   string      `json:"message"`              // 提示信息
+	Data      interface{} `json:"data"`                 // 返回数据
+	ErrorCode string      `json:"error_code,omitempty"` // 失败时的错误码，取值见 model/error_codes.go
+}
+
+// FieldError 参数校验失败时 data.errors 中的单项，Allowed 仅在参数取值为固定枚举时给出
+type FieldError struct {
+	Field   string      `json:"field"`
+	Message string      `json:"message"`
+	Allowed []string    `json:"allowed,omitempty"`
+	Got     interface{} `json:"got,omitempty"`
+}
@@ -0,0 +1,158 @@
+package apitypes
+
+import "time"
+
+// GenerateRequest 生成图片请求参数
+type GenerateRequest struct {
+	Provider string                 `json:"provider" binding:"required"`
+	ModelID  string                 `json:"model_id"`
+	Params   map[string]interface{} `json:"params"`
+	// DedupeWarn 为 true 时检查近期是否生成过相近的提示词，命中时随任务一起返回（不阻止生成）
+	DedupeWarn bool `json:"dedupe_warn"`
+	// AutoCancelOnDisconnect 为 true 时任务排队期间没有 SSE / WebSocket / 长轮询连接超过宽限时间即自动取消
+	AutoCancelOnDisconnect bool `json:"auto_cancel_on_disconnect"`
+	// Fanout count 大于 1 时的拆分方式: single_task（默认，一个任务生成全部图片）/ per_image（每张图片一个任务，共享 group_id）
+	Fanout string `json:"fanout"`
+}
+
+// GenerateWithImagesRequest generate-with-images 的 JSON 请求体，字段名与 multipart 表单一致。
+// count、private、auto_cancel_on_disconnect 同时接受 JSON 原生类型与字符串
+type GenerateWithImagesRequest struct {
+	Provider    string      `json:"provider"`
+	ModelID     string      `json:"model_id"`
+	Prompt      string      `json:"prompt"`
+	AspectRatio string      `json:"aspectRatio"`
+	ImageSize   string      `json:"imageSize"`
+	Count       interface{} `json:"count"`
+	Private     interface{} `json:"private"`
+	AutoCancel  interface{} `json:"auto_cancel_on_disconnect"`
+	RefPaths    []string    `json:"refPaths"`
+	RefImages   []string    `json:"reference_images_base64"` // data URL 或裸 base64
+}
+
+// ExportImagesRequest 批量导出图片的请求体
+type ExportImagesRequest struct {
+	ImageIDs    []string `json:"imageIds"`
+	ImageIDsAlt []string `json:"image_ids"`
+	// Format 导出格式: zip（默认）或 pdf
+	Format string `json:"format"`
+	// IncludeHeader PDF 每页顶部是否显示提示词与生成时间
+	IncludeHeader bool `json:"include_header"`
+}
+
+// Task 任务记录的对外字段，与服务端任务模型的 JSON 序列化结果一致；
+// 排队估算、最近事件与可重试标记仅在任务详情与状态推送中返回
+type Task struct {
+	ID             uint       `json:"id"`
+	TaskID         string     `json:"task_id"`
+	Prompt         string     `json:"prompt"`
+	PromptPreview  string     `json:"prompt_preview"`
+	Truncated      bool       `json:"truncated,omitempty"`
+	ProviderName   string     `json:"provider_name"`
+	ModelID        string     `json:"model_id"`
+	Status         string     `json:"status"`
+	Progress       int        `json:"progress,omitempty"`
+	ErrorMessage   string     `json:"error_message"`
+	ErrorCode      string     `json:"error_code,omitempty"`
+	ErrorClass     string     `json:"error_class,omitempty"`
+	RetryAfter     int        `json:"retry_after,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	RateLimitRetry int        `json:"rate_limit_retries,omitempty"`
+	ImageURL       string     `json:"image_url"`
+	LocalPath      string     `json:"local_path"`
+	ThumbnailURL   string     `json:"thumbnail_url"`
+	ThumbnailPath  string     `json:"thumbnail_path"`
+	ThumbnailHash  string     `json:"thumbnail_hash,omitempty"`
+	ThumbnailSrc   string     `json:"thumbnail_src,omitempty"`
+	ThumbStatus    string     `json:"thumbnail_status,omitempty"`
+	SyncStatus     string     `json:"remote_sync_status,omitempty"`
+	SyncError      string     `json:"remote_sync_error,omitempty"`
+	Width          int        `json:"width"`
+	Height         int        `json:"height"`
+	AspectRatio    string     `json:"requested_aspect_ratio,omitempty"`
+	AspectMismatch bool       `json:"aspect_mismatch,omitempty"`
+	Cropped        bool       `json:"cropped,omitempty"`
+	OriginalPath   string     `json:"original_path,omitempty"`
+	OriginalWidth  int        `json:"original_width,omitempty"`
+	OriginalHeight int        `json:"original_height,omitempty"`
+	FileSize       int64      `json:"file_size"`
+	ContentHash    string     `json:"content_hash,omitempty"`
+	PerceptualHash string     `json:"perceptual_hash,omitempty"`
+	TotalCount     int        `json:"total_count"`
+	ConfigSnapshot string     `json:"config_snapshot"`
+	TaskType       string     `json:"task_type"`
+	ParentTaskID   string     `json:"parent_task_id"`
+	RootTaskID     string     `json:"root_task_id,omitempty"`
+	GroupID        string     `json:"group_id,omitempty"`
+	Caption        string     `json:"caption"`
+	Favorite       bool       `json:"favorite"`
+	Private        bool       `json:"private"`
+	AutoCancel     bool       `json:"auto_cancel_on_disconnect,omitempty"`
+	Tags           []string   `json:"tags,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ArchivedAt     *time.Time `json:"archived_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at"`
+
+	QueueEstimate *QueueEstimate `json:"queue_estimate,omitempty"`
+	LatestEvent   *TaskEvent     `json:"latest_event,omitempty"`
+	Retryable     *bool          `json:"retryable,omitempty"`
+}
+
+// Terminal 任务是否已结束（完成、导入或失败，取消的任务记为失败），结束后状态不再变化
+func (t *Task) Terminal() bool {
+	return t.Status == "completed" || t.Status == "imported" || t.Status == "failed"
+}
+
+// Settled 任务已结束且缩略图不再等待后台生成；完成的任务在缩略图就绪前还会再推送一次
+func (t *Task) Settled() bool {
+	return t.Terminal() && t.ThumbStatus != "pending"
+}
+
+// TaskEvent 任务处理事件
+type TaskEvent struct {
+	ID        uint      `json:"id"`
+	TaskID    string    `json:"task_id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueueEstimate 排队位置与预计等待时间，均为估算值
+type QueueEstimate struct {
+	Estimated bool `json:"estimated"`
+	// Position 当前任务在同一 Provider 队列中的位置（从 1 开始）
+	Position int64 `json:"position"`
+	// Ahead 排在前面的任务数（含正在处理中的任务）
+	Ahead int64 `json:"ahead"`
+	// ETASeconds 预计完成所需的秒数；尚无历史耗时数据时为空
+	ETASeconds *int64 `json:"eta_seconds,omitempty"`
+}
+
+// SimilarPrompt 近期提示词相近的历史任务
+type SimilarPrompt struct {
+	TaskID        string    `json:"task_id"`
+	Prompt        string    `json:"prompt"`
+	Similarity    float64   `json:"similarity"`
+	ThumbnailPath string    `json:"thumbnail_path"`
+	ThumbnailURL  string    `json:"thumbnail_url"`
+	ThumbnailSrc  string    `json:"thumbnail_src,omitempty"`
+	LocalPath     string    `json:"local_path"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// GenerateResponse 生成接口的响应。单个任务时任务字段在顶层；fanout=per_image 时
+// 顶层只有 GroupID 与 Tasks
+type GenerateResponse struct {
+	Task
+	GroupID      string          `json:"group_id,omitempty"`
+	Tasks        []Task          `json:"tasks,omitempty"`
+	SimilarTasks []SimilarPrompt `json:"similar_tasks,omitempty"`
+	Warning      string          `json:"warning,omitempty"`
+}
+
+// ImageList 图库列表接口的响应；游标分页时 NextCursor 为下一页游标，没有更多数据时为空
+type ImageList struct {
+	Total      int64  `json:"total"`
+	List       []Task `json:"list"`
+	NextCursor string `json:"next_cursor"`
+}
@@ -0,0 +1,285 @@
+// Package client 是图片生成服务 HTTP 接口的 Go 客户端，请求与响应结构与服务端共用 pkg/apitypes。
+//
+// 所有方法都接受 context.Context，取消或超时会立即中止请求。请求在连接失败与 429 / 503 时按指数退避自动重试，
+// 并遵循服务端返回的 Retry-After；其他网络错误与 502 / 504 只重试幂等请求，避免重复创建任务。
+// 提交任务并等待结束的完整用法见 Example。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-gen-service/pkg/apitypes"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryWait  = 500 * time.Millisecond
+	// maxRetryWait 单次重试等待的上限，Retry-After 超过该值时同样按上限等待
+	maxRetryWait = 30 * time.Second
+	apiPrefix    = "/api/v1"
+)
+
+// Client 图片生成服务客户端，可被多个 goroutine 并发使用
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	maxRetries int
+	retryWait  time.Duration
+}
+
+// Option 客户端配置项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 http.Client；流式接口长时间保持连接，不要设置 Client.Timeout，
+// 请通过 Context 控制超时
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithAPIToken 以 Authorization: Bearer 方式携带 API Token
+func WithAPIToken(token string) Option {
+	return func(c *Client) {
+		c.token = strings.TrimSpace(token)
+	}
+}
+
+// WithRetries 设置暂时性错误的最大重试次数与首次重试等待时间，maxRetries 为 0 时不重试
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		if maxRetries >= 0 {
+			c.maxRetries = maxRetries
+		}
+		if wait > 0 {
+			c.retryWait = wait
+		}
+	}
+}
+
+// New 创建客户端，baseURL 为服务地址（如 http://127.0.0.1:8080），不含 /api/v1
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		retryWait:  defaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError 服务端返回的业务错误
+type APIError struct {
+	StatusCode int    // HTTP 状态码
+	Code       int    // 响应中的业务状态码
+	ErrorCode  string // 错误码，如 VALIDATION_FAILED、TASK_NOT_FOUND
+	Message    string
+	// Data 错误附带的数据，如参数校验失败时的字段列表
+	Data json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("接口错误 %d (%s): %s", e.StatusCode, e.ErrorCode, e.Message)
+	}
+	return fmt.Sprintf("接口错误 %d: %s", e.StatusCode, e.Message)
+}
+
+// FieldErrors 参数校验失败时返回各字段的错误，其他错误返回 nil
+func (e *APIError) FieldErrors() []apitypes.FieldError {
+	var data struct {
+		Errors []apitypes.FieldError `json:"errors"`
+	}
+	if len(e.Data) == 0 || json.Unmarshal(e.Data, &data) != nil {
+		return nil
+	}
+	return data.Errors
+}
+
+// IsNotFound 错误是否为资源不存在
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// envelope 解析响应外层时保留 data 的原始内容，再按各接口的类型解析
+type envelope struct {
+	Code      int             `json:"code"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data"`
+	ErrorCode string          `json:"error_code,omitempty"`
+}
+
+// request 一次请求的描述；body 以字节保存，重试时可以重复发送
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   []byte
+	accept string
+	// idempotent 为 false 时只在请求确定未被服务端处理（连接失败、429、503）时重试，避免重复创建任务
+	idempotent bool
+}
+
+// do 发送请求并在暂时性错误时重试；成功时返回未读取的响应，由调用方关闭 Body
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	target := c.baseURL + apiPrefix + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if r.body != nil {
+			body = bytes.NewReader(r.body)
+		}
+		req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		if r.body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if r.accept != "" {
+			req.Header.Set("Accept", r.accept)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || !retryableNetError(err, r.idempotent) || attempt >= c.maxRetries {
+				return nil, err
+			}
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return resp, nil
+		default:
+			apiErr := readAPIError(resp)
+			if !retryableStatus(resp.StatusCode, r.idempotent) || attempt >= c.maxRetries {
+				return nil, apiErr
+			}
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+
+		delay := wait + time.Duration(rand.Int63n(int64(wait)/2+1))
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if delay > maxRetryWait {
+			delay = maxRetryWait
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		wait *= 2
+	}
+}
+
+// doJSON 发送请求并把响应 data 解析到 out；out 为 nil 时忽略 data
+func (c *Client) doJSON(ctx context.Context, r request, out interface{}) error {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	if env.Code != 0 && env.Code != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode, Code: env.Code, ErrorCode: env.ErrorCode, Message: env.Message, Data: env.Data}
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("解析响应数据失败: %w", err)
+	}
+	return nil
+}
+
+func readAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	apiErr := &APIError{StatusCode: resp.StatusCode, Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var env envelope
+	if json.Unmarshal(data, &env) == nil && (env.Message != "" || env.Code != 0) {
+		apiErr.Code = env.Code
+		apiErr.ErrorCode = env.ErrorCode
+		apiErr.Message = env.Message
+		apiErr.Data = env.Data
+	} else if text := strings.TrimSpace(string(data)); text != "" {
+		apiErr.Message = text
+	}
+	return apiErr
+}
+
+// retryableStatus 限流与服务暂不可用时请求没有被处理，任何请求都可以重试；
+// 网关错误时请求可能已被处理，只重试幂等请求
+func retryableStatus(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// retryableNetError 连接建立失败时请求一定没有发出，可以重试；其他网络错误只重试幂等请求
+func retryableNetError(err error, idempotent bool) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotent
+}
+
+// parseRetryAfter 支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"image-gen-service/pkg/apitypes"
+)
+
+func writeOK(w http.ResponseWriter, data string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"code":200,"message":"success","data":%s}`, data)
+}
+
+// TestGenerateRetriesQueueFull 队列已满（503）时请求未被处理，非幂等的提交同样重试
+func TestGenerateRetriesQueueFull(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"code":503,"message":"服务器繁忙，请稍后再试","error_code":"QUEUE_FULL"}`)
+			return
+		}
+		writeOK(w, `{"task_id":"t-1","status":"pending"}`)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRetries(3, time.Millisecond))
+	task, err := c.Generate(context.Background(), apitypes.GenerateRequest{Provider: "fake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.TaskID != "t-1" || calls.Load() != 3 {
+		t.Fatalf("task=%s calls=%d", task.TaskID, calls.Load())
+	}
+}
+
+// TestGenerateDoesNotRetryBadGateway 网关错误时提交可能已被处理，非幂等请求不重试，幂等请求重试
+func TestGenerateDoesNotRetryBadGateway(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRetries(2, time.Millisecond))
+	_, err := c.Generate(context.Background(), apitypes.GenerateRequest{Provider: "fake"})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("提交被发送了 %d 次", n)
+	}
+
+	calls.Store(0)
+	if _, err := c.GetTask(context.Background(), "t-1"); err == nil {
+		t.Fatal("期望返回错误")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("幂等请求发送了 %d 次，期望 3 次", n)
+	}
+}
+
+// TestStreamTaskReconnects 状态流在任务结束前断开时自动重连，直到收到结束状态
+func TestStreamTaskReconnects(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if conns.Add(1) == 1 {
+			fmt.Fprint(w, "data: {\"task_id\":\"t-1\",\"status\":\"processing\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, "data: {\"task_id\":\"t-1\",\"status\":\"failed\",\"error_code\":\"TIMEOUT\"}\n\n")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRetries(2, time.Millisecond))
+	updates, errs := c.StreamTask(context.Background(), "t-1")
+	var statuses []string
+	for task := range updates {
+		statuses = append(statuses, task.Status)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(statuses) != "[processing failed]" || conns.Load() != 2 {
+		t.Fatalf("statuses=%v conns=%d", statuses, conns.Load())
+	}
+}
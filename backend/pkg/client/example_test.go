@@ -0,0 +1,148 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"image-gen-service/pkg/apitypes"
+	"image-gen-service/pkg/client"
+)
+
+// newExampleServer 模拟服务端的生成、状态推送、详情与图库接口，任务 t-1 依次经历排队、处理与完成
+func newExampleServer() *httptest.Server {
+	writeData := func(w http.ResponseWriter, status int, resp apitypes.Response) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+	completed := apitypes.Task{TaskID: "t-1", Status: "completed", Width: 1024, Height: 1024}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/tasks/generate", func(w http.ResponseWriter, r *http.Request) {
+		var req apitypes.GenerateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Params["prompt"] == nil {
+			writeData(w, http.StatusBadRequest, apitypes.Response{
+				Code:      400,
+				Message:   "参数校验失败",
+				ErrorCode: "VALIDATION_FAILED",
+				Data: map[string]interface{}{"errors": []apitypes.FieldError{
+					{Field: "prompt", Message: "prompt 不能为空"},
+				}},
+			})
+			return
+		}
+		writeData(w, http.StatusOK, apitypes.Response{Code: 200, Message: "success", Data: apitypes.Task{TaskID: "t-1", Status: "pending"}})
+	})
+	mux.HandleFunc("GET /api/v1/tasks/t-1/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": padding\n\n")
+		for _, status := range []string{"pending", "processing"} {
+			fmt.Fprintf(w, "data: {\"task_id\":\"t-1\",\"status\":%q}\n\n", status)
+		}
+		fmt.Fprint(w, "event: ping\ndata: {}\n\n")
+		data, _ := json.Marshal(completed)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	})
+	mux.HandleFunc("GET /api/v1/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "t-1" {
+			writeData(w, http.StatusNotFound, apitypes.Response{Code: 404, Message: "任务未找到", ErrorCode: "TASK_NOT_FOUND"})
+			return
+		}
+		writeData(w, http.StatusOK, apitypes.Response{Code: 200, Message: "success", Data: completed})
+	})
+	mux.HandleFunc("GET /api/v1/images", func(w http.ResponseWriter, r *http.Request) {
+		list := apitypes.ImageList{Total: 1, List: []apitypes.Task{{TaskID: "t-1", Status: "completed", PromptPreview: "a red fox"}}}
+		if r.URL.Query().Get("fields") == "prompt" {
+			list.List[0].Prompt = "a red fox in snow"
+		}
+		writeData(w, http.StatusOK, apitypes.Response{Code: 200, Message: "success", Data: list})
+	})
+	return httptest.NewServer(mux)
+}
+
+// 提交任务并通过 SSE 等待任务结束
+func Example() {
+	srv := newExampleServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := client.New(srv.URL, client.WithAPIToken("token"))
+	task, err := c.Generate(ctx, apitypes.GenerateRequest{
+		Provider: "gemini",
+		Params:   map[string]interface{}{"prompt": "a red fox in snow"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	updates, errs := c.StreamTask(ctx, task.TaskID)
+	for t := range updates {
+		fmt.Printf("%s: %s\n", t.TaskID, t.Status)
+	}
+	if err := <-errs; err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// t-1: pending
+	// t-1: processing
+	// t-1: completed
+}
+
+func ExampleClient_GetTask() {
+	srv := newExampleServer()
+	defer srv.Close()
+	c := client.New(srv.URL)
+
+	task, err := c.GetTask(context.Background(), "t-1")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(task.Status, task.Width, task.Height)
+
+	_, err = c.GetTask(context.Background(), "missing")
+	fmt.Println(client.IsNotFound(err))
+	// Output:
+	// completed 1024 1024
+	// true
+}
+
+func ExampleClient_ListImages() {
+	srv := newExampleServer()
+	defer srv.Close()
+	c := client.New(srv.URL)
+
+	list, err := c.ListImages(context.Background(), client.ListImagesOptions{PageSize: 20, WithPrompt: true})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, task := range list.List {
+		fmt.Printf("%s %q\n", task.TaskID, task.Prompt)
+	}
+	// Output:
+	// t-1 "a red fox in snow"
+}
+
+func ExampleAPIError_FieldErrors() {
+	srv := newExampleServer()
+	defer srv.Close()
+	c := client.New(srv.URL)
+
+	_, err := c.Generate(context.Background(), apitypes.GenerateRequest{Provider: "gemini"})
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		fmt.Println(apiErr.StatusCode, apiErr.ErrorCode)
+		for _, field := range apiErr.FieldErrors() {
+			fmt.Println(field.Field, strings.TrimSpace(field.Message))
+		}
+	}
+	// Output:
+	// 400 VALIDATION_FAILED
+	// prompt prompt 不能为空
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"image-gen-service/pkg/apitypes"
+)
+
+// ListImagesOptions 图库列表的分页与筛选条件，零值字段不作为条件
+type ListImagesOptions struct {
+	Page     int
+	PageSize int
+	// Cursor 上一页返回的 NextCursor，设置后忽略 Page
+	Cursor string
+	// Sort 排序字段，Order 为 asc / desc
+	Sort  string
+	Order string
+	// WithPrompt 为 true 时返回完整提示词，否则只返回 prompt_preview
+	WithPrompt      bool
+	Keyword         string
+	ParentTaskID    string
+	GroupID         string
+	TaskType        string
+	Tag             string
+	Favorite        *bool
+	Private         *bool
+	IncludeArchived bool
+}
+
+func (o ListImagesOptions) values() url.Values {
+	q := url.Values{}
+	setInt := func(key string, v int) {
+		if v > 0 {
+			q.Set(key, strconv.Itoa(v))
+		}
+	}
+	setString := func(key, v string) {
+		if v = strings.TrimSpace(v); v != "" {
+			q.Set(key, v)
+		}
+	}
+	setBool := func(key string, v *bool) {
+		if v != nil {
+			q.Set(key, strconv.FormatBool(*v))
+		}
+	}
+	setInt("page", o.Page)
+	setInt("page_size", o.PageSize)
+	setString("cursor", o.Cursor)
+	setString("sort", o.Sort)
+	setString("order", o.Order)
+	setString("keyword", o.Keyword)
+	setString("parent_task_id", o.ParentTaskID)
+	setString("group_id", o.GroupID)
+	setString("task_type", o.TaskType)
+	setString("tag", o.Tag)
+	setBool("favorite", o.Favorite)
+	setBool("private", o.Private)
+	if o.WithPrompt {
+		q.Set("fields", "prompt")
+	}
+	if o.IncludeArchived {
+		q.Set("include_archived", "true")
+	}
+	return q
+}
+
+// ListImages 查询图库列表
+func (c *Client) ListImages(ctx context.Context, opts ListImagesOptions) (*apitypes.ImageList, error) {
+	var list apitypes.ImageList
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/images", query: opts.values(), idempotent: true}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Export 把图片导出为 zip（默认）或 pdf 并写入 w，返回写入的字节数。
+// 导出内容以流的方式写入，写入中途出错时 w 中可能已有部分数据
+func (c *Client) Export(ctx context.Context, req apitypes.ExportImagesRequest, w io.Writer) (int64, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	// 导出不修改数据，可以安全重试
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/images/export", body: body, idempotent: true})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"image-gen-service/pkg/apitypes"
+)
+
+// maxSSELine 单条 SSE 数据的长度上限，任务中的完整提示词可能有数 KB
+const maxSSELine = 1 << 20
+
+// Generate 提交文生图任务。fanout=per_image 时返回的 GroupID 与 Tasks 为拆分出的全部任务
+func (c *Client) Generate(ctx context.Context, req apitypes.GenerateRequest) (*apitypes.GenerateResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp apitypes.GenerateResponse
+	if err := c.doJSON(ctx, request{method: http.MethodPost, path: "/tasks/generate", body: body}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GenerateWithImages 提交图生图任务，images 为参考图的原始字节，以 base64 内联在 JSON 请求中发送，
+// 追加在 req.RefImages 之后
+func (c *Client) GenerateWithImages(ctx context.Context, req apitypes.GenerateWithImagesRequest, images ...[]byte) (*apitypes.GenerateResponse, error) {
+	refs := make([]string, 0, len(req.RefImages)+len(images))
+	refs = append(refs, req.RefImages...)
+	for _, data := range images {
+		refs = append(refs, InlineImage(data))
+	}
+	req.RefImages = refs
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp apitypes.GenerateResponse
+	if err := c.doJSON(ctx, request{method: http.MethodPost, path: "/tasks/generate-with-images", body: body}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// InlineImage 把图片编码为 data URL，可直接放入 GenerateWithImagesRequest.RefImages
+func InlineImage(data []byte) string {
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// GetTask 查询任务详情
+func (c *Client) GetTask(ctx context.Context, taskID string) (*apitypes.Task, error) {
+	var task apitypes.Task
+	path := "/tasks/" + url.PathEscape(taskID)
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: path, idempotent: true}, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// StreamTask 通过 SSE 订阅任务状态，每次状态变化向 updates 发送一次，任务结束且缩略图就绪后关闭两个通道。
+// 连接中断时按重试设置自动重连，服务端重连后会先推送当前状态；errs 最多返回一个错误，
+// 正常结束时不返回错误。调用方需要读完 updates，或取消 ctx 提前结束
+func (c *Client) StreamTask(ctx context.Context, taskID string) (<-chan apitypes.Task, <-chan error) {
+	updates := make(chan apitypes.Task)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(updates)
+
+		wait := c.retryWait
+		failures := 0
+		for {
+			done, received, err := c.streamOnce(ctx, taskID, updates)
+			if done {
+				return
+			}
+			if ctx.Err() != nil {
+				errs <- ctx.Err()
+				return
+			}
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				errs <- err
+				return
+			}
+			if received {
+				// 连接期间收到过数据，说明服务可用，重新计算退避
+				failures, wait = 0, c.retryWait
+			}
+			if failures >= c.maxRetries {
+				if err == nil {
+					err = errors.New("任务状态流在任务结束前断开")
+				}
+				errs <- err
+				return
+			}
+			failures++
+			if err := sleep(ctx, wait); err != nil {
+				errs <- err
+				return
+			}
+			wait *= 2
+			if wait > maxRetryWait {
+				wait = maxRetryWait
+			}
+		}
+	}()
+	return updates, errs
+}
+
+// streamOnce 建立一次 SSE 连接并转发任务状态；done 表示任务已结束，received 表示本次连接收到过任务数据
+func (c *Client) streamOnce(ctx context.Context, taskID string, updates chan<- apitypes.Task) (done, received bool, err error) {
+	// 重连由 StreamTask 负责，这里只尝试一次
+	once := *c
+	once.maxRetries = 0
+	resp, err := once.do(ctx, request{
+		method:     http.MethodGet,
+		path:       "/tasks/" + url.PathEscape(taskID) + "/stream",
+		accept:     "text/event-stream",
+		idempotent: true,
+	})
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+	var event string
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// 空行结束一条事件；只处理默认事件，忽略 ping 等保活事件
+			if data.Len() > 0 && (event == "" || event == "message") {
+				var task apitypes.Task
+				if err := json.Unmarshal(data.Bytes(), &task); err != nil {
+					return false, received, fmt.Errorf("解析任务状态失败: %w", err)
+				}
+				received = true
+				select {
+				case updates <- task:
+				case <-ctx.Done():
+					return false, received, ctx.Err()
+				}
+				if task.Settled() {
+					return true, received, nil
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// 注释行（首包填充）
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return false, received, scanner.Err()
+}
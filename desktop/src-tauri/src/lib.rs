@@ -16,6 +16,9 @@ struct PortPayload {
     port: u16,
 }
 
+/// 向后端标准输入写心跳的间隔，需与后端 stdinHeartbeatInterval 保持一致
+const SIDECAR_HEARTBEAT_SECS: u64 = 2;
+
 struct BackendPort(Arc<Mutex<u16>>);
 struct SidecarState(Arc<Mutex<Option<CommandChild>>>);
 struct GenerationState(Arc<Mutex<bool>>);
@@ -580,6 +583,24 @@ pub fn run() {
             app.manage(SidecarState(sidecar_state.clone()));
             let child_clone = sidecar_state.clone();
 
+            // 定期向后端写入心跳，后端据此判断父进程是否存活（连续多次未收到心跳才会退出）
+            let heartbeat_state = sidecar_state.clone();
+            std::thread::spawn(move || loop {
+                std::thread::sleep(std::time::Duration::from_secs(SIDECAR_HEARTBEAT_SECS));
+                let mut guard = match heartbeat_state.lock() {
+                    Ok(guard) => guard,
+                    Err(_) => break,
+                };
+                match guard.as_mut() {
+                    Some(child) => {
+                        if child.write(b"\n").is_err() {
+                            break;
+                        }
+                    }
+                    None => break,
+                }
+            });
+
             let app_handle = app.handle().clone();
             let port_state_inner = port_state_for_setup.clone();
             let log_state_for_task = log_state.clone();
@@ -392,7 +392,7 @@ export const ImageCard = React.memo(function ImageCard({
             <img
               ref={imgRef}
               src={image.thumbnailUrl || image.url}
-              alt={image.prompt || t('generate.card.imageAlt')}
+              alt={image.prompt || image.promptPreview || t('generate.card.imageAlt')}
               className="w-full h-full object-cover"
               loading="lazy"
               decoding="async"
@@ -438,8 +438,8 @@ export const ImageCard = React.memo(function ImageCard({
 
       {/* 信息区域 - 保持与历史区一致的样式 */}
       <div className="p-2 sm:p-3 flex flex-col gap-1.5 sm:gap-2 flex-shrink-0 bg-white">
-        <p className="text-[10px] sm:text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed h-8 sm:h-9" title={image.prompt}>
-          {image.prompt || t('generate.card.emptyPrompt')}
+        <p className="text-[10px] sm:text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed h-8 sm:h-9" title={image.prompt || image.promptPreview}>
+          {image.prompt || image.promptPreview || t('generate.card.emptyPrompt')}
         </p>
 
         <div className="flex items-center justify-between text-[8px] sm:text-[9px] text-gray-400 pt-1 border-t border-gray-50 mt-auto">
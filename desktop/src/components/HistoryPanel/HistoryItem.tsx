@@ -23,7 +23,7 @@ export const HistoryItem = React.memo(function HistoryItem({ item, onDelete }: H
         {imageUrl ? (
             <img
                 src={imageUrl}
-                alt={item.prompt}
+                alt={item.prompt || item.promptPreview}
                 className="w-full h-full object-cover"
                 loading="lazy"
                 decoding="async"
@@ -39,7 +39,7 @@ export const HistoryItem = React.memo(function HistoryItem({ item, onDelete }: H
       </div>
       <div className="flex-1 min-w-0 flex flex-col justify-between py-1">
         <div>
-            <p className="text-sm text-gray-900 font-medium line-clamp-2 mb-1">{item.prompt}</p>
+            <p className="text-sm text-gray-900 font-medium line-clamp-2 mb-1">{item.prompt || item.promptPreview}</p>
             <div className="flex items-center gap-3 text-xs text-gray-500">
                 <span>{item.model}</span>
                 <span>•</span>
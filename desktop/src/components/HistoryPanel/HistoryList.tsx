@@ -141,6 +141,7 @@ export function HistoryList() {
                       url: img.url || getImageUrl(img.filePath || img.thumbnailPath),
                       thumbnailUrl: img.thumbnailUrl || getImageUrl(img.thumbnailPath || img.filePath),
                       prompt: task.prompt || '',
+                      promptPreview: task.promptPreview || task.prompt || '',
                       model: task.model || '',
                       taskCreatedAt: task.createdAt || new Date().toISOString(),
                       // 基于图片真实的 width 和 height 计算标签
@@ -11,6 +11,7 @@ import { toast } from '../../store/toastStore';
 import { VersionBadge } from '../common/VersionBadge';
 import { InternalDragLayer } from '../common/InternalDragLayer';
 import { getTaskStatus } from '../../services/generateApi';
+import type { StartupStatus } from '../../services/historyApi';
 import { getUpdateSource } from '../../store/updateSourceStore';
 
 // 使用懒加载减少初始包体积
@@ -80,14 +81,29 @@ export default function MainLayout() {
 
     let retryCount = 0;
     const maxRetries = 5;
+    // 同一个降级原因只提示一次，后端恢复后清空
+    let lastDegradedReason = '';
 
     const checkHealth = async () => {
       try {
         await api.get('/health');
         setIsBackendHealthy(true);
         retryCount = 0; // 重置重试计数
+        lastDegradedReason = '';
       } catch (error) {
         console.error('Backend health check failed:', error);
+
+        // 数据库只读或被锁定时后端以降级模式运行，健康检查返回启动失败的原因，直接展示而不是等待重试
+        const startup = (error as any)?.response?.data?.data?.startup as StartupStatus | undefined;
+        if (startup?.status === 'degraded') {
+          setIsBackendHealthy(false);
+          const reason = startup.hint || startup.error || '';
+          if (reason !== lastDegradedReason) {
+            lastDegradedReason = reason;
+            toast.error(t('layout.toast.backendDegraded', { reason }));
+          }
+          return;
+        }
         
         // 只有在重试多次都失败后才提示用户，给 Sidecar 启动留出时间
         if (retryCount >= maxRetries) {
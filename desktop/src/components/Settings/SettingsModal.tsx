@@ -16,7 +16,9 @@ import appIcon from '../../assets/app-icon.png';
 
 const CHAT_PROVIDER_OPTIONS = [
   { value: 'gemini-chat', label: 'Gemini(/v1beta)', defaultBase: 'https://generativelanguage.googleapis.com' },
-  { value: 'openai-chat', label: 'OpenAI(/v1)', defaultBase: 'https://api.openai.com/v1' }
+  { value: 'openai-chat', label: 'OpenAI(/v1)', defaultBase: 'https://api.openai.com/v1' },
+  { value: 'anthropic-chat', label: 'Anthropic Claude', defaultBase: 'https://api.anthropic.com' },
+  { value: 'deepseek-chat', label: 'DeepSeek', defaultBase: 'https://api.deepseek.com' }
 ];
 const DEFAULT_CHAT_PROVIDER = 'openai-chat';
 
@@ -338,7 +340,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
         api_key: imageKey,
         enabled: true,
         model_id: imageModelValue,
-        timeout_seconds: imageTimeoutValue
+        timeout_seconds: imageTimeoutValue,
+        purpose: 'image'
       });
 
       // 保存识图配置
@@ -349,7 +352,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
         api_key: visionKey,
         enabled: false,
         model_id: visionModelValue,
-        timeout_seconds: visionTimeoutValue
+        timeout_seconds: visionTimeoutValue,
+        purpose: 'chat'
       });
       setVisionSyncedConfig({ apiBaseUrl: visionBase, apiKey: visionKey, model: visionModelValue, timeoutSeconds: visionTimeoutValue });
 
@@ -361,7 +365,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
           api_key: chatKey,
           enabled: false,
           model_id: chatModelValue,
-          timeout_seconds: chatTimeoutValue
+          timeout_seconds: chatTimeoutValue,
+          purpose: 'chat'
         });
         setChatSyncedConfig({ apiBaseUrl: chatBase, apiKey: chatKey, model: chatModelValue, timeoutSeconds: chatTimeoutValue });
       } else {
@@ -942,9 +947,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
                 value={visionApiBaseUrl || ''}
                 onChange={(e) => setVisionApiBaseUrl(e.target.value)}
                 placeholder={
-                  visionProvider === 'gemini-chat'
-                    ? 'https://generativelanguage.googleapis.com'
-                    : 'https://api.openai.com/v1'
+                  CHAT_PROVIDER_OPTIONS.find((option) => option.value === visionProvider)?.defaultBase
+                    ?? 'https://api.openai.com/v1'
                 }
                 className="h-10 bg-slate-100 text-slate-900 font-medium rounded-2xl text-sm px-5 focus:bg-white border border-slate-200 transition-all shadow-none"
               />
@@ -1057,9 +1061,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
                 value={chatApiBaseUrl || ''}
                 onChange={(e) => setChatApiBaseUrl(e.target.value)}
                 placeholder={
-                  chatProvider === 'gemini-chat'
-                    ? 'https://generativelanguage.googleapis.com'
-                    : 'https://api.openai.com/v1'
+                  CHAT_PROVIDER_OPTIONS.find((option) => option.value === chatProvider)?.defaultBase
+                    ?? 'https://api.openai.com/v1'
                 }
                 className="h-10 bg-slate-100 text-slate-900 font-medium rounded-2xl text-sm px-5 focus:bg-white border border-slate-200 transition-all shadow-none"
               />
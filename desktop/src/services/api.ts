@@ -298,6 +298,11 @@ export const getImageUrl = (path: string) => {
   return url;
 };
 
+// 获取经后端代理的图片 URL：本地文件已清理、只剩远程地址时由后端拉取，避免存储桶的 CORS 限制
+export const getImageProxyUrl = (id: string, thumb = false) => {
+    return `${BASE_URL}/images/${id}/proxy${thumb ? '?thumb=1' : ''}`;
+};
+
 // 获取图片下载 URL
 export const getImageDownloadUrl = (id: string) => {
     return `${BASE_URL}/images/${id}/download`;
@@ -12,6 +12,19 @@ export interface HealthCheckResponse {
   message: string;
 }
 
+// 启动状态：数据库只读或被锁定时后端以降级模式运行，error_kind / hint 说明原因
+export interface StartupStatus {
+  status: 'initializing' | 'degraded' | 'ready';
+  error?: string;
+  error_kind?: 'read_only' | 'locked' | 'unavailable' | 'other';
+  hint?: string;
+  db_path: string;
+  attempts: number;
+  last_attempt_at?: string;
+  next_retry_at?: string;
+  ready_at?: string;
+}
+
 // 获取历史列表 (支持关键词搜索和分页)
 // 后端统一使用 /images 接口，通过 keyword 参数过滤
 // 注意：API 拦截器已解包 response.data，所以返回的是实际数据类型
@@ -58,3 +71,11 @@ export const exportImages = async (imageIds: string[]): Promise<ExportImagesResu
 // 检查服务是否正常运行
 export const healthCheck = () =>
   api.get<HealthCheckResponse>('/health');
+
+// 查询启动状态（降级模式下仍可访问）
+export const getStartupStatus = () =>
+  api.get<StartupStatus>('/startup-status');
+
+// 立即重新检查数据库并完成启动，仍不可用时返回 503
+export const retryStartup = () =>
+  api.post<StartupStatus>('/startup/retry');
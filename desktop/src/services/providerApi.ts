@@ -9,6 +9,15 @@ export interface ProviderConfig {
     model_id?: string;
     models?: string;
     timeout_seconds?: number;
+    // 默认生成参数 JSON（如 {"aspect_ratio":"16:9"}），请求未指定的参数按此补全
+    default_params?: string;
+    purpose?: 'image' | 'chat';
+    // 单次生成数量上限（params.count），仅生图配置返回
+    max_count?: number;
+    // 尚未完成的任务数，仅生图配置返回
+    queued_tasks?: number;
+    // 已停用但仍在执行停用前排队的任务
+    draining?: boolean;
 }
 
 export const getProviders = async (): Promise<ProviderConfig[]> => {
@@ -69,6 +69,7 @@ const mergeTask = (existing: HistoryItem | undefined, incoming: HistoryTaskUpdat
     ...existing,
     ...incoming,
     prompt: incoming.prompt || existing.prompt,
+    promptPreview: incoming.promptPreview || existing.promptPreview,
     model: incoming.model || existing.model,
     options: incoming.options || existing.options,
     errorMessage: incoming.errorMessage || existing.errorMessage,
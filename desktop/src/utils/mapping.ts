@@ -1,14 +1,23 @@
 import { GenerationTask, GeneratedImage, BackendTask, BackendHistoryResponse } from '../types';
-import { getImageUrl } from '../services/api';
+import { getImageUrl, getImageProxyUrl } from '../services/api';
 
 /**
  * 将后端 Task 模型映射为前端 GenerationTask 模型
  */
 export const mapBackendTaskToFrontend = (task: BackendTask): GenerationTask => {
+  // 图库列表不返回完整提示词，prompt 保持为空，由需要完整内容的视图从任务详情加载
+  const prompt = task.prompt ?? '';
+  const promptPreview = task.prompt_preview || prompt;
   const getFullUrl = (path: string | undefined) => {
     return getImageUrl(path || '');
   };
 
+  // thumbnail_src 在没有本地缩略图时是 OSS 地址，此时改走代理
+  const localThumb = (task.thumbnail_path && (task.thumbnail_src || task.thumbnail_path)) || task.local_path;
+
+  // 导入的图片（imported）与生成完成的图片展示方式一致
+  const finished = task.status === 'completed' || task.status === 'imported';
+
   const image: GeneratedImage = {
     id: task.task_id,
     taskId: task.task_id,
@@ -19,24 +28,36 @@ export const mapBackendTaskToFrontend = (task: BackendTask): GenerationTask => {
     height: task.height || 0,
     mimeType: 'image/jpeg',
     createdAt: task.created_at,
-    prompt: task.prompt,
+    prompt,
+    promptPreview,
     // 生成弹窗需要展示模型：对齐历史记录的 task.model 显示逻辑
     model: task.model_id || task.provider_name || '',
-    status: task.status === 'completed' ? 'success' : (task.status === 'failed' ? 'failed' : 'pending'),
-    // 弹窗预览使用原图
-    url: getFullUrl(task.local_path || task.image_url || task.thumbnail_path || task.thumbnail_url),
+    status: finished ? 'success' : (task.status === 'failed' ? 'failed' : 'pending'),
+    // 弹窗预览使用原图；只有远程地址时经后端代理，不受存储桶 CORS 限制
+    url: task.local_path ? getFullUrl(task.local_path)
+      : task.image_url ? getImageProxyUrl(task.task_id)
+      : getFullUrl(task.thumbnail_path || task.thumbnail_url),
     // 卡片展示优先使用缩略图
-    thumbnailUrl: getFullUrl(task.thumbnail_path || task.local_path || task.thumbnail_url || task.image_url)
+    thumbnailUrl: localThumb ? getFullUrl(localThumb)
+      : task.thumbnail_url ? getImageProxyUrl(task.task_id, true)
+      : task.image_url ? getImageProxyUrl(task.task_id) : '',
+    remoteSyncStatus: task.remote_sync_status,
+    aspectMismatch: task.aspect_mismatch,
+    requestedAspectRatio: task.requested_aspect_ratio
   };
 
   return {
     id: task.task_id,
-    prompt: task.prompt,
+    prompt,
+    promptPreview,
     model: task.model_id || task.provider_name || '',
     totalCount: task.total_count || 1,
-    completedCount: task.status === 'completed' ? (task.total_count || 1) : 0,
-    status: task.status as GenerationTask['status'],
+    completedCount: finished ? (task.total_count || 1) : 0,
+    // 限流等待中的任务按排队中展示，并附带下次重试时间
+    status: (finished ? 'completed' : (task.status === 'rate_limited' ? 'pending' : task.status)) as GenerationTask['status'],
+    nextAttemptAt: task.next_attempt_at,
     errorMessage: task.error_message || '',
+    errorCode: task.error_code,
     options: task.config_snapshot || '',
     createdAt: task.created_at,
     updatedAt: task.updated_at || '',
@@ -1,10 +1,11 @@
 import React, { useState, useRef, useEffect, useCallback, useMemo } from 'react';
 import { Modal } from '../common/Modal';
-import { GeneratedImage } from '../../types';
+import { GeneratedImage, BackendTask, BackendTaskReference } from '../../types';
 import { Button } from '../common/Button';
 import { Download, Copy, Calendar, Box, Maximize2, X, ZoomIn, ZoomOut, ChevronLeft, ChevronRight, Trash2, Check } from 'lucide-react';
 import { formatDateTime } from '../../utils/date';
-import { getImageDownloadUrl } from '../../services/api';
+import { getImageDownloadUrl, getImageUrl } from '../../services/api';
+import { getHistoryDetail } from '../../services/historyApi';
 import { useHistoryStore } from '../../store/historyStore';
 import { toast } from '../../store/toastStore';
 import { useTranslation } from 'react-i18next';
@@ -31,6 +32,9 @@ export const ImagePreview = React.memo(function ImagePreview({
     const [isDeleting, setIsDeleting] = useState(false);
     const [showDeleteConfirm, setShowDeleteConfirm] = useState(false);
     const [copySuccess, setCopySuccess] = useState(false);
+    const [references, setReferences] = useState<BackendTaskReference[]>([]);
+    // 图库列表只带截断的预览，复制与展示使用从任务详情加载的完整提示词
+    const [fullPrompt, setFullPrompt] = useState(image?.prompt || '');
     const [isWheelZooming, setIsWheelZooming] = useState(false);
     const containerRef = useRef<HTMLDivElement>(null);
     const deleteConfirmTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
@@ -80,6 +84,26 @@ export const ImagePreview = React.memo(function ImagePreview({
         onClose();
     }, [onClose]);
 
+    // 加载任务详情：完整提示词与参考图（参考图仅图生图任务有记录）
+    useEffect(() => {
+        setReferences([]);
+        setFullPrompt(image?.prompt || '');
+        const taskId = image?.taskId;
+        if (!taskId) return;
+        let cancelled = false;
+        getHistoryDetail(taskId)
+            .then((res) => {
+                if (cancelled) return;
+                const task = res as unknown as BackendTask;
+                setReferences(task.references || []);
+                if (task.prompt) setFullPrompt(task.prompt);
+            })
+            .catch(() => {});
+        return () => {
+            cancelled = true;
+        };
+    }, [image?.taskId, image?.prompt]);
+
     // 键盘监听 - 优化性能
     useEffect(() => {
         const handleKeyDown = (e: KeyboardEvent) => {
@@ -200,7 +224,7 @@ export const ImagePreview = React.memo(function ImagePreview({
 
     // 处理复制提示词 - 优先使用同步方案，速度最快
     const handleCopyPrompt = useCallback(() => {
-        if (!image?.prompt) return;
+        if (!fullPrompt) return;
 
         // 清除之前的定时器
         if (copySuccessTimerRef.current) {
@@ -209,7 +233,7 @@ export const ImagePreview = React.memo(function ImagePreview({
 
         // 方案1: 同步的 document.execCommand (最快，立即返回)
         const textArea = document.createElement('textarea');
-        textArea.value = image.prompt;
+        textArea.value = fullPrompt;
         textArea.style.position = 'fixed';
         textArea.style.opacity = '0';
         document.body.appendChild(textArea);
@@ -228,7 +252,7 @@ export const ImagePreview = React.memo(function ImagePreview({
             }, 2000);
         } else {
             // 方案1失败，尝试方案2: Clipboard API
-            navigator.clipboard.writeText(image.prompt)
+            navigator.clipboard.writeText(fullPrompt)
                 .then(() => {
                     setCopySuccess(true);
                     toast.success(t('toast.copyPromptSuccess'));
@@ -242,7 +266,7 @@ export const ImagePreview = React.memo(function ImagePreview({
                     toast.error(t('toast.copyFailedManual'));
                 });
         }
-    }, [image?.prompt]);
+    }, [fullPrompt]);
 
     if (!image) return null;
 
@@ -382,7 +406,7 @@ export const ImagePreview = React.memo(function ImagePreview({
                         <img
                             ref={imageRef}
                             src={image.url}
-                            alt={image.prompt}
+                            alt={fullPrompt || image.promptPreview}
                             className="max-w-full max-h-full object-contain shadow-2xl rounded-lg"
                             decoding="async"
                             draggable={false}
@@ -453,10 +477,10 @@ export const ImagePreview = React.memo(function ImagePreview({
                                 <h3 className="text-xs font-bold text-slate-400 uppercase tracking-widest">{t('preview.prompt.label')}</h3>
                                 <button
                                     onClick={handleCopyPrompt}
-                                    disabled={!image.prompt}
+                                    disabled={!fullPrompt}
                                     className={`
                                         text-xs font-bold flex items-center gap-1.5 py-1 px-2 rounded-lg transition-all
-                                        ${!image.prompt
+                                        ${!fullPrompt
                                             ? 'text-slate-400 cursor-not-allowed bg-slate-50'
                                             : copySuccess
                                                 ? 'text-green-600 bg-green-50'
@@ -476,12 +500,41 @@ export const ImagePreview = React.memo(function ImagePreview({
                                 </button>
                             </div>
                             <div className="flex-1 bg-slate-50 p-5 rounded-2xl border border-slate-100 text-sm text-slate-700 leading-relaxed whitespace-pre-wrap overflow-y-auto scrollbar-thin">
-                                {image.prompt || t('preview.prompt.empty')}
+                                {fullPrompt || image.promptPreview || t('preview.prompt.empty')}
                             </div>
                         </div>
                     </div>
 
                     <div className="flex-shrink-0">
+                        {references.length > 0 && (
+                            <div className="px-8 pt-5 border-t border-slate-50 bg-white">
+                                <h3 className="text-xs font-bold text-slate-400 uppercase tracking-widest mb-3">{t('preview.references.label', { count: references.length })}</h3>
+                                <div className="flex gap-2 overflow-x-auto scrollbar-thin pb-1">
+                                    {references.map((ref) => {
+                                        const src = ref.thumbnail_url || ref.url;
+                                        return src ? (
+                                            <a
+                                                key={ref.position}
+                                                href={getImageUrl(ref.url || src)}
+                                                target="_blank"
+                                                rel="noreferrer"
+                                                className="flex-shrink-0 w-14 h-14 rounded-xl overflow-hidden border border-slate-100 bg-slate-50"
+                                            >
+                                                <img src={getImageUrl(src)} alt="" className="w-full h-full object-cover" loading="lazy" draggable={false} />
+                                            </a>
+                                        ) : (
+                                            <div
+                                                key={ref.position}
+                                                title={ref.sha256}
+                                                className="flex-shrink-0 w-14 h-14 rounded-xl border border-dashed border-slate-200 bg-slate-50 flex items-center justify-center text-[10px] font-mono text-slate-400"
+                                            >
+                                                {ref.sha256.slice(0, 6)}
+                                            </div>
+                                        );
+                                    })}
+                                </div>
+                            </div>
+                        )}
                         <div className="px-8 py-5 space-y-4 border-t border-slate-50 bg-white">
                             <div className="flex items-center justify-between text-sm">
                                 <span className="text-slate-400 font-medium flex items-center gap-2.5"><Box className="w-4 h-4" /> {t('preview.meta.model')}</span>
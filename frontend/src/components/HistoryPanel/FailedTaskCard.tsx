@@ -85,6 +85,15 @@ export const FailedTaskCard = React.memo(function FailedTaskCard({ task, onClick
                     borderColor: 'border-red-200'
                 };
             case 'pending':
+                if (task.nextAttemptAt) {
+                    return {
+                        icon: <Loader2 className="w-8 h-8 text-orange-500 animate-spin" />,
+                        title: t('history.status.rateLimited.title'),
+                        description: t('history.status.rateLimited.description', { time: formatDateTime(task.nextAttemptAt) }),
+                        bgColor: 'bg-orange-50',
+                        borderColor: 'border-orange-200'
+                    };
+                }
                 return {
                     icon: <Loader2 className="w-8 h-8 text-blue-500 animate-spin" />,
                     title: t('history.status.pending.title'),
@@ -125,7 +134,7 @@ export const FailedTaskCard = React.memo(function FailedTaskCard({ task, onClick
                     borderColor: 'border-gray-200'
                 };
         }
-    }, [task.status, task.errorMessage, task.completedCount, task.totalCount, t]);
+    }, [task.status, task.errorMessage, task.completedCount, task.totalCount, task.nextAttemptAt, t]);
 
     return (
         <div
@@ -239,8 +248,8 @@ export const FailedTaskCard = React.memo(function FailedTaskCard({ task, onClick
 
                 {/* 任务信息 */}
                 <div className="w-full min-h-0">
-                    <p className="text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed mb-3" title={task.prompt}>
-                        {task.prompt || t('history.prompt.empty')}
+                    <p className="text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed mb-3" title={task.prompt || task.promptPreview}>
+                        {task.prompt || task.promptPreview || t('history.prompt.empty')}
                     </p>
 
                     <div className="flex items-center justify-between text-[9px] text-gray-400 pt-1">
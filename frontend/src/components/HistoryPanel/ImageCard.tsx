@@ -263,7 +263,7 @@ export const ImageCard = React.memo(function ImageCard({ image, onClick }: Image
                 <img
                     ref={imgRef}
                     src={image.thumbnailUrl || image.url}
-                    alt={image.prompt}
+                    alt={image.prompt || image.promptPreview}
                     className="w-full h-full object-cover"
                     loading="lazy"
                     decoding="async"
@@ -274,8 +274,8 @@ export const ImageCard = React.memo(function ImageCard({ image, onClick }: Image
 
             {/* 简要信息 */}
             <div className="p-2 sm:p-3 flex flex-col gap-1.5 sm:gap-2 flex-shrink-0">
-                <p className="text-[10px] sm:text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed" title={image.prompt}>
-                    {image.prompt}
+                <p className="text-[10px] sm:text-xs text-gray-800 line-clamp-2 font-medium leading-relaxed" title={image.prompt || image.promptPreview}>
+                    {image.prompt || image.promptPreview}
                 </p>
 
                 <div className="flex items-center justify-between text-[8px] sm:text-[9px] text-gray-400 pt-1 border-t border-gray-50 mt-auto">
@@ -13,7 +13,9 @@ import { getSystemLocale } from '../../i18n/systemLocale';
 
 const CHAT_PROVIDER_OPTIONS = [
   { value: 'gemini-chat', label: 'Gemini(/v1beta)', defaultBase: 'https://generativelanguage.googleapis.com' },
-  { value: 'openai-chat', label: 'OpenAI(/v1)', defaultBase: 'https://api.openai.com/v1' }
+  { value: 'openai-chat', label: 'OpenAI(/v1)', defaultBase: 'https://api.openai.com/v1' },
+  { value: 'anthropic-chat', label: 'Anthropic Claude', defaultBase: 'https://api.anthropic.com' },
+  { value: 'deepseek-chat', label: 'DeepSeek', defaultBase: 'https://api.deepseek.com' }
 ];
 const DEFAULT_CHAT_PROVIDER = 'openai-chat';
 
@@ -229,7 +231,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
         api_key: imageKey,
         enabled: true,
         model_id: imageModelValue,
-        timeout_seconds: imageTimeoutValue
+        timeout_seconds: imageTimeoutValue,
+        purpose: 'image'
       });
 
       if (wantsChat) {
@@ -240,7 +243,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
           api_key: chatKey,
           enabled: false,
           model_id: chatModelValue,
-          timeout_seconds: chatTimeoutValue
+          timeout_seconds: chatTimeoutValue,
+          purpose: 'chat'
         });
         setChatSyncedConfig({ apiBaseUrl: chatBase, apiKey: chatKey, model: chatModelValue, timeoutSeconds: chatTimeoutValue });
       } else {
@@ -555,9 +559,8 @@ export function SettingsModal({ isOpen, onClose }: SettingsModalProps) {
                 value={chatApiBaseUrl || ''}
                 onChange={(e) => setChatApiBaseUrl(e.target.value)}
                 placeholder={
-                  chatProvider === 'gemini-chat'
-                    ? 'https://generativelanguage.googleapis.com'
-                    : 'https://api.openai.com/v1'
+                  CHAT_PROVIDER_OPTIONS.find((option) => option.value === chatProvider)?.defaultBase
+                    ?? 'https://api.openai.com/v1'
                 }
                 className="h-10 bg-slate-100 text-slate-900 font-medium rounded-2xl text-sm px-5 focus:bg-white border border-slate-200 transition-all shadow-none"
               />
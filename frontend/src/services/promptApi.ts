@@ -2,6 +2,8 @@ import api from './api';
 
 export interface OptimizePromptResponse {
   prompt: string;
+  // 后端检测到（或请求中指定）的提示词语言
+  language?: string;
 }
 
 export interface OptimizePromptRequest {
@@ -9,6 +11,8 @@ export interface OptimizePromptRequest {
   model: string;
   prompt: string;
   response_format?: string;
+  // 可选，指定输出语言；留空时由后端按输入自动检测
+  language?: string;
 }
 
 const extractPrompt = (value: any): string => {
@@ -29,5 +33,9 @@ const extractPrompt = (value: any): string => {
 
 export const optimizePrompt = async (payload: OptimizePromptRequest): Promise<OptimizePromptResponse> => {
   const res = await api.post<any>('/prompts/optimize', payload);
-  return { prompt: extractPrompt(res) };
+  const data = res && typeof res === 'object' && 'data' in res ? (res as any).data : res;
+  return {
+    prompt: extractPrompt(res),
+    language: typeof data?.language === 'string' ? data.language : undefined,
+  };
 };
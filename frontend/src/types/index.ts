@@ -5,6 +5,14 @@ export interface ApiResponse<T> {
   data: T;
 }
 
+// 参数校验失败（error_code=VALIDATION_FAILED）时 data.errors 的单项
+export interface ValidationFieldError {
+  field: string;
+  message: string;
+  allowed?: string[];  // 取值为固定枚举时的可选值
+  got?: unknown;
+}
+
 // 图片模型
 export interface GeneratedImage {
   id: string;
@@ -19,10 +27,17 @@ export interface GeneratedImage {
   // 前端辅助字段
   url?: string;
   thumbnailUrl?: string;
+  // 完整提示词；图库列表只带 promptPreview，完整内容需从任务详情加载
   prompt?: string;
+  promptPreview?: string;
   status?: 'pending' | 'success' | 'failed';
   model?: string;
   options?: string | ImageOptions;
+  // OSS 同步状态，非 synced 时图片可能仅存在于本地
+  remoteSyncStatus?: 'synced' | 'partial' | 'failed';
+  // 实际宽高比与请求比例不符
+  aspectMismatch?: boolean;
+  requestedAspectRatio?: string;
 }
 
 // 图片选项配置
@@ -35,12 +50,17 @@ export interface ImageOptions {
 export interface GenerationTask {
   id: string;
   prompt: string;
+  // 截断的提示词预览，仅用于列表展示，不能代替 prompt
+  promptPreview?: string;
   model: string;
   totalCount: number;
   completedCount: number;
   status: 'pending' | 'processing' | 'completed' | 'failed' | 'partial';
   options: string;
   errorMessage: string;
+  errorCode?: string;
+  // 上游限流后等待自动重试的时间，仅排队中的任务有值
+  nextAttemptAt?: string;
   createdAt: string;
   updatedAt: string;
   images: GeneratedImage[];
@@ -144,11 +164,17 @@ export interface TemplateListResponse {
 // 后端 Task 模型（用于 API 响应）
 export interface BackendTask {
   task_id: string;
-  prompt: string;
+  // 图库列表默认不返回完整提示词（需 fields=prompt），只返回 prompt_preview
+  prompt?: string;
+  prompt_preview?: string;
   model_id?: string;
   provider_name?: string;
   local_path?: string;
   thumbnail_path?: string;
+  // 后端计算好的缩略图访问地址（内容哈希命名，可长期缓存）
+  thumbnail_src?: string;
+  // 缩略图在任务完成后于后台生成：pending 期间卡片回退显示原图，failed 可通过维护接口重新生成
+  thumbnail_status?: 'pending' | 'ready' | 'failed';
   image_url?: string;
   thumbnail_url?: string;
   width?: number;
@@ -156,13 +182,58 @@ export interface BackendTask {
   created_at: string;
   updated_at?: string;
   status: string;
+  // 生成进度百分比，仅开启 stream_progress 的中转服务会上报
+  progress?: number;
+  // 派生任务（编辑、放大、去背景等）的来源任务与派生链根任务
+  parent_task_id?: string;
+  root_task_id?: string;
+  favorite?: boolean;
+  // 私密图片，图库可按可见性筛选
+  private?: boolean;
+  tags?: string[];
   total_count?: number;
   error_message?: string;
+  // 失败原因的错误码，如 QUEUE_FULL / SAFETY_BLOCKED / TIMEOUT
+  error_code?: string;
+  // 失败原因分类与是否值得重试，仅失败任务返回
+  error_class?: string;
+  retry_after?: number;
+  // 上游限流后任务进入 rate_limited 状态，到 next_attempt_at 自动重试
+  next_attempt_at?: string;
+  rate_limit_retries?: number;
+  retryable?: boolean;
+  // 提示词超过长度上限被自动截断（prompts.auto_truncate）
+  truncated?: boolean;
+  // OSS 同步状态与失败原因，未启用 OSS 时不返回
+  remote_sync_status?: 'synced' | 'partial' | 'failed';
+  remote_sync_error?: string;
+  // 请求的宽高比及实际图片是否与之不符
+  requested_aspect_ratio?: string;
+  aspect_mismatch?: boolean;
+  // enforce_aspect=crop 裁剪后记录裁剪前的尺寸与原图路径
+  cropped?: boolean;
+  original_path?: string;
+  original_width?: number;
+  original_height?: number;
   config_snapshot?: string;
+  // 图生图任务使用的参考图，仅任务详情接口返回
+  references?: BackendTaskReference[];
+}
+
+// 任务参考图记录；按隐私设置可能只保存缩略图或只保存哈希
+export interface BackendTaskReference {
+  position: number;
+  sha256: string;
+  file_size: number;
+  width?: number;
+  height?: number;
+  url?: string;
+  thumbnail_url?: string;
 }
 
 // 后端历史列表响应
 export interface BackendHistoryResponse {
   list: BackendTask[];
   total: number;
+  next_cursor?: string;  // 游标分页：传回 cursor 参数获取下一页（需保持相同的 sort/order）
 }